@@ -11,6 +11,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -39,6 +40,7 @@ import (
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/metrics"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/middleware"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
 	"github.com/JadenRazo/Project-Website/backend/internal/core"
 	coreConfig "github.com/JadenRazo/Project-Website/backend/internal/core/config"
 	"github.com/JadenRazo/Project-Website/backend/internal/core/db"
@@ -46,6 +48,15 @@ import (
 	// "github.com/JadenRazo/Project-Website/backend/internal/devpanel/project"
 	"github.com/JadenRazo/Project-Website/backend/internal/gateway"
 	"github.com/JadenRazo/Project-Website/backend/internal/messaging"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/gc"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/scanning"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+	messagingws "github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/digest"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/push"
+	msgretention "github.com/JadenRazo/Project-Website/backend/internal/messaging/retention"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/store"
 	projectHTTP "github.com/JadenRazo/Project-Website/backend/internal/projects/delivery/http"
 	projectMemoryService "github.com/JadenRazo/Project-Website/backend/internal/projects/service"
 	"github.com/JadenRazo/Project-Website/backend/internal/status"
@@ -285,18 +296,39 @@ func main() {
 		MaxMessageSize:   cfg.Messaging.MaxMessageSize,
 		MaxAttachments:   10,
 		AllowedFileTypes: []string{"image/jpeg", "image/png", "image/gif", "application/pdf"},
+		// Redis lets every replica deliver events to its own clients and replay
+		// the ones a reconnecting client missed
+		Broker:   messagingws.NewRedisBroker(secureCacheInstance),
+		EventLog: messagingws.NewRedisEventLog(secureCacheInstance, 0),
 	}
 
 	urlShortenerService := urlshortener.NewService(gormDB, urlShortenerConfig)
 	urlShortenerService.SetAuth(authService)
 	messagingService := messaging.NewService(gormDB, messagingConfig)
+	messagingService.SetHubIDs(store.NewHubIDRepository(gormDB))
 
 	projectPathRepository := projectPathRepo.NewGormRepository(gormDB)
 
 	codeStatsService := codestats.NewService(gormDB, projectPathRepository)
+	// tokei is used when installed unless the built-in counter is requested
+	if os.Getenv("CODESTATS_COUNTER") == "native" {
+		codeStatsService.SetCounter(codestats.NewNativeCounter(0))
+	}
 
 	projectPathService := projectpath.NewServiceWithStatsUpdater(projectPathRepository, codeStatsService)
 
+	// Rescan a project when its files change; "poll" skips inotify for
+	// mounts that do not deliver its events
+	var codeStatsWatcher *codestats.Watcher
+	if watchMode := os.Getenv("CODESTATS_WATCH"); watchMode != "false" {
+		codeStatsWatcher = codestats.NewWatcher(codeStatsService, codestats.WatcherConfig{
+			ForcePolling: watchMode == "poll",
+		})
+		if err := codeStatsWatcher.Start(ctx); err != nil {
+			logger.Warn("Failed to start project path watcher", "error", err)
+		}
+	}
+
 	projectService := projectMemoryService.NewMemoryProjectService()
 
 	metricsConfig := metrics.DefaultConfig()
@@ -315,6 +347,12 @@ func main() {
 		MaxPageViewsPerSession: 100,
 		EnableBotDetection: true,
 		PrivacyMode:        "balanced",
+		Cookieless:         os.Getenv("VISITOR_COOKIELESS") == "true",
+		PrivacyRequests: visitor.PrivacyRequestConfig{
+			SigningKey: []byte(cfg.Auth.JWTSecret),
+			ExportDir:  filepath.Join("data", "privacy-exports"),
+			PublicURL:  os.Getenv("FRONTEND_URL"),
+		},
 	}
 
 	// Check visitor tables BEFORE creating the service
@@ -343,11 +381,135 @@ func main() {
 		logger.Info("Contact form email not configured, submissions will be logged only")
 	}
 
+	visitorService.PrivacyRequests().SetMailer(contact.NewMailer(contactEmailConfig))
+
 	blogRepository := blogRepo.NewGormRepository(gormDB)
 	blogService := blog.NewService(blogRepository, secureCacheInstance)
 	blogHandler := blogHTTP.NewHandler(blogService)
 
 	workerService := worker.NewService(gormDB)
+	workerService.SetPrivacyRequests(visitorService.PrivacyRequests())
+
+	// Channels without their own retention policy keep messages for
+	// MESSAGE_RETENTION_DAYS, or forever when it is unset
+	messageRetentionDays, _ := strconv.Atoi(os.Getenv("MESSAGE_RETENTION_DAYS"))
+	messageRetention, err := msgretention.NewEnforcer(gormDB, msgretention.Options{
+		DefaultDays: messageRetentionDays,
+		Mode:        os.Getenv("MESSAGE_RETENTION_MODE"),
+	})
+	if err != nil {
+		logger.Error("Message retention disabled", "error", err)
+	} else {
+		workerService.SetMessageRetention(messageRetention)
+	}
+
+	// Sending a message stores notifications for the members it mentions,
+	// and for the other members of direct channels.
+	messagingSettings := store.NewUserSettingsRepository(gormDB)
+	messagingNotifications := store.NewNotificationRepository(gormDB)
+	messagingService.SetNotifications(messagingNotifications)
+
+	// Web Push is enabled by a VAPID private key, which must stay the same
+	// once browsers have subscribed. Pushes are sent by this process's job
+	// runner, and respect each user's notification settings and channel
+	// mutes. Users connected to the WebSocket hub of any instance are not
+	// pushed, since the hub shares their presence between instances.
+	var pushHandler *push.Handler
+	if vapidKey := os.Getenv("WEB_PUSH_VAPID_PRIVATE_KEY"); vapidKey != "" {
+		vapidKeys, err := push.ParseVAPIDKeys(vapidKey)
+		if err != nil {
+			logger.Error("Web Push disabled", "error", err)
+		} else {
+			pushService := push.NewService(gormDB, vapidKeys, push.Options{
+				Subject: os.Getenv("WEB_PUSH_SUBJECT"),
+			})
+			pushService.SetJobQueue(workerService.Jobs())
+			pushService.SetUserSettings(messagingSettings)
+			pushService.SetMutes(store.NewUserMuteRepository(gormDB))
+			pushService.SetSessions(messagingService)
+			messagingService.SetNotifier(pushService)
+			workerService.Jobs().Register(push.NotifyJobType, pushService.NotifyProcessor())
+			workerService.Jobs().Register(push.DeliverJobType, pushService.DeliverProcessor())
+			pushHandler = push.NewHandler(pushService)
+		}
+	}
+
+	// Email digests are sent by the worker's hourly task to users who chose
+	// a digest frequency in their notification settings. The links they
+	// contain open frontend pages, which post the emailed token back here.
+	digestService := digest.NewService(gormDB, digest.Config{
+		SigningKey: []byte(cfg.Auth.JWTSecret),
+		PublicURL:  os.Getenv("FRONTEND_URL"),
+	})
+	digestService.SetMailer(contact.NewMailer(contactEmailConfig))
+	digestService.SetUserSettings(messagingSettings)
+	digestService.SetReadReceipts(store.NewReadReceiptRepository(gormDB))
+	digestService.SetNotifications(messagingNotifications)
+	workerService.SetEmailDigests(digestService)
+	digestHandler := digest.NewHandler(digestService)
+
+	// Attachment files are kept on local disk, or in S3 or MinIO when
+	// STORAGE_TYPE is s3. Local files are downloaded through signed URLs
+	// served on the path of STORAGE_BASE_URL. Attachments are uploaded with
+	// the resumable upload protocol and finalized into attachments, which
+	// the worker scans and processes. It also expires abandoned uploads and
+	// collects files nothing refers to.
+	storageConfig := storage.DefaultConfig()
+	if storageType := os.Getenv("STORAGE_TYPE"); storageType != "" {
+		storageConfig.Type = storage.StorageType(storageType)
+	}
+	if storagePath := os.Getenv("STORAGE_PATH"); storagePath != "" {
+		storageConfig.BasePath = storagePath
+	}
+	storageConfig.BaseURL = os.Getenv("STORAGE_BASE_URL")
+	if storageConfig.BaseURL == "" {
+		storageConfig.BaseURL = "/api/v1/files"
+	}
+	// The provider derives its own key from the secret, so falling back to
+	// the JWT secret never lets a download signature pass as a token
+	storageConfig.SigningKey = os.Getenv("STORAGE_SIGNING_KEY")
+	if storageConfig.SigningKey == "" {
+		storageConfig.SigningKey = cfg.Auth.JWTSecret
+	}
+	storageConfig.S3 = storage.S3Config{
+		Bucket:       os.Getenv("STORAGE_S3_BUCKET"),
+		Region:       os.Getenv("STORAGE_S3_REGION"),
+		Endpoint:     os.Getenv("STORAGE_S3_ENDPOINT"),
+		AccessKey:    os.Getenv("STORAGE_S3_ACCESS_KEY"),
+		SecretKey:    os.Getenv("STORAGE_S3_SECRET_KEY"),
+		UseSSL:       os.Getenv("STORAGE_S3_USE_SSL") != "false",
+		CreateBucket: os.Getenv("STORAGE_S3_CREATE_BUCKET") == "true",
+	}
+	var attachmentGC *gc.Collector
+	var uploadHandler *uploads.Handler
+	var attachmentHandler *attachments.Handler
+	storageProvider, err := storage.NewProvider(storageConfig)
+	if err != nil {
+		logger.Error("Attachment storage disabled", "error", err)
+	} else {
+		attachmentService := attachments.NewAttachmentService(storageProvider, attachments.NewRepository(gormDB), messagingService, attachments.MaxFileSize)
+		attachmentService.SetJobQueue(workerService.Jobs())
+		// Uploads are released unscanned unless clamd is reachable on
+		// CLAMD_SOCKET; blocked ones warn their uploader in the audit log
+		if clamdSocket := os.Getenv("CLAMD_SOCKET"); clamdSocket != "" {
+			attachmentService.SetScanner(scanning.NewClamdScanner(clamdSocket))
+		} else {
+			logger.Warn("Attachment malware scanning disabled: CLAMD_SOCKET is not set")
+		}
+		attachmentService.SetModerator(attachments.NewAuditModerator(gormDB))
+		workerService.Jobs().Register(attachments.ScanJobType, attachmentService.ScanProcessor())
+		workerService.Jobs().Register(attachments.ProcessImageJobType, attachmentService.ImageProcessor())
+		attachmentHandler = attachments.NewHandler(attachmentService)
+
+		uploadService := uploads.NewService(gormDB, storageProvider, uploads.Config{MaxSize: attachments.MaxFileSize})
+		uploadService.SetFinalizer(attachmentService)
+		uploadService.SetNotifier(messagingService)
+		uploadHandler = uploads.NewHandler(uploadService)
+		workerService.SetAttachmentUploads(uploadService)
+
+		attachmentGC = gc.NewCollector(gormDB, storageProvider, gc.Options{})
+		workerService.SetAttachmentGC(attachmentGC)
+	}
 
 	metricsCollector := devpanel.NewMetricsCollector(devpanel.Config{
 		MetricsInterval: 30 * time.Second,
@@ -360,6 +522,16 @@ func main() {
 		LogRetention:    7 * 24 * time.Hour,
 	})
 
+	devpanelService.SetRetentionEngine(workerService.RetentionEngine())
+	visitorService.SetRetentionEngine(workerService.RetentionEngine())
+	if messageRetention != nil {
+		devpanelService.SetMessageRetention(messageRetention)
+	}
+	if attachmentGC != nil {
+		devpanelService.SetAttachmentGC(attachmentGC)
+	}
+	devpanelService.SetCodeStatsService(codeStatsService)
+
 	logManager := devpanel.NewLogManager(
 		filepath.Join("logs", "services"),
 		cfg.MaxLogLines,
@@ -461,12 +633,16 @@ func main() {
 		}
 		logger.Info("Using default CORS origins", "origins", allowedOrigins)
 	}
+	messagingService.SetAllowedOrigins(allowedOrigins)
 
+	// The Tus- and Upload- headers are those of resumable attachment uploads
 	apiGateway.AddMiddleware(cors.New(cors.Config{
-		AllowOrigins:     allowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Request-ID"},
-		ExposeHeaders:    []string{"Content-Length", "Content-Type", "X-Request-ID"},
+		AllowOrigins: allowedOrigins,
+		AllowMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Request-ID",
+			"Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset"},
+		ExposeHeaders: []string{"Content-Length", "Content-Type", "X-Request-ID",
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -476,10 +652,16 @@ func main() {
 	router.Use(middleware.SecurityHeaders())
 	logger.Info("Security headers middleware registered")
 
-	router.GET("/ws/analytics", func(c *gin.Context) {
+	// Realtime analytics are only streamed to authenticated admins
+	router.GET("/ws/analytics", visitor.WebSocketToken(), adminAuthHandlers.AuthMiddleware(), func(c *gin.Context) {
 		visitorService.ServeWs(visitorService.GetHub(), c)
 	})
 
+	// Signed attachment downloads; their URLs are the authorisation
+	if storageProvider != nil {
+		storageProvider.RegisterDownloadRoutes(router)
+	}
+
 	router.Use(visitor.TrackingMiddleware(visitorService))
 
 	logger.Info("Registering service routes")
@@ -528,6 +710,19 @@ func main() {
 
 	apiGateway.RegisterService("urls", urlShortenerService.RegisterRoutes)
 	apiGateway.RegisterService("messaging", messagingService.RegisterRoutes)
+	if pushHandler != nil {
+		apiGateway.RegisterService("messaging", func(rg *gin.RouterGroup) {
+			pushHandler.RegisterRoutes(rg.Group("", authService.GinAuthMiddleware()))
+		})
+	}
+	apiGateway.RegisterService("messaging", digestHandler.RegisterRoutes)
+	if uploadHandler != nil {
+		apiGateway.RegisterService("messaging", func(rg *gin.RouterGroup) {
+			authenticated := rg.Group("", authService.GinAuthMiddleware())
+			uploadHandler.RegisterRoutes(authenticated)
+			attachmentHandler.RegisterRoutes(authenticated)
+		})
+	}
 	apiGateway.RegisterService("devpanel", devpanelService.RegisterRoutes)
 
 	codeStatsHandler := codeStatsHTTP.NewHandler(codeStatsService)
@@ -666,6 +861,11 @@ func main() {
 	logger.Info("Stopping log manager")
 	logManager.StopCleanup()
 
+	if codeStatsWatcher != nil {
+		logger.Info("Stopping project path watcher")
+		codeStatsWatcher.Stop()
+	}
+
 	logger.Info("Stopping all services")
 	if err := serviceManager.StopAllServices(); err != nil {
 		logger.Error("Error stopping services", "error", err)
@@ -2,18 +2,17 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
 	appconfig "github.com/JadenRazo/Project-Website/backend/internal/app/config"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
 	"github.com/JadenRazo/Project-Website/backend/internal/core/db"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
 	"github.com/JadenRazo/Project-Website/backend/internal/worker/tasks"
 	"gorm.io/gorm"
 )
@@ -23,39 +22,17 @@ const (
 	appVersion = "1.0.0"
 )
 
-// Job represents a background task to be processed
-type Job struct {
-	ID          string
-	Type        string
-	Payload     []byte
-	CreatedAt   time.Time
-	Status      string
-	RetryCount  int
-	NextRetryAt *time.Time
-	Error       string
-}
-
-// Worker handles processing of background jobs
+// Worker processes queued background jobs
 type Worker struct {
-	dbConn        *gorm.DB
-	quit          chan struct{}
-	processingWg  sync.WaitGroup
-	pollInterval  time.Duration
-	maxRetries    int
-	processorsMap map[string]JobProcessor
-	batchSize     int
-	logger        *log.Logger
-}
-
-// JobProcessor defines the interface for job type-specific processors
-type JobProcessor interface {
-	Process(ctx context.Context, job Job) error
+	runner *queue.Runner
+	done   chan struct{}
+	logger *log.Logger
 }
 
 // EmailProcessor processes email jobs
 type EmailProcessor struct{}
 
-func (p *EmailProcessor) Process(ctx context.Context, job Job) error {
+func (p *EmailProcessor) Process(ctx context.Context, job *queue.Job) error {
 	// Implement email sending logic
 	log.Printf("Processing email job: %s", job.ID)
 	return nil
@@ -64,241 +41,44 @@ func (p *EmailProcessor) Process(ctx context.Context, job Job) error {
 // NotificationProcessor processes notification jobs
 type NotificationProcessor struct{}
 
-func (p *NotificationProcessor) Process(ctx context.Context, job Job) error {
+func (p *NotificationProcessor) Process(ctx context.Context, job *queue.Job) error {
 	// Implement notification sending logic
 	log.Printf("Processing notification job: %s", job.ID)
 	return nil
 }
 
-// NewWorker creates a new worker instance
+// NewWorker creates a new worker instance. Jobs are claimed with row locks
+// skipped, so several workers and the API's in-process runner can share the
+// jobs table; each only claims the job types it has processors for.
 func NewWorker(database *gorm.DB) *Worker {
+	runner := queue.NewRunner(queue.New(database))
+	runner.Register("email", &EmailProcessor{})
+	runner.Register("notification", &NotificationProcessor{})
+
 	return &Worker{
-		dbConn:       database,
-		quit:         make(chan struct{}),
-		pollInterval: 5 * time.Second,
-		maxRetries:   3,
-		batchSize:    10,
-		logger:       log.New(os.Stdout, "[WORKER] ", log.LstdFlags),
-		processorsMap: map[string]JobProcessor{
-			"email":        &EmailProcessor{},
-			"notification": &NotificationProcessor{},
-		},
+		runner: runner,
+		done:   make(chan struct{}),
+		logger: log.New(os.Stdout, "[WORKER] ", log.LstdFlags),
 	}
 }
 
-// Start begins the worker's job processing loop
+// Start processes jobs until ctx is cancelled
 func (w *Worker) Start(ctx context.Context) error {
 	w.logger.Println("Starting worker service...")
+	defer close(w.done)
 
-	// Create a ticker for regular job polling
-	ticker := time.NewTicker(w.pollInterval)
-	defer ticker.Stop()
-
-	// Start processing loop
-	for {
-		select {
-		case <-ticker.C:
-			w.processBatch(ctx)
-		case <-w.quit:
-			w.logger.Println("Worker shutting down...")
-			return nil
-		case <-ctx.Done():
-			w.logger.Println("Context cancelled, worker shutting down...")
-			return ctx.Err()
-		}
-	}
-}
-
-// processBatch processes a batch of jobs
-func (w *Worker) processBatch(ctx context.Context) {
-	jobs, err := w.fetchJobs(ctx, w.batchSize)
-	if err != nil {
-		w.logger.Printf("Error fetching jobs: %v", err)
-		return
-	}
-
-	if len(jobs) == 0 {
-		return // No jobs to process
-	}
-
-	w.logger.Printf("Processing batch of %d jobs", len(jobs))
-
-	for _, job := range jobs {
-		// Process each job in its own goroutine with tracking
-		w.processingWg.Add(1)
-		go func(j Job) {
-			defer w.processingWg.Done()
-			defer func() {
-				if r := recover(); r != nil {
-					w.logger.Printf("Recovered from panic in job %s: %v", j.ID, r)
-					w.markJobFailed(ctx, j.ID, fmt.Sprintf("panic: %v", r))
-				}
-			}()
-
-			if err := w.processJob(ctx, j); err != nil {
-				w.logger.Printf("Failed to process job %s: %v", j.ID, err)
-				w.markJobFailed(ctx, j.ID, err.Error())
-			} else {
-				w.markJobComplete(ctx, j.ID)
-			}
-		}(job)
-	}
-}
-
-// fetchJobs retrieves pending jobs from the database
-func (w *Worker) fetchJobs(ctx context.Context, limit int) ([]Job, error) {
-	var jobs []Job
-
-	// In a production environment, we would use a transaction and update job status
-	// to prevent multiple workers from processing the same jobs
-	tx := w.dbConn.WithContext(ctx).Begin()
-	if tx.Error != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", tx.Error)
-	}
-
-	// This is where you would implement your database query
-	// Example query (commented out for now):
-	/*
-		err := tx.Raw(`
-			UPDATE jobs
-			SET status = 'processing', updated_at = NOW()
-			WHERE id IN (
-				SELECT id FROM jobs
-				WHERE status = 'pending'
-				AND next_retry_at <= NOW()
-				ORDER BY priority DESC, created_at ASC
-				LIMIT ?
-				FOR UPDATE SKIP LOCKED
-			)
-			RETURNING *
-		`, limit).Scan(&jobs).Error
-
-		if err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to fetch jobs: %w", err)
-		}
-	*/
-
-	// Commit the transaction
-	if err := tx.Commit().Error; err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	// Return empty slice for now
-	return jobs, nil
+	err := w.runner.Run(ctx)
+	w.logger.Println("Worker shutting down...")
+	return err
 }
 
-// processJob handles processing a single job
-func (w *Worker) processJob(ctx context.Context, job Job) error {
-	processor, exists := w.processorsMap[job.Type]
-	if !exists {
-		return fmt.Errorf("no processor found for job type: %s", job.Type)
-	}
-
-	w.logger.Printf("Processing job %s of type %s", job.ID, job.Type)
-
-	// Create a timeout context for individual job processing
-	jobCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
-
-	return processor.Process(jobCtx, job)
-}
-
-// markJobComplete marks a job as successfully completed
-func (w *Worker) markJobComplete(ctx context.Context, jobID string) {
-	// Update job status in database
-	tx := w.dbConn.WithContext(ctx).Begin()
-	if tx.Error != nil {
-		w.logger.Printf("Failed to begin transaction for completing job %s: %v", jobID, tx.Error)
-		return
-	}
-
-	// Example update query (commented out for now)
-	/*
-		err := tx.Exec(`
-			UPDATE jobs
-			SET status = 'completed', completed_at = NOW(), updated_at = NOW()
-			WHERE id = ?
-		`, jobID).Error
-
-		if err != nil {
-			tx.Rollback()
-			w.logger.Printf("Failed to mark job %s as complete: %v", jobID, err)
-			return
-		}
-	*/
-
-	if err := tx.Commit().Error; err != nil {
-		w.logger.Printf("Failed to commit transaction for completing job %s: %v", jobID, err)
-		return
-	}
-
-	w.logger.Printf("Marked job %s as complete", jobID)
-}
-
-// markJobFailed marks a job as failed and updates retry information
-func (w *Worker) markJobFailed(ctx context.Context, jobID string, errMsg string) {
-	tx := w.dbConn.WithContext(ctx).Begin()
-	if tx.Error != nil {
-		w.logger.Printf("Failed to begin transaction for failing job %s: %v", jobID, tx.Error)
-		return
-	}
-
-	// Example update query with retry logic (commented out for now)
-	/*
-		var job Job
-		err := tx.First(&job, "id = ?", jobID).Error
-		if err != nil {
-			tx.Rollback()
-			w.logger.Printf("Failed to find job %s: %v", jobID, err)
-			return
-		}
-
-		job.RetryCount++
-		job.Error = errMsg
-
-		if job.RetryCount >= w.maxRetries {
-			job.Status = "failed"
-		} else {
-			job.Status = "pending"
-			// Calculate exponential backoff for next retry
-			backoff := time.Duration(1<<uint(job.RetryCount-1)) * time.Second
-			nextRetry := time.Now().Add(backoff)
-			job.NextRetryAt = &nextRetry
-		}
-
-		err = tx.Save(&job).Error
-		if err != nil {
-			tx.Rollback()
-			w.logger.Printf("Failed to update job %s after failure: %v", jobID, err)
-			return
-		}
-	*/
-
-	if err := tx.Commit().Error; err != nil {
-		w.logger.Printf("Failed to commit transaction for failing job %s: %v", jobID, err)
-		return
-	}
-
-	w.logger.Printf("Marked job %s as failed: %s", jobID, errMsg)
-}
-
-// GracefulShutdown waits for all in-progress jobs to complete
+// GracefulShutdown waits for the jobs in progress to complete. The context
+// passed to Start must be cancelled first.
 func (w *Worker) GracefulShutdown(timeout time.Duration) {
 	w.logger.Printf("Graceful shutdown initiated with %s timeout", timeout)
 
-	// Signal the main loop to stop polling for new jobs
-	close(w.quit)
-
-	// Wait for in-progress jobs with timeout
-	done := make(chan struct{})
-	go func() {
-		w.processingWg.Wait()
-		close(done)
-	}()
-
 	select {
-	case <-done:
+	case <-w.done:
 		w.logger.Println("All jobs completed successfully")
 	case <-time.After(timeout):
 		w.logger.Println("Shutdown timeout reached, some jobs may still be running")
@@ -136,7 +136,7 @@ func (a *Application) Boot() error {
 	logger.Info("Health checker initialized")
 
 	// Initialize HTTP server
-	srv, err := server.New(a.Config, a.DB, a.Cache, a.Auth, a.MetricsManager, a.HealthChecker, a.MCStatsHandler)
+	srv, err := server.New(a.Config, a.DB, a.Cache, a.Auth, a.MetricsManager, a.HealthChecker, a.MCStatsHandler, a.Storage)
 	if err != nil {
 		return fmt.Errorf("failed to initialize server: %w", err)
 	}
@@ -11,7 +11,9 @@ import (
 	"github.com/JadenRazo/Project-Website/backend/internal/common/health"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/ratelimit"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
 	mcstatshttp "github.com/JadenRazo/Project-Website/backend/internal/mcstats/delivery/http"
+	"github.com/gin-gonic/gin"
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 )
@@ -24,6 +26,7 @@ func SetupRouter(
 	healthChecker *health.Health,
 	rateLimiter ratelimit.RateLimiter,
 	mcStatsHandler *mcstatshttp.Handler,
+	storageProvider *storage.Provider,
 ) http.Handler {
 	r := chi.NewRouter()
 
@@ -69,6 +72,15 @@ func SetupRouter(
 		if mcStatsHandler != nil {
 			mcStatsHandler.RegisterRoutes(r)
 		}
+
+		// Local storage downloads, authorised by their signed URLs. The
+		// handler is written for gin, so it runs on its own engine.
+		if storageProvider != nil {
+			files := gin.New()
+			if storageProvider.RegisterDownloadRoutes(files) {
+				r.Handle(storageProvider.DownloadPath()+"/*", files)
+			}
+		}
 	})
 
 	// Protected routes - require authentication
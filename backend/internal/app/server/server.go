@@ -17,6 +17,7 @@ import (
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/metrics"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/ratelimit"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
 	mcstatshttp "github.com/JadenRazo/Project-Website/backend/internal/mcstats/delivery/http"
 )
 
@@ -38,6 +39,7 @@ func New(
 	metricsManager *metrics.Manager,
 	healthChecker *health.Health,
 	mcStatsHandler *mcstatshttp.Handler,
+	storageProvider *storage.Provider,
 ) (*Server, error) {
 	// Create rate limiter
 	rateLimiter, err := ratelimit.NewRateLimiter(&cfg.RateLimit)
@@ -46,7 +48,7 @@ func New(
 	}
 
 	// Setup router with all handlers
-	router := SetupRouter(cfg, authService, cacheClient, healthChecker, rateLimiter, mcStatsHandler)
+	router := SetupRouter(cfg, authService, cacheClient, healthChecker, rateLimiter, mcStatsHandler, storageProvider)
 
 	return &Server{
 		router:          router,
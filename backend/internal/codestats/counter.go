@@ -0,0 +1,128 @@
+package codestats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+)
+
+// ErrTokeiNotFound is returned when no tokei binary is installed
+var ErrTokeiNotFound = errors.New("tokei binary not found")
+
+// Counter counts the lines of code under a directory. excludes are
+// gitignore-style patterns relative to root.
+type Counter interface {
+	Name() string
+	Count(ctx context.Context, root string, excludes []string) (*CodeStats, error)
+}
+
+// tokeiPaths are the locations searched for tokei before $PATH
+var tokeiPaths = []string{"/usr/local/bin/tokei", "/root/.cargo/bin/tokei"}
+
+// TokeiCounter counts lines by running the tokei binary
+type TokeiCounter struct {
+	path string
+}
+
+// NewTokeiCounter locates the tokei binary
+func NewTokeiCounter() (*TokeiCounter, error) {
+	for _, path := range tokeiPaths {
+		if _, err := os.Stat(path); err == nil {
+			return &TokeiCounter{path: path}, nil
+		}
+	}
+	if path, err := exec.LookPath("tokei"); err == nil {
+		return &TokeiCounter{path: path}, nil
+	}
+	return nil, ErrTokeiNotFound
+}
+
+func (t *TokeiCounter) Name() string { return "tokei" }
+
+// Count runs tokei against a single directory and converts its JSON report
+func (t *TokeiCounter) Count(ctx context.Context, root string, excludes []string) (*CodeStats, error) {
+	args := []string{"--output", "json"}
+	for _, pattern := range excludes {
+		args = append(args, "--exclude", pattern)
+	}
+	args = append(args, root)
+
+	cmd := exec.CommandContext(ctx, t.path, args...)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderrMsg := string(exitErr.Stderr)
+			logger.Error("Tokei execution failed", "stderr", stderrMsg, "exit_code", exitErr.ExitCode())
+			return nil, fmt.Errorf("tokei command failed with exit code %d: %s. Check if the project path is accessible", exitErr.ExitCode(), stderrMsg)
+		}
+		return nil, fmt.Errorf("failed to execute tokei command: %w. Verify tokei installation and project path permissions", err)
+	}
+
+	var tokeiOutput map[string]interface{}
+	if err := json.Unmarshal(output, &tokeiOutput); err != nil {
+		logger.Error("Failed to parse tokei JSON output", "output_preview", string(output[:min(len(output), 500)]))
+		return nil, fmt.Errorf("failed to parse tokei JSON output: %w. The output may be corrupted or in unexpected format", err)
+	}
+
+	return parseTokeiOutput(tokeiOutput), nil
+}
+
+func parseTokeiOutput(output map[string]interface{}) *CodeStats {
+	stats := &CodeStats{
+		Languages: []Language{},
+	}
+
+	for lang, data := range output {
+		if lang == "Total" {
+			continue
+		}
+
+		if langData, ok := data.(map[string]interface{}); ok {
+			language := Language{
+				Name: lang,
+			}
+
+			// Count files from reports array
+			if reports, ok := langData["reports"].([]interface{}); ok {
+				language.Files = len(reports)
+			}
+
+			if code, ok := langData["code"].(float64); ok {
+				language.Code = int64(code)
+			}
+			if comments, ok := langData["comments"].(float64); ok {
+				language.Comments = int64(comments)
+			}
+			if blanks, ok := langData["blanks"].(float64); ok {
+				language.Blanks = int64(blanks)
+			}
+
+			// Calculate total lines as code + comments + blanks
+			language.Lines = language.Code + language.Comments + language.Blanks
+
+			stats.Languages = append(stats.Languages, language)
+			stats.TotalFiles += language.Files
+			stats.TotalLines += language.Lines
+			stats.TotalCode += language.Code
+			stats.TotalComment += language.Comments
+			stats.TotalBlanks += language.Blanks
+		}
+	}
+
+	return stats
+}
+
+// DefaultCounter prefers tokei when it is installed and falls back to the
+// built-in counter
+func DefaultCounter() Counter {
+	if tokei, err := NewTokeiCounter(); err == nil {
+		return tokei
+	}
+	logger.Info("tokei not found, using the built-in line counter")
+	return NewNativeCounter(0)
+}
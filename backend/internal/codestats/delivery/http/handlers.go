@@ -1,13 +1,16 @@
 package http
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/JadenRazo/Project-Website/backend/internal/codestats"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 type Handler struct {
@@ -26,6 +29,13 @@ func NewHandler(service *codestats.Service) *Handler {
 func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/stats", h.GetStats)
 	router.POST("/stats/update", h.UpdateStats)
+	router.GET("/stats/projects", h.GetProjectStats)
+	router.GET("/stats/projects/:id/snapshots", h.GetProjectSnapshots)
+	router.GET("/stats/history", h.GetHistory)
+	router.GET("/stats/diff", h.GetDiff)
+	router.GET("/stats/git", h.GetGitHistory)
+	router.GET("/stats/dependencies", h.GetDependencies)
+	router.GET("/stats/projects/:id/dependencies", h.GetProjectDependencies)
 }
 
 func (h *Handler) GetStats(c *gin.Context) {
@@ -171,3 +181,173 @@ func (h *Handler) UpdateStats(c *gin.Context) {
 		"request_id": requestID,
 	})
 }
+
+// GetProjectStats returns the latest snapshot of every active project
+func (h *Handler) GetProjectStats(c *gin.Context) {
+	projects, err := h.service.GetProjectStats(c.Request.Context())
+	if err != nil {
+		logger.Error("Failed to get project statistics",
+			"request_id", c.GetString("RequestID"),
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve project statistics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"projects": projects})
+}
+
+// GetProjectSnapshots lists a project's snapshots, newest first
+func (h *Handler) GetProjectSnapshots(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	snapshots, err := h.service.ListSnapshots(c.Request.Context(), id, limit)
+	if err != nil {
+		logger.Error("Failed to list snapshots",
+			"request_id", c.GetString("RequestID"),
+			"project_id", id,
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"snapshots": snapshots})
+}
+
+// GetHistory returns a time series of line counts, optionally for a single
+// project and/or language, e.g. ?language=Go&period=1y&interval=month
+func (h *Handler) GetHistory(c *gin.Context) {
+	query := codestats.SeriesQuery{
+		Language: strings.TrimSpace(c.Query("language")),
+		Period:   c.DefaultQuery("period", "1y"),
+		Interval: c.DefaultQuery("interval", "week"),
+	}
+	if project := c.Query("project"); project != "" {
+		id, err := uuid.Parse(project)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+			return
+		}
+		query.ProjectID = &id
+	}
+
+	points, err := h.service.GetSeries(c.Request.Context(), query)
+	if err != nil {
+		if errors.Is(err, codestats.ErrInvalidPeriod) || errors.Is(err, codestats.ErrInvalidInterval) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("Failed to get code statistics history",
+			"request_id", c.GetString("RequestID"),
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve code statistics history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"project":  query.ProjectID,
+		"language": query.Language,
+		"period":   query.Period,
+		"interval": query.Interval,
+		"data":     points,
+	})
+}
+
+// GetDiff compares two snapshots, ?from=<snapshot id>&to=<snapshot id>
+func (h *Handler) GetDiff(c *gin.Context) {
+	from, err := uuid.Parse(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from snapshot ID"})
+		return
+	}
+	to, err := uuid.Parse(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to snapshot ID"})
+		return
+	}
+
+	diff, err := h.service.DiffSnapshots(c.Request.Context(), from, to)
+	if err != nil {
+		if errors.Is(err, codestats.ErrSnapshotNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("Failed to diff snapshots",
+			"request_id", c.GetString("RequestID"),
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// GetGitHistory returns commit activity, churn and contributor counts read
+// from the git repositories of one or all projects, e.g. ?period=6m
+func (h *Handler) GetGitHistory(c *gin.Context) {
+	var projectID *uuid.UUID
+	if project := c.Query("project"); project != "" {
+		id, err := uuid.Parse(project)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+			return
+		}
+		projectID = &id
+	}
+
+	report, err := h.service.GetGitHistory(c.Request.Context(), projectID, c.DefaultQuery("period", "1y"))
+	if err != nil {
+		if errors.Is(err, codestats.ErrInvalidPeriod) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("Failed to get git history",
+			"request_id", c.GetString("RequestID"),
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve git history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"project": projectID, "git": report})
+}
+
+// GetDependencies returns the dependency inventory aggregated across all
+// active projects
+func (h *Handler) GetDependencies(c *gin.Context) {
+	report, err := h.service.GetDependencyReport(c.Request.Context(), nil)
+	if err != nil {
+		logger.Error("Failed to get dependency inventory",
+			"request_id", c.GetString("RequestID"),
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dependencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetProjectDependencies returns a project's dependency inventory including
+// every dependency
+func (h *Handler) GetProjectDependencies(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	report, err := h.service.GetDependencyReport(c.Request.Context(), &id)
+	if err != nil {
+		logger.Error("Failed to get project dependencies",
+			"request_id", c.GetString("RequestID"),
+			"project_id", id,
+			"error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dependencies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
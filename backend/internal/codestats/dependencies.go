@@ -0,0 +1,459 @@
+package codestats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxManifestDepth is how deep below a project path manifests are searched
+const maxManifestDepth = 6
+
+// manifestSkipDirs are never searched for manifests: they hold installed
+// dependencies or build output rather than the project's own manifests
+var manifestSkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"venv":         true,
+	"env":          true,
+	"__pycache__":  true,
+	"dist":         true,
+	"build":        true,
+}
+
+// Dependency is a package used by a project, recorded on each stats update
+type Dependency struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"-"`
+	ProjectPathID uuid.UUID `gorm:"type:uuid;not null;index" json:"projectPathId"`
+	// Manifest is the manifest's path relative to the project
+	Manifest  string `gorm:"type:text;not null" json:"manifest"`
+	Ecosystem string `gorm:"type:varchar(20);not null" json:"ecosystem"`
+	Name      string `gorm:"type:varchar(255);not null" json:"name"`
+	Version   string `gorm:"type:varchar(100)" json:"version"`
+	Direct    bool   `json:"direct"`
+	Dev       bool   `json:"dev"`
+	License   string `gorm:"type:varchar(255)" json:"license,omitempty"`
+	Copyleft  bool   `json:"copyleft"`
+	// LatestVersion is the newest version known locally, set only when it is
+	// newer than Version
+	LatestVersion string    `gorm:"type:varchar(100)" json:"latestVersion,omitempty"`
+	CreatedAt     time.Time `json:"-"`
+}
+
+func (Dependency) TableName() string { return "code_dependencies" }
+
+// DependencyMetadata caches what was learnt about a package from local
+// sources, so licences and newer versions stay known after a project's
+// node_modules or virtualenv is removed
+type DependencyMetadata struct {
+	Ecosystem     string    `gorm:"type:varchar(20);primaryKey" json:"ecosystem"`
+	Name          string    `gorm:"type:varchar(255);primaryKey" json:"name"`
+	License       string    `gorm:"type:varchar(255)" json:"license,omitempty"`
+	LatestVersion string    `gorm:"type:varchar(100)" json:"latestVersion,omitempty"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+func (DependencyMetadata) TableName() string { return "code_dependency_metadata" }
+
+// SyncDependencies inventories the dependencies of every active project
+func (s *Service) SyncDependencies(ctx context.Context) error {
+	projects, err := s.projectPathRepo.GetActive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get project paths: %w", err)
+	}
+	return s.syncDependencies(ctx, projects)
+}
+
+func (s *Service) syncDependencies(ctx context.Context, projects []*projectpath.ProjectPath) error {
+	resolver, err := s.newMetadataResolver(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, project := range projects {
+		deps, err := collectDependencies(project, resolver)
+		if err != nil {
+			logger.Error("Failed to read project dependencies", "project", project.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", project.Name, err))
+			continue
+		}
+
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("project_path_id = ?", project.ID).Delete(&Dependency{}).Error; err != nil {
+				return err
+			}
+			if len(deps) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(deps, 500).Error
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to save dependencies: %w", project.Name, err))
+		}
+	}
+
+	if err := resolver.save(ctx, s.db); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// collectDependencies finds every manifest under a project and resolves the
+// licence and latest version of each dependency
+func collectDependencies(project *projectpath.ProjectPath, resolver *metadataResolver) ([]*Dependency, error) {
+	if _, err := os.Stat(project.Path); err != nil {
+		return nil, fmt.Errorf("failed to access project path: %w", err)
+	}
+
+	excluded := &ignoreMatcher{}
+	excluded.add("", project.ExcludePatterns)
+
+	var deps []*Dependency
+	for _, manifest := range findManifests(project.Path, excluded) {
+		path := filepath.Join(project.Path, filepath.FromSlash(manifest))
+		parsed, err := parseManifest(path)
+		if err != nil {
+			logger.Warn("Failed to parse manifest", "project", project.Name, "manifest", manifest, "error", err)
+			continue
+		}
+
+		dir := filepath.Dir(path)
+		for _, dep := range parsed {
+			license, latest := resolver.resolve(dep, dir)
+			d := &Dependency{
+				ProjectPathID: project.ID,
+				Manifest:      manifest,
+				Ecosystem:     dep.ecosystem,
+				Name:          dep.name,
+				Version:       dep.version,
+				Direct:        dep.direct,
+				Dev:           dep.dev,
+				License:       license,
+				Copyleft:      isCopyleft(license),
+			}
+			if latest != "" && isExactVersion(dep.version) && compareVersions(latest, dep.version) > 0 {
+				d.LatestVersion = latest
+			}
+			deps = append(deps, d)
+		}
+	}
+	return deps, nil
+}
+
+// findManifests returns the slash-separated paths, relative to root, of the
+// dependency manifests below root
+func findManifests(root string, excluded *ignoreMatcher) []string {
+	var manifests []string
+
+	var walk func(dir, rel string, depth int)
+	walk = func(dir, rel string, depth int) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			childRel := name
+			if rel != "" {
+				childRel = rel + "/" + name
+			}
+			if excluded.ignored(childRel, entry.IsDir()) {
+				continue
+			}
+
+			if entry.IsDir() {
+				if depth < maxManifestDepth && !strings.HasPrefix(name, ".") && !manifestSkipDirs[name] {
+					walk(filepath.Join(dir, name), childRel, depth+1)
+				}
+				continue
+			}
+			if isManifestName(name) {
+				manifests = append(manifests, childRel)
+			}
+		}
+	}
+	walk(root, "", 0)
+
+	sort.Strings(manifests)
+	return manifests
+}
+
+// isManifestName reports whether a file name is a supported manifest
+func isManifestName(name string) bool {
+	switch name {
+	case "go.mod", "package.json", "Cargo.toml":
+		return true
+	}
+	return strings.HasSuffix(name, ".txt") &&
+		(strings.HasPrefix(name, "requirements") || strings.HasSuffix(name, "-requirements.txt"))
+}
+
+// metadataResolver looks dependencies up in local sources, falling back to
+// the metadata cached from earlier scans, and collects updates to the cache
+type metadataResolver struct {
+	local   *localMetadata
+	cached  map[[2]string]*DependencyMetadata
+	updated map[[2]string]*DependencyMetadata
+}
+
+func (s *Service) newMetadataResolver(ctx context.Context) (*metadataResolver, error) {
+	var rows []*DependencyMetadata
+	if err := s.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load dependency metadata: %w", err)
+	}
+
+	r := &metadataResolver{
+		local:   newLocalMetadata(),
+		cached:  make(map[[2]string]*DependencyMetadata, len(rows)),
+		updated: make(map[[2]string]*DependencyMetadata),
+	}
+	for _, row := range rows {
+		r.cached[[2]string{row.Ecosystem, row.Name}] = row
+	}
+	return r, nil
+}
+
+// resolve returns the licence and the newest locally known version of a
+// dependency. A licence declared in a lock file takes precedence.
+func (r *metadataResolver) resolve(dep manifestDependency, dir string) (license, latest string) {
+	key := [2]string{dep.ecosystem, dep.name}
+
+	meta, ok := r.cached[key]
+	if !ok {
+		meta = &DependencyMetadata{Ecosystem: dep.ecosystem, Name: dep.name}
+		r.cached[key] = meta
+	}
+
+	localLicense, versions := r.local.lookup(dep, dir)
+	if dep.license != "" {
+		localLicense = dep.license
+	}
+	if isExactVersion(dep.version) {
+		versions = append(versions, dep.version)
+	}
+
+	changed := false
+	if localLicense != "" && localLicense != meta.License {
+		meta.License = localLicense
+		changed = true
+	}
+	if newest := newestVersion(versions); newest != "" &&
+		(meta.LatestVersion == "" || compareVersions(newest, meta.LatestVersion) > 0) {
+		meta.LatestVersion = newest
+		changed = true
+	}
+	if changed {
+		r.updated[key] = meta
+	}
+
+	return meta.License, meta.LatestVersion
+}
+
+// save writes the metadata learnt during the scan to the cache
+func (r *metadataResolver) save(ctx context.Context, db *gorm.DB) error {
+	if len(r.updated) == 0 {
+		return nil
+	}
+
+	rows := make([]*DependencyMetadata, 0, len(r.updated))
+	for _, meta := range r.updated {
+		meta.UpdatedAt = time.Now()
+		rows = append(rows, meta)
+	}
+
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ecosystem"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"license", "latest_version", "updated_at"}),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return fmt.Errorf("failed to save dependency metadata: %w", err)
+	}
+	return nil
+}
+
+// EcosystemSummary counts a project's or all projects' dependencies in one
+// ecosystem. Packages are counted once even if several manifests use them.
+type EcosystemSummary struct {
+	Ecosystem  string         `json:"ecosystem"`
+	Projects   int            `json:"projects"`
+	Direct     int            `json:"direct"`
+	Transitive int            `json:"transitive"`
+	Outdated   int            `json:"outdated"`
+	Copyleft   int            `json:"copyleft"`
+	Licenses   map[string]int `json:"licenses"`
+}
+
+// CopyleftDependency is a copyleft-licensed package and the projects using it
+type CopyleftDependency struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+	License   string `json:"license"`
+	Direct    bool   `json:"direct"`
+	// Projects are the names of the projects using the package
+	Projects   []string    `json:"projects"`
+	ProjectIDs []uuid.UUID `json:"projectIds"`
+}
+
+// DependencyReport is the dependency inventory of one or all projects
+type DependencyReport struct {
+	Projects     int                  `json:"projects"`
+	Ecosystems   []EcosystemSummary   `json:"ecosystems"`
+	Copyleft     []CopyleftDependency `json:"copyleft"`
+	Dependencies []*Dependency        `json:"dependencies,omitempty"`
+}
+
+// GetDependencyReport summarises the dependencies of the active projects.
+// For a single project the individual dependencies are included as well.
+func (s *Service) GetDependencyReport(ctx context.Context, projectID *uuid.UUID) (*DependencyReport, error) {
+	type dependencyRow struct {
+		Dependency
+		ProjectName string
+	}
+
+	query := s.db.WithContext(ctx).Table("code_dependencies d").
+		Select("d.*, p.name AS project_name").
+		Joins("JOIN project_paths p ON p.id = d.project_path_id AND p.is_active = true AND p.deleted_at IS NULL").
+		Order("d.ecosystem, d.direct DESC, d.name, d.version")
+	if projectID != nil {
+		query = query.Where("d.project_path_id = ?", *projectID)
+	}
+
+	var rows []dependencyRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dependencies: %w", err)
+	}
+
+	type packageState struct {
+		direct   bool
+		outdated bool
+		license  string
+		copyleft bool
+		projects map[uuid.UUID]string
+	}
+	type ecosystemState struct {
+		projects map[uuid.UUID]bool
+		packages map[string]*packageState
+	}
+
+	ecosystems := make(map[string]*ecosystemState)
+	allProjects := make(map[uuid.UUID]bool)
+	report := &DependencyReport{Ecosystems: []EcosystemSummary{}, Copyleft: []CopyleftDependency{}}
+
+	for i := range rows {
+		row := &rows[i]
+		allProjects[row.ProjectPathID] = true
+
+		eco, ok := ecosystems[row.Ecosystem]
+		if !ok {
+			eco = &ecosystemState{projects: make(map[uuid.UUID]bool), packages: make(map[string]*packageState)}
+			ecosystems[row.Ecosystem] = eco
+		}
+		eco.projects[row.ProjectPathID] = true
+
+		pkg, ok := eco.packages[row.Name]
+		if !ok {
+			pkg = &packageState{projects: make(map[uuid.UUID]string)}
+			eco.packages[row.Name] = pkg
+		}
+		pkg.direct = pkg.direct || row.Direct
+		pkg.outdated = pkg.outdated || (row.Direct && row.LatestVersion != "")
+		pkg.projects[row.ProjectPathID] = row.ProjectName
+		if row.License != "" {
+			pkg.license = row.License
+			pkg.copyleft = row.Copyleft
+		}
+
+		if projectID != nil {
+			dep := row.Dependency
+			report.Dependencies = append(report.Dependencies, &dep)
+		}
+	}
+	report.Projects = len(allProjects)
+
+	for name, eco := range ecosystems {
+		summary := EcosystemSummary{
+			Ecosystem: name,
+			Projects:  len(eco.projects),
+			Licenses:  make(map[string]int),
+		}
+		for pkgName, pkg := range eco.packages {
+			if pkg.direct {
+				summary.Direct++
+			} else {
+				summary.Transitive++
+			}
+			if pkg.outdated {
+				summary.Outdated++
+			}
+
+			license := pkg.license
+			if license == "" {
+				license = "Unknown"
+			}
+			summary.Licenses[license]++
+
+			if pkg.copyleft {
+				summary.Copyleft++
+				dep := CopyleftDependency{
+					Ecosystem: name,
+					Name:      pkgName,
+					License:   pkg.license,
+					Direct:    pkg.direct,
+				}
+				dep.Projects, dep.ProjectIDs = projectsByName(pkg.projects)
+				report.Copyleft = append(report.Copyleft, dep)
+			}
+		}
+		report.Ecosystems = append(report.Ecosystems, summary)
+	}
+
+	sort.Slice(report.Ecosystems, func(i, j int) bool {
+		return report.Ecosystems[i].Direct > report.Ecosystems[j].Direct
+	})
+	sort.Slice(report.Copyleft, func(i, j int) bool {
+		a, b := report.Copyleft[i], report.Copyleft[j]
+		if a.Direct != b.Direct {
+			return a.Direct
+		}
+		if a.Ecosystem != b.Ecosystem {
+			return a.Ecosystem < b.Ecosystem
+		}
+		return a.Name < b.Name
+	})
+
+	return report, nil
+}
+
+// projectsByName returns the names and IDs of projects sorted by name, so
+// that names[i] is the name of ids[i]
+func projectsByName(projects map[uuid.UUID]string) (names []string, ids []uuid.UUID) {
+	ids = make([]uuid.UUID, 0, len(projects))
+	for id := range projects {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if projects[ids[i]] != projects[ids[j]] {
+			return projects[ids[i]] < projects[ids[j]]
+		}
+		return ids[i].String() < ids[j].String()
+	})
+
+	names = make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, projects[id])
+	}
+	return names, ids
+}
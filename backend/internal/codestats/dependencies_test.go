@@ -0,0 +1,31 @@
+package codestats
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectsByName(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+	projects := map[uuid.UUID]string{
+		ids[0]: "website",
+		ids[1]: "api",
+		ids[2]: "cli",
+		ids[3]: "api",
+	}
+
+	for range 20 {
+		names, sorted := projectsByName(projects)
+		assert.Equal(t, []string{"api", "api", "cli", "website"}, names)
+		for i, id := range sorted {
+			assert.Equal(t, projects[id], names[i])
+		}
+		if ids[1].String() < ids[3].String() {
+			assert.Equal(t, []uuid.UUID{ids[1], ids[3], ids[2], ids[0]}, sorted)
+		} else {
+			assert.Equal(t, []uuid.UUID{ids[3], ids[1], ids[2], ids[0]}, sorted)
+		}
+	}
+}
@@ -0,0 +1,632 @@
+package codestats
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxRepoDepth is how deep below a project path repositories are searched
+	maxRepoDepth = 3
+	// maxTopFiles bounds the files listed in a git history report
+	maxTopFiles = 20
+	// otherLanguage groups churn in files of unrecognised languages
+	otherLanguage = "Other"
+)
+
+// ErrGitNotFound is returned when the git binary is not installed
+var ErrGitNotFound = errors.New("git binary not found")
+
+// GitSyncState remembers the last commit read from a repository so later
+// syncs only read new history
+type GitSyncState struct {
+	ProjectPathID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Repo          string    `gorm:"type:text;primaryKey"`
+	LastCommit    string    `gorm:"type:varchar(64);not null"`
+	Commits       int       `gorm:"default:0"`
+	UpdatedAt     time.Time
+}
+
+func (GitSyncState) TableName() string { return "code_git_sync_state" }
+
+// GitDailyActivity counts commits and line changes per repository and day
+type GitDailyActivity struct {
+	ProjectPathID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Repo          string    `gorm:"type:text;primaryKey"`
+	Day           time.Time `gorm:"type:date;primaryKey"`
+	Commits       int
+	Additions     int64
+	Deletions     int64
+}
+
+func (GitDailyActivity) TableName() string { return "code_git_daily" }
+
+// GitLanguageChurn counts line changes per repository, week and language
+type GitLanguageChurn struct {
+	ProjectPathID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Repo          string    `gorm:"type:text;primaryKey"`
+	Week          time.Time `gorm:"type:date;primaryKey"`
+	Language      string    `gorm:"type:varchar(100);primaryKey"`
+	Additions     int64
+	Deletions     int64
+}
+
+func (GitLanguageChurn) TableName() string { return "code_git_language_churn" }
+
+// GitFileChurn counts how often a file changed over the whole history
+type GitFileChurn struct {
+	ProjectPathID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Repo          string    `gorm:"type:text;primaryKey"`
+	Path          string    `gorm:"type:text;primaryKey"`
+	Language      string    `gorm:"type:varchar(100)"`
+	Changes       int
+	Additions     int64
+	Deletions     int64
+	LastChangedAt time.Time
+}
+
+func (GitFileChurn) TableName() string { return "code_git_file_churn" }
+
+// GitContributor tracks commit activity per author. Authors are stored as a
+// hash of their email so the portfolio only ever exposes counts.
+type GitContributor struct {
+	ProjectPathID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Repo          string    `gorm:"type:text;primaryKey"`
+	AuthorHash    string    `gorm:"type:varchar(64);primaryKey"`
+	Commits       int
+	FirstCommitAt time.Time
+	LastCommitAt  time.Time
+}
+
+func (GitContributor) TableName() string { return "code_git_contributors" }
+
+// gitCommit is a parsed non-merge commit with its numstat lines
+type gitCommit struct {
+	hash   string
+	author string
+	when   time.Time
+	files  []gitFileChange
+}
+
+type gitFileChange struct {
+	path      string
+	additions int64
+	deletions int64
+}
+
+// gitAggregate accumulates the changes read during one sync
+type gitAggregate struct {
+	lastCommit   string
+	commits      int
+	daily        map[time.Time]*GitDailyActivity
+	languages    map[[2]string]*GitLanguageChurn
+	files        map[string]*GitFileChurn
+	contributors map[string]*GitContributor
+}
+
+// SyncGitHistory reads new commits from every git repository under the
+// active project paths
+func (s *Service) SyncGitHistory(ctx context.Context) error {
+	projects, err := s.projectPathRepo.GetActive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get project paths: %w", err)
+	}
+	return s.syncGitHistory(ctx, projects)
+}
+
+func (s *Service) syncGitHistory(ctx context.Context, projects []*projectpath.ProjectPath) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return ErrGitNotFound
+	}
+
+	var errs []error
+	for _, project := range projects {
+		excluded := &ignoreMatcher{}
+		excluded.add("", project.ExcludePatterns)
+
+		for _, repo := range findGitRepos(project.Path, excluded) {
+			if err := s.syncRepo(ctx, project, repo, excluded); err != nil {
+				logger.Error("Failed to sync git history", "project", project.Name, "repo", repo, "error", err)
+				errs = append(errs, fmt.Errorf("%s/%s: %w", project.Name, repo, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findGitRepos returns the slash-separated paths, relative to root, of git
+// repositories at or below root ("" for root itself). Nested repositories
+// such as submodules are reported separately.
+func findGitRepos(root string, excluded *ignoreMatcher) []string {
+	var repos []string
+
+	var walk func(dir, rel string, depth int)
+	walk = func(dir, rel string, depth int) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			repos = append(repos, rel)
+		}
+		if depth >= maxRepoDepth {
+			return
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() || strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+				continue
+			}
+			childRel := name
+			if rel != "" {
+				childRel = rel + "/" + name
+			}
+			if excluded.ignored(childRel, true) {
+				continue
+			}
+			walk(filepath.Join(dir, name), childRel, depth+1)
+		}
+	}
+	walk(root, "", 0)
+
+	return repos
+}
+
+// syncRepo reads the commits since the last sync and adds them to the
+// aggregates. If the last seen commit is no longer in the history, for
+// example after a force push, the repository is rebuilt from scratch.
+func (s *Service) syncRepo(ctx context.Context, project *projectpath.ProjectPath, repo string, excluded *ignoreMatcher) error {
+	dir := filepath.Join(project.Path, filepath.FromSlash(repo))
+
+	head, err := gitOutput(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil || head == "" {
+		return nil // no commits yet
+	}
+
+	var state GitSyncState
+	err = s.db.WithContext(ctx).Where("project_path_id = ? AND repo = ?", project.ID, repo).First(&state).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if state.LastCommit == head {
+		return nil
+	}
+
+	rebuild := false
+	logRange := "HEAD"
+	if state.LastCommit != "" {
+		if _, err := gitOutput(ctx, dir, "merge-base", "--is-ancestor", state.LastCommit, "HEAD"); err == nil {
+			logRange = state.LastCommit + "..HEAD"
+		} else {
+			logger.Warn("Last seen commit is no longer reachable, rebuilding git history",
+				"project", project.Name, "repo", repo, "commit", state.LastCommit)
+			rebuild = true
+		}
+	}
+
+	agg := &gitAggregate{
+		lastCommit:   head,
+		daily:        make(map[time.Time]*GitDailyActivity),
+		languages:    make(map[[2]string]*GitLanguageChurn),
+		files:        make(map[string]*GitFileChurn),
+		contributors: make(map[string]*GitContributor),
+	}
+
+	prefix := ""
+	if repo != "" {
+		prefix = repo + "/"
+	}
+	err = readGitLog(ctx, dir, logRange, func(commit gitCommit) {
+		agg.add(project.ID, repo, commit, func(path string) bool {
+			return excluded.ignored(prefix+path, false)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if rebuild {
+			for _, model := range []interface{}{&GitDailyActivity{}, &GitLanguageChurn{}, &GitFileChurn{}, &GitContributor{}} {
+				if err := tx.Where("project_path_id = ? AND repo = ?", project.ID, repo).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			state.Commits = 0
+		}
+		if err := agg.save(tx); err != nil {
+			return err
+		}
+
+		state.ProjectPathID = project.ID
+		state.Repo = repo
+		state.LastCommit = agg.lastCommit
+		state.Commits += agg.commits
+		state.UpdatedAt = time.Now()
+		// Save would insert rather than update the state of a repository at
+		// the project root, as its empty repo key counts as unset
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&state).Error
+	})
+}
+
+// gitOutput runs a git command in dir and returns its trimmed output
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	output, err := cmd.Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+// readGitLog streams non-merge commits with their numstat, oldest first so
+// the first and last commit times of contributors come out in order
+func readGitLog(ctx context.Context, dir, logRange string, fn func(gitCommit)) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "log", "--reverse", "--no-merges", "--no-renames",
+		"--numstat", "--format=%x1e%H%x1f%aE%x1f%aI", logRange)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run git log: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var current *gitCommit
+	flush := func() {
+		if current != nil {
+			fn(*current)
+			current = nil
+		}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if header, ok := strings.CutPrefix(line, "\x1e"); ok {
+			flush()
+			parts := strings.Split(header, "\x1f")
+			if len(parts) != 3 {
+				continue
+			}
+			when, err := time.Parse(time.RFC3339, parts[2])
+			if err != nil {
+				continue
+			}
+			current = &gitCommit{hash: parts[0], author: strings.ToLower(parts[1]), when: when}
+			continue
+		}
+
+		if current == nil || line == "" {
+			continue
+		}
+		// numstat: additions, deletions and path separated by tabs; binary
+		// files report "-" for both counts
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		additions, _ := strconv.ParseInt(fields[0], 10, 64)
+		deletions, _ := strconv.ParseInt(fields[1], 10, 64)
+		current.files = append(current.files, gitFileChange{path: fields[2], additions: additions, deletions: deletions})
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		cmd.Wait()
+		return fmt.Errorf("failed to read git log: %w", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git log failed: %w", err)
+	}
+	return nil
+}
+
+// add folds a commit into the aggregates. Changes to excluded files are not
+// counted, but the commit itself still is.
+func (a *gitAggregate) add(projectID uuid.UUID, repo string, commit gitCommit, excluded func(string) bool) {
+	a.commits++
+
+	when := commit.when.UTC()
+	day := time.Date(when.Year(), when.Month(), when.Day(), 0, 0, 0, 0, time.UTC)
+	week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)) // Monday
+
+	daily, ok := a.daily[day]
+	if !ok {
+		daily = &GitDailyActivity{ProjectPathID: projectID, Repo: repo, Day: day}
+		a.daily[day] = daily
+	}
+	daily.Commits++
+
+	for _, change := range commit.files {
+		if excluded(change.path) {
+			continue
+		}
+
+		language := otherLanguage
+		if def := languageForPath(change.path); def != nil {
+			language = def.name
+		}
+
+		daily.Additions += change.additions
+		daily.Deletions += change.deletions
+
+		key := [2]string{week.Format("2006-01-02"), language}
+		churn, ok := a.languages[key]
+		if !ok {
+			churn = &GitLanguageChurn{ProjectPathID: projectID, Repo: repo, Week: week, Language: language}
+			a.languages[key] = churn
+		}
+		churn.Additions += change.additions
+		churn.Deletions += change.deletions
+
+		file, ok := a.files[change.path]
+		if !ok {
+			file = &GitFileChurn{ProjectPathID: projectID, Repo: repo, Path: change.path, Language: language}
+			a.files[change.path] = file
+		}
+		file.Changes++
+		file.Additions += change.additions
+		file.Deletions += change.deletions
+		file.LastChangedAt = commit.when
+	}
+
+	authorHash := sha256.Sum256([]byte(commit.author))
+	author := hex.EncodeToString(authorHash[:])
+	contributor, ok := a.contributors[author]
+	if !ok {
+		contributor = &GitContributor{ProjectPathID: projectID, Repo: repo, AuthorHash: author, FirstCommitAt: commit.when}
+		a.contributors[author] = contributor
+	}
+	contributor.Commits++
+	contributor.LastCommitAt = commit.when
+}
+
+// save adds the aggregates to the stored totals
+func (a *gitAggregate) save(tx *gorm.DB) error {
+	increment := func(columns ...string) clause.Set {
+		set := make(clause.Set, 0, len(columns))
+		for _, column := range columns {
+			set = append(set, clause.Assignment{
+				Column: clause.Column{Name: column},
+				Value:  gorm.Expr("? + EXCLUDED.?", clause.Column{Table: clause.CurrentTable, Name: column}, clause.Column{Name: column}),
+			})
+		}
+		return set
+	}
+
+	daily := make([]*GitDailyActivity, 0, len(a.daily))
+	for _, row := range a.daily {
+		daily = append(daily, row)
+	}
+	languages := make([]*GitLanguageChurn, 0, len(a.languages))
+	for _, row := range a.languages {
+		languages = append(languages, row)
+	}
+	files := make([]*GitFileChurn, 0, len(a.files))
+	for _, row := range a.files {
+		files = append(files, row)
+	}
+	contributors := make([]*GitContributor, 0, len(a.contributors))
+	for _, row := range a.contributors {
+		contributors = append(contributors, row)
+	}
+
+	if len(daily) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_path_id"}, {Name: "repo"}, {Name: "day"}},
+			DoUpdates: increment("commits", "additions", "deletions"),
+		}).CreateInBatches(daily, 500).Error; err != nil {
+			return fmt.Errorf("failed to save daily git activity: %w", err)
+		}
+	}
+	if len(languages) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_path_id"}, {Name: "repo"}, {Name: "week"}, {Name: "language"}},
+			DoUpdates: increment("additions", "deletions"),
+		}).CreateInBatches(languages, 500).Error; err != nil {
+			return fmt.Errorf("failed to save language churn: %w", err)
+		}
+	}
+	if len(files) > 0 {
+		set := increment("changes", "additions", "deletions")
+		set = append(set, clause.Assignment{Column: clause.Column{Name: "last_changed_at"}, Value: gorm.Expr("EXCLUDED.last_changed_at")})
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_path_id"}, {Name: "repo"}, {Name: "path"}},
+			DoUpdates: set,
+		}).CreateInBatches(files, 500).Error; err != nil {
+			return fmt.Errorf("failed to save file churn: %w", err)
+		}
+	}
+	if len(contributors) > 0 {
+		set := increment("commits")
+		set = append(set, clause.Assignment{Column: clause.Column{Name: "last_commit_at"}, Value: gorm.Expr("EXCLUDED.last_commit_at")})
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "project_path_id"}, {Name: "repo"}, {Name: "author_hash"}},
+			DoUpdates: set,
+		}).CreateInBatches(contributors, 500).Error; err != nil {
+			return fmt.Errorf("failed to save contributors: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// WeekActivity is the commit activity of one week
+type WeekActivity struct {
+	Week       time.Time `json:"week"`
+	Commits    int       `json:"commits"`
+	ActiveDays int       `json:"activeDays"`
+	Additions  int64     `json:"additions"`
+	Deletions  int64     `json:"deletions"`
+}
+
+// LanguageChurnStat is the number of changed lines in a language
+type LanguageChurnStat struct {
+	Language  string `json:"language"`
+	Additions int64  `json:"additions"`
+	Deletions int64  `json:"deletions"`
+	Churn     int64  `json:"churn"`
+}
+
+// FileChurnStat is a frequently changed file over the whole history
+type FileChurnStat struct {
+	Repo          string    `json:"repo"`
+	Path          string    `json:"path"`
+	Language      string    `json:"language"`
+	Changes       int       `json:"changes"`
+	Additions     int64     `json:"additions"`
+	Deletions     int64     `json:"deletions"`
+	LastChangedAt time.Time `json:"lastChangedAt"`
+}
+
+// GitHistoryReport summarises git activity for one or all projects
+type GitHistoryReport struct {
+	Period             string              `json:"period"`
+	Since              time.Time           `json:"since"`
+	Commits            int                 `json:"commits"`
+	ActiveDays         int                 `json:"activeDays"`
+	Contributors       int                 `json:"contributors"`
+	ActiveContributors int                 `json:"activeContributors"`
+	Weekly             []WeekActivity      `json:"weekly"`
+	Languages          []LanguageChurnStat `json:"languages"`
+	TopFiles           []FileChurnStat     `json:"topFiles"`
+}
+
+// GetGitHistory builds the git activity report for a period. Weekly
+// activity, active days and language churn are limited to the period; top
+// files cover the whole history. Contributors counts all authors and
+// ActiveContributors those with a commit in the period.
+func (s *Service) GetGitHistory(ctx context.Context, projectID *uuid.UUID, period string) (*GitHistoryReport, error) {
+	if period == "" {
+		period = "1y"
+	}
+	since, err := historySince(period)
+	if err != nil {
+		return nil, err
+	}
+	since = since.UTC()
+
+	report := &GitHistoryReport{
+		Period:    period,
+		Since:     since,
+		Weekly:    []WeekActivity{},
+		Languages: []LanguageChurnStat{},
+		TopFiles:  []FileChurnStat{},
+	}
+
+	scope := gitHistoryScope(projectID)
+
+	if report.Weekly, err = s.weeklyActivity(ctx, scope, since); err != nil {
+		return nil, err
+	}
+	for _, week := range report.Weekly {
+		report.Commits += week.Commits
+		report.ActiveDays += week.ActiveDays
+	}
+
+	if report.Languages, err = s.languageChurn(ctx, scope, since); err != nil {
+		return nil, err
+	}
+	if report.TopFiles, err = s.topFiles(ctx, scope); err != nil {
+		return nil, err
+	}
+	if report.Contributors, report.ActiveContributors, err = s.contributorCounts(ctx, scope, since); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// gitScope selects a git history table, aliased as h, joined to its project
+type gitScope func(table string) func(*gorm.DB) *gorm.DB
+
+// gitHistoryScope limits the git history tables to active projects, or to
+// one project. project_paths shares column names such as path with the
+// history tables, so queries using the scope qualify their columns.
+func gitHistoryScope(projectID *uuid.UUID) gitScope {
+	return func(table string) func(*gorm.DB) *gorm.DB {
+		return func(db *gorm.DB) *gorm.DB {
+			db = db.Table(table + " h").
+				Joins("JOIN project_paths p ON p.id = h.project_path_id AND p.is_active = true AND p.deleted_at IS NULL")
+			if projectID != nil {
+				db = db.Where("h.project_path_id = ?", *projectID)
+			}
+			return db
+		}
+	}
+}
+
+// weeklyActivity sums daily activity per week. Days are counted once even
+// if several repositories were active.
+func (s *Service) weeklyActivity(ctx context.Context, scope gitScope, since time.Time) ([]WeekActivity, error) {
+	weekly := []WeekActivity{}
+	if err := s.db.WithContext(ctx).Scopes(scope("code_git_daily")).
+		Select(`date_trunc('week', h.day)::date AS week,
+			SUM(h.commits) AS commits,
+			COUNT(DISTINCT h.day) AS active_days,
+			SUM(h.additions) AS additions,
+			SUM(h.deletions) AS deletions`).
+		Where("h.day >= ?", since).
+		Group("1").Order("1").
+		Scan(&weekly).Error; err != nil {
+		return nil, fmt.Errorf("failed to query weekly git activity: %w", err)
+	}
+	return weekly, nil
+}
+
+// languageChurn sums changed lines per language over the weeks of a period
+func (s *Service) languageChurn(ctx context.Context, scope gitScope, since time.Time) ([]LanguageChurnStat, error) {
+	languages := []LanguageChurnStat{}
+	if err := s.db.WithContext(ctx).Scopes(scope("code_git_language_churn")).
+		Select("h.language, SUM(h.additions) AS additions, SUM(h.deletions) AS deletions, SUM(h.additions + h.deletions) AS churn").
+		Where("h.week >= ?", since.AddDate(0, 0, -6)).
+		Group("h.language").Order("churn DESC, h.language").
+		Scan(&languages).Error; err != nil {
+		return nil, fmt.Errorf("failed to query language churn: %w", err)
+	}
+	return languages, nil
+}
+
+// topFiles returns the most frequently changed files
+func (s *Service) topFiles(ctx context.Context, scope gitScope) ([]FileChurnStat, error) {
+	files := []FileChurnStat{}
+	if err := s.db.WithContext(ctx).Scopes(scope("code_git_file_churn")).
+		Select("h.repo, h.path, h.language, h.changes, h.additions, h.deletions, h.last_changed_at").
+		Order("h.changes DESC, h.path").Limit(maxTopFiles).
+		Scan(&files).Error; err != nil {
+		return nil, fmt.Errorf("failed to query file churn: %w", err)
+	}
+	return files, nil
+}
+
+// contributorCounts returns the number of authors and of those with a
+// commit since the start of the period
+func (s *Service) contributorCounts(ctx context.Context, scope gitScope, since time.Time) (total, active int, err error) {
+	var contributors struct {
+		Total  int
+		Active int
+	}
+	if err := s.db.WithContext(ctx).Scopes(scope("code_git_contributors")).
+		Select("COUNT(DISTINCT h.author_hash) AS total, COUNT(DISTINCT h.author_hash) FILTER (WHERE h.last_commit_at >= ?) AS active", since).
+		Scan(&contributors).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to query contributors: %w", err)
+	}
+	return contributors.Total, contributors.Active, nil
+}
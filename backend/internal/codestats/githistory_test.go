@@ -0,0 +1,401 @@
+package codestats
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// The weekly activity query uses date_trunc, so only the other git history
+// queries run against sqlite
+func newGitHistoryTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.Exec(`CREATE TABLE project_paths (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		language TEXT,
+		is_active BOOLEAN DEFAULT true,
+		deleted_at TIMESTAMP
+	)`).Error)
+	require.NoError(t, db.AutoMigrate(&GitSyncState{}, &GitDailyActivity{}, &GitLanguageChurn{}, &GitFileChurn{}, &GitContributor{}))
+
+	return &Service{db: db}
+}
+
+func TestGitHistoryQueries(t *testing.T) {
+	s := newGitHistoryTestService(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	since := now.AddDate(0, -1, 0)
+
+	active, other, inactive, deleted := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	for _, project := range []struct {
+		id       uuid.UUID
+		isActive bool
+		deleted  bool
+	}{
+		{active, true, false},
+		{other, true, false},
+		{inactive, false, false},
+		{deleted, true, true},
+	} {
+		var deletedAt *time.Time
+		if project.deleted {
+			deletedAt = &now
+		}
+		require.NoError(t, s.db.Exec(`INSERT INTO project_paths (id, name, path, language, is_active, deleted_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			project.id, project.id.String(), "/srv/"+project.id.String(), "Go", project.isActive, deletedAt).Error)
+	}
+
+	files := []GitFileChurn{
+		{ProjectPathID: active, Repo: "site", Path: "main.go", Language: "Go", Changes: 9, Additions: 90, Deletions: 10, LastChangedAt: now},
+		{ProjectPathID: active, Repo: "site", Path: "README.md", Language: "Markdown", Changes: 3, Additions: 5, Deletions: 1, LastChangedAt: now},
+		{ProjectPathID: other, Repo: "tool", Path: "main.go", Language: "Go", Changes: 5, Additions: 20, Deletions: 2, LastChangedAt: now},
+		{ProjectPathID: inactive, Repo: "old", Path: "main.go", Language: "Go", Changes: 50, LastChangedAt: now},
+		{ProjectPathID: deleted, Repo: "gone", Path: "main.go", Language: "Go", Changes: 50, LastChangedAt: now},
+	}
+	require.NoError(t, s.db.Create(&files).Error)
+
+	week := now.AddDate(0, 0, -7)
+	languages := []GitLanguageChurn{
+		{ProjectPathID: active, Repo: "site", Week: week, Language: "Go", Additions: 40, Deletions: 10},
+		{ProjectPathID: active, Repo: "site", Week: week, Language: "Markdown", Additions: 5, Deletions: 1},
+		{ProjectPathID: active, Repo: "site", Week: now.AddDate(-1, 0, 0), Language: "Markdown", Additions: 500},
+		{ProjectPathID: other, Repo: "tool", Week: week, Language: "Go", Additions: 20, Deletions: 2},
+		{ProjectPathID: inactive, Repo: "old", Week: week, Language: "Rust", Additions: 1000},
+	}
+	require.NoError(t, s.db.Create(&languages).Error)
+
+	contributors := []GitContributor{
+		{ProjectPathID: active, Repo: "site", AuthorHash: "a", Commits: 3, LastCommitAt: now},
+		{ProjectPathID: active, Repo: "site", AuthorHash: "b", Commits: 1, LastCommitAt: now.AddDate(-1, 0, 0)},
+		{ProjectPathID: other, Repo: "tool", AuthorHash: "a", Commits: 2, LastCommitAt: now},
+		{ProjectPathID: deleted, Repo: "gone", AuthorHash: "c", Commits: 2, LastCommitAt: now},
+	}
+	require.NoError(t, s.db.Create(&contributors).Error)
+
+	t.Run("all projects", func(t *testing.T) {
+		scope := gitHistoryScope(nil)
+
+		top, err := s.topFiles(ctx, scope)
+		require.NoError(t, err)
+		require.Len(t, top, 3)
+		assert.Equal(t, "site", top[0].Repo)
+		assert.Equal(t, "main.go", top[0].Path)
+		assert.Equal(t, 9, top[0].Changes)
+		assert.Equal(t, "tool", top[1].Repo)
+		assert.Equal(t, "README.md", top[2].Path)
+
+		churn, err := s.languageChurn(ctx, scope, since)
+		require.NoError(t, err)
+		assert.Equal(t, []LanguageChurnStat{
+			{Language: "Go", Additions: 60, Deletions: 12, Churn: 72},
+			{Language: "Markdown", Additions: 5, Deletions: 1, Churn: 6},
+		}, churn)
+
+		total, activeCount, err := s.contributorCounts(ctx, scope, since)
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.Equal(t, 1, activeCount)
+	})
+
+	t.Run("one project", func(t *testing.T) {
+		scope := gitHistoryScope(&other)
+
+		top, err := s.topFiles(ctx, scope)
+		require.NoError(t, err)
+		require.Len(t, top, 1)
+		assert.Equal(t, "tool", top[0].Repo)
+
+		churn, err := s.languageChurn(ctx, scope, since)
+		require.NoError(t, err)
+		assert.Equal(t, []LanguageChurnStat{{Language: "Go", Additions: 20, Deletions: 2, Churn: 22}}, churn)
+
+		total, activeCount, err := s.contributorCounts(ctx, scope, since)
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Equal(t, 1, activeCount)
+	})
+
+	t.Run("inactive project", func(t *testing.T) {
+		top, err := s.topFiles(ctx, gitHistoryScope(&inactive))
+		require.NoError(t, err)
+		assert.Empty(t, top)
+	})
+}
+
+// testRepo is a git repository in a temporary directory with a fixed
+// identity and commit dates
+type testRepo struct {
+	t   *testing.T
+	dir string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	r := &testRepo{t: t, dir: t.TempDir()}
+	r.git("init", "--quiet", "--initial-branch=main")
+	return r
+}
+
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	return r.gitAs("Dev@Example.com", "2024-03-11T12:00:00Z", args...)
+}
+
+func (r *testRepo) gitAs(email, date string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Dev",
+		"GIT_AUTHOR_EMAIL="+email,
+		"GIT_AUTHOR_DATE="+date,
+		"GIT_COMMITTER_NAME=Dev",
+		"GIT_COMMITTER_EMAIL="+email,
+		"GIT_COMMITTER_DATE="+date,
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(r.t, err, "git %s: %s", strings.Join(args, " "), output)
+	return strings.TrimSpace(string(output))
+}
+
+func (r *testRepo) write(path, content string) {
+	r.t.Helper()
+	full := filepath.Join(r.dir, filepath.FromSlash(path))
+	require.NoError(r.t, os.MkdirAll(filepath.Dir(full), 0755))
+	require.NoError(r.t, os.WriteFile(full, []byte(content), 0644))
+}
+
+// commit stages everything and commits it as email at date
+func (r *testRepo) commit(email, date, message string) {
+	r.t.Helper()
+	r.git("add", "-A")
+	r.gitAs(email, date, "commit", "--quiet", "-m", message)
+}
+
+func TestReadGitLog(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("main.go", "package main\n\nfunc main() {}\n")
+	repo.write("logo.png", "\x89PNG\x00\x01\x02")
+	repo.commit("First@Example.com", "2024-03-10T09:00:00+02:00", "initial")
+
+	repo.git("checkout", "--quiet", "-b", "feature")
+	repo.write("README.md", "# Readme\n")
+	repo.commit("second@example.com", "2024-03-11T09:00:00Z", "readme")
+	repo.git("checkout", "--quiet", "main")
+	repo.write("main.go", "package main\n\nfunc main() {\n\tprintln()\n}\n")
+	repo.commit("first@example.com", "2024-03-12T09:00:00Z", "print")
+	repo.gitAs("first@example.com", "2024-03-13T09:00:00Z", "merge", "--quiet", "--no-ff", "-m", "merge", "feature")
+
+	var commits []gitCommit
+	require.NoError(t, readGitLog(context.Background(), repo.dir, "HEAD", func(commit gitCommit) {
+		commits = append(commits, commit)
+	}))
+
+	require.Len(t, commits, 3, "merge commits are skipped")
+	first := commits[0]
+	assert.Len(t, first.hash, 40)
+	assert.Equal(t, "first@example.com", first.author, "emails are lowercased")
+	assert.True(t, first.when.Equal(time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC)))
+	assert.ElementsMatch(t, []gitFileChange{
+		{path: "main.go", additions: 3},
+		{path: "logo.png"}, // binary files have no line counts
+	}, first.files)
+
+	assert.True(t, commits[1].when.Before(commits[2].when), "commits are read oldest first")
+	var edit gitCommit
+	for _, commit := range commits[1:] {
+		if commit.author == "first@example.com" {
+			edit = commit
+		}
+	}
+	assert.Equal(t, []gitFileChange{{path: "main.go", additions: 3, deletions: 1}}, edit.files)
+
+	commits = nil
+	require.NoError(t, readGitLog(context.Background(), repo.dir, first.hash+"..HEAD", func(commit gitCommit) {
+		commits = append(commits, commit)
+	}))
+	assert.Len(t, commits, 2, "a range only reads newer commits")
+
+	err := readGitLog(context.Background(), repo.dir, "no-such-branch", func(gitCommit) {})
+	assert.Error(t, err)
+}
+
+func TestGitAggregateAdd(t *testing.T) {
+	projectID := uuid.New()
+	agg := &gitAggregate{
+		daily:        make(map[time.Time]*GitDailyActivity),
+		languages:    make(map[[2]string]*GitLanguageChurn),
+		files:        make(map[string]*GitFileChurn),
+		contributors: make(map[string]*GitContributor),
+	}
+	excluded := func(path string) bool { return strings.HasPrefix(path, "vendor/") }
+
+	sunday := time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC)
+	// Monday morning in UTC+5 is still Sunday in UTC
+	sundayUTC := time.Date(2024, 3, 11, 1, 0, 0, 0, time.FixedZone("UTC+5", 5*60*60))
+	monday := time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)
+
+	agg.add(projectID, "site", gitCommit{author: "a@example.com", when: sunday, files: []gitFileChange{
+		{path: "main.go", additions: 10, deletions: 2},
+		{path: "vendor/lib.go", additions: 1000},
+	}}, excluded)
+	agg.add(projectID, "site", gitCommit{author: "b@example.com", when: sundayUTC, files: []gitFileChange{
+		{path: "README.md", additions: 4},
+		{path: "data.bin", additions: 1},
+	}}, excluded)
+	agg.add(projectID, "site", gitCommit{author: "a@example.com", when: monday, files: []gitFileChange{
+		{path: "main.go", additions: 1, deletions: 1},
+		{path: "vendor/lib.go", deletions: 1000},
+	}}, excluded)
+
+	assert.Equal(t, 3, agg.commits)
+
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	require.Len(t, agg.daily, 2)
+	assert.Equal(t, 2, agg.daily[day(10)].Commits)
+	assert.Equal(t, int64(15), agg.daily[day(10)].Additions, "excluded files are not counted")
+	assert.Equal(t, int64(2), agg.daily[day(10)].Deletions)
+	assert.Equal(t, 1, agg.daily[day(11)].Commits, "a commit touching only excluded files still counts")
+	assert.Equal(t, int64(1), agg.daily[day(11)].Deletions)
+
+	// Weeks start on Monday, so Sunday belongs to the previous week
+	assert.Equal(t, map[[2]string]*GitLanguageChurn{
+		{"2024-03-04", "Go"}:       {ProjectPathID: projectID, Repo: "site", Week: day(4), Language: "Go", Additions: 10, Deletions: 2},
+		{"2024-03-04", "Markdown"}: {ProjectPathID: projectID, Repo: "site", Week: day(4), Language: "Markdown", Additions: 4},
+		{"2024-03-04", "Other"}:    {ProjectPathID: projectID, Repo: "site", Week: day(4), Language: "Other", Additions: 1},
+		{"2024-03-11", "Go"}:       {ProjectPathID: projectID, Repo: "site", Week: day(11), Language: "Go", Additions: 1, Deletions: 1},
+	}, agg.languages)
+
+	require.Len(t, agg.files, 3)
+	assert.NotContains(t, agg.files, "vendor/lib.go")
+	mainGo := agg.files["main.go"]
+	assert.Equal(t, 2, mainGo.Changes)
+	assert.Equal(t, int64(11), mainGo.Additions)
+	assert.Equal(t, monday, mainGo.LastChangedAt)
+
+	require.Len(t, agg.contributors, 2)
+	for hash, contributor := range agg.contributors {
+		assert.Len(t, hash, 64, "authors are stored hashed")
+		assert.NotContains(t, hash, "example")
+		if contributor.Commits == 2 {
+			assert.Equal(t, sunday, contributor.FirstCommitAt)
+			assert.Equal(t, monday, contributor.LastCommitAt)
+		}
+	}
+}
+
+func TestSyncRepo(t *testing.T) {
+	initTestLogger(t)
+	s := newGitHistoryTestService(t)
+	ctx := context.Background()
+
+	repo := newTestRepo(t)
+	project := &projectpath.ProjectPath{ID: uuid.New(), Name: "site", Path: repo.dir}
+	excluded := &ignoreMatcher{}
+	excluded.add("", []string{"*.lock"})
+
+	state := func() GitSyncState {
+		t.Helper()
+		var state GitSyncState
+		require.NoError(t, s.db.Where("project_path_id = ? AND repo = ?", project.ID, "").First(&state).Error)
+		return state
+	}
+	file := func(path string) GitFileChurn {
+		t.Helper()
+		var file GitFileChurn
+		require.NoError(t, s.db.Where("project_path_id = ? AND path = ?", project.ID, path).First(&file).Error)
+		return file
+	}
+	count := func(model interface{}) int64 {
+		t.Helper()
+		var n int64
+		require.NoError(t, s.db.Model(model).Where("project_path_id = ?", project.ID).Count(&n).Error)
+		return n
+	}
+
+	// A repository without commits is skipped
+	require.NoError(t, s.syncRepo(ctx, project, "", excluded))
+	assert.Zero(t, count(&GitSyncState{}))
+
+	repo.write("main.go", "package main\n")
+	repo.write("deps.lock", "a\nb\n")
+	repo.commit("dev@example.com", "2024-03-11T09:00:00Z", "initial")
+	repo.write("main.go", "package main\n\nfunc main() {}\n")
+	repo.commit("dev@example.com", "2024-03-12T09:00:00Z", "main")
+
+	require.NoError(t, s.syncRepo(ctx, project, "", excluded))
+	synced := state()
+	assert.Equal(t, 2, synced.Commits)
+	assert.Equal(t, repo.git("rev-parse", "HEAD"), synced.LastCommit)
+	assert.Equal(t, 2, file("main.go").Changes)
+	assert.Equal(t, int64(1), count(&GitFileChurn{}), "excluded files are not stored")
+
+	// Syncing again without new commits changes nothing
+	require.NoError(t, s.syncRepo(ctx, project, "", excluded))
+	assert.Equal(t, 2, state().Commits)
+	assert.Equal(t, 2, file("main.go").Changes)
+
+	t.Run("incremental", func(t *testing.T) {
+		repo.write("main.go", "package main\n\nfunc main() { println() }\n")
+		repo.write("README.md", "# Site\n")
+		repo.commit("other@example.com", "2024-03-12T18:00:00Z", "readme")
+
+		require.NoError(t, s.syncRepo(ctx, project, "", excluded))
+		assert.Equal(t, 3, state().Commits)
+		main := file("main.go")
+		assert.Equal(t, 3, main.Changes, "only the new commit is added")
+		assert.Equal(t, int64(4), main.Additions)
+		assert.Equal(t, int64(1), main.Deletions)
+		assert.Equal(t, int64(2), count(&GitContributor{}))
+
+		var day GitDailyActivity
+		require.NoError(t, s.db.Where("project_path_id = ?", project.ID).Order("day DESC").First(&day).Error)
+		assert.Equal(t, 2, day.Commits, "commits on a day already stored are added to it")
+	})
+
+	t.Run("force push rebuilds", func(t *testing.T) {
+		repo.git("reset", "--quiet", "--hard", "HEAD~2")
+		repo.write("lib.go", "package main\n")
+		repo.commit("dev@example.com", "2024-03-13T09:00:00Z", "rewritten")
+
+		require.NoError(t, s.syncRepo(ctx, project, "", excluded))
+		rebuilt := state()
+		assert.Equal(t, 2, rebuilt.Commits)
+		assert.Equal(t, repo.git("rev-parse", "HEAD"), rebuilt.LastCommit)
+
+		assert.Equal(t, 1, file("main.go").Changes, "history from before the rewrite is dropped")
+		assert.Equal(t, 1, file("lib.go").Changes)
+		assert.Equal(t, int64(2), count(&GitFileChurn{}))
+		assert.Equal(t, int64(1), count(&GitContributor{}))
+		assert.Equal(t, int64(2), count(&GitDailyActivity{}))
+	})
+}
@@ -0,0 +1,162 @@
+package codestats
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single compiled gitignore pattern
+type ignoreRule struct {
+	// base is the slash-separated directory, relative to the scan root, of
+	// the .gitignore that defined the rule ("" for the root)
+	base     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	re       *regexp.Regexp
+}
+
+// ignoreMatcher evaluates gitignore rules; the last matching rule wins
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// add compiles gitignore-style patterns defined in the directory base
+func (m *ignoreMatcher) add(base string, patterns []string) {
+	for _, pattern := range patterns {
+		if rule, ok := compileIgnoreRule(base, pattern); ok {
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// addFile loads the .gitignore in dir, if there is one
+func (m *ignoreMatcher) addFile(dir, base string) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	m.add(base, patterns)
+}
+
+// clone returns a matcher that can be extended without affecting m, so
+// rules from a subdirectory's .gitignore only apply below it
+func (m *ignoreMatcher) clone() *ignoreMatcher {
+	return &ignoreMatcher{rules: append([]ignoreRule(nil), m.rules...)}
+}
+
+// ignored reports whether the slash-separated path relative to the scan root
+// is ignored
+func (m *ignoreMatcher) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		p := rel
+		if rule.base != "" {
+			var ok bool
+			if p, ok = strings.CutPrefix(rel, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		if !rule.anchored {
+			p = path.Base(p)
+		}
+
+		if rule.re.MatchString(p) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func compileIgnoreRule(base, pattern string) (ignoreRule, bool) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// A slash anywhere but the end anchors the pattern to its directory;
+	// otherwise it matches a name at any depth
+	if strings.Contains(pattern, "/") {
+		rule.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// globToRegexp translates gitignore glob syntax, including **, to a regexp
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("(?:/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
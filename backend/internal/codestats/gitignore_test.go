@@ -0,0 +1,115 @@
+package codestats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"*.go", `[^/]*\.go`},
+		{"file?.txt", `file[^/]\.txt`},
+		{"**/foo", `(?:.*/)?foo`},
+		{"foo/**", `foo(?:/.*)?`},
+		{"a/**/b", `a/(?:.*/)?b`},
+		{"a**b", `a.*b`},
+		{"[abc].go", `[abc]\.go`},
+		{"[!abc].go", `[^abc]\.go`},
+		{"[abc", `\[abc`},
+		{`\*.go`, `\*\.go`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			assert.Equal(t, tt.want, globToRegexp(tt.glob))
+		})
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	m := &ignoreMatcher{}
+	m.add("", []string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"build/",
+		"/vendor",
+		"docs/**/*.md",
+		"**/generated",
+		"tmp/**",
+		"file?.txt",
+		`\#literal`,
+		"trailing.txt   ",
+	})
+
+	tests := []struct {
+		name  string
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"unanchored at root", "app.log", false, true},
+		{"unanchored in subdirectory", "src/deep/app.log", false, true},
+		{"negated", "keep.log", false, false},
+		{"negated in subdirectory", "src/keep.log", false, false},
+		{"dir-only matches directory", "build", true, true},
+		{"dir-only skips file", "build", false, false},
+		{"dir-only in subdirectory", "src/build", true, true},
+		{"anchored at root", "vendor", true, true},
+		{"anchored not in subdirectory", "src/vendor", true, false},
+		{"double star directly below", "docs/readme.md", false, true},
+		{"double star nested", "docs/a/b/readme.md", false, true},
+		{"double star pattern is anchored", "site/docs/readme.md", false, false},
+		{"leading double star at root", "generated", true, true},
+		{"leading double star nested", "a/b/generated", true, true},
+		{"trailing double star", "tmp/a/b.go", false, true},
+		{"trailing double star sibling", "tmpfile", false, false},
+		{"question mark", "file1.txt", false, true},
+		{"question mark single character", "file10.txt", false, false},
+		{"escaped hash", "#literal", false, true},
+		{"trailing spaces trimmed", "trailing.txt", false, true},
+		{"unmatched", "main.go", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, m.ignored(tt.rel, tt.isDir))
+		})
+	}
+}
+
+func TestIgnoreMatcherNestedScope(t *testing.T) {
+	root := &ignoreMatcher{}
+	root.add("", []string{"*.log", "*.tmp"})
+
+	pkg := root.clone()
+	pkg.add("pkg", []string{"!important.log", "/out", "*.gen.go"})
+
+	tests := []struct {
+		name    string
+		matcher *ignoreMatcher
+		rel     string
+		want    bool
+	}{
+		{"root rule applies below", pkg, "pkg/a.tmp", true},
+		{"nested negation overrides root rule", pkg, "pkg/important.log", false},
+		{"nested negation scoped to its directory", pkg, "other/important.log", true},
+		{"nested rule applies at depth", pkg, "pkg/sub/a.gen.go", true},
+		{"nested anchor is relative to its directory", pkg, "pkg/out", true},
+		{"nested anchor not deeper", pkg, "pkg/sub/out", false},
+		{"nested rule not outside its directory", pkg, "a.gen.go", false},
+		{"clone leaves parent untouched", root, "pkg/a.gen.go", false},
+		{"parent negation untouched", root, "pkg/important.log", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.matcher.ignored(tt.rel, false))
+		})
+	}
+}
@@ -0,0 +1,447 @@
+package codestats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrInvalidPeriod    = errors.New("invalid period")
+	ErrInvalidInterval  = errors.New("invalid interval")
+)
+
+// Snapshot records the statistics of one project at one point in time. A
+// snapshot is only written when the numbers changed since the previous one,
+// so a project's latest snapshot stays valid until the next one.
+type Snapshot struct {
+	ID            uuid.UUID          `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ProjectPathID uuid.UUID          `gorm:"type:uuid;not null;index" json:"projectPathId"`
+	ProjectName   string             `gorm:"type:varchar(255);not null" json:"projectName"`
+	Files         int                `json:"files"`
+	Lines         int64              `json:"lines"`
+	Code          int64              `json:"code"`
+	Comments      int64              `json:"comments"`
+	Blanks        int64              `json:"blanks"`
+	Languages     []SnapshotLanguage `gorm:"foreignKey:SnapshotID" json:"languages,omitempty"`
+	CreatedAt     time.Time          `json:"createdAt"`
+}
+
+func (Snapshot) TableName() string { return "code_stats_snapshots" }
+
+// SnapshotLanguage holds one language's numbers within a snapshot. The
+// project and time are repeated so series can be queried without a join.
+type SnapshotLanguage struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"-"`
+	SnapshotID    uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	ProjectPathID uuid.UUID `gorm:"type:uuid;not null" json:"-"`
+	Language      string    `gorm:"type:varchar(100);not null" json:"language"`
+	Files         int       `json:"files"`
+	Lines         int64     `json:"lines"`
+	Code          int64     `json:"code"`
+	Comments      int64     `json:"comments"`
+	Blanks        int64     `json:"blanks"`
+	CreatedAt     time.Time `json:"-"`
+}
+
+func (SnapshotLanguage) TableName() string { return "code_stats_language_snapshots" }
+
+// SeriesPoint is the total for one bucket of a time series
+type SeriesPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Files     int       `json:"files"`
+	Lines     int64     `json:"lines"`
+	Code      int64     `json:"code"`
+	// Growth is the change in lines since the previous point
+	Growth int64 `json:"growth"`
+}
+
+// SeriesQuery selects the data for a time series. ProjectID and Language are
+// optional filters.
+type SeriesQuery struct {
+	ProjectID *uuid.UUID
+	Language  string
+	Period    string
+	Interval  string
+}
+
+// LanguageDiff is the change of one language between two snapshots
+type LanguageDiff struct {
+	Language   string `json:"language"`
+	FromLines  int64  `json:"fromLines"`
+	ToLines    int64  `json:"toLines"`
+	LinesDelta int64  `json:"linesDelta"`
+	CodeDelta  int64  `json:"codeDelta"`
+	FilesDelta int    `json:"filesDelta"`
+}
+
+// SnapshotDiff compares two snapshots
+type SnapshotDiff struct {
+	From       *Snapshot      `json:"from"`
+	To         *Snapshot      `json:"to"`
+	LinesDelta int64          `json:"linesDelta"`
+	CodeDelta  int64          `json:"codeDelta"`
+	FilesDelta int            `json:"filesDelta"`
+	Languages  []LanguageDiff `json:"languages"`
+}
+
+// historySince converts a period such as 30d, 12w, 6m or 1y into a start time
+func historySince(period string) (time.Time, error) {
+	now := time.Now()
+	if period == "" {
+		period = "1y"
+	}
+
+	var n int
+	var unit string
+	if _, err := fmt.Sscanf(period, "%d%s", &n, &unit); err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidPeriod, period)
+	}
+
+	switch unit {
+	case "d":
+		return now.AddDate(0, 0, -n), nil
+	case "w":
+		return now.AddDate(0, 0, -7*n), nil
+	case "m":
+		return now.AddDate(0, -n, 0), nil
+	case "y":
+		return now.AddDate(-n, 0, 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidPeriod, period)
+	}
+}
+
+// recordSnapshot stores a project's statistics unless they are identical to
+// the project's latest snapshot
+func (s *Service) recordSnapshot(ctx context.Context, project *projectpath.ProjectPath, stats *CodeStats) error {
+	latest, err := s.latestSnapshot(ctx, project.ID)
+	if err != nil {
+		return err
+	}
+	if latest != nil && sameStats(latest, stats) {
+		return nil
+	}
+
+	now := time.Now()
+	snapshot := &Snapshot{
+		ID:            uuid.New(),
+		ProjectPathID: project.ID,
+		ProjectName:   project.Name,
+		Files:         stats.TotalFiles,
+		Lines:         stats.TotalLines,
+		Code:          stats.TotalCode,
+		Comments:      stats.TotalComment,
+		Blanks:        stats.TotalBlanks,
+		CreatedAt:     now,
+	}
+	for _, lang := range stats.Languages {
+		snapshot.Languages = append(snapshot.Languages, SnapshotLanguage{
+			ProjectPathID: project.ID,
+			Language:      lang.Name,
+			Files:         lang.Files,
+			Lines:         lang.Lines,
+			Code:          lang.Code,
+			Comments:      lang.Comments,
+			Blanks:        lang.Blanks,
+			CreatedAt:     now,
+		})
+	}
+
+	if err := s.db.WithContext(ctx).Create(snapshot).Error; err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+// sameStats reports whether a snapshot holds exactly the given statistics
+func sameStats(snapshot *Snapshot, stats *CodeStats) bool {
+	if snapshot.Files != stats.TotalFiles || snapshot.Lines != stats.TotalLines ||
+		snapshot.Code != stats.TotalCode || snapshot.Comments != stats.TotalComment ||
+		snapshot.Blanks != stats.TotalBlanks || len(snapshot.Languages) != len(stats.Languages) {
+		return false
+	}
+
+	langs := make(map[string]SnapshotLanguage, len(snapshot.Languages))
+	for _, lang := range snapshot.Languages {
+		langs[lang.Language] = lang
+	}
+	for _, lang := range stats.Languages {
+		prev, ok := langs[lang.Name]
+		if !ok || prev.Files != lang.Files || prev.Lines != lang.Lines || prev.Code != lang.Code ||
+			prev.Comments != lang.Comments || prev.Blanks != lang.Blanks {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) latestSnapshot(ctx context.Context, projectID uuid.UUID) (*Snapshot, error) {
+	var snapshot Snapshot
+	err := s.db.WithContext(ctx).Preload("Languages").
+		Where("project_path_id = ?", projectID).
+		Order("created_at DESC").
+		First(&snapshot).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetProjectStats returns the latest snapshot of every active project
+func (s *Service) GetProjectStats(ctx context.Context) ([]Snapshot, error) {
+	var ids []uuid.UUID
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (s.project_path_id) s.id
+		FROM code_stats_snapshots s
+		JOIN project_paths p ON p.id = s.project_path_id
+		WHERE p.is_active = true AND p.deleted_at IS NULL
+		ORDER BY s.project_path_id, s.created_at DESC
+	`).Scan(&ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to query project stats: %w", err)
+	}
+
+	snapshots := []Snapshot{}
+	if len(ids) == 0 {
+		return snapshots, nil
+	}
+	if err := s.db.WithContext(ctx).Preload("Languages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("lines DESC")
+	}).Where("id IN ?", ids).Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to load project stats: %w", err)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Lines > snapshots[j].Lines
+	})
+	return snapshots, nil
+}
+
+// ListSnapshots returns a project's snapshots, newest first
+func (s *Service) ListSnapshots(ctx context.Context, projectID uuid.UUID, limit int) ([]Snapshot, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	var snapshots []Snapshot
+	err := s.db.WithContext(ctx).
+		Where("project_path_id = ?", projectID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// GetSeries returns totals per interval bucket. Each bucket counts the
+// latest snapshot of every active project taken before the bucket ends, so
+// projects that did not change in a bucket still contribute.
+func (s *Service) GetSeries(ctx context.Context, query SeriesQuery) ([]SeriesPoint, error) {
+	since, err := historySince(query.Period)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := query.Interval
+	if interval == "" {
+		interval = "week"
+	}
+	switch interval {
+	case "day", "week", "month":
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, interval)
+	}
+
+	var projectFilter, languageFilter string
+	args := []interface{}{since}
+	if query.ProjectID != nil {
+		projectFilter = "AND s.project_path_id = ?"
+		args = append(args, *query.ProjectID)
+	}
+	if query.Language != "" {
+		languageFilter = "AND LOWER(l.language) = LOWER(?)"
+		args = append(args, query.Language)
+	}
+
+	// interval is validated above, so it is safe to inline
+	sql := fmt.Sprintf(`
+		SELECT
+			b.bucket AS timestamp,
+			COALESCE(SUM(l.files), 0) AS files,
+			COALESCE(SUM(l.lines), 0) AS lines,
+			COALESCE(SUM(l.code), 0) AS code
+		FROM generate_series(date_trunc('%[1]s', ?::timestamptz), now(), interval '1 %[1]s') AS b(bucket)
+		LEFT JOIN LATERAL (
+			SELECT DISTINCT ON (s.project_path_id) s.id
+			FROM code_stats_snapshots s
+			JOIN project_paths p ON p.id = s.project_path_id
+			WHERE s.created_at < b.bucket + interval '1 %[1]s'
+			AND p.is_active = true AND p.deleted_at IS NULL
+			%[2]s
+			ORDER BY s.project_path_id, s.created_at DESC
+		) latest ON true
+		LEFT JOIN code_stats_language_snapshots l ON l.snapshot_id = latest.id %[3]s
+		GROUP BY b.bucket
+		ORDER BY b.bucket
+	`, interval, projectFilter, languageFilter)
+
+	var points []SeriesPoint
+	if err := s.db.WithContext(ctx).Raw(sql, args...).Scan(&points).Error; err != nil {
+		return nil, fmt.Errorf("failed to query code stats series: %w", err)
+	}
+
+	for i := 1; i < len(points); i++ {
+		points[i].Growth = points[i].Lines - points[i-1].Lines
+	}
+	return points, nil
+}
+
+// DiffSnapshots compares two snapshots language by language
+func (s *Service) DiffSnapshots(ctx context.Context, fromID, toID uuid.UUID) (*SnapshotDiff, error) {
+	load := func(id uuid.UUID) (*Snapshot, error) {
+		var snapshot Snapshot
+		if err := s.db.WithContext(ctx).Preload("Languages").First(&snapshot, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+			}
+			return nil, err
+		}
+		return &snapshot, nil
+	}
+
+	from, err := load(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := load(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &SnapshotDiff{
+		From:       from,
+		To:         to,
+		LinesDelta: to.Lines - from.Lines,
+		CodeDelta:  to.Code - from.Code,
+		FilesDelta: to.Files - from.Files,
+		Languages:  []LanguageDiff{},
+	}
+
+	langs := make(map[string]*LanguageDiff)
+	get := func(name string) *LanguageDiff {
+		d, ok := langs[name]
+		if !ok {
+			d = &LanguageDiff{Language: name}
+			langs[name] = d
+		}
+		return d
+	}
+	for _, lang := range from.Languages {
+		d := get(lang.Language)
+		d.FromLines = lang.Lines
+		d.LinesDelta -= lang.Lines
+		d.CodeDelta -= lang.Code
+		d.FilesDelta -= lang.Files
+	}
+	for _, lang := range to.Languages {
+		d := get(lang.Language)
+		d.ToLines = lang.Lines
+		d.LinesDelta += lang.Lines
+		d.CodeDelta += lang.Code
+		d.FilesDelta += lang.Files
+	}
+
+	for _, d := range langs {
+		diff.Languages = append(diff.Languages, *d)
+	}
+	sort.Slice(diff.Languages, func(i, j int) bool {
+		a, b := abs64(diff.Languages[i].LinesDelta), abs64(diff.Languages[j].LinesDelta)
+		if a != b {
+			return a > b
+		}
+		return diff.Languages[i].Language < diff.Languages[j].Language
+	})
+
+	return diff, nil
+}
+
+// ProjectStatsSummaries returns the latest snapshot summary for each of the
+// given projects. It implements projectpath.StatsSummaryProvider.
+func (s *Service) ProjectStatsSummaries(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*projectpath.StatsSummary, error) {
+	summaries := make(map[uuid.UUID]*projectpath.StatsSummary, len(ids))
+	if len(ids) == 0 {
+		return summaries, nil
+	}
+
+	var snapshots []Snapshot
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (project_path_id) *
+		FROM code_stats_snapshots
+		WHERE project_path_id IN ?
+		ORDER BY project_path_id, created_at DESC
+	`, ids).Scan(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to query project stats: %w", err)
+	}
+
+	snapshotIDs := make([]uuid.UUID, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		snapshotIDs = append(snapshotIDs, snapshot.ID)
+	}
+
+	// The language with the most code in each snapshot
+	topLanguages := make(map[uuid.UUID]string)
+	if len(snapshotIDs) > 0 {
+		var rows []struct {
+			SnapshotID uuid.UUID
+			Language   string
+		}
+		if err := s.db.WithContext(ctx).Raw(`
+			SELECT DISTINCT ON (snapshot_id) snapshot_id, language
+			FROM code_stats_language_snapshots
+			WHERE snapshot_id IN ?
+			ORDER BY snapshot_id, code DESC
+		`, snapshotIDs).Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to query project languages: %w", err)
+		}
+		for _, row := range rows {
+			topLanguages[row.SnapshotID] = row.Language
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		id := snapshot.ProjectPathID.String()
+		summaries[snapshot.ProjectPathID] = &projectpath.StatsSummary{
+			SnapshotID:  snapshot.ID,
+			Files:       snapshot.Files,
+			Lines:       snapshot.Lines,
+			Code:        snapshot.Code,
+			TopLanguage: topLanguages[snapshot.ID],
+			ScannedAt:   snapshot.CreatedAt,
+			Links: map[string]string{
+				"snapshots": "/api/v1/code/stats/projects/" + id + "/snapshots",
+				"history":   "/api/v1/code/stats/history?project=" + id,
+			},
+		}
+	}
+
+	return summaries, nil
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
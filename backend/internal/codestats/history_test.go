@@ -0,0 +1,167 @@
+package codestats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestHistorySince(t *testing.T) {
+	tests := []struct {
+		period string
+		want   func(time.Time) time.Time
+	}{
+		{"", func(now time.Time) time.Time { return now.AddDate(-1, 0, 0) }},
+		{"30d", func(now time.Time) time.Time { return now.AddDate(0, 0, -30) }},
+		{"12w", func(now time.Time) time.Time { return now.AddDate(0, 0, -84) }},
+		{"6m", func(now time.Time) time.Time { return now.AddDate(0, -6, 0) }},
+		{"2y", func(now time.Time) time.Time { return now.AddDate(-2, 0, 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			before := time.Now()
+			since, err := historySince(tt.period)
+			after := time.Now()
+			require.NoError(t, err)
+			assert.False(t, since.Before(tt.want(before)))
+			assert.False(t, since.After(tt.want(after)))
+		})
+	}
+
+	for _, period := range []string{"d", "30", "0d", "-7d", "1yr", "5h", "week"} {
+		t.Run(period, func(t *testing.T) {
+			_, err := historySince(period)
+			assert.ErrorIs(t, err, ErrInvalidPeriod)
+		})
+	}
+}
+
+func TestSameStats(t *testing.T) {
+	snapshot := &Snapshot{
+		Files: 3, Lines: 120, Code: 90, Comments: 10, Blanks: 20,
+		Languages: []SnapshotLanguage{
+			{Language: "Go", Files: 2, Lines: 100, Code: 80, Comments: 5, Blanks: 15},
+			{Language: "Markdown", Files: 1, Lines: 20, Code: 10, Comments: 5, Blanks: 5},
+		},
+	}
+	stats := func() *CodeStats {
+		return &CodeStats{
+			TotalFiles: 3, TotalLines: 120, TotalCode: 90, TotalComment: 10, TotalBlanks: 20,
+			// Languages may come back in any order
+			Languages: []Language{
+				{Name: "Markdown", Files: 1, Lines: 20, Code: 10, Comments: 5, Blanks: 5},
+				{Name: "Go", Files: 2, Lines: 100, Code: 80, Comments: 5, Blanks: 15},
+			},
+		}
+	}
+
+	assert.True(t, sameStats(snapshot, stats()))
+
+	changes := map[string]func(*CodeStats){
+		"total lines":      func(s *CodeStats) { s.TotalLines++ },
+		"total comments":   func(s *CodeStats) { s.TotalComment++ },
+		"language code":    func(s *CodeStats) { s.Languages[1].Code-- },
+		"language blanks":  func(s *CodeStats) { s.Languages[0].Blanks++ },
+		"renamed language": func(s *CodeStats) { s.Languages[0].Name = "Text" },
+		"added language":   func(s *CodeStats) { s.Languages = append(s.Languages, Language{Name: "Shell"}) },
+		"removed language": func(s *CodeStats) { s.Languages = s.Languages[:1] },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := stats()
+			change(changed)
+			assert.False(t, sameStats(snapshot, changed))
+		})
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	// The uuid_generate_v4() defaults do not exist in sqlite
+	require.NoError(t, db.Exec(`CREATE TABLE code_stats_snapshots (
+		id TEXT PRIMARY KEY,
+		project_path_id TEXT NOT NULL,
+		project_name TEXT NOT NULL,
+		files INTEGER,
+		lines INTEGER,
+		code INTEGER,
+		comments INTEGER,
+		blanks INTEGER,
+		created_at TIMESTAMP
+	)`).Error)
+	require.NoError(t, db.Exec(`CREATE TABLE code_stats_language_snapshots (
+		id TEXT PRIMARY KEY,
+		snapshot_id TEXT NOT NULL,
+		project_path_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		files INTEGER,
+		lines INTEGER,
+		code INTEGER,
+		comments INTEGER,
+		blanks INTEGER,
+		created_at TIMESTAMP
+	)`).Error)
+
+	s := &Service{db: db}
+	projectID := uuid.New()
+	snapshot := func(files int, lines, code int64, languages ...SnapshotLanguage) *Snapshot {
+		snapshot := &Snapshot{ID: uuid.New(), ProjectPathID: projectID, ProjectName: "site", Files: files, Lines: lines, Code: code}
+		for _, lang := range languages {
+			lang.ID = uuid.New()
+			lang.ProjectPathID = projectID
+			snapshot.Languages = append(snapshot.Languages, lang)
+		}
+		require.NoError(t, db.Create(snapshot).Error)
+		return snapshot
+	}
+
+	from := snapshot(5, 150, 120,
+		SnapshotLanguage{Language: "Go", Files: 3, Lines: 100, Code: 80},
+		SnapshotLanguage{Language: "Python", Files: 2, Lines: 50, Code: 40},
+	)
+	to := snapshot(6, 150, 125,
+		SnapshotLanguage{Language: "Go", Files: 4, Lines: 120, Code: 95},
+		SnapshotLanguage{Language: "Rust", Files: 2, Lines: 30, Code: 30},
+	)
+
+	diff, err := s.DiffSnapshots(context.Background(), from.ID, to.ID)
+	require.NoError(t, err)
+	assert.Equal(t, from.ID, diff.From.ID)
+	assert.Equal(t, to.ID, diff.To.ID)
+	assert.Equal(t, int64(0), diff.LinesDelta)
+	assert.Equal(t, int64(5), diff.CodeDelta)
+	assert.Equal(t, 1, diff.FilesDelta)
+
+	// Languages in either snapshot are merged and sorted by the size of
+	// their change
+	assert.Equal(t, []LanguageDiff{
+		{Language: "Python", FromLines: 50, ToLines: 0, LinesDelta: -50, CodeDelta: -40, FilesDelta: -2},
+		{Language: "Rust", FromLines: 0, ToLines: 30, LinesDelta: 30, CodeDelta: 30, FilesDelta: 2},
+		{Language: "Go", FromLines: 100, ToLines: 120, LinesDelta: 20, CodeDelta: 15, FilesDelta: 1},
+	}, diff.Languages)
+
+	same, err := s.DiffSnapshots(context.Background(), to.ID, to.ID)
+	require.NoError(t, err)
+	assert.Zero(t, same.LinesDelta)
+	for _, lang := range same.Languages {
+		assert.Zero(t, lang.LinesDelta, lang.Language)
+	}
+	assert.Equal(t, "Go", same.Languages[0].Language, "ties are sorted by name")
+
+	_, err = s.DiffSnapshots(context.Background(), from.ID, uuid.New())
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+}
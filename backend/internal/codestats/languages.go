@@ -0,0 +1,139 @@
+package codestats
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// commentPair delimits a block comment
+type commentPair struct {
+	start string
+	end   string
+}
+
+// languageDef describes how to recognise a language and its comments. Names
+// match tokei's so history stays continuous when switching counters.
+type languageDef struct {
+	name       string
+	extensions []string
+	filenames  []string
+	// interpreters are matched against a shebang line
+	interpreters []string
+	line         []string
+	block        []commentPair
+}
+
+var (
+	cStyleLine  = []string{"//"}
+	cStyleBlock = []commentPair{{"/*", "*/"}}
+	hashLine    = []string{"#"}
+	htmlBlock   = []commentPair{{"<!--", "-->"}}
+)
+
+var languageDefs = []languageDef{
+	{name: "Go", extensions: []string{".go"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Rust", extensions: []string{".rs"}, line: cStyleLine, block: cStyleBlock},
+	{name: "C", extensions: []string{".c"}, line: cStyleLine, block: cStyleBlock},
+	{name: "C Header", extensions: []string{".h"}, line: cStyleLine, block: cStyleBlock},
+	{name: "C++", extensions: []string{".cc", ".cpp", ".cxx", ".c++"}, line: cStyleLine, block: cStyleBlock},
+	{name: "C++ Header", extensions: []string{".hh", ".hpp", ".hxx"}, line: cStyleLine, block: cStyleBlock},
+	{name: "C#", extensions: []string{".cs"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Java", extensions: []string{".java"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Kotlin", extensions: []string{".kt", ".kts"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Scala", extensions: []string{".scala", ".sc"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Swift", extensions: []string{".swift"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Dart", extensions: []string{".dart"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Zig", extensions: []string{".zig"}, line: cStyleLine},
+	{name: "JavaScript", extensions: []string{".js", ".mjs", ".cjs"}, interpreters: []string{"node", "deno", "bun"}, line: cStyleLine, block: cStyleBlock},
+	{name: "JSX", extensions: []string{".jsx"}, line: cStyleLine, block: cStyleBlock},
+	{name: "TypeScript", extensions: []string{".ts", ".mts", ".cts"}, interpreters: []string{"ts-node"}, line: cStyleLine, block: cStyleBlock},
+	{name: "TSX", extensions: []string{".tsx"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Vue", extensions: []string{".vue"}, line: cStyleLine, block: append([]commentPair{{"<!--", "-->"}}, cStyleBlock...)},
+	{name: "Svelte", extensions: []string{".svelte"}, line: cStyleLine, block: append([]commentPair{{"<!--", "-->"}}, cStyleBlock...)},
+	{name: "CSS", extensions: []string{".css"}, block: cStyleBlock},
+	{name: "Sass", extensions: []string{".scss", ".sass"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Less", extensions: []string{".less"}, line: cStyleLine, block: cStyleBlock},
+	{name: "HTML", extensions: []string{".html", ".htm"}, block: htmlBlock},
+	{name: "XML", extensions: []string{".xml", ".svg"}, block: htmlBlock},
+	{name: "Markdown", extensions: []string{".md", ".markdown"}},
+	{name: "JSON", extensions: []string{".json"}},
+	{name: "YAML", extensions: []string{".yml", ".yaml"}, line: hashLine},
+	{name: "TOML", extensions: []string{".toml"}, line: hashLine},
+	{name: "SQL", extensions: []string{".sql"}, line: []string{"--"}, block: cStyleBlock},
+	{name: "GraphQL", extensions: []string{".graphql", ".gql"}, line: hashLine},
+	{name: "Protocol Buffers", extensions: []string{".proto"}, line: cStyleLine, block: cStyleBlock},
+	{name: "Python", extensions: []string{".py", ".pyw"}, interpreters: []string{"python"}, line: hashLine, block: []commentPair{{`"""`, `"""`}, {"'''", "'''"}}},
+	{name: "Ruby", extensions: []string{".rb", ".rake"}, filenames: []string{"Gemfile", "Rakefile"}, interpreters: []string{"ruby"}, line: hashLine, block: []commentPair{{"=begin", "=end"}}},
+	{name: "Perl", extensions: []string{".pl", ".pm"}, interpreters: []string{"perl"}, line: hashLine, block: []commentPair{{"=pod", "=cut"}}},
+	{name: "PHP", extensions: []string{".php"}, interpreters: []string{"php"}, line: []string{"//", "#"}, block: cStyleBlock},
+	{name: "Lua", extensions: []string{".lua"}, interpreters: []string{"lua", "luajit"}, line: []string{"--"}, block: []commentPair{{"--[[", "]]"}}},
+	{name: "Shell", extensions: []string{".sh", ".bash", ".zsh"}, interpreters: []string{"sh", "bash", "zsh", "dash", "ksh"}, line: hashLine},
+	{name: "PowerShell", extensions: []string{".ps1", ".psm1"}, interpreters: []string{"pwsh"}, line: hashLine, block: []commentPair{{"<#", "#>"}}},
+	{name: "R", extensions: []string{".r"}, interpreters: []string{"Rscript"}, line: hashLine},
+	{name: "Elixir", extensions: []string{".ex", ".exs"}, interpreters: []string{"elixir"}, line: hashLine},
+	{name: "Haskell", extensions: []string{".hs"}, interpreters: []string{"runhaskell"}, line: []string{"--"}, block: []commentPair{{"{-", "-}"}}},
+	{name: "Dockerfile", extensions: []string{".dockerfile"}, filenames: []string{"Dockerfile", "Containerfile"}, line: hashLine},
+	{name: "Makefile", extensions: []string{".mk"}, filenames: []string{"Makefile", "makefile", "GNUmakefile"}, line: hashLine},
+}
+
+var (
+	languagesByExtension   = make(map[string]*languageDef)
+	languagesByFilename    = make(map[string]*languageDef)
+	languagesByInterpreter = make(map[string]*languageDef)
+)
+
+func init() {
+	for i := range languageDefs {
+		def := &languageDefs[i]
+		for _, ext := range def.extensions {
+			languagesByExtension[ext] = def
+		}
+		for _, name := range def.filenames {
+			languagesByFilename[name] = def
+		}
+		for _, interpreter := range def.interpreters {
+			languagesByInterpreter[interpreter] = def
+		}
+	}
+}
+
+// languageForPath detects a language from the file name or extension
+func languageForPath(path string) *languageDef {
+	base := filepath.Base(path)
+	if def, ok := languagesByFilename[base]; ok {
+		return def
+	}
+	if strings.HasPrefix(base, "Dockerfile.") {
+		return languagesByFilename["Dockerfile"]
+	}
+	return languagesByExtension[strings.ToLower(filepath.Ext(base))]
+}
+
+// languageForShebang detects a language from a "#!" first line, handling
+// both direct interpreters and "/usr/bin/env [-S] name" with version
+// suffixes such as python3.12
+func languageForShebang(line string) *languageDef {
+	line, ok := strings.CutPrefix(strings.TrimSpace(line), "#!")
+	if !ok {
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") && !strings.Contains(field, "=") {
+				interpreter = filepath.Base(field)
+				break
+			}
+		}
+	}
+
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+	return languagesByInterpreter[interpreter]
+}
@@ -0,0 +1,384 @@
+package codestats
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// licenseFiles are the file names checked for a licence text
+var licenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "License", "LICENCE", "LICENCE.md", "COPYING", "COPYING.md"}
+
+// licenseMarkers identify common licence texts. Order matters: the LGPL and
+// AGPL texts mention the GPL, and several texts quote others.
+var licenseMarkers = []struct {
+	license string
+	markers []string
+}{
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE"}},
+	{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE\n                       Version 3"}},
+	{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "GNU LIBRARY GENERAL PUBLIC LICENSE"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE\n                       Version 3"}},
+	{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE"}},
+	{"MPL-2.0", []string{"Mozilla Public License Version 2.0", "Mozilla Public License, version 2.0"}},
+	{"EPL-2.0", []string{"Eclipse Public License - v 2.0"}},
+	{"Apache-2.0", []string{"Apache License", "www.apache.org/licenses/LICENSE-2.0"}},
+	{"Unlicense", []string{"This is free and unencumbered software released into the public domain"}},
+	{"ISC", []string{"Permission to use, copy, modify, and/or distribute this software for any"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"BSD-3-Clause", []string{"Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+}
+
+// detectLicense identifies a licence from its text, returning "" when it is
+// not recognised
+func detectLicense(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, candidate := range licenseMarkers {
+		for _, marker := range candidate.markers {
+			if strings.Contains(text, marker) {
+				return candidate.license
+			}
+		}
+	}
+	return ""
+}
+
+// detectLicenseInDir reads the first licence file found in dir
+func detectLicenseInDir(dir string) string {
+	for _, name := range licenseFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return detectLicense(string(data))
+		}
+	}
+	return ""
+}
+
+// copyleftLicenses are the SPDX identifier prefixes treated as copyleft,
+// including weak copyleft licences such as the LGPL and MPL
+var copyleftLicenses = []string{"GPL", "AGPL", "LGPL", "MPL", "EPL", "EUPL", "CDDL", "OSL", "CC-BY-SA", "GNU"}
+
+var (
+	licenseOr  = regexp.MustCompile(`(?i)\s+OR\s+|/`)
+	licenseAnd = regexp.MustCompile(`(?i)\s+AND\s+`)
+)
+
+// isCopyleft reports whether a licence expression obliges the project to
+// share its changes. An expression with a permissive alternative ("MIT OR
+// GPL-3.0") is not copyleft; one combining licences with AND is if any of
+// them is.
+func isCopyleft(license string) bool {
+	expr := strings.NewReplacer("(", " ", ")", " ").Replace(strings.TrimSpace(license))
+	if expr == "" {
+		return false
+	}
+
+	// npm and Python metadata also use "/" for alternatives
+	for _, alternative := range licenseOr.Split(expr, -1) {
+		copyleft := false
+		for _, id := range licenseAnd.Split(alternative, -1) {
+			if licenseIsCopyleft(id) {
+				copyleft = true
+				break
+			}
+		}
+		if !copyleft {
+			return false
+		}
+	}
+	return true
+}
+
+func licenseIsCopyleft(id string) bool {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	for _, prefix := range copyleftLicenses {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// localMetadata finds licence and version information for dependencies in
+// local package caches and install directories, without network access
+type localMetadata struct {
+	goModCache string
+	cargoHome  string
+}
+
+func newLocalMetadata() *localMetadata {
+	home, _ := os.UserHomeDir()
+
+	goModCache := os.Getenv("GOMODCACHE")
+	if goModCache == "" {
+		gopath := os.Getenv("GOPATH")
+		if gopath == "" {
+			gopath = filepath.Join(home, "go")
+		}
+		goModCache = filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+	}
+
+	cargoHome := os.Getenv("CARGO_HOME")
+	if cargoHome == "" {
+		cargoHome = filepath.Join(home, ".cargo")
+	}
+
+	return &localMetadata{goModCache: goModCache, cargoHome: cargoHome}
+}
+
+// lookup returns the licence of a dependency and the versions of it that
+// are available locally. dir is the directory of the manifest that
+// declared it.
+func (m *localMetadata) lookup(dep manifestDependency, dir string) (license string, versions []string) {
+	switch dep.ecosystem {
+	case EcosystemGo:
+		return m.lookupGo(dep)
+	case EcosystemNPM:
+		return lookupNPM(dep, dir)
+	case EcosystemCargo:
+		return m.lookupCargo(dep)
+	case EcosystemPyPI:
+		return lookupPython(dep, dir)
+	}
+	return "", nil
+}
+
+// lookupGo reads the module cache: the extracted module for its licence and
+// the download cache's version list for newer versions
+func (m *localMetadata) lookupGo(dep manifestDependency) (string, []string) {
+	escaped := escapeModulePath(dep.name)
+	license := detectLicenseInDir(filepath.Join(m.goModCache, escaped+"@"+dep.version))
+
+	var versions []string
+	f, err := os.Open(filepath.Join(m.goModCache, "cache", "download", escaped, "@v", "list"))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if v := strings.TrimSpace(scanner.Text()); v != "" {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return license, versions
+}
+
+// escapeModulePath applies the module cache's case encoding, where an upper
+// case letter is written as "!" followed by its lower case form
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return filepath.FromSlash(b.String())
+}
+
+// lookupNPM reads the installed package.json under node_modules
+func lookupNPM(dep manifestDependency, dir string) (string, []string) {
+	var pkg struct {
+		Version string `json:"version"`
+		License any    `json:"license"`
+	}
+	pkgDir := filepath.Join(dir, "node_modules", filepath.FromSlash(dep.name))
+	if err := readJSONFile(filepath.Join(pkgDir, "package.json"), &pkg); err != nil {
+		return "", nil
+	}
+
+	license := ""
+	switch v := pkg.License.(type) {
+	case string:
+		license = v
+	case map[string]any:
+		license, _ = v["type"].(string)
+	}
+	if license == "" {
+		license = detectLicenseInDir(pkgDir)
+	}
+
+	var versions []string
+	if pkg.Version != "" {
+		versions = append(versions, pkg.Version)
+	}
+	return license, versions
+}
+
+// lookupCargo reads the crates extracted in the cargo registry, where each
+// downloaded version has its own name-version directory
+func (m *localMetadata) lookupCargo(dep manifestDependency) (string, []string) {
+	registries, _ := filepath.Glob(filepath.Join(m.cargoHome, "registry", "src", "*"))
+
+	license := ""
+	var versions []string
+	for _, registry := range registries {
+		matches, _ := filepath.Glob(filepath.Join(registry, dep.name+"-*"))
+		for _, match := range matches {
+			version := strings.TrimPrefix(filepath.Base(match), dep.name+"-")
+			if version == "" || version[0] < '0' || version[0] > '9' {
+				continue // a different crate sharing the prefix
+			}
+			versions = append(versions, version)
+
+			if license == "" && version == dep.version {
+				var manifest struct {
+					Package struct {
+						License string `toml:"license"`
+					} `toml:"package"`
+				}
+				if err := readTOMLFile(filepath.Join(match, "Cargo.toml"), &manifest); err == nil {
+					license = manifest.Package.License
+				}
+				if license == "" {
+					license = detectLicenseInDir(match)
+				}
+			}
+		}
+	}
+	return license, versions
+}
+
+// pythonEnvDirs are the virtualenv directories looked for next to a
+// requirements file
+var pythonEnvDirs = []string{".venv", "venv", "env"}
+
+// lookupPython reads the dist-info METADATA of packages installed in a
+// virtualenv next to the requirements file
+func lookupPython(dep manifestDependency, dir string) (string, []string) {
+	for _, env := range pythonEnvDirs {
+		infos, _ := filepath.Glob(filepath.Join(dir, env, "lib", "python*", "site-packages", "*.dist-info"))
+		for _, info := range infos {
+			name, version, ok := strings.Cut(strings.TrimSuffix(filepath.Base(info), ".dist-info"), "-")
+			if !ok || normalizePythonName(name) != dep.name {
+				continue
+			}
+			return pythonLicense(filepath.Join(info, "METADATA")), []string{version}
+		}
+	}
+	return "", nil
+}
+
+// pythonLicense reads the licence from package metadata, preferring the
+// SPDX License-Expression field, then License, then trove classifiers
+func pythonLicense(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var expression, license, classifier string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break // the headers end at the first blank line
+		}
+		switch {
+		case strings.HasPrefix(line, "License-Expression:"):
+			expression = strings.TrimSpace(strings.TrimPrefix(line, "License-Expression:"))
+		case strings.HasPrefix(line, "License:"):
+			license = strings.TrimSpace(strings.TrimPrefix(line, "License:"))
+		case strings.HasPrefix(line, "Classifier: License ::") && classifier == "":
+			parts := strings.Split(line, "::")
+			classifier = strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+
+	switch {
+	case expression != "":
+		return expression
+	case license != "" && len(license) < 64 && license != "UNKNOWN":
+		return license // some packages paste the whole licence text here
+	default:
+		return classifier
+	}
+}
+
+// newestVersion returns the highest stable version in versions, falling
+// back to the highest pre-release when there is no stable one
+func newestVersion(versions []string) string {
+	newest, newestPre := "", ""
+	for _, v := range versions {
+		if strings.Contains(v, "-") {
+			if newestPre == "" || compareVersions(v, newestPre) > 0 {
+				newestPre = v
+			}
+		} else if newest == "" || compareVersions(v, newest) > 0 {
+			newest = v
+		}
+	}
+	if newest == "" {
+		return newestPre
+	}
+	return newest
+}
+
+// isExactVersion reports whether version is a concrete version rather than
+// a range such as ^1.2.0 or >=2
+func isExactVersion(version string) bool {
+	version = strings.TrimPrefix(version, "v")
+	return version != "" && version[0] >= '0' && version[0] <= '9' &&
+		!strings.ContainsAny(version, " <>=^~*|,xX")
+}
+
+// compareVersions orders dotted versions with an optional "v" prefix,
+// treating a pre-release as older than its release and ignoring build
+// metadata. Non-numeric parts compare as strings.
+func compareVersions(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+
+	aCore, aPre, aHasPre := strings.Cut(a, "-")
+	bCore, bPre, bHasPre := strings.Cut(b, "-")
+
+	if c := compareDotted(aCore, bCore); c != 0 {
+		return c
+	}
+	switch {
+	case aHasPre && !bHasPre:
+		return -1
+	case !aHasPre && bHasPre:
+		return 1
+	}
+	return compareDotted(aPre, bPre)
+}
+
+func compareDotted(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var x, y string
+		if i < len(aParts) {
+			x = aParts[i]
+		}
+		if i < len(bParts) {
+			y = bParts[i]
+		}
+
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package codestats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCopyleft(t *testing.T) {
+	tests := []struct {
+		license string
+		want    bool
+	}{
+		{"", false},
+		{"MIT", false},
+		{"Apache-2.0", false},
+		{"BSD-3-Clause", false},
+		{"GPL-3.0", true},
+		{"GPL-2.0-or-later", true},
+		{"AGPL-3.0-only", true},
+		{"LGPL-2.1", true},
+		{"MPL-2.0", true},
+		{"gpl-3.0", true},
+		{"CC-BY-SA-4.0", true},
+		{"CC-BY-4.0", false},
+		{"GNU General Public License v3 (GPLv3)", true},
+		{"MIT OR GPL-3.0", false},
+		{"GPL-2.0 OR LGPL-2.1", true},
+		{"(MIT OR Apache-2.0)", false},
+		{"MIT AND GPL-3.0", true},
+		{"MIT AND Apache-2.0", false},
+		{"(MIT AND GPL-2.0) OR Apache-2.0", false},
+		{"(MIT AND GPL-2.0) OR LGPL-3.0", true},
+		{"MIT/GPL-2.0", false},
+		{"GPL-2.0/LGPL-2.1", true},
+		{"Unlicense or MPL-2.0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.license, func(t *testing.T) {
+			assert.Equal(t, tt.want, isCopyleft(tt.license))
+		})
+	}
+}
+
+func TestDetectLicense(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"unknown", "All rights reserved.", ""},
+		{"mit", "MIT License\n\nPermission is hereby granted, free of charge, to any person", "MIT"},
+		{"isc", "Permission to use, copy, modify, and/or distribute this software for any\npurpose", "ISC"},
+		{"apache", "                                 Apache License\n                           Version 2.0, January 2004", "Apache-2.0"},
+		{"bsd 3 clause", "Redistribution and use in source and binary forms, with or without\n3. Neither the name of the copyright holder", "BSD-3-Clause"},
+		{"bsd 2 clause", "Redistribution and use in source and binary forms, with or without", "BSD-2-Clause"},
+		{"gpl 3", "                    GNU GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007", "GPL-3.0"},
+		{"gpl 2", "                    GNU GENERAL PUBLIC LICENSE\n                       Version 2, June 1991", "GPL-2.0"},
+		{"gpl 3 with windows line endings", "                    GNU GENERAL PUBLIC LICENSE\r\n                       Version 3, 29 June 2007", "GPL-3.0"},
+		{"lgpl 3 mentions the gpl", "                   GNU LESSER GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007\n\nversion 3 of the GNU General Public License", "LGPL-3.0"},
+		{"lgpl 2.1", "                  GNU LESSER GENERAL PUBLIC LICENSE\n                       Version 2.1, February 1999", "LGPL-2.1"},
+		{"agpl mentions the gpl", "                    GNU AFFERO GENERAL PUBLIC LICENSE\n                       Version 3, 19 November 2007\n\nGNU GENERAL PUBLIC LICENSE", "AGPL-3.0"},
+		{"mpl", "Mozilla Public License Version 2.0\n==================================", "MPL-2.0"},
+		{"unlicense", "This is free and unencumbered software released into the public domain.", "Unlicense"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectLicense(tt.text))
+		})
+	}
+}
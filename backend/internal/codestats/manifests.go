@@ -0,0 +1,347 @@
+package codestats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Dependency ecosystems
+const (
+	EcosystemGo    = "go"
+	EcosystemNPM   = "npm"
+	EcosystemCargo = "cargo"
+	EcosystemPyPI  = "pypi"
+)
+
+// manifestDependency is a dependency read from a manifest or lock file.
+// license is only set when the lock file itself declares one.
+type manifestDependency struct {
+	ecosystem string
+	name      string
+	version   string
+	direct    bool
+	dev       bool
+	license   string
+}
+
+// parseManifest reads the dependencies declared by a manifest file and, when
+// present, its lock file
+func parseManifest(path string) ([]manifestDependency, error) {
+	switch name := filepath.Base(path); {
+	case name == "go.mod":
+		return parseGoMod(path)
+	case name == "package.json":
+		return parsePackageJSON(path)
+	case name == "Cargo.toml":
+		return parseCargoToml(path)
+	case isManifestName(name):
+		return parseRequirements(path)
+	}
+	return nil, fmt.Errorf("unsupported manifest: %s", path)
+}
+
+// parseGoMod reads the require directives of a go.mod. Requirements marked
+// "// indirect" are transitive.
+func parseGoMod(path string) ([]manifestDependency, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var deps []manifestDependency
+	inRequire := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		var spec string
+		switch {
+		case inRequire && line == ")":
+			inRequire = false
+			continue
+		case inRequire:
+			spec = line
+		case line == "require (":
+			inRequire = true
+			continue
+		case strings.HasPrefix(line, "require "):
+			spec = strings.TrimPrefix(line, "require ")
+		default:
+			continue
+		}
+
+		spec, comment, _ := strings.Cut(spec, "//")
+		fields := strings.Fields(spec)
+		if len(fields) != 2 {
+			continue
+		}
+		deps = append(deps, manifestDependency{
+			ecosystem: EcosystemGo,
+			name:      strings.Trim(fields[0], `"`),
+			version:   fields[1],
+			direct:    strings.TrimSpace(comment) != "indirect",
+		})
+	}
+	return deps, scanner.Err()
+}
+
+type packageJSON struct {
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// packageLock is the lockfileVersion 2 and 3 format; version 1 lock files
+// are ignored and only the declared dependencies are reported
+type packageLock struct {
+	Packages map[string]struct {
+		Version string          `json:"version"`
+		License json.RawMessage `json:"license"`
+		Dev     bool            `json:"dev"`
+		Link    bool            `json:"link"`
+	} `json:"packages"`
+}
+
+// parsePackageJSON reads package.json and, if there is one, the
+// package-lock.json next to it for resolved versions and the transitive tree
+func parsePackageJSON(path string) ([]manifestDependency, error) {
+	var pkg packageJSON
+	if err := readJSONFile(path, &pkg); err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]bool) // name -> dev
+	for name := range pkg.Dependencies {
+		declared[name] = false
+	}
+	for name := range pkg.OptionalDependencies {
+		declared[name] = false
+	}
+	for name := range pkg.DevDependencies {
+		if _, ok := declared[name]; !ok {
+			declared[name] = true
+		}
+	}
+
+	var lock packageLock
+	lockPath := filepath.Join(filepath.Dir(path), "package-lock.json")
+	if err := readJSONFile(lockPath, &lock); err != nil || len(lock.Packages) == 0 {
+		deps := make([]manifestDependency, 0, len(declared))
+		for name, dev := range declared {
+			version := pkg.Dependencies[name]
+			if dev {
+				version = pkg.DevDependencies[name]
+			} else if version == "" {
+				version = pkg.OptionalDependencies[name]
+			}
+			deps = append(deps, manifestDependency{
+				ecosystem: EcosystemNPM,
+				name:      name,
+				version:   version,
+				direct:    true,
+				dev:       dev,
+			})
+		}
+		return deps, nil
+	}
+
+	deps := make([]manifestDependency, 0, len(lock.Packages))
+	for key, entry := range lock.Packages {
+		idx := strings.LastIndex(key, "node_modules/")
+		if idx < 0 || entry.Link {
+			continue // the root package or a workspace member
+		}
+		name := key[idx+len("node_modules/"):]
+		_, isDeclared := declared[name]
+		deps = append(deps, manifestDependency{
+			ecosystem: EcosystemNPM,
+			name:      name,
+			version:   entry.Version,
+			direct:    isDeclared && idx == 0,
+			dev:       entry.Dev,
+			license:   npmLicense(entry.License),
+		})
+	}
+	return deps, nil
+}
+
+// npmLicense reads a license field, which is usually an SPDX string but is
+// an object in some older packages
+func npmLicense(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var license string
+	if err := json.Unmarshal(raw, &license); err == nil {
+		return license
+	}
+	var legacy struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(raw, &legacy); err == nil {
+		return legacy.Type
+	}
+	return ""
+}
+
+type cargoManifest struct {
+	Dependencies      map[string]any `toml:"dependencies"`
+	DevDependencies   map[string]any `toml:"dev-dependencies"`
+	BuildDependencies map[string]any `toml:"build-dependencies"`
+	Workspace         struct {
+		Dependencies map[string]any `toml:"dependencies"`
+	} `toml:"workspace"`
+}
+
+type cargoLock struct {
+	Package []struct {
+		Name    string `toml:"name"`
+		Version string `toml:"version"`
+		Source  string `toml:"source"`
+	} `toml:"package"`
+}
+
+// parseCargoToml reads the dependency tables of Cargo.toml and, if there is
+// one, the Cargo.lock next to it for resolved versions of every crate
+func parseCargoToml(path string) ([]manifestDependency, error) {
+	var manifest cargoManifest
+	if err := readTOMLFile(path, &manifest); err != nil {
+		return nil, err
+	}
+
+	type declaredCrate struct {
+		version string
+		dev     bool
+	}
+	declared := make(map[string]declaredCrate)
+	addTable := func(table map[string]any, dev bool) {
+		for name, spec := range table {
+			version := ""
+			switch v := spec.(type) {
+			case string:
+				version = v
+			case map[string]any:
+				if pkg, ok := v["package"].(string); ok {
+					name = pkg // renamed dependency
+				}
+				version, _ = v["version"].(string)
+			}
+			if existing, ok := declared[name]; ok && !existing.dev {
+				continue
+			}
+			declared[name] = declaredCrate{version: version, dev: dev}
+		}
+	}
+	addTable(manifest.Dependencies, false)
+	addTable(manifest.BuildDependencies, false)
+	addTable(manifest.Workspace.Dependencies, false)
+	addTable(manifest.DevDependencies, true)
+
+	var lock cargoLock
+	lockPath := filepath.Join(filepath.Dir(path), "Cargo.lock")
+	if err := readTOMLFile(lockPath, &lock); err != nil || len(lock.Package) == 0 {
+		deps := make([]manifestDependency, 0, len(declared))
+		for name, crate := range declared {
+			deps = append(deps, manifestDependency{
+				ecosystem: EcosystemCargo,
+				name:      name,
+				version:   crate.version,
+				direct:    true,
+				dev:       crate.dev,
+			})
+		}
+		return deps, nil
+	}
+
+	deps := make([]manifestDependency, 0, len(lock.Package))
+	for _, pkg := range lock.Package {
+		if pkg.Source == "" {
+			continue // a crate of the workspace itself
+		}
+		crate, isDeclared := declared[pkg.Name]
+		deps = append(deps, manifestDependency{
+			ecosystem: EcosystemCargo,
+			name:      pkg.Name,
+			version:   pkg.Version,
+			direct:    isDeclared,
+			dev:       isDeclared && crate.dev,
+		})
+	}
+	return deps, nil
+}
+
+// parseRequirements reads a pip requirements file. Pinned requirements
+// (name==version) record the version; other specifiers are kept as written.
+// Files with "dev" or "test" in their name hold development dependencies.
+func parseRequirements(path string) ([]manifestDependency, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	base := strings.ToLower(filepath.Base(path))
+	dev := strings.Contains(base, "dev") || strings.Contains(base, "test")
+
+	var deps []manifestDependency
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line, _, _ = strings.Cut(line, ";") // environment markers
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") || strings.Contains(line, "://") {
+			continue // options, includes and direct URLs
+		}
+
+		end := strings.IndexAny(line, "=<>!~[ @")
+		name, spec := line, ""
+		if end >= 0 {
+			name, spec = line[:end], strings.TrimSpace(line[end:])
+		}
+		if _, extras, ok := strings.Cut(spec, "]"); ok && strings.HasPrefix(spec, "[") {
+			spec = strings.TrimSpace(extras)
+		}
+		if pinned, ok := strings.CutPrefix(spec, "=="); ok {
+			spec = strings.TrimSpace(pinned)
+		}
+
+		deps = append(deps, manifestDependency{
+			ecosystem: EcosystemPyPI,
+			name:      normalizePythonName(name),
+			version:   spec,
+			direct:    true,
+			dev:       dev,
+		})
+	}
+	return deps, scanner.Err()
+}
+
+// normalizePythonName applies PEP 503 normalisation so "Foo_Bar" and
+// "foo-bar" are the same package
+func normalizePythonName(name string) string {
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "-", ".", "-").Replace(name)
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func readTOMLFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return toml.Unmarshal(data, v)
+}
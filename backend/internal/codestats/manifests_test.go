@@ -0,0 +1,189 @@
+package codestats
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseTestManifest(t *testing.T, dir, name string) []manifestDependency {
+	t.Helper()
+
+	deps, err := parseManifest(filepath.Join(dir, name))
+	require.NoError(t, err)
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].name != deps[j].name {
+			return deps[i].name < deps[j].name
+		}
+		return deps[i].version < deps[j].version
+	})
+	return deps
+}
+
+func TestParseGoMod(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "go.mod", `module example.com/app
+
+go 1.22
+
+require github.com/single/line v1.0.0
+
+require (
+	github.com/gin-gonic/gin v1.9.1
+	"github.com/quoted/mod" v0.2.0
+	golang.org/x/text v0.14.0 // indirect
+	// a comment
+)
+
+replace github.com/single/line => ../line
+`)
+
+	assert.Equal(t, []manifestDependency{
+		{ecosystem: EcosystemGo, name: "github.com/gin-gonic/gin", version: "v1.9.1", direct: true},
+		{ecosystem: EcosystemGo, name: "github.com/quoted/mod", version: "v0.2.0", direct: true},
+		{ecosystem: EcosystemGo, name: "github.com/single/line", version: "v1.0.0", direct: true},
+		{ecosystem: EcosystemGo, name: "golang.org/x/text", version: "v0.14.0", direct: false},
+	}, parseTestManifest(t, dir, "go.mod"))
+}
+
+func TestParsePackageJSON(t *testing.T) {
+	packageJSON := `{
+		"dependencies": {"react": "^18.2.0"},
+		"optionalDependencies": {"fsevents": "^2.3.0"},
+		"devDependencies": {"typescript": "^5.0.0", "react": "^18.2.0"}
+	}`
+
+	t.Run("without lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "package.json", packageJSON)
+
+		assert.Equal(t, []manifestDependency{
+			{ecosystem: EcosystemNPM, name: "fsevents", version: "^2.3.0", direct: true},
+			{ecosystem: EcosystemNPM, name: "react", version: "^18.2.0", direct: true},
+			{ecosystem: EcosystemNPM, name: "typescript", version: "^5.0.0", direct: true, dev: true},
+		}, parseTestManifest(t, dir, "package.json"))
+	})
+
+	t.Run("with lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "package.json", packageJSON)
+		writeFile(t, dir, "package-lock.json", `{
+			"lockfileVersion": 3,
+			"packages": {
+				"": {"name": "app"},
+				"node_modules/react": {"version": "18.2.0", "license": "MIT"},
+				"node_modules/loose-envify": {"version": "1.4.0", "license": {"type": "MIT"}},
+				"node_modules/typescript": {"version": "5.3.3", "license": "Apache-2.0", "dev": true},
+				"node_modules/typescript/node_modules/react": {"version": "17.0.2", "license": "MIT", "dev": true},
+				"node_modules/workspace-pkg": {"link": true},
+				"packages/lib": {"version": "1.0.0"}
+			}
+		}`)
+
+		// A nested copy of a direct dependency is transitive
+		assert.Equal(t, []manifestDependency{
+			{ecosystem: EcosystemNPM, name: "loose-envify", version: "1.4.0", license: "MIT"},
+			{ecosystem: EcosystemNPM, name: "react", version: "17.0.2", dev: true, license: "MIT"},
+			{ecosystem: EcosystemNPM, name: "react", version: "18.2.0", direct: true, license: "MIT"},
+			{ecosystem: EcosystemNPM, name: "typescript", version: "5.3.3", direct: true, dev: true, license: "Apache-2.0"},
+		}, parseTestManifest(t, dir, "package.json"))
+	})
+}
+
+func TestParseCargoToml(t *testing.T) {
+	cargoToml := `[package]
+name = "app"
+
+[dependencies]
+serde = "1.0"
+tokio = { version = "1.35", features = ["full"] }
+json = { package = "serde_json", version = "1.0" }
+
+[dev-dependencies]
+proptest = "1.4"
+serde = "1.0"
+
+[build-dependencies]
+cc = "1.0"
+`
+
+	t.Run("without lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "Cargo.toml", cargoToml)
+
+		assert.Equal(t, []manifestDependency{
+			{ecosystem: EcosystemCargo, name: "cc", version: "1.0", direct: true},
+			{ecosystem: EcosystemCargo, name: "proptest", version: "1.4", direct: true, dev: true},
+			{ecosystem: EcosystemCargo, name: "serde", version: "1.0", direct: true},
+			{ecosystem: EcosystemCargo, name: "serde_json", version: "1.0", direct: true},
+			{ecosystem: EcosystemCargo, name: "tokio", version: "1.35", direct: true},
+		}, parseTestManifest(t, dir, "Cargo.toml"))
+	})
+
+	t.Run("with lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, dir, "Cargo.toml", cargoToml)
+		writeFile(t, dir, "Cargo.lock", `version = 3
+
+[[package]]
+name = "app"
+version = "0.1.0"
+
+[[package]]
+name = "proptest"
+version = "1.4.0"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+
+[[package]]
+name = "serde"
+version = "1.0.195"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+
+[[package]]
+name = "serde_derive"
+version = "1.0.195"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+`)
+
+		assert.Equal(t, []manifestDependency{
+			{ecosystem: EcosystemCargo, name: "proptest", version: "1.4.0", direct: true, dev: true},
+			{ecosystem: EcosystemCargo, name: "serde", version: "1.0.195", direct: true},
+			{ecosystem: EcosystemCargo, name: "serde_derive", version: "1.0.195"},
+		}, parseTestManifest(t, dir, "Cargo.toml"))
+	})
+}
+
+func TestParseRequirements(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "requirements.txt", `# production
+Django==4.2.7
+requests>=2.31  # http
+Flask_Login[extras]==0.6.3
+zope.interface
+pywin32==306 ; sys_platform == "win32"
+-r base.txt
+--index-url https://example.com/simple
+git+https://github.com/org/repo.git#egg=repo
+`)
+	writeFile(t, dir, "requirements-dev.txt", "pytest==7.4.3\n")
+
+	assert.Equal(t, []manifestDependency{
+		{ecosystem: EcosystemPyPI, name: "django", version: "4.2.7", direct: true},
+		{ecosystem: EcosystemPyPI, name: "flask-login", version: "0.6.3", direct: true},
+		{ecosystem: EcosystemPyPI, name: "pywin32", version: "306", direct: true},
+		{ecosystem: EcosystemPyPI, name: "requests", version: ">=2.31", direct: true},
+		{ecosystem: EcosystemPyPI, name: "zope-interface", version: "", direct: true},
+	}, parseTestManifest(t, dir, "requirements.txt"))
+
+	assert.Equal(t, []manifestDependency{
+		{ecosystem: EcosystemPyPI, name: "pytest", version: "7.4.3", direct: true, dev: true},
+	}, parseTestManifest(t, dir, "requirements-dev.txt"))
+}
+
+func TestParseManifestUnsupported(t *testing.T) {
+	_, err := parseManifest(filepath.Join(t.TempDir(), "pom.xml"))
+	assert.Error(t, err)
+}
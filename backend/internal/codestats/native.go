@@ -0,0 +1,298 @@
+package codestats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxCountFileSize skips files too large to be hand-written source,
+	// such as bundles and data dumps
+	maxCountFileSize = 8 << 20
+	// binarySniffLen is how much of a file is checked for NUL bytes
+	binarySniffLen = 8000
+)
+
+// NativeCounter is a built-in line counter used when tokei is unavailable.
+// Comment detection does not parse string literals, so comment markers
+// inside strings can be misread; totals are otherwise close to tokei's.
+type NativeCounter struct {
+	workers int
+}
+
+// NewNativeCounter creates a counter that reads files with at most workers
+// goroutines, defaulting to the number of CPUs
+func NewNativeCounter(workers int) *NativeCounter {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &NativeCounter{workers: workers}
+}
+
+func (n *NativeCounter) Name() string { return "native" }
+
+// fileCount is the result of counting one file
+type fileCount struct {
+	language string
+	code     int64
+	comments int64
+	blanks   int64
+}
+
+// Count walks root, skipping paths matched by .gitignore files or excludes,
+// and counts every file in a recognised language
+func (n *NativeCounter) Count(ctx context.Context, root string, excludes []string) (*CodeStats, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access project path: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("project path is not a directory: %s", root)
+	}
+
+	excluded := &ignoreMatcher{}
+	excluded.add("", excludes)
+
+	paths := make(chan string, n.workers*4)
+	results := make(chan fileCount, n.workers*4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if count, ok := countFile(path); ok {
+					results <- count
+				}
+			}
+		}()
+	}
+
+	var walkErr error
+	go func() {
+		gitignore := &ignoreMatcher{}
+		gitignore.addFile(root, "")
+		walkErr = walkSource(ctx, root, "", gitignore, excluded, paths)
+		close(paths)
+		wg.Wait()
+		close(results)
+	}()
+
+	languages := make(map[string]*Language)
+	for count := range results {
+		lang, ok := languages[count.language]
+		if !ok {
+			lang = &Language{Name: count.language}
+			languages[count.language] = lang
+		}
+		lang.Files++
+		lang.Code += count.code
+		lang.Comments += count.comments
+		lang.Blanks += count.blanks
+	}
+
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	stats := &CodeStats{Languages: []Language{}}
+	for _, lang := range languages {
+		lang.Lines = lang.Code + lang.Comments + lang.Blanks
+		stats.Languages = append(stats.Languages, *lang)
+		stats.TotalFiles += lang.Files
+		stats.TotalLines += lang.Lines
+		stats.TotalCode += lang.Code
+		stats.TotalComment += lang.Comments
+		stats.TotalBlanks += lang.Blanks
+	}
+	sort.Slice(stats.Languages, func(i, j int) bool {
+		return stats.Languages[i].Name < stats.Languages[j].Name
+	})
+
+	return stats, nil
+}
+
+// walkSource sends every file under dir that is not ignored. Nested
+// .gitignore files only apply to their own subtree. Symlinks are not
+// followed, matching tokei.
+func walkSource(ctx context.Context, dir, rel string, gitignore, excluded *ignoreMatcher, paths chan<- string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if rel == "" {
+			return fmt.Errorf("failed to read project path: %w", err)
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := entry.Name()
+		if entry.Type()&os.ModeSymlink != 0 || (entry.IsDir() && name == ".git") {
+			continue
+		}
+
+		childRel := name
+		if rel != "" {
+			childRel = rel + "/" + name
+		}
+		isDir := entry.IsDir()
+		if excluded.ignored(childRel, isDir) || gitignore.ignored(childRel, isDir) {
+			continue
+		}
+
+		childPath := filepath.Join(dir, name)
+		if isDir {
+			childIgnore := gitignore
+			if _, err := os.Stat(filepath.Join(childPath, ".gitignore")); err == nil {
+				childIgnore = gitignore.clone()
+				childIgnore.addFile(childPath, childRel)
+			}
+			if err := walkSource(ctx, childPath, childRel, childIgnore, excluded, paths); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		select {
+		case paths <- childPath:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// countFile reads a source file and counts its lines. Binary, oversized and
+// unrecognised files are skipped.
+func countFile(path string) (fileCount, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileCount{}, false
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxCountFileSize+1))
+	if err != nil || len(content) > maxCountFileSize {
+		return fileCount{}, false
+	}
+	if bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+		return fileCount{}, false
+	}
+
+	def := languageForPath(path)
+	if def == nil && bytes.HasPrefix(content, []byte("#!")) {
+		firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+		def = languageForShebang(string(firstLine))
+	}
+	if def == nil {
+		return fileCount{}, false
+	}
+
+	count := countLines(def, string(content))
+	count.language = def.name
+	return count, true
+}
+
+// countLines classifies each line as code, comment or blank. A line with
+// any code outside comments counts as code; blank lines inside block
+// comments count as blank, as in tokei.
+func countLines(def *languageDef, content string) fileCount {
+	var count fileCount
+	if content == "" {
+		return count
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var blockEnd string
+	for _, line := range lines {
+		rest := strings.TrimSpace(line)
+		if rest == "" {
+			count.blanks++
+			continue
+		}
+
+		hasCode, hasComment := false, false
+		for rest != "" {
+			if blockEnd != "" {
+				hasComment = true
+				idx := strings.Index(rest, blockEnd)
+				if idx < 0 {
+					rest = ""
+					break
+				}
+				rest = rest[idx+len(blockEnd):]
+				blockEnd = ""
+				continue
+			}
+
+			pos, token, end := nextComment(def, rest)
+			if pos < 0 {
+				if strings.TrimSpace(rest) != "" {
+					hasCode = true
+				}
+				break
+			}
+			if strings.TrimSpace(rest[:pos]) != "" {
+				hasCode = true
+			}
+			hasComment = true
+			if end == "" {
+				break // line comment runs to the end of the line
+			}
+			blockEnd = end
+			rest = rest[pos+len(token):]
+		}
+
+		switch {
+		case hasCode:
+			count.code++
+		case hasComment:
+			count.comments++
+		default:
+			count.blanks++
+		}
+	}
+
+	return count
+}
+
+// nextComment finds the earliest comment opener in s. end is empty for line
+// comments. On a tie the longer token wins, so Lua's --[[ beats --.
+func nextComment(def *languageDef, s string) (pos int, token, end string) {
+	pos = -1
+	consider := func(start, stop string) {
+		idx := strings.Index(s, start)
+		if idx < 0 {
+			return
+		}
+		if pos < 0 || idx < pos || (idx == pos && len(start) > len(token)) {
+			pos, token, end = idx, start, stop
+		}
+	}
+
+	for _, pair := range def.block {
+		consider(pair.start, pair.end)
+	}
+	for _, prefix := range def.line {
+		consider(prefix, "")
+	}
+	return pos, token, end
+}
@@ -0,0 +1,175 @@
+package codestats
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    fileCount
+	}{
+		{
+			name:    "empty file",
+			path:    "main.go",
+			content: "",
+			want:    fileCount{},
+		},
+		{
+			name:    "line comments and blanks",
+			path:    "main.go",
+			content: "package main\n\n// comment\n   \t\nfunc main() {}\n",
+			want:    fileCount{code: 2, comments: 1, blanks: 2},
+		},
+		{
+			name:    "trailing comment is code",
+			path:    "main.go",
+			content: "x := 1 // set x\ny := 2 /* set y */\n",
+			want:    fileCount{code: 2},
+		},
+		{
+			name:    "block comment spanning lines",
+			path:    "main.go",
+			content: "/*\n * Package main\n\n */\npackage main\n",
+			want:    fileCount{code: 1, comments: 3, blanks: 1},
+		},
+		{
+			name:    "code after a block comment closes",
+			path:    "main.go",
+			content: "/* start\nend */ x := 1\n",
+			want:    fileCount{code: 1, comments: 1},
+		},
+		{
+			name:    "code before a block comment opens",
+			path:    "main.go",
+			content: "x := 1 /* start\nend */\n",
+			want:    fileCount{code: 1, comments: 1},
+		},
+		{
+			name:    "several block comments on a line",
+			path:    "main.go",
+			content: "/* a */ /* b */\n/* a */ x /* b */\n",
+			want:    fileCount{code: 1, comments: 1},
+		},
+		{
+			name:    "line comment inside a block comment",
+			path:    "main.go",
+			content: "/* // not a line comment\nstill */\nx := 1\n",
+			want:    fileCount{code: 1, comments: 2},
+		},
+		{
+			name:    "lua block comment",
+			path:    "init.lua",
+			content: "--[[ header\nstill in the block\n]]\nprint(1)\n",
+			want:    fileCount{code: 1, comments: 3},
+		},
+		{
+			name:    "lua line comment does not open a block",
+			path:    "init.lua",
+			content: "-- comment\nprint(1)\n-- [[ not a block\nprint(2)\n",
+			want:    fileCount{code: 2, comments: 2},
+		},
+		{
+			name:    "lua code after a block comment",
+			path:    "init.lua",
+			content: "--[[ a\n]] print(1)\nprint(2) --[[ b ]]\n",
+			want:    fileCount{code: 2, comments: 1},
+		},
+		{
+			name:    "python docstring",
+			path:    "main.py",
+			content: "\"\"\"\nModule docs.\n\"\"\"\n# comment\nimport os\n",
+			want:    fileCount{code: 1, comments: 4},
+		},
+		{
+			name:    "language without comments",
+			path:    "README.md",
+			content: "# Title\n\n// text\n",
+			want:    fileCount{code: 2, blanks: 1},
+		},
+		{
+			name:    "windows line endings",
+			path:    "main.go",
+			content: "package main\r\n\r\n// comment\r\n",
+			want:    fileCount{code: 1, comments: 1, blanks: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			def := languageForPath(tt.path)
+			require.NotNil(t, def)
+			assert.Equal(t, tt.want, countLines(def, tt.content))
+		})
+	}
+}
+
+func TestNextComment(t *testing.T) {
+	golang := languageForPath("main.go")
+	lua := languageForPath("init.lua")
+
+	tests := []struct {
+		name      string
+		def       *languageDef
+		line      string
+		wantPos   int
+		wantToken string
+		wantEnd   string
+	}{
+		{"no comment", golang, "x := 1", -1, "", ""},
+		{"line comment", golang, "x := 1 // c", 7, "//", ""},
+		{"block comment", golang, "x /* c */", 2, "/*", "*/"},
+		{"earliest wins", golang, "/* a */ // b", 0, "/*", "*/"},
+		{"lua block over line", lua, "--[[ c", 0, "--[[", "]]"},
+		{"lua line", lua, "x = 1 -- c", 6, "--", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, token, end := nextComment(tt.def, tt.line)
+			assert.Equal(t, tt.wantPos, pos)
+			assert.Equal(t, tt.wantToken, token)
+			assert.Equal(t, tt.wantEnd, end)
+		})
+	}
+}
+
+func TestNativeCounterNestedGitignore(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, ".gitignore", "*.gen.go\n/vendor/\n")
+	writeFile(t, root, "main.go", "package main\n")
+	writeFile(t, root, "main.gen.go", "package main\n")
+	writeFile(t, root, "vendor/lib/lib.go", "package lib\n")
+	writeFile(t, root, "pkg/.gitignore", "!keep.gen.go\nscratch/\n")
+	writeFile(t, root, "pkg/keep.gen.go", "package pkg\n")
+	writeFile(t, root, "pkg/drop.gen.go", "package pkg\n")
+	writeFile(t, root, "pkg/scratch/tmp.go", "package scratch\n")
+	writeFile(t, root, "pkg/vendor/v.go", "package vendor\n")
+	// pkg/.gitignore does not apply outside pkg
+	writeFile(t, root, "cmd/keep.gen.go", "package cmd\n")
+	writeFile(t, root, "cmd/scratch/tmp.go", "package scratch\n")
+
+	stats, err := NewNativeCounter(2).Count(context.Background(), root, nil)
+	require.NoError(t, err)
+
+	// main.go, pkg/keep.gen.go, pkg/vendor/v.go and cmd/scratch/tmp.go
+	require.Len(t, stats.Languages, 1)
+	assert.Equal(t, "Go", stats.Languages[0].Name)
+	assert.EqualValues(t, 4, stats.Languages[0].Files)
+	assert.EqualValues(t, 4, stats.Languages[0].Code)
+}
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
@@ -18,6 +18,8 @@ type ProjectPath struct {
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       *time.Time     `json:"deleted_at,omitempty"`
+	// Stats is the latest code statistics snapshot, when one exists
+	Stats *StatsSummary `json:"stats,omitempty"`
 }
 
 type Filter struct {
@@ -79,4 +81,21 @@ type ListResponse struct {
 	CurrentPage int            `json:"current_page"`
 	PageSize    int            `json:"page_size"`
 	HasNext     bool           `json:"has_next"`
-}
\ No newline at end of file
+}
+
+// StatsSummary is the latest code statistics snapshot of a project, with
+// links to its snapshot history and time series
+type StatsSummary struct {
+	SnapshotID  uuid.UUID         `json:"snapshot_id"`
+	Files       int               `json:"files"`
+	Lines       int64             `json:"lines"`
+	Code        int64             `json:"code"`
+	TopLanguage string            `json:"top_language"`
+	ScannedAt   time.Time         `json:"scanned_at"`
+	Links       map[string]string `json:"links"`
+}
+
+// StatsSummaryProvider looks up the latest statistics of projects
+type StatsSummaryProvider interface {
+	ProjectStatsSummaries(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*StatsSummary, error)
+}
@@ -15,6 +15,12 @@ type CodeStatsUpdater interface {
 	UpdateStats() error
 }
 
+// ProjectChangeHandler is implemented by stats updaters that can rescan
+// just the project path that changed instead of every project
+type ProjectChangeHandler interface {
+	ProjectPathChanged(ctx context.Context, id uuid.UUID) error
+}
+
 type ProjectPathService struct {
 	repo        Repository
 	statsUpdater CodeStatsUpdater
@@ -45,13 +51,19 @@ func (s *ProjectPathService) CreateProjectPath(ctx context.Context, path *Projec
 	}
 
 	// Trigger async code stats update
-	s.triggerStatsUpdate("created project path", path.Name)
+	s.triggerStatsUpdate("created project path", path)
 	
 	return nil
 }
 
 func (s *ProjectPathService) GetProjectPath(ctx context.Context, id uuid.UUID) (*ProjectPath, error) {
-	return s.repo.Get(ctx, id)
+	path, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.attachStats(ctx, path)
+	return path, nil
 }
 
 func (s *ProjectPathService) UpdateProjectPath(ctx context.Context, path *ProjectPath) error {
@@ -77,7 +89,7 @@ func (s *ProjectPathService) UpdateProjectPath(ctx context.Context, path *Projec
 		fmt.Sprintf("%v", existing.ExcludePatterns) != fmt.Sprintf("%v", path.ExcludePatterns)
 	
 	if shouldUpdate {
-		s.triggerStatsUpdate("updated project path", path.Name)
+		s.triggerStatsUpdate("updated project path", path)
 	}
 	
 	return nil
@@ -95,7 +107,7 @@ func (s *ProjectPathService) DeleteProjectPath(ctx context.Context, id uuid.UUID
 	}
 
 	// Trigger async code stats update
-	s.triggerStatsUpdate("deleted project path", path.Name)
+	s.triggerStatsUpdate("deleted project path", path)
 	
 	return nil
 }
@@ -113,7 +125,13 @@ func (s *ProjectPathService) ListProjectPaths(ctx context.Context, filter *Filte
 		pagination.PageSize = 10
 	}
 
-	return s.repo.List(ctx, filter, pagination)
+	paths, total, err := s.repo.List(ctx, filter, pagination)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.attachStats(ctx, paths...)
+	return paths, total, nil
 }
 
 func (s *ProjectPathService) GetActiveProjectPaths(ctx context.Context) ([]*ProjectPath, error) {
@@ -140,8 +158,34 @@ func (s *ProjectPathService) validateProjectPath(path *ProjectPath) error {
 	return nil
 }
 
+// attachStats links project paths to their latest code statistics snapshot
+// when the stats updater can provide them. Lookup failures are logged only,
+// the paths themselves are still returned.
+func (s *ProjectPathService) attachStats(ctx context.Context, paths ...*ProjectPath) {
+	provider, ok := s.statsUpdater.(StatsSummaryProvider)
+	if !ok || len(paths) == 0 {
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(paths))
+	for _, path := range paths {
+		ids = append(ids, path.ID)
+	}
+
+	summaries, err := provider.ProjectStatsSummaries(ctx, ids)
+	if err != nil {
+		logger.Warn("Failed to load code stats for project paths", "error", err)
+		return
+	}
+
+	for _, path := range paths {
+		path.Stats = summaries[path.ID]
+	}
+}
+
 // triggerStatsUpdate asynchronously updates code statistics
-func (s *ProjectPathService) triggerStatsUpdate(action, pathName string) {
+func (s *ProjectPathService) triggerStatsUpdate(action string, path *ProjectPath) {
+	pathName := path.Name
 	if s.statsUpdater == nil {
 		logger.Warn("Code stats updater not configured, skipping stats update", 
 			"action", action, "path", pathName)
@@ -152,8 +196,15 @@ func (s *ProjectPathService) triggerStatsUpdate(action, pathName string) {
 	go func() {
 		logger.Info("Triggering code stats update", 
 			"action", action, "path", pathName)
-		
-		if err := s.statsUpdater.UpdateStats(); err != nil {
+
+		var err error
+		if handler, ok := s.statsUpdater.(ProjectChangeHandler); ok {
+			err = handler.ProjectPathChanged(context.Background(), path.ID)
+		} else {
+			err = s.statsUpdater.UpdateStats()
+		}
+
+		if err != nil {
 			logger.Error("Failed to update code statistics after project path change",
 				"action", action, "path", pathName, "error", err)
 		} else {
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -27,6 +29,10 @@ type Service struct {
 	projectPathRepo projectpath.Repository
 	updateMutex     sync.Mutex
 	updating        bool
+	// scanMutex serialises full and single-project scans
+	scanMutex sync.Mutex
+	watcher   *Watcher
+	counter         Counter
 	ticker          *time.Ticker
 	stopChan        chan struct{}
 	stopped         bool
@@ -57,10 +63,25 @@ func NewService(db *gorm.DB, projectPathRepo projectpath.Repository) *Service {
 	return &Service{
 		db:              db,
 		projectPathRepo: projectPathRepo,
+		counter:         DefaultCounter(),
 		stopChan:        make(chan struct{}),
 	}
 }
 
+// SetCounter replaces the line counter used for scans
+func (s *Service) SetCounter(counter Counter) {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	s.counter = counter
+}
+
+// Counter returns the line counter used for scans
+func (s *Service) Counter() Counter {
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+	return s.counter
+}
+
 func (s *Service) GetLatestStats() (*CodeStats, error) {
 	var stats CodeStats
 	err := s.db.Order("created_at DESC").First(&stats).Error
@@ -91,17 +112,11 @@ func (s *Service) UpdateStats() error {
 		s.updateMutex.Unlock()
 	}()
 
-	logger.Info("Running tokei to collect code statistics")
+	s.scanMutex.Lock()
+	defer s.scanMutex.Unlock()
 
-	// Check if tokei binary exists before proceeding
-	tokeiPath := "/usr/local/bin/tokei"
-	if _, err := os.Stat(tokeiPath); os.IsNotExist(err) {
-		// Fallback to cargo install path for local development
-		tokeiPath = "/root/.cargo/bin/tokei"
-		if _, err := os.Stat(tokeiPath); os.IsNotExist(err) {
-			return fmt.Errorf("tokei binary not found. Please install tokei to enable code statistics")
-		}
-	}
+	counter := s.Counter()
+	logger.Info("Collecting code statistics", "counter", counter.Name())
 
 	// Get active project paths from database
 	ctx := context.Background()
@@ -114,49 +129,140 @@ func (s *Service) UpdateStats() error {
 		return fmt.Errorf("no active project paths configured. Please add project paths in the DevPanel")
 	}
 
-	// Build tokei command with all project paths and exclusions
-	args := []string{tokeiPath, "--output", "json"}
-
-	// Add exclusion patterns from database
-	excludePatterns := make(map[string]bool)
+	// Each project is scanned on its own with its own exclusions so
+	// per-project numbers can be kept as snapshots
+	stats := &CodeStats{Languages: []Language{}}
+	var failures []string
 	for _, project := range projectPaths {
-		for _, exclude := range project.ExcludePatterns {
-			excludePatterns[exclude] = true
+		logger.Info("Scanning project", "name", project.Name, "path", project.Path)
+
+		projectStats, err := counter.Count(ctx, project.Path, project.ExcludePatterns)
+		if err != nil {
+			logger.Error("Failed to scan project", "name", project.Name, "path", project.Path, "error", err)
+			failures = append(failures, fmt.Sprintf("%s: %v", project.Name, err))
+			continue
+		}
+
+		if err := s.recordSnapshot(ctx, project, projectStats); err != nil {
+			logger.Error("Failed to record project snapshot", "name", project.Name, "error", err)
 		}
+		mergeStats(stats, projectStats)
 	}
 
-	for pattern := range excludePatterns {
-		args = append(args, "--exclude", pattern)
+	if len(failures) == len(projectPaths) {
+		return fmt.Errorf("failed to scan all project paths: %s", strings.Join(failures, "; "))
+	}
+
+	sort.Slice(stats.Languages, func(i, j int) bool {
+		return stats.Languages[i].Lines > stats.Languages[j].Lines
+	})
+
+	if err := s.saveAggregate(stats); err != nil {
+		return err
+	}
+
+	// Git history is read incrementally, so this only costs the commits made
+	// since the previous update
+	if err := s.syncGitHistory(ctx, projectPaths); err != nil {
+		logger.Error("Failed to sync git history", "error", err)
+	}
+	if err := s.syncDependencies(ctx, projectPaths); err != nil {
+		logger.Error("Failed to inventory dependencies", "error", err)
+	}
+
+	return nil
+}
+
+// UpdateProjectStats rescans a single project and rebuilds the aggregate
+// from the latest snapshots of the other projects, so a change in one
+// project does not rescan them all. An inactive or deleted project only
+// drops out of the aggregate.
+func (s *Service) UpdateProjectStats(ctx context.Context, id uuid.UUID) error {
+	s.scanMutex.Lock()
+	defer s.scanMutex.Unlock()
+
+	projectPaths, err := s.projectPathRepo.GetActive(ctx)
+	if err != nil {
+		return fmt.Errorf("database error while retrieving project paths: %w", err)
 	}
 
-	// Add all project paths from database
 	for _, project := range projectPaths {
-		args = append(args, project.Path)
-		logger.Info("Adding project to scan", "name", project.Name, "path", project.Path)
+		if project.ID != id {
+			continue
+		}
+
+		counter := s.Counter()
+		logger.Info("Scanning project", "name", project.Name, "path", project.Path, "counter", counter.Name())
+
+		projectStats, err := counter.Count(ctx, project.Path, project.ExcludePatterns)
+		if err != nil {
+			return fmt.Errorf("failed to scan project %s: %w", project.Name, err)
+		}
+		if err := s.recordSnapshot(ctx, project, projectStats); err != nil {
+			return fmt.Errorf("failed to record project snapshot: %w", err)
+		}
+
+		only := []*projectpath.ProjectPath{project}
+		if err := s.syncGitHistory(ctx, only); err != nil {
+			logger.Error("Failed to sync git history", "name", project.Name, "error", err)
+		}
+		if err := s.syncDependencies(ctx, only); err != nil {
+			logger.Error("Failed to inventory dependencies", "name", project.Name, "error", err)
+		}
+		break
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
-	output, err := cmd.Output()
+	snapshots, err := s.GetProjectStats(ctx)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			stderrMsg := string(exitErr.Stderr)
-			logger.Error("Tokei execution failed", "stderr", stderrMsg, "exit_code", exitErr.ExitCode())
-			return fmt.Errorf("tokei command failed with exit code %d: %s. Check if all project paths are accessible", exitErr.ExitCode(), stderrMsg)
+		return err
+	}
+
+	stats := &CodeStats{Languages: []Language{}}
+	for _, snapshot := range snapshots {
+		projectStats := &CodeStats{
+			TotalFiles:   snapshot.Files,
+			TotalLines:   snapshot.Lines,
+			TotalCode:    snapshot.Code,
+			TotalComment: snapshot.Comments,
+			TotalBlanks:  snapshot.Blanks,
+		}
+		for _, lang := range snapshot.Languages {
+			projectStats.Languages = append(projectStats.Languages, Language{
+				Name:     lang.Language,
+				Files:    lang.Files,
+				Lines:    lang.Lines,
+				Code:     lang.Code,
+				Comments: lang.Comments,
+				Blanks:   lang.Blanks,
+			})
 		}
-		return fmt.Errorf("failed to execute tokei command: %w. Verify tokei installation and project path permissions", err)
+		mergeStats(stats, projectStats)
 	}
 
-	var tokeiOutput map[string]interface{}
-	if err := json.Unmarshal(output, &tokeiOutput); err != nil {
-		logger.Error("Failed to parse tokei JSON output", "output_preview", string(output[:min(len(output), 500)]))
-		return fmt.Errorf("failed to parse tokei JSON output: %w. The output may be corrupted or in unexpected format", err)
+	sort.Slice(stats.Languages, func(i, j int) bool {
+		return stats.Languages[i].Lines > stats.Languages[j].Lines
+	})
+
+	return s.saveAggregate(stats)
+}
+
+// ProjectPathChanged rescans a project after its path was created, edited
+// or deleted, and updates which paths are watched
+func (s *Service) ProjectPathChanged(ctx context.Context, id uuid.UUID) error {
+	if s.watcher != nil {
+		if err := s.watcher.Sync(ctx); err != nil {
+			logger.Error("Failed to update watched project paths", "error", err)
+		}
 	}
+	return s.UpdateProjectStats(ctx, id)
+}
 
-	stats := s.parseTokeniOutput(tokeiOutput)
+// saveAggregate stores the statistics summed over all projects
+func (s *Service) saveAggregate(stats *CodeStats) error {
 	stats.UpdatedAt = time.Now()
 	stats.CreatedAt = time.Now()
 
-	if err := s.db.Create(&stats).Error; err != nil {
+	if err := s.db.Create(stats).Error; err != nil {
 		logger.Error("Database error while saving code statistics", "total_lines", stats.TotalLines, "db_error", err)
 		return fmt.Errorf("database error while saving code statistics: %w. Check database connectivity and permissions", err)
 	}
@@ -174,49 +280,32 @@ func (s *Service) UpdateStats() error {
 	return nil
 }
 
-func (s *Service) parseTokeniOutput(output map[string]interface{}) *CodeStats {
-	stats := &CodeStats{
-		Languages: []Language{},
-	}
-
-	for lang, data := range output {
-		if lang == "Total" {
-			continue
-		}
-
-		if langData, ok := data.(map[string]interface{}); ok {
-			language := Language{
-				Name: lang,
-			}
-
-			// Count files from reports array
-			if reports, ok := langData["reports"].([]interface{}); ok {
-				language.Files = len(reports)
+// mergeStats adds a project's statistics to the aggregate, summing languages
+// that appear in several projects
+func mergeStats(total, project *CodeStats) {
+	for _, lang := range project.Languages {
+		merged := false
+		for i := range total.Languages {
+			if total.Languages[i].Name == lang.Name {
+				total.Languages[i].Files += lang.Files
+				total.Languages[i].Lines += lang.Lines
+				total.Languages[i].Code += lang.Code
+				total.Languages[i].Comments += lang.Comments
+				total.Languages[i].Blanks += lang.Blanks
+				merged = true
+				break
 			}
-
-			if code, ok := langData["code"].(float64); ok {
-				language.Code = int64(code)
-			}
-			if comments, ok := langData["comments"].(float64); ok {
-				language.Comments = int64(comments)
-			}
-			if blanks, ok := langData["blanks"].(float64); ok {
-				language.Blanks = int64(blanks)
-			}
-
-			// Calculate total lines as code + comments + blanks
-			language.Lines = language.Code + language.Comments + language.Blanks
-
-			stats.Languages = append(stats.Languages, language)
-			stats.TotalFiles += language.Files
-			stats.TotalLines += language.Lines
-			stats.TotalCode += language.Code
-			stats.TotalComment += language.Comments
-			stats.TotalBlanks += language.Blanks
+		}
+		if !merged {
+			total.Languages = append(total.Languages, lang)
 		}
 	}
 
-	return stats
+	total.TotalFiles += project.TotalFiles
+	total.TotalLines += project.TotalLines
+	total.TotalCode += project.TotalCode
+	total.TotalComment += project.TotalComment
+	total.TotalBlanks += project.TotalBlanks
 }
 
 func (s *Service) saveToFile(stats *CodeStats) error {
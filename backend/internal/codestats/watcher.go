@@ -0,0 +1,411 @@
+package codestats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+// WatcherConfig configures the project path watcher
+type WatcherConfig struct {
+	// Debounce is how long a project must be quiet before it is rescanned
+	Debounce time.Duration
+	// MaxDelay bounds how long a rescan is postponed by continuous changes
+	MaxDelay time.Duration
+	// PollInterval is how often polled projects are checked for changes
+	PollInterval time.Duration
+	// ResyncInterval is how often the set of active project paths is
+	// reloaded, to catch changes made outside this instance
+	ResyncInterval time.Duration
+	// ForcePolling disables inotify, for file systems where it does not
+	// deliver events such as network shares and some container mounts
+	ForcePolling bool
+}
+
+// DefaultWatcherConfig returns the default watcher settings
+func DefaultWatcherConfig() WatcherConfig {
+	return WatcherConfig{
+		Debounce:       10 * time.Second,
+		MaxDelay:       2 * time.Minute,
+		PollInterval:   30 * time.Second,
+		ResyncInterval: 5 * time.Minute,
+	}
+}
+
+// Watcher rescans a project when files below its path change. It uses
+// inotify through fsnotify and falls back to polling a project when inotify
+// is unavailable or its watch limit is reached.
+type Watcher struct {
+	service *Service
+	config  WatcherConfig
+
+	mu       sync.Mutex
+	projects map[uuid.UUID]*projectWatch
+	pending  map[uuid.UUID]*pendingRescan
+	stop     chan struct{}
+	stopped  bool
+}
+
+// projectWatch is the watch on one project path
+type projectWatch struct {
+	id   uuid.UUID
+	name string
+	root string
+	// key identifies the path and exclusions the watch was set up with, so
+	// edits to either restart it
+	key    string
+	filter *ignoreMatcher
+	stop   chan struct{}
+}
+
+type pendingRescan struct {
+	first time.Time
+	timer *time.Timer
+}
+
+// NewWatcher creates a watcher for the service's active project paths.
+// Zero config values are replaced by the defaults.
+func NewWatcher(service *Service, config WatcherConfig) *Watcher {
+	defaults := DefaultWatcherConfig()
+	if config.Debounce <= 0 {
+		config.Debounce = defaults.Debounce
+	}
+	if config.MaxDelay < config.Debounce {
+		config.MaxDelay = max(defaults.MaxDelay, config.Debounce)
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.ResyncInterval <= 0 {
+		config.ResyncInterval = defaults.ResyncInterval
+	}
+
+	w := &Watcher{
+		service:  service,
+		config:   config,
+		projects: make(map[uuid.UUID]*projectWatch),
+		pending:  make(map[uuid.UUID]*pendingRescan),
+		stop:     make(chan struct{}),
+	}
+	service.watcher = w
+	return w
+}
+
+// Start watches the active project paths and keeps the set of watches up
+// to date until Stop is called
+func (w *Watcher) Start(ctx context.Context) error {
+	if err := w.Sync(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.config.ResyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := w.Sync(ctx); err != nil {
+					logger.Error("Failed to update watched project paths", "error", err)
+				}
+			case <-w.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	logger.Info("Watching project paths for changes", "debounce", w.config.Debounce, "polling", w.config.ForcePolling)
+	return nil
+}
+
+// Stop removes every watch and cancels pending rescans
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped {
+		return
+	}
+	w.stopped = true
+	close(w.stop)
+
+	for id, watch := range w.projects {
+		close(watch.stop)
+		delete(w.projects, id)
+	}
+	for id, pending := range w.pending {
+		pending.timer.Stop()
+		delete(w.pending, id)
+	}
+}
+
+// Sync watches newly active project paths, stops watching deactivated or
+// deleted ones and restarts watches whose path or exclusions changed
+func (w *Watcher) Sync(ctx context.Context) error {
+	projects, err := w.service.projectPathRepo.GetActive(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get project paths: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return nil
+	}
+
+	active := make(map[uuid.UUID]*projectpath.ProjectPath, len(projects))
+	for _, project := range projects {
+		active[project.ID] = project
+	}
+
+	for id, watch := range w.projects {
+		project, ok := active[id]
+		if ok && watch.key == watchKey(project) {
+			continue
+		}
+		close(watch.stop)
+		delete(w.projects, id)
+		if pending, ok := w.pending[id]; ok && project == nil {
+			pending.timer.Stop()
+			delete(w.pending, id)
+		}
+		logger.Info("Stopped watching project path", "name", watch.name, "path", watch.root)
+	}
+
+	for id, project := range active {
+		if _, ok := w.projects[id]; ok {
+			continue
+		}
+		watch := w.newProjectWatch(project)
+		w.projects[id] = watch
+		w.startWatch(watch)
+	}
+
+	return nil
+}
+
+func watchKey(project *projectpath.ProjectPath) string {
+	return project.Path + "\x00" + strings.Join(project.ExcludePatterns, "\x00")
+}
+
+func (w *Watcher) newProjectWatch(project *projectpath.ProjectPath) *projectWatch {
+	// Changes to ignored files do not affect the counts, so the exclusions
+	// and the root .gitignore filter events before they reach the debounce
+	filter := &ignoreMatcher{}
+	filter.add("", project.ExcludePatterns)
+	filter.addFile(project.Path, "")
+
+	return &projectWatch{
+		id:     project.ID,
+		name:   project.Name,
+		root:   project.Path,
+		key:    watchKey(project),
+		filter: filter,
+		stop:   make(chan struct{}),
+	}
+}
+
+// startWatch starts an inotify watch on a project, falling back to polling
+func (w *Watcher) startWatch(watch *projectWatch) {
+	if !w.config.ForcePolling {
+		notifier, err := w.addNotifyWatches(watch)
+		if err == nil {
+			go w.runNotify(watch, notifier)
+			logger.Info("Watching project path", "name", watch.name, "path", watch.root, "mode", "inotify")
+			return
+		}
+		logger.Warn("Inotify unavailable for project path, polling instead",
+			"name", watch.name, "path", watch.root, "error", err)
+	}
+
+	go w.runPoll(watch)
+	logger.Info("Watching project path", "name", watch.name, "path", watch.root, "mode", "poll", "interval", w.config.PollInterval)
+}
+
+// addNotifyWatches creates an fsnotify watcher covering every directory of
+// the project that is not ignored. inotify watches are not recursive, so
+// each directory needs its own.
+func (w *Watcher) addNotifyWatches(watch *projectWatch) (*fsnotify.Watcher, error) {
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := addWatchTree(notifier, watch, watch.root); err != nil {
+		notifier.Close()
+		return nil, err
+	}
+	return notifier, nil
+}
+
+// addWatchTree watches dir and its subdirectories
+func addWatchTree(notifier *fsnotify.Watcher, watch *projectWatch, dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // unreadable subdirectories are skipped
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != watch.root && watch.ignored(path, true) {
+			return filepath.SkipDir
+		}
+		return notifier.Add(path)
+	})
+}
+
+// ignored reports whether an absolute path below the project root is
+// excluded from counting
+func (pw *projectWatch) ignored(path string, isDir bool) bool {
+	rel, err := filepath.Rel(pw.root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, part := range strings.Split(rel, "/") {
+		if part == ".git" {
+			return true
+		}
+	}
+	return pw.filter.ignored(rel, isDir)
+}
+
+func (w *Watcher) runNotify(watch *projectWatch, notifier *fsnotify.Watcher) {
+	defer notifier.Close()
+
+	for {
+		select {
+		case event, ok := <-notifier.Events:
+			if !ok {
+				return
+			}
+
+			info, err := os.Lstat(event.Name)
+			isDir := err == nil && info.IsDir()
+			if watch.ignored(event.Name, isDir) {
+				continue
+			}
+
+			if isDir && event.Op&fsnotify.Create != 0 {
+				if err := addWatchTree(notifier, watch, event.Name); err != nil {
+					logger.Warn("Failed to watch new directory", "name", watch.name, "path", event.Name, "error", err)
+				}
+			}
+			w.schedule(watch.id)
+
+		case err, ok := <-notifier.Errors:
+			if !ok {
+				return
+			}
+			// A queue overflow means events were lost, so rescan to be safe
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.schedule(watch.id)
+				continue
+			}
+			logger.Warn("Project path watch error", "name", watch.name, "error", err)
+
+		case <-watch.stop:
+			return
+		}
+	}
+}
+
+func (w *Watcher) runPoll(watch *projectWatch) {
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	previous := watch.fingerprint()
+	for {
+		select {
+		case <-ticker.C:
+			current := watch.fingerprint()
+			if current != previous {
+				previous = current
+				w.schedule(watch.id)
+			}
+		case <-watch.stop:
+			return
+		}
+	}
+}
+
+// fingerprint hashes the path, size and modification time of every file
+// that is not ignored
+func (pw *projectWatch) fingerprint() uint64 {
+	h := fnv.New64a()
+	filepath.WalkDir(pw.root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || path == pw.root {
+			return nil
+		}
+		if pw.ignored(path, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64()
+}
+
+// schedule debounces a rescan of a project: each change pushes the rescan
+// back by the debounce period, up to MaxDelay after the first change
+func (w *Watcher) schedule(id uuid.UUID) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+
+	now := time.Now()
+	pending, ok := w.pending[id]
+	if !ok {
+		pending = &pendingRescan{first: now}
+		w.pending[id] = pending
+	} else {
+		pending.timer.Stop()
+	}
+
+	delay := w.config.Debounce
+	if remaining := pending.first.Add(w.config.MaxDelay).Sub(now); remaining < delay {
+		delay = max(remaining, 0)
+	}
+	pending.timer = time.AfterFunc(delay, func() { w.rescan(id) })
+}
+
+func (w *Watcher) rescan(id uuid.UUID) {
+	w.mu.Lock()
+	delete(w.pending, id)
+	watch, ok := w.projects[id]
+	w.mu.Unlock()
+	if !ok {
+		return // the path stopped being watched while the rescan was pending
+	}
+
+	logger.Info("Files changed, rescanning project", "name", watch.name, "path", watch.root)
+	if err := w.service.UpdateProjectStats(context.Background(), id); err != nil {
+		logger.Error("Failed to rescan project after file changes", "name", watch.name, "error", err)
+	}
+}
@@ -0,0 +1,280 @@
+package codestats
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	appconfig "github.com/JadenRazo/Project-Website/backend/internal/app/config"
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProjectPaths serves active project paths to the watcher and records
+// the rescans it triggers, which fail early with errScanSkipped
+type fakeProjectPaths struct {
+	projectpath.Repository
+
+	mu       sync.Mutex
+	projects []*projectpath.ProjectPath
+	scanning bool
+	scans    chan time.Time
+}
+
+var errScanSkipped = errors.New("scan skipped")
+
+func newFakeProjectPaths(projects ...*projectpath.ProjectPath) *fakeProjectPaths {
+	return &fakeProjectPaths{projects: projects, scans: make(chan time.Time, 10)}
+}
+
+func (f *fakeProjectPaths) GetActive(ctx context.Context) ([]*projectpath.ProjectPath, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.scanning {
+		f.scans <- time.Now()
+		return nil, errScanSkipped
+	}
+	return append([]*projectpath.ProjectPath(nil), f.projects...), nil
+}
+
+func (f *fakeProjectPaths) set(projects ...*projectpath.ProjectPath) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.projects = projects
+}
+
+var initLogger sync.Once
+
+// initTestLogger initialises the logger once, as timers of earlier tests
+// may still be logging
+func initTestLogger(t *testing.T) {
+	initLogger.Do(func() {
+		require.NoError(t, logger.InitLogger(&appconfig.LoggingConfig{Level: "fatal", Output: "stderr"}, "codestats-test", "test"))
+	})
+}
+
+// newTestWatcher creates a watcher over repo
+func newTestWatcher(t *testing.T, repo *fakeProjectPaths, config WatcherConfig) *Watcher {
+	t.Helper()
+	initTestLogger(t)
+	w := NewWatcher(&Service{projectPathRepo: repo}, config)
+	t.Cleanup(w.Stop)
+	return w
+}
+
+// scanningWatcher returns a watcher whose rescans of id are reported on
+// the repository's scans channel
+func scanningWatcher(t *testing.T, config WatcherConfig) (*Watcher, *fakeProjectPaths, uuid.UUID) {
+	t.Helper()
+	repo := newFakeProjectPaths()
+	repo.scanning = true
+	w := newTestWatcher(t, repo, config)
+
+	id := uuid.New()
+	w.projects[id] = &projectWatch{id: id, name: "test", stop: make(chan struct{})}
+	return w, repo, id
+}
+
+func waitForScan(t *testing.T, repo *fakeProjectPaths) time.Time {
+	t.Helper()
+	select {
+	case at := <-repo.scans:
+		return at
+	case <-time.After(2 * time.Second):
+		t.Fatal("project was not rescanned")
+		return time.Time{}
+	}
+}
+
+func TestWatcherScheduleDebounces(t *testing.T) {
+	w, repo, id := scanningWatcher(t, WatcherConfig{Debounce: 50 * time.Millisecond, MaxDelay: time.Second})
+
+	start := time.Now()
+	w.schedule(id)
+	time.Sleep(20 * time.Millisecond)
+	w.schedule(id)
+
+	at := waitForScan(t, repo)
+	assert.GreaterOrEqual(t, at.Sub(start), 70*time.Millisecond, "the second change restarts the debounce")
+
+	w.mu.Lock()
+	assert.Empty(t, w.pending)
+	w.mu.Unlock()
+
+	select {
+	case <-repo.scans:
+		t.Fatal("changes within the debounce period are rescanned once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatcherScheduleCappedByMaxDelay(t *testing.T) {
+	w, repo, id := scanningWatcher(t, WatcherConfig{Debounce: 50 * time.Millisecond, MaxDelay: 150 * time.Millisecond})
+
+	start := time.Now()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			w.schedule(id)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Changes keep arriving faster than the debounce, so only MaxDelay
+	// lets the rescan through
+	elapsed := waitForScan(t, repo).Sub(start)
+	assert.GreaterOrEqual(t, elapsed, 150*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
+
+func TestWatcherSkipsRescanOfUnwatchedPath(t *testing.T) {
+	w, repo, id := scanningWatcher(t, WatcherConfig{Debounce: 10 * time.Millisecond})
+	delete(w.projects, id)
+
+	w.schedule(id)
+	select {
+	case <-repo.scans:
+		t.Fatal("a path that is no longer watched was rescanned")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatcherSync(t *testing.T) {
+	kept := &projectpath.ProjectPath{ID: uuid.New(), Name: "kept", Path: t.TempDir()}
+	changed := &projectpath.ProjectPath{ID: uuid.New(), Name: "changed", Path: t.TempDir()}
+	removed := &projectpath.ProjectPath{ID: uuid.New(), Name: "removed", Path: t.TempDir()}
+
+	repo := newFakeProjectPaths(kept, changed, removed)
+	w := newTestWatcher(t, repo, WatcherConfig{
+		Debounce:     time.Hour,
+		PollInterval: time.Hour,
+		ForcePolling: true,
+	})
+
+	ctx := context.Background()
+	require.NoError(t, w.Sync(ctx))
+	require.Len(t, w.projects, 3)
+	keptWatch, changedWatch, removedWatch := w.projects[kept.ID], w.projects[changed.ID], w.projects[removed.ID]
+
+	w.schedule(changed.ID)
+	w.schedule(removed.ID)
+
+	edited := *changed
+	edited.ExcludePatterns = []string{"*.log"}
+	repo.set(kept, &edited)
+	require.NoError(t, w.Sync(ctx))
+
+	require.Len(t, w.projects, 2)
+	assert.Same(t, keptWatch, w.projects[kept.ID], "unchanged paths keep their watch")
+	assert.NotSame(t, changedWatch, w.projects[changed.ID], "edited exclusions restart the watch")
+	assert.Equal(t, watchKey(&edited), w.projects[changed.ID].key)
+	assert.NotContains(t, w.projects, removed.ID)
+
+	assert.Contains(t, w.pending, changed.ID, "a restarted watch keeps its pending rescan")
+	assert.NotContains(t, w.pending, removed.ID, "a deactivated path's rescan is cancelled")
+
+	for name, watch := range map[string]*projectWatch{"changed": changedWatch, "removed": removedWatch} {
+		select {
+		case <-watch.stop:
+		default:
+			t.Errorf("%s watch was not stopped", name)
+		}
+	}
+	select {
+	case <-keptWatch.stop:
+		t.Error("kept watch was stopped")
+	default:
+	}
+}
+
+// watchedProject creates a project directory with a .gitignore and returns
+// a watch for it
+func watchedProject(t *testing.T, exclude ...string) *projectWatch {
+	t.Helper()
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("build/\n*.tmp\n"), 0644))
+	for _, dir := range []string{"src", "build", ".git", "vendor"} {
+		require.NoError(t, os.Mkdir(filepath.Join(root, dir), 0755))
+	}
+	w := &Watcher{}
+	return w.newProjectWatch(&projectpath.ProjectPath{ID: uuid.New(), Path: root, ExcludePatterns: exclude})
+}
+
+func TestProjectWatchIgnored(t *testing.T) {
+	watch := watchedProject(t, "vendor/", "*.min.js")
+	root := watch.root
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{root, true, false},
+		{filepath.Join(root, "main.go"), false, false},
+		{filepath.Join(root, "src", "app.js"), false, false},
+		{filepath.Join(root, ".git"), true, true},
+		{filepath.Join(root, ".git", "HEAD"), false, true},
+		{filepath.Join(root, "src", ".git", "config"), false, true},
+		{filepath.Join(root, "build"), true, true},
+		{filepath.Join(root, "src", "scratch.tmp"), false, true},
+		{filepath.Join(root, "vendor"), true, true},
+		{filepath.Join(root, "vendor"), false, false},
+		{filepath.Join(root, "src", "app.min.js"), false, true},
+	}
+
+	for _, tt := range tests {
+		rel, _ := filepath.Rel(root, tt.path)
+		assert.Equal(t, tt.want, watch.ignored(tt.path, tt.isDir), "%s (dir %v)", rel, tt.isDir)
+	}
+}
+
+func TestProjectWatchFingerprint(t *testing.T) {
+	watch := watchedProject(t, "vendor/")
+	root := watch.root
+	source := filepath.Join(root, "src", "main.go")
+	require.NoError(t, os.WriteFile(source, []byte("package main\n"), 0644))
+
+	initial := watch.fingerprint()
+	assert.Equal(t, initial, watch.fingerprint(), "an unchanged tree keeps its fingerprint")
+
+	// Changes to ignored files do not trigger a rescan
+	for _, path := range []string{
+		filepath.Join(root, ".git", "index"),
+		filepath.Join(root, "build", "app"),
+		filepath.Join(root, "vendor", "lib.go"),
+		filepath.Join(root, "src", "notes.tmp"),
+	} {
+		require.NoError(t, os.WriteFile(path, []byte("ignored"), 0644))
+		assert.Equal(t, initial, watch.fingerprint(), "writing %s", path)
+	}
+
+	require.NoError(t, os.WriteFile(source, []byte("package main\n\nfunc main() {}\n"), 0644))
+	edited := watch.fingerprint()
+	assert.NotEqual(t, initial, edited, "editing a file changes the fingerprint")
+
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(source, later, later))
+	touched := watch.fingerprint()
+	assert.NotEqual(t, edited, touched, "touching a file changes the fingerprint")
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "src", "util.go"), nil, 0644))
+	added := watch.fingerprint()
+	assert.NotEqual(t, touched, added, "adding a file changes the fingerprint")
+
+	require.NoError(t, os.Remove(source))
+	assert.NotEqual(t, added, watch.fingerprint(), "removing a file changes the fingerprint")
+}
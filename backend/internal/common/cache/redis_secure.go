@@ -310,4 +310,112 @@ func (c *SecureCache) FlushDB(ctx context.Context) error {
 // Info returns Redis server information
 func (c *SecureCache) Info(ctx context.Context, section ...string) (string, error) {
 	return c.redis.client.Info(ctx, section...).Result()
-}
\ No newline at end of file
+}
+// Publish encrypts a message and publishes it on a pub/sub channel
+func (c *SecureCache) Publish(ctx context.Context, channel string, message []byte) error {
+	encrypted, err := c.encrypt(message)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	return c.redis.client.Publish(ctx, channel, encrypted).Err()
+}
+
+// Subscribe delivers decrypted messages published on a channel until ctx is
+// cancelled. Messages that fail to decrypt are dropped.
+func (c *SecureCache) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	pubsub := c.redis.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", channel, err)
+	}
+
+	messages := make(chan []byte, 64)
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+
+		incoming := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-incoming:
+				if !ok {
+					return
+				}
+				plaintext, err := c.decrypt(msg.Payload)
+				if err != nil {
+					continue
+				}
+				select {
+				case messages <- plaintext:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// StreamEntry is an entry of a sequenced stream
+type StreamEntry struct {
+	Seq     int64
+	Message []byte
+}
+
+// appendSequencedScript assigns the next sequence number of a stream and
+// appends the entry under it in one step, so entry IDs stay in order when
+// several instances append at once
+var appendSequencedScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+redis.call('XADD', KEYS[1], 'MAXLEN', ARGV[2], seq .. '-0', 'm', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+// AppendSequenced encrypts a message and appends it to a stream capped at
+// maxLen entries. It returns the sequence number assigned to the entry.
+// Streams and their counters expire after ttl without appends.
+func (c *SecureCache) AppendSequenced(ctx context.Context, stream string, message []byte, maxLen int64, ttl time.Duration) (int64, error) {
+	encrypted, err := c.encrypt(message)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	keys := []string{stream, stream + ":seq"}
+	seq, err := appendSequencedScript.Run(ctx, c.redis.client, keys, encrypted, maxLen, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to append to %s: %w", stream, err)
+	}
+	return seq, nil
+}
+
+// ReadSequenced returns the decrypted entries of a stream with a sequence
+// number of at least from, oldest first
+func (c *SecureCache) ReadSequenced(ctx context.Context, stream string, from int64) ([]StreamEntry, error) {
+	messages, err := c.redis.client.XRange(ctx, stream, fmt.Sprintf("%d-0", from), "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", stream, err)
+	}
+
+	entries := make([]StreamEntry, 0, len(messages))
+	for _, msg := range messages {
+		var seq int64
+		if _, err := fmt.Sscanf(msg.ID, "%d-", &seq); err != nil {
+			continue
+		}
+		payload, ok := msg.Values["m"].(string)
+		if !ok {
+			continue
+		}
+		plaintext, err := c.decrypt(payload)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, StreamEntry{Seq: seq, Message: plaintext})
+	}
+	return entries, nil
+}
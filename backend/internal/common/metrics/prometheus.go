@@ -62,6 +62,18 @@ var (
 
 	// VisitorsByCountry tracks visitors by country
 	VisitorsByCountry *prometheus.GaugeVec
+
+	// AttachmentGCRuns tracks attachment garbage collection runs
+	AttachmentGCRuns *prometheus.CounterVec
+
+	// AttachmentGCItems tracks files and attachments found by garbage collection
+	AttachmentGCItems *prometheus.CounterVec
+
+	// AttachmentGCReclaimedBytes tracks storage freed by garbage collection
+	AttachmentGCReclaimedBytes prometheus.Counter
+
+	// AttachmentGCDuration tracks how long garbage collection runs take
+	AttachmentGCDuration prometheus.Histogram
 )
 
 // InitMetrics initializes all Prometheus metrics
@@ -211,6 +223,38 @@ func InitMetrics(cfg *config.MetricsConfig) {
 		},
 		[]string{"country_code"},
 	)
+
+	// Attachment garbage collection metrics
+	AttachmentGCRuns = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "attachment_gc_runs_total",
+			Help: "Total number of attachment garbage collection runs",
+		},
+		[]string{"mode", "status"},
+	)
+
+	AttachmentGCItems = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "attachment_gc_items_total",
+			Help: "Total number of orphaned files, missing files and purged attachments found by garbage collection",
+		},
+		[]string{"mode", "kind"},
+	)
+
+	AttachmentGCReclaimedBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "attachment_gc_reclaimed_bytes_total",
+			Help: "Total bytes of storage freed by attachment garbage collection",
+		},
+	)
+
+	AttachmentGCDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "attachment_gc_duration_seconds",
+			Help:    "Duration of attachment garbage collection runs",
+			Buckets: prometheus.ExponentialBuckets(0.1, 4, 8),
+		},
+	)
 }
 
 // PrometheusMiddleware creates a middleware for HTTP request metrics
@@ -326,6 +370,43 @@ func TrackQueueProcessingTime(queue, messageType string, duration time.Duration)
 	}).Observe(duration.Seconds())
 }
 
+// AttachmentGCStats is the outcome of an attachment garbage collection run
+type AttachmentGCStats struct {
+	DryRun            bool
+	Failed            bool
+	OrphanedFiles     int
+	MissingFiles      int
+	PurgedAttachments int
+	ReclaimedBytes    int64
+	Duration          time.Duration
+}
+
+// RecordAttachmentGC records a garbage collection run. It does nothing
+// when metrics are disabled, since the worker may run without them.
+func RecordAttachmentGC(stats AttachmentGCStats) {
+	if AttachmentGCRuns == nil {
+		return
+	}
+
+	mode := "delete"
+	if stats.DryRun {
+		mode = "dry_run"
+	}
+	status := "completed"
+	if stats.Failed {
+		status = "failed"
+	}
+
+	AttachmentGCRuns.With(prometheus.Labels{"mode": mode, "status": status}).Inc()
+	AttachmentGCItems.With(prometheus.Labels{"mode": mode, "kind": "orphaned_file"}).Add(float64(stats.OrphanedFiles))
+	AttachmentGCItems.With(prometheus.Labels{"mode": mode, "kind": "missing_file"}).Add(float64(stats.MissingFiles))
+	AttachmentGCItems.With(prometheus.Labels{"mode": mode, "kind": "purged_attachment"}).Add(float64(stats.PurgedAttachments))
+	if !stats.DryRun {
+		AttachmentGCReclaimedBytes.Add(float64(stats.ReclaimedBytes))
+	}
+	AttachmentGCDuration.Observe(stats.Duration.Seconds())
+}
+
 // MetricsHandler returns the Prometheus metrics HTTP handler
 func MetricsHandler() http.Handler {
 	return promhttp.Handler()
@@ -0,0 +1,383 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The local backend stores file contents once per distinct content, named
+// by their SHA-256 and sharded by its first two bytes so no directory grows
+// too large. Keys are metadata files pointing at the contents:
+//
+//	objects/ab/cd/abcd…        file contents
+//	objects/ab/cd/abcd….refs   number of keys referencing the contents
+//	keys/12/34/1234…           metadata of a key, named by the key's SHA-256
+//	tmp/                       uploads in progress
+//
+// Every file is written to tmp/ first and renamed into place, so readers
+// never see a partial file.
+
+// localEntry is the metadata stored for a key
+type localEntry struct {
+	Key         string    `json:"key"`
+	Hash        string    `json:"hash"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// uploadLocal uploads a file to local storage
+func (p *Provider) uploadLocal(ctx context.Context, key string, reader io.Reader, contentType string) (*FileInfo, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" {
+		return nil, errors.New("file key is required")
+	}
+
+	tmp, err := p.localTempFile()
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), &contextReader{ctx: ctx, reader: reader})
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write file: %w", err)
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	p.localMu.Lock()
+	defer p.localMu.Unlock()
+
+	object := p.objectPath(hash)
+	if _, err := os.Stat(object); err == nil {
+		// Identical contents are already stored
+		os.Remove(tmp.Name())
+	} else {
+		if err := os.MkdirAll(filepath.Dir(object), 0o755); err != nil {
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("failed to create object directory: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), object); err != nil {
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("failed to store file: %w", err)
+		}
+	}
+
+	previous, err := p.readLocalEntry(key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	// Reference the new contents before the key points at them, so a crash
+	// in between leaks contents rather than deleting ones still in use
+	replaced := previous != nil && previous.Hash != hash
+	if previous == nil || replaced {
+		if err := p.adjustRefs(hash, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := &localEntry{
+		Key:         key,
+		Hash:        hash,
+		Size:        size,
+		ContentType: contentType,
+		ModTime:     time.Now().UTC(),
+	}
+	if err := p.writeLocalFile(p.keyPath(key), entry); err != nil {
+		return nil, fmt.Errorf("failed to store file metadata: %w", err)
+	}
+
+	if replaced {
+		if err := p.adjustRefs(previous.Hash, -1); err != nil {
+			return nil, err
+		}
+	}
+
+	fileURL, err := p.SignedURL(ctx, key, p.urlExpiry())
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileInfo{
+		Key:      key,
+		Size:     size,
+		URL:      fileURL,
+		MimeType: contentType,
+		ModTime:  entry.ModTime,
+	}, nil
+}
+
+// downloadLocal downloads a file from local storage
+func (p *Provider) downloadLocal(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
+	file, entry, err := p.openLocal(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fileURL, err := p.SignedURL(ctx, entry.Key, p.urlExpiry())
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, &FileInfo{
+		Key:      entry.Key,
+		Size:     entry.Size,
+		URL:      fileURL,
+		MimeType: entry.ContentType,
+		ModTime:  entry.ModTime,
+	}, nil
+}
+
+// openLocal opens the contents of a key
+func (p *Provider) openLocal(key string) (*os.File, *localEntry, error) {
+	key = strings.TrimPrefix(key, "/")
+
+	p.localMu.Lock()
+	defer p.localMu.Unlock()
+
+	entry, err := p.readLocalEntry(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(p.objectPath(entry.Hash))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: contents of %s are missing", ErrNotFound, key)
+		}
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return file, entry, nil
+}
+
+// deleteLocal deletes a file from local storage. The contents are removed
+// once no other key references them.
+func (p *Provider) deleteLocal(ctx context.Context, key string) error {
+	key = strings.TrimPrefix(key, "/")
+
+	p.localMu.Lock()
+	defer p.localMu.Unlock()
+
+	entry, err := p.readLocalEntry(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p.keyPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file metadata: %w", err)
+	}
+	return p.adjustRefs(entry.Hash, -1)
+}
+
+// listLocal walks the key metadata. Keys are stored by their hash, so
+// every key is read to match the prefix.
+func (p *Provider) listLocal(ctx context.Context, prefix string, fn func(*FileInfo) error) error {
+	prefix = strings.TrimPrefix(prefix, "/")
+	root := filepath.Join(p.config.BasePath, "keys")
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Deleted while listing
+				return nil
+			}
+			return err
+		}
+		var entry localEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("failed to parse file metadata %s: %w", path, err)
+		}
+		if !strings.HasPrefix(entry.Key, prefix) {
+			return nil
+		}
+
+		return fn(&FileInfo{
+			Key:      entry.Key,
+			Size:     entry.Size,
+			MimeType: entry.ContentType,
+			ModTime:  entry.ModTime,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+	return nil
+}
+
+// objectPath returns the path of the contents with the given hash
+func (p *Provider) objectPath(hash string) string {
+	return filepath.Join(p.config.BasePath, "objects", hash[0:2], hash[2:4], hash)
+}
+
+// keyPath returns the path of a key's metadata. Keys are hashed, so they
+// cannot escape the storage directory.
+func (p *Provider) keyPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(p.config.BasePath, "keys", name[0:2], name[2:4], name)
+}
+
+func (p *Provider) readLocalEntry(key string) (*localEntry, error) {
+	data, err := os.ReadFile(p.keyPath(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to read file metadata: %w", err)
+	}
+
+	var entry localEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse file metadata: %w", err)
+	}
+	return &entry, nil
+}
+
+// adjustRefs changes the reference count of stored contents, removing them
+// when it drops to zero. The caller holds localMu.
+func (p *Provider) adjustRefs(hash string, delta int) error {
+	object := p.objectPath(hash)
+	refsPath := object + ".refs"
+
+	refs := 0
+	if data, err := os.ReadFile(refsPath); err == nil {
+		refs, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read reference count: %w", err)
+	}
+
+	refs += delta
+	if refs > 0 {
+		if err := p.writeLocalFile(refsPath, strconv.Itoa(refs)); err != nil {
+			return fmt.Errorf("failed to update reference count: %w", err)
+		}
+		return nil
+	}
+
+	if err := os.Remove(object); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if err := os.Remove(refsPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete reference count: %w", err)
+	}
+	return nil
+}
+
+// writeLocalFile atomically replaces a small file. Strings are written as
+// they are, other values as JSON.
+func (p *Provider) writeLocalFile(path string, value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data = encoded
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := p.localTempFile()
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// staleTempFileAge is how old a temp file must be before it is considered
+// abandoned; no upload takes this long
+const staleTempFileAge = 24 * time.Hour
+
+// removeStaleTempFiles deletes temp files last modified before cutoff
+func removeStaleTempFiles(dir string, cutoff time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(dir, entry.Name()))
+	}
+}
+
+// localTempFile creates a file in the storage's tmp directory, which is on
+// the same file system as the final location so renames are atomic
+func (p *Provider) localTempFile() (*os.File, error) {
+	dir := filepath.Join(p.config.BasePath, "tmp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return tmp, nil
+}
+
+// contextReader stops a copy when its context is cancelled
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(buf []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(buf)
+}
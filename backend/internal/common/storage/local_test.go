@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLocalProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	provider, err := NewProvider(&Config{
+		Type:       StorageTypeLocal,
+		BasePath:   t.TempDir(),
+		BaseURL:    "http://localhost:8080/files",
+		SigningKey: "test-signing-key",
+	})
+	require.NoError(t, err)
+	return provider
+}
+
+func countObjects(t *testing.T, provider *Provider) int {
+	t.Helper()
+
+	count := 0
+	root := filepath.Join(provider.config.BasePath, "objects")
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && !strings.HasSuffix(path, ".refs") {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+func readAll(t *testing.T, provider *Provider, key string) string {
+	t.Helper()
+
+	reader, _, err := provider.Download(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestLocalUploadDownloadDelete(t *testing.T) {
+	provider := newLocalProvider(t)
+	ctx := context.Background()
+
+	info, err := provider.Upload(ctx, "/attachments/a.txt", strings.NewReader("hello"), "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, "attachments/a.txt", info.Key)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Contains(t, info.URL, "signature=")
+
+	// Identical contents are stored once
+	_, err = provider.Upload(ctx, "attachments/b.txt", strings.NewReader("hello"), "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, 1, countObjects(t, provider))
+
+	_, fileInfo, err := provider.Download(ctx, "attachments/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", fileInfo.MimeType)
+	assert.Equal(t, "hello", readAll(t, provider, "attachments/a.txt"))
+
+	// Contents stay while another key references them
+	require.NoError(t, provider.Delete(ctx, "attachments/a.txt"))
+	_, _, err = provider.Download(ctx, "attachments/a.txt")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "hello", readAll(t, provider, "attachments/b.txt"))
+
+	require.NoError(t, provider.Delete(ctx, "attachments/b.txt"))
+	assert.Equal(t, 0, countObjects(t, provider))
+	assert.ErrorIs(t, provider.Delete(ctx, "attachments/b.txt"), ErrNotFound)
+
+	// Nothing is left behind in the temp directory
+	leftovers, err := os.ReadDir(filepath.Join(provider.config.BasePath, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestLocalUploadReplacesKey(t *testing.T) {
+	provider := newLocalProvider(t)
+	ctx := context.Background()
+
+	_, err := provider.Upload(ctx, "avatar.png", strings.NewReader("old"), "image/png")
+	require.NoError(t, err)
+	_, err = provider.Upload(ctx, "avatar.png", strings.NewReader("new"), "image/png")
+	require.NoError(t, err)
+
+	assert.Equal(t, "new", readAll(t, provider, "avatar.png"))
+	assert.Equal(t, 1, countObjects(t, provider), "replaced contents are removed")
+}
+
+func TestDownloadHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := newLocalProvider(t)
+	ctx := context.Background()
+
+	router := gin.New()
+	require.True(t, provider.RegisterDownloadRoutes(router))
+
+	_, err := provider.Upload(ctx, "docs/report.txt", strings.NewReader("0123456789"), "text/plain")
+	require.NoError(t, err)
+
+	signed, err := provider.SignedURL(ctx, "docs/report.txt", time.Minute)
+	require.NoError(t, err)
+	parsed, err := url.Parse(signed)
+	require.NoError(t, err)
+	target := parsed.RequestURI()
+
+	get := func(target string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("serves signed URLs", func(t *testing.T) {
+		rec := get(target, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "0123456789", rec.Body.String())
+		assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+		assert.NotEmpty(t, rec.Header().Get("ETag"))
+	})
+
+	t.Run("answers HEAD requests", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, target, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "10", rec.Header().Get("Content-Length"))
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("serves ranges", func(t *testing.T) {
+		rec := get(target, map[string]string{"Range": "bytes=2-5"})
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "2345", rec.Body.String())
+		assert.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+	})
+
+	t.Run("honours conditional requests", func(t *testing.T) {
+		etag := get(target, nil).Header().Get("ETag")
+		rec := get(target, map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("rejects tampered URLs", func(t *testing.T) {
+		query := parsed.Query()
+		query.Set("expires", "9999999999")
+		rec := get(parsed.Path+"?"+query.Encode(), nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = get(strings.Replace(target, "report", "other", 1), nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		rec = get(parsed.Path, nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("rejects expired URLs", func(t *testing.T) {
+		expired, err := provider.SignedURL(ctx, "docs/report.txt", -time.Minute)
+		require.NoError(t, err)
+		parsed, err := url.Parse(expired)
+		require.NoError(t, err)
+
+		rec := get(parsed.RequestURI(), nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), "expired")
+	})
+
+	t.Run("returns not found for deleted files", func(t *testing.T) {
+		require.NoError(t, provider.Delete(ctx, "docs/report.txt"))
+		rec := get(target, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestDownloadPath(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    string
+	}{
+		{"http://localhost:8080/files", "/files"},
+		{"https://example.com/api/files/", "/api/files"},
+		{"/files", "/files"},
+		{"https://files.example.com", ""},
+		{"https://files.example.com/", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			provider := newLocalProvider(t)
+			provider.config.BaseURL = tt.baseURL
+			assert.Equal(t, tt.want, provider.DownloadPath())
+			assert.Equal(t, tt.want != "", provider.RegisterDownloadRoutes(gin.New()))
+		})
+	}
+}
+
+func TestLocalRemovesStaleTempFiles(t *testing.T) {
+	basePath := t.TempDir()
+	tmpDir := filepath.Join(basePath, "tmp")
+	require.NoError(t, os.MkdirAll(tmpDir, 0o755))
+
+	stale := filepath.Join(tmpDir, "upload-stale")
+	inFlight := filepath.Join(tmpDir, "upload-in-flight")
+	require.NoError(t, os.WriteFile(stale, []byte("abandoned"), 0o644))
+	require.NoError(t, os.WriteFile(inFlight, []byte("still uploading"), 0o644))
+	old := time.Now().Add(-staleTempFileAge - time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	_, err := NewProvider(&Config{Type: StorageTypeLocal, BasePath: basePath})
+	require.NoError(t, err)
+
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, inFlight, "temp files another process may be writing are kept")
+}
+
+func TestLocalList(t *testing.T) {
+	provider := newLocalProvider(t)
+	ctx := context.Background()
+
+	// Nothing stored yet
+	require.NoError(t, provider.List(ctx, "", func(*FileInfo) error {
+		t.Fatal("unexpected file")
+		return nil
+	}))
+
+	for _, key := range []string{"attachments/a.txt", "/attachments/b.txt", "avatars/c.png"} {
+		_, err := provider.Upload(ctx, key, strings.NewReader(key), "text/plain")
+		require.NoError(t, err)
+	}
+
+	var keys []string
+	require.NoError(t, provider.List(ctx, "/attachments/", func(info *FileInfo) error {
+		keys = append(keys, info.Key)
+		assert.False(t, info.ModTime.IsZero())
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"attachments/a.txt", "attachments/b.txt"}, keys)
+	assert.Equal(t, "attachments/b.txt", provider.CanonicalKey("/attachments/b.txt"))
+
+	stop := errors.New("stop")
+	err := provider.List(ctx, "", func(*FileInfo) error { return stop })
+	assert.ErrorIs(t, err, stop)
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MinPartSize is the smallest part S3 accepts, except for the last one
+const MinPartSize = 5 * 1024 * 1024
+
+// ErrInvalidPart is returned when completing an upload with parts that were
+// not uploaded or whose ETags do not match
+var ErrInvalidPart = errors.New("invalid multipart upload part")
+
+// CompletedPart is a part of a multipart upload
+type CompletedPart struct {
+	Number int64  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// Multipart uploads of the local backend keep their parts until completed,
+// outside tmp/ so they survive restarts:
+//
+//	multipart/<upload id>/upload.json   key and content type
+//	multipart/<upload id>/<number>      part contents
+
+// localMultipart is the metadata of a local multipart upload
+type localMultipart struct {
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+}
+
+// MinPartSize returns the smallest part, other than the last, the backend
+// accepts in a multipart upload
+func (p *Provider) MinPartSize() int64 {
+	if p.config.Type == StorageTypeS3 {
+		return MinPartSize
+	}
+	return 1
+}
+
+// CreateMultipartUpload starts an upload whose contents are sent in parts,
+// and returns its ID
+func (p *Provider) CreateMultipartUpload(ctx context.Context, key string, contentType string) (string, error) {
+	switch p.config.Type {
+	case StorageTypeS3:
+		result, err := p.s3Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      aws.String(p.config.S3.Bucket),
+			Key:         aws.String(p.s3Key(key)),
+			ContentType: aws.String(contentType),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create S3 multipart upload: %w", err)
+		}
+		return *result.UploadId, nil
+	case StorageTypeLocal:
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return "", fmt.Errorf("failed to generate upload ID: %w", err)
+		}
+		uploadID := hex.EncodeToString(id)
+
+		dir := p.multipartDir(uploadID)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create upload directory: %w", err)
+		}
+		meta := &localMultipart{Key: key, ContentType: contentType}
+		if err := p.writeLocalFile(filepath.Join(dir, "upload.json"), meta); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("failed to store upload metadata: %w", err)
+		}
+		return uploadID, nil
+	default:
+		return "", fmt.Errorf("unsupported storage type: %s", p.config.Type)
+	}
+}
+
+// UploadPart stores a part of a multipart upload. Parts are numbered from 1
+// and uploading a number again replaces the part.
+func (p *Provider) UploadPart(ctx context.Context, key string, uploadID string, number int64, reader io.ReadSeeker, size int64) (*CompletedPart, error) {
+	switch p.config.Type {
+	case StorageTypeS3:
+		result, err := p.s3Client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(p.config.S3.Bucket),
+			Key:           aws.String(p.s3Key(key)),
+			UploadId:      aws.String(uploadID),
+			PartNumber:    aws.Int64(number),
+			Body:          reader,
+			ContentLength: aws.Int64(size),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload S3 part %d: %w", number, err)
+		}
+		return &CompletedPart{Number: number, ETag: *result.ETag, Size: size}, nil
+	case StorageTypeLocal:
+		dir, err := p.localMultipartDir(uploadID)
+		if err != nil {
+			return nil, err
+		}
+
+		tmp, err := p.localTempFile()
+		if err != nil {
+			return nil, err
+		}
+		hasher := sha256.New()
+		written, err := io.Copy(io.MultiWriter(tmp, hasher), &contextReader{ctx: ctx, reader: io.LimitReader(reader, size)})
+		if err == nil && written != size {
+			err = fmt.Errorf("part %d has %d bytes, expected %d", number, written, size)
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), filepath.Join(dir, strconv.FormatInt(number, 10)))
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("failed to store part %d: %w", number, err)
+		}
+		return &CompletedPart{Number: number, ETag: hex.EncodeToString(hasher.Sum(nil)), Size: size}, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", p.config.Type)
+	}
+}
+
+// CompleteMultipartUpload joins the parts, in order of their numbers, into
+// the file stored under key
+func (p *Provider) CompleteMultipartUpload(ctx context.Context, key string, uploadID string, parts []CompletedPart) (*FileInfo, error) {
+	sorted := append([]CompletedPart(nil), parts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+
+	switch p.config.Type {
+	case StorageTypeS3:
+		completed := make([]*s3.CompletedPart, len(sorted))
+		for i, part := range sorted {
+			completed[i] = &s3.CompletedPart{PartNumber: aws.Int64(part.Number), ETag: aws.String(part.ETag)}
+		}
+		_, err := p.s3Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(p.config.S3.Bucket),
+			Key:             aws.String(p.s3Key(key)),
+			UploadId:        aws.String(uploadID),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to complete S3 multipart upload: %w", err)
+		}
+
+		return p.statS3(ctx, key)
+	case StorageTypeLocal:
+		dir, err := p.localMultipartDir(uploadID)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upload metadata: %w", err)
+		}
+		var meta localMultipart
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return nil, fmt.Errorf("failed to parse upload metadata: %w", err)
+		}
+
+		readers := make([]io.Reader, 0, len(sorted))
+		for _, part := range sorted {
+			file, err := os.Open(filepath.Join(dir, strconv.FormatInt(part.Number, 10)))
+			if err != nil {
+				return nil, fmt.Errorf("%w: part %d is missing", ErrInvalidPart, part.Number)
+			}
+			defer file.Close()
+
+			hasher := sha256.New()
+			if _, err := io.Copy(hasher, file); err != nil {
+				return nil, fmt.Errorf("failed to read part %d: %w", part.Number, err)
+			}
+			if hex.EncodeToString(hasher.Sum(nil)) != part.ETag {
+				return nil, fmt.Errorf("%w: part %d does not match its ETag", ErrInvalidPart, part.Number)
+			}
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to read part %d: %w", part.Number, err)
+			}
+			readers = append(readers, file)
+		}
+
+		info, err := p.uploadLocal(ctx, key, io.MultiReader(readers...), meta.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		os.RemoveAll(dir)
+		return info, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", p.config.Type)
+	}
+}
+
+// AbortMultipartUpload discards an upload and its parts
+func (p *Provider) AbortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	switch p.config.Type {
+	case StorageTypeS3:
+		_, err := p.s3Client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(p.config.S3.Bucket),
+			Key:      aws.String(p.s3Key(key)),
+			UploadId: aws.String(uploadID),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to abort S3 multipart upload: %w", err)
+		}
+		return nil
+	case StorageTypeLocal:
+		dir, err := p.localMultipartDir(uploadID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to delete upload parts: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported storage type: %s", p.config.Type)
+	}
+}
+
+// statS3 returns the metadata of an S3 object
+func (p *Provider) statS3(ctx context.Context, key string) (*FileInfo, error) {
+	key = p.s3Key(key)
+	head, err := p.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(p.config.S3.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file metadata from S3: %w", err)
+	}
+
+	return &FileInfo{
+		Key:      key,
+		Size:     aws.Int64Value(head.ContentLength),
+		URL:      p.generateURL(key),
+		MimeType: aws.StringValue(head.ContentType),
+		ModTime:  aws.TimeValue(head.LastModified),
+	}, nil
+}
+
+func (p *Provider) multipartDir(uploadID string) string {
+	return filepath.Join(p.config.BasePath, "multipart", uploadID)
+}
+
+// localMultipartDir returns the directory of an existing local upload. IDs
+// are validated so they cannot escape the storage directory.
+func (p *Provider) localMultipartDir(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || len(uploadID) != 32 {
+		return "", fmt.Errorf("%w: upload %s", ErrNotFound, uploadID)
+	}
+	dir := p.multipartDir(uploadID)
+	if _, err := os.Stat(dir); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: upload %s", ErrNotFound, uploadID)
+		}
+		return "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	return dir, nil
+}
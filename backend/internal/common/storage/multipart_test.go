@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalMultipartUpload(t *testing.T) {
+	provider := newLocalProvider(t)
+	ctx := context.Background()
+
+	uploadID, err := provider.CreateMultipartUpload(ctx, "attachments/big.txt", "text/plain")
+	require.NoError(t, err)
+
+	// Parts may arrive out of order and be uploaded again
+	second, err := provider.UploadPart(ctx, "attachments/big.txt", uploadID, 2, strings.NewReader("world"), 5)
+	require.NoError(t, err)
+	_, err = provider.UploadPart(ctx, "attachments/big.txt", uploadID, 1, strings.NewReader("HELLO "), 6)
+	require.NoError(t, err)
+	first, err := provider.UploadPart(ctx, "attachments/big.txt", uploadID, 1, strings.NewReader("hello "), 6)
+	require.NoError(t, err)
+
+	// Parts survive a restart
+	restarted, err := NewProvider(provider.config)
+	require.NoError(t, err)
+
+	info, err := restarted.CompleteMultipartUpload(ctx, "attachments/big.txt", uploadID, []CompletedPart{*second, *first})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size)
+	assert.Equal(t, "hello world", readAll(t, restarted, "attachments/big.txt"))
+
+	_, fileInfo, err := restarted.Download(ctx, "attachments/big.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", fileInfo.MimeType)
+
+	_, err = os.Stat(filepath.Join(provider.config.BasePath, "multipart", uploadID))
+	assert.True(t, os.IsNotExist(err), "parts are removed once completed")
+}
+
+func TestLocalMultipartUploadFailures(t *testing.T) {
+	provider := newLocalProvider(t)
+	ctx := context.Background()
+
+	uploadID, err := provider.CreateMultipartUpload(ctx, "a.txt", "text/plain")
+	require.NoError(t, err)
+
+	t.Run("short parts are rejected", func(t *testing.T) {
+		_, err := provider.UploadPart(ctx, "a.txt", uploadID, 1, strings.NewReader("abc"), 5)
+		assert.Error(t, err)
+	})
+
+	t.Run("parts must match their ETags", func(t *testing.T) {
+		part, err := provider.UploadPart(ctx, "a.txt", uploadID, 1, strings.NewReader("abc"), 3)
+		require.NoError(t, err)
+		part.ETag = "tampered"
+
+		_, err = provider.CompleteMultipartUpload(ctx, "a.txt", uploadID, []CompletedPart{*part})
+		assert.ErrorIs(t, err, ErrInvalidPart)
+
+		_, err = provider.CompleteMultipartUpload(ctx, "a.txt", uploadID, []CompletedPart{{Number: 7, ETag: "x"}})
+		assert.ErrorIs(t, err, ErrInvalidPart)
+	})
+
+	t.Run("unknown uploads", func(t *testing.T) {
+		_, err := provider.UploadPart(ctx, "a.txt", "../../etc", 1, strings.NewReader("abc"), 3)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, provider.AbortMultipartUpload(ctx, "a.txt", "0123456789abcdef0123456789abcdef"))
+	})
+
+	t.Run("aborting removes the parts", func(t *testing.T) {
+		require.NoError(t, provider.AbortMultipartUpload(ctx, "a.txt", uploadID))
+		_, err := provider.UploadPart(ctx, "a.txt", uploadID, 2, strings.NewReader("abc"), 3)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
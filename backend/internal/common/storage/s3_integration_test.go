@@ -0,0 +1,116 @@
+//go:build integration
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newS3Provider connects to the MinIO server of docker compose --profile
+// minio up, or the one STORAGE_TEST_S3_ENDPOINT names. Run with
+// go test -tags integration ./internal/common/storage/
+func newS3Provider(t *testing.T) *Provider {
+	t.Helper()
+
+	endpoint := os.Getenv("STORAGE_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "localhost:9000"
+	}
+	accessKey := os.Getenv("STORAGE_TEST_S3_ACCESS_KEY")
+	if accessKey == "" {
+		accessKey = "minioadmin"
+	}
+	secretKey := os.Getenv("STORAGE_TEST_S3_SECRET_KEY")
+	if secretKey == "" {
+		secretKey = "minioadmin"
+	}
+
+	provider, err := NewProvider(&Config{
+		Type:     StorageTypeS3,
+		BasePath: "storage-test/" + time.Now().Format("20060102150405.000000000"),
+		S3: S3Config{
+			Bucket:       "storage-test",
+			Endpoint:     endpoint,
+			AccessKey:    accessKey,
+			SecretKey:    secretKey,
+			UseSSL:       os.Getenv("STORAGE_TEST_S3_USE_SSL") == "true",
+			CreateBucket: true,
+		},
+	})
+	require.NoError(t, err)
+	return provider
+}
+
+func TestS3UploadDownloadDelete(t *testing.T) {
+	provider := newS3Provider(t)
+	ctx := context.Background()
+
+	info, err := provider.Upload(ctx, "hello.txt", strings.NewReader("hello"), "text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, "hello", readAll(t, provider, "hello.txt"))
+
+	_, fileInfo, err := provider.Download(ctx, "hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", fileInfo.MimeType)
+
+	signed, err := provider.SignedURL(ctx, "hello.txt", time.Minute)
+	require.NoError(t, err)
+	resp, err := http.Get(signed)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	var listed []string
+	require.NoError(t, provider.List(ctx, "", func(file *FileInfo) error {
+		listed = append(listed, file.Key)
+		return nil
+	}))
+	assert.Equal(t, []string{provider.CanonicalKey("hello.txt")}, listed)
+
+	require.NoError(t, provider.Delete(ctx, "hello.txt"))
+	_, _, err = provider.Download(ctx, "hello.txt")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	provider := newS3Provider(t)
+	ctx := context.Background()
+
+	first := bytes.Repeat([]byte("a"), int(provider.MinPartSize()))
+	second := []byte("tail")
+
+	uploadID, err := provider.CreateMultipartUpload(ctx, "large.bin", "application/octet-stream")
+	require.NoError(t, err)
+	var parts []CompletedPart
+	for i, data := range [][]byte{first, second} {
+		part, err := provider.UploadPart(ctx, "large.bin", uploadID, int64(i+1), bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		parts = append(parts, *part)
+	}
+	info, err := provider.CompleteMultipartUpload(ctx, "large.bin", uploadID, parts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(first)+len(second)), info.Size)
+	assert.Equal(t, string(first)+string(second), readAll(t, provider, "large.bin"))
+	require.NoError(t, provider.Delete(ctx, "large.bin"))
+
+	aborted, err := provider.CreateMultipartUpload(ctx, "aborted.bin", "application/octet-stream")
+	require.NoError(t, err)
+	_, err = provider.UploadPart(ctx, "aborted.bin", aborted, 1, bytes.NewReader(second), int64(len(second)))
+	require.NoError(t, err)
+	require.NoError(t, provider.AbortMultipartUpload(ctx, "aborted.bin", aborted))
+	_, _, err = provider.Download(ctx, "aborted.bin")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultURLExpiry is how long URLs returned by uploads and downloads stay
+// valid when Config.URLExpiry is not set
+const defaultURLExpiry = time.Hour
+
+// inlineTypes are served inline by DownloadHandler. Everything else is sent
+// as an attachment so uploaded HTML or SVG cannot run in the site's origin.
+var inlineTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"video/mp4":       true,
+	"audio/mpeg":      true,
+}
+
+// SignedURL returns a URL that allows downloading a file until expiry has
+// passed. S3 URLs are presigned by S3; local URLs are signed with
+// Config.SigningKey and served by DownloadHandler.
+func (p *Provider) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	switch p.config.Type {
+	case StorageTypeS3:
+		req, _ := p.s3Client.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(p.config.S3.Bucket),
+			Key:    aws.String(p.s3Key(key)),
+		})
+		req.SetContext(ctx)
+		signed, err := req.Presign(expiry)
+		if err != nil {
+			return "", fmt.Errorf("failed to presign S3 URL: %w", err)
+		}
+		return signed, nil
+	case StorageTypeLocal:
+		key = strings.TrimPrefix(key, "/")
+		expires := time.Now().Add(expiry).Unix()
+		return fmt.Sprintf("%s?expires=%d&signature=%s", p.generateURL(key), expires, p.sign(key, expires)), nil
+	default:
+		return "", fmt.Errorf("unsupported storage type: %s", p.config.Type)
+	}
+}
+
+// sign computes the signature of a local download URL
+func (p *Provider) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, p.signingKey)
+	mac.Write([]byte(key))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks a local download URL's signature and expiry
+func (p *Provider) verifySignature(key string, expires int64, signature string) error {
+	expected := p.sign(key, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrURLExpired
+	}
+	return nil
+}
+
+// DownloadPath returns the path of Config.BaseURL, which DownloadHandler is
+// mounted on. It is empty when files are not served locally or BaseURL has
+// no path, since the handler cannot then be mounted beside other routes.
+func (p *Provider) DownloadPath() string {
+	if p.config.Type != StorageTypeLocal {
+		return ""
+	}
+	parsed, err := url.Parse(p.config.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(parsed.Path, "/")
+}
+
+// RegisterDownloadRoutes mounts DownloadHandler for GET and HEAD on
+// DownloadPath. It reports whether the routes were mounted.
+func (p *Provider) RegisterDownloadRoutes(router gin.IRoutes) bool {
+	prefix := p.DownloadPath()
+	if prefix == "" {
+		return false
+	}
+	handler := p.DownloadHandler()
+	router.GET(prefix+"/*key", handler)
+	router.HEAD(prefix+"/*key", handler)
+	return true
+}
+
+// DownloadHandler serves local files through the signed URLs returned by
+// SignedURL, with support for Range and conditional requests. Mount it on
+// the path of Config.BaseURL with a key wildcard, e.g.
+//
+//	router.GET("/files/*key", provider.DownloadHandler())
+//	router.HEAD("/files/*key", provider.DownloadHandler())
+//
+// RegisterDownloadRoutes does this.
+func (p *Provider) DownloadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p.config.Type != StorageTypeLocal {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid signature"})
+			return
+		}
+
+		if err := p.verifySignature(key, expires, c.Query("signature")); err != nil {
+			if errors.Is(err, ErrURLExpired) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Download link has expired"})
+				return
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid signature"})
+			return
+		}
+
+		file, entry, err := p.openLocal(key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+		defer file.Close()
+
+		contentType := entry.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		disposition := "attachment"
+		if inlineTypes[mediaType] {
+			disposition = "inline"
+		}
+
+		// Contents never change for a hash, so it is a strong validator and
+		// the response can be cached for as long as the URL is valid
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(key)}))
+		c.Header("ETag", `"`+entry.Hash+`"`)
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", max(expires-time.Now().Unix(), 0)))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+
+		http.ServeContent(c.Writer, c.Request, path.Base(key), entry.ModTime, file)
+	}
+}
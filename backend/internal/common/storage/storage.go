@@ -2,15 +2,21 @@ package storage
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
+	"os"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -28,6 +34,17 @@ const (
 	StorageTypeLocal StorageType = "local"
 )
 
+var (
+	// ErrNotFound is returned when a key does not exist
+	ErrNotFound = errors.New("file not found")
+
+	// ErrInvalidSignature is returned for download URLs with a wrong signature
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrURLExpired is returned for download URLs past their expiry
+	ErrURLExpired = errors.New("url expired")
+)
+
 // Config contains configuration for the storage provider
 type Config struct {
 	// Type defines the storage backend type
@@ -39,6 +56,14 @@ type Config struct {
 	// BaseURL is the base URL for generating public URLs
 	BaseURL string `json:"base_url" mapstructure:"base_url"`
 
+	// SigningKey is the secret local download URLs are signed with a key
+	// derived from. A random key is generated when empty, so signed URLs
+	// stop working when the process restarts.
+	SigningKey string `json:"signing_key" mapstructure:"signing_key"`
+
+	// URLExpiry is how long URLs returned by uploads and downloads stay valid
+	URLExpiry time.Duration `json:"url_expiry" mapstructure:"url_expiry"`
+
 	// S3 contains S3-specific configuration
 	S3 S3Config `json:"s3" mapstructure:"s3"`
 }
@@ -62,14 +87,19 @@ type S3Config struct {
 
 	// UseSSL indicates whether to use SSL for S3 connections
 	UseSSL bool `json:"use_ssl" mapstructure:"use_ssl"`
+
+	// CreateBucket creates the bucket at startup if it does not exist, so a
+	// fresh MinIO server works for local development and tests
+	CreateBucket bool `json:"create_bucket" mapstructure:"create_bucket"`
 }
 
 // DefaultConfig returns the default storage configuration
 func DefaultConfig() *Config {
 	return &Config{
-		Type:     StorageTypeLocal,
-		BasePath: "./storage",
-		BaseURL:  "http://localhost:8080/files",
+		Type:      StorageTypeLocal,
+		BasePath:  "./storage",
+		BaseURL:   "http://localhost:8080/files",
+		URLExpiry: defaultURLExpiry,
 		S3: S3Config{
 			Bucket: "project-website",
 			Region: "us-west-2",
@@ -84,6 +114,10 @@ type Provider struct {
 	s3Client     *s3.S3
 	s3Uploader   *s3manager.Uploader
 	s3Downloader *s3manager.Downloader
+
+	// localMu serialises changes to local keys and reference counts
+	localMu    sync.Mutex
+	signingKey []byte
 }
 
 // FileInfo contains information about a stored file
@@ -112,7 +146,9 @@ func NewProvider(config *Config) (*Provider, error) {
 			return nil, fmt.Errorf("failed to initialize S3 storage: %w", err)
 		}
 	case StorageTypeLocal:
-		// No initialization needed for local storage
+		if err := provider.initLocal(); err != nil {
+			return nil, fmt.Errorf("failed to initialize local storage: %w", err)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", config.Type)
 	}
@@ -128,6 +164,12 @@ func (p *Provider) initS3() error {
 		return errors.New("S3 bucket name is required")
 	}
 
+	// MinIO and most S3-compatible servers ignore the region but the SDK
+	// requires one
+	if s3Config.Region == "" {
+		s3Config.Region = "us-east-1"
+	}
+
 	// Create AWS session
 	awsConfig := &aws.Config{
 		Region:      aws.String(s3Config.Region),
@@ -152,9 +194,83 @@ func (p *Provider) initS3() error {
 	p.s3Uploader = s3manager.NewUploader(sess)
 	p.s3Downloader = s3manager.NewDownloader(sess)
 
+	if s3Config.CreateBucket {
+		if err := p.ensureBucket(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// ensureBucket creates the configured bucket if it does not exist
+func (p *Provider) ensureBucket() error {
+	bucket := aws.String(p.config.S3.Bucket)
+
+	_, err := p.s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: bucket})
+	if err == nil {
+		return nil
+	}
+
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || (awsErr.Code() != "NotFound" && awsErr.Code() != s3.ErrCodeNoSuchBucket) {
+		return fmt.Errorf("failed to check S3 bucket: %w", err)
+	}
+
+	if _, err := p.s3Client.CreateBucket(&s3.CreateBucketInput{Bucket: bucket}); err != nil {
+		return fmt.Errorf("failed to create S3 bucket: %w", err)
+	}
+	return p.s3Client.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: bucket})
+}
+
+// initLocal prepares the local storage directory and URL signing key
+func (p *Provider) initLocal() error {
+	if p.config.BasePath == "" {
+		return errors.New("storage base path is required")
+	}
+	if err := os.MkdirAll(p.config.BasePath, 0o755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	// Leftovers of uploads interrupted by a crash. Other processes sharing
+	// the directory may be writing temp files right now, so only old ones
+	// are removed.
+	removeStaleTempFiles(path.Join(p.config.BasePath, "tmp"), time.Now().Add(-staleTempFileAge))
+
+	if p.config.SigningKey != "" {
+		// Derive a purpose-specific key so a shared secret such as the JWT key
+		// can never produce a signature valid elsewhere
+		mac := hmac.New(sha256.New, []byte(p.config.SigningKey))
+		mac.Write([]byte("storage.signed-urls"))
+		p.signingKey = mac.Sum(nil)
+		return nil
+	}
+
+	p.signingKey = make([]byte, 32)
+	if _, err := rand.Read(p.signingKey); err != nil {
+		return fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	return nil
+}
+
+// urlExpiry returns how long generated URLs stay valid
+func (p *Provider) urlExpiry() time.Duration {
+	if p.config.URLExpiry > 0 {
+		return p.config.URLExpiry
+	}
+	return defaultURLExpiry
+}
+
+// s3Key normalizes a key by removing the leading slash and adding the
+// prefix if set
+func (p *Provider) s3Key(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if p.config.BasePath != "" && !strings.HasPrefix(key, p.config.BasePath) {
+		key = path.Join(p.config.BasePath, key)
+	}
+	return key
+}
+
 // Upload uploads a file to storage
 func (p *Provider) Upload(ctx context.Context, key string, reader io.Reader, contentType string) (*FileInfo, error) {
 	switch p.config.Type {
@@ -169,14 +285,7 @@ func (p *Provider) Upload(ctx context.Context, key string, reader io.Reader, con
 
 // uploadS3 uploads a file to S3
 func (p *Provider) uploadS3(ctx context.Context, key string, reader io.Reader, contentType string) (*FileInfo, error) {
-	// Normalize key by removing leading slash and adding prefix if set
-	if strings.HasPrefix(key, "/") {
-		key = key[1:]
-	}
-
-	if p.config.BasePath != "" && !strings.HasPrefix(key, p.config.BasePath) {
-		key = path.Join(p.config.BasePath, key)
-	}
+	key = p.s3Key(key)
 
 	// Upload the file
 	result, err := p.s3Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
@@ -213,13 +322,6 @@ func (p *Provider) uploadS3(ctx context.Context, key string, reader io.Reader, c
 	}, nil
 }
 
-// uploadLocal uploads a file to local storage
-func (p *Provider) uploadLocal(ctx context.Context, key string, reader io.Reader, contentType string) (*FileInfo, error) {
-	// TODO: Implement local file storage
-	// This is a placeholder for actual implementation
-	return nil, errors.New("local storage not implemented")
-}
-
 // Download downloads a file from storage
 func (p *Provider) Download(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
 	switch p.config.Type {
@@ -234,14 +336,7 @@ func (p *Provider) Download(ctx context.Context, key string) (io.ReadCloser, *Fi
 
 // downloadS3 downloads a file from S3
 func (p *Provider) downloadS3(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
-	// Normalize key by removing leading slash and adding prefix if set
-	if strings.HasPrefix(key, "/") {
-		key = key[1:]
-	}
-
-	if p.config.BasePath != "" && !strings.HasPrefix(key, p.config.BasePath) {
-		key = path.Join(p.config.BasePath, key)
-	}
+	key = p.s3Key(key)
 
 	// Get file metadata
 	head, err := p.s3Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
@@ -249,6 +344,11 @@ func (p *Provider) downloadS3(ctx context.Context, key string) (io.ReadCloser, *
 		Key:    aws.String(key),
 	})
 	if err != nil {
+		// HEAD responses have no body, so a missing key is only a 404
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && (awsErr.Code() == "NotFound" || awsErr.Code() == s3.ErrCodeNoSuchKey) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
 		return nil, nil, fmt.Errorf("failed to get file metadata from S3: %w", err)
 	}
 
@@ -275,13 +375,6 @@ func (p *Provider) downloadS3(ctx context.Context, key string) (io.ReadCloser, *
 	return result.Body, fileInfo, nil
 }
 
-// downloadLocal downloads a file from local storage
-func (p *Provider) downloadLocal(ctx context.Context, key string) (io.ReadCloser, *FileInfo, error) {
-	// TODO: Implement local file storage
-	// This is a placeholder for actual implementation
-	return nil, nil, errors.New("local storage not implemented")
-}
-
 // Delete deletes a file from storage
 func (p *Provider) Delete(ctx context.Context, key string) error {
 	switch p.config.Type {
@@ -296,14 +389,7 @@ func (p *Provider) Delete(ctx context.Context, key string) error {
 
 // deleteS3 deletes a file from S3
 func (p *Provider) deleteS3(ctx context.Context, key string) error {
-	// Normalize key by removing leading slash and adding prefix if set
-	if strings.HasPrefix(key, "/") {
-		key = key[1:]
-	}
-
-	if p.config.BasePath != "" && !strings.HasPrefix(key, p.config.BasePath) {
-		key = path.Join(p.config.BasePath, key)
-	}
+	key = p.s3Key(key)
 
 	// Delete the file
 	_, err := p.s3Client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
@@ -317,11 +403,55 @@ func (p *Provider) deleteS3(ctx context.Context, key string) error {
 	return nil
 }
 
-// deleteLocal deletes a file from local storage
-func (p *Provider) deleteLocal(ctx context.Context, key string) error {
-	// TODO: Implement local file storage
-	// This is a placeholder for actual implementation
-	return errors.New("local storage not implemented")
+// List calls fn for every file whose key starts with prefix, stopping at
+// the first error fn returns. URLs are not set, and keys are in the form
+// CanonicalKey returns.
+func (p *Provider) List(ctx context.Context, prefix string, fn func(*FileInfo) error) error {
+	switch p.config.Type {
+	case StorageTypeS3:
+		return p.listS3(ctx, prefix, fn)
+	case StorageTypeLocal:
+		return p.listLocal(ctx, prefix, fn)
+	default:
+		return fmt.Errorf("unsupported storage type: %s", p.config.Type)
+	}
+}
+
+// listS3 lists files in S3 a page at a time
+func (p *Provider) listS3(ctx context.Context, prefix string, fn func(*FileInfo) error) error {
+	var fnErr error
+	err := p.s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(p.config.S3.Bucket),
+		Prefix: aws.String(p.s3Key(prefix)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			fnErr = fn(&FileInfo{
+				Key:     aws.StringValue(object.Key),
+				Size:    aws.Int64Value(object.Size),
+				ModTime: aws.TimeValue(object.LastModified),
+			})
+			if fnErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list files in S3: %w", err)
+	}
+	return nil
+}
+
+// CanonicalKey returns the form of a key that List reports, so keys stored
+// elsewhere can be compared with listed ones
+func (p *Provider) CanonicalKey(key string) string {
+	if p.config.Type == StorageTypeS3 {
+		return p.s3Key(key)
+	}
+	return strings.TrimPrefix(key, "/")
 }
 
 // generateURL generates a URL for the given key
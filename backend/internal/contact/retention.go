@@ -0,0 +1,31 @@
+package contact
+
+import "github.com/JadenRazo/Project-Website/backend/internal/retention"
+
+// Contact submissions contain personal data, so they are only kept long enough
+// to follow up. Spam is dropped much sooner.
+const (
+	submissionRetentionDays = 730
+	spamRetentionDays       = 30
+)
+
+// RetentionDatasets returns the contact form datasets and their retention rules
+func RetentionDatasets() []retention.Dataset {
+	return []retention.Dataset{
+		{
+			Name:        "contact.submissions",
+			Description: "Contact form submissions",
+			Table:       "contact_submissions",
+			TimeColumn:  "created_at",
+			Retention:   retention.Fixed(retention.Days(submissionRetentionDays)),
+		},
+		{
+			Name:        "contact.spam",
+			Description: "Contact form submissions flagged as spam",
+			Table:       "contact_submissions",
+			TimeColumn:  "created_at",
+			Condition:   "is_spam = true",
+			Retention:   retention.Fixed(retention.Days(spamRetentionDays)),
+		},
+	}
+}
@@ -60,6 +60,40 @@ func SendEmail(cfg *EmailConfig, msg *EmailMessage) error {
 		ReplyTo: msg.Email,
 	}
 
+	return sendResend(cfg, reqBody)
+}
+
+// Mailer sends plain text email through the configured Resend account to any
+// recipient, for services other than the contact form
+type Mailer struct {
+	cfg *EmailConfig
+}
+
+// NewMailer creates a mailer using the contact email configuration
+func NewMailer(cfg *EmailConfig) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send sends a plain text email to a single recipient
+func (m *Mailer) Send(to, subject, body string) error {
+	if m.cfg == nil || m.cfg.ResendAPIKey == "" {
+		return fmt.Errorf("email not configured")
+	}
+
+	fromAddr := m.cfg.FromEmail
+	if fromAddr == "" {
+		fromAddr = "Portfolio <onboarding@resend.dev>"
+	}
+
+	return sendResend(m.cfg, resendRequest{
+		From:    fromAddr,
+		To:      []string{to},
+		Subject: subject,
+		Text:    body,
+	})
+}
+
+func sendResend(cfg *EmailConfig, reqBody resendRequest) error {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
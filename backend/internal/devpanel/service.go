@@ -12,10 +12,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/JadenRazo/Project-Website/backend/internal/codestats"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/response"
 	"github.com/JadenRazo/Project-Website/backend/internal/core"
 	"github.com/JadenRazo/Project-Website/backend/internal/devpanel/project"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/gc"
+	msgretention "github.com/JadenRazo/Project-Website/backend/internal/messaging/retention"
 	projectservice "github.com/JadenRazo/Project-Website/backend/internal/projects/service"
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
 	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
 	"github.com/gin-gonic/gin"
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -31,6 +35,10 @@ type Service struct {
 	visitorService   *visitor.Service
 	projectService   *project.Service
 	metricsCollector *MetricsCollector
+	retentionEngine  *retention.Engine
+	attachmentGC     *gc.Collector
+	messageRetention *msgretention.Enforcer
+	codeStats        *codestats.Service
 	config           Config
 }
 
@@ -83,6 +91,26 @@ func NewService(serviceManager *core.ServiceManager, visitorService *visitor.Ser
 	}
 }
 
+// SetRetentionEngine sets the engine used for the data retention views
+func (s *Service) SetRetentionEngine(engine *retention.Engine) {
+	s.retentionEngine = engine
+}
+
+// SetAttachmentGC sets the collector used for attachment garbage collection
+func (s *Service) SetAttachmentGC(collector *gc.Collector) {
+	s.attachmentGC = collector
+}
+
+// SetMessageRetention sets the enforcer used for the channel retention views
+func (s *Service) SetMessageRetention(enforcer *msgretention.Enforcer) {
+	s.messageRetention = enforcer
+}
+
+// SetCodeStatsService sets the service used for the dependency inventory
+func (s *Service) SetCodeStatsService(codeStats *codestats.Service) {
+	s.codeStats = codeStats
+}
+
 // RegisterRoutes registers the devpanel routes
 func (s *Service) RegisterRoutes(router *gin.RouterGroup) {
 	// System overview
@@ -117,6 +145,42 @@ func (s *Service) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/visitors/realtime", s.getVisitorRealtime)
 	router.GET("/visitors/locations", s.getVisitorLocations)
 	router.GET("/visitors/breakdown", s.getVisitorBreakdown)
+	router.GET("/visitors/acquisition", s.getVisitorAcquisition)
+	router.GET("/visitors/vitals", s.getVisitorVitals)
+	router.GET("/visitors/events/top", s.getVisitorTopEvents)
+	router.GET("/visitors/events/timeline", s.getVisitorEventTimeline)
+	router.GET("/visitors/goals", s.listVisitorGoals)
+	router.POST("/visitors/goals", s.createVisitorGoal)
+	router.DELETE("/visitors/goals/:id", s.deleteVisitorGoal)
+	router.GET("/visitors/goals/:id/report", s.getVisitorGoalReport)
+	router.GET("/visitors/funnels", s.listVisitorFunnels)
+	router.POST("/visitors/funnels", s.createVisitorFunnel)
+	router.DELETE("/visitors/funnels/:id", s.deleteVisitorFunnel)
+	router.GET("/visitors/funnels/:id/report", s.getVisitorFunnelReport)
+
+	// Data subject requests
+	router.GET("/privacy/requests", s.listPrivacyRequests)
+	router.POST("/privacy/requests/:id/verify", s.verifyPrivacyRequest)
+	router.POST("/privacy/requests/:id/fulfill", s.fulfillPrivacyRequest)
+	router.POST("/privacy/requests/:id/reject", s.rejectPrivacyRequest)
+
+	// Data retention
+	router.GET("/retention/datasets", s.getRetentionDatasets)
+	router.GET("/retention/runs", s.getRetentionRuns)
+	router.POST("/retention/run", s.runRetention)
+
+	// Attachment storage
+	router.POST("/attachments/gc/run", s.runAttachmentGC)
+
+	// Message retention
+	router.GET("/messaging/retention/policies", s.getMessageRetentionPolicies)
+	router.PUT("/messaging/retention/policies/:channelId", s.setMessageRetentionPolicy)
+	router.PUT("/messaging/retention/policies/:channelId/legal-hold", s.setMessageLegalHold)
+	router.POST("/messaging/retention/run", s.runMessageRetention)
+
+	// Dependency inventory
+	router.GET("/dependencies", s.getDependencies)
+	router.GET("/dependencies/copyleft", s.getCopyleftDependencies)
 
 	// Project management
 	router.GET("/projects", s.listProjects)
@@ -0,0 +1,35 @@
+package devpanel
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/gc"
+	"github.com/gin-gonic/gin"
+)
+
+// Attachment Storage Handlers
+
+// runAttachmentGC reconciles attachment files against their records and
+// returns the report. It is a dry run that only reports what would be
+// deleted unless dry_run=false is passed explicitly.
+func (s *Service) runAttachmentGC(c *gin.Context) {
+	if s.attachmentGC == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Attachment garbage collection not available"})
+		return
+	}
+
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+
+	report, err := s.attachmentGC.Run(c.Request.Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, gc.ErrRunInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
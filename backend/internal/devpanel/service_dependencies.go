@@ -0,0 +1,54 @@
+package devpanel
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Dependency Inventory Handlers
+
+// getDependencies returns the dependency inventory of all projects, or of a
+// single project with ?project=<id>
+func (s *Service) getDependencies(c *gin.Context) {
+	if s.codeStats == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Code stats service not available"})
+		return
+	}
+
+	var projectID *uuid.UUID
+	if project := c.Query("project"); project != "" {
+		id, err := uuid.Parse(project)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID format"})
+			return
+		}
+		projectID = &id
+	}
+
+	report, err := s.codeStats.GetDependencyReport(c.Request.Context(), projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// getCopyleftDependencies lists the copyleft-licensed packages in use and
+// the projects using them, direct dependencies first
+func (s *Service) getCopyleftDependencies(c *gin.Context) {
+	if s.codeStats == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Code stats service not available"})
+		return
+	}
+
+	report, err := s.codeStats.GetDependencyReport(c.Request.Context(), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dependencies": report.Copyleft})
+}
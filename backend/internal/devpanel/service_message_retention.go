@@ -0,0 +1,128 @@
+package devpanel
+
+import (
+	"errors"
+	"net/http"
+
+	msgretention "github.com/JadenRazo/Project-Website/backend/internal/messaging/retention"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Message Retention Handlers
+
+// getMessageRetentionPolicies lists the channel retention policies and the
+// server-wide default they override
+func (s *Service) getMessageRetentionPolicies(c *gin.Context) {
+	if s.messageRetention == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Message retention not available"})
+		return
+	}
+
+	policies, err := s.messageRetention.Policies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"defaultDays": s.messageRetention.DefaultDays(),
+		"mode":        s.messageRetention.Mode(),
+		"policies":    policies,
+	})
+}
+
+// setMessageRetentionPolicy sets how long a channel keeps its messages: a
+// number of days, 0 for the server-wide default or -1 for forever
+func (s *Service) setMessageRetentionPolicy(c *gin.Context) {
+	if s.messageRetention == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Message retention not available"})
+		return
+	}
+	channelID, ok := parseRetentionChannelID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		RetentionDays *int `json:"retentionDays" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || *body.RetentionDays < msgretention.KeepForever {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retentionDays must be a number of days, 0 or -1"})
+		return
+	}
+
+	policy, err := s.messageRetention.SetRetention(c.Request.Context(), channelID, *body.RetentionDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// setMessageLegalHold places a channel under legal hold or releases it
+func (s *Service) setMessageLegalHold(c *gin.Context) {
+	if s.messageRetention == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Message retention not available"})
+		return
+	}
+	channelID, ok := parseRetentionChannelID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		LegalHold *bool  `json:"legalHold" binding:"required"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "legalHold is required"})
+		return
+	}
+	if *body.LegalHold && body.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to place a legal hold"})
+		return
+	}
+
+	policy, err := s.messageRetention.SetLegalHold(c.Request.Context(), channelID, *body.LegalHold, body.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// runMessageRetention applies the channel retention policies. It is a dry
+// run that only counts expired messages unless dry_run=false is passed
+// explicitly.
+func (s *Service) runMessageRetention(c *gin.Context) {
+	if s.messageRetention == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Message retention not available"})
+		return
+	}
+
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+
+	report, err := s.messageRetention.Run(c.Request.Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, msgretention.ErrRunInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func parseRetentionChannelID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("channelId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid channel ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,110 @@
+package devpanel
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Privacy Request Handlers
+
+// listPrivacyRequests returns data subject requests ordered by deadline
+func (s *Service) listPrivacyRequests(c *gin.Context) {
+	requests, err := s.visitorService.PrivacyRequests().List(
+		c.Request.Context(),
+		c.Query("status"),
+		c.Query("overdue") == "true",
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+// verifyPrivacyRequest marks a request verified after an out-of-band
+// identity check
+func (s *Service) verifyPrivacyRequest(c *gin.Context) {
+	id, ok := parsePrivacyRequestID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Note string `json:"note" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A note describing the identity check is required"})
+		return
+	}
+
+	if err := s.visitorService.PrivacyRequests().AdminVerify(c.Request.Context(), id, body.Note); err != nil {
+		sendPrivacyRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Request verified"})
+}
+
+// fulfillPrivacyRequest processes a verified request immediately instead of
+// waiting for the worker
+func (s *Service) fulfillPrivacyRequest(c *gin.Context) {
+	id, ok := parsePrivacyRequestID(c)
+	if !ok {
+		return
+	}
+
+	if err := s.visitorService.PrivacyRequests().Fulfill(c.Request.Context(), id); err != nil {
+		sendPrivacyRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Request fulfilled"})
+}
+
+// rejectPrivacyRequest closes a request without fulfilling it
+func (s *Service) rejectPrivacyRequest(c *gin.Context) {
+	id, ok := parsePrivacyRequestID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A rejection reason is required"})
+		return
+	}
+
+	if err := s.visitorService.PrivacyRequests().Reject(c.Request.Context(), id, body.Reason); err != nil {
+		sendPrivacyRequestError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Request rejected"})
+}
+
+func parsePrivacyRequestID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func sendPrivacyRequestError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, visitor.ErrPrivacyRequestNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, visitor.ErrPrivacyRequestState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,63 @@
+package devpanel
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
+	"github.com/gin-gonic/gin"
+)
+
+// Data Retention Handlers
+
+// getRetentionDatasets lists every registered dataset and its retention rule
+func (s *Service) getRetentionDatasets(c *gin.Context) {
+	if s.retentionEngine == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Retention engine not available"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"datasets": s.retentionEngine.Datasets()})
+}
+
+// getRetentionRuns returns the audit records of recent retention runs
+func (s *Service) getRetentionRuns(c *gin.Context) {
+	if s.retentionEngine == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Retention engine not available"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	runs, err := s.retentionEngine.ListRuns(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+// runRetention triggers a retention run. It is a dry run that only counts
+// expired rows unless dry_run=false is passed explicitly.
+func (s *Service) runRetention(c *gin.Context) {
+	if s.retentionEngine == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Retention engine not available"})
+		return
+	}
+
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+
+	run, err := s.retentionEngine.Run(c.Request.Context(), dryRun, "devpanel")
+	if err != nil {
+		if errors.Is(err, retention.ErrRunInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,223 @@
+package devpanel
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Visitor Event Handlers
+
+// getVisitorTopEvents returns the most frequent custom events
+func (s *Service) getVisitorTopEvents(c *gin.Context) {
+	period := c.DefaultQuery("period", "7d")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	events, err := s.visitorService.GetTopEvents(c.Request.Context(), period, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period": period,
+		"events": events,
+	})
+}
+
+// getVisitorEventTimeline returns custom event counts over time
+func (s *Service) getVisitorEventTimeline(c *gin.Context) {
+	period := c.DefaultQuery("period", "7d")
+	name := c.Query("name")
+
+	data, err := s.visitorService.GetEventTimeline(c.Request.Context(), period, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period": period,
+		"name":   name,
+		"data":   data,
+	})
+}
+
+// getVisitorAcquisition returns the channel, source and campaign breakdown
+func (s *Service) getVisitorAcquisition(c *gin.Context) {
+	period := c.DefaultQuery("period", "30d")
+
+	report, err := s.visitorService.GetAcquisitionReport(c.Request.Context(), period)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// getVisitorVitals returns web vitals percentiles by page with week-over-week
+// regressions
+func (s *Service) getVisitorVitals(c *gin.Context) {
+	report, err := s.visitorService.GetWebVitalsReport(c.Request.Context(), c.Query("device"))
+	if err != nil {
+		if errors.Is(err, visitor.ErrInvalidDevice) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// Visitor Goal and Funnel Handlers
+
+// listVisitorGoals returns all configured conversion goals
+func (s *Service) listVisitorGoals(c *gin.Context) {
+	goals, err := s.visitorService.ListGoals(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"goals": goals})
+}
+
+// createVisitorGoal creates a new conversion goal
+func (s *Service) createVisitorGoal(c *gin.Context) {
+	var goal visitor.Goal
+	if err := c.ShouldBindJSON(&goal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.visitorService.CreateGoal(c.Request.Context(), &goal); err != nil {
+		if errors.Is(err, visitor.ErrInvalidGoal) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, goal)
+}
+
+// deleteVisitorGoal deletes a goal and its precomputed conversions
+func (s *Service) deleteVisitorGoal(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal ID"})
+		return
+	}
+
+	if err := s.visitorService.DeleteGoal(c.Request.Context(), id); err != nil {
+		if errors.Is(err, visitor.ErrGoalNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Goal deleted successfully"})
+}
+
+// getVisitorGoalReport returns conversions for a goal over a period
+func (s *Service) getVisitorGoalReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid goal ID"})
+		return
+	}
+
+	report, err := s.visitorService.GetGoalReport(c.Request.Context(), id, c.DefaultQuery("period", "30d"))
+	if err != nil {
+		if errors.Is(err, visitor.ErrGoalNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// listVisitorFunnels returns all configured funnels
+func (s *Service) listVisitorFunnels(c *gin.Context) {
+	funnels, err := s.visitorService.ListFunnels(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"funnels": funnels})
+}
+
+// createVisitorFunnel creates a new multi-step funnel
+func (s *Service) createVisitorFunnel(c *gin.Context) {
+	var funnel visitor.Funnel
+	if err := c.ShouldBindJSON(&funnel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.visitorService.CreateFunnel(c.Request.Context(), &funnel); err != nil {
+		if errors.Is(err, visitor.ErrInvalidFunnel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, funnel)
+}
+
+// deleteVisitorFunnel deletes a funnel and its precomputed results
+func (s *Service) deleteVisitorFunnel(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid funnel ID"})
+		return
+	}
+
+	if err := s.visitorService.DeleteFunnel(c.Request.Context(), id); err != nil {
+		if errors.Is(err, visitor.ErrFunnelNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Funnel deleted successfully"})
+}
+
+// getVisitorFunnelReport returns per-step drop-off for a funnel over a period
+func (s *Service) getVisitorFunnelReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid funnel ID"})
+		return
+	}
+
+	report, err := s.visitorService.GetFunnelReport(c.Request.Context(), id, c.DefaultQuery("period", "30d"))
+	if err != nil {
+		if errors.Is(err, visitor.ErrFunnelNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
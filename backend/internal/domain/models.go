@@ -67,6 +67,22 @@ type Attachment struct {
 	IsImage   bool   `gorm:"default:false" json:"isImage"`
 	Thumbnail string `json:"thumbnail,omitempty"`
 
+	// StorageKey identifies the file in storage; FileURL is derived from it
+	StorageKey string `json:"-"`
+
+	// Image details, filled in by the image processing job
+	Width            int    `json:"width,omitempty"`
+	Height           int    `json:"height,omitempty"`
+	Preview          string `json:"preview,omitempty"` // Larger thumbnail
+	Blurhash         string `json:"blurhash,omitempty"`
+	ThumbnailKey     string `json:"-"`
+	PreviewKey       string `json:"-"`
+	ProcessingStatus string `gorm:"default:complete" json:"processingStatus,omitempty"` // processing, complete, failed
+
+	// Uploads are quarantined until scanned; blocked files are never published
+	ScanStatus    string `gorm:"default:clean" json:"scanStatus,omitempty"` // pending, clean, blocked, failed
+	ScanSignature string `json:"-"`
+
 	// Relations
 	Message Message `gorm:"foreignKey:MessageID" json:"-"`
 }
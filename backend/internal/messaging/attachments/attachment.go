@@ -0,0 +1,75 @@
+package attachments
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// Attachment is a file attached to a message, stored in
+// messaging_attachments. Its URLs point at the attachment routes of
+// Handler, which check access and redirect to short-lived signed URLs, so
+// they stay valid for as long as the attachment exists.
+type Attachment struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	MessageID  uuid.UUID `gorm:"type:uuid;not null" json:"message_id"`
+	UploadedBy uuid.UUID `gorm:"type:uuid" json:"uploaded_by"`
+	FileName   string    `gorm:"not null" json:"file_name"`
+	FileType   string    `gorm:"column:mime_type" json:"file_type"`
+	FileSize   int64     `json:"file_size"`
+	FileURL    string    `gorm:"not null" json:"file_url"`
+
+	// StorageKey identifies the file in storage
+	StorageKey string `json:"-"`
+
+	// Image details, filled in by the image processing job
+	Width            int    `json:"width,omitempty"`
+	Height           int    `json:"height,omitempty"`
+	Blurhash         string `json:"blurhash,omitempty"`
+	ThumbnailURL     string `json:"thumbnail_url,omitempty"`
+	PreviewURL       string `json:"preview_url,omitempty"` // Larger thumbnail
+	ThumbnailKey     string `json:"-"`
+	PreviewKey       string `json:"-"`
+	ProcessingStatus string `json:"processing_status,omitempty"` // processing, complete, failed
+
+	// Uploads are quarantined until scanned; blocked files are never published
+	ScanStatus    string `json:"scan_status"` // pending, clean, blocked, failed
+	ScanSignature string `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table attachments are stored in
+func (Attachment) TableName() string { return "messaging_attachments" }
+
+// IsImage reports whether the attachment is an image
+func (a *Attachment) IsImage() bool {
+	return strings.HasPrefix(a.FileType, "image/")
+}
+
+// Available reports whether the attachment's file may be downloaded: it
+// has been scanned clean and, for images, stripped of its metadata
+func (a *Attachment) Available() bool {
+	if a.ScanStatus != ScanStatusClean {
+		return false
+	}
+	return !a.IsImage() || a.ProcessingStatus == ProcessingStatusComplete
+}
+
+// Domain returns the attachment as the messaging API presents it
+func (a *Attachment) Domain() *domain.Attachment {
+	return &domain.Attachment{
+		ID:           a.ID,
+		MessageID:    a.MessageID,
+		UserID:       a.UploadedBy,
+		FileName:     a.FileName,
+		FileSize:     a.FileSize,
+		FileType:     a.FileType,
+		FileURL:      a.FileURL,
+		ThumbnailURL: a.ThumbnailURL,
+		CreatedAt:    a.CreatedAt,
+	}
+}
@@ -0,0 +1,371 @@
+// Package gc removes attachment files nothing refers to any more. It
+// reconciles stored files against the records in messaging_attachments in
+// both directions: files without a record are deleted, and records whose
+// file is gone are removed. Files of attachments whose message was deleted
+// by its author are deleted with their records; retention deletes the
+// records itself, which leaves their files without one.
+package gc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/metrics"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultGracePeriod protects files and records younger than it, so
+	// uploads in progress are not mistaken for orphans
+	DefaultGracePeriod = 24 * time.Hour
+
+	// DefaultBatchSize is the number of records loaded at a time
+	DefaultBatchSize = 500
+
+	// reportSampleSize caps how many items of each kind a report lists
+	reportSampleSize = 100
+)
+
+// DefaultPrefixes are the storage prefixes attachment files are kept under
+var DefaultPrefixes = []string{attachments.KeyPrefix, uploads.KeyPrefix}
+
+// ErrRunInProgress is returned when a collection is already running
+var ErrRunInProgress = errors.New("attachment garbage collection already in progress")
+
+// Options configures a Collector
+type Options struct {
+	// Prefixes are the storage prefixes holding attachment files. Files
+	// elsewhere are never touched.
+	Prefixes    []string
+	GracePeriod time.Duration
+	BatchSize   int
+}
+
+// OrphanedFile is a stored file no record refers to
+type OrphanedFile struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// MissingFile is an attachment whose file is not in storage
+type MissingFile struct {
+	AttachmentID uuid.UUID `json:"attachmentId"`
+	Key          string    `json:"key"`
+}
+
+// Report records what a collection found and, unless it was a dry run,
+// removed. The item lists are samples capped at 100 entries; the counts
+// are complete.
+type Report struct {
+	DryRun     bool      `json:"dryRun"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Cutoff     time.Time `json:"cutoff"`
+
+	ListedFiles    int `json:"listedFiles"`
+	ReferencedKeys int `json:"referencedKeys"`
+
+	// Attachments of deleted messages, whose files and records are removed
+	PurgedAttachments   int         `json:"purgedAttachments"`
+	PurgedAttachmentIDs []uuid.UUID `json:"purgedAttachmentIds,omitempty"`
+
+	OrphanedFiles       int            `json:"orphanedFiles"`
+	OrphanedBytes       int64          `json:"orphanedBytes"`
+	OrphanedFileSamples []OrphanedFile `json:"orphanedFileSamples,omitempty"`
+
+	MissingFiles       int           `json:"missingFiles"`
+	MissingFileSamples []MissingFile `json:"missingFileSamples,omitempty"`
+
+	// ReclaimedBytes is the storage freed, or that would be freed
+	ReclaimedBytes int64    `json:"reclaimedBytes"`
+	Errors         []string `json:"errors,omitempty"`
+}
+
+func (r *Report) addError(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+// Collector garbage collects attachment files
+type Collector struct {
+	db      *gorm.DB
+	storage *storage.Provider
+	options Options
+	running sync.Mutex
+}
+
+// NewCollector creates a new collector
+func NewCollector(db *gorm.DB, provider *storage.Provider, options Options) *Collector {
+	if len(options.Prefixes) == 0 {
+		options.Prefixes = DefaultPrefixes
+	}
+	if options.GracePeriod <= 0 {
+		options.GracePeriod = DefaultGracePeriod
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+
+	return &Collector{
+		db:      db,
+		storage: provider,
+		options: options,
+	}
+}
+
+// Run collects garbage. In dry-run mode nothing is deleted and the report
+// lists what would be. Failures to delete single files are recorded in the
+// report and retried by the next run; an error is returned when a run
+// could not complete, in which case storage is left as it was found for
+// the steps that did not run.
+func (c *Collector) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	if !c.running.TryLock() {
+		return nil, ErrRunInProgress
+	}
+	defer c.running.Unlock()
+
+	now := time.Now()
+	report := &Report{
+		DryRun:    dryRun,
+		StartedAt: now,
+		Cutoff:    now.Add(-c.options.GracePeriod),
+	}
+
+	err := c.run(ctx, report)
+	report.FinishedAt = time.Now()
+
+	metrics.RecordAttachmentGC(metrics.AttachmentGCStats{
+		DryRun:            dryRun,
+		Failed:            err != nil,
+		OrphanedFiles:     report.OrphanedFiles,
+		MissingFiles:      report.MissingFiles,
+		PurgedAttachments: report.PurgedAttachments,
+		ReclaimedBytes:    report.ReclaimedBytes,
+		Duration:          report.FinishedAt.Sub(report.StartedAt),
+	})
+	return report, err
+}
+
+func (c *Collector) run(ctx context.Context, report *Report) error {
+	if err := c.purgeRemoved(ctx, report); err != nil {
+		return err
+	}
+
+	// Records are read before storage is listed: a file stored after the
+	// records were read is younger than the cutoff and so never orphaned
+	referenced, err := c.referencedKeys(ctx)
+	if err != nil {
+		return err
+	}
+	report.ReferencedKeys = len(referenced)
+
+	listed := make(map[string]struct{})
+	var orphans []OrphanedFile
+	for _, prefix := range c.options.Prefixes {
+		err := c.storage.List(ctx, prefix, func(info *storage.FileInfo) error {
+			listed[info.Key] = struct{}{}
+			if _, ok := referenced[info.Key]; !ok && info.ModTime.Before(report.Cutoff) {
+				orphans = append(orphans, OrphanedFile{Key: info.Key, Size: info.Size, ModTime: info.ModTime})
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+	}
+	report.ListedFiles = len(listed)
+
+	c.deleteOrphans(ctx, report, orphans)
+	return c.removeMissing(ctx, report, listed)
+}
+
+// purgeRemoved deletes the files and records of attachments whose message
+// was deleted or no longer exists
+func (c *Collector) purgeRemoved(ctx context.Context, report *Report) error {
+	var lastID uuid.UUID
+	for {
+		var batch []attachments.Attachment
+		err := c.db.WithContext(ctx).
+			Select("messaging_attachments.*").
+			Joins("LEFT JOIN messaging_messages m ON m.id = messaging_attachments.message_id").
+			Where("messaging_attachments.id > ?", lastID).
+			Where(`messaging_attachments.created_at < ?
+				AND (m.id IS NULL OR (m.is_deleted AND m.deleted_at < ?))`,
+				report.Cutoff, report.Cutoff).
+			Order("messaging_attachments.id").
+			Limit(c.options.BatchSize).
+			Find(&batch).Error
+		if err != nil {
+			return fmt.Errorf("failed to find removed attachments: %w", err)
+		}
+
+		for i := range batch {
+			attachment := &batch[i]
+			lastID = attachment.ID
+
+			if !report.DryRun {
+				if !c.deleteKeys(ctx, report, attachmentKeys(attachment)) {
+					continue
+				}
+				if err := c.db.WithContext(ctx).Delete(&attachments.Attachment{}, "id = ?", attachment.ID).Error; err != nil {
+					report.addError("failed to delete attachment %s: %v", attachment.ID, err)
+					continue
+				}
+			}
+
+			report.PurgedAttachments++
+			report.ReclaimedBytes += attachment.FileSize
+			if len(report.PurgedAttachmentIDs) < reportSampleSize {
+				report.PurgedAttachmentIDs = append(report.PurgedAttachmentIDs, attachment.ID)
+			}
+		}
+
+		if len(batch) < c.options.BatchSize {
+			return nil
+		}
+	}
+}
+
+// referencedKeys returns the canonical keys of every file a record refers
+// to, including uploads in progress
+func (c *Collector) referencedKeys(ctx context.Context) (map[string]struct{}, error) {
+	referenced := make(map[string]struct{})
+	add := func(keys ...string) {
+		for _, key := range keys {
+			if key != "" {
+				referenced[c.storage.CanonicalKey(key)] = struct{}{}
+			}
+		}
+	}
+
+	var stored []attachments.Attachment
+	err := c.db.WithContext(ctx).
+		Select("id", "storage_key", "thumbnail_key", "preview_key").
+		FindInBatches(&stored, c.options.BatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range stored {
+				add(attachmentKeys(&stored[i])...)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attachment keys: %w", err)
+	}
+
+	var pending []uploads.Upload
+	err = c.db.WithContext(ctx).
+		Select("id", "storage_key", "tail_size").
+		FindInBatches(&pending, c.options.BatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range pending {
+				add(pending[i].StorageKey)
+				if pending[i].TailSize > 0 {
+					add(pending[i].TailKey())
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload keys: %w", err)
+	}
+
+	return referenced, nil
+}
+
+// deleteOrphans deletes files no record refers to
+func (c *Collector) deleteOrphans(ctx context.Context, report *Report, orphans []OrphanedFile) {
+	for _, orphan := range orphans {
+		if !report.DryRun {
+			if err := c.storage.Delete(ctx, orphan.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				report.addError("failed to delete orphaned file %s: %v", orphan.Key, err)
+				continue
+			}
+		}
+
+		report.OrphanedFiles++
+		report.OrphanedBytes += orphan.Size
+		report.ReclaimedBytes += orphan.Size
+		if len(report.OrphanedFileSamples) < reportSampleSize {
+			report.OrphanedFileSamples = append(report.OrphanedFileSamples, orphan)
+		}
+	}
+}
+
+// removeMissing deletes the records of attachments whose file is gone.
+// Blocked attachments lost their file on purpose and are kept.
+func (c *Collector) removeMissing(ctx context.Context, report *Report, listed map[string]struct{}) error {
+	var stored []attachments.Attachment
+	err := c.db.WithContext(ctx).
+		Where("storage_key <> '' AND created_at < ? AND scan_status <> ?", report.Cutoff, attachments.ScanStatusBlocked).
+		FindInBatches(&stored, c.options.BatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range stored {
+				attachment := &stored[i]
+				key := c.storage.CanonicalKey(attachment.StorageKey)
+				if !c.managed(key) {
+					continue
+				}
+				if _, ok := listed[key]; ok {
+					continue
+				}
+
+				if !report.DryRun {
+					if err := c.db.WithContext(ctx).Delete(&attachments.Attachment{}, "id = ?", attachment.ID).Error; err != nil {
+						report.addError("failed to delete attachment %s: %v", attachment.ID, err)
+						continue
+					}
+				}
+
+				report.MissingFiles++
+				if len(report.MissingFileSamples) < reportSampleSize {
+					report.MissingFileSamples = append(report.MissingFileSamples, MissingFile{AttachmentID: attachment.ID, Key: key})
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to check attachment files: %w", err)
+	}
+	return nil
+}
+
+// managed reports whether a canonical key lies under one of the prefixes,
+// so its absence from the listing means the file is gone
+func (c *Collector) managed(key string) bool {
+	for _, prefix := range c.options.Prefixes {
+		if strings.HasPrefix(key, c.storage.CanonicalKey(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteKeys deletes stored files, reporting whether all of them are gone
+func (c *Collector) deleteKeys(ctx context.Context, report *Report, keys []string) bool {
+	deleted := true
+	for _, key := range keys {
+		if err := c.storage.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to delete attachment file %s: %v", key, err)
+			report.addError("failed to delete file %s: %v", key, err)
+			deleted = false
+		}
+	}
+	return deleted
+}
+
+// attachmentKeys returns the keys of an attachment's file and thumbnails
+func attachmentKeys(attachment *attachments.Attachment) []string {
+	keys := make([]string, 0, 3)
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey, attachment.PreviewKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,263 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/retention"
+)
+
+// schema is the part of the messaging schema the collector and retention
+// touch, besides the attachment and upload tables
+var schema = []string{
+	`CREATE TABLE messaging_channels (id TEXT PRIMARY KEY, name TEXT)`,
+	`CREATE TABLE messaging_messages (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, parent_id TEXT, content TEXT,
+		is_edited BOOLEAN DEFAULT false, edited_at DATETIME, is_deleted BOOLEAN DEFAULT false,
+		deleted_at DATETIME, created_at DATETIME)`,
+	`CREATE TABLE messaging_reactions (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_pinned_messages (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_embeds (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_read_receipts (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, last_message_id TEXT)`,
+}
+
+type testEnv struct {
+	db      *gorm.DB
+	storage *storage.Provider
+	channel uuid.UUID
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger:                                   gormlogger.Default.LogMode(gormlogger.Silent),
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	for _, statement := range schema {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	require.NoError(t, db.AutoMigrate(&attachments.Attachment{}, &uploads.Upload{}, &retention.Policy{}))
+	channel := uuid.New()
+	require.NoError(t, db.Exec("INSERT INTO messaging_channels (id, name) VALUES (?, ?)", channel, "general").Error)
+
+	provider, err := storage.NewProvider(&storage.Config{
+		Type:       storage.StorageTypeLocal,
+		BasePath:   t.TempDir(),
+		BaseURL:    "http://localhost:8080/files",
+		SigningKey: "test-signing-key",
+	})
+	require.NoError(t, err)
+
+	return &testEnv{db: db, storage: provider, channel: channel}
+}
+
+func (e *testEnv) store(t *testing.T, key string) {
+	t.Helper()
+	_, err := e.storage.Upload(context.Background(), key, strings.NewReader("data of "+key), "text/plain")
+	require.NoError(t, err)
+}
+
+func (e *testEnv) exists(t *testing.T, key string) bool {
+	t.Helper()
+	reader, _, err := e.storage.Download(context.Background(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	require.NoError(t, err)
+	reader.Close()
+	return true
+}
+
+// message creates a message sent the given number of days ago, deleted by
+// its author if deleted is set
+func (e *testEnv) message(t *testing.T, age int, deleted bool) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	createdAt := time.Now().AddDate(0, 0, -age)
+	require.NoError(t, e.db.Exec(
+		"INSERT INTO messaging_messages (id, channel_id, user_id, content, created_at) VALUES (?, ?, ?, ?, ?)",
+		id, e.channel, uuid.New(), "hello", createdAt,
+	).Error)
+	if deleted {
+		require.NoError(t, e.db.Exec("UPDATE messaging_messages SET is_deleted = ?, deleted_at = ? WHERE id = ?",
+			true, time.Now().Add(-time.Hour), id).Error)
+	}
+	return id
+}
+
+func (e *testEnv) attachment(t *testing.T, messageID uuid.UUID, key string, scanStatus string) *attachments.Attachment {
+	t.Helper()
+	attachment := &attachments.Attachment{
+		ID:         uuid.New(),
+		FileName:   key,
+		FileType:   "text/plain",
+		FileSize:   int64(len("data of " + key)),
+		FileURL:    attachments.DefaultURLPrefix + "/" + key,
+		MessageID:  messageID,
+		StorageKey: key,
+		ScanStatus: scanStatus,
+		CreatedAt:  time.Now().Add(-48 * time.Hour),
+	}
+	require.NoError(t, e.db.Create(attachment).Error)
+	return attachment
+}
+
+func (e *testEnv) attachmentIDs(t *testing.T) []uuid.UUID {
+	t.Helper()
+	var ids []uuid.UUID
+	require.NoError(t, e.db.Model(&attachments.Attachment{}).Order("created_at, file_name").Pluck("id", &ids).Error)
+	return ids
+}
+
+func TestCollectorReconciles(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	live := env.message(t, 2, false)
+	removed := env.message(t, 2, true)
+
+	env.store(t, "attachments/kept.txt")
+	kept := env.attachment(t, live, "attachments/kept.txt", "clean")
+
+	env.store(t, "attachments/removed.txt")
+	env.store(t, "attachments/removed-thumb.jpg")
+	purged := env.attachment(t, removed, "attachments/removed.txt", "clean")
+	require.NoError(t, env.db.Model(purged).Update("thumbnail_key", "attachments/removed-thumb.jpg").Error)
+
+	missing := env.attachment(t, live, "attachments/missing.txt", "clean")
+	blocked := env.attachment(t, live, "attachments/blocked.txt", "blocked")
+
+	upload := &uploads.Upload{ID: uuid.New(), UserID: uuid.New(), ChannelID: uuid.New(), FileName: "big.bin", Length: 100, TailSize: 3, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, env.db.Create(upload).Error)
+	env.store(t, upload.TailKey())
+
+	env.store(t, "attachments/orphan.txt")
+	env.store(t, "avatars/unmanaged.png")
+
+	collector := NewCollector(env.db, env.storage, Options{GracePeriod: time.Nanosecond, BatchSize: 2})
+
+	t.Run("dry run", func(t *testing.T) {
+		report, err := collector.Run(ctx, true)
+		require.NoError(t, err)
+
+		assert.True(t, report.DryRun)
+		assert.Equal(t, 1, report.PurgedAttachments)
+		assert.Equal(t, []uuid.UUID{purged.ID}, report.PurgedAttachmentIDs)
+		assert.Equal(t, 1, report.OrphanedFiles)
+		require.Len(t, report.OrphanedFileSamples, 1)
+		assert.Equal(t, "attachments/orphan.txt", report.OrphanedFileSamples[0].Key)
+		assert.Equal(t, 1, report.MissingFiles)
+		assert.Equal(t, []MissingFile{{AttachmentID: missing.ID, Key: "attachments/missing.txt"}}, report.MissingFileSamples)
+		assert.Equal(t, purged.FileSize+report.OrphanedBytes, report.ReclaimedBytes)
+		assert.Empty(t, report.Errors)
+
+		for _, key := range []string{"attachments/removed.txt", "attachments/removed-thumb.jpg", "attachments/orphan.txt"} {
+			assert.True(t, env.exists(t, key), key)
+		}
+		assert.Len(t, env.attachmentIDs(t), 4)
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		report, err := collector.Run(ctx, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.PurgedAttachments)
+		assert.Equal(t, 1, report.OrphanedFiles)
+		assert.Equal(t, 1, report.MissingFiles)
+
+		for _, key := range []string{"attachments/removed.txt", "attachments/removed-thumb.jpg", "attachments/orphan.txt"} {
+			assert.False(t, env.exists(t, key), key)
+		}
+		for _, key := range []string{"attachments/kept.txt", "avatars/unmanaged.png", upload.TailKey()} {
+			assert.True(t, env.exists(t, key), key)
+		}
+
+		assert.ElementsMatch(t, []uuid.UUID{kept.ID, blocked.ID}, env.attachmentIDs(t),
+			"attachments of removed messages, and without a file unless blocked, are deleted")
+		assert.NotContains(t, env.attachmentIDs(t), missing.ID)
+	})
+
+	t.Run("nothing left on the next run", func(t *testing.T) {
+		report, err := collector.Run(ctx, false)
+		require.NoError(t, err)
+		assert.Zero(t, report.PurgedAttachments)
+		assert.Zero(t, report.OrphanedFiles)
+		assert.Zero(t, report.MissingFiles)
+	})
+}
+
+func TestCollectorRemovesFilesOfExpiredMessages(t *testing.T) {
+	for _, mode := range []string{retention.ModeTombstone, retention.ModeDelete} {
+		t.Run(mode, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+
+			expired := env.message(t, 40, false)
+			env.store(t, "attachments/expired.txt")
+			env.attachment(t, expired, "attachments/expired.txt", "clean")
+
+			current := env.message(t, 2, false)
+			env.store(t, "attachments/current.txt")
+			env.attachment(t, current, "attachments/current.txt", "clean")
+
+			enforcer, err := retention.NewEnforcer(env.db, retention.Options{DefaultDays: 30, Mode: mode, BatchPause: -1})
+			require.NoError(t, err)
+			result, err := enforcer.Run(ctx, false)
+			require.NoError(t, err)
+			require.EqualValues(t, 1, result.Messages)
+			assert.True(t, env.exists(t, "attachments/expired.txt"), "retention leaves files to the collector")
+
+			report, err := NewCollector(env.db, env.storage, Options{GracePeriod: time.Nanosecond}).Run(ctx, false)
+			require.NoError(t, err)
+			assert.Empty(t, report.Errors)
+			assert.Equal(t, 1, report.OrphanedFiles)
+			assert.False(t, env.exists(t, "attachments/expired.txt"))
+			assert.True(t, env.exists(t, "attachments/current.txt"))
+		})
+	}
+}
+
+func TestCollectorGracePeriod(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	env.store(t, "attachments/fresh.txt")
+
+	message := env.message(t, 2, false)
+	recent := env.attachment(t, message, "attachments/recent.txt", "clean")
+	require.NoError(t, env.db.Model(recent).Update("created_at", time.Now()).Error)
+
+	report, err := NewCollector(env.db, env.storage, Options{}).Run(ctx, false)
+	require.NoError(t, err)
+	assert.Zero(t, report.OrphanedFiles, "files younger than the grace period are kept")
+	assert.Zero(t, report.MissingFiles, "records younger than the grace period are kept")
+	assert.Equal(t, 1, report.ListedFiles)
+	assert.True(t, env.exists(t, "attachments/fresh.txt"))
+}
+
+func TestCollectorRejectsConcurrentRuns(t *testing.T) {
+	env := newTestEnv(t)
+	collector := NewCollector(env.db, env.storage, Options{})
+
+	collector.running.Lock()
+	_, err := collector.Run(context.Background(), true)
+	collector.running.Unlock()
+	assert.ErrorIs(t, err, ErrRunInProgress)
+}
@@ -0,0 +1,136 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Thumbnails of image attachments that can be downloaded besides the file
+const (
+	VariantThumbnail = "thumbnail"
+	VariantPreview   = "preview"
+)
+
+// fileURL returns the URL an attachment's file, or one of its thumbnails,
+// is downloaded from
+func (s *AttachmentService) fileURL(attachmentID uuid.UUID, variant string) string {
+	url := s.urlPrefix + "/" + attachmentID.String()
+	if variant != "" {
+		url += "/" + variant
+	}
+	return url
+}
+
+// DownloadURL returns a signed URL of an attachment's file, or of one of
+// its thumbnails, for a member of the channel it was sent in. Files are
+// only handed out once they are available.
+func (s *AttachmentService) DownloadURL(ctx context.Context, attachmentID uuid.UUID, userID uuid.UUID, variant string) (string, error) {
+	attachment, err := s.repo.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return "", err
+	}
+	allowed, err := s.repo.CanAccess(ctx, attachmentID, userID)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		// Attachments of other channels are not disclosed
+		return "", ErrAttachmentNotFound
+	}
+	if !attachment.Available() {
+		return "", ErrUnavailable
+	}
+
+	var key string
+	switch variant {
+	case "":
+		key = attachment.StorageKey
+	case VariantThumbnail:
+		key = attachment.ThumbnailKey
+	case VariantPreview:
+		key = attachment.PreviewKey
+	}
+	if key == "" {
+		return "", ErrAttachmentNotFound
+	}
+	return s.storage.SignedURL(ctx, key, downloadURLExpiry)
+}
+
+// Handler serves the attachment URLs, redirecting members of the channel
+// an attachment was sent in to a short-lived signed URL of its file
+type Handler struct {
+	service *AttachmentService
+}
+
+// NewHandler creates a new attachment handler
+func NewHandler(service *AttachmentService) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers the attachment routes. The group must
+// authenticate the user and set "user_id", and be mounted on the path the
+// service's URL prefix names.
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
+	attachments := router.Group("/attachments")
+	{
+		attachments.GET("/:id", h.Download)
+		attachments.GET("/:id/:variant", h.Download)
+	}
+}
+
+// Download redirects to a signed URL of an attachment's file
+func (h *Handler) Download(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	variant := c.Param("variant")
+	if variant != "" && variant != VariantThumbnail && variant != VariantPreview {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	url, err := h.service.DownloadURL(c.Request.Context(), id, userID, variant)
+	switch {
+	case err == nil:
+		// The signed URL expires, so the redirect must not be cached
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, url)
+	case errors.Is(err, ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+	case errors.Is(err, ErrUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment is not available"})
+	default:
+		log.Printf("Attachment download failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to download attachment"})
+	}
+}
+
+func requireUserID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("user_id")
+	if exists {
+		switch id := value.(type) {
+		case uuid.UUID:
+			if id != uuid.Nil {
+				return id, true
+			}
+		case string:
+			if parsed, err := uuid.Parse(id); err == nil {
+				return parsed, true
+			}
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	return uuid.Nil, false
+}
@@ -0,0 +1,114 @@
+package imaging
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// base83 is the blurhash alphabet
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes an image as a blurhash (https://blurha.sh), a short
+// string clients decode into a blurred placeholder while the image loads.
+// componentsX and componentsY, between 1 and 9, set how much detail it keeps.
+func Blurhash(img *image.RGBA, componentsX, componentsY int) string {
+	componentsX = min(max(componentsX, 1), 9)
+	componentsY = min(max(componentsY, 1), 9)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// Convert once; every component sums over all pixels
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := img.PixOffset(x, y)
+			linear[y*width+x] = [3]float64{
+				srgbToLinear(img.Pix[offset]),
+				srgbToLinear(img.Pix[offset+1]),
+				srgbToLinear(img.Pix[offset+2]),
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := basisY * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	encode83(&hash, (componentsX-1)+(componentsY-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(factor[0]), math.Max(math.Abs(factor[1]), math.Abs(factor[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		encode83(&hash, quantisedMax, 1)
+	} else {
+		encode83(&hash, 0, 1)
+	}
+
+	encode83(&hash, linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4)
+	for _, factor := range ac {
+		quantise := func(value float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(value/maxValue, 0.5)*9+9.5))))
+		}
+		encode83(&hash, quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2)
+	}
+
+	return hash.String()
+}
+
+func encode83(hash *strings.Builder, value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		divisor := 1
+		for k := 0; k < i; k++ {
+			divisor *= 83
+		}
+		hash.WriteByte(base83[(value/divisor)%83])
+	}
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
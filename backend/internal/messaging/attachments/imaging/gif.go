@@ -0,0 +1,71 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errTruncatedGIF is returned for GIFs that end within a block
+var errTruncatedGIF = errors.New("gif: truncated")
+
+// checkGIFFrames walks the blocks of a GIF without decoding any pixels and
+// rejects it if it has more than maxFrames frames, or more than maxPixels
+// pixels across all of them. gif.DecodeAll allocates every frame at once,
+// so a small file repeating a large frame could otherwise exhaust memory.
+func checkGIFFrames(data []byte, maxFrames, maxPixels int) error {
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return fmt.Errorf("%w: %v", ErrUnsupportedFormat, errTruncatedGIF)
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+
+	frames, pixels := 0, 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then data sub-blocks
+			pos += 2
+		case 0x2C: // Image descriptor
+			if pos+10 > len(data) {
+				return fmt.Errorf("%w: %v", ErrUnsupportedFormat, errTruncatedGIF)
+			}
+			width := int(data[pos+5]) | int(data[pos+6])<<8
+			height := int(data[pos+7]) | int(data[pos+8])<<8
+			flags := data[pos+9]
+			frames++
+			pixels += width * height
+			if frames > maxFrames {
+				return fmt.Errorf("%w: more than %d frames", ErrImageTooLarge, maxFrames)
+			}
+			if pixels > maxPixels {
+				return fmt.Errorf("%w: frames have more than %d pixels", ErrImageTooLarge, maxPixels)
+			}
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			// LZW minimum code size, then data sub-blocks
+			pos++
+		case 0x3B: // Trailer
+			return nil
+		default:
+			// Left to the decoder to reject
+			return nil
+		}
+
+		// Sub-blocks, each prefixed by its size and ended by an empty one
+		for {
+			if pos >= len(data) {
+				return fmt.Errorf("%w: %v", ErrUnsupportedFormat, errTruncatedGIF)
+			}
+			size := int(data[pos])
+			pos += size + 1
+			if size == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
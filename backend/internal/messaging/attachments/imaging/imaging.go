@@ -0,0 +1,311 @@
+// Package imaging prepares uploaded images for display: it strips their
+// metadata, records their dimensions and renders thumbnails and a blurhash
+// placeholder.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+const (
+	// DefaultMaxPixels bounds the decoded size of an image, so a small file
+	// declaring huge dimensions cannot exhaust memory
+	DefaultMaxPixels = 50_000_000
+
+	// DefaultMaxFrames bounds the number of frames of an animated GIF
+	DefaultMaxFrames = 500
+
+	// originalJPEGQuality is used when re-encoding JPEG originals
+	originalJPEGQuality = 90
+)
+
+var (
+	// ErrUnsupportedFormat is returned for images that cannot be decoded
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrImageTooLarge is returned for images above Options.MaxPixels, or
+	// animations above Options.MaxFrames
+	ErrImageTooLarge = errors.New("image dimensions too large")
+)
+
+// Size is a thumbnail size, bounded by its longest side
+type Size struct {
+	Name         string
+	MaxDimension int
+}
+
+// DefaultSizes are the thumbnails rendered when Options.Sizes is empty
+var DefaultSizes = []Size{
+	{Name: "small", MaxDimension: 200},
+	{Name: "large", MaxDimension: 800},
+}
+
+// Encoder encodes thumbnails
+type Encoder interface {
+	Encode(w io.Writer, img image.Image) error
+	ContentType() string
+	Extension() string
+}
+
+// JPEGEncoder encodes thumbnails as JPEG. Transparent areas are flattened
+// onto white.
+type JPEGEncoder struct {
+	Quality int
+}
+
+func (e JPEGEncoder) Encode(w io.Writer, img image.Image) error {
+	quality := e.Quality
+	if quality <= 0 {
+		quality = 80
+	}
+	return jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: quality})
+}
+
+func (e JPEGEncoder) ContentType() string { return "image/jpeg" }
+
+func (e JPEGEncoder) Extension() string { return ".jpg" }
+
+// WebPEncoder encodes thumbnails as lossless WebP, which keeps transparency
+// and the sharp edges of graphics but is larger than JPEG for photos
+type WebPEncoder struct{}
+
+func (e WebPEncoder) Encode(w io.Writer, img image.Image) error {
+	return nativewebp.Encode(w, img, nil)
+}
+
+func (e WebPEncoder) ContentType() string { return "image/webp" }
+
+func (e WebPEncoder) Extension() string { return ".webp" }
+
+// Options configure Process
+type Options struct {
+	// Sizes are the thumbnails to render, DefaultSizes if empty
+	Sizes []Size
+	// Encoder encodes thumbnails. If nil, images with transparency are
+	// encoded as WebP and opaque ones as JPEG at quality 80.
+	Encoder Encoder
+	// MaxPixels rejects larger images, DefaultMaxPixels if zero. For
+	// animations it bounds the pixels of all frames together.
+	MaxPixels int
+	// MaxFrames rejects animations with more frames, DefaultMaxFrames if zero
+	MaxFrames int
+	// BlurhashX and BlurhashY are the blurhash components, 4x3 if zero
+	BlurhashX, BlurhashY int
+}
+
+// Thumbnail is a rendered thumbnail
+type Thumbnail struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Result is a processed image
+type Result struct {
+	// Format is the decoder's name for the original, e.g. "jpeg"
+	Format      string
+	ContentType string
+	// Width and Height are the displayed dimensions, after applying the
+	// EXIF orientation
+	Width  int
+	Height int
+	// Original is the image re-encoded without EXIF, GPS or other metadata
+	Original   []byte
+	Thumbnails []Thumbnail
+	Blurhash   string
+}
+
+// Process decodes an image, strips its metadata and renders thumbnails.
+// Metadata is removed by re-encoding the pixels, which drops EXIF, XMP and
+// text chunks alike; the EXIF orientation of JPEGs is applied first so the
+// stripped image is displayed the right way up.
+func Process(r io.Reader, opts Options) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	maxPixels := opts.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = DefaultMaxPixels
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrImageTooLarge, config.Width, config.Height)
+	}
+
+	result := &Result{Format: format}
+	var img image.Image
+	var original bytes.Buffer
+
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+		}
+		img = orient(img, jpegOrientation(data))
+		err = jpeg.Encode(&original, img, &jpeg.Options{Quality: originalJPEGQuality})
+		result.ContentType = "image/jpeg"
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+		}
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&original, img)
+		result.ContentType = "image/png"
+	case "gif":
+		// Keep every frame of animations; thumbnails use the first. Frames
+		// are decoded in full, so they are counted before decoding any.
+		maxFrames := opts.MaxFrames
+		if maxFrames <= 0 {
+			maxFrames = DefaultMaxFrames
+		}
+		if err := checkGIFFrames(data, maxFrames, maxPixels); err != nil {
+			return nil, err
+		}
+		var anim *gif.GIF
+		anim, err = gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+		}
+		img = anim.Image[0]
+		err = gif.EncodeAll(&original, anim)
+		result.ContentType = "image/gif"
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to re-encode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	result.Width = bounds.Dx()
+	result.Height = bounds.Dy()
+	result.Original = original.Bytes()
+
+	src := toRGBA(img)
+	encoder := opts.Encoder
+	if encoder == nil {
+		encoder = JPEGEncoder{}
+		if !src.Opaque() {
+			encoder = WebPEncoder{}
+		}
+	}
+	sizes := opts.Sizes
+	if len(sizes) == 0 {
+		sizes = DefaultSizes
+	}
+
+	for _, size := range sizes {
+		width, height := fit(result.Width, result.Height, size.MaxDimension)
+		thumb := resize(src, width, height)
+
+		var buf bytes.Buffer
+		if err := encoder.Encode(&buf, thumb); err != nil {
+			return nil, fmt.Errorf("failed to encode %s thumbnail: %w", size.Name, err)
+		}
+		result.Thumbnails = append(result.Thumbnails, Thumbnail{
+			Name:        size.Name,
+			Width:       width,
+			Height:      height,
+			ContentType: encoder.ContentType(),
+			Extension:   encoder.Extension(),
+			Data:        buf.Bytes(),
+		})
+	}
+
+	componentsX, componentsY := opts.BlurhashX, opts.BlurhashY
+	if componentsX <= 0 || componentsY <= 0 {
+		componentsX, componentsY = 4, 3
+	}
+	// The placeholder only keeps a few frequencies, so a tiny copy suffices
+	width, height := fit(result.Width, result.Height, 32)
+	result.Blurhash = Blurhash(resize(src, width, height), componentsX, componentsY)
+
+	return result, nil
+}
+
+// fit scales width and height down so neither exceeds maxDimension
+func fit(width, height, maxDimension int) (int, int) {
+	if width <= maxDimension && height <= maxDimension {
+		return width, height
+	}
+	if width >= height {
+		return maxDimension, max(1, height*maxDimension/width)
+	}
+	return max(1, width*maxDimension/height), maxDimension
+}
+
+// toRGBA converts an image to RGBA with its origin at zero
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// flatten draws an image onto a white background
+func flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+	return flat
+}
+
+// resize scales an image down by averaging the source pixels each target
+// pixel covers, which avoids the aliasing of nearest-neighbour sampling
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if width == srcWidth && height == srcHeight {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max((y+1)*srcHeight/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max((x+1)*srcWidth/width, x0+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					a += uint32(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
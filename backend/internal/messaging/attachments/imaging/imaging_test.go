@@ -0,0 +1,270 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testImage is wider than high with a red top-left quadrant
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < width/2 && y < height/2 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// exifSegment builds an APP1 segment with an orientation tag and a GPS
+// latitude reference, which is what must not survive processing
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(2))
+	// Orientation, SHORT, count 1
+	binary.Write(&tiff, binary.BigEndian, []uint16{exifOrientationTag, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	// GPSLatitudeRef, ASCII "N"
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0001, 2})
+	binary.Write(&tiff, binary.BigEndian, uint32(2))
+	tiff.WriteString("N\x00\x00\x00")
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString("GPS 51.5007N 0.1246W")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func jpegWithExif(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	data := buf.Bytes()
+
+	// Insert the segment right after the SOI marker
+	return append(append([]byte{0xFF, 0xD8}, exifSegment(orientation)...), data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func TestProcessStripsMetadataAndAppliesOrientation(t *testing.T) {
+	data := jpegWithExif(t, testImage(64, 32), 6)
+	require.Equal(t, 6, jpegOrientation(data))
+
+	result, err := Process(bytes.NewReader(data), Options{})
+	require.NoError(t, err)
+
+	assert.Equal(t, "jpeg", result.Format)
+	assert.Equal(t, "image/jpeg", result.ContentType)
+	assert.Equal(t, 32, result.Width, "dimensions are reported upright")
+	assert.Equal(t, 64, result.Height)
+
+	assert.False(t, bytes.Contains(result.Original, []byte("Exif")))
+	assert.False(t, bytes.Contains(result.Original, []byte("GPS")))
+	assert.Equal(t, 1, jpegOrientation(result.Original))
+
+	// Rotating clockwise moves the red top-left quadrant to the top right
+	stripped, err := jpeg.Decode(bytes.NewReader(result.Original))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 32, 64), stripped.Bounds())
+	assert.True(t, isRed(stripped.At(24, 8)))
+	assert.False(t, isRed(stripped.At(8, 8)))
+}
+
+func TestOrient(t *testing.T) {
+	src := testImage(4, 2)
+	cases := map[int]struct {
+		width, height int
+		redX, redY    int
+	}{
+		1: {4, 2, 0, 0},
+		2: {4, 2, 3, 0},
+		3: {4, 2, 3, 1},
+		4: {4, 2, 0, 1},
+		5: {2, 4, 0, 0},
+		6: {2, 4, 1, 0},
+		7: {2, 4, 1, 3},
+		8: {2, 4, 0, 3},
+	}
+
+	for orientation, want := range cases {
+		oriented := orient(src, orientation)
+		assert.Equal(t, image.Rect(0, 0, want.width, want.height), oriented.Bounds(), "orientation %d", orientation)
+		assert.True(t, isRed(oriented.At(want.redX, want.redY)), "orientation %d", orientation)
+	}
+}
+
+func TestProcessStripsPNGTextChunks(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(10, 10)))
+	data := buf.Bytes()
+
+	// Insert a tEXt chunk after IHDR
+	text := []byte("tEXtLocation\x0051.5007N 0.1246W")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	ihdrEnd := 8 + 4 + 4 + 13 + 4
+	withText := append(append(append([]byte{}, data[:ihdrEnd]...), chunk...), data[ihdrEnd:]...)
+
+	result, err := Process(bytes.NewReader(withText), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", result.ContentType)
+	assert.False(t, bytes.Contains(result.Original, []byte("tEXt")))
+}
+
+func TestProcessRendersThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(1000, 500)))
+
+	result, err := Process(&buf, Options{})
+	require.NoError(t, err)
+
+	require.Len(t, result.Thumbnails, 2)
+	small, large := result.Thumbnails[0], result.Thumbnails[1]
+	assert.Equal(t, "small", small.Name)
+	assert.Equal(t, [2]int{200, 100}, [2]int{small.Width, small.Height})
+	assert.Equal(t, "large", large.Name)
+	assert.Equal(t, [2]int{800, 400}, [2]int{large.Width, large.Height})
+
+	for _, thumb := range result.Thumbnails {
+		assert.Equal(t, "image/jpeg", thumb.ContentType)
+		assert.Equal(t, ".jpg", thumb.Extension)
+		decoded, err := jpeg.Decode(bytes.NewReader(thumb.Data))
+		require.NoError(t, err)
+		assert.Equal(t, thumb.Width, decoded.Bounds().Dx())
+		assert.True(t, isRed(decoded.At(thumb.Width/8, thumb.Height/8)))
+	}
+}
+
+func TestProcessDoesNotUpscale(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(120, 300)))
+
+	result, err := Process(&buf, Options{Sizes: []Size{{Name: "small", MaxDimension: 150}, {Name: "large", MaxDimension: 800}}})
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{60, 150}, [2]int{result.Thumbnails[0].Width, result.Thumbnails[0].Height})
+	assert.Equal(t, [2]int{120, 300}, [2]int{result.Thumbnails[1].Width, result.Thumbnails[1].Height})
+}
+
+func TestProcessRejectsBadImages(t *testing.T) {
+	_, err := Process(strings.NewReader("not an image"), Options{})
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(100, 100)))
+	_, err = Process(&buf, Options{MaxPixels: 5000})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func TestProcessRejectsUndecodableImages(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(100, 100)))
+	// The header is intact, so only decoding the pixels fails
+	truncated := buf.Bytes()[:60]
+
+	_, err := Process(bytes.NewReader(truncated), Options{})
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestProcessRendersTransparentThumbnailsAsWebP(t *testing.T) {
+	img := testImage(100, 50)
+	img.Set(0, 0, color.RGBA{})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+
+	result, err := Process(&buf, Options{})
+	require.NoError(t, err)
+	for _, thumb := range result.Thumbnails {
+		assert.Equal(t, "image/webp", thumb.ContentType)
+		assert.Equal(t, ".webp", thumb.Extension)
+		require.Greater(t, len(thumb.Data), 16)
+		assert.Equal(t, "RIFF", string(thumb.Data[:4]))
+		assert.Equal(t, "WEBPVP8L", string(thumb.Data[8:16]))
+	}
+}
+
+// animation encodes a GIF repeating a frame of the given size
+func animation(t *testing.T, frames, width, height int) []byte {
+	t.Helper()
+	anim := &gif.GIF{}
+	frame := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&buf, anim))
+	return buf.Bytes()
+}
+
+func TestProcessLimitsAnimations(t *testing.T) {
+	result, err := Process(bytes.NewReader(animation(t, 5, 40, 20)), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "image/gif", result.ContentType)
+	anim, err := gif.DecodeAll(bytes.NewReader(result.Original))
+	require.NoError(t, err)
+	assert.Len(t, anim.Image, 5, "every frame is kept")
+
+	cases := map[string]struct {
+		data []byte
+		opts Options
+	}{
+		"too many frames": {animation(t, 5, 40, 20), Options{MaxFrames: 4}},
+		"too many pixels": {animation(t, 5, 40, 20), Options{MaxPixels: 4 * 40 * 20}},
+		"default frames":  {animation(t, DefaultMaxFrames+1, 1, 1), Options{}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Process(bytes.NewReader(tc.data), tc.opts)
+			assert.ErrorIs(t, err, ErrImageTooLarge)
+		})
+	}
+
+	truncated := animation(t, 2, 40, 20)
+	_, err = Process(bytes.NewReader(truncated[:len(truncated)-10]), Options{})
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestBlurhash(t *testing.T) {
+	solid := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(solid.Pix); i += 4 {
+		copy(solid.Pix[i:], []byte{255, 0, 0, 255})
+	}
+
+	// A size flag for 4x3 components, the maximum AC value, the average
+	// colour and two characters per AC component
+	hash := Blurhash(solid, 4, 3)
+	assert.Len(t, hash, 1+1+4+2*11)
+	assert.Equal(t, "L", hash[:1])
+	assert.Equal(t, "TI:j", hash[2:6], "average colour is pure red")
+
+	varied := Blurhash(testImage(32, 16), 4, 3)
+	assert.Len(t, varied, 28)
+	assert.NotEqual(t, hash, varied)
+}
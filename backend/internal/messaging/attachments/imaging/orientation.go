@@ -0,0 +1,133 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// exifOrientationTag is the EXIF tag holding how the camera was rotated
+const exifOrientationTag = 0x0112
+
+// jpegOrientation returns the EXIF orientation of a JPEG, 1 (upright) if it
+// has none or it cannot be read
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			pos += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Image data starts; metadata segments come before it
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of the TIFF
+// structure inside an EXIF segment
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		// A SHORT stored in the first two bytes of the value field
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// orient transforms an image according to its EXIF orientation so it is
+// displayed upright without the tag
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	src := toRGBA(img)
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// source maps a pixel of the upright image to the stored one
+	var source func(x, y int) (int, int)
+	dstWidth, dstHeight := width, height
+	switch orientation {
+	case 2: // mirrored
+		source = func(x, y int) (int, int) { return width - 1 - x, y }
+	case 3: // rotated 180°
+		source = func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }
+	case 4: // mirrored vertically
+		source = func(x, y int) (int, int) { return x, height - 1 - y }
+	case 5: // transposed
+		source = func(x, y int) (int, int) { return y, x }
+	case 6: // needs rotating 90° clockwise
+		source = func(x, y int) (int, int) { return y, height - 1 - x }
+	case 7: // transversed
+		source = func(x, y int) (int, int) { return width - 1 - y, height - 1 - x }
+	case 8: // needs rotating 90° anticlockwise
+		source = func(x, y int) (int, int) { return width - 1 - y, x }
+	}
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			sx, sy := source(x, y)
+			from := src.PixOffset(sx, sy)
+			to := dst.PixOffset(x, y)
+			copy(dst.Pix[to:to+4], src.Pix[from:from+4])
+		}
+	}
+	return dst
+}
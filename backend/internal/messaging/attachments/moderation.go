@@ -0,0 +1,83 @@
+package attachments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/scanning"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditModerator warns uploaders of blocked attachments by recording a
+// moderation action against them in audit_logs, where administrators
+// review repeat offenders
+type AuditModerator struct {
+	db *gorm.DB
+}
+
+var _ Moderator = (*AuditModerator)(nil)
+
+// NewAuditModerator creates a moderator recording warnings in audit_logs
+func NewAuditModerator(db *gorm.DB) *AuditModerator {
+	return &AuditModerator{db: db}
+}
+
+// auditLog is a row of audit_logs
+type auditLog struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
+	UserID     uuid.UUID `gorm:"type:uuid"`
+	Action     string
+	EntityType string
+	EntityID   uuid.UUID `gorm:"type:uuid"`
+	Metadata   string    `gorm:"type:jsonb"`
+	CreatedAt  time.Time
+}
+
+func (auditLog) TableName() string { return "audit_logs" }
+
+// moderationMetadata describes a blocked attachment in its audit log entry
+type moderationMetadata struct {
+	Action    domain.ModerationActionType `json:"action"`
+	Reason    string                      `json:"reason"`
+	ChannelID uuid.UUID                   `json:"channel_id"`
+	MessageID uuid.UUID                   `json:"message_id"`
+	FileName  string                      `json:"file_name"`
+	Signature string                      `json:"signature"`
+}
+
+// WarningAction is the audit log action of warnings for blocked attachments
+const WarningAction = "moderation.warn"
+
+// AttachmentBlocked records a warning against the uploader of a blocked
+// attachment
+func (m *AuditModerator) AttachmentBlocked(ctx context.Context, attachment *Attachment, channelID uuid.UUID, uploaderID uuid.UUID, verdict *scanning.Verdict) error {
+	metadata, err := json.Marshal(moderationMetadata{
+		Action:    domain.ModerationActionWarn,
+		Reason:    "uploaded an attachment the malware scanner blocked",
+		ChannelID: channelID,
+		MessageID: attachment.MessageID,
+		FileName:  attachment.FileName,
+		Signature: verdict.Signature,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode moderation metadata: %w", err)
+	}
+
+	entry := &auditLog{
+		ID:         uuid.New(),
+		UserID:     uploaderID,
+		Action:     WarningAction,
+		EntityType: "attachment",
+		EntityID:   attachment.ID,
+		Metadata:   string(metadata),
+		CreatedAt:  time.Now(),
+	}
+	if err := m.db.WithContext(ctx).Create(entry).Error; err != nil {
+		return fmt.Errorf("failed to record warning against user %s: %w", uploaderID, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Repository stores attachments in messaging_attachments
+type Repository struct {
+	db *gorm.DB
+}
+
+var _ AttachmentRepository = (*Repository)(nil)
+
+// NewRepository creates a new attachment repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// CreateAttachment stores a new attachment, assigning its ID
+func (r *Repository) CreateAttachment(ctx context.Context, attachment *Attachment) error {
+	if attachment.ID == uuid.Nil {
+		attachment.ID = uuid.New()
+	}
+	if err := r.db.WithContext(ctx).Create(attachment).Error; err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	return nil
+}
+
+// UpdateAttachment saves every field of an attachment
+func (r *Repository) UpdateAttachment(ctx context.Context, attachment *Attachment) error {
+	if err := r.db.WithContext(ctx).Save(attachment).Error; err != nil {
+		return fmt.Errorf("failed to update attachment %s: %w", attachment.ID, err)
+	}
+	return nil
+}
+
+// GetAttachment retrieves an attachment
+func (r *Repository) GetAttachment(ctx context.Context, attachmentID uuid.UUID) (*Attachment, error) {
+	var attachment Attachment
+	err := r.db.WithContext(ctx).Where("id = ?", attachmentID).Take(&attachment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("failed to load attachment %s: %w", attachmentID, err)
+	}
+	return &attachment, nil
+}
+
+// DeleteAttachment deletes an attachment
+func (r *Repository) DeleteAttachment(ctx context.Context, attachmentID uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Where("id = ?", attachmentID).Delete(&Attachment{}).Error; err != nil {
+		return fmt.Errorf("failed to delete attachment %s: %w", attachmentID, err)
+	}
+	return nil
+}
+
+// GetMessageAttachments lists the attachments of a message
+func (r *Repository) GetMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]Attachment, error) {
+	var attachments []Attachment
+	err := r.db.WithContext(ctx).Where("message_id = ?", messageID).Order("created_at").Find(&attachments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments of message %s: %w", messageID, err)
+	}
+	return attachments, nil
+}
+
+// CanAccess checks whether a user is a member of the channel the message
+// an attachment belongs to was sent in
+func (r *Repository) CanAccess(ctx context.Context, attachmentID uuid.UUID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Table("messaging_attachments a").
+		Joins("JOIN messaging_messages m ON m.id = a.message_id").
+		Joins("JOIN messaging_channel_members cm ON cm.channel_id = m.channel_id").
+		Where("a.id = ? AND cm.user_id = ?", attachmentID, userID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check access of user %s to attachment %s: %w", userID, attachmentID, err)
+	}
+	return count > 0, nil
+}
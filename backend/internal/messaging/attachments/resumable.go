@@ -0,0 +1,52 @@
+package attachments
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/scanning"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/google/uuid"
+)
+
+var _ uploads.Finalizer = (*AttachmentService)(nil)
+
+// FinalizeUpload turns a completed resumable upload into an attachment of
+// a message. Like uploads sent in a single request, its type is detected
+// from its contents and it stays quarantined until scanned. The storage
+// must be the one the upload was written to, since the attachment keeps
+// the upload's file.
+func (s *AttachmentService) FinalizeUpload(ctx context.Context, upload *uploads.Upload, messageID uuid.UUID) (*domain.Attachment, error) {
+	if upload.Length > s.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes is over the maximum size", uploads.ErrUploadRejected, upload.Length)
+	}
+
+	file, _, err := s.storage.Download(ctx, upload.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload %s: %w", upload.ID, err)
+	}
+	head := make([]byte, scanning.SniffLength)
+	n, err := io.ReadFull(file, head)
+	file.Close()
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read upload %s: %w", upload.ID, err)
+	}
+
+	contentType := scanning.DetectContentType(head[:n], upload.ContentType)
+	if !s.isAllowedFileType(contentType) {
+		return nil, fmt.Errorf("%w: %s files are not allowed", uploads.ErrUploadRejected, contentType)
+	}
+
+	attachment := s.newAttachment(messageID, upload.UserID, upload.FileName, contentType, upload.Length)
+	attachment.StorageKey = upload.StorageKey
+	if err := s.repo.CreateAttachment(ctx, attachment); err != nil {
+		return nil, err
+	}
+
+	s.broadcastAttachmentStatus(attachment, "scanning", 0, upload.ChannelID)
+	s.enqueueScan(ctx, attachment, upload.ChannelID, upload.UserID)
+
+	return attachment.Domain(), nil
+}
@@ -0,0 +1,174 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/scanning"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
+)
+
+// ScanJobType is the queue job type that scans quarantined uploads
+const ScanJobType = "attachment.scan"
+
+// Attachment scan statuses
+const (
+	ScanStatusPending = "pending"
+	ScanStatusClean   = "clean"
+	ScanStatusBlocked = "blocked"
+	ScanStatusFailed  = "failed"
+)
+
+// scanPayload is the payload of ScanJobType jobs
+type scanPayload struct {
+	AttachmentID uuid.UUID `json:"attachment_id"`
+	ChannelID    uuid.UUID `json:"channel_id"`
+	UploaderID   uuid.UUID `json:"uploader_id"`
+}
+
+// Moderator is told about uploads the scanner blocked, to act against the
+// uploader, e.g. by logging a moderation action or muting them
+type Moderator interface {
+	AttachmentBlocked(ctx context.Context, attachment *Attachment, channelID uuid.UUID, uploaderID uuid.UUID, verdict *scanning.Verdict) error
+}
+
+// SetScanner sets the scanner uploads are checked with. Without one, every
+// upload is released once it has been stored.
+func (s *AttachmentService) SetScanner(scanner scanning.Scanner) {
+	s.scanner = scanner
+}
+
+// SetModerator sets who is told about blocked uploads
+func (s *AttachmentService) SetModerator(moderator Moderator) {
+	s.moderator = moderator
+}
+
+// enqueueScan schedules a quarantined upload for scanning
+func (s *AttachmentService) enqueueScan(ctx context.Context, attachment *Attachment, channelID uuid.UUID, uploaderID uuid.UUID) {
+	payload := scanPayload{AttachmentID: attachment.ID, ChannelID: channelID, UploaderID: uploaderID}
+
+	if s.jobs == nil {
+		go func() {
+			if err := s.ScanAttachment(context.Background(), payload.AttachmentID, payload.ChannelID, payload.UploaderID); err != nil {
+				log.Printf("Failed to scan attachment %s: %v", payload.AttachmentID, err)
+				s.failScan(context.Background(), payload.AttachmentID, payload.ChannelID)
+			}
+		}()
+		return
+	}
+
+	if _, err := s.jobs.Enqueue(ctx, ScanJobType, payload); err != nil {
+		log.Printf("Failed to enqueue scan of attachment %s: %v", attachment.ID, err)
+		s.failScan(ctx, attachment.ID, channelID)
+	}
+}
+
+// ScanProcessor returns the queue processor for ScanJobType jobs. Scans
+// that fail, e.g. because the scanner is down, are retried; once out of
+// attempts the upload stays quarantined and is marked as failed.
+func (s *AttachmentService) ScanProcessor() queue.Processor {
+	return queue.ProcessorFunc(func(ctx context.Context, job *queue.Job) error {
+		var payload scanPayload
+		if err := job.Decode(&payload); err != nil {
+			return err
+		}
+
+		err := s.ScanAttachment(ctx, payload.AttachmentID, payload.ChannelID, payload.UploaderID)
+		if err != nil && job.Attempts >= job.MaxAttempts {
+			s.failScan(ctx, payload.AttachmentID, payload.ChannelID)
+		}
+		return err
+	})
+}
+
+// ScanAttachment scans a quarantined upload. Clean files are published, or
+// handed to image processing; blocked files are deleted and moderated.
+func (s *AttachmentService) ScanAttachment(ctx context.Context, attachmentID uuid.UUID, channelID uuid.UUID, uploaderID uuid.UUID) error {
+	attachment, err := s.repo.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return err
+	}
+	if attachment.ScanStatus != ScanStatusPending {
+		// Already scanned by an earlier attempt
+		return nil
+	}
+
+	file, _, err := s.storage.Download(ctx, attachment.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open attachment %s: %w", attachmentID, err)
+	}
+	verdict, err := s.scanner.Scan(ctx, file)
+	file.Close()
+	if err != nil {
+		if errors.Is(err, scanning.ErrScanLimitExceeded) {
+			log.Printf("Cannot scan attachment %s: %v", attachmentID, err)
+			s.failScan(ctx, attachmentID, channelID)
+			return nil
+		}
+		return err
+	}
+
+	if !verdict.Clean {
+		return s.blockAttachment(ctx, attachment, channelID, uploaderID, verdict)
+	}
+
+	attachment.ScanStatus = ScanStatusClean
+	if err := s.repo.UpdateAttachment(ctx, attachment); err != nil {
+		return err
+	}
+	if attachment.IsImage() {
+		// Image processing publishes the stripped copy
+		s.broadcastAttachmentStatus(attachment, "processing", 0, channelID)
+		s.enqueueImageProcessing(ctx, attachment, channelID)
+		return nil
+	}
+
+	s.broadcastAttachmentStatus(attachment, "complete", 100, channelID)
+	return nil
+}
+
+// blockAttachment deletes an infected upload and reports it for moderation.
+// The record is kept, without a file, so the block can be audited.
+func (s *AttachmentService) blockAttachment(ctx context.Context, attachment *Attachment, channelID uuid.UUID, uploaderID uuid.UUID, verdict *scanning.Verdict) error {
+	log.Printf("Blocked attachment %s uploaded by user %s: %s", attachment.ID, uploaderID, verdict.Signature)
+
+	attachment.ScanStatus = ScanStatusBlocked
+	attachment.ScanSignature = verdict.Signature
+	if attachment.IsImage() {
+		attachment.ProcessingStatus = ProcessingStatusFailed
+	}
+	if err := s.repo.UpdateAttachment(ctx, attachment); err != nil {
+		return err
+	}
+
+	s.deleteFiles(ctx, []string{attachment.StorageKey})
+	s.broadcastAttachmentStatus(attachment, "blocked", 0, channelID)
+
+	if s.moderator != nil {
+		if err := s.moderator.AttachmentBlocked(ctx, attachment, channelID, uploaderID, verdict); err != nil {
+			log.Printf("Failed to moderate blocked attachment %s: %v", attachment.ID, err)
+		}
+	}
+	return nil
+}
+
+// failScan marks an upload that could not be scanned. It stays quarantined.
+func (s *AttachmentService) failScan(ctx context.Context, attachmentID uuid.UUID, channelID uuid.UUID) {
+	attachment, err := s.repo.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return
+	}
+
+	attachment.ScanStatus = ScanStatusFailed
+	if attachment.IsImage() {
+		attachment.ProcessingStatus = ProcessingStatusFailed
+	}
+	if err := s.repo.UpdateAttachment(ctx, attachment); err != nil {
+		log.Printf("Failed to mark attachment %s as unscanned: %v", attachmentID, err)
+	}
+	s.broadcastAttachmentStatus(attachment, "error", 0, channelID)
+}
@@ -0,0 +1,209 @@
+// Package scanning checks uploaded files before they are published: it
+// detects their real type from their contents and scans them for malware.
+package scanning
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultClamdTimeout bounds a whole scan, including streaming the file
+	defaultClamdTimeout = 2 * time.Minute
+
+	// clamdChunkSize is the size of the chunks streamed to clamd
+	clamdChunkSize = 64 * 1024
+)
+
+var (
+	// ErrScanFailed is returned when a file could not be scanned
+	ErrScanFailed = errors.New("scan failed")
+
+	// ErrScanLimitExceeded is returned for files larger than the scanner
+	// accepts. Retrying does not help, so such files stay quarantined.
+	ErrScanLimitExceeded = errors.New("file exceeds scanner size limit")
+)
+
+// Verdict is the outcome of a scan
+type Verdict struct {
+	Clean bool `json:"clean"`
+	// Signature names what was found in files that are not clean
+	Signature string `json:"signature,omitempty"`
+}
+
+// Scanner scans file contents for malware
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (*Verdict, error)
+}
+
+// NopScanner reports every file as clean, for deployments without a scanner
+type NopScanner struct{}
+
+// Scan reads nothing and reports the file as clean
+func (NopScanner) Scan(ctx context.Context, r io.Reader) (*Verdict, error) {
+	return &Verdict{Clean: true}, nil
+}
+
+// ClamdScanner scans files with the ClamAV daemon. Files are streamed with
+// the INSTREAM command, so clamd does not need access to the storage.
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner creates a scanner talking to clamd on a unix socket, as
+// configured by LocalSocket in clamd.conf
+func NewClamdScanner(socketPath string) *ClamdScanner {
+	return &ClamdScanner{network: "unix", address: socketPath, timeout: defaultClamdTimeout}
+}
+
+// NewClamdTCPScanner creates a scanner talking to clamd over TCP, as
+// configured by TCPSocket in clamd.conf
+func NewClamdTCPScanner(address string) *ClamdScanner {
+	return &ClamdScanner{network: "tcp", address: address, timeout: defaultClamdTimeout}
+}
+
+// SetTimeout sets how long a single scan may take
+func (s *ClamdScanner) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+// Ping checks that clamd is reachable
+func (s *ClamdScanner) Ping(ctx context.Context) error {
+	reply, err := s.command(ctx, "PING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("%w: unexpected reply to PING: %q", ErrScanFailed, reply)
+	}
+	return nil
+}
+
+// Scan streams a file to clamd and returns its verdict
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (*Verdict, error) {
+	reply, err := s.command(ctx, "INSTREAM", r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replies look like "stream: OK" or "stream: Eicar-Signature FOUND"
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return &Verdict{Clean: true}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(reply, " FOUND")
+		if idx := strings.Index(signature, ": "); idx >= 0 {
+			signature = signature[idx+2:]
+		}
+		return &Verdict{Clean: false, Signature: signature}, nil
+	case strings.Contains(reply, "size limit exceeded"):
+		return nil, ErrScanLimitExceeded
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
+
+// command sends a null-terminated command and, for INSTREAM, the contents
+// of body as length-prefixed chunks, then reads the null-terminated reply
+func (s *ClamdScanner) command(ctx context.Context, name string, body io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to connect to clamd: %v", ErrScanFailed, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock reads and writes if the context is cancelled early
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.Write([]byte("z" + name + "\x00")); err != nil {
+		return "", fmt.Errorf("%w: failed to send command: %v", ErrScanFailed, err)
+	}
+
+	if body != nil {
+		if err := streamChunks(conn, body); err != nil {
+			var readErr *bodyError
+			if errors.As(err, &readErr) {
+				return "", fmt.Errorf("%w: failed to read file: %v", ErrScanFailed, readErr.err)
+			}
+			// clamd closes the connection once a stream passes its limit,
+			// after replying; prefer the reply if there is one
+			if reply, replyErr := readReply(conn); replyErr == nil && reply != "" {
+				return reply, nil
+			}
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("%w: %v", ErrScanFailed, ctx.Err())
+			}
+			return "", fmt.Errorf("%w: failed to stream file: %v", ErrScanFailed, err)
+		}
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("%w: %v", ErrScanFailed, ctx.Err())
+		}
+		return "", fmt.Errorf("%w: failed to read reply: %v", ErrScanFailed, err)
+	}
+	return reply, nil
+}
+
+// streamChunks writes body as INSTREAM chunks followed by the zero-length
+// chunk that ends the stream
+func streamChunks(w io.Writer, body io.Reader) error {
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(body, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, writeErr := w.Write(buf[:4+n]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return &bodyError{err: err}
+		}
+	}
+
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// bodyError is a failure to read the file being streamed, as opposed to a
+// failure to send it
+type bodyError struct {
+	err error
+}
+
+func (e *bodyError) Error() string {
+	return e.err.Error()
+}
+
+// readReply reads a null-terminated reply
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", err
+	}
+	return string(bytes.TrimSpace(bytes.TrimSuffix(reply, []byte{0}))), nil
+}
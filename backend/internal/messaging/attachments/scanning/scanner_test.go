@@ -0,0 +1,186 @@
+package scanning
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd speaks the clamd protocol on a unix socket. It reports EICAR as
+// found and rejects streams above maxStream like StreamMaxLength does.
+type fakeClamd struct {
+	socket    string
+	maxStream int
+	stall     bool
+
+	mu       sync.Mutex
+	received [][]byte
+}
+
+func newFakeClamd(t *testing.T) *fakeClamd {
+	t.Helper()
+
+	clamd := &fakeClamd{socket: filepath.Join(t.TempDir(), "clamd.sock"), maxStream: 1 << 20}
+	listener, err := net.Listen("unix", clamd.socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go clamd.serve(conn)
+		}
+	}()
+	return clamd
+}
+
+func (f *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	command, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var stream []byte
+		for {
+			var size uint32
+			if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(reader, chunk); err != nil {
+				return
+			}
+			stream = append(stream, chunk...)
+			if len(stream) > f.maxStream {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				return
+			}
+		}
+
+		f.mu.Lock()
+		f.received = append(f.received, stream)
+		f.mu.Unlock()
+
+		if f.stall {
+			time.Sleep(time.Second)
+		}
+		if bytes.Contains(stream, []byte(eicar)) {
+			conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+			return
+		}
+		conn.Write([]byte("stream: OK\x00"))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func (f *fakeClamd) streams() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.received
+}
+
+func TestClamdScanner(t *testing.T) {
+	clamd := newFakeClamd(t)
+	scanner := NewClamdScanner(clamd.socket)
+	ctx := context.Background()
+
+	require.NoError(t, scanner.Ping(ctx))
+
+	t.Run("reports clean files", func(t *testing.T) {
+		verdict, err := scanner.Scan(ctx, strings.NewReader("quarterly report"))
+		require.NoError(t, err)
+		assert.True(t, verdict.Clean)
+		assert.Empty(t, verdict.Signature)
+	})
+
+	t.Run("reports infected files", func(t *testing.T) {
+		verdict, err := scanner.Scan(ctx, strings.NewReader(eicar))
+		require.NoError(t, err)
+		assert.False(t, verdict.Clean)
+		assert.Equal(t, "Eicar-Signature", verdict.Signature)
+	})
+
+	t.Run("streams large files in chunks", func(t *testing.T) {
+		contents := bytes.Repeat([]byte("a"), 3*clamdChunkSize+17)
+		contents = append(contents, eicar...)
+
+		verdict, err := scanner.Scan(ctx, bytes.NewReader(contents))
+		require.NoError(t, err)
+		assert.False(t, verdict.Clean)
+
+		streams := clamd.streams()
+		assert.Equal(t, contents, streams[len(streams)-1])
+	})
+
+	t.Run("reports files above the stream limit", func(t *testing.T) {
+		_, err := scanner.Scan(ctx, bytes.NewReader(make([]byte, clamd.maxStream+clamdChunkSize)))
+		assert.ErrorIs(t, err, ErrScanLimitExceeded)
+	})
+
+	t.Run("fails when the file cannot be read", func(t *testing.T) {
+		_, err := scanner.Scan(ctx, io.MultiReader(strings.NewReader("partial"), &failingReader{}))
+		assert.ErrorIs(t, err, ErrScanFailed)
+	})
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("storage went away")
+}
+
+func TestClamdScannerFailures(t *testing.T) {
+	t.Run("clamd is not running", func(t *testing.T) {
+		scanner := NewClamdScanner(filepath.Join(t.TempDir(), "missing.sock"))
+		_, err := scanner.Scan(context.Background(), strings.NewReader("data"))
+		assert.ErrorIs(t, err, ErrScanFailed)
+		assert.ErrorIs(t, scanner.Ping(context.Background()), ErrScanFailed)
+	})
+
+	t.Run("clamd is too slow", func(t *testing.T) {
+		clamd := newFakeClamd(t)
+		clamd.stall = true
+		scanner := NewClamdScanner(clamd.socket)
+		scanner.SetTimeout(50 * time.Millisecond)
+
+		start := time.Now()
+		_, err := scanner.Scan(context.Background(), strings.NewReader("data"))
+		assert.ErrorIs(t, err, ErrScanFailed)
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+}
+
+func TestNopScanner(t *testing.T) {
+	verdict, err := NopScanner{}.Scan(context.Background(), strings.NewReader(eicar))
+	require.NoError(t, err)
+	assert.True(t, verdict.Clean)
+}
@@ -0,0 +1,54 @@
+package scanning
+
+import (
+	"mime"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// SniffLength is how many leading bytes DetectContentType needs
+const SniffLength = 3072
+
+// unknownType is reported when the contents match no known format
+const unknownType = "application/octet-stream"
+
+// DetectContentType returns the MIME type of a file from its leading bytes.
+// The declared type, e.g. a client's Content-Type header, is only kept when
+// it is a more specific kind of what the bytes show, such as a Word
+// document for what looks like a ZIP archive; otherwise the bytes win.
+// Parameters such as charset are dropped.
+func DetectContentType(head []byte, declared string) string {
+	detected := mimetype.Detect(head)
+	detectedType := mediaType(detected.String())
+
+	declaredType := mediaType(declared)
+	if declaredType == "" || declaredType == detectedType || detectedType == unknownType {
+		return detectedType
+	}
+
+	// Keep the declared type if the detected one is one of its ancestors,
+	// e.g. application/zip for a .docx whose marker is past the sniffed bytes
+	if declaredMIME := mimetype.Lookup(declaredType); declaredMIME != nil {
+		for parent := declaredMIME.Parent(); parent != nil; parent = parent.Parent() {
+			if mediaType(parent.String()) == unknownType {
+				break
+			}
+			if parent.Is(detectedType) {
+				return declaredType
+			}
+		}
+	}
+	return detectedType
+}
+
+// mediaType strips parameters from a MIME type
+func mediaType(value string) string {
+	if value == "" {
+		return ""
+	}
+	parsed, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return ""
+	}
+	return parsed
+}
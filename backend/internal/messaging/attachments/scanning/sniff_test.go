@@ -0,0 +1,55 @@
+package scanning
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// zipWith builds a ZIP archive whose only entry has the given name
+func zipWith(t *testing.T, name string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	entry, err := archive.Create(name)
+	require.NoError(t, err)
+	entry.Write([]byte("<xml/>"))
+	require.NoError(t, archive.Close())
+	return buf.Bytes()
+}
+
+func TestDetectContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	pdf := []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj\n")
+	html := []byte("<!DOCTYPE html><html><script>alert(1)</script></html>")
+	docx := zipWith(t, "word/document.xml")
+	plainZip := zipWith(t, "notes.txt")
+
+	cases := []struct {
+		name     string
+		head     []byte
+		declared string
+		want     string
+	}{
+		{"matching type", png, "image/png", "image/png"},
+		{"contents override the declared type", png, "application/pdf", "image/png"},
+		{"HTML declared as an image", html, "image/jpeg", "text/html"},
+		{"nothing declared", pdf, "", "application/pdf"},
+		{"parameters are dropped", []byte("just some notes\n"), "text/plain; charset=utf-8", "text/plain"},
+		{"specific kind of the detected type", plainZip, "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"detected specific type", docx, "application/zip", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"unrelated declared type", plainZip, "image/png", "application/zip"},
+		{"unknown contents", []byte{0x00, 0x01, 0x02, 0x03, 0xfe}, "image/png", "application/octet-stream"},
+		{"malformed declared type", png, "not a type;;", "image/png"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, DetectContentType(tc.head, tc.declared))
+		})
+	}
+}
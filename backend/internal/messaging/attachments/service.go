@@ -3,182 +3,392 @@ package attachments
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"image"
-	_ "image/gif"  // Register GIF format
-	_ "image/jpeg" // Register JPEG format
-	_ "image/png"  // Register PNG format
 	"io"
+	"log"
 	"mime/multipart"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/JadenRazo/Project-Website/backend/internal/domain"
-	"github.com/JadenRazo/Project-Website/backend/internal/messaging/errors"
-	"github.com/JadenRazo/Project-Website/backend/internal/messaging/events"
-	"github.com/JadenRazo/Project-Website/backend/internal/messaging/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/imaging"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/scanning"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
 	"github.com/google/uuid"
 )
 
-// StorageProvider defines the interface for file storage
-type StorageProvider interface {
-	// StoreFile stores a file and returns its unique identifier and public URL
-	StoreFile(ctx context.Context, file io.Reader, filename string, contentType string) (string, string, error)
+// ProcessImageJobType is the queue job type that processes uploaded images
+const ProcessImageJobType = "attachment.process_image"
 
-	// DeleteFile deletes a file by its identifier
-	DeleteFile(ctx context.Context, fileID string) error
+// Attachment processing statuses
+const (
+	ProcessingStatusProcessing = "processing"
+	ProcessingStatusComplete   = "complete"
+	ProcessingStatusFailed     = "failed"
+)
+
+// KeyPrefix is the storage key prefix of attachment files
+const KeyPrefix = "attachments/"
+
+// DefaultURLPrefix is the path attachment URLs start with when the
+// attachment routes are mounted on the messaging API
+const DefaultURLPrefix = "/api/v1/messaging/attachments"
+
+// MaxFileSize is the largest attachment messaging_attachments accepts
+const MaxFileSize = 100 * 1024 * 1024
+
+// downloadURLExpiry is how long the signed URLs attachment downloads are
+// redirected to stay valid
+const downloadURLExpiry = 15 * time.Minute
+
+var (
+	// ErrAttachmentNotFound is returned for attachments that do not exist
+	ErrAttachmentNotFound = errors.New("attachment not found")
+
+	// ErrAttachmentTooLarge is returned for files over the maximum size
+	ErrAttachmentTooLarge = errors.New("attachment too large")
+
+	// ErrInvalidAttachmentType is returned for files of types that are not
+	// allowed
+	ErrInvalidAttachmentType = errors.New("attachment type not allowed")
+
+	// ErrNotPermitted is returned when a user may not access an attachment
+	ErrNotPermitted = errors.New("not permitted")
+
+	// ErrUnavailable is returned for attachments whose file cannot be
+	// downloaded, because it is still being scanned or processed, or was
+	// blocked
+	ErrUnavailable = errors.New("attachment not available")
+)
+
+// processImagePayload is the payload of ProcessImageJobType jobs
+type processImagePayload struct {
+	AttachmentID uuid.UUID `json:"attachment_id"`
+	ChannelID    uuid.UUID `json:"channel_id"`
+}
+
+// Storage is where attachment files are kept. It is satisfied by
+// *storage.Provider.
+type Storage interface {
+	Upload(ctx context.Context, key string, reader io.Reader, contentType string) (*storage.FileInfo, error)
+	Download(ctx context.Context, key string) (io.ReadCloser, *storage.FileInfo, error)
+	Delete(ctx context.Context, key string) error
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
 }
 
 // AttachmentRepository defines the interface for attachment data access
 type AttachmentRepository interface {
-	CreateAttachment(ctx context.Context, attachment *domain.Attachment) error
-	UpdateAttachment(ctx context.Context, attachment *domain.Attachment) error
-	GetAttachment(ctx context.Context, attachmentID uint) (*domain.Attachment, error)
-	DeleteAttachment(ctx context.Context, attachmentID uint) error
-	GetMessageAttachments(ctx context.Context, messageID uint) ([]domain.Attachment, error)
+	CreateAttachment(ctx context.Context, attachment *Attachment) error
+	UpdateAttachment(ctx context.Context, attachment *Attachment) error
+	GetAttachment(ctx context.Context, attachmentID uuid.UUID) (*Attachment, error)
+	DeleteAttachment(ctx context.Context, attachmentID uuid.UUID) error
+	GetMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]Attachment, error)
+	CanAccess(ctx context.Context, attachmentID uuid.UUID, userID uuid.UUID) (bool, error)
+}
+
+// Broadcaster sends attachment events to the members of a channel. It is
+// satisfied by *messaging.Service.
+type Broadcaster interface {
+	BroadcastToChannel(channelID uuid.UUID, msgType string, data interface{})
 }
 
 // AttachmentService manages message attachments
 type AttachmentService struct {
-	storage    StorageProvider
-	repo       AttachmentRepository
-	hub        *websocket.Hub
-	dispatcher *events.EventDispatcher
-	maxSize    int64
+	storage     Storage
+	repo        AttachmentRepository
+	broadcaster Broadcaster
+	maxSize     int64
+	urlPrefix   string
+	jobs        queue.Enqueuer
+	imaging     imaging.Options
+	scanner     scanning.Scanner
+	moderator   Moderator
 }
 
 // NewAttachmentService creates a new attachment service
 func NewAttachmentService(
-	storage StorageProvider,
+	storage Storage,
 	repo AttachmentRepository,
-	hub *websocket.Hub,
-	dispatcher *events.EventDispatcher,
+	broadcaster Broadcaster,
 	maxSize int64,
 ) *AttachmentService {
 	return &AttachmentService{
-		storage:    storage,
-		repo:       repo,
-		hub:        hub,
-		dispatcher: dispatcher,
-		maxSize:    maxSize, // Maximum file size in bytes
+		storage:     storage,
+		repo:        repo,
+		broadcaster: broadcaster,
+		maxSize:     maxSize, // Maximum file size in bytes
+		urlPrefix:   DefaultURLPrefix,
+		scanner:     scanning.NopScanner{},
 	}
 }
 
+// SetURLPrefix sets the path the attachment routes are mounted on, which
+// attachment URLs start with
+func (s *AttachmentService) SetURLPrefix(prefix string) {
+	s.urlPrefix = strings.TrimSuffix(prefix, "/")
+}
+
+// SetJobQueue sets the queue scan and image processing jobs are enqueued
+// on. The queue's runner needs the processors returned by ScanProcessor and
+// ImageProcessor. Without a queue, uploads are scanned and processed in the
+// background of this process.
+func (s *AttachmentService) SetJobQueue(jobs queue.Enqueuer) {
+	s.jobs = jobs
+}
+
+// SetImagingOptions overrides the thumbnail sizes and encoder
+func (s *AttachmentService) SetImagingOptions(opts imaging.Options) {
+	s.imaging = opts
+}
+
 // UploadAttachment handles file upload and creates an attachment record
 func (s *AttachmentService) UploadAttachment(
 	ctx context.Context,
 	file multipart.File,
 	header *multipart.FileHeader,
-	messageID uint,
-	channelID uint,
-	userID uint,
-) (*domain.Attachment, error) {
+	messageID uuid.UUID,
+	channelID uuid.UUID,
+	userID uuid.UUID,
+) (*Attachment, error) {
 	// Validate file size
 	if header.Size > s.maxSize {
-		return nil, errors.ErrAttachmentTooLarge
+		return nil, ErrAttachmentTooLarge
 	}
 
-	// Validate file type
-	contentType := header.Header.Get("Content-Type")
+	// Validate file type, detected from the contents rather than trusted
+	// from the client
+	head := make([]byte, scanning.SniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	contentType := scanning.DetectContentType(head[:n], header.Header.Get("Content-Type"))
 	if !s.isAllowedFileType(contentType) {
-		return nil, errors.ErrInvalidAttachmentType
+		return nil, ErrInvalidAttachmentType
 	}
 
-	// Generate a unique filename to prevent collisions
-	filename := s.generateUniqueFilename(header.Filename)
-
 	// Create attachment record
-	attachment := &domain.Attachment{
-		MessageID: messageID,
-		FileName:  header.Filename,
-		FileType:  contentType,
-		FileSize:  header.Size,
-		IsImage:   s.isImageType(contentType),
-	}
+	attachment := s.newAttachment(messageID, userID, header.Filename, contentType, header.Size)
 
 	// Begin upload - broadcast uploading status
 	s.broadcastAttachmentStatus(attachment, "uploading", 0, channelID)
 
-	// Check if it's an image that needs processing
-	if attachment.IsImage {
-		// Read the file for image processing while keeping a copy for storage
-		var buf bytes.Buffer
-		tee := io.TeeReader(file, &buf)
+	// Upload to storage provider before the record refers to it; files
+	// left behind by a failed insert are collected as unreferenced
+	fileID, err := s.storeFile(ctx, file, header.Filename, contentType)
+	if err != nil {
+		s.broadcastAttachmentStatus(attachment, "error", 0, channelID)
+		return nil, fmt.Errorf("failed to upload file: %w", err)
+	}
+	attachment.StorageKey = fileID
+
+	if err := s.repo.CreateAttachment(ctx, attachment); err != nil {
+		s.broadcastAttachmentStatus(attachment, "error", 0, channelID)
+		return nil, err
+	}
+
+	// Broadcast scanning status; the scan job publishes the file
+	s.broadcastAttachmentStatus(attachment, "scanning", 0, channelID)
+	s.enqueueScan(ctx, attachment, channelID, userID)
+
+	return attachment, nil
+}
+
+// newAttachment returns the record of a new upload. It is quarantined until
+// scanned, and images until they are processed too, since the original
+// may carry EXIF and GPS metadata; Available reports when its URL may be
+// followed.
+func (s *AttachmentService) newAttachment(messageID, userID uuid.UUID, fileName, contentType string, size int64) *Attachment {
+	attachment := &Attachment{
+		ID:         uuid.New(),
+		MessageID:  messageID,
+		UploadedBy: userID,
+		FileName:   fileName,
+		FileType:   contentType,
+		FileSize:   size,
+		ScanStatus: ScanStatusPending,
+	}
+	attachment.FileURL = s.fileURL(attachment.ID, "")
+	if attachment.IsImage() {
+		attachment.ProcessingStatus = ProcessingStatusProcessing
+	}
+	return attachment
+}
+
+// enqueueImageProcessing schedules an uploaded image for processing
+func (s *AttachmentService) enqueueImageProcessing(ctx context.Context, attachment *Attachment, channelID uuid.UUID) {
+	payload := processImagePayload{AttachmentID: attachment.ID, ChannelID: channelID}
+
+	if s.jobs == nil {
+		go func() {
+			if err := s.ProcessImage(context.Background(), payload.AttachmentID, payload.ChannelID); err != nil {
+				log.Printf("Failed to process image attachment %s: %v", payload.AttachmentID, err)
+				s.failImageProcessing(context.Background(), payload.AttachmentID, payload.ChannelID)
+			}
+		}()
+		return
+	}
+
+	if _, err := s.jobs.Enqueue(ctx, ProcessImageJobType, payload); err != nil {
+		log.Printf("Failed to enqueue image attachment %s: %v", attachment.ID, err)
+		s.failImageProcessing(ctx, attachment.ID, channelID)
+	}
+}
+
+// ImageProcessor returns the queue processor for ProcessImageJobType jobs.
+// Failed jobs are retried; once out of attempts the attachment is marked
+// as failed.
+func (s *AttachmentService) ImageProcessor() queue.Processor {
+	return queue.ProcessorFunc(func(ctx context.Context, job *queue.Job) error {
+		var payload processImagePayload
+		if err := job.Decode(&payload); err != nil {
+			return err
+		}
 
-		// Get image dimensions (for future use, not stored in current model)
-		_, format, err := image.DecodeConfig(tee)
-		if err == nil {
-			attachment.FileType = "image/" + format
+		err := s.ProcessImage(ctx, payload.AttachmentID, payload.ChannelID)
+		if err != nil && job.Attempts >= job.MaxAttempts {
+			s.failImageProcessing(ctx, payload.AttachmentID, payload.ChannelID)
 		}
+		return err
+	})
+}
 
-		// Reset file reader position
-		file.Seek(0, io.SeekStart)
+// ProcessImage strips the metadata of an uploaded image, records its
+// dimensions and stores its thumbnails and blurhash. Progress is broadcast
+// to the channel. Images that cannot be decoded are marked as failed
+// rather than returned as errors, since retrying would not help.
+func (s *AttachmentService) ProcessImage(ctx context.Context, attachmentID uuid.UUID, channelID uuid.UUID) error {
+	attachment, err := s.repo.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return err
+	}
+	if attachment.ProcessingStatus != ProcessingStatusProcessing || attachment.ScanStatus != ScanStatusClean {
+		// Already processed by an earlier attempt, or not cleared by a scan
+		return nil
 	}
 
-	// Save the attachment record to get an ID
-	if err := s.repo.CreateAttachment(ctx, attachment); err != nil {
-		return nil, errors.WrapError(err, errors.ErrorTypeDatabase, "db_error", "Failed to create attachment record")
+	s.broadcastAttachmentStatus(attachment, "processing", 10, channelID)
+
+	original, _, err := s.storage.Download(ctx, attachment.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open attachment %s: %w", attachmentID, err)
+	}
+	result, err := imaging.Process(original, s.imaging)
+	original.Close()
+	if err != nil {
+		if errors.Is(err, imaging.ErrUnsupportedFormat) || errors.Is(err, imaging.ErrImageTooLarge) {
+			log.Printf("Cannot process image attachment %s: %v", attachmentID, err)
+			s.failImageProcessing(ctx, attachmentID, channelID)
+			return nil
+		}
+		return err
 	}
 
-	// Upload to storage provider
-	fileID, fileURL, err := s.storage.StoreFile(ctx, file, filename, contentType)
+	s.broadcastAttachmentStatus(attachment, "processing", 40, channelID)
+
+	// Store everything under new names before touching the record, so a
+	// failed attempt leaves the original in place for the retry
+	strippedKey, err := s.storeFile(ctx, bytes.NewReader(result.Original), attachment.FileName, result.ContentType)
 	if err != nil {
-		// Handle upload failure
-		s.repo.UpdateAttachment(ctx, attachment)
+		return fmt.Errorf("failed to store processed image: %w", err)
+	}
 
-		s.broadcastAttachmentStatus(attachment, "error", 0, channelID)
-		return nil, errors.WrapError(err, errors.ErrorTypeInternal, "upload_failed", "Failed to upload file")
+	stored := []string{strippedKey}
+	thumbnails := make(map[string]string, len(result.Thumbnails))
+	for i, thumb := range result.Thumbnails {
+		key, err := s.storeFile(ctx, bytes.NewReader(thumb.Data), thumb.Name+thumb.Extension, thumb.ContentType)
+		if err != nil {
+			s.deleteFiles(ctx, stored)
+			return fmt.Errorf("failed to store %s thumbnail: %w", thumb.Name, err)
+		}
+		stored = append(stored, key)
+		thumbnails[thumb.Name] = key
+		s.broadcastAttachmentStatus(attachment, "processing", 40+50*(i+1)/len(result.Thumbnails), channelID)
 	}
 
-	// Update attachment with storage details
-	// Note: fileID is stored separately for internal tracking
-	_ = fileID // We'll use this for deletion
-	attachment.FileURL = fileURL
+	originalKey := attachment.StorageKey
+	attachment.StorageKey = strippedKey
+	attachment.FileType = result.ContentType
+	attachment.FileSize = int64(len(result.Original))
+	attachment.Width = result.Width
+	attachment.Height = result.Height
+	attachment.Blurhash = result.Blurhash
+	if key, ok := thumbnails["small"]; ok {
+		attachment.ThumbnailKey, attachment.ThumbnailURL = key, s.fileURL(attachment.ID, VariantThumbnail)
+	}
+	if key, ok := thumbnails["large"]; ok {
+		attachment.PreviewKey, attachment.PreviewURL = key, s.fileURL(attachment.ID, VariantPreview)
+	}
+	attachment.ProcessingStatus = ProcessingStatusComplete
 
-	// Save the updated attachment
 	if err := s.repo.UpdateAttachment(ctx, attachment); err != nil {
-		// Log error but don't fail - file is already uploaded
-		// Consider a cleanup process for orphaned files
+		s.deleteFiles(ctx, stored)
+		return err
 	}
 
-	// Broadcast attachment complete
-	s.broadcastAttachmentStatus(attachment, "complete", 100, channelID)
+	// The original still has its metadata, so it is not kept
+	s.deleteFiles(ctx, []string{originalKey})
 
-	return attachment, nil
+	s.broadcastAttachmentStatus(attachment, "complete", 100, channelID)
+	return nil
 }
 
-// DeleteAttachment removes an attachment
-func (s *AttachmentService) DeleteAttachment(ctx context.Context, attachmentID uint, userID uint) error {
-	// Get the attachment
+// failImageProcessing marks an image that could not be processed. Its
+// original stays unpublished.
+func (s *AttachmentService) failImageProcessing(ctx context.Context, attachmentID uuid.UUID, channelID uuid.UUID) {
 	attachment, err := s.repo.GetAttachment(ctx, attachmentID)
 	if err != nil {
-		return errors.ErrAttachmentNotFound
+		return
 	}
 
-	// For now, we'll assume any authenticated user can delete their message attachments
-	// This would normally check against the message owner or channel admin
-	// TODO: Add proper permission checking when message ownership is available
+	attachment.ProcessingStatus = ProcessingStatusFailed
+	if err := s.repo.UpdateAttachment(ctx, attachment); err != nil {
+		log.Printf("Failed to mark image attachment %s as failed: %v", attachmentID, err)
+	}
+	s.broadcastAttachmentStatus(attachment, "error", 0, channelID)
+}
 
-	// Delete from storage using the FileURL to derive the file ID
-	// In a real implementation, we'd store the fileID separately
-	if attachment.FileURL != "" {
-		// Extract file ID from URL or use URL as identifier
-		if err := s.storage.DeleteFile(ctx, attachment.FileURL); err != nil {
-			// Log error but continue with deletion from database
+// deleteFiles removes stored files, logging failures
+func (s *AttachmentService) deleteFiles(ctx context.Context, fileIDs []string) {
+	for _, fileID := range fileIDs {
+		if fileID == "" {
+			continue
+		}
+		if err := s.storage.Delete(ctx, fileID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Failed to delete attachment file %s: %v", fileID, err)
 		}
 	}
+}
 
-	// Delete from database
+// DeleteAttachment removes an attachment. Only its uploader may remove it.
+func (s *AttachmentService) DeleteAttachment(ctx context.Context, attachmentID uuid.UUID, userID uuid.UUID) error {
+	// Get the attachment
+	attachment, err := s.repo.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return err
+	}
+	if attachment.UploadedBy != userID {
+		return ErrNotPermitted
+	}
+
+	// Delete from database first, so no record refers to a deleted file
 	if err := s.repo.DeleteAttachment(ctx, attachmentID); err != nil {
-		return errors.WrapError(err, errors.ErrorTypeDatabase, "delete_failed", "Failed to delete attachment")
+		return err
 	}
 
+	// Delete from storage, along with any thumbnails
+	s.deleteFiles(ctx, []string{attachment.StorageKey, attachment.ThumbnailKey, attachment.PreviewKey})
 	return nil
 }
 
 // GetAttachments retrieves attachments for a message
-func (s *AttachmentService) GetAttachments(ctx context.Context, messageID uint) ([]domain.Attachment, error) {
+func (s *AttachmentService) GetAttachments(ctx context.Context, messageID uuid.UUID) ([]Attachment, error) {
 	return s.repo.GetMessageAttachments(ctx, messageID)
 }
 
@@ -207,36 +417,46 @@ func (s *AttachmentService) isAllowedFileType(contentType string) bool {
 	return false
 }
 
-// isImageType determines if the content type is an image
-func (s *AttachmentService) isImageType(contentType string) bool {
-	return strings.HasPrefix(contentType, "image/")
+// storeFile stores a file under a unique key with the original extension
+func (s *AttachmentService) storeFile(ctx context.Context, file io.Reader, originalName string, contentType string) (string, error) {
+	key := KeyPrefix + s.generateUniqueFilename(originalName)
+	if _, err := s.storage.Upload(ctx, key, file, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
 }
 
 // generateUniqueFilename creates a unique filename with original extension
 func (s *AttachmentService) generateUniqueFilename(originalName string) string {
-	ext := filepath.Ext(originalName)
+	ext := strings.ToLower(filepath.Ext(originalName))
 	return fmt.Sprintf("%s%s", uuid.New().String(), ext)
 }
 
 // broadcastAttachmentStatus sends attachment status updates to WebSocket clients
 func (s *AttachmentService) broadcastAttachmentStatus(
-	attachment *domain.Attachment,
+	attachment *Attachment,
 	status string,
 	progress int,
-	channelID uint,
+	channelID uuid.UUID,
 ) {
+	if s.broadcaster == nil {
+		return
+	}
+
+	event := websocket.AttachmentEvent{
+		Type:         websocket.EventTypeAttachment,
+		AttachmentID: attachment.ID.String(),
+		MessageID:    attachment.MessageID.String(),
+		ChannelID:    channelID.String(),
+		Status:       status,
+		Progress:     progress,
+		Timestamp:    time.Now().Unix(),
+	}
+	if status == "complete" {
+		// Clients need the URLs, dimensions and placeholder to display it
+		event.Attachment = attachment
+	}
+
 	// Broadcast via WebSocket
-	s.hub.BroadcastToChannel(
-		channelID,
-		websocket.EventTypeAttachment,
-		websocket.AttachmentEvent{
-			Type:         websocket.EventTypeAttachment,
-			AttachmentID: attachment.ID,
-			MessageID:    attachment.MessageID,
-			ChannelID:    channelID,
-			Status:       status,
-			Progress:     progress,
-			Timestamp:    time.Now().Unix(),
-		},
-	)
+	s.broadcaster.BroadcastToChannel(channelID, websocket.EventTypeAttachment, event)
 }
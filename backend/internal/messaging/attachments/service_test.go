@@ -0,0 +1,347 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/scanning"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
+)
+
+type recordingBroadcaster struct {
+	mu       sync.Mutex
+	statuses []string
+}
+
+func (b *recordingBroadcaster) BroadcastToChannel(channelID uuid.UUID, msgType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statuses = append(b.statuses, data.(websocket.AttachmentEvent).Status)
+}
+
+func (b *recordingBroadcaster) last() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.statuses[len(b.statuses)-1]
+}
+
+// recordingQueue keeps enqueued jobs for the test to run
+type recordingQueue struct {
+	jobs []*queue.Job
+}
+
+func (q *recordingQueue) Enqueue(ctx context.Context, jobType string, payload interface{}) (*queue.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &queue.Job{ID: uuid.New(), Type: jobType, Payload: data, MaxAttempts: 5}
+	q.jobs = append(q.jobs, job)
+	return job, nil
+}
+
+// infectedScanner finds every file infected
+type infectedScanner struct{}
+
+func (infectedScanner) Scan(ctx context.Context, r io.Reader) (*scanning.Verdict, error) {
+	return &scanning.Verdict{Signature: "Eicar-Test-Signature"}, nil
+}
+
+type recordingModerator struct {
+	blocked []uuid.UUID
+}
+
+func (m *recordingModerator) AttachmentBlocked(ctx context.Context, attachment *Attachment, channelID uuid.UUID, uploaderID uuid.UUID, verdict *scanning.Verdict) error {
+	m.blocked = append(m.blocked, uploaderID)
+	return nil
+}
+
+type testEnv struct {
+	db          *gorm.DB
+	service     *AttachmentService
+	storage     *storage.Provider
+	broadcaster *recordingBroadcaster
+	jobs        *recordingQueue
+
+	// user is a member of channel, where they sent message; other is not
+	user    uuid.UUID
+	other   uuid.UUID
+	channel uuid.UUID
+	message uuid.UUID
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Attachment{}))
+	for _, statement := range []string{
+		`CREATE TABLE messaging_channel_members (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT)`,
+		`CREATE TABLE messaging_messages (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT)`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	provider, err := storage.NewProvider(&storage.Config{
+		Type:       storage.StorageTypeLocal,
+		BasePath:   t.TempDir(),
+		BaseURL:    "http://localhost:8080/files",
+		SigningKey: "test-signing-key",
+	})
+	require.NoError(t, err)
+
+	env := &testEnv{
+		db:          db,
+		storage:     provider,
+		broadcaster: &recordingBroadcaster{},
+		jobs:        &recordingQueue{},
+		user:        uuid.New(),
+		other:       uuid.New(),
+		channel:     uuid.New(),
+		message:     uuid.New(),
+	}
+	env.service = NewAttachmentService(provider, NewRepository(db), env.broadcaster, 1<<20)
+	env.service.SetJobQueue(env.jobs)
+	require.NoError(t, db.Exec("INSERT INTO messaging_channel_members (id, channel_id, user_id) VALUES (?, ?, ?)",
+		uuid.New(), env.channel, env.user).Error)
+	require.NoError(t, db.Exec("INSERT INTO messaging_messages (id, channel_id, user_id) VALUES (?, ?, ?)",
+		env.message, env.channel, env.user).Error)
+	return env
+}
+
+// upload stores a completed resumable upload of the user
+func (e *testEnv) upload(t *testing.T, name string, contents []byte) *uploads.Upload {
+	t.Helper()
+
+	upload := &uploads.Upload{
+		ID:         uuid.New(),
+		UserID:     e.user,
+		ChannelID:  e.channel,
+		FileName:   name,
+		Length:     int64(len(contents)),
+		StorageKey: uploads.KeyPrefix + uuid.NewString(),
+	}
+	_, err := e.storage.Upload(context.Background(), upload.StorageKey, bytes.NewReader(contents), "")
+	require.NoError(t, err)
+	return upload
+}
+
+// runJobs runs the enqueued jobs, including the ones they enqueue
+func (e *testEnv) runJobs(t *testing.T) {
+	t.Helper()
+
+	processors := map[string]queue.Processor{
+		ScanJobType:         e.service.ScanProcessor(),
+		ProcessImageJobType: e.service.ImageProcessor(),
+	}
+	for len(e.jobs.jobs) > 0 {
+		job := e.jobs.jobs[0]
+		e.jobs.jobs = e.jobs.jobs[1:]
+		job.Attempts = 1
+		require.NoError(t, processors[job.Type].Process(context.Background(), job))
+	}
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 48; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestFinalizeUpload(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	upload := env.upload(t, "notes.txt", []byte("plain text notes"))
+	attachment, err := env.service.FinalizeUpload(ctx, upload, env.message)
+	require.NoError(t, err)
+	assert.Equal(t, env.message, attachment.MessageID)
+	assert.Equal(t, env.user, attachment.UserID)
+	assert.Equal(t, "text/plain", attachment.FileType)
+	assert.Equal(t, DefaultURLPrefix+"/"+attachment.ID.String(), attachment.FileURL)
+	assert.Equal(t, "scanning", env.broadcaster.last())
+
+	// Quarantined until scanned
+	_, err = env.service.DownloadURL(ctx, attachment.ID, env.user, "")
+	assert.ErrorIs(t, err, ErrUnavailable)
+
+	env.runJobs(t)
+	assert.Equal(t, "complete", env.broadcaster.last())
+
+	signed, err := env.service.DownloadURL(ctx, attachment.ID, env.user, "")
+	require.NoError(t, err)
+	assert.Contains(t, signed, url.PathEscape(upload.StorageKey))
+	assert.Contains(t, signed, "signature=")
+
+	_, err = env.service.DownloadURL(ctx, attachment.ID, env.other, "")
+	assert.ErrorIs(t, err, ErrAttachmentNotFound, "attachments of other channels are not disclosed")
+	_, err = env.service.DownloadURL(ctx, attachment.ID, env.user, VariantThumbnail)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound, "only images have thumbnails")
+
+	t.Run("disallowed types", func(t *testing.T) {
+		upload := env.upload(t, "page.html", []byte("<!DOCTYPE html><html><script></script></html>"))
+		_, err := env.service.FinalizeUpload(ctx, upload, env.message)
+		assert.ErrorIs(t, err, uploads.ErrUploadRejected)
+	})
+}
+
+func TestFinalizeImageUpload(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	upload := env.upload(t, "photo.PNG", pngImage(t))
+	finalized, err := env.service.FinalizeUpload(ctx, upload, env.message)
+	require.NoError(t, err)
+	env.runJobs(t)
+	assert.Equal(t, "complete", env.broadcaster.last())
+
+	attachments, err := env.service.GetAttachments(ctx, env.message)
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	attachment := attachments[0]
+	assert.Equal(t, finalized.ID, attachment.ID)
+	assert.Equal(t, ProcessingStatusComplete, attachment.ProcessingStatus)
+	assert.Equal(t, 64, attachment.Width)
+	assert.NotEmpty(t, attachment.Blurhash)
+	assert.Equal(t, finalized.FileURL, attachment.FileURL, "the URL does not change when the file does")
+	assert.Equal(t, attachment.FileURL+"/"+VariantThumbnail, attachment.ThumbnailURL)
+
+	// The original, which may carry metadata, is replaced by a stripped copy
+	assert.NotEqual(t, upload.StorageKey, attachment.StorageKey)
+	_, _, err = env.storage.Download(ctx, upload.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	signed, err := env.service.DownloadURL(ctx, attachment.ID, env.user, VariantThumbnail)
+	require.NoError(t, err)
+	assert.Contains(t, signed, url.PathEscape(attachment.ThumbnailKey))
+
+	require.NoError(t, env.service.DeleteAttachment(ctx, attachment.ID, env.user))
+	_, _, err = env.storage.Download(ctx, attachment.ThumbnailKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestBlockedUpload(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	moderator := &recordingModerator{}
+	env.service.SetScanner(infectedScanner{})
+	env.service.SetModerator(moderator)
+
+	upload := env.upload(t, "notes.txt", []byte("not really a virus"))
+	attachment, err := env.service.FinalizeUpload(ctx, upload, env.message)
+	require.NoError(t, err)
+	env.runJobs(t)
+
+	assert.Equal(t, "blocked", env.broadcaster.last())
+	assert.Equal(t, []uuid.UUID{env.user}, moderator.blocked)
+	_, _, err = env.storage.Download(ctx, upload.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = env.service.DownloadURL(ctx, attachment.ID, env.user, "")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestAuditModerator(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	require.NoError(t, env.db.Exec(`CREATE TABLE audit_logs (
+		id TEXT PRIMARY KEY, user_id TEXT, action TEXT, entity_type TEXT, entity_id TEXT,
+		metadata TEXT, created_at DATETIME)`).Error)
+	env.service.SetScanner(infectedScanner{})
+	env.service.SetModerator(NewAuditModerator(env.db))
+
+	upload := env.upload(t, "notes.txt", []byte("not really a virus"))
+	attachment, err := env.service.FinalizeUpload(ctx, upload, env.message)
+	require.NoError(t, err)
+	env.runJobs(t)
+
+	var entry auditLog
+	require.NoError(t, env.db.Take(&entry).Error)
+	assert.Equal(t, env.user, entry.UserID)
+	assert.Equal(t, WarningAction, entry.Action)
+	assert.Equal(t, "attachment", entry.EntityType)
+	assert.Equal(t, attachment.ID, entry.EntityID)
+
+	var metadata moderationMetadata
+	require.NoError(t, json.Unmarshal([]byte(entry.Metadata), &metadata))
+	assert.Equal(t, domain.ModerationActionWarn, metadata.Action)
+	assert.Equal(t, env.channel, metadata.ChannelID)
+	assert.Equal(t, env.message, metadata.MessageID)
+	assert.Equal(t, "notes.txt", metadata.FileName)
+	assert.NotEmpty(t, metadata.Signature)
+}
+
+func TestHandlerDownload(t *testing.T) {
+	env := newTestEnv(t)
+	upload := env.upload(t, "notes.txt", []byte("plain text notes"))
+	attachment, err := env.service.FinalizeUpload(context.Background(), upload, env.message)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api/v1/messaging", func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Set("user_id", user)
+		}
+	})
+	NewHandler(env.service).RegisterRoutes(api)
+
+	download := func(user uuid.UUID, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if user != uuid.Nil {
+			req.Header.Set("X-User", user.String())
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusConflict, download(env.user, attachment.FileURL).Code)
+	env.runJobs(t)
+
+	rec := download(env.user, attachment.FileURL)
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Location"), "http://localhost:8080/files/"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusUnauthorized, download(uuid.Nil, attachment.FileURL).Code)
+	assert.Equal(t, http.StatusNotFound, download(env.other, attachment.FileURL).Code)
+	assert.Equal(t, http.StatusNotFound, download(env.user, attachment.FileURL+"/original").Code)
+	assert.Equal(t, http.StatusNotFound, download(env.user, DefaultURLPrefix+"/"+uuid.NewString()).Code)
+}
@@ -0,0 +1,324 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// TusVersion is the version of the tus protocol spoken by the handler
+	TusVersion = "1.0.0"
+
+	// tusExtensions are the tus extensions the handler supports
+	tusExtensions = "creation,expiration,termination"
+
+	// offsetContentType is the content type of PATCH requests
+	offsetContentType = "application/offset+octet-stream"
+)
+
+// Handler serves resumable uploads over the tus protocol. Clients create
+// an upload, send its bytes with PATCH requests, resuming from the offset
+// reported by HEAD after an interruption, and finalize it into an
+// attachment of their message.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new upload handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers the upload routes. The group must authenticate
+// the user and set "user_id".
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
+	uploads := router.Group("/uploads")
+	uploads.Use(h.tusResumable)
+	{
+		uploads.OPTIONS("", h.Options)
+		uploads.POST("", h.Create)
+		uploads.HEAD("/:id", h.Head)
+		uploads.PATCH("/:id", h.Patch)
+		uploads.DELETE("/:id", h.Terminate)
+		uploads.POST("/:id/finalize", h.Finalize)
+	}
+}
+
+// tusResumable checks the protocol version clients send with every request
+// other than OPTIONS, and reports the server's in every response
+func (h *Handler) tusResumable(c *gin.Context) {
+	c.Header("Tus-Resumable", TusVersion)
+
+	if c.Request.Method == http.MethodOptions || strings.HasSuffix(c.FullPath(), "/finalize") {
+		c.Next()
+		return
+	}
+	if c.GetHeader("Tus-Resumable") != TusVersion {
+		c.Header("Tus-Version", TusVersion)
+		c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{"error": "Unsupported tus version"})
+		return
+	}
+	c.Next()
+}
+
+// Options reports the supported protocol version, extensions and size
+func (h *Handler) Options(c *gin.Context) {
+	c.Header("Tus-Version", TusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.service.MaxSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Create starts an upload. The file's size is sent in Upload-Length; its
+// name, type and channel in the filename, filetype and channelId keys of
+// Upload-Metadata.
+func (h *Handler) Create(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Deferred upload length is not supported"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Length"})
+		return
+	}
+
+	metadata, err := parseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Metadata"})
+		return
+	}
+	fileName := metadata["filename"]
+	if fileName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "filename is required"})
+		return
+	}
+	channelID, err := uuid.Parse(metadata["channelId"])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "channelId is required"})
+		return
+	}
+
+	upload, err := h.service.Create(c.Request.Context(), userID, channelID, fileName, metadata["filetype"], length)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID.String())
+	c.Header("Upload-Offset", "0")
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.JSON(http.StatusCreated, upload)
+}
+
+// Head reports how many bytes of an upload have been received
+func (h *Handler) Head(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := uploadID(c)
+	if !ok {
+		return
+	}
+
+	upload, err := h.service.Get(c.Request.Context(), id, userID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if !upload.Complete() {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+}
+
+// Patch appends the request body to an upload at Upload-Offset
+func (h *Handler) Patch(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := uploadID(c)
+	if !ok {
+		return
+	}
+
+	if c.ContentType() != offsetContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be " + offsetContentType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Offset"})
+		return
+	}
+
+	// Refuse bodies that would run past the declared length up front,
+	// rather than storing part of them
+	if c.Request.ContentLength > 0 {
+		upload, err := h.service.Get(c.Request.Context(), id, userID)
+		if err != nil {
+			h.respondError(c, err)
+			return
+		}
+		if offset+c.Request.ContentLength > upload.Length {
+			h.respondError(c, ErrUploadTooLarge)
+			return
+		}
+	}
+
+	upload, err := h.service.Write(c.Request.Context(), id, userID, offset, c.Request.Body)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if !upload.Complete() {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Terminate discards an upload
+func (h *Handler) Terminate(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := uploadID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Terminate(c.Request.Context(), id, userID); err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// FinalizeRequest attaches a completed upload to a message
+type FinalizeRequest struct {
+	MessageID uuid.UUID `json:"messageId" binding:"required"`
+}
+
+// Finalize turns a completed upload into an attachment of a message
+func (h *Handler) Finalize(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := uploadID(c)
+	if !ok {
+		return
+	}
+
+	var req FinalizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+		return
+	}
+
+	attachment, err := h.service.Finalize(c.Request.Context(), id, userID, req.MessageID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// respondError maps service errors to tus status codes
+func (h *Handler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUploadNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+	case errors.Is(err, ErrUploadExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "Upload expired"})
+	case errors.Is(err, ErrUploadLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": "Upload is in use by another request"})
+	case errors.Is(err, ErrOffsetMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset does not match the upload's offset"})
+	case errors.Is(err, ErrUploadTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Upload too large"})
+	case errors.Is(err, ErrInvalidLength):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Upload-Length"})
+	case errors.Is(err, ErrUploadComplete), errors.Is(err, ErrUploadIncomplete), errors.Is(err, ErrUploadFinalized):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUploadRejected):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotPermitted):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not permitted"})
+	default:
+		log.Printf("Upload request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Upload failed"})
+	}
+}
+
+// parseMetadata decodes an Upload-Metadata header: comma separated keys,
+// each followed by its base64 encoded value
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func uploadID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// requireUserID returns the authenticated user, responding with 401 if
+// there is none. Authentication middlewares store the ID as a string or
+// as a UUID.
+func requireUserID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("user_id")
+	if exists {
+		switch id := value.(type) {
+		case uuid.UUID:
+			if id != uuid.Nil {
+				return id, true
+			}
+		case string:
+			if parsed, err := uuid.Parse(id); err == nil {
+				return parsed, true
+			}
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	return uuid.Nil, false
+}
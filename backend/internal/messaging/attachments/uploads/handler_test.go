@@ -0,0 +1,170 @@
+package uploads
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(t *testing.T, env *testEnv) *gin.Engine {
+	t.Helper()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	api := router.Group("/api/messaging", func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			return
+		}
+		c.Set("user_id", env.user.String())
+	})
+	NewHandler(env.service).RegisterRoutes(api)
+	return router
+}
+
+func tusRequest(method string, target string, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", TusVersion)
+	req.Header.Set("Authorization", "Bearer token")
+	return req
+}
+
+func serve(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func metadata(pairs ...string) string {
+	encoded := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		encoded = append(encoded, pairs[i]+" "+base64.StdEncoding.EncodeToString([]byte(pairs[i+1])))
+	}
+	return strings.Join(encoded, ",")
+}
+
+func TestHandlerUploadFlow(t *testing.T) {
+	env := newTestEnv(t)
+	router := newTestRouter(t, env)
+	const contents = "resumable"
+
+	rec := serve(router, tusRequest(http.MethodOptions, "/api/messaging/uploads", ""))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, TusVersion, rec.Header().Get("Tus-Version"))
+	assert.Contains(t, rec.Header().Get("Tus-Extension"), "creation")
+	assert.Equal(t, "1024", rec.Header().Get("Tus-Max-Size"))
+
+	req := tusRequest(http.MethodPost, "/api/messaging/uploads", "")
+	req.Header.Set("Upload-Length", strconv.Itoa(len(contents)))
+	req.Header.Set("Upload-Metadata", metadata("filename", "notes.txt", "filetype", "text/plain", "channelId", env.channel.String()))
+	rec = serve(router, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	location := rec.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "/api/messaging/uploads/"))
+	assert.Equal(t, TusVersion, rec.Header().Get("Tus-Resumable"))
+	assert.NotEmpty(t, rec.Header().Get("Upload-Expires"))
+
+	patch := func(offset int, body string) *httptest.ResponseRecorder {
+		req := tusRequest(http.MethodPatch, location, body)
+		req.Header.Set("Content-Type", offsetContentType)
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		return serve(router, req)
+	}
+
+	rec = patch(0, contents[:5])
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, "5", rec.Header().Get("Upload-Offset"))
+
+	rec = patch(2, "xyz")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serve(router, tusRequest(http.MethodHead, location, ""))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("Upload-Offset"))
+	assert.Equal(t, strconv.Itoa(len(contents)), rec.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	rec = patch(5, contents[5:]+"overflow")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = serve(router, tusRequest(http.MethodPost, location+"/finalize", `{"messageId": "`+env.message.String()+`"}`))
+	assert.Equal(t, http.StatusConflict, rec.Code, "incomplete uploads cannot be finalized")
+
+	rec = patch(5, contents[5:])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, strconv.Itoa(len(contents)), rec.Header().Get("Upload-Offset"))
+
+	rec = serve(router, tusRequest(http.MethodPost, location+"/finalize", `{"messageId": "`+env.message.String()+`"}`))
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"message_id":"`+env.message.String()+`"`)
+	require.Len(t, env.finalizer.finalized, 1)
+	assert.Equal(t, contents, env.contents(t, env.finalizer.finalized[0].StorageKey))
+}
+
+func TestHandlerRejections(t *testing.T) {
+	env := newTestEnv(t)
+	router := newTestRouter(t, env)
+
+	create := func(length string, meta string) *httptest.ResponseRecorder {
+		req := tusRequest(http.MethodPost, "/api/messaging/uploads", "")
+		req.Header.Set("Upload-Length", length)
+		req.Header.Set("Upload-Metadata", meta)
+		return serve(router, req)
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		req := tusRequest(http.MethodPost, "/api/messaging/uploads", "")
+		req.Header.Del("Authorization")
+		assert.Equal(t, http.StatusUnauthorized, serve(router, req).Code)
+	})
+
+	t.Run("unsupported protocol version", func(t *testing.T) {
+		req := tusRequest(http.MethodPost, "/api/messaging/uploads", "")
+		req.Header.Set("Tus-Resumable", "0.2.2")
+		rec := serve(router, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Equal(t, TusVersion, rec.Header().Get("Tus-Version"))
+	})
+
+	t.Run("invalid creation requests", func(t *testing.T) {
+		valid := metadata("filename", "a.txt", "channelId", env.channel.String())
+		assert.Equal(t, http.StatusBadRequest, create("", valid).Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, create("4096", valid).Code)
+		assert.Equal(t, http.StatusBadRequest, create("4", metadata("filename", "a.txt")).Code)
+		assert.Equal(t, http.StatusBadRequest, create("4", "filename not-base64!").Code)
+		assert.Equal(t, http.StatusBadRequest, create("4", metadata("filename", "a.txt", "channelId", "10")).Code)
+	})
+
+	t.Run("channel the user is not a member of", func(t *testing.T) {
+		rec := create("4", metadata("filename", "a.txt", "channelId", uuid.New().String()))
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("wrong content type", func(t *testing.T) {
+		rec := create("4", metadata("filename", "a.txt", "channelId", env.channel.String()))
+		require.Equal(t, http.StatusCreated, rec.Code)
+
+		req := tusRequest(http.MethodPatch, rec.Header().Get("Location"), "data")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Upload-Offset", "0")
+		assert.Equal(t, http.StatusUnsupportedMediaType, serve(router, req).Code)
+	})
+
+	t.Run("unknown and terminated uploads", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(router, tusRequest(http.MethodHead, "/api/messaging/uploads/not-an-id", "")).Code)
+
+		rec := create("4", metadata("filename", "a.txt", "channelId", env.channel.String()))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		location := rec.Header().Get("Location")
+
+		assert.Equal(t, http.StatusNoContent, serve(router, tusRequest(http.MethodDelete, location, "")).Code)
+		assert.Equal(t, http.StatusNotFound, serve(router, tusRequest(http.MethodHead, location, "")).Code)
+	})
+}
@@ -0,0 +1,494 @@
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPartSize is the size of the parts uploads are stored in
+	DefaultPartSize = 8 * 1024 * 1024
+
+	// DefaultMaxSize is the largest upload accepted by default
+	DefaultMaxSize = 1024 * 1024 * 1024
+
+	// DefaultExpiry is how long an upload may stay idle before it expires
+	DefaultExpiry = 24 * time.Hour
+
+	// leaseDuration is how long a write holds an upload without storing a
+	// part. It is renewed with every part.
+	leaseDuration = 5 * time.Minute
+
+	// expireBatchSize is how many expired uploads are removed at a time
+	expireBatchSize = 100
+)
+
+// Config tunes resumable uploads
+type Config struct {
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize int64
+	// PartSize is the size of the parts uploads are stored in. It is raised
+	// to the minimum the storage backend accepts.
+	PartSize int64
+	// Expiry is how long an upload may stay idle before it expires
+	Expiry time.Duration
+}
+
+// ProgressNotifier is told how far uploads have got, so the uploader's
+// other clients can show progress. It is satisfied by *messaging.Service,
+// which maps users to the WebSocket hub's IDs.
+type ProgressNotifier interface {
+	BroadcastToUser(userID uuid.UUID, msgType string, data interface{})
+}
+
+// Finalizer turns completed uploads into attachments of a message. The
+// upload's user has been checked to be the message's author.
+type Finalizer interface {
+	FinalizeUpload(ctx context.Context, upload *Upload, messageID uuid.UUID) (*domain.Attachment, error)
+}
+
+// Service manages resumable uploads
+type Service struct {
+	db        *gorm.DB
+	storage   *storage.Provider
+	config    Config
+	notifier  ProgressNotifier
+	finalizer Finalizer
+}
+
+// NewService creates a new upload service
+func NewService(db *gorm.DB, provider *storage.Provider, config Config) *Service {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = DefaultPartSize
+	}
+	if minPart := provider.MinPartSize(); config.PartSize < minPart {
+		config.PartSize = minPart
+	}
+	if config.Expiry <= 0 {
+		config.Expiry = DefaultExpiry
+	}
+
+	return &Service{
+		db:      db,
+		storage: provider,
+		config:  config,
+	}
+}
+
+// SetNotifier sets who is told about upload progress
+func (s *Service) SetNotifier(notifier ProgressNotifier) {
+	s.notifier = notifier
+}
+
+// SetFinalizer sets what turns completed uploads into attachments
+func (s *Service) SetFinalizer(finalizer Finalizer) {
+	s.finalizer = finalizer
+}
+
+// MaxSize returns the largest upload accepted
+func (s *Service) MaxSize() int64 {
+	return s.config.MaxSize
+}
+
+// Create starts an upload of length bytes into a channel the user is a
+// member of
+func (s *Service) Create(ctx context.Context, userID uuid.UUID, channelID uuid.UUID, fileName string, contentType string, length int64) (*Upload, error) {
+	if length <= 0 {
+		return nil, ErrInvalidLength
+	}
+	if length > s.config.MaxSize {
+		return nil, ErrUploadTooLarge
+	}
+	if err := s.checkMember(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	upload := &Upload{
+		ID:          id,
+		UserID:      userID,
+		ChannelID:   channelID,
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+		Length:      length,
+		StorageKey:  KeyPrefix + id.String() + strings.ToLower(filepath.Ext(fileName)),
+		Parts:       Parts{},
+		ExpiresAt:   time.Now().Add(s.config.Expiry),
+	}
+
+	multipartID, err := s.storage.CreateMultipartUpload(ctx, upload.StorageKey, contentType)
+	if err != nil {
+		return nil, err
+	}
+	upload.MultipartID = multipartID
+
+	if err := s.db.WithContext(ctx).Create(upload).Error; err != nil {
+		s.storage.AbortMultipartUpload(ctx, upload.StorageKey, multipartID)
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return upload, nil
+}
+
+// Get returns an upload of the user
+func (s *Service) Get(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Upload, error) {
+	var upload Upload
+	err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&upload).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	if !upload.Complete() && upload.ExpiresAt.Before(time.Now()) {
+		return nil, ErrUploadExpired
+	}
+	return &upload, nil
+}
+
+// Write stores the bytes of body, which continue the upload at offset.
+// Bytes received before the client goes away are kept, so the upload can
+// be resumed from the returned offset.
+func (s *Service) Write(ctx context.Context, id uuid.UUID, userID uuid.UUID, offset int64, body io.Reader) (*Upload, error) {
+	upload, err := s.acquire(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	// Keep storing after the request is cancelled, so bytes already
+	// received are not lost
+	ctx = context.WithoutCancel(ctx)
+
+	if upload.Complete() {
+		s.release(ctx, upload)
+		return nil, ErrUploadComplete
+	}
+	if offset != upload.Offset {
+		s.release(ctx, upload)
+		return nil, ErrOffsetMismatch
+	}
+
+	buf := make([]byte, s.config.PartSize)
+	filled := 0
+	hadTail := upload.TailSize > 0
+	if hadTail {
+		if err := s.readTail(ctx, upload, buf[:upload.TailSize]); err != nil {
+			s.release(ctx, upload)
+			return nil, err
+		}
+		filled = int(upload.TailSize)
+	}
+
+	data := io.LimitReader(body, upload.Length-upload.Offset)
+	for {
+		n, err := io.ReadFull(data, buf[filled:])
+		filled += n
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				log.Printf("Upload %s interrupted at offset %d: %v", upload.ID, upload.partsSize()+int64(filled), err)
+			}
+			break
+		}
+		if upload.partsSize()+int64(filled) == upload.Length {
+			break
+		}
+
+		// A full part that is not the last one
+		if err := s.storePart(ctx, upload, buf[:filled]); err != nil {
+			s.release(ctx, upload)
+			return nil, err
+		}
+		filled = 0
+		upload.Offset = upload.partsSize()
+		upload.TailSize = 0
+		lease := time.Now().Add(leaseDuration)
+		upload.LockedUntil = &lease
+		if err := s.save(ctx, upload); err != nil {
+			return nil, err
+		}
+		if hadTail {
+			s.deleteTail(ctx, upload)
+			hadTail = false
+		}
+		s.notifyProgress(upload)
+	}
+
+	switch {
+	case upload.partsSize()+int64(filled) == upload.Length:
+		if filled > 0 {
+			if err := s.storePart(ctx, upload, buf[:filled]); err != nil {
+				s.release(ctx, upload)
+				return nil, err
+			}
+		}
+		if _, err := s.storage.CompleteMultipartUpload(ctx, upload.StorageKey, upload.MultipartID, upload.Parts); err != nil {
+			s.release(ctx, upload)
+			return nil, err
+		}
+		now := time.Now()
+		upload.CompletedAt = &now
+		upload.Offset = upload.Length
+		upload.TailSize = 0
+	case int64(filled) != upload.TailSize || !hadTail:
+		if filled > 0 {
+			if _, err := s.storage.Upload(ctx, upload.TailKey(), bytes.NewReader(buf[:filled]), "application/octet-stream"); err != nil {
+				s.release(ctx, upload)
+				return nil, fmt.Errorf("failed to store upload tail: %w", err)
+			}
+			hadTail = false
+		}
+		upload.TailSize = int64(filled)
+		upload.Offset = upload.partsSize() + upload.TailSize
+	default:
+		// Nothing was received beyond the stored tail
+		hadTail = false
+	}
+
+	upload.LockedUntil = nil
+	upload.ExpiresAt = time.Now().Add(s.config.Expiry)
+	if err := s.save(ctx, upload); err != nil {
+		return nil, err
+	}
+	if hadTail {
+		s.deleteTail(ctx, upload)
+	}
+
+	s.notifyProgress(upload)
+	return upload, nil
+}
+
+// Finalize turns a completed upload into an attachment of a message. The
+// message must be the user's own, in the channel the upload was made for,
+// and the user must still be a member of it.
+func (s *Service) Finalize(ctx context.Context, id uuid.UUID, userID uuid.UUID, messageID uuid.UUID) (*domain.Attachment, error) {
+	if s.finalizer == nil {
+		return nil, errors.New("uploads cannot be finalized: no finalizer configured")
+	}
+
+	upload, err := s.acquire(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.AttachmentID != nil {
+		s.release(ctx, upload)
+		return nil, ErrUploadFinalized
+	}
+	if !upload.Complete() {
+		s.release(ctx, upload)
+		return nil, ErrUploadIncomplete
+	}
+	if err := s.checkMessage(ctx, upload, messageID); err != nil {
+		s.release(ctx, upload)
+		return nil, err
+	}
+
+	attachment, err := s.finalizer.FinalizeUpload(ctx, upload, messageID)
+	if err != nil {
+		s.release(ctx, upload)
+		return nil, err
+	}
+
+	upload.AttachmentID = &attachment.ID
+	upload.LockedUntil = nil
+	if err := s.save(context.WithoutCancel(ctx), upload); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// Terminate discards an upload. The file of a finalized upload belongs to
+// its attachment and is kept.
+func (s *Service) Terminate(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	upload, err := s.acquire(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	return s.discard(context.WithoutCancel(ctx), upload)
+}
+
+// ExpireStale removes uploads that have been idle for longer than the
+// expiry, along with their stored parts, and returns how many it removed
+func (s *Service) ExpireStale(ctx context.Context) (int, error) {
+	removed := 0
+	for {
+		now := time.Now()
+		var expired []Upload
+		err := s.db.WithContext(ctx).
+			Where("expires_at < ? AND (locked_until IS NULL OR locked_until < ?)", now, now).
+			Order("expires_at").
+			Limit(expireBatchSize).
+			Find(&expired).Error
+		if err != nil {
+			return removed, fmt.Errorf("failed to find expired uploads: %w", err)
+		}
+
+		for i := range expired {
+			if err := s.discard(ctx, &expired[i]); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(expired) < expireBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// acquire takes the lease of an upload, so only one request writes to it
+func (s *Service) acquire(ctx context.Context, id uuid.UUID, userID uuid.UUID) (*Upload, error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&Upload{}).
+		Where("id = ? AND user_id = ? AND (locked_until IS NULL OR locked_until < ?)", id, userID, now).
+		Update("locked_until", now.Add(leaseDuration))
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to lock upload: %w", result.Error)
+	}
+
+	upload, err := s.Get(ctx, id, userID)
+	if err != nil {
+		if result.RowsAffected > 0 && errors.Is(err, ErrUploadExpired) {
+			s.db.WithContext(ctx).Model(&Upload{}).Where("id = ?", id).Update("locked_until", nil)
+		}
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUploadLocked
+	}
+	return upload, nil
+}
+
+// checkMember checks that a user is a member of a channel
+func (s *Service) checkMember(ctx context.Context, userID uuid.UUID, channelID uuid.UUID) error {
+	var count int64
+	err := s.db.WithContext(ctx).Table("messaging_channel_members").
+		Where("channel_id = ? AND user_id = ?", channelID, userID).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to check channel membership: %w", err)
+	}
+	if count == 0 {
+		return ErrNotPermitted
+	}
+	return nil
+}
+
+// checkMessage checks that an upload may be attached to a message: one the
+// uploader sent, and did not delete, in the upload's channel, which they
+// are still a member of
+func (s *Service) checkMessage(ctx context.Context, upload *Upload, messageID uuid.UUID) error {
+	if err := s.checkMember(ctx, upload.UserID, upload.ChannelID); err != nil {
+		return err
+	}
+
+	var count int64
+	err := s.db.WithContext(ctx).Table("messaging_messages").
+		Where("id = ? AND user_id = ? AND channel_id = ? AND NOT is_deleted", messageID, upload.UserID, upload.ChannelID).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to check message %s: %w", messageID, err)
+	}
+	if count == 0 {
+		return ErrNotPermitted
+	}
+	return nil
+}
+
+// release gives up the lease of an upload without other changes
+func (s *Service) release(ctx context.Context, upload *Upload) {
+	err := s.db.WithContext(ctx).Model(&Upload{}).Where("id = ?", upload.ID).Update("locked_until", nil).Error
+	if err != nil {
+		log.Printf("Failed to unlock upload %s: %v", upload.ID, err)
+	}
+}
+
+func (s *Service) save(ctx context.Context, upload *Upload) error {
+	if err := s.db.WithContext(ctx).Save(upload).Error; err != nil {
+		return fmt.Errorf("failed to update upload %s: %w", upload.ID, err)
+	}
+	return nil
+}
+
+// storePart stores data as the next part of an upload
+func (s *Service) storePart(ctx context.Context, upload *Upload, data []byte) error {
+	number := int64(len(upload.Parts) + 1)
+	part, err := s.storage.UploadPart(ctx, upload.StorageKey, upload.MultipartID, number, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	upload.Parts = append(upload.Parts, *part)
+	return nil
+}
+
+// readTail reads the stored bytes that did not fill a part yet into buf
+func (s *Service) readTail(ctx context.Context, upload *Upload, buf []byte) error {
+	reader, _, err := s.storage.Download(ctx, upload.TailKey())
+	if err != nil {
+		return fmt.Errorf("failed to read upload tail: %w", err)
+	}
+	defer reader.Close()
+
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return fmt.Errorf("failed to read upload tail: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) deleteTail(ctx context.Context, upload *Upload) {
+	if err := s.storage.Delete(ctx, upload.TailKey()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Failed to delete tail of upload %s: %v", upload.ID, err)
+	}
+}
+
+// discard removes an upload and whatever it stored that no attachment uses
+func (s *Service) discard(ctx context.Context, upload *Upload) error {
+	switch {
+	case upload.AttachmentID != nil:
+		// The file belongs to the attachment
+	case upload.Complete():
+		if err := s.storage.Delete(ctx, upload.StorageKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("failed to delete file of upload %s: %w", upload.ID, err)
+		}
+	default:
+		if err := s.storage.AbortMultipartUpload(ctx, upload.StorageKey, upload.MultipartID); err != nil {
+			return fmt.Errorf("failed to abort upload %s: %w", upload.ID, err)
+		}
+		if upload.TailSize > 0 {
+			s.deleteTail(ctx, upload)
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Delete(&Upload{}, "id = ?", upload.ID).Error; err != nil {
+		return fmt.Errorf("failed to delete upload %s: %w", upload.ID, err)
+	}
+	return nil
+}
+
+// notifyProgress tells the uploader's clients how far an upload has got
+func (s *Service) notifyProgress(upload *Upload) {
+	if s.notifier == nil {
+		return
+	}
+
+	s.notifier.BroadcastToUser(upload.UserID, websocket.EventTypeAttachment, websocket.AttachmentEvent{
+		Type:      websocket.EventTypeAttachment,
+		ChannelID: upload.ChannelID.String(),
+		UploadID:  upload.ID.String(),
+		Status:    "uploading",
+		Progress:  int(upload.Offset * 100 / upload.Length),
+		Timestamp: time.Now().Unix(),
+	})
+}
@@ -0,0 +1,405 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// recordingNotifier keeps the progress events sent to users
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []websocket.AttachmentEvent
+}
+
+func (n *recordingNotifier) BroadcastToUser(userID uuid.UUID, msgType string, data interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, data.(websocket.AttachmentEvent))
+}
+
+func (n *recordingNotifier) progress() []int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	progress := make([]int, len(n.events))
+	for i, event := range n.events {
+		progress[i] = event.Progress
+	}
+	return progress
+}
+
+// fakeFinalizer creates attachments without a database
+type fakeFinalizer struct {
+	finalized []*Upload
+	err       error
+}
+
+func (f *fakeFinalizer) FinalizeUpload(ctx context.Context, upload *Upload, messageID uuid.UUID) (*domain.Attachment, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.finalized = append(f.finalized, upload)
+
+	return &domain.Attachment{
+		ID:        uuid.New(),
+		MessageID: messageID,
+		UserID:    upload.UserID,
+		FileName:  upload.FileName,
+		FileSize:  upload.Length,
+	}, nil
+}
+
+type testEnv struct {
+	service   *Service
+	storage   *storage.Provider
+	notifier  *recordingNotifier
+	finalizer *fakeFinalizer
+	db        *gorm.DB
+	basePath  string
+
+	// user is a member of channel, where they sent message; other is not
+	user    uuid.UUID
+	other   uuid.UUID
+	channel uuid.UUID
+	message uuid.UUID
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Upload{}))
+	for _, statement := range []string{
+		`CREATE TABLE messaging_channel_members (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT)`,
+		`CREATE TABLE messaging_messages (
+			id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, is_deleted BOOLEAN DEFAULT false)`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	basePath := t.TempDir()
+	provider, err := storage.NewProvider(&storage.Config{
+		Type:       storage.StorageTypeLocal,
+		BasePath:   basePath,
+		BaseURL:    "http://localhost:8080/files",
+		SigningKey: "test-signing-key",
+	})
+	require.NoError(t, err)
+
+	env := &testEnv{
+		service:   NewService(db, provider, Config{MaxSize: 1024, PartSize: 4}),
+		storage:   provider,
+		notifier:  &recordingNotifier{},
+		finalizer: &fakeFinalizer{},
+		db:        db,
+		basePath:  basePath,
+		user:      uuid.New(),
+		other:     uuid.New(),
+		channel:   uuid.New(),
+		message:   uuid.New(),
+	}
+	require.NoError(t, db.Exec("INSERT INTO messaging_channel_members (id, channel_id, user_id) VALUES (?, ?, ?)",
+		uuid.New(), env.channel, env.user).Error)
+	require.NoError(t, db.Exec("INSERT INTO messaging_messages (id, channel_id, user_id) VALUES (?, ?, ?)",
+		env.message, env.channel, env.user).Error)
+	env.service.SetNotifier(env.notifier)
+	env.service.SetFinalizer(env.finalizer)
+	return env
+}
+
+func (e *testEnv) contents(t *testing.T, key string) string {
+	t.Helper()
+
+	reader, _, err := e.storage.Download(context.Background(), key)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// disconnectingReader stands in for a client that disconnects
+// mid-request, which also cancels the request's context
+type disconnectingReader struct {
+	cancel context.CancelFunc
+}
+
+func (r disconnectingReader) Read([]byte) (int, error) {
+	r.cancel()
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestWriteInChunks(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	const contents = "hello resumable world"
+
+	upload, err := env.service.Create(ctx, env.user, env.channel, "notes.txt", "text/plain", int64(len(contents)))
+	require.NoError(t, err)
+
+	// Chunks that do not line up with the parts: the bytes past the last
+	// full part are kept as the tail
+	upload, err = env.service.Write(ctx, upload.ID, env.user, 0, strings.NewReader(contents[:3]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), upload.Offset)
+	assert.Empty(t, upload.Parts)
+	assert.Equal(t, int64(3), upload.TailSize)
+
+	upload, err = env.service.Write(ctx, upload.ID, env.user, 3, strings.NewReader(contents[3:10]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), upload.Offset)
+	assert.Len(t, upload.Parts, 2)
+	assert.Equal(t, int64(2), upload.TailSize)
+	assert.False(t, upload.Complete())
+
+	upload, err = env.service.Write(ctx, upload.ID, env.user, 10, strings.NewReader(contents[10:]))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), upload.Offset)
+	assert.True(t, upload.Complete())
+	assert.Zero(t, upload.TailSize)
+
+	assert.Equal(t, contents, env.contents(t, upload.StorageKey))
+	_, _, err = env.storage.Download(ctx, upload.TailKey())
+	assert.ErrorIs(t, err, storage.ErrNotFound, "the tail is removed")
+
+	stored, err := env.service.Get(ctx, upload.ID, env.user)
+	require.NoError(t, err)
+	assert.Equal(t, upload.Offset, stored.Offset)
+	assert.Nil(t, stored.LockedUntil)
+
+	progress := env.notifier.progress()
+	assert.Equal(t, 100, progress[len(progress)-1])
+	assert.IsNonDecreasing(t, progress)
+	assert.Equal(t, upload.ID.String(), env.notifier.events[0].UploadID)
+}
+
+func TestInterruptedWriteResumes(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	const contents = "0123456789abcdef"
+
+	upload, err := env.service.Create(ctx, env.user, env.channel, "data.bin", "", int64(len(contents)))
+	require.NoError(t, err)
+
+	// The client goes away after sending 7 bytes
+	request, cancel := context.WithCancel(ctx)
+	body := io.MultiReader(strings.NewReader(contents[:7]), disconnectingReader{cancel: cancel})
+	upload, err = env.service.Write(request, upload.ID, env.user, 0, body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), upload.Offset)
+
+	stored, err := env.service.Get(ctx, upload.ID, env.user)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), stored.Offset)
+
+	upload, err = env.service.Write(ctx, upload.ID, env.user, stored.Offset, strings.NewReader(contents[7:]))
+	require.NoError(t, err)
+	assert.True(t, upload.Complete())
+	assert.Equal(t, contents, env.contents(t, upload.StorageKey))
+}
+
+func TestWriteRejections(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	_, err := env.service.Create(ctx, env.user, env.channel, "big.bin", "", 2048)
+	assert.ErrorIs(t, err, ErrUploadTooLarge)
+	_, err = env.service.Create(ctx, env.user, env.channel, "empty.bin", "", 0)
+	assert.ErrorIs(t, err, ErrInvalidLength)
+
+	upload, err := env.service.Create(ctx, env.user, env.channel, "a.txt", "text/plain", 6)
+	require.NoError(t, err)
+
+	t.Run("offset mismatch", func(t *testing.T) {
+		_, err := env.service.Write(ctx, upload.ID, env.user, 3, strings.NewReader("abc"))
+		assert.ErrorIs(t, err, ErrOffsetMismatch)
+	})
+
+	t.Run("uploads of other users", func(t *testing.T) {
+		_, err := env.service.Write(ctx, upload.ID, env.other, 0, strings.NewReader("abc"))
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+		_, err = env.service.Get(ctx, uuid.New(), env.user)
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		require.NoError(t, env.db.Model(&Upload{}).Where("id = ?", upload.ID).Update("locked_until", time.Now().Add(time.Minute)).Error)
+		_, err := env.service.Write(ctx, upload.ID, env.user, 0, strings.NewReader("abc"))
+		assert.ErrorIs(t, err, ErrUploadLocked)
+
+		// Leases of requests that died run out
+		require.NoError(t, env.db.Model(&Upload{}).Where("id = ?", upload.ID).Update("locked_until", time.Now().Add(-time.Second)).Error)
+		_, err = env.service.Write(ctx, upload.ID, env.user, 0, strings.NewReader("abc"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("bytes past the length are not stored", func(t *testing.T) {
+		written, err := env.service.Write(ctx, upload.ID, env.user, 3, strings.NewReader("defghi"))
+		require.NoError(t, err)
+		assert.True(t, written.Complete())
+		assert.Equal(t, "abcdef", env.contents(t, written.StorageKey))
+	})
+
+	t.Run("complete uploads", func(t *testing.T) {
+		_, err := env.service.Write(ctx, upload.ID, env.user, 6, strings.NewReader("x"))
+		assert.ErrorIs(t, err, ErrUploadComplete)
+	})
+
+	t.Run("expired uploads", func(t *testing.T) {
+		expired, err := env.service.Create(ctx, env.user, env.channel, "b.txt", "text/plain", 6)
+		require.NoError(t, err)
+		require.NoError(t, env.db.Model(&Upload{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		_, err = env.service.Write(ctx, expired.ID, env.user, 0, strings.NewReader("abc"))
+		assert.ErrorIs(t, err, ErrUploadExpired)
+	})
+}
+
+func TestFinalize(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	upload, err := env.service.Create(ctx, env.user, env.channel, "report.pdf", "application/pdf", 5)
+	require.NoError(t, err)
+
+	_, err = env.service.Finalize(ctx, upload.ID, env.user, env.message)
+	assert.ErrorIs(t, err, ErrUploadIncomplete)
+
+	_, err = env.service.Write(ctx, upload.ID, env.user, 0, strings.NewReader("%PDF-"))
+	require.NoError(t, err)
+
+	env.finalizer.err = ErrUploadRejected
+	_, err = env.service.Finalize(ctx, upload.ID, env.user, env.message)
+	assert.ErrorIs(t, err, ErrUploadRejected)
+
+	env.finalizer.err = nil
+	attachment, err := env.service.Finalize(ctx, upload.ID, env.user, env.message)
+	require.NoError(t, err)
+	assert.Equal(t, env.message, attachment.MessageID)
+	assert.Equal(t, upload.StorageKey, env.finalizer.finalized[0].StorageKey)
+
+	stored, err := env.service.Get(ctx, upload.ID, env.user)
+	require.NoError(t, err)
+	assert.Equal(t, &attachment.ID, stored.AttachmentID)
+
+	_, err = env.service.Finalize(ctx, upload.ID, env.user, env.message)
+	assert.ErrorIs(t, err, ErrUploadFinalized)
+}
+
+func TestPermissions(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	_, err := env.service.Create(ctx, env.other, env.channel, "a.txt", "text/plain", 3)
+	assert.ErrorIs(t, err, ErrNotPermitted, "only channel members can upload")
+	_, err = env.service.Create(ctx, env.user, uuid.New(), "a.txt", "text/plain", 3)
+	assert.ErrorIs(t, err, ErrNotPermitted)
+
+	upload, err := env.service.Create(ctx, env.user, env.channel, "a.txt", "text/plain", 3)
+	require.NoError(t, err)
+	_, err = env.service.Write(ctx, upload.ID, env.user, 0, strings.NewReader("abc"))
+	require.NoError(t, err)
+
+	// Messages of other users, of other channels and deleted ones cannot
+	// be attached to
+	foreign, elsewhere, deleted := uuid.New(), uuid.New(), uuid.New()
+	for _, row := range []struct {
+		id, channel, user uuid.UUID
+		deleted           bool
+	}{
+		{foreign, env.channel, env.other, false},
+		{elsewhere, uuid.New(), env.user, false},
+		{deleted, env.channel, env.user, true},
+	} {
+		require.NoError(t, env.db.Exec("INSERT INTO messaging_messages (id, channel_id, user_id, is_deleted) VALUES (?, ?, ?, ?)",
+			row.id, row.channel, row.user, row.deleted).Error)
+	}
+	for _, messageID := range []uuid.UUID{foreign, elsewhere, deleted, uuid.New()} {
+		_, err = env.service.Finalize(ctx, upload.ID, env.user, messageID)
+		assert.ErrorIs(t, err, ErrNotPermitted)
+	}
+
+	// Users who left the channel can no longer finalize
+	require.NoError(t, env.db.Exec("DELETE FROM messaging_channel_members").Error)
+	_, err = env.service.Finalize(ctx, upload.ID, env.user, env.message)
+	assert.ErrorIs(t, err, ErrNotPermitted)
+	assert.Empty(t, env.finalizer.finalized)
+
+	stored, err := env.service.Get(ctx, upload.ID, env.user)
+	require.NoError(t, err)
+	assert.Nil(t, stored.LockedUntil, "rejected finalizations release the upload")
+}
+
+func TestExpireStale(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	partial, err := env.service.Create(ctx, env.user, env.channel, "partial.txt", "text/plain", 20)
+	require.NoError(t, err)
+	partial, err = env.service.Write(ctx, partial.ID, env.user, 0, strings.NewReader("0123456"))
+	require.NoError(t, err)
+
+	unclaimed, err := env.service.Create(ctx, env.user, env.channel, "unclaimed.txt", "text/plain", 3)
+	require.NoError(t, err)
+	unclaimed, err = env.service.Write(ctx, unclaimed.ID, env.user, 0, strings.NewReader("abc"))
+	require.NoError(t, err)
+
+	finalized, err := env.service.Create(ctx, env.user, env.channel, "kept.txt", "text/plain", 4)
+	require.NoError(t, err)
+	_, err = env.service.Write(ctx, finalized.ID, env.user, 0, strings.NewReader("kept"))
+	require.NoError(t, err)
+	_, err = env.service.Finalize(ctx, finalized.ID, env.user, env.message)
+	require.NoError(t, err)
+
+	fresh, err := env.service.Create(ctx, env.user, env.channel, "fresh.txt", "text/plain", 3)
+	require.NoError(t, err)
+
+	require.NoError(t, env.db.Model(&Upload{}).
+		Where("id IN ?", []uuid.UUID{partial.ID, unclaimed.ID, finalized.ID}).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+	removed, err := env.service.ExpireStale(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	var remaining []Upload
+	require.NoError(t, env.db.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, fresh.ID, remaining[0].ID)
+
+	// Parts, tails and unclaimed files are removed; finalized files belong
+	// to their attachment
+	entries, err := os.ReadDir(filepath.Join(env.basePath, "multipart"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "only the fresh upload's parts are left")
+	_, _, err = env.storage.Download(ctx, partial.TailKey())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, _, err = env.storage.Download(ctx, unclaimed.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, "kept", env.contents(t, finalized.StorageKey))
+}
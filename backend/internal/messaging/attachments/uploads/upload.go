@@ -0,0 +1,142 @@
+// Package uploads implements resumable attachment uploads following the tus
+// protocol (https://tus.io/protocols/resumable-upload). Uploads are
+// streamed to storage in parts, so interrupted transfers resume from the
+// last received byte, and become attachments once finalized.
+package uploads
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/storage"
+	"github.com/google/uuid"
+)
+
+// KeyPrefix is the storage prefix of uploaded files and their tails
+const KeyPrefix = "uploads/"
+
+var (
+	// ErrUploadNotFound is returned for unknown uploads and uploads of
+	// other users
+	ErrUploadNotFound = errors.New("upload not found")
+
+	// ErrUploadExpired is returned for uploads that were not completed in time
+	ErrUploadExpired = errors.New("upload expired")
+
+	// ErrUploadLocked is returned while another request writes to the upload
+	ErrUploadLocked = errors.New("upload is being written by another request")
+
+	// ErrOffsetMismatch is returned when a write does not continue at the
+	// upload's current offset
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+	// ErrUploadTooLarge is returned for uploads above the maximum size, and
+	// for writes past the declared length
+	ErrUploadTooLarge = errors.New("upload too large")
+
+	// ErrInvalidLength is returned for uploads without contents
+	ErrInvalidLength = errors.New("invalid upload length")
+
+	// ErrUploadComplete is returned when writing to a completed upload
+	ErrUploadComplete = errors.New("upload already complete")
+
+	// ErrUploadFinalized is returned when finalizing an upload again
+	ErrUploadFinalized = errors.New("upload already finalized")
+
+	// ErrUploadRejected is returned by finalizers for files that may not
+	// become attachments, e.g. because of their type
+	ErrUploadRejected = errors.New("upload rejected")
+
+	// ErrUploadIncomplete is returned when finalizing an upload that has
+	// not received all of its bytes
+	ErrUploadIncomplete = errors.New("upload incomplete")
+
+	// ErrNotPermitted is returned for uploads to channels the user is not a
+	// member of, and when finalizing into a message that is not theirs
+	ErrNotPermitted = errors.New("not permitted")
+)
+
+// Upload is a resumable upload in progress. Received bytes are stored as
+// parts of a multipart upload; bytes that do not fill a part yet are kept
+// in a tail object and sent with the next part.
+type Upload struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	ChannelID   uuid.UUID `gorm:"type:uuid;not null" json:"channelId"`
+	FileName    string    `gorm:"type:varchar(255);not null" json:"fileName"`
+	ContentType string    `gorm:"type:varchar(255)" json:"contentType"`
+	Length      int64     `gorm:"column:upload_length;not null" json:"length"`
+	Offset      int64     `gorm:"column:upload_offset;not null;default:0" json:"offset"`
+
+	// StorageKey is where the file is stored once complete
+	StorageKey  string `gorm:"type:varchar(512);not null" json:"-"`
+	MultipartID string `gorm:"type:varchar(512);not null" json:"-"`
+	Parts       Parts  `gorm:"type:jsonb" json:"-"`
+	TailSize    int64  `gorm:"not null;default:0" json:"-"`
+
+	// LockedUntil is the lease of the request writing to the upload
+	LockedUntil *time.Time `json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expiresAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+
+	// AttachmentID is set once the upload is finalized into an attachment
+	AttachmentID *uuid.UUID `gorm:"type:uuid" json:"attachmentId,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (Upload) TableName() string {
+	return "attachment_uploads"
+}
+
+// Complete reports whether all bytes have been received
+func (u *Upload) Complete() bool {
+	return u.CompletedAt != nil
+}
+
+// TailKey is where bytes that do not fill a part yet are kept
+func (u *Upload) TailKey() string {
+	return fmt.Sprintf("%s%s.tail", KeyPrefix, u.ID)
+}
+
+// partsSize is the number of bytes stored in parts
+func (u *Upload) partsSize() int64 {
+	var size int64
+	for _, part := range u.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+// Parts is a custom type for JSONB storage of uploaded parts
+type Parts []storage.CompletedPart
+
+// Value implements the driver.Valuer interface
+func (p Parts) Value() (driver.Value, error) {
+	if p == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (p *Parts) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("unsupported parts value %T", value)
+	}
+}
@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+)
+
+// brokerTopic is the pub/sub topic shared by every hub
+const brokerTopic = "messaging:hub"
+
+// Broker fans hub events out to every API instance. Published messages are
+// delivered to all subscribers, including the publishing instance.
+type Broker interface {
+	Publish(ctx context.Context, topic string, message []byte) error
+	// Subscribe delivers messages published on topic until ctx is cancelled
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+}
+
+// MemoryBroker is an in-process Broker for running several hubs in one
+// process, as tests do. Hubs sharing one MemoryBroker behave like nodes
+// sharing Redis.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan []byte]struct{}
+}
+
+// NewMemoryBroker creates a new in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscribers: make(map[string]map[chan []byte]struct{})}
+}
+
+// Publish delivers a message to every subscriber of the topic. Slow
+// subscribers miss messages rather than blocking the publisher, as with
+// Redis pub/sub.
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, message []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers[topic] {
+		select {
+		case sub <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber until ctx is cancelled
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	sub := make(chan []byte, 256)
+
+	b.mu.Lock()
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan []byte]struct{})
+	}
+	b.subscribers[topic][sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers[topic], sub)
+		close(sub)
+		b.mu.Unlock()
+	}()
+
+	return sub, nil
+}
+
+// pubsubBackend is the subset of the secure cache used for pub/sub
+type pubsubBackend interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+}
+
+// RedisBroker fans events out through Redis pub/sub so hubs on different
+// API replicas reach each other's clients
+type RedisBroker struct {
+	backend pubsubBackend
+}
+
+// NewRedisBroker creates a broker on top of a Redis pub/sub backend
+func NewRedisBroker(backend pubsubBackend) *RedisBroker {
+	return &RedisBroker{backend: backend}
+}
+
+// Publish sends a message to every instance, including this one
+func (b *RedisBroker) Publish(ctx context.Context, topic string, message []byte) error {
+	return b.backend.Publish(ctx, topic, message)
+}
+
+// Subscribe listens on a topic until ctx is cancelled
+func (b *RedisBroker) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	return b.backend.Subscribe(ctx, topic)
+}
@@ -2,7 +2,9 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -27,6 +29,10 @@ type Client struct {
 
 	// Time of last activity for timeout management
 	lastActivity time.Time
+
+	// Guards send against use after Close
+	mu     sync.Mutex
+	closed bool
 }
 
 // NewClient creates a new websocket client
@@ -137,6 +143,8 @@ func (c *Client) handleMessage(msg *ClientMessage) {
 		c.handleChannelUnsubscribe(msg)
 	case EventTypeMessage:
 		c.handleNewMessage(msg)
+	case EventTypeResume:
+		c.handleResume(msg)
 	default:
 		c.sendError("unknown_message_type", "Unknown message type")
 	}
@@ -154,19 +162,8 @@ func (c *Client) handleTypingIndicator(msg *ClientMessage) {
 		return
 	}
 
-	// Create typing event
-	typingEvent := Message{
-		Type:      EventTypeTyping,
-		ChannelID: data.ChannelID,
-		Data: map[string]interface{}{
-			"userId":   c.UserID,
-			"isTyping": data.IsTyping,
-		},
-		Timestamp: time.Now().Unix(),
-	}
-
 	// Broadcast to channel
-	c.hub.broadcast <- &typingEvent
+	c.hub.BroadcastTyping(c.UserID, data.ChannelID, data.IsTyping)
 }
 
 // handlePresenceUpdate processes presence status updates
@@ -218,6 +215,11 @@ func (c *Client) handleChannelSubscribe(msg *ClientMessage) {
 		return
 	}
 
+	if !c.hub.canAccessChannel(c.UserID, data.ChannelID) {
+		c.sendError("channel_access_denied", "Access denied to this channel")
+		return
+	}
+
 	// Add client to channel
 	c.hub.SubscribeToChannel(c, data.ChannelID)
 
@@ -272,7 +274,97 @@ func (c *Client) handleNewMessage(msg *ClientMessage) {
 		Timestamp: time.Now().Unix(),
 	}
 
-	c.hub.broadcast <- message
+	c.hub.broadcastMessage(message)
+}
+
+// handleResume replays the channel events a reconnecting client missed. The
+// client sends the last sequence number it saw per channel; channels whose
+// gap is no longer retained get a resync_required event instead, telling the
+// client to reload them. Events broadcast during the replay can arrive
+// twice, so clients ignore sequence numbers they have already seen.
+// Channels the user may not access are left out of the acknowledgement.
+func (c *Client) handleResume(msg *ClientMessage) {
+	var lastSeqs map[uint]uint64
+	if err := extractData(msg.Data, &lastSeqs); err != nil {
+		c.sendError("invalid_data", "Invalid resume data")
+		return
+	}
+
+	resumed := make(map[uint]uint64, len(lastSeqs))
+	for channelID, lastSeq := range lastSeqs {
+		if !c.hub.canAccessChannel(c.UserID, channelID) {
+			continue
+		}
+
+		// Subscribe first so nothing broadcast during the replay is missed
+		c.hub.SubscribeToChannel(c, channelID)
+
+		events, err := c.hub.eventsSince(channelID, lastSeq)
+		if err != nil {
+			if !errors.Is(err, ErrResyncRequired) {
+				log.Printf("Failed to replay events for channel %d: %v", channelID, err)
+			}
+			c.sendResync(channelID, lastSeq)
+			continue
+		}
+
+		seq, complete := lastSeq, true
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil || !c.queue(data) {
+				// The client cannot keep up with the replay
+				complete = false
+				break
+			}
+			seq = event.Seq
+		}
+
+		if !complete {
+			c.sendResync(channelID, seq)
+			continue
+		}
+		resumed[channelID] = seq
+	}
+
+	c.sendAck(EventTypeResume, map[string]interface{}{
+		"channels": resumed,
+	})
+}
+
+// sendResync tells the client to reload a channel it cannot resume
+func (c *Client) sendResync(channelID uint, lastSeq uint64) {
+	data, err := json.Marshal(Message{
+		Type:      EventTypeResyncRequired,
+		ChannelID: channelID,
+		Data: map[string]interface{}{
+			"lastSeq": lastSeq,
+		},
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		log.Printf("Error marshaling resync message: %v", err)
+		return
+	}
+
+	c.queue(data)
+}
+
+// queue adds data to the outbound buffer without blocking. It reports false
+// if the buffer is full or the client has been closed.
+func (c *Client) queue(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
+	}
 }
 
 // sendError sends an error message to the client
@@ -311,7 +403,13 @@ func (c *Client) sendAck(eventType string, data interface{}) {
 
 // Close closes the client connection and cleans up resources
 func (c *Client) Close() {
-	close(c.send)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
 }
 
 // Helper function to extract data from interface{} to struct
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/cache"
+)
+
+const (
+	// defaultEventLogSize is how many recent events are kept per channel
+	defaultEventLogSize = 500
+
+	// eventLogTTL is how long the events of an idle channel are kept
+	eventLogTTL = 24 * time.Hour
+)
+
+// ErrResyncRequired is returned when events a client missed are no longer
+// retained, so it has to reload the channel instead of replaying the gap
+var ErrResyncRequired = errors.New("resync required")
+
+// EventLog numbers the events of each channel and keeps the most recent ones
+// so reconnecting clients can replay what they missed. Sequence numbers must
+// be shared by every node, so multi-node setups need a shared log.
+//
+// Only events broadcast to a whole channel, such as messages, edits and
+// reactions, are numbered. Typing indicators and presence are transient
+// and are not replayed. Read receipts and events sent to a single user are
+// not part of any channel's sequence either; clients reload them after a
+// reconnect instead.
+type EventLog interface {
+	// Append assigns the next sequence number of msg.ChannelID to msg.Seq
+	// and records the message
+	Append(ctx context.Context, msg *Message) error
+	// Since returns the events of a channel after seq, oldest first. It
+	// returns ErrResyncRequired if some of them are no longer retained.
+	Since(ctx context.Context, channelID uint, seq uint64) ([]*Message, error)
+}
+
+// MemoryEventLog is an in-process EventLog with a ring buffer per channel,
+// for single-node setups and tests
+type MemoryEventLog struct {
+	mu       sync.Mutex
+	size     int
+	channels map[uint]*eventRing
+}
+
+// eventRing holds the latest events of a channel
+type eventRing struct {
+	seq     uint64 // sequence number of the latest event
+	events  []*Message
+	next    int
+	retains int
+}
+
+// NewMemoryEventLog creates an in-process log keeping size events per channel
+func NewMemoryEventLog(size int) *MemoryEventLog {
+	if size <= 0 {
+		size = defaultEventLogSize
+	}
+	return &MemoryEventLog{
+		size:     size,
+		channels: make(map[uint]*eventRing),
+	}
+}
+
+// Append records an event, evicting the channel's oldest when it is full
+func (l *MemoryEventLog) Append(ctx context.Context, msg *Message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ring, ok := l.channels[msg.ChannelID]
+	if !ok {
+		ring = &eventRing{events: make([]*Message, l.size)}
+		l.channels[msg.ChannelID] = ring
+	}
+
+	ring.seq++
+	msg.Seq = ring.seq
+
+	stored := *msg
+	ring.events[ring.next] = &stored
+	ring.next = (ring.next + 1) % l.size
+	if ring.retains < l.size {
+		ring.retains++
+	}
+	return nil
+}
+
+// Since returns the retained events of a channel after seq
+func (l *MemoryEventLog) Since(ctx context.Context, channelID uint, seq uint64) ([]*Message, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ring, ok := l.channels[channelID]
+	if !ok {
+		if seq > 0 {
+			return nil, ErrResyncRequired
+		}
+		return nil, nil
+	}
+	if seq > ring.seq {
+		// The client saw events this log never recorded
+		return nil, ErrResyncRequired
+	}
+
+	oldest := ring.seq - uint64(ring.retains) + 1
+	if seq+1 < oldest {
+		return nil, ErrResyncRequired
+	}
+
+	missed := int(ring.seq - seq)
+	events := make([]*Message, 0, missed)
+	for i := missed; i > 0; i-- {
+		idx := (ring.next - i + l.size) % l.size
+		stored := *ring.events[idx]
+		events = append(events, &stored)
+	}
+	return events, nil
+}
+
+// sequencedBackend is the subset of the secure cache used for Redis streams
+type sequencedBackend interface {
+	AppendSequenced(ctx context.Context, stream string, message []byte, maxLen int64, ttl time.Duration) (int64, error)
+	ReadSequenced(ctx context.Context, stream string, from int64) ([]cache.StreamEntry, error)
+}
+
+// RedisEventLog keeps each channel's recent events in a capped Redis stream
+// whose entry IDs are the sequence numbers, shared by every node
+type RedisEventLog struct {
+	backend sequencedBackend
+	size    int64
+}
+
+// NewRedisEventLog creates a log keeping size events per channel in Redis
+func NewRedisEventLog(backend sequencedBackend, size int) *RedisEventLog {
+	if size <= 0 {
+		size = defaultEventLogSize
+	}
+	return &RedisEventLog{backend: backend, size: int64(size)}
+}
+
+func eventStream(channelID uint) string {
+	return fmt.Sprintf("messaging:events:%d", channelID)
+}
+
+// Append records an event in the channel's stream. The sequence number is
+// only known once appended, so the stored copy has none and it is restored
+// from the entry ID on replay.
+func (l *RedisEventLog) Append(ctx context.Context, msg *Message) error {
+	stored := *msg
+	stored.Seq = 0
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	seq, err := l.backend.AppendSequenced(ctx, eventStream(msg.ChannelID), data, l.size, eventLogTTL)
+	if err != nil {
+		return err
+	}
+	msg.Seq = uint64(seq)
+	return nil
+}
+
+// Since returns the retained events of a channel after seq. The read starts
+// at seq itself: when neither it nor the event after it is retained, the
+// gap was evicted or the client saw events the stream no longer knows.
+func (l *RedisEventLog) Since(ctx context.Context, channelID uint, seq uint64) ([]*Message, error) {
+	entries, err := l.backend.ReadSequenced(ctx, eventStream(channelID), int64(max(seq, 1)))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		if seq > 0 {
+			return nil, ErrResyncRequired
+		}
+		return nil, nil
+	}
+	if seq > 0 && uint64(entries[0].Seq) == seq {
+		entries = entries[1:]
+	}
+
+	events := make([]*Message, 0, len(entries))
+	expected := seq + 1
+	for _, entry := range entries {
+		if uint64(entry.Seq) != expected {
+			// An entry could not be read, so the replay would have a hole
+			return nil, ErrResyncRequired
+		}
+		expected++
+
+		var msg Message
+		if err := json.Unmarshal(entry.Message, &msg); err != nil {
+			return nil, ErrResyncRequired
+		}
+		msg.Seq = uint64(entry.Seq)
+		events = append(events, &msg)
+	}
+	return events, nil
+}
@@ -0,0 +1,279 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/cache"
+)
+
+func appendEvents(t *testing.T, eventLog EventLog, channelID uint, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		msg := &Message{Type: EventTypeMessage, ChannelID: channelID, Data: fmt.Sprintf("event %d", i+1)}
+		require.NoError(t, eventLog.Append(context.Background(), msg))
+	}
+}
+
+func seqs(events []*Message) []uint64 {
+	result := make([]uint64, 0, len(events))
+	for _, event := range events {
+		result = append(result, event.Seq)
+	}
+	return result
+}
+
+// fakeStreams mimics the secure cache's sequenced Redis streams
+type fakeStreams struct {
+	mu      sync.Mutex
+	streams map[string][]cache.StreamEntry
+	seqs    map[string]int64
+}
+
+func newFakeStreams() *fakeStreams {
+	return &fakeStreams{
+		streams: make(map[string][]cache.StreamEntry),
+		seqs:    make(map[string]int64),
+	}
+}
+
+func (f *fakeStreams) AppendSequenced(ctx context.Context, stream string, message []byte, maxLen int64, ttl time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seqs[stream]++
+	entries := append(f.streams[stream], cache.StreamEntry{Seq: f.seqs[stream], Message: message})
+	if int64(len(entries)) > maxLen {
+		entries = entries[int64(len(entries))-maxLen:]
+	}
+	f.streams[stream] = entries
+	return f.seqs[stream], nil
+}
+
+func (f *fakeStreams) ReadSequenced(ctx context.Context, stream string, from int64) ([]cache.StreamEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var entries []cache.StreamEntry
+	for _, entry := range f.streams[stream] {
+		if entry.Seq >= from {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func TestEventLogs(t *testing.T) {
+	logs := map[string]func() EventLog{
+		"memory": func() EventLog { return NewMemoryEventLog(5) },
+		"redis":  func() EventLog { return NewRedisEventLog(newFakeStreams(), 5) },
+	}
+
+	for name, newLog := range logs {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			t.Run("numbers events per channel", func(t *testing.T) {
+				eventLog := newLog()
+				appendEvents(t, eventLog, 1, 3)
+				appendEvents(t, eventLog, 2, 1)
+
+				events, err := eventLog.Since(ctx, 1, 0)
+				require.NoError(t, err)
+				assert.Equal(t, []uint64{1, 2, 3}, seqs(events))
+				assert.Equal(t, "event 3", events[2].Data)
+
+				events, err = eventLog.Since(ctx, 2, 0)
+				require.NoError(t, err)
+				assert.Equal(t, []uint64{1}, seqs(events))
+			})
+
+			t.Run("replays the gap", func(t *testing.T) {
+				eventLog := newLog()
+				appendEvents(t, eventLog, 1, 4)
+
+				events, err := eventLog.Since(ctx, 1, 2)
+				require.NoError(t, err)
+				assert.Equal(t, []uint64{3, 4}, seqs(events))
+
+				events, err = eventLog.Since(ctx, 1, 4)
+				require.NoError(t, err)
+				assert.Empty(t, events)
+			})
+
+			t.Run("requires a resync once the gap is evicted", func(t *testing.T) {
+				eventLog := newLog()
+				appendEvents(t, eventLog, 1, 8) // retains 4 to 8
+
+				events, err := eventLog.Since(ctx, 1, 3)
+				require.NoError(t, err)
+				assert.Equal(t, []uint64{4, 5, 6, 7, 8}, seqs(events))
+
+				_, err = eventLog.Since(ctx, 1, 2)
+				assert.ErrorIs(t, err, ErrResyncRequired)
+
+				_, err = eventLog.Since(ctx, 1, 0)
+				assert.ErrorIs(t, err, ErrResyncRequired)
+			})
+
+			t.Run("requires a resync for sequence numbers it never issued", func(t *testing.T) {
+				eventLog := newLog()
+				appendEvents(t, eventLog, 1, 2)
+
+				_, err := eventLog.Since(ctx, 1, 9)
+				assert.ErrorIs(t, err, ErrResyncRequired)
+
+				_, err = eventLog.Since(ctx, 7, 1)
+				assert.ErrorIs(t, err, ErrResyncRequired)
+
+				events, err := eventLog.Since(ctx, 7, 0)
+				require.NoError(t, err)
+				assert.Empty(t, events)
+			})
+		})
+	}
+}
+
+func TestBroadcastToChannelNumbersEventsAcrossNodes(t *testing.T) {
+	hubA, hubB := newTestHubs(t, NewMemoryEventLog(10))
+
+	alice := connect(t, hubA, 1, 10)
+
+	hubA.BroadcastToChannel(10, EventTypeMessage, "first")
+	hubB.BroadcastToChannel(10, EventTypeMessage, "second")
+
+	received := []float64{
+		receive(t, alice, EventTypeMessage)["seq"].(float64),
+		receive(t, alice, EventTypeMessage)["seq"].(float64),
+	}
+	sort.Float64s(received)
+	assert.Equal(t, []float64{1, 2}, received)
+}
+
+func TestResumeReplaysMissedEvents(t *testing.T) {
+	hubA, hubB := newTestHubs(t, NewMemoryEventLog(3))
+	observer := connect(t, hubA, 2, 20)
+
+	// Events broadcast while the client was disconnected
+	for i := 1; i <= 4; i++ {
+		hubB.BroadcastToChannel(10, EventTypeMessage, fmt.Sprintf("message %d", i))
+	}
+	hubB.BroadcastToChannel(20, EventTypeMessage, "other channel")
+
+	// Events reach the other node in order, so once the last one arrived
+	// the earlier ones were handled before the client connects
+	receive(t, observer, EventTypeMessage)
+
+	client := connect(t, hubA, 1)
+	client.handleMessage(&ClientMessage{
+		Type: EventTypeResume,
+		Data: map[string]interface{}{"10": 2, "20": 0, "30": 5},
+	})
+
+	var replayed []float64
+	var resync []float64
+	var ack map[string]interface{}
+	timeout := time.After(2 * time.Second)
+	for ack == nil {
+		select {
+		case data := <-client.send:
+			event := decodeEvent(t, data)
+			switch event["type"] {
+			case EventTypeMessage:
+				if event["channelId"] == float64(10) {
+					replayed = append(replayed, event["seq"].(float64))
+				}
+			case EventTypeResyncRequired:
+				resync = append(resync, event["channelId"].(float64))
+			case EventTypeResume + "_ack":
+				ack = event
+			}
+		case <-timeout:
+			t.Fatal("resume was not acknowledged")
+		}
+	}
+
+	assert.Equal(t, []float64{3, 4}, replayed)
+	assert.Equal(t, []float64{30}, resync, "channel 30 has no events to replay from seq 5")
+	channels := ack["data"].(map[string]interface{})["channels"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"10": float64(4), "20": float64(1)}, channels)
+
+	// Resuming subscribes the client to live events
+	hubB.BroadcastToChannel(10, EventTypeMessage, "live")
+	assert.Equal(t, float64(5), receive(t, client, EventTypeMessage)["seq"])
+}
+
+func TestResumeRequiresResyncWhenGapEvicted(t *testing.T) {
+	hubA, _ := newTestHubs(t, NewMemoryEventLog(2))
+
+	for i := 1; i <= 5; i++ {
+		hubA.BroadcastToChannel(10, EventTypeMessage, i)
+	}
+
+	client := connect(t, hubA, 1)
+	client.handleMessage(&ClientMessage{
+		Type: EventTypeResume,
+		Data: map[string]interface{}{"10": 1},
+	})
+
+	event := receive(t, client, EventTypeResyncRequired)
+	assert.Equal(t, float64(10), event["channelId"])
+	assert.Equal(t, float64(1), event["data"].(map[string]interface{})["lastSeq"])
+}
+
+func TestResumeSkipsInaccessibleChannels(t *testing.T) {
+	hubA, _ := newTestHubs(t, nil)
+	hubA.SetChannelAccess(allowChannels{10: true})
+
+	hubA.BroadcastToChannel(10, EventTypeMessage, "public")
+	hubA.BroadcastToChannel(20, EventTypeMessage, "private")
+
+	client := connect(t, hubA, 1)
+	client.handleMessage(&ClientMessage{
+		Type: EventTypeResume,
+		Data: map[string]interface{}{"10": 0, "20": 0},
+	})
+
+	ack := receive(t, client, EventTypeResume+"_ack")
+	channels := ack["data"].(map[string]interface{})["channels"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"10": float64(1)}, channels)
+
+	// The other channel was neither replayed nor subscribed to; the replay
+	// of channel 10 arrived before the acknowledgement
+	hubA.BroadcastToChannel(20, EventTypeMessage, "private again")
+	assertNoEvent(t, client, EventTypeMessage)
+	assert.NotContains(t, client.Channels, uint(20))
+}
+
+func TestSubscribeRequiresChannelAccess(t *testing.T) {
+	hub := NewHub(NewConnectionManager(&WebSocketConfig{MaxConnections: 100}))
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	client := connect(t, hub, 1)
+	subscribe := func(channelID uint) {
+		client.handleMessage(&ClientMessage{
+			Type: EventTypeChannelSubscribe,
+			Data: map[string]interface{}{"channelId": channelID},
+		})
+	}
+
+	// Without a way to check access, nobody can subscribe
+	subscribe(10)
+	assert.Equal(t, "channel_access_denied", receive(t, client, EventTypeError)["code"])
+
+	hub.SetChannelAccess(allowChannels{10: true})
+	subscribe(20)
+	assert.Equal(t, "channel_access_denied", receive(t, client, EventTypeError)["code"])
+	subscribe(10)
+	receive(t, client, EventTypeChannelSubscribe+"_ack")
+	assert.Equal(t, []uint{10}, client.Channels)
+}
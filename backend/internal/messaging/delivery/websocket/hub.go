@@ -2,19 +2,78 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// presenceHeartbeat is how often a node republishes the presence of its
+	// connected users
+	presenceHeartbeat = 30 * time.Second
+
+	// presenceTTL is how long another node's presence is trusted without a
+	// heartbeat, so users of a crashed node eventually go offline
+	presenceTTL = 3 * presenceHeartbeat
+
+	// publishTimeout bounds a single broker publish
+	publishTimeout = 5 * time.Second
+
+	// outboundQueueSize is how many events can wait to be published to the
+	// other nodes before new ones are dropped for them
+	outboundQueueSize = 4096
+)
+
+// Kinds of events exchanged between hubs
+const (
+	envelopeChannel      = "channel"
+	envelopeUser         = "user"
+	envelopeTyping       = "typing"
+	envelopeReadReceipt  = "read_receipt"
+	envelopePresence     = "presence"
+	envelopePresenceSync = "presence_sync"
 )
 
+// envelope is an event sent between hubs through the broker. Payload is the
+// JSON delivered to clients, except for presence where it is the node's
+// PresenceUpdate for the user.
+type envelope struct {
+	Node      string          `json:"node"`
+	Kind      string          `json:"kind"`
+	ChannelID uint            `json:"channelId,omitempty"`
+	UserID    uint            `json:"userId,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// nodePresence is a user's presence as reported by one node
+type nodePresence struct {
+	status    string
+	statusMsg string
+	changed   int64     // when the status was set, unix seconds
+	received  time.Time // when the node last reported it
+}
+
+// statusRank breaks ties between nodes that changed status in the same second
+var statusRank = map[string]int{
+	StatusOnline: 3,
+	StatusDND:    2,
+	StatusIdle:   1,
+}
+
 // ClientList is a map of connected clients with thread-safe access
 type ClientList struct {
 	sync.RWMutex
 	clients map[*Client]bool
 }
 
-// Hub maintains the set of active clients and broadcasts messages
+// Hub maintains the set of active clients and broadcasts messages. Events
+// are delivered to this node's clients directly and published through a
+// Broker so that the hubs of the other API instances deliver them to
+// theirs.
 type Hub struct {
 	// Registered clients by user ID
 	userClients map[uint]*ClientList
@@ -26,49 +85,158 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 
-	// Broadcast message channel
-	broadcast chan *Message
-
-	// Presence updates for status changes
+	// Presence updates for status changes made by local clients
 	presence chan *PresenceUpdate
 
-	// Typing indicator updates
-	typing chan *TypingEvent
-
-	// Read receipts
-	readReceipts chan *ReadReceipt
-
 	// Mutex for thread-safe access to maps
 	mu sync.RWMutex
 
-	// User presence map (userID -> presence data)
+	// User presence map (userID -> presence aggregated across nodes)
 	userPresence map[uint]*PresenceData
 
+	// Presence of users connected to this node
+	localPresence map[uint]*PresenceUpdate
+
+	// Presence reported by each node (userID -> node ID -> presence)
+	nodePresence map[uint]map[string]*nodePresence
+
 	// Connection manager for rate limiting and connection count
 	connManager *ConnectionManager
+
+	// Recent channel events, for clients resuming after a reconnect
+	eventLog EventLog
+
+	// Decides which channels users may subscribe to and replay
+	access ChannelAccess
+
+	// Broker shared with the hubs of other instances, and the queue of
+	// events waiting to be published to it. Without a broker the hub only
+	// serves its own clients.
+	broker        Broker
+	nodeID        string
+	events        <-chan []byte
+	outbound      chan []byte
+	publisherDone chan struct{}
+	outboundMu    sync.RWMutex
+	stopped       bool
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
-// NewHub creates a new hub instance
+// NewHub creates a new hub instance for a single node
 func NewHub(connManager *ConnectionManager) *Hub {
-	return &Hub{
+	return NewHubWithBroker(connManager, nil)
+}
+
+// NewHubWithBroker creates a hub that shares events with other hubs through
+// the broker. A nil broker creates a hub for a single node.
+func NewHubWithBroker(connManager *ConnectionManager, broker Broker) *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h := &Hub{
 		userClients:    make(map[uint]*ClientList),
 		channelClients: make(map[uint]*ClientList),
 		register:       make(chan *Client),
 		unregister:     make(chan *Client),
-		broadcast:      make(chan *Message),
 		presence:       make(chan *PresenceUpdate),
-		typing:         make(chan *TypingEvent),
-		readReceipts:   make(chan *ReadReceipt),
 		userPresence:   make(map[uint]*PresenceData),
+		localPresence:  make(map[uint]*PresenceUpdate),
+		nodePresence:   make(map[uint]map[string]*nodePresence),
 		connManager:    connManager,
+		eventLog:       NewMemoryEventLog(defaultEventLogSize),
+		broker:         broker,
+		nodeID:         uuid.New().String(),
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+	if broker == nil {
+		return h
 	}
+
+	// Subscribe before Run so events other nodes publish in the meantime
+	// are not missed. Without a subscription the hub only serves its own
+	// clients.
+	events, err := broker.Subscribe(ctx, brokerTopic)
+	if err != nil {
+		log.Printf("Failed to subscribe to hub broker, events stay on this node: %v", err)
+		return h
+	}
+	h.events = events
+
+	// Publish from a goroutine of its own, so a slow broker delays other
+	// nodes but never this node's clients or the Run loop
+	h.outbound = make(chan []byte, outboundQueueSize)
+	h.publisherDone = make(chan struct{})
+	go h.runPublisher(ctx)
+
+	return h
+}
+
+// runPublisher publishes queued events to the broker until the queue is
+// closed
+func (h *Hub) runPublisher(ctx context.Context) {
+	defer close(h.publisherDone)
+
+	for data := range h.outbound {
+		publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err := h.broker.Publish(publishCtx, brokerTopic, data)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to publish hub event to other nodes: %v", err)
+		}
+	}
+}
+
+// ChannelAccess tells whether a user may follow a channel's events, which
+// is normally whether they are a member of it
+type ChannelAccess interface {
+	CanAccessChannel(ctx context.Context, userID, channelID uint) (bool, error)
+}
+
+// SetChannelAccess sets who may subscribe to and replay channels. Until it
+// is set, clients can only receive the channels they registered with.
+func (h *Hub) SetChannelAccess(access ChannelAccess) {
+	h.access = access
+}
+
+// canAccessChannel checks whether a user may follow a channel
+func (h *Hub) canAccessChannel(userID, channelID uint) bool {
+	if h.access == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	allowed, err := h.access.CanAccessChannel(ctx, userID, channelID)
+	if err != nil {
+		log.Printf("Failed to check access of user %d to channel %d: %v", userID, channelID, err)
+		return false
+	}
+	return allowed
+}
+
+// SetEventLog replaces the in-memory event log, which only numbers events
+// consistently on a single node. It must be called before Run.
+func (h *Hub) SetEventLog(eventLog EventLog) {
+	h.eventLog = eventLog
 }
 
 // Run starts the hub's main loop for handling client events
 func (h *Hub) Run() {
 	// Periodic cleanup for inactive clients
 	ticker := time.NewTicker(2 * time.Minute)
+	defer ticker.Stop()
 
+	heartbeat := time.NewTicker(presenceHeartbeat)
+	defer heartbeat.Stop()
+
+	// Ask the other nodes for the presence of their users
+	h.publish(envelopePresenceSync, 0, 0, nil)
+
+	events := h.events
 	for {
 		select {
 		case client := <-h.register:
@@ -77,24 +245,77 @@ func (h *Hub) Run() {
 		case client := <-h.unregister:
 			h.unregisterClient(client)
 
-		case message := <-h.broadcast:
-			h.broadcastMessage(message)
-
 		case presence := <-h.presence:
 			h.updatePresence(presence)
 
-		case typing := <-h.typing:
-			h.broadcastTypingEvent(typing)
+		case data, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			var env envelope
+			if err := json.Unmarshal(data, &env); err != nil {
+				log.Printf("Failed to unmarshal hub event: %v", err)
+				continue
+			}
+			if env.Node == h.nodeID {
+				// Already delivered when it was published
+				continue
+			}
+			h.handleEnvelope(&env)
 
-		case receipt := <-h.readReceipts:
-			h.handleReadReceipt(receipt)
+		case <-heartbeat.C:
+			h.publishLocalPresence()
+			h.expireNodePresence()
 
 		case <-ticker.C:
 			h.cleanupInactiveClients()
+
+		case <-h.done:
+			return
 		}
 	}
 }
 
+// Stop marks this node's users offline on the other nodes and stops the hub
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() {
+		h.mu.RLock()
+		users := make([]uint, 0, len(h.localPresence))
+		for userID := range h.localPresence {
+			users = append(users, userID)
+		}
+		h.mu.RUnlock()
+
+		for _, userID := range users {
+			h.publish(envelopePresence, 0, userID, &PresenceUpdate{
+				Type:      EventTypePresence,
+				UserID:    userID,
+				Status:    StatusOffline,
+				Timestamp: time.Now().Unix(),
+			})
+		}
+
+		// Let the publisher flush the queue, including the offline
+		// updates, before the broker subscription is cancelled
+		h.outboundMu.Lock()
+		h.stopped = true
+		if h.outbound != nil {
+			close(h.outbound)
+		}
+		h.outboundMu.Unlock()
+		if h.publisherDone != nil {
+			select {
+			case <-h.publisherDone:
+			case <-time.After(publishTimeout):
+			}
+		}
+
+		h.cancel()
+		close(h.done)
+	})
+}
+
 // Register adds a client to the hub
 func (h *Hub) Register(client *Client) {
 	h.register <- client
@@ -104,7 +325,6 @@ func (h *Hub) Register(client *Client) {
 // registerClient adds a new client connection
 func (h *Hub) registerClient(client *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
 	// Add to user client list
 	if _, exists := h.userClients[client.UserID]; !exists {
@@ -130,8 +350,13 @@ func (h *Hub) registerClient(client *Client) {
 		h.channelClients[channelID].Unlock()
 	}
 
+	_, present := h.localPresence[client.UserID]
+	h.mu.Unlock()
+
 	// Update user presence to online
-	h.updateUserPresence(client.UserID, StatusOnline)
+	if !present {
+		h.updateUserPresence(client.UserID, StatusOnline)
+	}
 
 	// Send initial presence data to the client
 	h.sendPresenceData(client)
@@ -140,23 +365,29 @@ func (h *Hub) registerClient(client *Client) {
 // unregisterClient removes a client connection
 func (h *Hub) unregisterClient(client *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 
-	// Decrement connection count
-	h.connManager.RemoveConnection()
+	// Remove from user client list. Slow clients can be queued for removal
+	// more than once, so clients that are already gone are ignored.
+	clients, exists := h.userClients[client.UserID]
+	if !exists {
+		h.mu.Unlock()
+		return
+	}
 
-	// Remove from user client list
-	if clients, exists := h.userClients[client.UserID]; exists {
-		clients.Lock()
-		delete(clients.clients, client)
-		numClients := len(clients.clients)
+	clients.Lock()
+	if !clients.clients[client] {
 		clients.Unlock()
+		h.mu.Unlock()
+		return
+	}
+	delete(clients.clients, client)
+	numClients := len(clients.clients)
+	clients.Unlock()
 
-		// If no more clients for this user, clean up and update presence
-		if numClients == 0 {
-			delete(h.userClients, client.UserID)
-			h.updateUserPresence(client.UserID, StatusOffline)
-		}
+	// If no more clients for this user, clean up and update presence
+	lastClient := numClients == 0
+	if lastClient {
+		delete(h.userClients, client.UserID)
 	}
 
 	// Remove from channel client lists
@@ -174,163 +405,354 @@ func (h *Hub) unregisterClient(client *Client) {
 		}
 	}
 
+	h.mu.Unlock()
+
+	// Decrement connection count
+	h.connManager.RemoveConnection()
+
 	// Close client connection
 	client.Close()
+
+	if lastClient {
+		h.updateUserPresence(client.UserID, StatusOffline)
+	}
 }
 
-// broadcastMessage sends a message to all relevant clients
-func (h *Hub) broadcastMessage(msg *Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+// publish delivers an event to this node's clients and queues it for the
+// hubs of the other nodes. When the queue is full, because the broker is
+// slow or down, the other nodes miss the event.
+func (h *Hub) publish(kind string, channelID, userID uint, payload interface{}) {
+	env := &envelope{
+		Node:      h.nodeID,
+		Kind:      kind,
+		ChannelID: channelID,
+		UserID:    userID,
+	}
 
-	// Get all clients in the target channel
-	channelClients, ok := h.channelClients[msg.ChannelID]
-	if !ok {
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Failed to marshal %s event: %v", kind, err)
+			return
+		}
+		env.Payload = data
+	}
+
+	h.handleEnvelope(env)
+	h.enqueue(env)
+}
+
+// enqueue queues an event for publishing to the other nodes
+func (h *Hub) enqueue(env *envelope) {
+	h.outboundMu.RLock()
+	defer h.outboundMu.RUnlock()
+
+	if h.outbound == nil || h.stopped {
 		return
 	}
 
-	// Convert message to JSON
-	data, err := json.Marshal(msg)
+	data, err := json.Marshal(env)
 	if err != nil {
-		log.Printf("Failed to marshal message: %v", err)
+		log.Printf("Failed to marshal hub event: %v", err)
 		return
 	}
 
-	// Send to all clients in the channel
-	channelClients.RLock()
-	for client := range channelClients.clients {
-		select {
-		case client.send <- data:
-			// Message sent successfully
-		default:
-			// Buffer full, client might be slow or disconnected
-			h.unregister <- client
+	select {
+	case h.outbound <- data:
+	default:
+		log.Printf("Hub publish queue is full, other nodes miss a %s event", env.Kind)
+	}
+}
+
+// handleEnvelope delivers an event published by this or another node to
+// this node's clients
+func (h *Hub) handleEnvelope(env *envelope) {
+	switch env.Kind {
+	case envelopeChannel:
+		h.sendToChannel(env.ChannelID, env.Payload, 0)
+
+	case envelopeTyping:
+		// Don't send typing events back to the user who is typing
+		h.sendToChannel(env.ChannelID, env.Payload, env.UserID)
+
+	case envelopeUser, envelopeReadReceipt:
+		h.sendToUser(env.UserID, env.Payload)
+
+	case envelopePresence:
+		var update PresenceUpdate
+		if err := json.Unmarshal(env.Payload, &update); err != nil {
+			log.Printf("Failed to unmarshal presence update: %v", err)
+			return
+		}
+		h.applyNodePresence(env.Node, &update)
+
+	case envelopePresenceSync:
+		if env.Node != h.nodeID {
+			h.publishLocalPresence()
 		}
 	}
-	channelClients.RUnlock()
 }
 
-// broadcastTypingEvent broadcasts typing event to all clients in a channel
-func (h *Hub) broadcastTypingEvent(event *TypingEvent) {
+// sendToChannel sends data to all clients in a channel except those of
+// skipUser
+func (h *Hub) sendToChannel(channelID uint, data []byte, skipUser uint) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	// Get all clients in the target channel
-	channelClients, ok := h.channelClients[event.ChannelID]
+	channelClients, ok := h.channelClients[channelID]
 	if !ok {
 		return
 	}
 
-	// Convert event to JSON
-	data, err := json.Marshal(event)
-	if err != nil {
-		log.Printf("Failed to marshal typing event: %v", err)
-		return
-	}
-
-	// Send to all clients in the channel
 	channelClients.RLock()
 	for client := range channelClients.clients {
-		// Don't send typing events back to the user who is typing
-		if client.UserID == event.UserID {
+		if skipUser != 0 && client.UserID == skipUser {
 			continue
 		}
-
-		select {
-		case client.send <- data:
-			// Event sent successfully
-		default:
-			// Buffer full, client might be slow or disconnected
-			h.unregister <- client
-		}
+		h.sendToClient(client, data)
 	}
 	channelClients.RUnlock()
 }
 
-// handleReadReceipt updates read status and notifies relevant clients
-func (h *Hub) handleReadReceipt(receipt *ReadReceipt) {
+// sendToUser sends data to all clients of a user
+func (h *Hub) sendToUser(userID uint, data []byte) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	// Only notify the sender of the original message
-	userClients, ok := h.userClients[receipt.MessageSenderID]
+	userClients, ok := h.userClients[userID]
 	if !ok {
 		return
 	}
 
-	// Convert receipt to JSON
-	data, err := json.Marshal(receipt)
-	if err != nil {
-		log.Printf("Failed to marshal read receipt: %v", err)
-		return
-	}
-
-	// Send to the original message sender's clients
 	userClients.RLock()
 	for client := range userClients.clients {
-		select {
-		case client.send <- data:
-			// Receipt sent successfully
-		default:
-			// Buffer full
-			h.unregister <- client
-		}
+		h.sendToClient(client, data)
 	}
 	userClients.RUnlock()
 }
 
-// updatePresence broadcasts a presence update to relevant clients
+// sendToClient queues data for a client. The caller holds h.mu.
+func (h *Hub) sendToClient(client *Client, data []byte) {
+	select {
+	case client.send <- data:
+		// Message sent successfully
+	default:
+		// Buffer full, client might be slow or disconnected. Unregistering
+		// goes through Run, which may be the caller.
+		go func(c *Client) {
+			h.unregister <- c
+		}(client)
+	}
+}
+
+// broadcastMessage numbers a message and sends it to all clients in its
+// channel on every node. If the event log is unavailable the message is
+// still delivered live, without a sequence number.
+func (h *Hub) broadcastMessage(msg *Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	err := h.eventLog.Append(ctx, msg)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to record %s event for channel %d: %v", msg.Type, msg.ChannelID, err)
+	}
+
+	h.publish(envelopeChannel, msg.ChannelID, 0, msg)
+}
+
+// eventsSince returns the events of a channel a client missed after seq
+func (h *Hub) eventsSince(channelID uint, seq uint64) ([]*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	return h.eventLog.Since(ctx, channelID, seq)
+}
+
+// updatePresence records a status set by a user connected to this node and
+// shares it with the other nodes
 func (h *Hub) updatePresence(update *PresenceUpdate) {
 	h.mu.Lock()
+	_, connected := h.userClients[update.UserID]
+	if !connected && update.Status != StatusOffline {
+		// The user disconnected while the update was queued
+		h.mu.Unlock()
+		return
+	}
+
+	if update.Status == StatusOffline {
+		delete(h.localPresence, update.UserID)
+	} else {
+		h.localPresence[update.UserID] = update
+	}
+	h.mu.Unlock()
+
+	h.publish(envelopePresence, 0, update.UserID, update)
+}
+
+// updateUserPresence updates a user's presence status
+func (h *Hub) updateUserPresence(userID uint, status string) {
+	update := &PresenceUpdate{
+		Type:      EventTypePresence,
+		UserID:    userID,
+		Status:    status,
+		Timestamp: time.Now().Unix(),
+	}
+
+	h.updatePresence(update)
+}
+
+// publishLocalPresence republishes the presence of this node's users, as a
+// heartbeat and for nodes that have just started
+func (h *Hub) publishLocalPresence() {
+	h.mu.RLock()
+	updates := make([]*PresenceUpdate, 0, len(h.localPresence))
+	for _, update := range h.localPresence {
+		updates = append(updates, update)
+	}
+	h.mu.RUnlock()
+
+	for _, update := range updates {
+		h.publish(envelopePresence, 0, update.UserID, update)
+	}
+}
+
+// applyNodePresence records the presence a node reported for a user and
+// notifies clients if the user's overall presence changed
+func (h *Hub) applyNodePresence(node string, update *PresenceUpdate) {
+	h.mu.Lock()
 
-	// Update presence in our map
-	h.userPresence[update.UserID] = &PresenceData{
-		Status:    update.Status,
-		LastSeen:  time.Now(),
-		StatusMsg: update.StatusMsg,
+	nodes := h.nodePresence[update.UserID]
+	if update.Status == StatusOffline {
+		delete(nodes, node)
+	} else {
+		if nodes == nil {
+			nodes = make(map[string]*nodePresence)
+			h.nodePresence[update.UserID] = nodes
+		}
+		nodes[node] = &nodePresence{
+			status:    update.Status,
+			statusMsg: update.StatusMsg,
+			changed:   update.Timestamp,
+			received:  time.Now(),
+		}
+	}
+	if len(nodes) == 0 {
+		delete(h.nodePresence, update.UserID)
+	}
+
+	changed := h.refreshPresence(update.UserID)
+	h.mu.Unlock()
+
+	if changed != nil {
+		h.notifyPresence(changed)
 	}
+}
 
+// expireNodePresence forgets presence from nodes that stopped sending
+// heartbeats
+func (h *Hub) expireNodePresence() {
+	cutoff := time.Now().Add(-presenceTTL)
+	var changes []*PresenceUpdate
+
+	h.mu.Lock()
+	for userID, nodes := range h.nodePresence {
+		expired := false
+		for node, presence := range nodes {
+			if node != h.nodeID && presence.received.Before(cutoff) {
+				delete(nodes, node)
+				expired = true
+			}
+		}
+		if !expired {
+			continue
+		}
+		if len(nodes) == 0 {
+			delete(h.nodePresence, userID)
+		}
+		if changed := h.refreshPresence(userID); changed != nil {
+			changes = append(changes, changed)
+		}
+	}
 	h.mu.Unlock()
 
-	// Broadcast the update to all relevant clients
+	for _, update := range changes {
+		h.notifyPresence(update)
+	}
+}
+
+// refreshPresence recomputes a user's presence from what every node
+// reported. A user is offline only when no node has them connected;
+// otherwise the most recently set status wins. It returns the update to
+// send to clients, or nil if nothing changed. The caller holds h.mu.
+func (h *Hub) refreshPresence(userID uint) *PresenceUpdate {
+	var latest *nodePresence
+	for _, presence := range h.nodePresence[userID] {
+		if latest == nil || presence.changed > latest.changed ||
+			(presence.changed == latest.changed && statusRank[presence.status] > statusRank[latest.status]) {
+			latest = presence
+		}
+	}
+
+	status, statusMsg := StatusOffline, ""
+	if latest != nil {
+		status, statusMsg = latest.status, latest.statusMsg
+	}
+
+	current, known := h.userPresence[userID]
+	if known && current.Status == status && current.StatusMsg == statusMsg {
+		return nil
+	}
+	if !known && latest == nil {
+		return nil
+	}
+
+	now := time.Now()
+	h.userPresence[userID] = &PresenceData{
+		Status:    status,
+		LastSeen:  now,
+		StatusMsg: statusMsg,
+	}
+
+	return &PresenceUpdate{
+		Type:      EventTypePresence,
+		UserID:    userID,
+		Status:    status,
+		StatusMsg: statusMsg,
+		Timestamp: now.Unix(),
+	}
+}
+
+// notifyPresence broadcasts a presence update to this node's clients
+func (h *Hub) notifyPresence(update *PresenceUpdate) {
 	data, err := json.Marshal(update)
 	if err != nil {
 		log.Printf("Failed to marshal presence update: %v", err)
 		return
 	}
 
-	// For each channel this user is in, notify all clients
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	// Notify all connected clients
-	for _, clients := range h.channelClients {
+	for _, clients := range h.userClients {
 		clients.RLock()
 		for client := range clients.clients {
-			select {
-			case client.send <- data:
-				// Update sent
-			default:
-				// Buffer full
-				go func(c *Client) {
-					h.unregister <- c
-				}(client)
-			}
+			h.sendToClient(client, data)
 		}
 		clients.RUnlock()
 	}
 }
 
-// updateUserPresence updates a user's presence status
-func (h *Hub) updateUserPresence(userID uint, status string) {
-	update := &PresenceUpdate{
-		Type:      EventTypePresence,
-		UserID:    userID,
-		Status:    status,
-		Timestamp: time.Now().Unix(),
-	}
+// GetPresence returns a user's presence across all nodes
+func (h *Hub) GetPresence(userID uint) (PresenceData, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-	h.presence <- update
+	presence, ok := h.userPresence[userID]
+	if !ok {
+		return PresenceData{}, false
+	}
+	return *presence, true
 }
 
 // sendPresenceData sends current presence data to a newly connected client
@@ -363,33 +785,40 @@ func (h *Hub) sendPresenceData(client *Client) {
 		return
 	}
 
-	client.send <- data
+	h.sendToClient(client, data)
 }
 
 // cleanupInactiveClients removes clients that haven't been active
 func (h *Hub) cleanupInactiveClients() {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	var inactive []*Client
 
+	h.mu.RLock()
 	for _, clientList := range h.userClients {
 		clientList.RLock()
 		for client := range clientList.clients {
 			if time.Since(client.lastActivity) > 10*time.Minute {
-				h.unregister <- client
+				inactive = append(inactive, client)
 			}
 		}
 		clientList.RUnlock()
 	}
+	h.mu.RUnlock()
+
+	for _, client := range inactive {
+		h.unregisterClient(client)
+	}
 
 	// Clean up stale presence data
 	timeout := 24 * time.Hour
 	now := time.Now()
 
+	h.mu.Lock()
 	for userID, presence := range h.userPresence {
 		if presence.Status == StatusOffline && now.Sub(presence.LastSeen) > timeout {
 			delete(h.userPresence, userID)
 		}
 	}
+	h.mu.Unlock()
 }
 
 // SubscribeToChannel adds a client to a channel's broadcast list
@@ -449,7 +878,7 @@ func (h *Hub) UnsubscribeFromChannel(client *Client, channelID uint) {
 	}
 }
 
-// BroadcastToChannel sends a message to a specific channel
+// BroadcastToChannel sends a message to a specific channel on every node
 func (h *Hub) BroadcastToChannel(channelID uint, msgType string, data interface{}) {
 	message := &Message{
 		Type:      msgType,
@@ -458,10 +887,10 @@ func (h *Hub) BroadcastToChannel(channelID uint, msgType string, data interface{
 		Timestamp: time.Now().Unix(),
 	}
 
-	h.broadcast <- message
+	h.broadcastMessage(message)
 }
 
-// BroadcastTyping sends a typing indicator to a channel
+// BroadcastTyping sends a typing indicator to a channel on every node
 func (h *Hub) BroadcastTyping(userID, channelID uint, isTyping bool) {
 	event := &TypingEvent{
 		Type:      EventTypeTyping,
@@ -471,7 +900,7 @@ func (h *Hub) BroadcastTyping(userID, channelID uint, isTyping bool) {
 		Timestamp: time.Now().Unix(),
 	}
 
-	h.typing <- event
+	h.publish(envelopeTyping, channelID, userID, event)
 }
 
 // SendReadReceipt notifies that a user has read a message
@@ -485,43 +914,18 @@ func (h *Hub) SendReadReceipt(messageID, channelID, userID, senderID uint) {
 		Timestamp:       time.Now().Unix(),
 	}
 
-	h.readReceipts <- receipt
+	// Only notify the sender of the original message
+	h.publish(envelopeReadReceipt, channelID, senderID, receipt)
 }
 
-// BroadcastToUser sends a message to all clients of a specific user
+// BroadcastToUser sends a message to all clients of a specific user on
+// every node
 func (h *Hub) BroadcastToUser(userID uint, msgType string, data interface{}) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	clients, ok := h.userClients[userID]
-	if !ok {
-		return
-	}
-
 	message := map[string]interface{}{
 		"type":      msgType,
 		"data":      data,
 		"timestamp": time.Now().Unix(),
 	}
 
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Failed to marshal user message: %v", err)
-		return
-	}
-
-	clients.RLock()
-	defer clients.RUnlock()
-
-	for client := range clients.clients {
-		select {
-		case client.send <- jsonData:
-			// Message sent
-		default:
-			// Buffer full
-			go func(c *Client) {
-				h.unregister <- c
-			}(client)
-		}
-	}
+	h.publish(envelopeUser, 0, userID, message)
 }
@@ -0,0 +1,237 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHubs starts two hubs sharing an in-memory broker and, if given, an
+// event log, standing in for two API instances sharing Redis
+func newTestHubs(t *testing.T, eventLog EventLog) (*Hub, *Hub) {
+	t.Helper()
+
+	broker := NewMemoryBroker()
+	newHub := func() *Hub {
+		hub := NewHubWithBroker(NewConnectionManager(&WebSocketConfig{MaxConnections: 100}), broker)
+		hub.SetChannelAccess(allowChannels(nil))
+		if eventLog != nil {
+			hub.SetEventLog(eventLog)
+		}
+		go hub.Run()
+		t.Cleanup(hub.Stop)
+		return hub
+	}
+	return newHub(), newHub()
+}
+
+// allowChannels lets every user access the given channels, or all
+// channels when nil
+type allowChannels map[uint]bool
+
+func (a allowChannels) CanAccessChannel(ctx context.Context, userID, channelID uint) (bool, error) {
+	return a == nil || a[channelID], nil
+}
+
+func connect(t *testing.T, hub *Hub, userID uint, channels ...uint) *Client {
+	t.Helper()
+
+	client := NewClient(nil, userID, hub)
+	client.Channels = append(client.Channels, channels...)
+	hub.Register(client)
+	return client
+}
+
+// receive waits for the next event of the given type sent to a client
+func receive(t *testing.T, client *Client, eventType string) map[string]interface{} {
+	t.Helper()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case data, ok := <-client.send:
+			require.True(t, ok, "client was closed")
+			if event := decodeEvent(t, data); event["type"] == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("user %d did not receive a %s event", client.UserID, eventType)
+		}
+	}
+}
+
+func decodeEvent(t *testing.T, data []byte) map[string]interface{} {
+	t.Helper()
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &event))
+	return event
+}
+
+// assertNoEvent checks that a client gets no event of the given type
+func assertNoEvent(t *testing.T, client *Client, eventType string) {
+	t.Helper()
+
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case data := <-client.send:
+			event := decodeEvent(t, data)
+			assert.NotEqual(t, eventType, event["type"], "user %d received an unexpected event", client.UserID)
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestBroadcastToChannelReachesOtherNode(t *testing.T) {
+	hubA, hubB := newTestHubs(t, nil)
+
+	alice := connect(t, hubA, 1, 10)
+	bob := connect(t, hubB, 2, 10)
+	carol := connect(t, hubB, 3, 20)
+
+	hubA.BroadcastToChannel(10, EventTypeMessage, map[string]interface{}{"content": "hello"})
+
+	for _, client := range []*Client{alice, bob} {
+		event := receive(t, client, EventTypeMessage)
+		assert.Equal(t, float64(10), event["channelId"])
+		assert.Equal(t, "hello", event["data"].(map[string]interface{})["content"])
+	}
+	assertNoEvent(t, carol, EventTypeMessage)
+}
+
+func TestBroadcastToUserReachesOtherNode(t *testing.T) {
+	hubA, hubB := newTestHubs(t, nil)
+
+	alice := connect(t, hubA, 1)
+	bob := connect(t, hubB, 2)
+
+	hubB.BroadcastToUser(1, EventTypeChannelCreate, map[string]interface{}{"channelId": 5})
+
+	event := receive(t, alice, EventTypeChannelCreate)
+	assert.Equal(t, float64(5), event["data"].(map[string]interface{})["channelId"])
+	assertNoEvent(t, bob, EventTypeChannelCreate)
+}
+
+func TestBroadcastTypingSkipsTypingUser(t *testing.T) {
+	hubA, hubB := newTestHubs(t, nil)
+
+	alice := connect(t, hubA, 1, 10)
+	bob := connect(t, hubB, 2, 10)
+
+	hubB.BroadcastTyping(2, 10, true)
+
+	event := receive(t, alice, EventTypeTyping)
+	assert.Equal(t, float64(2), event["userId"])
+	assert.Equal(t, true, event["isTyping"])
+	assertNoEvent(t, bob, EventTypeTyping)
+}
+
+func TestPresenceAggregatesAcrossNodes(t *testing.T) {
+	hubA, hubB := newTestHubs(t, nil)
+
+	status := func(hub *Hub, userID uint) string {
+		presence, ok := hub.GetPresence(userID)
+		if !ok {
+			return ""
+		}
+		return presence.Status
+	}
+
+	phone := connect(t, hubA, 1)
+	desktop := connect(t, hubB, 1)
+
+	for _, hub := range []*Hub{hubA, hubB} {
+		require.Eventually(t, func() bool { return status(hub, 1) == StatusOnline },
+			2*time.Second, 10*time.Millisecond)
+	}
+
+	// Disconnecting from one node leaves the user online everywhere
+	hubA.unregister <- phone
+	assert.Never(t, func() bool {
+		return status(hubA, 1) != StatusOnline || status(hubB, 1) != StatusOnline
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	hubB.unregister <- desktop
+	for _, hub := range []*Hub{hubA, hubB} {
+		require.Eventually(t, func() bool { return status(hub, 1) == StatusOffline },
+			2*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestPresenceSyncOnNodeStart(t *testing.T) {
+	broker := NewMemoryBroker()
+	hubA := NewHubWithBroker(NewConnectionManager(&WebSocketConfig{MaxConnections: 100}), broker)
+	go hubA.Run()
+	t.Cleanup(hubA.Stop)
+
+	connect(t, hubA, 1)
+	require.Eventually(t, func() bool {
+		_, ok := hubA.GetPresence(1)
+		return ok
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A node started later learns about users already connected elsewhere
+	hubB := NewHubWithBroker(NewConnectionManager(&WebSocketConfig{MaxConnections: 100}), broker)
+	go hubB.Run()
+	t.Cleanup(hubB.Stop)
+
+	require.Eventually(t, func() bool {
+		presence, ok := hubB.GetPresence(1)
+		return ok && presence.Status == StatusOnline
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSingleNodeDeliversBursts(t *testing.T) {
+	hub := NewHub(NewConnectionManager(&WebSocketConfig{MaxConnections: 100}))
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	client := connect(t, hub, 1, 10)
+	receive(t, client, EventTypeBulkPresence)
+
+	// Fill most of the client's buffer at once; nothing may be dropped
+	const burst = 200
+	for i := 0; i < burst; i++ {
+		hub.BroadcastToChannel(10, EventTypeMessage, i)
+	}
+	for i := 0; i < burst; i++ {
+		event := receive(t, client, EventTypeMessage)
+		assert.Equal(t, float64(i), event["data"])
+	}
+}
+
+// stalledBroker accepts subscriptions but blocks every publish until its
+// context ends, like an unreachable Redis
+type stalledBroker struct {
+	*MemoryBroker
+}
+
+func (b stalledBroker) Publish(ctx context.Context, topic string, message []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStalledBrokerDoesNotDelayLocalClients(t *testing.T) {
+	hub := NewHubWithBroker(NewConnectionManager(&WebSocketConfig{MaxConnections: 100}), stalledBroker{NewMemoryBroker()})
+	go hub.Run()
+	t.Cleanup(hub.Stop)
+
+	start := time.Now()
+	alice := connect(t, hub, 1, 10)
+	bob := connect(t, hub, 2, 10)
+	receive(t, alice, EventTypeBulkPresence)
+	receive(t, bob, EventTypeBulkPresence)
+	hub.BroadcastToChannel(10, EventTypeMessage, "hello")
+	hub.BroadcastTyping(2, 10, true)
+
+	receive(t, alice, EventTypeMessage)
+	receive(t, bob, EventTypeMessage)
+	receive(t, alice, EventTypeTyping)
+	assert.Less(t, time.Since(start), publishTimeout)
+}
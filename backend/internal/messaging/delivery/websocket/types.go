@@ -19,6 +19,8 @@ const (
 	EventTypeError              = "error"
 	EventTypeRead               = "read_receipt"
 	EventTypeAttachment         = "attachment"
+	EventTypeResume             = "resume"
+	EventTypeResyncRequired     = "resync_required"
 )
 
 // User status constants
@@ -36,10 +38,12 @@ type ClientMessage struct {
 	Timestamp int64       `json:"timestamp,omitempty"`
 }
 
-// Message represents a message to be broadcast to clients
+// Message represents a message to be broadcast to clients. Seq numbers the
+// events of a channel so clients can detect and replay gaps.
 type Message struct {
 	Type      string      `json:"type"`
 	ChannelID uint        `json:"channelId"`
+	Seq       uint64      `json:"seq,omitempty"`
 	Data      interface{} `json:"data"`
 	Timestamp int64       `json:"timestamp"`
 }
@@ -88,13 +92,17 @@ type ReadReceipt struct {
 // AttachmentEvent represents an attachment being uploaded or processed
 type AttachmentEvent struct {
 	Type         string `json:"type"`
-	AttachmentID uint   `json:"attachmentId"`
-	MessageID    uint   `json:"messageId"`
-	ChannelID    uint   `json:"channelId"`
-	Status       string `json:"status"`             // "uploading", "processing", "complete", "error"
+	AttachmentID string `json:"attachmentId,omitempty"`
+	UploadID     string `json:"uploadId,omitempty"` // resumable upload, before it becomes an attachment
+	MessageID    string `json:"messageId,omitempty"`
+	ChannelID    string `json:"channelId"`
+	Status       string `json:"status"`             // "uploading", "scanning", "processing", "complete", "blocked", "error"
 	Progress     int    `json:"progress,omitempty"` // 0-100 for uploading/processing
 	Error        string `json:"error,omitempty"`
 	Timestamp    int64  `json:"timestamp"`
+
+	// Attachment is the processed attachment, sent with the complete status
+	Attachment interface{} `json:"attachment,omitempty"`
 }
 
 // ErrorMessage represents an error to be sent to clients
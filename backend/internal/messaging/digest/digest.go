@@ -0,0 +1,246 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// maxPreviewLength caps the mention previews in a digest, in runes
+const maxPreviewLength = 140
+
+// channelSummary is an unread channel listed in a digest
+type channelSummary struct {
+	Name     string
+	Unread   int
+	Mentions int
+	HasNew   bool
+	Link     string
+}
+
+// mentionSummary is an unread mention listed in a digest
+type mentionSummary struct {
+	Sender    string
+	Channel   string
+	Preview   string
+	CreatedAt time.Time
+	Link      string
+}
+
+// digest is the content of a digest email
+type digest struct {
+	Username        string
+	Frequency       domain.DigestFrequency
+	Channels        []channelSummary
+	Mentions        []mentionSummary
+	MentionTotal    int
+	MarkReadLink    string
+	UnsubscribeLink string
+}
+
+// build collects a user's unread channels and mentions. Muted channels
+// are left out; mentions in them are not.
+func (s *Service) build(ctx context.Context, c candidate, frequency domain.DigestFrequency, since time.Time) (*digest, error) {
+	now := time.Now()
+	channels, err := s.channels(ctx, c.UserID, since, now)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &digest{
+		Username:        c.Username,
+		Frequency:       frequency,
+		MarkReadLink:    s.link("/messaging/digest/mark-read", s.signToken(c.UserID, purposeMarkRead, now.Add(markReadTokenTTL))),
+		UnsubscribeLink: s.link("/messaging/digest/unsubscribe", s.signToken(c.UserID, purposeUnsubscribe, time.Time{})),
+	}
+
+	names := make(map[uuid.UUID]string, len(channels))
+	for _, channel := range channels {
+		names[channel.ID] = channel.Name
+		if channel.Muted {
+			continue
+		}
+
+		status, err := s.reads.GetChannelReadStatus(ctx, channel.ID, c.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load read status of channel %s: %w", channel.ID, err)
+		}
+		if status.UnreadCount == 0 {
+			continue
+		}
+		d.Channels = append(d.Channels, channelSummary{
+			Name:     channel.Name,
+			Unread:   status.UnreadCount,
+			Mentions: status.MentionCount,
+			HasNew:   channel.HasNew,
+			Link:     s.messageLink(channel.ID, status.LastReadID),
+		})
+	}
+
+	if s.notifications == nil {
+		return d, nil
+	}
+	notifications, _, err := s.notifications.GetUserNotifications(ctx, c.UserID, true, mentionLookupLimit, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mentions: %w", err)
+	}
+
+	var mentions []*domain.Notification
+	for _, notification := range notifications {
+		if notification.Type == domain.NotificationTypeMention {
+			mentions = append(mentions, notification)
+		}
+	}
+	d.MentionTotal = len(mentions)
+	if len(mentions) > maxMentions {
+		mentions = mentions[:maxMentions]
+	}
+
+	senders, err := s.usernames(ctx, mentions)
+	if err != nil {
+		return nil, err
+	}
+	for _, mention := range mentions {
+		d.Mentions = append(d.Mentions, mentionSummary{
+			Sender:    senders[mention.SenderID],
+			Channel:   names[mention.ChannelID],
+			Preview:   truncate(mention.Content, maxPreviewLength),
+			CreatedAt: mention.CreatedAt,
+			Link:      s.messageLink(mention.ChannelID, mention.MessageID),
+		})
+	}
+	return d, nil
+}
+
+// usernames returns the usernames of the senders of mentions
+func (s *Service) usernames(ctx context.Context, mentions []*domain.Notification) (map[uuid.UUID]string, error) {
+	names := make(map[uuid.UUID]string)
+	if len(mentions) == 0 {
+		return names, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(mentions))
+	for _, mention := range mentions {
+		ids = append(ids, mention.SenderID)
+	}
+	var users []struct {
+		ID       uuid.UUID
+		Username string
+	}
+	err := s.db.WithContext(ctx).Raw(`SELECT id, username FROM users WHERE id IN ?`, ids).Scan(&users).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mention senders: %w", err)
+	}
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names, nil
+}
+
+// hasNews reports whether anything in the digest happened after since, so
+// users are not emailed the same unread messages again
+func (d *digest) hasNews(since time.Time) bool {
+	for _, channel := range d.Channels {
+		if channel.HasNew {
+			return true
+		}
+	}
+	for _, mention := range d.Mentions {
+		if mention.CreatedAt.After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *digest) unread() int {
+	total := 0
+	for _, channel := range d.Channels {
+		total += channel.Unread
+	}
+	return total
+}
+
+func (d *digest) subject() string {
+	if d.MentionTotal > 0 {
+		return fmt.Sprintf("You were mentioned %s and have %s",
+			plural(d.MentionTotal, "time", "times"), plural(d.unread(), "unread message", "unread messages"))
+	}
+	return fmt.Sprintf("You have %s in %s",
+		plural(d.unread(), "unread message", "unread messages"), plural(len(d.Channels), "channel", "channels"))
+}
+
+func (d *digest) body() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Hi %s,\n\nHere is what you missed.\n", d.Username)
+
+	if len(d.Mentions) > 0 {
+		b.WriteString("\nMentions\n")
+		for _, mention := range d.Mentions {
+			sender := mention.Sender
+			if sender == "" {
+				sender = "Someone"
+			}
+			if mention.Channel != "" {
+				fmt.Fprintf(&b, "\n%s in #%s:\n", sender, mention.Channel)
+			} else {
+				fmt.Fprintf(&b, "\n%s:\n", sender)
+			}
+			fmt.Fprintf(&b, "  \"%s\"\n  %s\n", mention.Preview, mention.Link)
+		}
+		if more := d.MentionTotal - len(d.Mentions); more > 0 {
+			fmt.Fprintf(&b, "\n...and %s more.\n", plural(more, "mention", "mentions"))
+		}
+	}
+
+	if len(d.Channels) > 0 {
+		b.WriteString("\nUnread channels\n\n")
+		for _, channel := range d.Channels {
+			fmt.Fprintf(&b, "#%s: %s", channel.Name, plural(channel.Unread, "unread message", "unread messages"))
+			if channel.Mentions > 0 {
+				fmt.Fprintf(&b, ", %s", plural(channel.Mentions, "mention", "mentions"))
+			}
+			fmt.Fprintf(&b, "\n  %s\n", channel.Link)
+		}
+	}
+
+	fmt.Fprintf(&b, "\nMark everything as read:\n%s\n", d.MarkReadLink)
+	fmt.Fprintf(&b, "\nYou receive this digest %s because of your notification settings. To stop receiving it:\n%s\n",
+		d.Frequency, d.UnsubscribeLink)
+
+	return b.String()
+}
+
+// messageLink links to a message in a channel, or to the channel when
+// there is no message
+func (s *Service) messageLink(channelID, messageID uuid.UUID) string {
+	link := strings.TrimSuffix(s.config.PublicURL, "/") + "/messaging/channels/" + channelID.String()
+	if messageID != uuid.Nil {
+		link += "?message=" + messageID.String()
+	}
+	return link
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// truncate shortens s to at most max runes, ending it with an ellipsis
+func truncate(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
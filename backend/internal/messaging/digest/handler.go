@@ -0,0 +1,77 @@
+package digest
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves the actions linked from digest emails. The emailed
+// token authenticates them, so the routes need no session.
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new digest handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers the digest routes
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
+	digest := router.Group("/digest")
+	{
+		digest.POST("/unsubscribe", h.Unsubscribe)
+		digest.POST("/mark-read", h.MarkAllRead)
+	}
+}
+
+type tokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Unsubscribe turns off the digests of the token's user
+func (h *Handler) Unsubscribe(c *gin.Context) {
+	var req tokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	if err := h.service.Unsubscribe(c.Request.Context(), req.Token); err != nil {
+		h.sendError(c, err, "Failed to unsubscribe from email digests")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "You will no longer receive email digests"})
+}
+
+// MarkAllRead marks every channel and notification of the token's user as
+// read
+func (h *Handler) MarkAllRead(c *gin.Context) {
+	var req tokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	channels, err := h.service.MarkAllRead(c.Request.Context(), req.Token)
+	if err != nil {
+		h.sendError(c, err, "Failed to mark messages as read")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "All messages marked as read", "channels": channels})
+}
+
+func (h *Handler) sendError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrDigestsUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
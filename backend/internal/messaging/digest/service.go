@@ -0,0 +1,261 @@
+// Package digest emails users a summary of what they missed while away.
+// Users choose hourly or daily digests in their notification settings; each
+// run finds the users whose digest is due and who have new messages, lists
+// their unread channels and mentions with links back to the messages, and
+// sends it with links to mark everything read or to unsubscribe.
+package digest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+const (
+	// dueSlack lets a digest go out on the run just before its interval has
+	// passed, so run timing jitter does not delay it by a whole run
+	dueSlack = 5 * time.Minute
+
+	// maxMentions is the number of mentions listed in a digest
+	maxMentions = 10
+	// mentionLookupLimit is the number of unread notifications searched
+	// for mentions
+	mentionLookupLimit = 100
+)
+
+var (
+	// ErrDigestsUnavailable is returned when digests are not configured
+	ErrDigestsUnavailable = errors.New("email digests are not configured")
+	// ErrInvalidToken is returned for tokens that are malformed, forged,
+	// expired or issued for another action
+	ErrInvalidToken = errors.New("invalid or expired digest token")
+)
+
+// Config configures a Service
+type Config struct {
+	// SigningKey signs the unsubscribe and mark read tokens; digests are
+	// disabled without it
+	SigningKey []byte
+	// PublicURL is the frontend origin used in emailed links
+	PublicURL string
+}
+
+// Mailer sends plain text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Delivery records when a user was last sent a digest
+type Delivery struct {
+	UserID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"userId"`
+	LastSentAt time.Time `gorm:"not null" json:"lastSentAt"`
+}
+
+func (Delivery) TableName() string {
+	return "messaging_email_digests"
+}
+
+// Report summarizes a digest run
+type Report struct {
+	Candidates int `json:"candidates"`
+	Sent       int `json:"sent"`
+	Failed     int `json:"failed"`
+}
+
+// Service builds and sends email digests
+type Service struct {
+	db            *gorm.DB
+	config        Config
+	mailer        Mailer
+	settings      domain.UserSettingsRepository
+	reads         domain.ReadReceiptRepository
+	notifications domain.NotificationRepository
+}
+
+// NewService creates a new digest service
+func NewService(db *gorm.DB, config Config) *Service {
+	if len(config.SigningKey) > 0 {
+		// Derive a purpose-specific key so a shared secret such as the JWT key
+		// can never produce a token valid elsewhere
+		mac := hmac.New(sha256.New, config.SigningKey)
+		mac.Write([]byte("messaging.email-digests"))
+		config.SigningKey = mac.Sum(nil)
+	}
+	return &Service{db: db, config: config}
+}
+
+// SetMailer sets the mailer digests are sent with
+func (s *Service) SetMailer(mailer Mailer) {
+	s.mailer = mailer
+}
+
+// SetUserSettings sets where users' digest frequency is read from and
+// where unsubscribing turns it off
+func (s *Service) SetUserSettings(settings domain.UserSettingsRepository) {
+	s.settings = settings
+}
+
+// SetReadReceipts sets where channels' unread counts are read from and
+// where marking everything read is recorded
+func (s *Service) SetReadReceipts(reads domain.ReadReceiptRepository) {
+	s.reads = reads
+}
+
+// SetNotifications sets where users' mentions are read from. Without it,
+// digests list unread channels only.
+func (s *Service) SetNotifications(notifications domain.NotificationRepository) {
+	s.notifications = notifications
+}
+
+// Enabled reports whether digests can be built and sent
+func (s *Service) Enabled() bool {
+	return len(s.config.SigningKey) > 0 && s.mailer != nil && s.settings != nil && s.reads != nil
+}
+
+// candidate is a user with new messages in one of their channels
+type candidate struct {
+	UserID     uuid.UUID
+	Username   string
+	Email      string
+	LastSentAt *time.Time
+}
+
+// Run sends every digest that is due. A failure for one user is logged
+// and does not stop the others.
+func (s *Service) Run(ctx context.Context) (*Report, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+
+	now := time.Now()
+	candidates, err := s.candidates(ctx, now.Add(-domain.DigestDaily.Interval()))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Candidates: len(candidates)}
+	for _, c := range candidates {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		sent, err := s.send(ctx, c, now)
+		if err != nil {
+			report.Failed++
+			log.Printf("Failed to send email digest to user %s: %v", c.UserID, err)
+			continue
+		}
+		if sent {
+			report.Sent++
+		}
+	}
+	return report, nil
+}
+
+// candidates returns the active users with messages from others posted
+// after since in one of their channels
+func (s *Service) candidates(ctx context.Context, since time.Time) ([]candidate, error) {
+	var candidates []candidate
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT u.id AS user_id, u.username, u.email, d.last_sent_at
+		FROM users u
+		LEFT JOIN messaging_email_digests d ON d.user_id = u.id
+		WHERE u.is_active AND u.email <> ''
+		AND EXISTS (
+			SELECT 1 FROM messaging_channel_members cm
+			JOIN messaging_messages m ON m.channel_id = cm.channel_id
+			WHERE cm.user_id = u.id AND m.user_id <> u.id
+			AND NOT m.is_deleted AND m.created_at > ?
+		)
+		ORDER BY u.id`, since).
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find digest recipients: %w", err)
+	}
+	return candidates, nil
+}
+
+// send builds and sends a user's digest if it is due and has anything new
+func (s *Service) send(ctx context.Context, c candidate, now time.Time) (bool, error) {
+	settings, err := s.settings.GetNotificationSettings(ctx, c.UserID)
+	if err != nil {
+		if domain.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load notification settings: %w", err)
+	}
+	interval := settings.EmailDigest.Interval()
+	if interval == 0 {
+		return false, nil
+	}
+
+	since := now.Add(-interval)
+	if c.LastSentAt != nil {
+		if now.Sub(*c.LastSentAt) < interval-dueSlack {
+			return false, nil
+		}
+		since = *c.LastSentAt
+	}
+
+	digest, err := s.build(ctx, c, settings.EmailDigest, since)
+	if err != nil {
+		return false, err
+	}
+	if !digest.hasNews(since) {
+		return false, nil
+	}
+
+	if err := s.mailer.Send(c.Email, digest.subject(), digest.body()); err != nil {
+		return false, fmt.Errorf("failed to send digest email: %w", err)
+	}
+
+	err = s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_sent_at"}),
+	}).Create(&Delivery{UserID: c.UserID, LastSentAt: now}).Error
+	if err != nil {
+		return true, fmt.Errorf("failed to record digest delivery: %w", err)
+	}
+	return true, nil
+}
+
+// memberChannel is a channel a user belongs to
+type memberChannel struct {
+	ID     uuid.UUID
+	Name   string
+	Muted  bool
+	HasNew bool
+}
+
+// channels returns the channels a user belongs to, and whether others
+// posted in each after since
+func (s *Service) channels(ctx context.Context, userID uuid.UUID, since, now time.Time) ([]memberChannel, error) {
+	var channels []memberChannel
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT c.id, c.name,
+			COALESCE(cm.is_muted, false) AND (cm.muted_until IS NULL OR cm.muted_until > ?) AS muted,
+			EXISTS (
+				SELECT 1 FROM messaging_messages m
+				WHERE m.channel_id = c.id AND m.user_id <> cm.user_id
+				AND NOT m.is_deleted AND m.created_at > ?
+			) AS has_new
+		FROM messaging_channel_members cm
+		JOIN messaging_channels c ON c.id = cm.channel_id
+		WHERE cm.user_id = ?
+		ORDER BY c.name, c.id`, now, since, userID).
+		Scan(&channels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channels: %w", err)
+	}
+	return channels, nil
+}
@@ -0,0 +1,382 @@
+package digest
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// schema is the part of the schema digests read
+var schema = []string{
+	`CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT, email TEXT, is_active BOOLEAN DEFAULT true)`,
+	`CREATE TABLE messaging_channels (id TEXT PRIMARY KEY, name TEXT)`,
+	`CREATE TABLE messaging_channel_members (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT,
+		is_muted BOOLEAN DEFAULT false, muted_until DATETIME)`,
+	`CREATE TABLE messaging_messages (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, content TEXT,
+		is_deleted BOOLEAN DEFAULT false, created_at DATETIME)`,
+}
+
+type fakeMailer struct {
+	sent []sentMail
+}
+
+type sentMail struct {
+	to, subject, body string
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+type fakeSettings struct {
+	domain.UserSettingsRepository
+	settings map[uuid.UUID]*domain.NotificationSettings
+}
+
+func (f *fakeSettings) GetNotificationSettings(ctx context.Context, userID uuid.UUID) (*domain.NotificationSettings, error) {
+	settings, ok := f.settings[userID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	copied := *settings
+	return &copied, nil
+}
+
+func (f *fakeSettings) UpdateNotificationSettings(ctx context.Context, userID uuid.UUID, settings *domain.NotificationSettings) error {
+	f.settings[userID] = settings
+	return nil
+}
+
+type receiptKey struct {
+	channelID, userID uuid.UUID
+}
+
+type fakeReads struct {
+	domain.ReadReceiptRepository
+	statuses map[receiptKey]*domain.ChannelReadStatus
+	marked   []receiptKey
+}
+
+func (f *fakeReads) GetChannelReadStatus(ctx context.Context, channelID, userID uuid.UUID) (*domain.ChannelReadStatus, error) {
+	if status, ok := f.statuses[receiptKey{channelID, userID}]; ok {
+		return status, nil
+	}
+	return &domain.ChannelReadStatus{ChannelID: channelID, UserID: userID}, nil
+}
+
+func (f *fakeReads) MarkChannelAsRead(ctx context.Context, channelID, userID uuid.UUID) error {
+	f.marked = append(f.marked, receiptKey{channelID, userID})
+	delete(f.statuses, receiptKey{channelID, userID})
+	return nil
+}
+
+type fakeNotifications struct {
+	domain.NotificationRepository
+	notifications []*domain.Notification
+}
+
+func (f *fakeNotifications) GetUserNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit, offset int) ([]*domain.Notification, int, error) {
+	var found []*domain.Notification
+	for _, notification := range f.notifications {
+		if notification.UserID == userID && (!unreadOnly || !notification.IsRead) {
+			found = append(found, notification)
+		}
+	}
+	return found, len(found), nil
+}
+
+func (f *fakeNotifications) MarkAllAsRead(ctx context.Context, userID uuid.UUID) error {
+	for _, notification := range f.notifications {
+		if notification.UserID == userID {
+			notification.IsRead = true
+		}
+	}
+	return nil
+}
+
+type testEnv struct {
+	db            *gorm.DB
+	service       *Service
+	mailer        *fakeMailer
+	settings      *fakeSettings
+	reads         *fakeReads
+	notifications *fakeNotifications
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	for _, statement := range schema {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	require.NoError(t, db.AutoMigrate(&Delivery{}))
+
+	env := &testEnv{
+		db:            db,
+		mailer:        &fakeMailer{},
+		settings:      &fakeSettings{settings: make(map[uuid.UUID]*domain.NotificationSettings)},
+		reads:         &fakeReads{statuses: make(map[receiptKey]*domain.ChannelReadStatus)},
+		notifications: &fakeNotifications{},
+	}
+	env.service = NewService(db, Config{SigningKey: []byte("secret"), PublicURL: "https://example.com/"})
+	env.service.SetMailer(env.mailer)
+	env.service.SetUserSettings(env.settings)
+	env.service.SetReadReceipts(env.reads)
+	env.service.SetNotifications(env.notifications)
+	return env
+}
+
+func (e *testEnv) user(t *testing.T, name string, frequency domain.DigestFrequency) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	require.NoError(t, e.db.Exec("INSERT INTO users (id, username, email) VALUES (?, ?, ?)", id, name, name+"@example.com").Error)
+	if frequency != "" {
+		e.settings.settings[id] = &domain.NotificationSettings{EmailDigest: frequency}
+	}
+	return id
+}
+
+func (e *testEnv) channel(t *testing.T, name string, members ...uuid.UUID) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	require.NoError(t, e.db.Exec("INSERT INTO messaging_channels (id, name) VALUES (?, ?)", id, name).Error)
+	for _, member := range members {
+		require.NoError(t, e.db.Exec("INSERT INTO messaging_channel_members (id, channel_id, user_id) VALUES (?, ?, ?)",
+			uuid.New(), id, member).Error)
+	}
+	return id
+}
+
+func (e *testEnv) message(t *testing.T, channelID, senderID uuid.UUID, age time.Duration) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	require.NoError(t, e.db.Exec("INSERT INTO messaging_messages (id, channel_id, user_id, content, created_at) VALUES (?, ?, ?, ?, ?)",
+		id, channelID, senderID, "hello", time.Now().Add(-age)).Error)
+	return id
+}
+
+func (e *testEnv) unread(channelID, userID uuid.UUID, count, mentions int, lastReadID uuid.UUID) {
+	e.reads.statuses[receiptKey{channelID, userID}] = &domain.ChannelReadStatus{
+		ChannelID:    channelID,
+		UserID:       userID,
+		LastReadID:   lastReadID,
+		UnreadCount:  count,
+		MentionCount: mentions,
+	}
+}
+
+func (e *testEnv) mailTo(t *testing.T, name string) sentMail {
+	t.Helper()
+	for _, mail := range e.mailer.sent {
+		if mail.to == name+"@example.com" {
+			return mail
+		}
+	}
+	require.Failf(t, "no digest sent", "to %s", name)
+	return sentMail{}
+}
+
+var tokenPattern = regexp.MustCompile(`https://example\.com/messaging/digest/([a-z-]+)\?token=(\S+)`)
+
+// tokens returns the tokens of the action links in a digest by action
+func tokens(t *testing.T, body string) map[string]string {
+	t.Helper()
+	found := make(map[string]string)
+	for _, match := range tokenPattern.FindAllStringSubmatch(body, -1) {
+		token, err := url.QueryUnescape(match[2])
+		require.NoError(t, err)
+		found[match[1]] = token
+	}
+	return found
+}
+
+func TestRunSendsDueDigests(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	eve := env.user(t, "eve", "")
+	alice := env.user(t, "alice", domain.DigestHourly)
+	bob := env.user(t, "bob", domain.DigestDaily)
+	carol := env.user(t, "carol", "")
+	dave := env.user(t, "dave", domain.DigestHourly)
+
+	general := env.channel(t, "general", eve, alice, bob, carol)
+	quiet := env.channel(t, "quiet", eve, dave)
+	lastRead := env.message(t, general, eve, 3*time.Hour)
+	mentioned := env.message(t, general, eve, 20*time.Minute)
+	env.message(t, general, eve, 10*time.Minute)
+	env.message(t, quiet, eve, 48*time.Hour)
+	env.unread(general, alice, 2, 1, lastRead)
+	env.unread(general, bob, 3, 0, uuid.Nil)
+	env.unread(quiet, dave, 1, 0, uuid.Nil)
+	env.notifications.notifications = []*domain.Notification{
+		domain.NewMentionNotification(alice, general, mentioned, eve, "hey @alice,\n  can you   look at this?"),
+		domain.NewMessageNotification(alice, general, mentioned, eve, "not a mention"),
+	}
+
+	report, err := env.service.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Candidates, "dave's channel has nothing new")
+	assert.Equal(t, 2, report.Sent, "carol has not chosen a digest")
+	assert.Zero(t, report.Failed)
+
+	mail := env.mailTo(t, "alice")
+	assert.Equal(t, "You were mentioned 1 time and have 2 unread messages", mail.subject)
+	assert.Contains(t, mail.body, "Hi alice,")
+	assert.Contains(t, mail.body, "eve in #general:\n  \"hey @alice, can you look at this?\"\n  https://example.com/messaging/channels/"+general.String()+"?message="+mentioned.String())
+	assert.Contains(t, mail.body, "#general: 2 unread messages, 1 mention\n  https://example.com/messaging/channels/"+general.String()+"?message="+lastRead.String())
+	assert.NotContains(t, mail.body, "not a mention")
+	assert.Contains(t, mail.body, "You receive this digest hourly")
+	assert.Len(t, tokens(t, mail.body), 2)
+
+	mail = env.mailTo(t, "bob")
+	assert.Equal(t, "You have 3 unread messages in 1 channel", mail.subject)
+	assert.Contains(t, mail.body, "#general: 3 unread messages\n  https://example.com/messaging/channels/"+general.String()+"\n")
+	assert.NotContains(t, mail.body, "Mentions")
+
+	var delivery Delivery
+	require.NoError(t, env.db.Where("user_id = ?", alice).First(&delivery).Error)
+	assert.WithinDuration(t, time.Now(), delivery.LastSentAt, time.Minute)
+
+	// Nothing is due right after a run
+	report, err = env.service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.Sent)
+	assert.Len(t, env.mailer.sent, 2)
+
+	// An hour later alice's digest is due but there is nothing new
+	require.NoError(t, env.db.Model(&Delivery{}).Where("user_id IN ?", []uuid.UUID{alice, bob}).
+		Update("last_sent_at", time.Now().Add(-58*time.Minute)).Error)
+	require.NoError(t, env.db.Exec("UPDATE messaging_messages SET created_at = ?", time.Now().Add(-2*time.Hour)).Error)
+	env.notifications.notifications[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	report, err = env.service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.Sent)
+
+	// A new message goes out in alice's hourly digest but waits for bob's
+	// daily one
+	env.message(t, general, eve, time.Minute)
+	env.unread(general, alice, 3, 1, lastRead)
+	report, err = env.service.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Sent)
+	assert.Equal(t, "alice@example.com", env.mailer.sent[2].to)
+}
+
+func TestRunSkipsMutedAndReadChannels(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	eve := env.user(t, "eve", "")
+	alice := env.user(t, "alice", domain.DigestHourly)
+	muted := env.channel(t, "muted", eve, alice)
+	read := env.channel(t, "read", eve, alice)
+	require.NoError(t, env.db.Exec("UPDATE messaging_channel_members SET is_muted = true WHERE channel_id = ?", muted).Error)
+	env.message(t, muted, eve, time.Minute)
+	env.message(t, read, eve, time.Minute)
+	env.unread(muted, alice, 5, 0, uuid.Nil)
+
+	report, err := env.service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, report.Sent)
+
+	// Mutes that ended no longer hide the channel
+	require.NoError(t, env.db.Exec("UPDATE messaging_channel_members SET muted_until = ? WHERE channel_id = ?",
+		time.Now().Add(-time.Hour), muted).Error)
+	report, err = env.service.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Sent)
+	assert.Contains(t, env.mailTo(t, "alice").body, "#muted: 5 unread messages")
+}
+
+func TestRunRequiresConfiguration(t *testing.T) {
+	env := newTestEnv(t)
+	service := NewService(env.db, Config{PublicURL: "https://example.com"})
+	service.SetMailer(env.mailer)
+	service.SetUserSettings(env.settings)
+	service.SetReadReceipts(env.reads)
+	assert.False(t, service.Enabled(), "digests need a signing key")
+
+	report, err := service.Run(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, report)
+
+	_, err = service.MarkAllRead(context.Background(), "token")
+	assert.ErrorIs(t, err, ErrDigestsUnavailable)
+}
+
+func TestDigestActions(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	eve := env.user(t, "eve", "")
+	alice := env.user(t, "alice", domain.DigestDaily)
+	general := env.channel(t, "general", eve, alice)
+	random := env.channel(t, "random", eve, alice)
+	message := env.message(t, general, eve, time.Minute)
+	env.unread(general, alice, 1, 1, uuid.Nil)
+	env.notifications.notifications = []*domain.Notification{
+		domain.NewMentionNotification(alice, general, message, eve, "@alice"),
+	}
+
+	_, err := env.service.Run(ctx)
+	require.NoError(t, err)
+	links := tokens(t, env.mailTo(t, "alice").body)
+	require.Contains(t, links, "mark-read")
+	require.Contains(t, links, "unsubscribe")
+
+	// Tokens only work for the action they were issued for
+	assert.ErrorIs(t, env.service.Unsubscribe(ctx, links["mark-read"]), ErrInvalidToken)
+	_, err = env.service.MarkAllRead(ctx, links["unsubscribe"])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	payload, sig, _ := strings.Cut(links["unsubscribe"], ".")
+	assert.ErrorIs(t, env.service.Unsubscribe(ctx, payload+"x."+sig), ErrInvalidToken)
+	assert.ErrorIs(t, env.service.Unsubscribe(ctx, "garbage"), ErrInvalidToken)
+
+	other := NewService(env.db, Config{SigningKey: []byte("another secret")})
+	other.SetUserSettings(env.settings)
+	assert.ErrorIs(t, other.Unsubscribe(ctx, links["unsubscribe"]), ErrInvalidToken)
+
+	expired := env.service.signToken(alice, purposeMarkRead, time.Now().Add(-time.Minute))
+	_, err = env.service.MarkAllRead(ctx, expired)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	channels, err := env.service.MarkAllRead(ctx, links["mark-read"])
+	require.NoError(t, err)
+	assert.Equal(t, 2, channels)
+	assert.ElementsMatch(t, []receiptKey{{general, alice}, {random, alice}}, env.reads.marked)
+	assert.True(t, env.notifications.notifications[0].IsRead)
+
+	require.NoError(t, env.service.Unsubscribe(ctx, links["unsubscribe"]))
+	assert.Equal(t, domain.DigestOff, env.settings.settings[alice].EmailDigest)
+	require.NoError(t, env.service.Unsubscribe(ctx, links["unsubscribe"]), "unsubscribing twice is fine")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "a b c", truncate(" a\n b\tc ", 10))
+	assert.Equal(t, "ééé…", truncate("éééééé", 4))
+}
@@ -0,0 +1,154 @@
+package digest
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+const (
+	// Actions a token can be issued for
+	purposeUnsubscribe = "unsubscribe"
+	purposeMarkRead    = "mark-read"
+
+	// markReadTokenTTL is how long the mark read link of a digest works.
+	// Unsubscribe links do not expire.
+	markReadTokenTTL = 7 * 24 * time.Hour
+)
+
+// digestToken is the signed payload of an emailed action link
+type digestToken struct {
+	UserID    string `json:"uid"`
+	Purpose   string `json:"purpose"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// Unsubscribe turns off the digests of the user a token was issued for
+func (s *Service) Unsubscribe(ctx context.Context, token string) error {
+	if s.settings == nil {
+		return ErrDigestsUnavailable
+	}
+	userID, err := s.parseToken(token, purposeUnsubscribe)
+	if err != nil {
+		return err
+	}
+
+	settings, err := s.settings.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		if domain.IsNotFoundError(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to load notification settings: %w", err)
+	}
+	if settings.EmailDigest == domain.DigestOff {
+		return nil
+	}
+
+	settings.EmailDigest = domain.DigestOff
+	if err := s.settings.UpdateNotificationSettings(ctx, userID, settings); err != nil {
+		return fmt.Errorf("failed to update notification settings: %w", err)
+	}
+	return nil
+}
+
+// MarkAllRead marks every channel and notification of the user a token was
+// issued for as read. It returns the number of channels marked.
+func (s *Service) MarkAllRead(ctx context.Context, token string) (int, error) {
+	if s.reads == nil {
+		return 0, ErrDigestsUnavailable
+	}
+	userID, err := s.parseToken(token, purposeMarkRead)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	channels, err := s.channels(ctx, userID, now, now)
+	if err != nil {
+		return 0, err
+	}
+	for _, channel := range channels {
+		if err := s.reads.MarkChannelAsRead(ctx, channel.ID, userID); err != nil {
+			return 0, fmt.Errorf("failed to mark channel %s as read: %w", channel.ID, err)
+		}
+	}
+
+	if s.notifications != nil {
+		if err := s.notifications.MarkAllAsRead(ctx, userID); err != nil {
+			return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+		}
+	}
+	return len(channels), nil
+}
+
+// signToken issues an HMAC-signed token for an action on a user's
+// messages. A zero expiry issues a token that does not expire.
+func (s *Service) signToken(userID uuid.UUID, purpose string, expires time.Time) string {
+	claims := digestToken{UserID: userID.String(), Purpose: purpose}
+	if !expires.IsZero() {
+		claims.ExpiresAt = expires.Unix()
+	}
+	payload, _ := json.Marshal(claims)
+
+	mac := hmac.New(sha256.New, s.config.SigningKey)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseToken returns the user a token was issued to after checking its
+// signature, expiry and purpose
+func (s *Service) parseToken(token, purpose string) (uuid.UUID, error) {
+	if len(s.config.SigningKey) == 0 {
+		return uuid.Nil, ErrDigestsUnavailable
+	}
+
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	mac := hmac.New(sha256.New, s.config.SigningKey)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return uuid.Nil, ErrInvalidToken
+	}
+
+	var claims digestToken
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	if claims.Purpose != purpose {
+		return uuid.Nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() > claims.ExpiresAt {
+		return uuid.Nil, ErrInvalidToken
+	}
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	return userID, nil
+}
+
+func (s *Service) link(path, token string) string {
+	return strings.TrimSuffix(s.config.PublicURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
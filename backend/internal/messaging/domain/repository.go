@@ -283,12 +283,14 @@ type MessageFilter struct {
 	Search        string        `json:"search,omitempty"`
 }
 
-// Pagination defines pagination parameters
+// Pagination defines pagination parameters. Where supported, Cursor
+// continues after a previous result and takes precedence over Page.
 type Pagination struct {
 	Page      int    `json:"page"`
 	PageSize  int    `json:"page_size"`
 	SortBy    string `json:"sort_by,omitempty"`
 	SortOrder string `json:"sort_order,omitempty"`
+	Cursor    string `json:"cursor,omitempty"`
 }
 
 // NewDefaultPagination creates a default pagination
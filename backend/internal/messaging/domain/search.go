@@ -18,8 +18,11 @@ const (
 	SearchOperatorOr SearchOperator = "OR"
 )
 
-// SearchFilter defines the criteria for searching messages
+// SearchFilter defines the criteria for searching messages. Query may use
+// the search operators from:, in:#, has:attachment, before: and after:.
+// Only messages in channels ViewerID is a member of are found.
 type SearchFilter struct {
+	ViewerID      *uuid.UUID    `json:"-"`
 	UserID        *uuid.UUID    `json:"user_id,omitempty"`
 	ChannelID     *uuid.UUID    `json:"channel_id,omitempty"`
 	Types         []MessageType `json:"types,omitempty"`
@@ -36,6 +39,8 @@ type SearchResult struct {
 	User       *User    `json:"user"`
 	Score      float64  `json:"score"`
 	Highlights []string `json:"highlights"`
+	// Cursor continues the search after this result
+	Cursor string `json:"cursor"`
 }
 
 // SearchOptions represents options to customize search results
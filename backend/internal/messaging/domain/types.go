@@ -242,13 +242,18 @@ type PinnedMessage struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
-// MessageRetentionPolicy represents a policy for message retention
+// MessageRetentionPolicy represents a policy for message retention.
+// RetentionDays of 0 uses the server-wide default and -1 keeps messages
+// forever. Nothing is deleted from a channel under legal hold.
 type MessageRetentionPolicy struct {
-	ID            uuid.UUID `json:"id" db:"id"`
-	ChannelID     uuid.UUID `json:"channel_id" db:"channel_id"`
-	RetentionDays int       `json:"retention_days" db:"retention_days"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	ChannelID       uuid.UUID  `json:"channel_id" db:"channel_id"`
+	RetentionDays   int        `json:"retention_days" db:"retention_days"`
+	LegalHold       bool       `json:"legal_hold" db:"legal_hold"`
+	LegalHoldReason string     `json:"legal_hold_reason,omitempty" db:"legal_hold_reason"`
+	LegalHoldSince  *time.Time `json:"legal_hold_since,omitempty" db:"legal_hold_since"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // MessagingUser represents a user in the messaging system
@@ -260,6 +265,9 @@ type MessagingUser struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// User is the messaging view of a user
+type User = MessagingUser
+
 // SearchScope defines where to search
 type SearchScope string
 
@@ -289,15 +297,43 @@ type UserSettings struct {
 
 // NotificationSettings represents user notification preferences
 type NotificationSettings struct {
-	DesktopNotifications bool       `json:"desktop_notifications" db:"desktop_notifications"`
-	EmailNotifications   bool       `json:"email_notifications" db:"email_notifications"`
-	MobileNotifications  bool       `json:"mobile_notifications" db:"mobile_notifications"`
-	MentionNotifications bool       `json:"mention_notifications" db:"mention_notifications"`
-	ThreadNotifications  bool       `json:"thread_notifications" db:"thread_notifications"`
-	SoundEnabled         bool       `json:"sound_enabled" db:"sound_enabled"`
-	DoNotDisturb         bool       `json:"do_not_disturb" db:"do_not_disturb"`
-	DoNotDisturbStart    *time.Time `json:"do_not_disturb_start,omitempty" db:"do_not_disturb_start"`
-	DoNotDisturbEnd      *time.Time `json:"do_not_disturb_end,omitempty" db:"do_not_disturb_end"`
+	DesktopNotifications bool            `json:"desktop_notifications" db:"desktop_notifications"`
+	EmailNotifications   bool            `json:"email_notifications" db:"email_notifications"`
+	MobileNotifications  bool            `json:"mobile_notifications" db:"mobile_notifications"`
+	MentionNotifications bool            `json:"mention_notifications" db:"mention_notifications"`
+	ThreadNotifications  bool            `json:"thread_notifications" db:"thread_notifications"`
+	SoundEnabled         bool            `json:"sound_enabled" db:"sound_enabled"`
+	DoNotDisturb         bool            `json:"do_not_disturb" db:"do_not_disturb"`
+	DoNotDisturbStart    *time.Time      `json:"do_not_disturb_start,omitempty" db:"do_not_disturb_start"`
+	DoNotDisturbEnd      *time.Time      `json:"do_not_disturb_end,omitempty" db:"do_not_disturb_end"`
+	EmailDigest          DigestFrequency `json:"email_digest,omitempty" db:"email_digest"`
+}
+
+// DigestFrequency is how often a user is emailed a digest of their unread
+// messages and mentions
+type DigestFrequency string
+
+const (
+	// DigestOff sends no digests
+	DigestOff DigestFrequency = ""
+
+	// DigestHourly sends a digest at most once an hour
+	DigestHourly DigestFrequency = "hourly"
+
+	// DigestDaily sends a digest at most once a day
+	DigestDaily DigestFrequency = "daily"
+)
+
+// Interval returns the time between two digests, or zero if digests are off
+func (f DigestFrequency) Interval() time.Duration {
+	switch f {
+	case DigestHourly:
+		return time.Hour
+	case DigestDaily:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
 }
 
 // PrivacySettings represents user privacy preferences
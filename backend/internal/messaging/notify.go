@@ -0,0 +1,131 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/entity"
+)
+
+// Notifier delivers notifications outside the app, such as Web Push
+type Notifier interface {
+	Notify(ctx context.Context, notification *domain.Notification) error
+}
+
+// mentionPattern matches @username mentions, but not the domain of an
+// email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([A-Za-z0-9_]+(?:[.-][A-Za-z0-9_]+)*)`)
+
+// SetNotifications sets the repository notifications of new messages are
+// stored in. When nil, sending a message notifies nobody.
+func (s *Service) SetNotifications(notifications domain.NotificationRepository) {
+	s.notifications = notifications
+}
+
+// SetNotifier sets where stored notifications are delivered to
+func (s *Service) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// notifyMessage notifies the members of a channel mentioned in a new
+// message and, in direct channels, the other members. Failures are
+// recorded on the service rather than failing the message.
+func (s *Service) notifyMessage(ctx context.Context, message *entity.Message) {
+	if s.notifications == nil {
+		return
+	}
+
+	notifications, err := s.messageNotifications(ctx, message)
+	if err != nil {
+		s.AddError(fmt.Errorf("failed to find users to notify of message %s: %w", message.ID, err))
+		return
+	}
+
+	for _, notification := range notifications {
+		if err := s.notifications.Create(ctx, notification); err != nil {
+			s.AddError(err)
+			continue
+		}
+		if s.notifier != nil {
+			if err := s.notifier.Notify(ctx, notification); err != nil {
+				s.AddError(err)
+			}
+		}
+	}
+}
+
+func (s *Service) messageNotifications(ctx context.Context, message *entity.Message) ([]*domain.Notification, error) {
+	mentioned, err := s.mentionedMembers(ctx, message.ChannelID, mentionedUsernames(message.Content))
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []*domain.Notification
+	notified := map[uuid.UUID]bool{message.UserID: true}
+	for _, userID := range mentioned {
+		if notified[userID] {
+			continue
+		}
+		notified[userID] = true
+		notifications = append(notifications, domain.NewMentionNotification(
+			userID, message.ChannelID, message.ID, message.UserID, message.Content))
+	}
+
+	var channel entity.Channel
+	if err := s.db.WithContext(ctx).Select("type").Where("id = ?", message.ChannelID).First(&channel).Error; err != nil {
+		return nil, err
+	}
+	if channel.Type != "direct" {
+		return notifications, nil
+	}
+
+	var members []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&entity.ChannelMember{}).
+		Where("channel_id = ?", message.ChannelID).
+		Pluck("user_id", &members).Error; err != nil {
+		return nil, err
+	}
+	for _, userID := range members {
+		if notified[userID] {
+			continue
+		}
+		notified[userID] = true
+		notifications = append(notifications, domain.NewMessageNotification(
+			userID, message.ChannelID, message.ID, message.UserID, message.Content))
+	}
+	return notifications, nil
+}
+
+// mentionedMembers returns the members of a channel with the given
+// usernames, which are matched case insensitively
+func (s *Service) mentionedMembers(ctx context.Context, channelID uuid.UUID, usernames []string) ([]uuid.UUID, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	var userIDs []uuid.UUID
+	err := s.db.WithContext(ctx).Model(&entity.ChannelMember{}).
+		Joins("JOIN users u ON u.id = channel_members.user_id").
+		Where("channel_members.channel_id = ? AND LOWER(u.username) IN ?", channelID, usernames).
+		Pluck("channel_members.user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// mentionedUsernames returns the lowercased usernames mentioned in a
+// message, without duplicates
+func mentionedUsernames(content string) []string {
+	var usernames []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := strings.ToLower(match[1])
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
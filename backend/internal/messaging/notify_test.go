@@ -0,0 +1,120 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/core"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/entity"
+)
+
+type fakeNotifications struct {
+	domain.NotificationRepository
+	created []*domain.Notification
+}
+
+func (f *fakeNotifications) Create(ctx context.Context, notification *domain.Notification) error {
+	f.created = append(f.created, notification)
+	return nil
+}
+
+type fakeNotifier struct {
+	notified []*domain.Notification
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, notification *domain.Notification) error {
+	f.notified = append(f.notified, notification)
+	return nil
+}
+
+func TestMentionedUsernames(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"hello", nil},
+		{"@alice hi", []string{"alice"}},
+		{"hi @Alice and @bob.smith.", []string{"alice", "bob.smith"}},
+		{"@alice @ALICE", []string{"alice"}},
+		{"(@carol)", []string{"carol"}},
+		{"mail alice@example.com", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, mentionedUsernames(tt.content), tt.content)
+	}
+}
+
+func TestNotifyMessage(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	for _, statement := range []string{
+		`CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT)`,
+		`CREATE TABLE channels (id TEXT PRIMARY KEY, name TEXT, type TEXT, deleted_at DATETIME)`,
+		`CREATE TABLE channel_members (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT)`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	for id, username := range map[uuid.UUID]string{alice: "alice", bob: "bob", carol: "carol"} {
+		require.NoError(t, db.Exec("INSERT INTO users (id, username) VALUES (?, ?)", id, username).Error)
+	}
+	addChannel := func(channelType string, members ...uuid.UUID) uuid.UUID {
+		channelID := uuid.New()
+		require.NoError(t, db.Exec("INSERT INTO channels (id, name, type) VALUES (?, ?, ?)", channelID, channelType, channelType).Error)
+		for _, userID := range members {
+			require.NoError(t, db.Exec("INSERT INTO channel_members (id, channel_id, user_id) VALUES (?, ?, ?)",
+				uuid.New(), channelID, userID).Error)
+		}
+		return channelID
+	}
+	public := addChannel("public", alice, bob)
+	direct := addChannel("direct", alice, bob)
+
+	send := func(channelID uuid.UUID, content string) ([]*domain.Notification, []*domain.Notification) {
+		notifications := &fakeNotifications{}
+		notifier := &fakeNotifier{}
+		service := &Service{BaseService: core.NewBaseService("messaging"), db: db}
+		service.SetNotifications(notifications)
+		service.SetNotifier(notifier)
+		service.notifyMessage(context.Background(), &entity.Message{
+			ID: uuid.New(), ChannelID: channelID, UserID: alice, Content: content,
+		})
+		return notifications.created, notifier.notified
+	}
+
+	// Only mentioned members are notified, and never the sender
+	created, notified := send(public, "hi @Bob, @carol and @alice")
+	require.Len(t, created, 1)
+	assert.Equal(t, bob, created[0].UserID)
+	assert.Equal(t, domain.NotificationTypeMention, created[0].Type)
+	assert.Equal(t, alice, created[0].SenderID)
+	assert.Equal(t, created, notified)
+
+	created, _ = send(public, "hello")
+	assert.Empty(t, created)
+
+	// Members of direct channels are notified of every message, once
+	created, _ = send(direct, "hello")
+	require.Len(t, created, 1)
+	assert.Equal(t, bob, created[0].UserID)
+	assert.Equal(t, domain.NotificationTypeNewMessage, created[0].Type)
+
+	created, _ = send(direct, "hello @bob")
+	require.Len(t, created, 1)
+	assert.Equal(t, domain.NotificationTypeMention, created[0].Type)
+}
@@ -0,0 +1,123 @@
+package push
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// recordSize is the aes128gcm record size. Push services accept
+	// payloads of a single record of up to 4096 bytes.
+	recordSize = 4096
+
+	// authSecretLength and saltLength are fixed by RFC 8291
+	authSecretLength = 16
+	saltLength       = 16
+
+	// headerLength is the salt, record size, key length and the sender's
+	// uncompressed public key
+	headerLength = saltLength + 4 + 1 + 65
+
+	// MaxPayloadSize is the largest plaintext that fits into one record,
+	// after the header, the padding delimiter and the GCM tag
+	MaxPayloadSize = recordSize - headerLength - 1 - 16
+)
+
+// ErrPayloadTooLarge is returned for payloads over MaxPayloadSize
+var ErrPayloadTooLarge = errors.New("push payload too large")
+
+// encrypt encrypts a push message for a subscription with the aes128gcm
+// content coding of RFC 8188, keyed as RFC 8291 specifies from the
+// subscription's P-256 key and authentication secret
+func encrypt(plaintext []byte, userAgentKey []byte, authSecret []byte) ([]byte, error) {
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate push message key: %w", err)
+	}
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate push message salt: %w", err)
+	}
+	return encryptWith(plaintext, userAgentKey, authSecret, serverKey, salt)
+}
+
+// encryptWith encrypts with a given sender key and salt, which must be
+// fresh for every message
+func encryptWith(plaintext []byte, userAgentKey []byte, authSecret []byte, serverKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(plaintext) > MaxPayloadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, len(plaintext))
+	}
+	if len(authSecret) != authSecretLength {
+		return nil, fmt.Errorf("%w: auth secret must be %d bytes", ErrInvalidSubscription, authSecretLength)
+	}
+	userAgentPublic, err := ecdh.P256().NewPublicKey(userAgentKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+
+	sharedSecret, err := serverKey.ECDH(userAgentPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive push shared secret: %w", err)
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	// IKM = HKDF(auth_secret, ecdh_secret, "WebPush: info" || 0x00 || ua_public || as_public)
+	keyInfo := "WebPush: info\x00" + string(userAgentKey) + string(serverPublic)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	contentKey, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, headerLength+len(plaintext)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(serverPublic)))
+	body = append(body, serverPublic...)
+
+	// The single, and so last, record ends with the 0x02 delimiter
+	record := append(append(make([]byte, 0, len(plaintext)+1), plaintext...), 0x02)
+	return gcm.Seal(body, nonce, record, nil), nil
+}
+
+// decodeKey decodes a subscription key. Browsers send them base64url
+// encoded without padding, but some clients pad them or use the standard
+// alphabet.
+func decodeKey(value string) ([]byte, error) {
+	value = strings.NewReplacer("+", "-", "/", "_").Replace(trimPadding(value))
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+func trimPadding(value string) string {
+	return strings.TrimRight(strings.TrimSpace(value), "=")
+}
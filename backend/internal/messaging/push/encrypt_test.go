@@ -0,0 +1,136 @@
+package push
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(t *testing.T, value string) []byte {
+	t.Helper()
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	require.NoError(t, err)
+	return data
+}
+
+// TestEncryptRFC8291Example checks the example of RFC 8291, Appendix A
+func TestEncryptRFC8291Example(t *testing.T) {
+	serverKey, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	require.NoError(t, err)
+
+	body, err := encryptWith(
+		[]byte("When I grow up, I want to be a watermelon"),
+		b64(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		b64(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		serverKey,
+		b64(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		"DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN",
+		base64.RawURLEncoding.EncodeToString(body))
+}
+
+// browser stands in for a subscribed user agent
+type browser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newBrowser(t *testing.T) *browser {
+	t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	auth := make([]byte, authSecretLength)
+	_, err = rand.Read(auth)
+	require.NoError(t, err)
+	return &browser{key: key, auth: auth}
+}
+
+func (b *browser) input(endpoint string) SubscriptionInput {
+	return SubscriptionInput{
+		Endpoint: endpoint,
+		Keys: SubscriptionKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(b.auth),
+		},
+	}
+}
+
+// decrypt decrypts a push message the way the browser does
+func (b *browser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+
+	require.Greater(t, len(body), headerLength)
+	salt := body[:saltLength]
+	assert.Equal(t, uint32(recordSize), binary.BigEndian.Uint32(body[saltLength:]))
+	keyLength := int(body[saltLength+4])
+	serverPublic, err := ecdh.P256().NewPublicKey(body[saltLength+5 : saltLength+5+keyLength])
+	require.NoError(t, err)
+
+	sharedSecret, err := b.key.ECDH(serverPublic)
+	require.NoError(t, err)
+	keyInfo := "WebPush: info\x00" + string(b.key.PublicKey().Bytes()) + string(serverPublic.Bytes())
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, b.auth, keyInfo, 32)
+	require.NoError(t, err)
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	require.NoError(t, err)
+	contentKey, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	require.NoError(t, err)
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(contentKey)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	record, err := gcm.Open(nil, nonce, body[saltLength+5+keyLength:], nil)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, record)
+	assert.Equal(t, byte(0x02), record[len(record)-1], "single records end with the last record delimiter")
+	return record[:len(record)-1]
+}
+
+func TestEncryptUsesFreshKeys(t *testing.T) {
+	b := newBrowser(t)
+	plaintext := []byte(`{"title":"New message"}`)
+
+	first, err := encrypt(plaintext, b.key.PublicKey().Bytes(), b.auth)
+	require.NoError(t, err)
+	second, err := encrypt(plaintext, b.key.PublicKey().Bytes(), b.auth)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, plaintext, b.decrypt(t, first))
+	assert.Equal(t, plaintext, b.decrypt(t, second))
+}
+
+func TestEncryptRejectsInvalidInput(t *testing.T) {
+	b := newBrowser(t)
+
+	_, err := encrypt(make([]byte, MaxPayloadSize+1), b.key.PublicKey().Bytes(), b.auth)
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+
+	_, err = encrypt([]byte("hi"), b.key.PublicKey().Bytes(), b.auth[:8])
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	_, err = encrypt([]byte("hi"), []byte("not a key"), b.auth)
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	body, err := encrypt(make([]byte, MaxPayloadSize), b.key.PublicKey().Bytes(), b.auth)
+	require.NoError(t, err)
+	assert.Len(t, body, recordSize, "the largest payload fills exactly one record")
+}
@@ -0,0 +1,126 @@
+package push
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Handler lets users manage the push subscriptions of their browsers
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new push subscription handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers the push routes. The group must authenticate
+// the user and set "user_id".
+func (h *Handler) RegisterRoutes(router *gin.RouterGroup) {
+	push := router.Group("/push")
+	{
+		push.GET("/vapid-key", h.GetVAPIDKey)
+		push.GET("/subscriptions", h.ListSubscriptions)
+		push.POST("/subscriptions", h.Subscribe)
+		push.DELETE("/subscriptions", h.Unsubscribe)
+	}
+}
+
+// GetVAPIDKey returns the applicationServerKey to subscribe with
+func (h *Handler) GetVAPIDKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"publicKey": h.service.PublicKey()})
+}
+
+// ListSubscriptions lists the user's subscriptions
+func (h *Handler) ListSubscriptions(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := h.service.Subscriptions(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to list push subscriptions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve push subscriptions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+// Subscribe stores the PushSubscription the browser created
+func (h *Handler) Subscribe(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req SubscriptionInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription data", "details": err.Error()})
+		return
+	}
+
+	subscription, err := h.service.Subscribe(c.Request.Context(), userID, req, c.Request.UserAgent())
+	if err != nil {
+		if errors.Is(err, ErrInvalidSubscription) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to save push subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save push subscription"})
+		return
+	}
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// Unsubscribe removes the subscription of an endpoint
+func (h *Handler) Unsubscribe(c *gin.Context) {
+	userID, ok := requireUserID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "endpoint is required"})
+		return
+	}
+
+	err := h.service.Unsubscribe(c.Request.Context(), userID, req.Endpoint)
+	if err != nil {
+		if errors.Is(err, ErrSubscriptionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Push subscription not found"})
+			return
+		}
+		log.Printf("Failed to delete push subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete push subscription"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// requireUserID returns the authenticated user, responding with 401 if
+// there is none
+func requireUserID(c *gin.Context) (uuid.UUID, bool) {
+	value, exists := c.Get("user_id")
+	if exists {
+		switch id := value.(type) {
+		case uuid.UUID:
+			return id, true
+		case string:
+			if parsed, err := uuid.Parse(id); err == nil {
+				return parsed, true
+			}
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	return uuid.Nil, false
+}
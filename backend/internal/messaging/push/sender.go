@@ -0,0 +1,108 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSubscriptionGone is returned when the push service reports that
+	// a subscription expired or was revoked
+	ErrSubscriptionGone = errors.New("push subscription gone")
+	// ErrPushRejected is returned when the push service rejects a push
+	// for a reason a retry will not fix
+	ErrPushRejected = errors.New("push rejected")
+)
+
+// deliver sends a queued push. Subscriptions that are gone are deleted and
+// rejected pushes dropped; other failures are returned to be retried.
+func (s *Service) deliver(ctx context.Context, payload deliverPayload) error {
+	var subscription Subscription
+	err := s.db.WithContext(ctx).Where("id = ?", payload.SubscriptionID).First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Unsubscribed since the push was queued
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load push subscription: %w", err)
+	}
+
+	err = s.send(ctx, &subscription, payload.Message, payload.Urgency, payload.Topic)
+	switch {
+	case err == nil:
+		now := time.Now()
+		return s.db.WithContext(ctx).Model(&subscription).UpdateColumn("last_push_at", now).Error
+	case errors.Is(err, ErrSubscriptionGone):
+		log.Printf("Deleting expired push subscription %s", subscription.ID)
+		return s.db.WithContext(ctx).Delete(&subscription).Error
+	case errors.Is(err, ErrPushRejected), errors.Is(err, ErrPayloadTooLarge), errors.Is(err, ErrInvalidSubscription):
+		log.Printf("Dropping push to subscription %s: %v", subscription.ID, err)
+		return nil
+	default:
+		return err
+	}
+}
+
+// send encrypts a message for a subscription and posts it to the
+// subscription's push service (RFC 8030)
+func (s *Service) send(ctx context.Context, subscription *Subscription, message []byte, urgency string, topic string) error {
+	userAgentKey, err := decodeKey(subscription.P256dh)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	authSecret, err := decodeKey(subscription.Auth)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+
+	body, err := encrypt(message, userAgentKey, authSecret)
+	if err != nil {
+		return err
+	}
+	authorization, err := s.keys.authorization(subscription.Endpoint, s.options.Subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSubscription, err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(s.options.TTL/time.Second)))
+	if urgency != "" {
+		req.Header.Set("Urgency", urgency)
+	}
+	if topic != "" {
+		req.Header.Set("Topic", topic)
+	}
+
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach push service: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("push service responded %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	default:
+		return fmt.Errorf("%w: push service responded %d: %s", ErrPushRejected, resp.StatusCode, bytes.TrimSpace(detail))
+	}
+}
@@ -0,0 +1,349 @@
+// Package push delivers messaging notifications to browsers with Web Push.
+// Users subscribe their browsers; notifications for them are queued,
+// checked against their notification settings and channel mutes, and sent
+// to each subscription signed with the server's VAPID keys and encrypted
+// for the browser. Users connected over WebSocket already receive their
+// notifications there and are not pushed to.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
+)
+
+const (
+	// NotifyJobType is the queue job type that decides whether and where a
+	// notification is pushed
+	NotifyJobType = "messaging.push.notify"
+	// DeliverJobType is the queue job type that sends a push message to a
+	// single subscription, so a failing push service only retries its own
+	// subscriptions
+	DeliverJobType = "messaging.push.deliver"
+
+	// DefaultTTL is how long push services keep messages for browsers that
+	// are offline
+	DefaultTTL = 24 * time.Hour
+
+	// maxBodyLength caps the message preview sent in a push, in runes
+	maxBodyLength = 200
+)
+
+// Sessions reports whether a user has a WebSocket session open on any API
+// instance
+type Sessions interface {
+	HasActiveSession(ctx context.Context, userID uuid.UUID) bool
+}
+
+// Options configures a Service
+type Options struct {
+	// Subject is a mailto: or https: URL push services can contact the
+	// operator at
+	Subject string
+	// TTL is how long push services keep undelivered messages, defaults to
+	// DefaultTTL
+	TTL time.Duration
+	// Client sends the pushes, defaults to a client with a 30 second timeout
+	Client *http.Client
+}
+
+// Message is the JSON a service worker receives in its push event
+type Message struct {
+	ID        uuid.UUID               `json:"id"`
+	Type      domain.NotificationType `json:"type"`
+	Title     string                  `json:"title"`
+	Body      string                  `json:"body"`
+	ChannelID *uuid.UUID              `json:"channel_id,omitempty"`
+	MessageID *uuid.UUID              `json:"message_id,omitempty"`
+	SenderID  uuid.UUID               `json:"sender_id"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+// deliverPayload is the payload of DeliverJobType jobs
+type deliverPayload struct {
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	Message        json.RawMessage `json:"message"`
+	Urgency        string          `json:"urgency"`
+	Topic          string          `json:"topic,omitempty"`
+}
+
+// Service manages push subscriptions and delivers notifications to them
+type Service struct {
+	db       *gorm.DB
+	keys     *VAPIDKeys
+	options  Options
+	jobs     queue.Enqueuer
+	settings domain.UserSettingsRepository
+	mutes    domain.UserMuteRepository
+	sessions Sessions
+}
+
+// NewService creates a new push service
+func NewService(db *gorm.DB, keys *VAPIDKeys, options Options) *Service {
+	if options.TTL <= 0 {
+		options.TTL = DefaultTTL
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Service{db: db, keys: keys, options: options}
+}
+
+// PublicKey returns the VAPID public key clients subscribe with
+func (s *Service) PublicKey() string {
+	return s.keys.PublicKey()
+}
+
+// SetJobQueue sets the queue notifications are delivered through. The
+// queue's runner needs the processors returned by NotifyProcessor and
+// DeliverProcessor. Without a queue, notifications are pushed in the
+// background of the request that created them.
+func (s *Service) SetJobQueue(jobs queue.Enqueuer) {
+	s.jobs = jobs
+}
+
+// SetUserSettings sets where users' notification settings are read from.
+// Without it, every notification is pushed.
+func (s *Service) SetUserSettings(settings domain.UserSettingsRepository) {
+	s.settings = settings
+}
+
+// SetMutes sets where users' channel mutes are read from. Without it, no
+// channel is muted.
+func (s *Service) SetMutes(mutes domain.UserMuteRepository) {
+	s.mutes = mutes
+}
+
+// SetSessions sets how WebSocket sessions are looked up. Without it,
+// users are pushed to even while connected.
+func (s *Service) SetSessions(sessions Sessions) {
+	s.sessions = sessions
+}
+
+// Notify queues a notification for push delivery. Notifications users
+// caused themselves, and those for users connected over WebSocket, are
+// dropped.
+func (s *Service) Notify(ctx context.Context, notification *domain.Notification) error {
+	if notification.UserID == notification.SenderID || s.connected(ctx, notification.UserID) {
+		return nil
+	}
+
+	if s.jobs == nil {
+		go func() {
+			if err := s.dispatch(context.Background(), notification); err != nil {
+				log.Printf("Failed to push notification %s: %v", notification.ID, err)
+			}
+		}()
+		return nil
+	}
+
+	if _, err := s.jobs.Enqueue(ctx, NotifyJobType, notification); err != nil {
+		return fmt.Errorf("failed to queue push notification: %w", err)
+	}
+	return nil
+}
+
+// NotifyProcessor returns the queue processor for NotifyJobType jobs
+func (s *Service) NotifyProcessor() queue.Processor {
+	return queue.ProcessorFunc(func(ctx context.Context, job *queue.Job) error {
+		var notification domain.Notification
+		if err := job.Decode(&notification); err != nil {
+			return err
+		}
+		return s.dispatch(ctx, &notification)
+	})
+}
+
+// DeliverProcessor returns the queue processor for DeliverJobType jobs.
+// Pushes the push service could not take are retried; subscriptions it
+// reports as expired are deleted.
+func (s *Service) DeliverProcessor() queue.Processor {
+	return queue.ProcessorFunc(func(ctx context.Context, job *queue.Job) error {
+		var payload deliverPayload
+		if err := job.Decode(&payload); err != nil {
+			return err
+		}
+		return s.deliver(ctx, payload)
+	})
+}
+
+// dispatch checks a notification against the user's settings and mutes
+// and queues a push to each of their subscriptions. The user may have
+// connected since the notification was queued, so sessions are checked
+// again.
+func (s *Service) dispatch(ctx context.Context, notification *domain.Notification) error {
+	if s.connected(ctx, notification.UserID) {
+		return nil
+	}
+	allowed, err := s.allowed(ctx, notification, time.Now())
+	if err != nil || !allowed {
+		return err
+	}
+
+	subscriptions, err := s.Subscriptions(ctx, notification.UserID)
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+
+	message, err := json.Marshal(newMessage(notification))
+	if err != nil {
+		return fmt.Errorf("failed to encode push message: %w", err)
+	}
+
+	urgency, topic := urgencyOf(notification), topicOf(notification)
+	for _, subscription := range subscriptions {
+		payload := deliverPayload{
+			SubscriptionID: subscription.ID,
+			Message:        message,
+			Urgency:        urgency,
+			Topic:          topic,
+		}
+
+		if s.jobs == nil {
+			if err := s.deliver(ctx, payload); err != nil {
+				log.Printf("Failed to push to subscription %s: %v", subscription.ID, err)
+			}
+			continue
+		}
+		if _, err := s.jobs.Enqueue(ctx, DeliverJobType, payload); err != nil {
+			return fmt.Errorf("failed to queue push to subscription %s: %w", subscription.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) connected(ctx context.Context, userID uuid.UUID) bool {
+	return s.sessions != nil && s.sessions.HasActiveSession(ctx, userID)
+}
+
+// allowed reports whether the user wants the notification pushed. Users
+// without settings get every notification of channels they did not mute.
+func (s *Service) allowed(ctx context.Context, notification *domain.Notification, now time.Time) (bool, error) {
+	if s.settings != nil {
+		settings, err := s.settings.GetNotificationSettings(ctx, notification.UserID)
+		if err != nil && !domain.IsNotFoundError(err) {
+			return false, fmt.Errorf("failed to load notification settings: %w", err)
+		}
+		if settings != nil && !wantsPush(settings, notification.Type, now) {
+			return false, nil
+		}
+	}
+
+	if s.mutes != nil && notification.ChannelID != uuid.Nil {
+		muted, err := s.mutes.IsMuted(ctx, notification.UserID, notification.ChannelID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check channel mute: %w", err)
+		}
+		if muted {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// wantsPush applies notification settings. Pushes reach desktop and mobile
+// browsers alike, so either enables them. Do not disturb without a window
+// holds all pushes; with one, only those within it.
+func wantsPush(settings *domain.NotificationSettings, notificationType domain.NotificationType, now time.Time) bool {
+	if !settings.DesktopNotifications && !settings.MobileNotifications {
+		return false
+	}
+	if settings.DoNotDisturb && inDoNotDisturb(settings.DoNotDisturbStart, settings.DoNotDisturbEnd, now) {
+		return false
+	}
+	if notificationType == domain.NotificationTypeMention {
+		return settings.MentionNotifications
+	}
+	return true
+}
+
+// inDoNotDisturb reports whether now falls into the daily window from
+// start to end, which may span midnight. Only the times of day count, in
+// the zone they were set in.
+func inDoNotDisturb(start, end *time.Time, now time.Time) bool {
+	if start == nil || end == nil {
+		return true
+	}
+
+	minuteOfDay := func(t time.Time) int { return t.Hour()*60 + t.Minute() }
+	from, until := minuteOfDay(*start), minuteOfDay(*end)
+	current := minuteOfDay(now.In(start.Location()))
+
+	if from <= until {
+		return current >= from && current < until
+	}
+	return current >= from || current < until
+}
+
+func newMessage(notification *domain.Notification) *Message {
+	message := &Message{
+		ID:        notification.ID,
+		Type:      notification.Type,
+		Title:     titleOf(notification.Type),
+		Body:      truncate(notification.Content, maxBodyLength),
+		SenderID:  notification.SenderID,
+		CreatedAt: notification.CreatedAt,
+	}
+	if notification.ChannelID != uuid.Nil {
+		channelID := notification.ChannelID
+		message.ChannelID = &channelID
+	}
+	if notification.MessageID != uuid.Nil {
+		messageID := notification.MessageID
+		message.MessageID = &messageID
+	}
+	return message
+}
+
+func titleOf(notificationType domain.NotificationType) string {
+	switch notificationType {
+	case domain.NotificationTypeMention:
+		return "You were mentioned"
+	case domain.NotificationTypeReaction:
+		return "New reaction"
+	case domain.NotificationTypeChannelInvite:
+		return "Channel invitation"
+	default:
+		return "New message"
+	}
+}
+
+// urgencyOf tells push services how soon to wake the browser's device
+func urgencyOf(notification *domain.Notification) string {
+	switch notification.Type {
+	case domain.NotificationTypeMention, domain.NotificationTypeChannelInvite:
+		return "high"
+	case domain.NotificationTypeReaction:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// topicOf collapses new messages of a channel: push services replace an
+// undelivered message with a newer one of the same topic
+func topicOf(notification *domain.Notification) string {
+	if notification.Type != domain.NotificationTypeNewMessage || notification.ChannelID == uuid.Nil {
+		return ""
+	}
+	return strings.ReplaceAll(notification.ChannelID.String(), "-", "")
+}
+
+func truncate(text string, maxRunes int) string {
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:maxRunes-1])) + "…"
+}
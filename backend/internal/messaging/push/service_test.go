@@ -0,0 +1,480 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
+)
+
+// fakeQueue records enqueued jobs so tests can run them
+type fakeQueue struct {
+	jobs []*queue.Job
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, jobType string, payload interface{}) (*queue.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &queue.Job{ID: uuid.New(), Type: jobType, Payload: data, MaxAttempts: 5}
+	q.jobs = append(q.jobs, job)
+	return job, nil
+}
+
+// take removes and returns the queued jobs of a type
+func (q *fakeQueue) take(jobType string) []*queue.Job {
+	var taken, rest []*queue.Job
+	for _, job := range q.jobs {
+		if job.Type == jobType {
+			taken = append(taken, job)
+		} else {
+			rest = append(rest, job)
+		}
+	}
+	q.jobs = rest
+	return taken
+}
+
+type fakeSettings struct {
+	domain.UserSettingsRepository
+	settings map[uuid.UUID]*domain.NotificationSettings
+}
+
+func (s *fakeSettings) GetNotificationSettings(ctx context.Context, userID uuid.UUID) (*domain.NotificationSettings, error) {
+	settings, ok := s.settings[userID]
+	if !ok {
+		return nil, domain.NewNotFoundError("user settings")
+	}
+	return settings, nil
+}
+
+type fakeMutes struct {
+	domain.UserMuteRepository
+	muted map[uuid.UUID]bool
+}
+
+func (m *fakeMutes) IsMuted(ctx context.Context, userID, channelID uuid.UUID) (bool, error) {
+	return m.muted[channelID], nil
+}
+
+type fakeSessions map[uuid.UUID]bool
+
+func (s fakeSessions) HasActiveSession(ctx context.Context, userID uuid.UUID) bool {
+	return s[userID]
+}
+
+// pushRequest is a push received by the fake push service
+type pushRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// pushServer is a push service answering with status
+type pushServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []pushRequest
+}
+
+func newPushServer(t *testing.T) *pushServer {
+	t.Helper()
+
+	server := &pushServer{status: http.StatusCreated}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		server.requests = append(server.requests, pushRequest{header: r.Header.Clone(), body: body})
+		w.WriteHeader(server.status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *pushServer) received() []pushRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pushRequest(nil), s.requests...)
+}
+
+type testEnv struct {
+	db       *gorm.DB
+	service  *Service
+	queue    *fakeQueue
+	server   *pushServer
+	settings *fakeSettings
+	mutes    *fakeMutes
+	sessions fakeSessions
+	user     uuid.UUID
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Subscription{}))
+
+	keys, err := GenerateVAPIDKeys()
+	require.NoError(t, err)
+	server := newPushServer(t)
+
+	env := &testEnv{
+		db:       db,
+		queue:    &fakeQueue{},
+		server:   server,
+		settings: &fakeSettings{settings: make(map[uuid.UUID]*domain.NotificationSettings)},
+		mutes:    &fakeMutes{muted: make(map[uuid.UUID]bool)},
+		sessions: make(fakeSessions),
+		user:     uuid.New(),
+	}
+	env.service = NewService(db, keys, Options{Subject: "mailto:ops@example.com", Client: server.Client()})
+	env.service.SetJobQueue(env.queue)
+	env.service.SetUserSettings(env.settings)
+	env.service.SetMutes(env.mutes)
+	env.service.SetSessions(env.sessions)
+	return env
+}
+
+func (e *testEnv) subscribe(t *testing.T, path string) *browser {
+	t.Helper()
+
+	b := newBrowser(t)
+	_, err := e.service.Subscribe(context.Background(), e.user, b.input(e.server.URL+path), "test")
+	require.NoError(t, err)
+	return b
+}
+
+// run processes the queued notify jobs, then the deliver jobs they queued
+func (e *testEnv) run(t *testing.T) {
+	t.Helper()
+
+	ctx := context.Background()
+	for _, job := range e.queue.take(NotifyJobType) {
+		require.NoError(t, e.service.NotifyProcessor().Process(ctx, job))
+	}
+	for _, job := range e.queue.take(DeliverJobType) {
+		require.NoError(t, e.service.DeliverProcessor().Process(ctx, job))
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	b := newBrowser(t)
+
+	invalid := b.input("http://push.example.com/send/1")
+	_, err := env.service.Subscribe(ctx, env.user, invalid, "")
+	assert.ErrorIs(t, err, ErrInvalidSubscription, "endpoints must use https")
+
+	invalid = b.input("https://push.example.com/send/1")
+	invalid.Keys.Auth = "c2hvcnQ"
+	_, err = env.service.Subscribe(ctx, env.user, invalid, "")
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	invalid = b.input("https://push.example.com/send/1")
+	invalid.Keys.P256dh = invalid.Keys.Auth
+	_, err = env.service.Subscribe(ctx, env.user, invalid, "")
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+
+	first, err := env.service.Subscribe(ctx, env.user, b.input("https://push.example.com/send/1"), "Firefox")
+	require.NoError(t, err)
+
+	// The browser is shared with another user who subscribes it again
+	other := uuid.New()
+	renewed := newBrowser(t).input("https://push.example.com/send/1")
+	renewed.Keys.P256dh += "=="
+	second, err := env.service.Subscribe(ctx, other, renewed, "Firefox")
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, other, second.UserID)
+
+	subscriptions, err := env.service.Subscriptions(ctx, env.user)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+
+	assert.ErrorIs(t, env.service.Unsubscribe(ctx, env.user, "https://push.example.com/send/1"), ErrSubscriptionNotFound)
+	require.NoError(t, env.service.Unsubscribe(ctx, other, "https://push.example.com/send/1"))
+	subscriptions, err = env.service.Subscriptions(ctx, other)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+}
+
+func TestNotifyPushesThroughQueue(t *testing.T) {
+	env := newTestEnv(t)
+	laptop := env.subscribe(t, "/send/laptop")
+	phone := env.subscribe(t, "/send/phone")
+
+	channelID, messageID, sender := uuid.New(), uuid.New(), uuid.New()
+	notification := domain.NewMessageNotification(env.user, channelID, messageID, sender, strings.Repeat("a", 300))
+	require.NoError(t, env.service.Notify(context.Background(), notification))
+	require.Len(t, env.queue.jobs, 1)
+
+	env.run(t)
+
+	requests := env.server.received()
+	require.Len(t, requests, 2)
+	for i, b := range []*browser{laptop, phone} {
+		request := requests[i]
+		assert.Equal(t, "aes128gcm", request.header.Get("Content-Encoding"))
+		assert.Equal(t, "86400", request.header.Get("TTL"))
+		assert.Equal(t, "normal", request.header.Get("Urgency"))
+		assert.Equal(t, strings.ReplaceAll(channelID.String(), "-", ""), request.header.Get("Topic"))
+
+		var message Message
+		require.NoError(t, json.Unmarshal(b.decrypt(t, request.body), &message))
+		assert.Equal(t, notification.ID, message.ID)
+		assert.Equal(t, "New message", message.Title)
+		assert.Equal(t, 200, len([]rune(message.Body)))
+		assert.Equal(t, &channelID, message.ChannelID)
+		assert.Equal(t, &messageID, message.MessageID)
+	}
+
+	var pushed int64
+	require.NoError(t, env.db.Model(&Subscription{}).Where("last_push_at IS NOT NULL").Count(&pushed).Error)
+	assert.Equal(t, int64(2), pushed)
+}
+
+func TestVAPIDAuthorization(t *testing.T) {
+	env := newTestEnv(t)
+	env.subscribe(t, "/send/laptop")
+
+	notification := domain.NewMentionNotification(env.user, uuid.New(), uuid.New(), uuid.New(), "@you")
+	require.NoError(t, env.service.Notify(context.Background(), notification))
+	env.run(t)
+
+	requests := env.server.received()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "high", requests[0].header.Get("Urgency"))
+
+	token, key, ok := strings.Cut(strings.TrimPrefix(requests[0].header.Get("Authorization"), "vapid t="), ", k=")
+	require.True(t, ok)
+	assert.Equal(t, env.service.PublicKey(), key)
+
+	keys, err := ParseVAPIDKeys(env.service.keys.PrivateKey())
+	require.NoError(t, err)
+	assert.Equal(t, env.service.PublicKey(), keys.PublicKey(), "keys survive a round trip through their encoding")
+
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return &keys.private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}))
+	require.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, env.server.URL, claims["aud"])
+	assert.Equal(t, "mailto:ops@example.com", claims["sub"])
+
+	_, err = ParseVAPIDKeys("not a key")
+	assert.ErrorIs(t, err, ErrInvalidVAPIDKey)
+}
+
+func TestNotifySuppression(t *testing.T) {
+	channelID := uuid.New()
+	enabled := func() *domain.NotificationSettings {
+		return &domain.NotificationSettings{DesktopNotifications: true, MentionNotifications: true}
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(env *testEnv)
+		notify   func(env *testEnv) *domain.Notification
+		expected int
+	}{
+		{
+			name:     "without settings",
+			expected: 1,
+		},
+		{
+			name: "own actions",
+			notify: func(env *testEnv) *domain.Notification {
+				return domain.NewReactionNotification(env.user, channelID, uuid.New(), env.user, "👍")
+			},
+		},
+		{
+			name:  "active WebSocket session",
+			setup: func(env *testEnv) { env.sessions[env.user] = true },
+		},
+		{
+			name: "browser notifications disabled",
+			setup: func(env *testEnv) {
+				env.settings.settings[env.user] = &domain.NotificationSettings{EmailNotifications: true, MentionNotifications: true}
+			},
+		},
+		{
+			name: "mentions disabled",
+			setup: func(env *testEnv) {
+				settings := enabled()
+				settings.MentionNotifications = false
+				env.settings.settings[env.user] = settings
+			},
+			notify: func(env *testEnv) *domain.Notification {
+				return domain.NewMentionNotification(env.user, channelID, uuid.New(), uuid.New(), "@you")
+			},
+		},
+		{
+			name: "mentions enabled",
+			setup: func(env *testEnv) {
+				env.settings.settings[env.user] = enabled()
+			},
+			notify: func(env *testEnv) *domain.Notification {
+				return domain.NewMentionNotification(env.user, channelID, uuid.New(), uuid.New(), "@you")
+			},
+			expected: 1,
+		},
+		{
+			name: "do not disturb",
+			setup: func(env *testEnv) {
+				settings := enabled()
+				settings.DoNotDisturb = true
+				env.settings.settings[env.user] = settings
+			},
+		},
+		{
+			name:  "muted channel",
+			setup: func(env *testEnv) { env.mutes.muted[channelID] = true },
+		},
+		{
+			name: "other channel muted",
+			setup: func(env *testEnv) {
+				env.mutes.muted[uuid.New()] = true
+			},
+			notify: func(env *testEnv) *domain.Notification {
+				return domain.NewChannelInviteNotification(env.user, channelID, uuid.New(), "general")
+			},
+			expected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.subscribe(t, "/send/laptop")
+			if tt.setup != nil {
+				tt.setup(env)
+			}
+
+			notification := domain.NewMessageNotification(env.user, channelID, uuid.New(), uuid.New(), "hello")
+			if tt.notify != nil {
+				notification = tt.notify(env)
+			}
+			require.NoError(t, env.service.Notify(context.Background(), notification))
+			env.run(t)
+
+			assert.Len(t, env.server.received(), tt.expected)
+		})
+	}
+}
+
+func TestNotifySkipsUsersConnectedSinceQueued(t *testing.T) {
+	env := newTestEnv(t)
+	env.subscribe(t, "/send/laptop")
+
+	notification := domain.NewMessageNotification(env.user, uuid.New(), uuid.New(), uuid.New(), "hello")
+	require.NoError(t, env.service.Notify(context.Background(), notification))
+	env.sessions[env.user] = true
+	env.run(t)
+
+	assert.Empty(t, env.server.received())
+}
+
+func TestDeliverHandlesPushServiceResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		retried bool
+		removed bool
+	}{
+		{name: "expired subscription", status: http.StatusGone, removed: true},
+		{name: "unknown subscription", status: http.StatusNotFound, removed: true},
+		{name: "rejected push", status: http.StatusBadRequest},
+		{name: "rate limited", status: http.StatusTooManyRequests, retried: true},
+		{name: "push service down", status: http.StatusServiceUnavailable, retried: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.subscribe(t, "/send/laptop")
+			env.server.status = tt.status
+
+			notification := domain.NewMessageNotification(env.user, uuid.New(), uuid.New(), uuid.New(), "hello")
+			require.NoError(t, env.service.Notify(context.Background(), notification))
+			for _, job := range env.queue.take(NotifyJobType) {
+				require.NoError(t, env.service.NotifyProcessor().Process(context.Background(), job))
+			}
+			jobs := env.queue.take(DeliverJobType)
+			require.Len(t, jobs, 1)
+
+			err := env.service.DeliverProcessor().Process(context.Background(), jobs[0])
+			if tt.retried {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			subscriptions, err := env.service.Subscriptions(context.Background(), env.user)
+			require.NoError(t, err)
+			assert.Equal(t, tt.removed, len(subscriptions) == 0)
+		})
+	}
+}
+
+func TestDeliverSkipsRemovedSubscriptions(t *testing.T) {
+	env := newTestEnv(t)
+	env.subscribe(t, "/send/laptop")
+
+	notification := domain.NewMessageNotification(env.user, uuid.New(), uuid.New(), uuid.New(), "hello")
+	require.NoError(t, env.service.Notify(context.Background(), notification))
+	for _, job := range env.queue.take(NotifyJobType) {
+		require.NoError(t, env.service.NotifyProcessor().Process(context.Background(), job))
+	}
+	require.NoError(t, env.service.Unsubscribe(context.Background(), env.user, env.server.URL+"/send/laptop"))
+
+	for _, job := range env.queue.take(DeliverJobType) {
+		assert.NoError(t, env.service.DeliverProcessor().Process(context.Background(), job))
+	}
+	assert.Empty(t, env.server.received())
+}
+
+func TestInDoNotDisturb(t *testing.T) {
+	at := func(hour, minute int) *time.Time {
+		t := time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+		return &t
+	}
+	now := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 15, hour, minute, 0, 0, time.UTC)
+	}
+
+	assert.True(t, inDoNotDisturb(nil, nil, now(12, 0)), "without a window do not disturb holds all day")
+	assert.True(t, inDoNotDisturb(at(9, 0), at(17, 0), now(12, 0)))
+	assert.False(t, inDoNotDisturb(at(9, 0), at(17, 0), now(17, 0)))
+	assert.True(t, inDoNotDisturb(at(22, 0), at(7, 30), now(23, 15)), "windows may span midnight")
+	assert.True(t, inDoNotDisturb(at(22, 0), at(7, 30), now(6, 0)))
+	assert.False(t, inDoNotDisturb(at(22, 0), at(7, 30), now(12, 0)))
+
+	berlin := time.FixedZone("CET", 3600)
+	start, end := time.Date(2024, 1, 1, 22, 0, 0, 0, berlin), time.Date(2024, 1, 1, 23, 0, 0, 0, berlin)
+	assert.True(t, inDoNotDisturb(&start, &end, now(21, 30)), "windows apply in the zone they were set in")
+}
@@ -0,0 +1,131 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidSubscription  = errors.New("invalid push subscription")
+	ErrSubscriptionNotFound = errors.New("push subscription not found")
+)
+
+// Subscription is a browser's Web Push subscription. Every push to the
+// endpoint is encrypted for the browser with P256dh and Auth.
+type Subscription struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Endpoint   string     `gorm:"type:text;not null;uniqueIndex" json:"endpoint"`
+	P256dh     string     `gorm:"column:p256dh;not null" json:"-"`
+	Auth       string     `gorm:"not null" json:"-"`
+	UserAgent  string     `json:"userAgent,omitempty"`
+	LastPushAt *time.Time `json:"lastPushAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+func (Subscription) TableName() string {
+	return "messaging_push_subscriptions"
+}
+
+// SubscriptionKeys are the keys of a PushSubscription, base64url encoded
+type SubscriptionKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// SubscriptionInput is a subscription as serialized by the browser's
+// PushSubscription.toJSON
+type SubscriptionInput struct {
+	Endpoint string           `json:"endpoint"`
+	Keys     SubscriptionKeys `json:"keys"`
+}
+
+// validate checks that the endpoint can be pushed to and the keys can be
+// encrypted for
+func (in SubscriptionInput) validate() error {
+	endpoint, err := url.Parse(in.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return fmt.Errorf("%w: endpoint must be an https URL", ErrInvalidSubscription)
+	}
+
+	key, err := decodeKey(in.Keys.P256dh)
+	if err != nil {
+		return fmt.Errorf("%w: p256dh is not base64url", ErrInvalidSubscription)
+	}
+	if _, err := ecdh.P256().NewPublicKey(key); err != nil {
+		return fmt.Errorf("%w: p256dh is not a P-256 public key", ErrInvalidSubscription)
+	}
+
+	auth, err := decodeKey(in.Keys.Auth)
+	if err != nil || len(auth) != authSecretLength {
+		return fmt.Errorf("%w: auth must be %d base64url encoded bytes", ErrInvalidSubscription, authSecretLength)
+	}
+	return nil
+}
+
+// Subscribe stores a user's subscription. Subscribing an endpoint again
+// renews its keys; if another user subscribed it before, e.g. on a shared
+// browser, it moves to this user.
+func (s *Service) Subscribe(ctx context.Context, userID uuid.UUID, in SubscriptionInput, userAgent string) (*Subscription, error) {
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+
+	subscription := &Subscription{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Endpoint:  in.Endpoint,
+		P256dh:    in.Keys.P256dh,
+		Auth:      in.Keys.Auth,
+		UserAgent: userAgent,
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "p256dh", "auth", "user_agent", "updated_at"}),
+	}).Create(subscription).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save push subscription: %w", err)
+	}
+
+	// The upsert keeps the ID of an existing row
+	var saved Subscription
+	if err := s.db.WithContext(ctx).Where("endpoint = ?", in.Endpoint).First(&saved).Error; err != nil {
+		return nil, fmt.Errorf("failed to load push subscription: %w", err)
+	}
+	return &saved, nil
+}
+
+// Unsubscribe removes one of a user's subscriptions
+func (s *Service) Unsubscribe(ctx context.Context, userID uuid.UUID, endpoint string) error {
+	res := s.db.WithContext(ctx).
+		Where("user_id = ? AND endpoint = ?", userID, endpoint).
+		Delete(&Subscription{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// Subscriptions returns a user's subscriptions
+func (s *Service) Subscriptions(ctx context.Context, userID uuid.UUID) ([]Subscription, error) {
+	var subscriptions []Subscription
+	err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at").
+		Find(&subscriptions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load push subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
@@ -0,0 +1,97 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// vapidExpiry is how long a VAPID token is valid. Push services reject
+// tokens valid for more than 24 hours.
+const vapidExpiry = 12 * time.Hour
+
+// ErrInvalidVAPIDKey is returned for VAPID private keys that are not a
+// base64url encoded P-256 scalar
+var ErrInvalidVAPIDKey = errors.New("invalid VAPID private key")
+
+// VAPIDKeys identify this server to push services (RFC 8292). Browsers
+// only accept pushes to a subscription signed with the key it was created
+// with, so the keys must not change once clients have subscribed.
+type VAPIDKeys struct {
+	private *ecdsa.PrivateKey
+	public  []byte
+}
+
+// GenerateVAPIDKeys creates a new key pair
+func GenerateVAPIDKeys() (*VAPIDKeys, error) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate VAPID keys: %w", err)
+	}
+	return newVAPIDKeys(private)
+}
+
+// ParseVAPIDKeys loads a key pair from its base64url encoded private key,
+// as printed by PrivateKey
+func ParseVAPIDKeys(privateKey string) (*VAPIDKeys, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(trimPadding(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVAPIDKey, err)
+	}
+	private, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVAPIDKey, err)
+	}
+	return newVAPIDKeys(private)
+}
+
+func newVAPIDKeys(private *ecdsa.PrivateKey) (*VAPIDKeys, error) {
+	public, err := private.PublicKey.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode VAPID public key: %w", err)
+	}
+	return &VAPIDKeys{private: private, public: public}, nil
+}
+
+// PublicKey returns the base64url encoded public key, which clients pass
+// to PushManager.subscribe as applicationServerKey
+func (k *VAPIDKeys) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(k.public)
+}
+
+// PrivateKey returns the base64url encoded private key
+func (k *VAPIDKeys) PrivateKey() string {
+	raw, _ := k.private.Bytes()
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// authorization returns the Authorization header for a push to endpoint.
+// subject is a mailto: or https: URL push services can reach the operator
+// at.
+func (k *VAPIDKeys) authorization(endpoint string, subject string, now time.Time) (string, error) {
+	target, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	claims := jwt.MapClaims{
+		"aud": target.Scheme + "://" + target.Host,
+		"exp": now.Add(vapidExpiry).Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(k.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	return "vapid t=" + token + ", k=" + k.PublicKey(), nil
+}
@@ -0,0 +1,207 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	gorillaws "github.com/gorilla/websocket"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/store"
+)
+
+// channelMembersTable holds channel memberships. The entity models are
+// not part of the schema, so memberships are read from the table the
+// messaging store and the rest of the schema use.
+const channelMembersTable = "messaging_channel_members"
+
+// HubIDs maps messaging users and channels to the numeric IDs the
+// WebSocket hub routes events by. It is satisfied by
+// *store.HubIDRepository.
+type HubIDs interface {
+	ID(ctx context.Context, kind string, entityID uuid.UUID) (uint, error)
+	Lookup(ctx context.Context, kind string, entityID uuid.UUID) (uint, error)
+	Entity(ctx context.Context, kind string, id uint) (uuid.UUID, error)
+}
+
+// SetHubIDs sets how users and channels are mapped to hub IDs. Without
+// it, WebSocket connections are refused.
+func (s *Service) SetHubIDs(ids HubIDs) {
+	s.hubIDs = ids
+}
+
+// SetAllowedOrigins sets the origins WebSocket connections are accepted
+// from. Without them, only connections from the API's own origin are.
+func (s *Service) SetAllowedOrigins(origins []string) {
+	s.allowedOrigins = origins
+}
+
+// HandleWebSocket upgrades the request to a WebSocket connection of the
+// authenticated user, subscribed to the channels they are a member of
+func (s *Service) HandleWebSocket(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	id, _ := userID.(string)
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if s.hubIDs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Real-time messaging is not available"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	hubUserID, err := s.hubIDs.ID(ctx, store.HubKindUser, uid)
+	if err != nil {
+		s.AddError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open WebSocket connection"})
+		return
+	}
+	channels, err := s.hubChannels(ctx, uid)
+	if err != nil {
+		s.AddError(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open WebSocket connection"})
+		return
+	}
+
+	// The upgrader responds to failed upgrades itself
+	conn, err := s.upgrader().Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	client := websocket.NewClient(conn, hubUserID, s.hub)
+	client.Channels = channels
+	s.hub.Register(client)
+
+	go client.WritePump()
+	go client.ReadPump()
+}
+
+// hubChannels returns the hub IDs of the channels a user is a member of
+func (s *Service) hubChannels(ctx context.Context, userID uuid.UUID) ([]uint, error) {
+	var channelIDs []uuid.UUID
+	err := s.db.WithContext(ctx).Table(channelMembersTable).
+		Where("user_id = ?", userID).
+		Pluck("channel_id", &channelIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channels of user %s: %w", userID, err)
+	}
+
+	channels := make([]uint, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		id, err := s.hubIDs.ID(ctx, store.HubKindChannel, channelID)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, id)
+	}
+	return channels, nil
+}
+
+func (s *Service) upgrader() *gorillaws.Upgrader {
+	upgrader := &gorillaws.Upgrader{
+		ReadBufferSize:   1024,
+		WriteBufferSize:  1024,
+		HandshakeTimeout: 10 * time.Second,
+	}
+	if len(s.allowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			for _, allowed := range s.allowedOrigins {
+				if origin == allowed {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return upgrader
+}
+
+// CanAccessChannel checks whether the user with a hub ID is a member of the
+// channel with a hub ID. It lets the hub check channel subscriptions.
+func (s *Service) CanAccessChannel(ctx context.Context, userID, channelID uint) (bool, error) {
+	if s.hubIDs == nil {
+		return false, nil
+	}
+
+	user, err := s.hubIDs.Entity(ctx, store.HubKindUser, userID)
+	if err != nil || user == uuid.Nil {
+		return false, err
+	}
+	channel, err := s.hubIDs.Entity(ctx, store.HubKindChannel, channelID)
+	if err != nil || channel == uuid.Nil {
+		return false, err
+	}
+
+	var count int64
+	err = s.db.WithContext(ctx).Table(channelMembersTable).
+		Where("channel_id = ? AND user_id = ?", channel, user).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check membership of user %s in channel %s: %w", user, channel, err)
+	}
+	return count > 0, nil
+}
+
+// HasActiveSession reports whether a user is connected to the WebSocket hub
+// of any API instance, going by the presence the instances share. Users
+// who set their status to offline count as disconnected.
+func (s *Service) HasActiveSession(ctx context.Context, userID uuid.UUID) bool {
+	if s.hubIDs == nil {
+		return false
+	}
+
+	id, err := s.hubIDs.Lookup(ctx, store.HubKindUser, userID)
+	if err != nil {
+		s.AddError(err)
+		return false
+	}
+	if id == 0 {
+		return false
+	}
+
+	presence, ok := s.hub.GetPresence(id)
+	return ok && presence.Status != websocket.StatusOffline
+}
+
+// BroadcastToChannel sends an event to the members of a channel connected
+// to the WebSocket hub of any API instance
+func (s *Service) BroadcastToChannel(channelID uuid.UUID, msgType string, data interface{}) {
+	if id := s.hubID(store.HubKindChannel, channelID); id != 0 {
+		s.hub.BroadcastToChannel(id, msgType, data)
+	}
+}
+
+// BroadcastToUser sends an event to the connections of a user on the
+// WebSocket hub of any API instance
+func (s *Service) BroadcastToUser(userID uuid.UUID, msgType string, data interface{}) {
+	if id := s.hubID(store.HubKindUser, userID); id != 0 {
+		s.hub.BroadcastToUser(id, msgType, data)
+	}
+}
+
+// hubID returns the hub ID of a user or channel, or 0 if the hub has never
+// seen it, in which case nobody can be listening for its events
+func (s *Service) hubID(kind string, entityID uuid.UUID) uint {
+	if s.hubIDs == nil {
+		return 0
+	}
+	id, err := s.hubIDs.Lookup(context.Background(), kind, entityID)
+	if err != nil {
+		s.AddError(err)
+		return 0
+	}
+	return id
+}
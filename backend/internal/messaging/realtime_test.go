@@ -0,0 +1,111 @@
+package messaging
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	gorillaws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/store"
+)
+
+func TestWebSocketSessions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	for _, statement := range []string{
+		`CREATE TABLE messaging_channel_members (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT)`,
+		`CREATE TABLE messaging_hub_ids (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, entity_id TEXT NOT NULL,
+			UNIQUE (kind, entity_id))`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	alice, bob := uuid.New(), uuid.New()
+	member, other := uuid.New(), uuid.New()
+	require.NoError(t, db.Exec("INSERT INTO messaging_channel_members (id, channel_id, user_id) VALUES (?, ?, ?)",
+		uuid.New(), member, alice).Error)
+
+	service := NewService(db, Config{})
+	t.Cleanup(service.hub.Stop)
+	ids := store.NewHubIDRepository(db)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) {
+		c.Set("user_id", c.Query("user"))
+		service.HandleWebSocket(c)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?user="
+
+	// Without hub IDs no connection is accepted
+	_, resp, err := gorillaws.DefaultDialer.Dial(url+alice.String(), nil)
+	require.Error(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+
+	service.SetHubIDs(ids)
+	ctx := context.Background()
+	assert.False(t, service.HasActiveSession(ctx, alice))
+
+	conn, _, err := gorillaws.DefaultDialer.Dial(url+alice.String(), nil)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return service.HasActiveSession(ctx, alice) }, time.Second, 10*time.Millisecond)
+	assert.False(t, service.HasActiveSession(ctx, bob))
+
+	// Users may only follow the channels they are a member of
+	aliceID, err := ids.Lookup(ctx, store.HubKindUser, alice)
+	require.NoError(t, err)
+	memberID, err := ids.Lookup(ctx, store.HubKindChannel, member)
+	require.NoError(t, err)
+	require.NotZero(t, memberID)
+	otherID, err := ids.ID(ctx, store.HubKindChannel, other)
+	require.NoError(t, err)
+
+	allowed, err := service.CanAccessChannel(ctx, aliceID, memberID)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = service.CanAccessChannel(ctx, aliceID, otherID)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = service.CanAccessChannel(ctx, memberID, memberID)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// Events for channels and users are routed by their hub IDs
+	service.BroadcastToChannel(member, "channel_event", "to the channel")
+	service.BroadcastToChannel(other, "other_event", "to another channel")
+	service.BroadcastToUser(alice, "user_event", "to alice")
+	received := make(map[string]bool)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	for !received["channel_event"] || !received["user_event"] {
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		for _, eventType := range []string{"channel_event", "other_event", "user_event"} {
+			if strings.Contains(string(data), `"`+eventType+`"`) {
+				received[eventType] = true
+			}
+		}
+	}
+	assert.False(t, received["other_event"])
+
+	require.NoError(t, conn.Close())
+	assert.Eventually(t, func() bool { return !service.HasActiveSession(ctx, alice) }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,340 @@
+// Package retention enforces per-channel message retention. Messages older
+// than their channel's policy, or the server-wide default for channels
+// without one, are deleted or replaced by tombstones in batches, together
+// with their attachments, reactions, pins and embeds. Channels under legal
+// hold are skipped.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// ModeTombstone keeps expired messages as content-less tombstones, so
+	// threads and replies stay intact
+	ModeTombstone = "tombstone"
+	// ModeDelete removes expired messages. Messages with replies that have
+	// not expired yet are tombstoned instead, since deleting them would
+	// delete the replies too.
+	ModeDelete = "delete"
+
+	// TombstoneContent replaces the content of expired messages
+	TombstoneContent = "[message expired]"
+
+	// DefaultBatchSize is the number of messages removed per transaction
+	DefaultBatchSize = 500
+	// DefaultBatchPause is the pause between batches so other writers can
+	// acquire locks on the tables
+	DefaultBatchPause = 50 * time.Millisecond
+
+	// Sources of a channel's retention period
+	SourcePolicy  = "policy"
+	SourceDefault = "default"
+)
+
+var (
+	ErrRunInProgress = errors.New("message retention run already in progress")
+	ErrInvalidMode   = errors.New("invalid message retention mode")
+)
+
+// Options configures an Enforcer
+type Options struct {
+	// DefaultDays is the server-wide retention period for channels without
+	// a policy of their own. Zero or less keeps their messages forever.
+	DefaultDays int
+	// Mode is ModeTombstone or ModeDelete, defaults to ModeTombstone
+	Mode       string
+	BatchSize  int
+	BatchPause time.Duration
+}
+
+// ChannelResult records what a run did in a single channel
+type ChannelResult struct {
+	ChannelID     uuid.UUID  `json:"channelId"`
+	RetentionDays int        `json:"retentionDays"`
+	Source        string     `json:"source"`
+	LegalHold     bool       `json:"legalHold"`
+	Skipped       bool       `json:"skipped"`
+	Cutoff        *time.Time `json:"cutoff,omitempty"`
+	Messages      int64      `json:"messages"`
+	Deleted       int64      `json:"deleted"`
+	Tombstoned    int64      `json:"tombstoned"`
+	Attachments   int64      `json:"attachments"`
+	Reactions     int64      `json:"reactions"`
+	Pins          int64      `json:"pins"`
+	Embeds        int64      `json:"embeds"`
+	ReadReceipts  int64      `json:"readReceipts"`
+	Batches       int        `json:"batches"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// Report records what a run did. In dry-run mode only Messages is counted.
+type Report struct {
+	DryRun      bool            `json:"dryRun"`
+	Mode        string          `json:"mode"`
+	DefaultDays int             `json:"defaultDays"`
+	Messages    int64           `json:"messages"`
+	Channels    []ChannelResult `json:"channels"`
+	StartedAt   time.Time       `json:"startedAt"`
+	FinishedAt  time.Time       `json:"finishedAt"`
+}
+
+// Enforcer applies the retention policies of all channels
+type Enforcer struct {
+	db      *gorm.DB
+	options Options
+	running sync.Mutex
+}
+
+// NewEnforcer creates a new message retention enforcer
+func NewEnforcer(db *gorm.DB, options Options) (*Enforcer, error) {
+	switch options.Mode {
+	case "":
+		options.Mode = ModeTombstone
+	case ModeTombstone, ModeDelete:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMode, options.Mode)
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.BatchPause < 0 {
+		options.BatchPause = 0
+	} else if options.BatchPause == 0 {
+		options.BatchPause = DefaultBatchPause
+	}
+
+	return &Enforcer{db: db, options: options}, nil
+}
+
+// DefaultDays returns the server-wide retention period
+func (e *Enforcer) DefaultDays() int {
+	return e.options.DefaultDays
+}
+
+// Mode returns how expired messages are removed
+func (e *Enforcer) Mode() string {
+	return e.options.Mode
+}
+
+// channelPolicy is a channel joined with its policy, if it has one
+type channelPolicy struct {
+	ChannelID     uuid.UUID
+	RetentionDays *int
+	LegalHold     *bool
+}
+
+// Run enforces the retention period of every channel. In dry-run mode
+// expired messages are counted but not removed. A failing channel does not
+// stop the others; its error is recorded in the report.
+func (e *Enforcer) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	if !e.running.TryLock() {
+		return nil, ErrRunInProgress
+	}
+	defer e.running.Unlock()
+
+	report := &Report{
+		DryRun:      dryRun,
+		Mode:        e.options.Mode,
+		DefaultDays: e.options.DefaultDays,
+		StartedAt:   time.Now(),
+	}
+
+	var channels []channelPolicy
+	err := e.db.WithContext(ctx).
+		Table("messaging_channels AS c").
+		Select("c.id AS channel_id, p.retention_days, p.legal_hold").
+		Joins("LEFT JOIN messaging_retention_policies p ON p.channel_id = c.id").
+		Order("c.id").
+		Scan(&channels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load channel retention policies: %w", err)
+	}
+
+	for _, channel := range channels {
+		if err := ctx.Err(); err != nil {
+			report.FinishedAt = time.Now()
+			return report, err
+		}
+
+		result := e.enforce(ctx, channel, report.StartedAt, dryRun)
+		report.Messages += result.Messages
+		report.Channels = append(report.Channels, result)
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+func (e *Enforcer) enforce(ctx context.Context, channel channelPolicy, now time.Time, dryRun bool) ChannelResult {
+	result := ChannelResult{
+		ChannelID:     channel.ChannelID,
+		RetentionDays: e.options.DefaultDays,
+		Source:        SourceDefault,
+	}
+	if channel.RetentionDays != nil && *channel.RetentionDays != InheritDefault {
+		result.RetentionDays = *channel.RetentionDays
+		result.Source = SourcePolicy
+	}
+	if channel.LegalHold != nil && *channel.LegalHold {
+		result.LegalHold = true
+		result.Skipped = true
+		return result
+	}
+	if result.RetentionDays <= 0 {
+		result.Skipped = true
+		return result
+	}
+
+	cutoff := now.AddDate(0, 0, -result.RetentionDays)
+	result.Cutoff = &cutoff
+
+	if dryRun {
+		if err := e.expired(ctx, channel.ChannelID, cutoff).Count(&result.Messages).Error; err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		var ids []uuid.UUID
+		err := e.expired(ctx, channel.ChannelID, cutoff).
+			Order("m.created_at").
+			Limit(e.options.BatchSize).
+			Pluck("m.id", &ids).Error
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if len(ids) == 0 {
+			return result
+		}
+
+		if err := e.removeBatch(ctx, &result, ids, cutoff); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Messages += int64(len(ids))
+		result.Batches++
+
+		if len(ids) < e.options.BatchSize {
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			result.Error = ctx.Err().Error()
+			return result
+		case <-time.After(e.options.BatchPause):
+		}
+	}
+}
+
+// expired selects the messages of a channel that expired and were not
+// removed yet. Tombstones are removed again only in delete mode, once they
+// have no replies left that have not expired.
+func (e *Enforcer) expired(ctx context.Context, channelID uuid.UUID, cutoff time.Time) *gorm.DB {
+	query := e.db.WithContext(ctx).
+		Table("messaging_messages AS m").
+		Where("m.channel_id = ? AND m.created_at < ?", channelID, cutoff)
+
+	if e.options.Mode == ModeDelete {
+		return query.Where(`NOT (m.is_deleted = ? AND m.content = ? AND EXISTS (
+			SELECT 1 FROM messaging_messages r WHERE r.parent_id = m.id AND r.created_at >= ?))`,
+			true, TombstoneContent, cutoff)
+	}
+	return query.Where("NOT (m.is_deleted = ? AND m.content = ?)", true, TombstoneContent)
+}
+
+// removeBatch removes a batch of expired messages and everything attached
+// to them in one transaction
+func (e *Enforcer) removeBatch(ctx context.Context, result *ChannelResult, ids []uuid.UUID, cutoff time.Time) error {
+	return e.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		remove := ids
+		var keep []uuid.UUID
+		if e.options.Mode == ModeDelete {
+			var parents []uuid.UUID
+			err := tx.Table("messaging_messages").
+				Where("parent_id IN ? AND created_at >= ?", ids, cutoff).
+				Distinct().
+				Pluck("parent_id", &parents).Error
+			if err != nil {
+				return fmt.Errorf("failed to find replied messages: %w", err)
+			}
+			remove, keep = split(ids, parents)
+		} else {
+			keep, remove = ids, nil
+		}
+
+		cascades := []struct {
+			table string
+			count *int64
+		}{
+			{"messaging_attachments", &result.Attachments},
+			{"messaging_reactions", &result.Reactions},
+			{"messaging_pinned_messages", &result.Pins},
+			{"messaging_embeds", &result.Embeds},
+		}
+		for _, cascade := range cascades {
+			res := tx.Exec("DELETE FROM "+cascade.table+" WHERE message_id IN ?", ids)
+			if res.Error != nil {
+				return fmt.Errorf("failed to delete from %s: %w", cascade.table, res.Error)
+			}
+			*cascade.count += res.RowsAffected
+		}
+
+		if len(remove) > 0 {
+			res := tx.Exec("UPDATE messaging_read_receipts SET last_message_id = NULL WHERE last_message_id IN ?", remove)
+			if res.Error != nil {
+				return fmt.Errorf("failed to clear read receipts: %w", res.Error)
+			}
+			result.ReadReceipts += res.RowsAffected
+
+			res = tx.Exec("DELETE FROM messaging_messages WHERE id IN ?", remove)
+			if res.Error != nil {
+				return fmt.Errorf("failed to delete messages: %w", res.Error)
+			}
+			result.Deleted += res.RowsAffected
+		}
+
+		if len(keep) > 0 {
+			res := tx.Exec(`UPDATE messaging_messages
+				SET content = ?, is_deleted = ?, deleted_at = COALESCE(deleted_at, ?), is_edited = ?, edited_at = NULL
+				WHERE id IN ?`, TombstoneContent, true, time.Now(), false, keep)
+			if res.Error != nil {
+				return fmt.Errorf("failed to tombstone messages: %w", res.Error)
+			}
+			result.Tombstoned += res.RowsAffected
+		}
+
+		return nil
+	})
+}
+
+// split separates ids into those not in exclude and those in it
+func split(ids []uuid.UUID, exclude []uuid.UUID) (rest []uuid.UUID, excluded []uuid.UUID) {
+	set := make(map[uuid.UUID]struct{}, len(exclude))
+	for _, id := range exclude {
+		set[id] = struct{}{}
+	}
+	for _, id := range ids {
+		if _, ok := set[id]; ok {
+			excluded = append(excluded, id)
+		} else {
+			rest = append(rest, id)
+		}
+	}
+	return rest, excluded
+}
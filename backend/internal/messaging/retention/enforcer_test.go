@@ -0,0 +1,234 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// schema is the part of the messaging schema retention touches
+var schema = []string{
+	`CREATE TABLE messaging_channels (id TEXT PRIMARY KEY, name TEXT)`,
+	`CREATE TABLE messaging_messages (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, parent_id TEXT, content TEXT,
+		is_edited BOOLEAN DEFAULT false, edited_at DATETIME, is_deleted BOOLEAN DEFAULT false,
+		deleted_at DATETIME, created_at DATETIME)`,
+	`CREATE TABLE messaging_attachments (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_reactions (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_pinned_messages (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_embeds (id TEXT PRIMARY KEY, message_id TEXT)`,
+	`CREATE TABLE messaging_read_receipts (id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, last_message_id TEXT)`,
+}
+
+type testEnv struct {
+	db   *gorm.DB
+	user uuid.UUID
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, statement := range schema {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	require.NoError(t, db.AutoMigrate(&Policy{}))
+
+	return &testEnv{db: db, user: uuid.New()}
+}
+
+func (e *testEnv) channel(t *testing.T) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	require.NoError(t, e.db.Exec("INSERT INTO messaging_channels (id, name) VALUES (?, ?)", id, "general").Error)
+	return id
+}
+
+// message creates a message sent the given number of days ago, with an
+// attachment, a reaction, a pin and an embed
+func (e *testEnv) message(t *testing.T, channelID uuid.UUID, age int, parentID *uuid.UUID) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	createdAt := time.Now().AddDate(0, 0, -age)
+	require.NoError(t, e.db.Exec(
+		"INSERT INTO messaging_messages (id, channel_id, user_id, parent_id, content, is_edited, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		id, channelID, e.user, parentID, "hello", true, createdAt,
+	).Error)
+	for _, table := range []string{"messaging_attachments", "messaging_reactions", "messaging_pinned_messages", "messaging_embeds"} {
+		require.NoError(t, e.db.Exec("INSERT INTO "+table+" (id, message_id) VALUES (?, ?)", uuid.New(), id).Error)
+	}
+	return id
+}
+
+func (e *testEnv) count(t *testing.T, query string, args ...interface{}) int64 {
+	t.Helper()
+	var count int64
+	require.NoError(t, e.db.Raw(query, args...).Scan(&count).Error)
+	return count
+}
+
+func (e *testEnv) content(t *testing.T, id uuid.UUID) string {
+	t.Helper()
+	var content string
+	require.NoError(t, e.db.Raw("SELECT content FROM messaging_messages WHERE id = ?", id).Scan(&content).Error)
+	return content
+}
+
+func newEnforcer(t *testing.T, env *testEnv, options Options) *Enforcer {
+	t.Helper()
+	options.BatchSize = 2
+	options.BatchPause = -1
+	enforcer, err := NewEnforcer(env.db, options)
+	require.NoError(t, err)
+	return enforcer
+}
+
+func TestEnforcerTombstones(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	enforcer := newEnforcer(t, env, Options{DefaultDays: 30})
+
+	channel := env.channel(t)
+	expired := []uuid.UUID{env.message(t, channel, 40, nil), env.message(t, channel, 35, nil), env.message(t, channel, 31, nil)}
+	recent := env.message(t, channel, 5, nil)
+
+	report, err := enforcer.Run(ctx, true)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, report.Messages)
+	assert.Equal(t, "hello", env.content(t, expired[0]), "dry runs change nothing")
+
+	report, err = enforcer.Run(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, report.Channels, 1)
+	result := report.Channels[0]
+	assert.Equal(t, SourceDefault, result.Source)
+	assert.EqualValues(t, 3, result.Tombstoned)
+	assert.Zero(t, result.Deleted)
+	assert.EqualValues(t, 3, result.Attachments)
+	assert.EqualValues(t, 3, result.Reactions)
+	assert.EqualValues(t, 3, result.Pins)
+	assert.EqualValues(t, 3, result.Embeds)
+	assert.Equal(t, 2, result.Batches)
+
+	for _, id := range expired {
+		assert.Equal(t, TombstoneContent, env.content(t, id))
+	}
+	assert.Equal(t, "hello", env.content(t, recent))
+	assert.EqualValues(t, 4, env.count(t, "SELECT COUNT(*) FROM messaging_messages"))
+	assert.EqualValues(t, 1, env.count(t, "SELECT COUNT(*) FROM messaging_reactions"))
+	assert.EqualValues(t, 3, env.count(t, "SELECT COUNT(*) FROM messaging_messages WHERE is_deleted = true AND is_edited = false"))
+
+	report, err = enforcer.Run(ctx, false)
+	require.NoError(t, err)
+	assert.Zero(t, report.Messages, "tombstones are not processed again")
+}
+
+func TestEnforcerDeletes(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	enforcer := newEnforcer(t, env, Options{DefaultDays: 30, Mode: ModeDelete})
+
+	channel := env.channel(t)
+	lone := env.message(t, channel, 40, nil)
+	parent := env.message(t, channel, 40, nil)
+	reply := env.message(t, channel, 5, &parent)
+	require.NoError(t, env.db.Exec(
+		"INSERT INTO messaging_read_receipts (id, channel_id, user_id, last_message_id) VALUES (?, ?, ?, ?)",
+		uuid.New(), channel, env.user, lone,
+	).Error)
+
+	report, err := enforcer.Run(ctx, false)
+	require.NoError(t, err)
+	result := report.Channels[0]
+	assert.EqualValues(t, 1, result.Deleted)
+	assert.EqualValues(t, 1, result.Tombstoned, "messages with live replies are tombstoned")
+	assert.EqualValues(t, 1, result.ReadReceipts)
+
+	assert.Zero(t, env.count(t, "SELECT COUNT(*) FROM messaging_messages WHERE id = ?", lone))
+	assert.Equal(t, TombstoneContent, env.content(t, parent))
+	assert.Equal(t, "hello", env.content(t, reply))
+	assert.Zero(t, env.count(t, "SELECT COUNT(*) FROM messaging_read_receipts WHERE last_message_id IS NOT NULL"))
+
+	report, err = enforcer.Run(ctx, false)
+	require.NoError(t, err)
+	assert.Zero(t, report.Messages, "tombstones with live replies are kept")
+
+	require.NoError(t, env.db.Exec("UPDATE messaging_messages SET created_at = ? WHERE id = ?", time.Now().AddDate(0, 0, -31), reply).Error)
+	report, err = enforcer.Run(ctx, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, report.Channels[0].Deleted, "tombstones are deleted once their replies expire")
+	assert.Zero(t, env.count(t, "SELECT COUNT(*) FROM messaging_messages"))
+}
+
+func TestEnforcerPolicies(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	enforcer := newEnforcer(t, env, Options{DefaultDays: 30})
+
+	short, forever, held, inherited := env.channel(t), env.channel(t), env.channel(t), env.channel(t)
+	for _, channel := range []uuid.UUID{short, forever, held, inherited} {
+		env.message(t, channel, 40, nil)
+		env.message(t, channel, 10, nil)
+	}
+
+	_, err := enforcer.SetRetention(ctx, short, 7)
+	require.NoError(t, err)
+	_, err = enforcer.SetRetention(ctx, forever, KeepForever)
+	require.NoError(t, err)
+	_, err = enforcer.SetRetention(ctx, held, 7)
+	require.NoError(t, err)
+	policy, err := enforcer.SetLegalHold(ctx, held, true, "litigation")
+	require.NoError(t, err)
+	assert.True(t, policy.LegalHold)
+	assert.Equal(t, 7, policy.RetentionDays, "a legal hold keeps the retention period")
+	assert.NotNil(t, policy.LegalHoldSince)
+
+	report, err := enforcer.Run(ctx, false)
+	require.NoError(t, err)
+
+	results := make(map[uuid.UUID]ChannelResult)
+	for _, result := range report.Channels {
+		results[result.ChannelID] = result
+	}
+	assert.EqualValues(t, 2, results[short].Messages)
+	assert.Equal(t, SourcePolicy, results[short].Source)
+	assert.True(t, results[forever].Skipped)
+	assert.True(t, results[held].Skipped)
+	assert.True(t, results[held].LegalHold)
+	assert.EqualValues(t, 1, results[inherited].Messages)
+	assert.Equal(t, SourceDefault, results[inherited].Source)
+
+	policy, err = enforcer.SetLegalHold(ctx, held, false, "")
+	require.NoError(t, err)
+	assert.False(t, policy.LegalHold)
+	assert.Empty(t, policy.LegalHoldReason)
+
+	report, err = enforcer.Run(ctx, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, report.Messages, "released channels are enforced again")
+
+	_, err = enforcer.ChannelPolicy(ctx, inherited)
+	assert.ErrorIs(t, err, ErrPolicyNotFound)
+	policies, err := enforcer.Policies(ctx)
+	require.NoError(t, err)
+	assert.Len(t, policies, 3)
+}
+
+func TestNewEnforcerRejectsInvalidMode(t *testing.T) {
+	_, err := NewEnforcer(nil, Options{Mode: "shred"})
+	assert.ErrorIs(t, err, ErrInvalidMode)
+}
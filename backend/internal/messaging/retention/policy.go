@@ -0,0 +1,96 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// InheritDefault makes a channel use the server-wide retention period
+	InheritDefault = 0
+
+	// KeepForever makes a channel keep its messages regardless of the
+	// server-wide retention period
+	KeepForever = -1
+)
+
+var ErrPolicyNotFound = errors.New("retention policy not found")
+
+// Policy is the stored form of domain.MessageRetentionPolicy. RetentionDays
+// is positive for a channel specific period, InheritDefault or KeepForever.
+// A legal hold suspends deletion in the channel whatever its period.
+type Policy struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ChannelID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"channel_id"`
+	RetentionDays   int        `gorm:"not null;default:0" json:"retention_days"`
+	LegalHold       bool       `gorm:"not null;default:false" json:"legal_hold"`
+	LegalHoldReason string     `gorm:"type:text" json:"legal_hold_reason,omitempty"`
+	LegalHoldSince  *time.Time `json:"legal_hold_since,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+func (Policy) TableName() string { return "messaging_retention_policies" }
+
+// Policies returns every stored channel policy
+func (e *Enforcer) Policies(ctx context.Context) ([]Policy, error) {
+	var policies []Policy
+	if err := e.db.WithContext(ctx).Order("channel_id").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// ChannelPolicy returns the stored policy of a channel
+func (e *Enforcer) ChannelPolicy(ctx context.Context, channelID uuid.UUID) (*Policy, error) {
+	var policy Policy
+	err := e.db.WithContext(ctx).Where("channel_id = ?", channelID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPolicyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SetRetention sets how many days a channel keeps its messages
+func (e *Enforcer) SetRetention(ctx context.Context, channelID uuid.UUID, days int) (*Policy, error) {
+	if days < KeepForever {
+		days = KeepForever
+	}
+
+	policy := &Policy{ID: uuid.New(), ChannelID: channelID, RetentionDays: days}
+	return e.upsert(ctx, policy, "retention_days")
+}
+
+// SetLegalHold places a channel under legal hold or releases it. Nothing in
+// a channel under legal hold is deleted until it is released.
+func (e *Enforcer) SetLegalHold(ctx context.Context, channelID uuid.UUID, hold bool, reason string) (*Policy, error) {
+	policy := &Policy{ID: uuid.New(), ChannelID: channelID, LegalHold: hold}
+	if hold {
+		now := time.Now()
+		policy.LegalHoldReason = reason
+		policy.LegalHoldSince = &now
+	}
+	return e.upsert(ctx, policy, "legal_hold", "legal_hold_reason", "legal_hold_since")
+}
+
+// upsert creates the policy of a channel or updates the given columns of
+// the existing one
+func (e *Enforcer) upsert(ctx context.Context, policy *Policy, columns ...string) (*Policy, error) {
+	err := e.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel_id"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(policy).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return e.ChannelPolicy(ctx, policy.ChannelID)
+}
@@ -0,0 +1,186 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrInvalidQuery is returned for queries with malformed operators
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Term is a word or quoted phrase to search for
+type Term struct {
+	Text   string
+	Phrase bool
+}
+
+// Query is a parsed search query. Text holds the search terms in
+// disjunctive form: a message matches when it matches every term of any
+// clause. Operators narrow the results further.
+type Query struct {
+	Text [][]Term
+
+	// From holds usernames given with from:; a message matches any of them
+	From []string
+	// In holds channel names given with in:#; a message matches any of them
+	In []string
+	// HasAttachment is set by has:attachment
+	HasAttachment bool
+	// Before and After are set by before: and after:. Both are exclusive:
+	// before:2024-05-01 matches messages sent up to the end of April 30.
+	Before *time.Time
+	After  *time.Time
+}
+
+// HasText reports whether the query has search terms to rank by
+func (q *Query) HasText() bool {
+	return len(q.Text) > 0
+}
+
+// ParseQuery parses a search query. Words and "quoted phrases" must all
+// match unless separated by OR; AND may be written explicitly and binds
+// tighter than OR. The operators from:user, in:#channel, has:attachment,
+// before:date and after:date filter the results, with dates written as
+// 2006-01-02 or in RFC 3339. Words with any other prefix are searched for.
+func ParseQuery(input string) (*Query, error) {
+	query := &Query{}
+	var clause []Term
+	endClause := func() {
+		if len(clause) > 0 {
+			query.Text = append(query.Text, clause)
+			clause = nil
+		}
+	}
+
+	for _, tok := range tokenize(input) {
+		switch {
+		case tok.quoted:
+			if text := strings.TrimSpace(tok.value); text != "" {
+				clause = append(clause, Term{Text: text, Phrase: true})
+			}
+			continue
+		case tok.value == "OR":
+			endClause()
+			continue
+		case tok.value == "AND":
+			continue
+		}
+
+		handled, err := query.applyOperator(tok.value)
+		if err != nil {
+			return nil, err
+		}
+		if !handled {
+			clause = append(clause, Term{Text: tok.value})
+		}
+	}
+	endClause()
+
+	return query, nil
+}
+
+// applyOperator applies a key:value token, reporting whether it was an
+// operator
+func (q *Query) applyOperator(token string) (bool, error) {
+	key, value, ok := strings.Cut(token, ":")
+	if !ok {
+		return false, nil
+	}
+
+	switch strings.ToLower(key) {
+	case "from":
+		value = strings.TrimPrefix(value, "@")
+		if value == "" {
+			return true, fmt.Errorf("%w: from: needs a username", ErrInvalidQuery)
+		}
+		q.From = append(q.From, value)
+	case "in":
+		value = strings.TrimPrefix(value, "#")
+		if value == "" {
+			return true, fmt.Errorf("%w: in: needs a channel", ErrInvalidQuery)
+		}
+		q.In = append(q.In, value)
+	case "has":
+		if !strings.EqualFold(value, "attachment") {
+			return true, fmt.Errorf("%w: unsupported has:%s", ErrInvalidQuery, value)
+		}
+		q.HasAttachment = true
+	case "before":
+		date, err := parseDate(value)
+		if err != nil {
+			return true, err
+		}
+		q.Before = &date
+	case "after":
+		date, err := parseDate(value)
+		if err != nil {
+			return true, err
+		}
+		// Messages after a day are those sent from the next day on
+		if !strings.Contains(value, "T") {
+			date = date.AddDate(0, 0, 1)
+		}
+		q.After = &date
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is not a date", ErrInvalidQuery, value)
+}
+
+type token struct {
+	value  string
+	quoted bool
+}
+
+// tokenize splits a query on whitespace. Double quotes group a phrase, or
+// an operator value with spaces as in in:"general chat". An unterminated
+// quote runs to the end of the query.
+func tokenize(input string) []token {
+	var tokens []token
+	var current strings.Builder
+	inQuotes, quotedValue := false, false
+
+	flush := func(quoted bool) {
+		if current.Len() > 0 || quoted {
+			tokens = append(tokens, token{value: current.String(), quoted: quoted})
+		}
+		current.Reset()
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"' && inQuotes:
+			inQuotes = false
+			if !quotedValue {
+				flush(true)
+			}
+		case r == '"':
+			inQuotes = true
+			// A quote straight after key: quotes the operator's value
+			quotedValue = strings.HasSuffix(current.String(), ":") || strings.HasSuffix(current.String(), ":#")
+			if !quotedValue {
+				flush(false)
+			}
+		case unicode.IsSpace(r) && !inQuotes:
+			flush(false)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush(inQuotes && !quotedValue)
+
+	return tokens
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueryTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]Term
+	}{
+		{"empty", "   ", nil},
+		{"words are joined with AND", "deploy failed", [][]Term{{{Text: "deploy"}, {Text: "failed"}}}},
+		{"explicit AND", "deploy AND failed", [][]Term{{{Text: "deploy"}, {Text: "failed"}}}},
+		{"AND binds tighter than OR", "deploy failed OR rollback", [][]Term{{{Text: "deploy"}, {Text: "failed"}}, {{Text: "rollback"}}}},
+		{"phrases", `"build failed" OR crash`, [][]Term{{{Text: "build failed", Phrase: true}}, {{Text: "crash"}}}},
+		{"phrase next to a word", `error"stack trace"`, [][]Term{{{Text: "error"}, {Text: "stack trace", Phrase: true}}}},
+		{"unterminated phrase", `"out of memory`, [][]Term{{{Text: "out of memory", Phrase: true}}}},
+		{"stray operators", "OR deploy OR OR AND", [][]Term{{{Text: "deploy"}}}},
+		{"lowercase or is a word", "this or that", [][]Term{{{Text: "this"}, {Text: "or"}, {Text: "that"}}}},
+		{"unknown prefixes are searched for", "https://example.com", [][]Term{{{Text: "https://example.com"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseQuery(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, query.Text)
+			assert.Equal(t, len(tt.want) > 0, query.HasText())
+		})
+	}
+}
+
+func TestParseQueryOperators(t *testing.T) {
+	query, err := ParseQuery(`from:@alice from:bob in:#general in:"release train" has:attachment before:2024-05-01 after:2024-04-01 outage`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alice", "bob"}, query.From)
+	assert.Equal(t, []string{"general", "release train"}, query.In)
+	assert.True(t, query.HasAttachment)
+	require.NotNil(t, query.Before)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *query.Before)
+	require.NotNil(t, query.After)
+	assert.Equal(t, time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC), *query.After, "after: excludes the day itself")
+	assert.Equal(t, [][]Term{{{Text: "outage"}}}, query.Text)
+
+	query, err = ParseQuery(`in:#"release train" after:2024-04-01T12:00:00Z`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"release train"}, query.In)
+	assert.Equal(t, time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC), *query.After, "timestamps are used as given")
+	assert.False(t, query.HasText())
+}
+
+func TestParseQueryRejectsInvalidOperators(t *testing.T) {
+	for _, input := range []string{"from:", "in:#", "has:link", "before:yesterday", "after:2024-13-01"} {
+		_, err := ParseQuery(input)
+		assert.ErrorIs(t, err, ErrInvalidQuery, input)
+	}
+}
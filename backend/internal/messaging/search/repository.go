@@ -0,0 +1,491 @@
+// Package search implements message search on PostgreSQL full-text search.
+// Messages are indexed by the search_vector column of messaging_messages,
+// ranked with ts_rank_cd and highlighted with ts_headline. Results are
+// limited to the channels the searching user is a member of and paged with
+// opaque cursors.
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+const (
+	// textSearchConfig is the text search configuration messages are
+	// indexed with; queries must use the same one to match
+	textSearchConfig = "english"
+
+	// maxSuggestions caps the completions returned for a query
+	maxSuggestions = 10
+)
+
+// Markers ts_headline puts around matches and between fragments. Control
+// characters are left alone by HTML escaping, so highlights can be escaped
+// before the markers are turned into <mark> tags.
+const (
+	matchStart        = "\x02"
+	matchStop         = "\x03"
+	fragmentSeparator = "\x1e"
+	headlineOptions   = `StartSel="` + matchStart + `", StopSel="` + matchStop + `", FragmentDelimiter="` + fragmentSeparator + `", MaxFragments=3, MaxWords=20, MinWords=5`
+)
+
+// operators are suggested while the user types an operator
+var operators = []string{"from:", "in:#", "has:attachment", "before:", "after:"}
+
+var (
+	ErrViewerRequired = errors.New("search requires the searching user")
+	ErrInvalidCursor  = errors.New("invalid search cursor")
+)
+
+// Repository implements domain.SearchRepository
+type Repository struct {
+	db *gorm.DB
+}
+
+var _ domain.SearchRepository = (*Repository)(nil)
+
+// NewRepository creates a new search repository
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// cursor is the position of a result in the ranked order
+type cursor struct {
+	Score     float32   `json:"s"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// resultRow is a ranked message with its channel and author
+type resultRow struct {
+	ID        uuid.UUID
+	ChannelID uuid.UUID
+	UserID    uuid.UUID
+	Content   string
+	Type      string
+	ParentID  *uuid.UUID
+	EditedAt  *time.Time
+	CreatedAt time.Time
+	Score     float32
+	Headline  string
+
+	ChannelName        string
+	ChannelDescription *string
+	ChannelType        string
+	ChannelCreatedBy   *uuid.UUID
+	ChannelIsArchived  bool
+	ChannelCreatedAt   time.Time
+	ChannelUpdatedAt   time.Time
+
+	Username  *string
+	UserEmail *string
+}
+
+// SearchMessages finds the messages matching a filter, best matches first,
+// or newest first when the query has no search terms. It returns a page of
+// results and the total number of matches.
+func (r *Repository) SearchMessages(ctx context.Context, filter domain.SearchFilter, pagination domain.Pagination) ([]*domain.SearchResult, int, error) {
+	if filter.ViewerID == nil {
+		return nil, 0, ErrViewerRequired
+	}
+	query, err := ParseQuery(filter.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pagination.Adjust()
+	var after *cursor
+	if pagination.Cursor != "" {
+		if after, err = decodeCursor(pagination.Cursor); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ranked, args := rankedQuery(filter, query)
+
+	var total int64
+	if err := r.db.WithContext(ctx).Raw(ranked+" SELECT COUNT(*) FROM ranked", args...).Scan(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	page, pageArgs := pageQuery(query, after, pagination)
+	var rows []resultRow
+	if err := r.db.WithContext(ctx).Raw(ranked+" "+page, append(args, pageArgs...)...).Scan(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	results := make([]*domain.SearchResult, 0, len(rows))
+	for i := range rows {
+		results = append(results, rows[i].result())
+	}
+	return results, int(total), nil
+}
+
+// rankedQuery builds the CTEs selecting every match of the query in the
+// viewer's channels with its score
+func rankedQuery(filter domain.SearchFilter, query *Query) (string, []interface{}) {
+	var sql strings.Builder
+	var args []interface{}
+
+	score := "0::real"
+	if query.HasText() {
+		tsquery, tsArgs := tsQuery(query.Text)
+		sql.WriteString("WITH q AS (SELECT " + tsquery + " AS query), ranked AS (")
+		args = append(args, tsArgs...)
+		score = "ts_rank_cd(m.search_vector, q.query)::real"
+	} else {
+		sql.WriteString("WITH ranked AS (")
+	}
+
+	sql.WriteString(`SELECT m.id, m.channel_id, m.user_id, m.content, m.type, m.parent_id, m.edited_at, m.created_at, ` + score + ` AS score
+		FROM messaging_messages m
+		JOIN messaging_channel_members cm ON cm.channel_id = m.channel_id AND cm.user_id = ?
+		JOIN messaging_channels c ON c.id = m.channel_id`)
+	args = append(args, *filter.ViewerID)
+	if query.HasText() {
+		sql.WriteString(" CROSS JOIN q")
+	}
+
+	conditions := []string{"m.is_deleted = false"}
+	where := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+
+	if query.HasText() {
+		where("m.search_vector @@ q.query")
+	}
+	if len(query.From) > 0 {
+		where("m.user_id IN (SELECT id FROM users WHERE username IN ?)", query.From)
+	}
+	if len(query.In) > 0 {
+		names := make([]string, len(query.In))
+		for i, name := range query.In {
+			names[i] = strings.ToLower(name)
+		}
+		where("(lower(c.name) IN ? OR lower(c.slug) IN ?)", names, names)
+	}
+	if query.HasAttachment || (filter.HasAttachment != nil && *filter.HasAttachment) {
+		where("EXISTS (SELECT 1 FROM messaging_attachments a WHERE a.message_id = m.id)")
+	} else if filter.HasAttachment != nil {
+		where("NOT EXISTS (SELECT 1 FROM messaging_attachments a WHERE a.message_id = m.id)")
+	}
+	if query.Before != nil {
+		where("m.created_at < ?", *query.Before)
+	}
+	if query.After != nil {
+		where("m.created_at >= ?", *query.After)
+	}
+	if filter.UserID != nil {
+		where("m.user_id = ?", *filter.UserID)
+	}
+	if filter.ChannelID != nil {
+		where("m.channel_id = ?", *filter.ChannelID)
+	}
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		where("m.type IN ?", types)
+	}
+	if filter.FromDate != nil {
+		where("m.created_at >= ?", *filter.FromDate)
+	}
+	if filter.ToDate != nil {
+		where("m.created_at <= ?", *filter.ToDate)
+	}
+
+	sql.WriteString(" WHERE " + strings.Join(conditions, " AND ") + ")")
+	return sql.String(), args
+}
+
+// pageQuery builds the statement selecting a page of the ranked matches,
+// with their channel, author and highlights
+func pageQuery(query *Query, after *cursor, pagination domain.Pagination) (string, []interface{}) {
+	var args []interface{}
+
+	headline := "'' AS headline"
+	if query.HasText() {
+		headline = "ts_headline('" + textSearchConfig + "', p.content, q.query, ?) AS headline"
+		args = append(args, headlineOptions)
+	}
+
+	inner := "SELECT * FROM ranked"
+	var innerArgs []interface{}
+	if after != nil {
+		inner += " WHERE (score, created_at, id) < (?::real, ?, ?::uuid)"
+		innerArgs = append(innerArgs, after.Score, after.CreatedAt, after.ID)
+	}
+	inner += " ORDER BY score DESC, created_at DESC, id DESC LIMIT ?"
+	innerArgs = append(innerArgs, pagination.PageSize)
+	if after == nil && pagination.Page > 1 {
+		inner += " OFFSET ?"
+		innerArgs = append(innerArgs, (pagination.Page-1)*pagination.PageSize)
+	}
+
+	sql := `SELECT p.*, ` + headline + `,
+		c.name AS channel_name, c.description AS channel_description, c.type AS channel_type,
+		c.created_by AS channel_created_by, c.is_archived AS channel_is_archived,
+		c.created_at AS channel_created_at, c.updated_at AS channel_updated_at,
+		u.username, u.email AS user_email
+		FROM (` + inner + `) p
+		JOIN messaging_channels c ON c.id = p.channel_id
+		LEFT JOIN users u ON u.id = p.user_id`
+	if query.HasText() {
+		sql += " CROSS JOIN q"
+	}
+	sql += " ORDER BY p.score DESC, p.created_at DESC, p.id DESC"
+
+	return sql, append(args, innerArgs...)
+}
+
+// tsQuery builds a tsquery expression from the parsed search terms. Terms
+// are converted by plainto_tsquery and phrases by phraseto_tsquery, so user
+// input never reaches the tsquery syntax.
+func tsQuery(clauses [][]Term) (string, []interface{}) {
+	var args []interface{}
+	ors := make([]string, 0, len(clauses))
+	for _, clause := range clauses {
+		ands := make([]string, 0, len(clause))
+		for _, term := range clause {
+			function := "plainto_tsquery"
+			if term.Phrase {
+				function = "phraseto_tsquery"
+			}
+			ands = append(ands, function+"('"+textSearchConfig+"', ?)")
+			args = append(args, term.Text)
+		}
+		ors = append(ors, "("+strings.Join(ands, " && ")+")")
+	}
+	return strings.Join(ors, " || "), args
+}
+
+func (row *resultRow) result() *domain.SearchResult {
+	message := &domain.Message{
+		ID:        row.ID,
+		ChannelID: row.ChannelID,
+		UserID:    row.UserID,
+		Content:   row.Content,
+		Type:      domain.MessageType(row.Type),
+		ReplyToID: row.ParentID,
+		EditedAt:  row.EditedAt,
+		CreatedAt: row.CreatedAt,
+	}
+	channel := &domain.Channel{
+		ID:         row.ChannelID,
+		Name:       row.ChannelName,
+		Type:       domain.ChannelType(row.ChannelType),
+		IsArchived: row.ChannelIsArchived,
+		CreatedAt:  row.ChannelCreatedAt,
+		UpdatedAt:  row.ChannelUpdatedAt,
+	}
+	if row.ChannelDescription != nil {
+		channel.Description = *row.ChannelDescription
+	}
+	if row.ChannelCreatedBy != nil {
+		channel.CreatedBy = *row.ChannelCreatedBy
+	}
+
+	result := &domain.SearchResult{
+		Message:    message,
+		Channel:    channel,
+		Score:      float64(row.Score),
+		Highlights: highlights(row.Headline),
+		Cursor:     cursor{Score: row.Score, CreatedAt: row.CreatedAt, ID: row.ID}.encode(),
+	}
+	if row.Username != nil {
+		result.User = &domain.User{ID: row.UserID, Username: *row.Username}
+		if row.UserEmail != nil {
+			result.User.Email = *row.UserEmail
+		}
+	}
+	return result
+}
+
+// highlights turns a ts_headline result into HTML fragments with matches
+// wrapped in <mark> tags
+func highlights(headline string) []string {
+	if headline == "" {
+		return []string{}
+	}
+
+	fragments := strings.Split(headline, fragmentSeparator)
+	out := make([]string, 0, len(fragments))
+	for _, fragment := range fragments {
+		fragment = strings.TrimSpace(fragment)
+		if fragment == "" {
+			continue
+		}
+		fragment = html.EscapeString(fragment)
+		fragment = strings.ReplaceAll(fragment, matchStart, "<mark>")
+		fragment = strings.ReplaceAll(fragment, matchStop, "</mark>")
+		out = append(out, fragment)
+	}
+	return out
+}
+
+// SearchUsers finds users whose username starts with the query
+func (r *Repository) SearchUsers(ctx context.Context, query string, pagination domain.Pagination) ([]*domain.User, int, error) {
+	pagination.Adjust()
+	scope := r.db.WithContext(ctx).Table("users").
+		Where("is_active = ? AND username ILIKE ?", true, likePrefix(query))
+
+	var total int64
+	if err := scope.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	var users []*domain.User
+	err := scope.Select("id, username, email, created_at, updated_at").
+		Order("username").
+		Offset((pagination.Page - 1) * pagination.PageSize).
+		Limit(pagination.PageSize).
+		Scan(&users).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search users: %w", err)
+	}
+	return users, int(total), nil
+}
+
+// SearchChannels finds public channels whose name contains the query
+func (r *Repository) SearchChannels(ctx context.Context, query string, pagination domain.Pagination) ([]*domain.Channel, int, error) {
+	pagination.Adjust()
+	scope := r.db.WithContext(ctx).Table("messaging_channels").
+		Where("type = ? AND is_archived = ? AND name ILIKE ?", domain.ChannelTypePublic, false, "%"+escapeLike(query)+"%")
+
+	var total int64
+	if err := scope.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count channels: %w", err)
+	}
+
+	var rows []struct {
+		ID          uuid.UUID
+		Name        string
+		Description *string
+		Type        string
+		CreatedBy   *uuid.UUID
+		IsArchived  bool
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+	err := scope.Select("id, name, description, type, created_by, is_archived, created_at, updated_at").
+		Order("name").
+		Offset((pagination.Page - 1) * pagination.PageSize).
+		Limit(pagination.PageSize).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search channels: %w", err)
+	}
+
+	channels := make([]*domain.Channel, 0, len(rows))
+	for _, row := range rows {
+		channel := &domain.Channel{
+			ID:         row.ID,
+			Name:       row.Name,
+			Type:       domain.ChannelType(row.Type),
+			IsArchived: row.IsArchived,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+		}
+		if row.Description != nil {
+			channel.Description = *row.Description
+		}
+		if row.CreatedBy != nil {
+			channel.CreatedBy = *row.CreatedBy
+		}
+		channels = append(channels, channel)
+	}
+	return channels, int(total), nil
+}
+
+// GetSearchSuggestions completes the last word of a query: usernames after
+// from:, public channels after in:# and operators otherwise
+func (r *Repository) GetSearchSuggestions(ctx context.Context, query string) ([]string, error) {
+	fields := strings.Fields(query)
+	if len(fields) == 0 || strings.HasSuffix(query, " ") {
+		return operators, nil
+	}
+	prefix := strings.Join(fields[:len(fields)-1], " ")
+	if prefix != "" {
+		prefix += " "
+	}
+	last := fields[len(fields)-1]
+
+	var (
+		values []string
+		err    error
+		format string
+	)
+	switch lower := strings.ToLower(last); {
+	case strings.HasPrefix(lower, "from:"):
+		format = "from:%s"
+		err = r.db.WithContext(ctx).Table("users").
+			Where("is_active = ? AND username ILIKE ?", true, likePrefix(strings.TrimPrefix(last[len("from:"):], "@"))).
+			Order("username").Limit(maxSuggestions).
+			Pluck("username", &values).Error
+	case strings.HasPrefix(lower, "in:"):
+		format = "in:#%s"
+		err = r.db.WithContext(ctx).Table("messaging_channels").
+			Where("type = ? AND is_archived = ? AND name ILIKE ?", domain.ChannelTypePublic, false, likePrefix(strings.TrimPrefix(last[len("in:"):], "#"))).
+			Order("name").Limit(maxSuggestions).
+			Pluck("name", &values).Error
+	default:
+		format = "%s"
+		for _, operator := range operators {
+			if strings.HasPrefix(operator, lower) {
+				values = append(values, operator)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get search suggestions: %w", err)
+	}
+
+	suggestions := make([]string, 0, len(values))
+	for _, value := range values {
+		if strings.ContainsRune(value, ' ') {
+			value = `"` + value + `"`
+		}
+		suggestions = append(suggestions, prefix+fmt.Sprintf(format, value))
+	}
+	return suggestions, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+func likePrefix(value string) string {
+	return escapeLike(value) + "%"
+}
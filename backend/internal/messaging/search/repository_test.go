@@ -0,0 +1,123 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+func TestTSQuery(t *testing.T) {
+	query, err := ParseQuery(`deploy "build failed" OR rollback`)
+	require.NoError(t, err)
+
+	sql, args := tsQuery(query.Text)
+	assert.Equal(t, "(plainto_tsquery('english', ?) && phraseto_tsquery('english', ?)) || (plainto_tsquery('english', ?))", sql)
+	assert.Equal(t, []interface{}{"deploy", "build failed", "rollback"}, args)
+}
+
+func TestSearchQueries(t *testing.T) {
+	viewer := uuid.New()
+	hasAttachment := false
+
+	tests := []struct {
+		name     string
+		filter   domain.SearchFilter
+		after    *cursor
+		page     int
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "ranked text search",
+			filter:   domain.SearchFilter{Query: "deploy from:alice in:#ops has:attachment before:2024-05-01"},
+			contains: []string{"m.search_vector @@ q.query", "ts_rank_cd", "ts_headline", "username IN ?", "lower(c.name) IN ?", "EXISTS (SELECT 1 FROM messaging_attachments", "m.created_at < ?", "cm.user_id = ?"},
+		},
+		{
+			name:     "operators only",
+			filter:   domain.SearchFilter{Query: "from:alice", HasAttachment: &hasAttachment},
+			contains: []string{"0::real AS score", "'' AS headline", "NOT EXISTS"},
+			excludes: []string{"q.query", "ts_headline"},
+		},
+		{
+			name:     "cursor",
+			filter:   domain.SearchFilter{Query: "deploy"},
+			after:    &cursor{Score: 0.5, CreatedAt: time.Now(), ID: uuid.New()},
+			page:     3,
+			contains: []string{"(score, created_at, id) < (?::real, ?, ?::uuid)"},
+			excludes: []string{"OFFSET"},
+		},
+		{
+			name:     "page offset",
+			filter:   domain.SearchFilter{Query: "deploy"},
+			page:     3,
+			contains: []string{"OFFSET ?"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.ViewerID = &viewer
+			query, err := ParseQuery(tt.filter.Query)
+			require.NoError(t, err)
+
+			ranked, args := rankedQuery(tt.filter, query)
+			page, pageArgs := pageQuery(query, tt.after, domain.Pagination{Page: tt.page, PageSize: 20})
+			sql := ranked + " " + page
+			args = append(args, pageArgs...)
+
+			assert.Equal(t, strings.Count(sql, "?"), len(args), "every placeholder has an argument")
+			assert.Contains(t, args, viewer)
+			for _, fragment := range tt.contains {
+				assert.Contains(t, sql, fragment)
+			}
+			for _, fragment := range tt.excludes {
+				assert.NotContains(t, sql, fragment)
+			}
+		})
+	}
+}
+
+func TestSearchMessagesValidation(t *testing.T) {
+	repo := NewRepository(nil)
+	viewer := uuid.New()
+
+	_, _, err := repo.SearchMessages(context.Background(), domain.SearchFilter{Query: "deploy"}, domain.NewDefaultPagination())
+	assert.ErrorIs(t, err, ErrViewerRequired)
+
+	_, _, err = repo.SearchMessages(context.Background(), domain.SearchFilter{ViewerID: &viewer, Query: "before:soon"}, domain.NewDefaultPagination())
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+
+	pagination := domain.NewDefaultPagination()
+	pagination.Cursor = "not a cursor"
+	_, _, err = repo.SearchMessages(context.Background(), domain.SearchFilter{ViewerID: &viewer}, pagination)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	original := cursor{Score: 0.123456789, CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC), ID: uuid.New()}
+
+	decoded, err := decodeCursor(original.encode())
+	require.NoError(t, err)
+	assert.Equal(t, original.Score, decoded.Score, "scores survive exactly so the next page starts after this result")
+	assert.True(t, original.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, original.ID, decoded.ID)
+
+	_, err = decodeCursor("e30")
+	assert.ErrorIs(t, err, ErrInvalidCursor, "cursors without a message are rejected")
+}
+
+func TestHighlights(t *testing.T) {
+	headline := "the \x02deploy\x03 <script>" + fragmentSeparator + " later \x02deploy\x03 again " + fragmentSeparator
+	assert.Equal(t, []string{
+		"the <mark>deploy</mark> &lt;script&gt;",
+		"later <mark>deploy</mark> again",
+	}, highlights(headline))
+	assert.Empty(t, highlights(""))
+}
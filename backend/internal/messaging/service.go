@@ -12,6 +12,7 @@ import (
 
 	"github.com/JadenRazo/Project-Website/backend/internal/core"
 	"github.com/JadenRazo/Project-Website/backend/internal/messaging/delivery/websocket"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
 	"github.com/JadenRazo/Project-Website/backend/internal/messaging/entity"
 )
 
@@ -21,6 +22,12 @@ type Service struct {
 	db     *gorm.DB
 	config Config
 	hub    *Hub
+
+	notifications domain.NotificationRepository
+	notifier      Notifier
+
+	hubIDs         HubIDs
+	allowedOrigins []string
 }
 
 // Config holds messaging service configuration
@@ -29,6 +36,15 @@ type Config struct {
 	MaxMessageSize   int
 	MaxAttachments   int
 	AllowedFileTypes []string
+
+	// Broker shares WebSocket events with the other API instances. When
+	// nil, events only reach clients connected to this instance.
+	Broker Broker
+
+	// EventLog keeps recent channel events for clients resuming after a
+	// reconnect. It must be shared by every instance; when nil, a
+	// per-instance in-memory log is used.
+	EventLog EventLog
 }
 
 // Hub is an alias for the websocket Hub
@@ -37,6 +53,12 @@ type Hub = websocket.Hub
 // Client is an alias for the websocket Client
 type Client = websocket.Client
 
+// Broker is an alias for the websocket Broker
+type Broker = websocket.Broker
+
+// EventLog is an alias for the websocket EventLog
+type EventLog = websocket.EventLog
+
 // NewService creates a new messaging service
 func NewService(db *gorm.DB, config Config) *Service {
 	// Create connection manager with default config
@@ -46,7 +68,15 @@ func NewService(db *gorm.DB, config Config) *Service {
 		ConnectionTimeout:  5 * time.Minute,
 	})
 
-	hub := websocket.NewHub(connManager)
+	var hub *Hub
+	if config.Broker != nil {
+		hub = websocket.NewHubWithBroker(connManager, config.Broker)
+	} else {
+		hub = websocket.NewHub(connManager)
+	}
+	if config.EventLog != nil {
+		hub.SetEventLog(config.EventLog)
+	}
 
 	service := &Service{
 		BaseService: core.NewBaseService("messaging"),
@@ -54,6 +84,7 @@ func NewService(db *gorm.DB, config Config) *Service {
 		config:      config,
 		hub:         hub,
 	}
+	hub.SetChannelAccess(service)
 
 	go hub.Run()
 	return service
@@ -356,6 +387,9 @@ func (s *Service) SendMessage(c *gin.Context) {
 	// Update channel's updated_at timestamp
 	s.db.Model(&entity.Channel{}).Where("id = ?", channelID).Update("updated_at", time.Now())
 
+	// Notify mentioned members, and the other members of direct channels
+	s.notifyMessage(c.Request.Context(), message)
+
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Message sent successfully",
@@ -573,15 +607,6 @@ func (s *Service) RemoveReaction(c *gin.Context) {
 	})
 }
 
-// HandleWebSocket handles WebSocket connections
-func (s *Service) HandleWebSocket(c *gin.Context) {
-
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error":   "WebSocket implementation pending",
-		"message": "Real-time messaging via WebSocket will be implemented in the next phase",
-	})
-}
-
 // HealthCheck performs service-specific health checks
 func (s *Service) HealthCheck() error {
 	if err := s.BaseService.HealthCheck(); err != nil {
@@ -634,5 +659,6 @@ func (s *Service) Stop() error {
 	}
 
 	// The hub will handle closing connections when it stops
+	s.hub.Stop()
 	return nil
 }
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of messaging records the WebSocket hub refers to by number
+const (
+	HubKindUser    = "user"
+	HubKindChannel = "channel"
+)
+
+// hubIDRecord is a row of messaging_hub_ids
+type hubIDRecord struct {
+	ID       uint      `gorm:"primaryKey"`
+	Kind     string    `gorm:"type:varchar(20);not null"`
+	EntityID uuid.UUID `gorm:"type:uuid;not null"`
+}
+
+func (hubIDRecord) TableName() string { return "messaging_hub_ids" }
+
+// HubIDRepository maps messaging users and channels to the numeric IDs the
+// WebSocket hub routes events by. A number is allocated the first time a
+// user or channel is seen and never changes, so every API instance agrees
+// on it.
+type HubIDRepository struct {
+	db *gorm.DB
+}
+
+// NewHubIDRepository creates a new hub ID repository
+func NewHubIDRepository(db *gorm.DB) *HubIDRepository {
+	return &HubIDRepository{db: db}
+}
+
+// ID returns the hub ID of a user or channel, allocating it if needed
+func (r *HubIDRepository) ID(ctx context.Context, kind string, entityID uuid.UUID) (uint, error) {
+	db := r.db.WithContext(ctx)
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "entity_id"}},
+		DoNothing: true,
+	}).Create(&hubIDRecord{Kind: kind, EntityID: entityID}).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate hub ID of %s %s: %w", kind, entityID, err)
+	}
+
+	id, err := r.Lookup(ctx, kind, entityID)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("hub ID of %s %s was not allocated", kind, entityID)
+	}
+	return id, nil
+}
+
+// Lookup returns the hub ID of a user or channel, or 0 if the hub has
+// never seen it
+func (r *HubIDRepository) Lookup(ctx context.Context, kind string, entityID uuid.UUID) (uint, error) {
+	var record hubIDRecord
+	err := r.db.WithContext(ctx).Where("kind = ? AND entity_id = ?", kind, entityID).Take(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to look up hub ID of %s %s: %w", kind, entityID, err)
+	}
+	return record.ID, nil
+}
+
+// Entity returns the user or channel a hub ID was allocated to, or
+// uuid.Nil if it was not allocated to one of that kind
+func (r *HubIDRepository) Entity(ctx context.Context, kind string, id uint) (uuid.UUID, error) {
+	var record hubIDRecord
+	err := r.db.WithContext(ctx).Where("id = ? AND kind = ?", id, kind).Take(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return uuid.Nil, nil
+		}
+		return uuid.Nil, fmt.Errorf("failed to look up %s of hub ID %d: %w", kind, id, err)
+	}
+	return record.EntityID, nil
+}
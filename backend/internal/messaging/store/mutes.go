@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// mutedCondition selects channel memberships that are muted now
+const mutedCondition = "cm.is_muted AND (cm.muted_until IS NULL OR cm.muted_until > ?)"
+
+// UserMuteRepository stores channel mutes on the members of a channel, in
+// the is_muted and muted_until columns of messaging_channel_members. Only
+// members can mute a channel.
+type UserMuteRepository struct {
+	db *gorm.DB
+}
+
+var _ domain.UserMuteRepository = (*UserMuteRepository)(nil)
+
+// NewUserMuteRepository creates a new user mute repository
+func NewUserMuteRepository(db *gorm.DB) *UserMuteRepository {
+	return &UserMuteRepository{db: db}
+}
+
+// Create mutes a channel for a user until the mute's expiry, or until it
+// is deleted when it has none
+func (r *UserMuteRepository) Create(ctx context.Context, mute *domain.UserMute) error {
+	return r.setMuted(ctx, mute.UserID, mute.ChannelID, true, mute.ExpiresAt)
+}
+
+// Delete unmutes a channel for a user
+func (r *UserMuteRepository) Delete(ctx context.Context, userID, channelID uuid.UUID) error {
+	return r.setMuted(ctx, userID, channelID, false, nil)
+}
+
+// Get retrieves a user's mute of a channel
+func (r *UserMuteRepository) Get(ctx context.Context, userID, channelID uuid.UUID) (*domain.UserMute, error) {
+	var row struct {
+		ID         uuid.UUID
+		MutedUntil *time.Time
+	}
+	err := r.db.WithContext(ctx).Table("messaging_channel_members cm").
+		Select("cm.id, cm.muted_until").
+		Where("cm.user_id = ? AND cm.channel_id = ?", userID, channelID).
+		Where(mutedCondition, time.Now()).
+		Take(&row).Error
+	if err != nil {
+		return nil, notFound(err, "channel mute not found")
+	}
+	return &domain.UserMute{
+		ID:        row.ID,
+		UserID:    userID,
+		ChannelID: channelID,
+		ExpiresAt: row.MutedUntil,
+	}, nil
+}
+
+// ListUserMutes lists the channels a user muted
+func (r *UserMuteRepository) ListUserMutes(ctx context.Context, userID uuid.UUID) ([]*domain.Channel, error) {
+	var channels []*domain.Channel
+	err := r.db.WithContext(ctx).Table("messaging_channel_members cm").
+		Select("c.id, c.name, c.description, c.type, c.created_by, c.created_at, c.updated_at, c.is_archived").
+		Joins("JOIN messaging_channels c ON c.id = cm.channel_id").
+		Where("cm.user_id = ?", userID).
+		Where(mutedCondition, time.Now()).
+		Order("c.name").
+		Scan(&channels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list muted channels: %w", err)
+	}
+	return channels, nil
+}
+
+// IsMuted checks whether a user has muted a channel
+func (r *UserMuteRepository) IsMuted(ctx context.Context, userID, channelID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Table("messaging_channel_members cm").
+		Where("cm.user_id = ? AND cm.channel_id = ?", userID, channelID).
+		Where(mutedCondition, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check channel mute: %w", err)
+	}
+	return count > 0, nil
+}
+
+// CleanupExpired clears mutes whose expiry has passed
+func (r *UserMuteRepository) CleanupExpired(ctx context.Context) error {
+	err := r.db.WithContext(ctx).Table("messaging_channel_members").
+		Where("is_muted AND muted_until <= ?", time.Now()).
+		Updates(map[string]interface{}{"is_muted": false, "muted_until": nil}).Error
+	if err != nil {
+		return fmt.Errorf("failed to clean up expired mutes: %w", err)
+	}
+	return nil
+}
+
+func (r *UserMuteRepository) setMuted(ctx context.Context, userID, channelID uuid.UUID, muted bool, until *time.Time) error {
+	result := r.db.WithContext(ctx).Table("messaging_channel_members").
+		Where("user_id = ? AND channel_id = ?", userID, channelID).
+		Updates(map[string]interface{}{"is_muted": muted, "muted_until": until})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update channel mute: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewNotFoundError("channel member not found")
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// notificationRecord is a row of messaging_notifications. Notifications
+// without a channel, message or sender store NULL.
+type notificationRecord struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null"`
+	Type      string     `gorm:"size:50;not null"`
+	ChannelID *uuid.UUID `gorm:"type:uuid"`
+	MessageID *uuid.UUID `gorm:"type:uuid"`
+	SenderID  *uuid.UUID `gorm:"type:uuid"`
+	Content   string     `gorm:"type:text;not null"`
+	IsRead    bool       `gorm:"not null;default:false"`
+	CreatedAt time.Time
+}
+
+func (notificationRecord) TableName() string { return "messaging_notifications" }
+
+func (r *notificationRecord) toDomain() *domain.Notification {
+	return &domain.Notification{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Type:      domain.NotificationType(r.Type),
+		ChannelID: fromNullable(r.ChannelID),
+		MessageID: fromNullable(r.MessageID),
+		SenderID:  fromNullable(r.SenderID),
+		Content:   r.Content,
+		IsRead:    r.IsRead,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+func nullable(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+func fromNullable(id *uuid.UUID) uuid.UUID {
+	if id == nil {
+		return uuid.Nil
+	}
+	return *id
+}
+
+// NotificationRepository stores users' messaging notifications
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+var _ domain.NotificationRepository = (*NotificationRepository)(nil)
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *gorm.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Create creates a notification
+func (r *NotificationRepository) Create(ctx context.Context, notification *domain.Notification) error {
+	if notification.ID == uuid.Nil {
+		notification.ID = uuid.New()
+	}
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+
+	record := &notificationRecord{
+		ID:        notification.ID,
+		UserID:    notification.UserID,
+		Type:      string(notification.Type),
+		ChannelID: nullable(notification.ChannelID),
+		MessageID: nullable(notification.MessageID),
+		SenderID:  nullable(notification.SenderID),
+		Content:   notification.Content,
+		IsRead:    notification.IsRead,
+		CreatedAt: notification.CreatedAt,
+	}
+	if err := r.db.WithContext(ctx).Create(record).Error; err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves a notification
+func (r *NotificationRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Notification, error) {
+	var record notificationRecord
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&record).Error; err != nil {
+		return nil, notFound(err, "notification not found")
+	}
+	return record.toDomain(), nil
+}
+
+// GetUserNotifications retrieves a page of a user's notifications, newest
+// first, and the number of notifications matching
+func (r *NotificationRepository) GetUserNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, limit, offset int) ([]*domain.Notification, int, error) {
+	query := r.db.WithContext(ctx).Model(&notificationRecord{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("NOT is_read")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+
+	var records []notificationRecord
+	if err := query.Order("created_at DESC, id").Limit(limit).Offset(offset).Find(&records).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load notifications: %w", err)
+	}
+
+	notifications := make([]*domain.Notification, 0, len(records))
+	for i := range records {
+		notifications = append(notifications, records[i].toDomain())
+	}
+	return notifications, int(total), nil
+}
+
+// MarkAsRead marks a notification as read
+func (r *NotificationRepository) MarkAsRead(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Model(&notificationRecord{}).Where("id = ?", id).Update("is_read", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewNotFoundError("notification not found")
+	}
+	return nil
+}
+
+// MarkAllAsRead marks all of a user's notifications as read
+func (r *NotificationRepository) MarkAllAsRead(ctx context.Context, userID uuid.UUID) error {
+	err := r.db.WithContext(ctx).Model(&notificationRecord{}).
+		Where("user_id = ? AND NOT is_read", userID).
+		Update("is_read", true).Error
+	if err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	return nil
+}
+
+// Delete deletes a notification
+func (r *NotificationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&notificationRecord{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete notification: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewNotFoundError("notification not found")
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// readReceiptRecord is a row of messaging_read_receipts. A user has one
+// receipt per channel: everything posted before it was read is read.
+type readReceiptRecord struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	ChannelID     uuid.UUID  `gorm:"type:uuid;not null"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null"`
+	LastMessageID *uuid.UUID `gorm:"type:uuid"`
+	ReadAt        time.Time
+}
+
+func (readReceiptRecord) TableName() string { return "messaging_read_receipts" }
+
+func (r *readReceiptRecord) toDomain() *domain.ReadReceipt {
+	return &domain.ReadReceipt{
+		ID:        r.ID,
+		ChannelID: r.ChannelID,
+		UserID:    r.UserID,
+		MessageID: fromNullable(r.LastMessageID),
+		ReadAt:    r.ReadAt,
+	}
+}
+
+func toReadReceipts(records []readReceiptRecord) []*domain.ReadReceipt {
+	receipts := make([]*domain.ReadReceipt, 0, len(records))
+	for i := range records {
+		receipts = append(receipts, records[i].toDomain())
+	}
+	return receipts
+}
+
+// ReadReceiptRepository stores how far users have read each channel
+type ReadReceiptRepository struct {
+	db *gorm.DB
+}
+
+var _ domain.ReadReceiptRepository = (*ReadReceiptRepository)(nil)
+
+// NewReadReceiptRepository creates a new read receipt repository
+func NewReadReceiptRepository(db *gorm.DB) *ReadReceiptRepository {
+	return &ReadReceiptRepository{db: db}
+}
+
+// Create records that a user read a channel up to a message, replacing
+// their previous receipt for the channel
+func (r *ReadReceiptRepository) Create(ctx context.Context, receipt *domain.ReadReceipt) error {
+	if receipt.ReadAt.IsZero() {
+		receipt.ReadAt = time.Now()
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return saveReceipt(tx, receipt)
+	})
+}
+
+// GetMessageReceipts retrieves the receipts of the users, other than its
+// sender, who read a message
+func (r *ReadReceiptRepository) GetMessageReceipts(ctx context.Context, messageID uuid.UUID) ([]*domain.ReadReceipt, error) {
+	var records []readReceiptRecord
+	err := r.db.WithContext(ctx).Table("messaging_read_receipts r").
+		Select("r.*").
+		Joins("JOIN messaging_messages m ON m.channel_id = r.channel_id").
+		Where("m.id = ? AND r.user_id <> m.user_id AND r.read_at >= m.created_at", messageID).
+		Order("r.read_at, r.id").
+		Scan(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load message receipts: %w", err)
+	}
+	return toReadReceipts(records), nil
+}
+
+// GetChannelReceipts retrieves the receipts of a channel's readers
+func (r *ReadReceiptRepository) GetChannelReceipts(ctx context.Context, channelID uuid.UUID) ([]*domain.ReadReceipt, error) {
+	var records []readReceiptRecord
+	if err := r.db.WithContext(ctx).Where("channel_id = ?", channelID).Order("read_at DESC, id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load channel receipts: %w", err)
+	}
+	return toReadReceipts(records), nil
+}
+
+// GetUserReceipts retrieves a user's receipts in every channel
+func (r *ReadReceiptRepository) GetUserReceipts(ctx context.Context, userID uuid.UUID) ([]*domain.ReadReceipt, error) {
+	var records []readReceiptRecord
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("read_at DESC, id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user receipts: %w", err)
+	}
+	return toReadReceipts(records), nil
+}
+
+// GetUserChannelReceipt retrieves a user's receipt for a channel
+func (r *ReadReceiptRepository) GetUserChannelReceipt(ctx context.Context, channelID, userID uuid.UUID) (*domain.ReadReceipt, error) {
+	var record readReceiptRecord
+	err := r.db.WithContext(ctx).Where("channel_id = ? AND user_id = ?", channelID, userID).First(&record).Error
+	if err != nil {
+		return nil, notFound(err, "read receipt not found")
+	}
+	return record.toDomain(), nil
+}
+
+// GetChannelReadStatus counts the messages others posted in a channel
+// since the user last read it, and the user's unread mentions in it. A
+// user who never read the channel has every message unread.
+func (r *ReadReceiptRepository) GetChannelReadStatus(ctx context.Context, channelID, userID uuid.UUID) (*domain.ChannelReadStatus, error) {
+	status := &domain.ChannelReadStatus{ChannelID: channelID, UserID: userID}
+
+	db := r.db.WithContext(ctx)
+	var record readReceiptRecord
+	err := db.Where("channel_id = ? AND user_id = ?", channelID, userID).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load read receipt: %w", err)
+	}
+	status.LastReadID = fromNullable(record.LastMessageID)
+	status.LastReadAt = record.ReadAt
+
+	unread := db.Table("messaging_messages").
+		Where("channel_id = ? AND user_id <> ? AND NOT is_deleted", channelID, userID)
+	if !record.ReadAt.IsZero() {
+		unread = unread.Where("created_at > ?", record.ReadAt)
+	}
+	var unreadCount int64
+	if err := unread.Count(&unreadCount).Error; err != nil {
+		return nil, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+	status.UnreadCount = int(unreadCount)
+
+	var mentionCount int64
+	err = db.Model(&notificationRecord{}).
+		Where("user_id = ? AND channel_id = ? AND type = ? AND NOT is_read", userID, channelID, domain.NotificationTypeMention).
+		Count(&mentionCount).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread mentions: %w", err)
+	}
+	status.MentionCount = int(mentionCount)
+	return status, nil
+}
+
+// MarkChannelAsRead marks everything posted in a channel so far as read by
+// a user
+func (r *ReadReceiptRepository) MarkChannelAsRead(ctx context.Context, channelID, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var latest []uuid.UUID
+		err := tx.Table("messaging_messages").
+			Where("channel_id = ? AND NOT is_deleted", channelID).
+			Order("created_at DESC, id DESC").
+			Limit(1).
+			Pluck("id", &latest).Error
+		if err != nil {
+			return fmt.Errorf("failed to find latest message: %w", err)
+		}
+
+		receipt := &domain.ReadReceipt{ChannelID: channelID, UserID: userID, ReadAt: time.Now()}
+		if len(latest) > 0 {
+			receipt.MessageID = latest[0]
+		}
+		return saveReceipt(tx, receipt)
+	})
+}
+
+// saveReceipt upserts a user's receipt for a channel and moves their
+// membership's last read time along with it
+func saveReceipt(tx *gorm.DB, receipt *domain.ReadReceipt) error {
+	record := &readReceiptRecord{
+		ID:            uuid.New(),
+		ChannelID:     receipt.ChannelID,
+		UserID:        receipt.UserID,
+		LastMessageID: nullable(receipt.MessageID),
+		ReadAt:        receipt.ReadAt,
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_message_id", "read_at"}),
+	}).Create(record).Error
+	if err != nil {
+		return fmt.Errorf("failed to save read receipt: %w", err)
+	}
+
+	err = tx.Table("messaging_channel_members").
+		Where("channel_id = ? AND user_id = ?", receipt.ChannelID, receipt.UserID).
+		Update("last_read_at", receipt.ReadAt).Error
+	if err != nil {
+		return fmt.Errorf("failed to update last read time: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// userSettingsRecord is a row of messaging_user_settings. Each group of
+// settings is a JSON document, so adding a setting needs no migration.
+type userSettingsRecord struct {
+	ID                   uuid.UUID                    `gorm:"type:uuid;primaryKey"`
+	UserID               uuid.UUID                    `gorm:"type:uuid;uniqueIndex;not null"`
+	Theme                string                       `gorm:"size:50"`
+	Language             string                       `gorm:"size:20"`
+	NotificationSettings *domain.NotificationSettings `gorm:"serializer:json;type:jsonb"`
+	PrivacySettings      *domain.PrivacySettings      `gorm:"serializer:json;type:jsonb"`
+	MessageSettings      *domain.MessageSettings      `gorm:"serializer:json;type:jsonb"`
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+func (userSettingsRecord) TableName() string { return "messaging_user_settings" }
+
+func (r *userSettingsRecord) toDomain() *domain.UserSettings {
+	return &domain.UserSettings{
+		ID:                   r.ID,
+		UserID:               r.UserID,
+		Theme:                r.Theme,
+		Language:             r.Language,
+		NotificationSettings: r.NotificationSettings,
+		PrivacySettings:      r.PrivacySettings,
+		MessageSettings:      r.MessageSettings,
+		CreatedAt:            r.CreatedAt,
+		UpdatedAt:            r.UpdatedAt,
+	}
+}
+
+func newUserSettingsRecord(settings *domain.UserSettings) *userSettingsRecord {
+	return &userSettingsRecord{
+		ID:                   settings.ID,
+		UserID:               settings.UserID,
+		Theme:                settings.Theme,
+		Language:             settings.Language,
+		NotificationSettings: settings.NotificationSettings,
+		PrivacySettings:      settings.PrivacySettings,
+		MessageSettings:      settings.MessageSettings,
+		CreatedAt:            settings.CreatedAt,
+		UpdatedAt:            settings.UpdatedAt,
+	}
+}
+
+// UserSettingsRepository stores users' messaging settings
+type UserSettingsRepository struct {
+	db *gorm.DB
+}
+
+var _ domain.UserSettingsRepository = (*UserSettingsRepository)(nil)
+
+// NewUserSettingsRepository creates a new user settings repository
+func NewUserSettingsRepository(db *gorm.DB) *UserSettingsRepository {
+	return &UserSettingsRepository{db: db}
+}
+
+// Get retrieves a user's settings
+func (r *UserSettingsRepository) Get(ctx context.Context, userID uuid.UUID) (*domain.UserSettings, error) {
+	record, err := r.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return record.toDomain(), nil
+}
+
+// Create creates a user's settings
+func (r *UserSettingsRepository) Create(ctx context.Context, settings *domain.UserSettings) error {
+	if settings.ID == uuid.Nil {
+		settings.ID = uuid.New()
+	}
+	record := newUserSettingsRecord(settings)
+	if err := r.db.WithContext(ctx).Create(record).Error; err != nil {
+		return fmt.Errorf("failed to create user settings: %w", err)
+	}
+	settings.CreatedAt, settings.UpdatedAt = record.CreatedAt, record.UpdatedAt
+	return nil
+}
+
+// Update replaces a user's settings
+func (r *UserSettingsRepository) Update(ctx context.Context, settings *domain.UserSettings) error {
+	record := newUserSettingsRecord(settings)
+	result := r.db.WithContext(ctx).Model(&userSettingsRecord{}).
+		Where("user_id = ?", settings.UserID).
+		Select("theme", "language", "notification_settings", "privacy_settings", "message_settings", "updated_at").
+		Updates(record)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update user settings: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return domain.NewNotFoundError("user settings not found")
+	}
+	return nil
+}
+
+// GetNotificationSettings gets a user's notification settings
+func (r *UserSettingsRepository) GetNotificationSettings(ctx context.Context, userID uuid.UUID) (*domain.NotificationSettings, error) {
+	record, err := r.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if record.NotificationSettings == nil {
+		return nil, domain.NewNotFoundError("notification settings not found")
+	}
+	return record.NotificationSettings, nil
+}
+
+// UpdateNotificationSettings sets a user's notification settings, creating
+// their settings if they have none
+func (r *UserSettingsRepository) UpdateNotificationSettings(ctx context.Context, userID uuid.UUID, settings *domain.NotificationSettings) error {
+	return r.upsert(ctx, &userSettingsRecord{UserID: userID, NotificationSettings: settings}, "notification_settings")
+}
+
+// GetPrivacySettings gets a user's privacy settings
+func (r *UserSettingsRepository) GetPrivacySettings(ctx context.Context, userID uuid.UUID) (*domain.PrivacySettings, error) {
+	record, err := r.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if record.PrivacySettings == nil {
+		return nil, domain.NewNotFoundError("privacy settings not found")
+	}
+	return record.PrivacySettings, nil
+}
+
+// UpdatePrivacySettings sets a user's privacy settings, creating their
+// settings if they have none
+func (r *UserSettingsRepository) UpdatePrivacySettings(ctx context.Context, userID uuid.UUID, settings *domain.PrivacySettings) error {
+	return r.upsert(ctx, &userSettingsRecord{UserID: userID, PrivacySettings: settings}, "privacy_settings")
+}
+
+// GetMessageSettings gets a user's message settings
+func (r *UserSettingsRepository) GetMessageSettings(ctx context.Context, userID uuid.UUID) (*domain.MessageSettings, error) {
+	record, err := r.get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if record.MessageSettings == nil {
+		return nil, domain.NewNotFoundError("message settings not found")
+	}
+	return record.MessageSettings, nil
+}
+
+// UpdateMessageSettings sets a user's message settings, creating their
+// settings if they have none
+func (r *UserSettingsRepository) UpdateMessageSettings(ctx context.Context, userID uuid.UUID, settings *domain.MessageSettings) error {
+	return r.upsert(ctx, &userSettingsRecord{UserID: userID, MessageSettings: settings}, "message_settings")
+}
+
+func (r *UserSettingsRepository) get(ctx context.Context, userID uuid.UUID) (*userSettingsRecord, error) {
+	var record userSettingsRecord
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&record).Error; err != nil {
+		return nil, notFound(err, "user settings not found")
+	}
+	return &record, nil
+}
+
+// upsert writes one group of settings, leaving the others as they are
+func (r *UserSettingsRepository) upsert(ctx context.Context, record *userSettingsRecord, column string) error {
+	record.ID = uuid.New()
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{column, "updated_at"}),
+	}).Create(record).Error
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", column, err)
+	}
+	return nil
+}
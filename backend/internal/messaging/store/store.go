@@ -0,0 +1,20 @@
+// Package store implements the messaging domain repositories used by the
+// push and email digest services over the messaging tables of schema.sql,
+// and the mapping of messaging users and channels to WebSocket hub IDs.
+package store
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// notFound maps gorm's missing record error to the domain's not found error
+func notFound(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.NewNotFoundError(message)
+	}
+	return err
+}
@@ -0,0 +1,313 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/domain"
+)
+
+// schema is the part of the messaging schema the repositories use
+var schema = []string{
+	`CREATE TABLE messaging_channels (
+		id TEXT PRIMARY KEY, name TEXT, description TEXT, type TEXT, created_by TEXT,
+		is_archived BOOLEAN DEFAULT false, created_at DATETIME, updated_at DATETIME)`,
+	`CREATE TABLE messaging_channel_members (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT,
+		last_read_at DATETIME, is_muted BOOLEAN DEFAULT false, muted_until DATETIME)`,
+	`CREATE TABLE messaging_messages (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, content TEXT,
+		is_deleted BOOLEAN DEFAULT false, created_at DATETIME)`,
+	`CREATE TABLE messaging_read_receipts (
+		id TEXT PRIMARY KEY, channel_id TEXT, user_id TEXT, last_message_id TEXT, read_at DATETIME,
+		UNIQUE (channel_id, user_id))`,
+	`CREATE TABLE messaging_user_settings (
+		id TEXT PRIMARY KEY, user_id TEXT NOT NULL UNIQUE, theme TEXT, language TEXT,
+		notification_settings TEXT, privacy_settings TEXT, message_settings TEXT,
+		created_at DATETIME, updated_at DATETIME)`,
+	`CREATE TABLE messaging_notifications (
+		id TEXT PRIMARY KEY, user_id TEXT NOT NULL, type TEXT NOT NULL,
+		channel_id TEXT, message_id TEXT, sender_id TEXT, content TEXT NOT NULL,
+		is_read BOOLEAN NOT NULL DEFAULT false, created_at DATETIME)`,
+	`CREATE TABLE messaging_hub_ids (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, kind TEXT NOT NULL, entity_id TEXT NOT NULL,
+		UNIQUE (kind, entity_id))`,
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	for _, statement := range schema {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	return db
+}
+
+// addMember adds a user to a channel, creating the channel
+func addMember(t *testing.T, db *gorm.DB, channelID, userID uuid.UUID, name string) {
+	t.Helper()
+	require.NoError(t, db.Exec("INSERT OR IGNORE INTO messaging_channels (id, name, type) VALUES (?, ?, 'public')",
+		channelID, name).Error)
+	require.NoError(t, db.Exec("INSERT INTO messaging_channel_members (id, channel_id, user_id) VALUES (?, ?, ?)",
+		uuid.New(), channelID, userID).Error)
+}
+
+func TestUserSettingsRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewUserSettingsRepository(newTestDB(t))
+	userID := uuid.New()
+
+	_, err := repo.Get(ctx, userID)
+	assert.True(t, domain.IsNotFoundError(err))
+	_, err = repo.GetNotificationSettings(ctx, userID)
+	assert.True(t, domain.IsNotFoundError(err))
+
+	// Updating one group creates the settings and leaves the others unset
+	require.NoError(t, repo.UpdateNotificationSettings(ctx, userID, &domain.NotificationSettings{
+		EmailNotifications: true,
+		EmailDigest:        domain.DigestDaily,
+	}))
+	notifications, err := repo.GetNotificationSettings(ctx, userID)
+	require.NoError(t, err)
+	assert.True(t, notifications.EmailNotifications)
+	assert.Equal(t, domain.DigestDaily, notifications.EmailDigest)
+	_, err = repo.GetPrivacySettings(ctx, userID)
+	assert.True(t, domain.IsNotFoundError(err))
+
+	// Updating another group keeps the first
+	require.NoError(t, repo.UpdatePrivacySettings(ctx, userID, &domain.PrivacySettings{OnlineStatusVisible: true}))
+	require.NoError(t, repo.UpdateNotificationSettings(ctx, userID, &domain.NotificationSettings{EmailDigest: domain.DigestHourly}))
+	settings, err := repo.Get(ctx, userID)
+	require.NoError(t, err)
+	require.NotNil(t, settings.PrivacySettings)
+	assert.True(t, settings.PrivacySettings.OnlineStatusVisible)
+	require.NotNil(t, settings.NotificationSettings)
+	assert.Equal(t, domain.DigestHourly, settings.NotificationSettings.EmailDigest)
+
+	settings.Theme = "dark"
+	require.NoError(t, repo.Update(ctx, settings))
+	settings, err = repo.Get(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, "dark", settings.Theme)
+
+	err = repo.Update(ctx, &domain.UserSettings{UserID: uuid.New()})
+	assert.True(t, domain.IsNotFoundError(err))
+}
+
+func TestUserMuteRepository(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewUserMuteRepository(db)
+	userID := uuid.New()
+	general, random, expired := uuid.New(), uuid.New(), uuid.New()
+	addMember(t, db, general, userID, "general")
+	addMember(t, db, random, userID, "random")
+	addMember(t, db, expired, userID, "expired")
+
+	later := time.Now().Add(time.Hour)
+	earlier := time.Now().Add(-time.Hour)
+	require.NoError(t, repo.Create(ctx, &domain.UserMute{UserID: userID, ChannelID: general}))
+	require.NoError(t, repo.Create(ctx, &domain.UserMute{UserID: userID, ChannelID: random, ExpiresAt: &later}))
+	require.NoError(t, repo.Create(ctx, &domain.UserMute{UserID: userID, ChannelID: expired, ExpiresAt: &earlier}))
+
+	for channelID, want := range map[uuid.UUID]bool{general: true, random: true, expired: false} {
+		muted, err := repo.IsMuted(ctx, userID, channelID)
+		require.NoError(t, err)
+		assert.Equal(t, want, muted, channelID)
+	}
+
+	mute, err := repo.Get(ctx, userID, random)
+	require.NoError(t, err)
+	require.NotNil(t, mute.ExpiresAt)
+	assert.WithinDuration(t, later, *mute.ExpiresAt, time.Second)
+	_, err = repo.Get(ctx, userID, expired)
+	assert.True(t, domain.IsNotFoundError(err))
+
+	channels, err := repo.ListUserMutes(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, channels, 2)
+	assert.Equal(t, "general", channels[0].Name)
+	assert.Equal(t, "random", channels[1].Name)
+
+	require.NoError(t, repo.CleanupExpired(ctx))
+	var stillMuted int64
+	require.NoError(t, db.Table("messaging_channel_members").Where("is_muted").Count(&stillMuted).Error)
+	assert.EqualValues(t, 2, stillMuted)
+
+	require.NoError(t, repo.Delete(ctx, userID, general))
+	muted, err := repo.IsMuted(ctx, userID, general)
+	require.NoError(t, err)
+	assert.False(t, muted)
+
+	// Only members can mute a channel
+	err = repo.Create(ctx, &domain.UserMute{UserID: uuid.New(), ChannelID: general})
+	assert.True(t, domain.IsNotFoundError(err))
+}
+
+func TestNotificationRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewNotificationRepository(newTestDB(t))
+	userID, channelID, senderID := uuid.New(), uuid.New(), uuid.New()
+
+	mention := domain.NewMentionNotification(userID, channelID, uuid.New(), senderID, "hi @alice")
+	mention.CreatedAt = time.Now().Add(-time.Minute)
+	require.NoError(t, repo.Create(ctx, mention))
+	invite := &domain.Notification{UserID: userID, Type: domain.NotificationTypeChannelInvite, SenderID: senderID, Content: "general"}
+	require.NoError(t, repo.Create(ctx, invite))
+	assert.NotEqual(t, uuid.Nil, invite.ID)
+	require.NoError(t, repo.Create(ctx, domain.NewMessageNotification(uuid.New(), channelID, uuid.New(), senderID, "hello")))
+
+	got, err := repo.Get(ctx, invite.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, got.ChannelID)
+	assert.Equal(t, uuid.Nil, got.MessageID)
+	assert.Equal(t, senderID, got.SenderID)
+
+	notifications, total, err := repo.GetUserNotifications(ctx, userID, false, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, invite.ID, notifications[0].ID)
+
+	require.NoError(t, repo.MarkAsRead(ctx, invite.ID))
+	notifications, total, err = repo.GetUserNotifications(ctx, userID, true, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, notifications, 1)
+	assert.Equal(t, mention.ID, notifications[0].ID)
+	assert.Equal(t, channelID, notifications[0].ChannelID)
+
+	require.NoError(t, repo.MarkAllAsRead(ctx, userID))
+	_, total, err = repo.GetUserNotifications(ctx, userID, true, 10, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	require.NoError(t, repo.Delete(ctx, mention.ID))
+	assert.True(t, domain.IsNotFoundError(repo.Delete(ctx, mention.ID)))
+	assert.True(t, domain.IsNotFoundError(repo.MarkAsRead(ctx, mention.ID)))
+	_, err = repo.Get(ctx, mention.ID)
+	assert.True(t, domain.IsNotFoundError(err))
+}
+
+// postMessage posts a message in a channel at a time
+func postMessage(t *testing.T, db *gorm.DB, channelID, userID uuid.UUID, at time.Time) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	require.NoError(t, db.Exec("INSERT INTO messaging_messages (id, channel_id, user_id, content, created_at) VALUES (?, ?, ?, 'hi', ?)",
+		id, channelID, userID, at).Error)
+	return id
+}
+
+func TestReadReceiptRepository(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewReadReceiptRepository(db)
+	notifications := NewNotificationRepository(db)
+	alice, bob := uuid.New(), uuid.New()
+	channelID := uuid.New()
+	addMember(t, db, channelID, alice, "general")
+	addMember(t, db, channelID, bob, "general")
+
+	now := time.Now()
+	first := postMessage(t, db, channelID, bob, now.Add(-3*time.Hour))
+	postMessage(t, db, channelID, alice, now.Add(-2*time.Hour))
+	last := postMessage(t, db, channelID, bob, now.Add(-time.Hour))
+	require.NoError(t, notifications.Create(ctx, domain.NewMentionNotification(alice, channelID, last, bob, "@alice")))
+	require.NoError(t, notifications.Create(ctx, domain.NewMessageNotification(alice, channelID, last, bob, "hello")))
+
+	// Without a receipt, every message from others is unread
+	status, err := repo.GetChannelReadStatus(ctx, channelID, alice)
+	require.NoError(t, err)
+	assert.Equal(t, 2, status.UnreadCount)
+	assert.Equal(t, 1, status.MentionCount)
+	assert.Equal(t, uuid.Nil, status.LastReadID)
+	_, err = repo.GetUserChannelReceipt(ctx, channelID, alice)
+	assert.True(t, domain.IsNotFoundError(err))
+
+	require.NoError(t, repo.Create(ctx, &domain.ReadReceipt{
+		ChannelID: channelID, UserID: alice, MessageID: first, ReadAt: now.Add(-150 * time.Minute),
+	}))
+	status, err = repo.GetChannelReadStatus(ctx, channelID, alice)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status.UnreadCount)
+	assert.Equal(t, first, status.LastReadID)
+
+	receipts, err := repo.GetMessageReceipts(ctx, first)
+	require.NoError(t, err)
+	require.Len(t, receipts, 1)
+	assert.Equal(t, alice, receipts[0].UserID)
+	receipts, err = repo.GetMessageReceipts(ctx, last)
+	require.NoError(t, err)
+	assert.Empty(t, receipts)
+
+	// Marking the channel read replaces the receipt
+	require.NoError(t, repo.MarkChannelAsRead(ctx, channelID, alice))
+	status, err = repo.GetChannelReadStatus(ctx, channelID, alice)
+	require.NoError(t, err)
+	assert.Zero(t, status.UnreadCount)
+	assert.Equal(t, last, status.LastReadID)
+
+	receipts, err = repo.GetChannelReceipts(ctx, channelID)
+	require.NoError(t, err)
+	require.Len(t, receipts, 1)
+	receipts, err = repo.GetUserReceipts(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, receipts, 1)
+	assert.Equal(t, last, receipts[0].MessageID)
+
+	var lastReadAt *time.Time
+	require.NoError(t, db.Table("messaging_channel_members").
+		Where("channel_id = ? AND user_id = ?", channelID, alice).
+		Pluck("last_read_at", &lastReadAt).Error)
+	require.NotNil(t, lastReadAt)
+	assert.WithinDuration(t, time.Now(), *lastReadAt, time.Minute)
+}
+
+func TestHubIDRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewHubIDRepository(newTestDB(t))
+	userID := uuid.New()
+
+	id, err := repo.Lookup(ctx, HubKindUser, userID)
+	require.NoError(t, err)
+	assert.Zero(t, id)
+
+	// IDs are allocated once and then stay the same
+	id, err = repo.ID(ctx, HubKindUser, userID)
+	require.NoError(t, err)
+	assert.NotZero(t, id)
+	again, err := repo.ID(ctx, HubKindUser, userID)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+	found, err := repo.Lookup(ctx, HubKindUser, userID)
+	require.NoError(t, err)
+	assert.Equal(t, id, found)
+
+	// Kinds are numbered separately
+	channelID, err := repo.ID(ctx, HubKindChannel, userID)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, channelID)
+
+	entity, err := repo.Entity(ctx, HubKindUser, id)
+	require.NoError(t, err)
+	assert.Equal(t, userID, entity)
+	entity, err = repo.Entity(ctx, HubKindChannel, id)
+	require.NoError(t, err)
+	assert.Equal(t, uuid.Nil, entity)
+}
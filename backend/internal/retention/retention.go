@@ -0,0 +1,371 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultBatchSize is the number of rows removed per DELETE statement
+	DefaultBatchSize = 1000
+	// DefaultBatchPause is the pause between batches so other writers can
+	// acquire locks on the table
+	DefaultBatchPause = 50 * time.Millisecond
+
+	// Run statuses
+	RunStatusCompleted = "completed"
+	RunStatusFailed    = "failed"
+)
+
+var (
+	ErrRunInProgress    = errors.New("retention run already in progress")
+	ErrInvalidDataset   = errors.New("invalid retention dataset")
+	ErrDuplicateDataset = errors.New("retention dataset already registered")
+
+	identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// Dataset describes a table whose rows expire after a retention period.
+// Table, column names and Condition come from code, never from user input.
+type Dataset struct {
+	Name        string
+	Description string
+	Table       string
+	TimeColumn  string
+	// KeyColumn identifies rows for batched deletes, defaults to "id"
+	KeyColumn string
+	// Condition is an optional extra SQL filter such as "is_spam = true"
+	Condition string
+	// Retention returns how long rows are kept. Zero or less keeps rows
+	// forever, which lets packages disable a dataset from configuration.
+	Retention func() time.Duration
+	// Dependents are removed in batches before each batch of expired rows,
+	// so a cascading delete never removes an unbounded number of rows
+	Dependents []Dependent
+}
+
+// Dependent is a table whose rows reference a dataset's rows
+type Dependent struct {
+	Table string
+	// ForeignKey is the column referencing the dataset's KeyColumn
+	ForeignKey string
+	// KeyColumn identifies rows for batched deletes, defaults to "id"
+	KeyColumn string
+}
+
+// Days is a convenience for expressing retention periods in days
+func Days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// Fixed returns a Retention func for a constant period
+func Fixed(d time.Duration) func() time.Duration {
+	return func() time.Duration { return d }
+}
+
+// DatasetInfo is the read-only view of a registered dataset
+type DatasetInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Table       string `json:"table"`
+	TimeColumn  string `json:"timeColumn"`
+	Condition   string `json:"condition,omitempty"`
+	Days        int    `json:"retentionDays"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// DatasetResult records what a run did to a single dataset
+type DatasetResult struct {
+	Dataset string     `json:"dataset"`
+	Table   string     `json:"table"`
+	Cutoff  *time.Time `json:"cutoff,omitempty"`
+	Skipped bool       `json:"skipped"`
+	Rows    int64      `json:"rows"`
+	// DependentRows are rows of Dataset.Dependents removed with Rows
+	DependentRows int64  `json:"dependentRows,omitempty"`
+	Batches       int    `json:"batches"`
+	DurationMs    int64  `json:"durationMs"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Run is the audit record written for every retention run
+type Run struct {
+	ID         uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	DryRun     bool            `gorm:"not null;default:false" json:"dryRun"`
+	Trigger    string          `gorm:"type:varchar(50);not null" json:"trigger"`
+	Status     string          `gorm:"type:varchar(20);not null" json:"status"`
+	TotalRows  int64           `gorm:"default:0" json:"totalRows"`
+	Results    []DatasetResult `gorm:"serializer:json;type:jsonb" json:"results"`
+	StartedAt  time.Time       `gorm:"not null" json:"startedAt"`
+	FinishedAt time.Time       `gorm:"not null" json:"finishedAt"`
+}
+
+func (Run) TableName() string { return "retention_runs" }
+
+// Options configures an Engine
+type Options struct {
+	BatchSize  int
+	BatchPause time.Duration
+}
+
+// Engine enforces retention rules for all registered datasets
+type Engine struct {
+	db       *gorm.DB
+	options  Options
+	mu       sync.RWMutex
+	datasets map[string]Dataset
+	running  sync.Mutex
+}
+
+// NewEngine creates a new retention engine
+func NewEngine(db *gorm.DB, options Options) *Engine {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.BatchPause < 0 {
+		options.BatchPause = 0
+	} else if options.BatchPause == 0 {
+		options.BatchPause = DefaultBatchPause
+	}
+
+	return &Engine{
+		db:       db,
+		options:  options,
+		datasets: make(map[string]Dataset),
+	}
+}
+
+// Register adds datasets to the engine
+func (e *Engine) Register(datasets ...Dataset) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ds := range datasets {
+		if ds.KeyColumn == "" {
+			ds.KeyColumn = "id"
+		}
+		if ds.Name == "" || ds.Retention == nil ||
+			!identifierPattern.MatchString(ds.Table) ||
+			!identifierPattern.MatchString(ds.TimeColumn) ||
+			!identifierPattern.MatchString(ds.KeyColumn) {
+			return fmt.Errorf("%w: %q", ErrInvalidDataset, ds.Name)
+		}
+		ds.Dependents = append([]Dependent(nil), ds.Dependents...)
+		for i := range ds.Dependents {
+			dep := &ds.Dependents[i]
+			if dep.KeyColumn == "" {
+				dep.KeyColumn = "id"
+			}
+			if !identifierPattern.MatchString(dep.Table) ||
+				!identifierPattern.MatchString(dep.ForeignKey) ||
+				!identifierPattern.MatchString(dep.KeyColumn) {
+				return fmt.Errorf("%w: %q", ErrInvalidDataset, ds.Name)
+			}
+		}
+		if _, exists := e.datasets[ds.Name]; exists {
+			return fmt.Errorf("%w: %q", ErrDuplicateDataset, ds.Name)
+		}
+		e.datasets[ds.Name] = ds
+	}
+
+	return nil
+}
+
+// Datasets returns all registered datasets ordered by name
+func (e *Engine) Datasets() []DatasetInfo {
+	datasets := e.sortedDatasets()
+
+	infos := make([]DatasetInfo, 0, len(datasets))
+	for _, ds := range datasets {
+		retention := ds.Retention()
+		infos = append(infos, DatasetInfo{
+			Name:        ds.Name,
+			Description: ds.Description,
+			Table:       ds.Table,
+			TimeColumn:  ds.TimeColumn,
+			Condition:   ds.Condition,
+			Days:        int(retention / (24 * time.Hour)),
+			Enabled:     retention > 0,
+		})
+	}
+	return infos
+}
+
+// Run enforces every registered dataset and writes an audit record. In dry-run
+// mode rows are counted but not deleted. A failing dataset does not stop the
+// others; the run is then recorded as failed.
+func (e *Engine) Run(ctx context.Context, dryRun bool, trigger string) (*Run, error) {
+	if !e.running.TryLock() {
+		return nil, ErrRunInProgress
+	}
+	defer e.running.Unlock()
+
+	run := &Run{
+		ID:        uuid.New(),
+		DryRun:    dryRun,
+		Trigger:   trigger,
+		Status:    RunStatusCompleted,
+		StartedAt: time.Now(),
+	}
+
+	for _, ds := range e.sortedDatasets() {
+		result := e.enforce(ctx, ds, dryRun)
+		if result.Error != "" {
+			run.Status = RunStatusFailed
+		}
+		run.TotalRows += result.Rows + result.DependentRows
+		run.Results = append(run.Results, result)
+	}
+
+	run.FinishedAt = time.Now()
+
+	// The audit record is written even if the run context was cancelled
+	if err := e.db.WithContext(context.WithoutCancel(ctx)).Create(run).Error; err != nil {
+		return run, fmt.Errorf("failed to write retention audit record: %w", err)
+	}
+
+	return run, nil
+}
+
+// ListRuns returns the most recent audit records
+func (e *Engine) ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var runs []Run
+	err := e.db.WithContext(ctx).Order("started_at DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+func (e *Engine) enforce(ctx context.Context, ds Dataset, dryRun bool) DatasetResult {
+	start := time.Now()
+	result := DatasetResult{Dataset: ds.Name, Table: ds.Table}
+	defer func() {
+		result.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	retention := ds.Retention()
+	if retention <= 0 {
+		result.Skipped = true
+		return result
+	}
+
+	cutoff := start.Add(-retention)
+	result.Cutoff = &cutoff
+
+	where := fmt.Sprintf("%s < ?", ds.TimeColumn)
+	if ds.Condition != "" {
+		where += " AND (" + ds.Condition + ")"
+	}
+
+	if dryRun {
+		if err := e.db.WithContext(ctx).Table(ds.Table).Where(where, cutoff).Count(&result.Rows).Error; err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		expired := fmt.Sprintf("SELECT %s FROM %s WHERE %s", ds.KeyColumn, ds.Table, where)
+		for _, dep := range ds.Dependents {
+			var rows int64
+			err := e.db.WithContext(ctx).Table(dep.Table).
+				Where(fmt.Sprintf("%s IN (%s)", dep.ForeignKey, expired), cutoff).
+				Count(&rows).Error
+			if err != nil {
+				result.Error = err.Error()
+				return result
+			}
+			result.DependentRows += rows
+		}
+		return result
+	}
+
+	// The batch is ordered so dependents are removed for the same rows the
+	// batch then deletes
+	batch := fmt.Sprintf("SELECT %s FROM %s WHERE %s", ds.KeyColumn, ds.Table, where)
+	if len(ds.Dependents) > 0 {
+		batch += " ORDER BY " + ds.KeyColumn
+	}
+	batch += " LIMIT ?"
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", ds.Table, ds.KeyColumn, batch)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		for _, dep := range ds.Dependents {
+			depQuery := fmt.Sprintf(
+				"DELETE FROM %s WHERE %s IN (SELECT %s FROM %s WHERE %s IN (%s) LIMIT ?)",
+				dep.Table, dep.KeyColumn, dep.KeyColumn, dep.Table, dep.ForeignKey, batch,
+			)
+			for {
+				res := e.db.WithContext(ctx).Exec(depQuery, cutoff, e.options.BatchSize, e.options.BatchSize)
+				if res.Error != nil {
+					result.Error = res.Error.Error()
+					return result
+				}
+				result.DependentRows += res.RowsAffected
+				result.Batches++
+
+				if res.RowsAffected < int64(e.options.BatchSize) {
+					break
+				}
+				if err := e.pause(ctx); err != nil {
+					result.Error = err.Error()
+					return result
+				}
+			}
+		}
+
+		res := e.db.WithContext(ctx).Exec(query, cutoff, e.options.BatchSize)
+		if res.Error != nil {
+			result.Error = res.Error.Error()
+			return result
+		}
+
+		result.Rows += res.RowsAffected
+		result.Batches++
+
+		if res.RowsAffected < int64(e.options.BatchSize) {
+			return result
+		}
+		if err := e.pause(ctx); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+}
+
+// pause waits between batches so other writers can acquire locks on the
+// table
+func (e *Engine) pause(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(e.options.BatchPause):
+		return nil
+	}
+}
+
+func (e *Engine) sortedDatasets() []Dataset {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	datasets := make([]Dataset, 0, len(e.datasets))
+	for _, ds := range e.datasets {
+		datasets = append(datasets, ds)
+	}
+	sort.Slice(datasets, func(i, j int) bool {
+		return datasets[i].Name < datasets[j].Name
+	})
+	return datasets
+}
@@ -0,0 +1,228 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	// Foreign keys are enforced without cascading, so deleting a row that
+	// still has dependents fails
+	db, err := gorm.Open(sqlite.Open(":memory:?_pragma=foreign_keys(1)"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	for _, statement := range []string{
+		`CREATE TABLE retention_runs (
+			id TEXT PRIMARY KEY, dry_run BOOLEAN, "trigger" TEXT, status TEXT, total_rows INTEGER,
+			results TEXT, started_at DATETIME, finished_at DATETIME)`,
+		`CREATE TABLE sessions (id INTEGER PRIMARY KEY, is_bot BOOLEAN DEFAULT false, created_at DATETIME)`,
+		`CREATE TABLE views (id INTEGER PRIMARY KEY, session_id INTEGER REFERENCES sessions(id), created_at DATETIME)`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+	return db
+}
+
+// insertSessions adds sessions created age ago, each with views page views
+func insertSessions(t *testing.T, db *gorm.DB, count int, age time.Duration, views int) {
+	t.Helper()
+	createdAt := time.Now().Add(-age)
+	for i := 0; i < count; i++ {
+		res := db.Exec("INSERT INTO sessions (created_at) VALUES (?)", createdAt)
+		require.NoError(t, res.Error)
+		var id int64
+		require.NoError(t, db.Raw("SELECT last_insert_rowid()").Scan(&id).Error)
+		for j := 0; j < views; j++ {
+			require.NoError(t, db.Exec("INSERT INTO views (session_id, created_at) VALUES (?, ?)", id, createdAt).Error)
+		}
+	}
+}
+
+func count(t *testing.T, db *gorm.DB, table string) int64 {
+	t.Helper()
+	var n int64
+	require.NoError(t, db.Table(table).Count(&n).Error)
+	return n
+}
+
+func sessionsDataset(days int) Dataset {
+	return Dataset{
+		Name:       "test.sessions",
+		Table:      "sessions",
+		TimeColumn: "created_at",
+		Retention:  Fixed(Days(days)),
+	}
+}
+
+func TestRegisterValidatesDatasets(t *testing.T) {
+	engine := NewEngine(newTestDB(t), Options{})
+	valid := sessionsDataset(30)
+	require.NoError(t, engine.Register(valid))
+
+	invalid := map[string]func(*Dataset){
+		"no name":               func(ds *Dataset) { ds.Name = "" },
+		"no retention":          func(ds *Dataset) { ds.Retention = nil },
+		"table":                 func(ds *Dataset) { ds.Table = "sessions; DROP TABLE sessions" },
+		"time column":           func(ds *Dataset) { ds.TimeColumn = "Created At" },
+		"key column":            func(ds *Dataset) { ds.KeyColumn = "id--" },
+		"dependent table":       func(ds *Dataset) { ds.Dependents = []Dependent{{Table: "views x", ForeignKey: "session_id"}} },
+		"dependent foreign key": func(ds *Dataset) { ds.Dependents = []Dependent{{Table: "views"}} },
+	}
+	for name, mutate := range invalid {
+		t.Run(name, func(t *testing.T) {
+			ds := sessionsDataset(30)
+			ds.Name = "test." + name
+			mutate(&ds)
+			assert.ErrorIs(t, engine.Register(ds), ErrInvalidDataset)
+		})
+	}
+
+	assert.ErrorIs(t, engine.Register(valid), ErrDuplicateDataset)
+	require.Len(t, engine.Datasets(), 1)
+	assert.Equal(t, 30, engine.Datasets()[0].Days)
+}
+
+func TestRunDeletesInBatches(t *testing.T) {
+	db := newTestDB(t)
+	insertSessions(t, db, 25, 40*24*time.Hour, 0)
+	insertSessions(t, db, 5, time.Hour, 0)
+
+	engine := NewEngine(db, Options{BatchSize: 10, BatchPause: -1})
+	require.NoError(t, engine.Register(sessionsDataset(30)))
+
+	run, err := engine.Run(context.Background(), false, "test")
+	require.NoError(t, err)
+	assert.Equal(t, RunStatusCompleted, run.Status)
+	assert.EqualValues(t, 25, run.TotalRows)
+	require.Len(t, run.Results, 1)
+	assert.EqualValues(t, 25, run.Results[0].Rows)
+	assert.Equal(t, 3, run.Results[0].Batches)
+	assert.EqualValues(t, 5, count(t, db, "sessions"), "rows within the retention period are kept")
+
+	runs, err := engine.ListRuns(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, run.ID, runs[0].ID)
+}
+
+func TestRunAppliesCondition(t *testing.T) {
+	db := newTestDB(t)
+	insertSessions(t, db, 4, 40*24*time.Hour, 0)
+	require.NoError(t, db.Exec("UPDATE sessions SET is_bot = true WHERE id <= 2").Error)
+
+	engine := NewEngine(db, Options{BatchPause: -1})
+	ds := sessionsDataset(30)
+	ds.Condition = "is_bot = true"
+	require.NoError(t, engine.Register(ds))
+
+	run, err := engine.Run(context.Background(), false, "test")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, run.TotalRows)
+	assert.EqualValues(t, 2, count(t, db, "sessions"))
+}
+
+func TestRunRemovesDependentsFirst(t *testing.T) {
+	db := newTestDB(t)
+	insertSessions(t, db, 3, 40*24*time.Hour, 5)
+	insertSessions(t, db, 2, time.Hour, 5)
+
+	engine := NewEngine(db, Options{BatchSize: 2, BatchPause: -1})
+	ds := sessionsDataset(30)
+	ds.Dependents = []Dependent{{Table: "views", ForeignKey: "session_id"}}
+	require.NoError(t, engine.Register(ds))
+
+	dry, err := engine.Run(context.Background(), true, "test")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, dry.Results[0].Rows)
+	assert.EqualValues(t, 15, dry.Results[0].DependentRows)
+
+	run, err := engine.Run(context.Background(), false, "test")
+	require.NoError(t, err)
+	require.Empty(t, run.Results[0].Error)
+	assert.EqualValues(t, 3, run.Results[0].Rows)
+	assert.EqualValues(t, 15, run.Results[0].DependentRows)
+	assert.EqualValues(t, 18, run.TotalRows)
+	assert.EqualValues(t, 2, count(t, db, "sessions"))
+	assert.EqualValues(t, 10, count(t, db, "views"), "page views of kept sessions are kept")
+
+	// Two batches of sessions: the first removes its 10 views in five full
+	// batches and an empty one, the second its 5 views in three
+	assert.Equal(t, 6+1+3+1, run.Results[0].Batches)
+}
+
+func TestDryRunDeletesNothing(t *testing.T) {
+	db := newTestDB(t)
+	insertSessions(t, db, 7, 40*24*time.Hour, 0)
+
+	engine := NewEngine(db, Options{BatchPause: -1})
+	require.NoError(t, engine.Register(sessionsDataset(30)))
+
+	run, err := engine.Run(context.Background(), true, "test")
+	require.NoError(t, err)
+	assert.True(t, run.DryRun)
+	assert.EqualValues(t, 7, run.TotalRows)
+	assert.Zero(t, run.Results[0].Batches)
+	assert.EqualValues(t, 7, count(t, db, "sessions"))
+}
+
+func TestRunSkipsDisabledDatasets(t *testing.T) {
+	db := newTestDB(t)
+	insertSessions(t, db, 3, 400*24*time.Hour, 0)
+
+	for _, days := range []int{0, -1} {
+		t.Run(fmt.Sprint(days), func(t *testing.T) {
+			engine := NewEngine(db, Options{BatchPause: -1})
+			require.NoError(t, engine.Register(sessionsDataset(days)))
+			assert.False(t, engine.Datasets()[0].Enabled)
+
+			run, err := engine.Run(context.Background(), false, "test")
+			require.NoError(t, err)
+			assert.True(t, run.Results[0].Skipped)
+			assert.Nil(t, run.Results[0].Cutoff)
+			assert.EqualValues(t, 3, count(t, db, "sessions"))
+		})
+	}
+}
+
+func TestRunRejectsConcurrentRuns(t *testing.T) {
+	engine := NewEngine(newTestDB(t), Options{})
+	require.NoError(t, engine.Register(sessionsDataset(30)))
+
+	engine.running.Lock()
+	_, err := engine.Run(context.Background(), false, "test")
+	assert.ErrorIs(t, err, ErrRunInProgress)
+	engine.running.Unlock()
+
+	_, err = engine.Run(context.Background(), false, "test")
+	assert.NoError(t, err)
+}
+
+func TestRunRecordsFailures(t *testing.T) {
+	db := newTestDB(t)
+	insertSessions(t, db, 1, 40*24*time.Hour, 1)
+
+	engine := NewEngine(db, Options{BatchPause: -1})
+	// Without its dependents the session cannot be deleted
+	require.NoError(t, engine.Register(sessionsDataset(30)))
+
+	run, err := engine.Run(context.Background(), false, "test")
+	require.NoError(t, err)
+	assert.Equal(t, RunStatusFailed, run.Status)
+	assert.NotEmpty(t, run.Results[0].Error)
+	assert.EqualValues(t, 1, count(t, db, "sessions"))
+}
@@ -0,0 +1,321 @@
+package status
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// badgeCacheTTL controls how long badges and the summary may be cached by
+	// browsers and CDNs. Checks run every 30s so anything longer goes stale.
+	badgeCacheTTL = 60 * time.Second
+
+	badgeColorGreen  = "#4c1"
+	badgeColorYellow = "#dfb317"
+	badgeColorOrange = "#fe7d37"
+	badgeColorRed    = "#e05d44"
+	badgeColorGrey   = "#9f9f9f"
+	badgeColorLabel  = "#555"
+)
+
+// jsonpCallbackPattern restricts JSONP callback names to plain JS identifiers
+// so the endpoint cannot be abused to reflect arbitrary script.
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$.]{0,63}$`)
+
+// Badge describes a shields.io style two-part badge
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// StatusSummary is a compact, embeddable view of the system status
+type StatusSummary struct {
+	Status      string           `json:"status"`
+	Description string           `json:"description"`
+	Uptime      float64          `json:"uptime_percentage"`
+	Services    []ServiceSummary `json:"services"`
+	Incidents   int              `json:"active_incidents"`
+	LastUpdated time.Time        `json:"last_updated"`
+}
+
+// ServiceSummary is the per-service part of StatusSummary
+type ServiceSummary struct {
+	Name   string  `json:"name"`
+	Status string  `json:"status"`
+	Uptime float64 `json:"uptime_percentage"`
+}
+
+// GetStatusSummary builds a StatusSummary from the current system status
+func (s *Service) GetStatusSummary() *StatusSummary {
+	system := s.GetSystemStatus()
+
+	summary := &StatusSummary{
+		Status:      system.Status,
+		Description: describeStatus(system.Status),
+		Uptime:      overallUptime(system.Services),
+		Services:    make([]ServiceSummary, 0, len(system.Services)),
+		Incidents:   len(system.Incidents),
+		LastUpdated: lastChecked(system.Services),
+	}
+
+	for _, svc := range system.Services {
+		summary.Services = append(summary.Services, ServiceSummary{
+			Name:   svc.Name,
+			Status: svc.Status,
+			Uptime: roundUptime(svc.Uptime),
+		})
+	}
+
+	sort.Slice(summary.Services, func(i, j int) bool {
+		return summary.Services[i].Name < summary.Services[j].Name
+	})
+
+	return summary
+}
+
+// BuildSystemBadge builds a badge for the overall system status. When metric
+// is "uptime" the message is the average 24h uptime instead of the status.
+func (s *Service) BuildSystemBadge(label, metric string) Badge {
+	system := s.GetSystemStatus()
+	if label == "" {
+		label = "status"
+	}
+
+	if metric == "uptime" {
+		uptime := overallUptime(system.Services)
+		return Badge{Label: label, Message: formatUptime(uptime), Color: uptimeColor(uptime)}
+	}
+
+	return Badge{Label: label, Message: describeStatus(system.Status), Color: statusColor(system.Status)}
+}
+
+// BuildServiceBadge builds a badge for a single service
+func (s *Service) BuildServiceBadge(name, label, metric string) (Badge, bool) {
+	svc, exists := s.GetServiceStatus(name)
+	if !exists {
+		return Badge{}, false
+	}
+	if label == "" {
+		label = name
+	}
+
+	s.mu.RLock()
+	status, uptime := svc.Status, svc.Uptime
+	s.mu.RUnlock()
+
+	if metric == "uptime" {
+		return Badge{Label: label, Message: formatUptime(uptime), Color: uptimeColor(uptime)}, true
+	}
+
+	return Badge{Label: label, Message: describeStatus(status), Color: statusColor(status)}, true
+}
+
+// RenderSVG renders the badge as a flat shields.io style SVG
+func (b Badge) RenderSVG() []byte {
+	labelWidth := textWidth(b.Label) + 10
+	messageWidth := textWidth(b.Message) + 10
+	totalWidth := labelWidth + messageWidth
+
+	label := html.EscapeString(b.Label)
+	message := html.EscapeString(b.Message)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`, totalWidth, label, message)
+	fmt.Fprintf(&sb, `<title>%s: %s</title>`, label, message)
+	sb.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&sb, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`, totalWidth)
+	sb.WriteString(`<g clip-path="url(#r)">`)
+	fmt.Fprintf(&sb, `<rect width="%d" height="20" fill="%s"/>`, labelWidth, badgeColorLabel)
+	fmt.Fprintf(&sb, `<rect x="%d" width="%d" height="20" fill="%s"/>`, labelWidth, messageWidth, b.Color)
+	fmt.Fprintf(&sb, `<rect width="%d" height="20" fill="url(#s)"/>`, totalWidth)
+	sb.WriteString(`</g>`)
+	sb.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	fmt.Fprintf(&sb, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, labelWidth/2, label)
+	fmt.Fprintf(&sb, `<text x="%d" y="14">%s</text>`, labelWidth/2, label)
+	fmt.Fprintf(&sb, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, labelWidth+messageWidth/2, message)
+	fmt.Fprintf(&sb, `<text x="%d" y="14">%s</text>`, labelWidth+messageWidth/2, message)
+	sb.WriteString(`</g></svg>`)
+
+	return []byte(sb.String())
+}
+
+// handleSystemBadge serves the overall status badge
+func (s *Service) handleSystemBadge(c *gin.Context) {
+	badge := s.BuildSystemBadge(c.Query("label"), c.Query("metric"))
+	writeCacheable(c, "image/svg+xml; charset=utf-8", badge.RenderSVG())
+}
+
+// handleServiceBadge serves a badge for a single service
+func (s *Service) handleServiceBadge(c *gin.Context) {
+	name := strings.TrimSuffix(c.Param("name"), ".svg")
+
+	badge, exists := s.BuildServiceBadge(name, c.Query("label"), c.Query("metric"))
+	if !exists {
+		badge = Badge{Label: name, Message: "unknown", Color: badgeColorGrey}
+		c.Header("Cache-Control", "no-cache")
+		c.Data(http.StatusNotFound, "image/svg+xml; charset=utf-8", badge.RenderSVG())
+		return
+	}
+
+	writeCacheable(c, "image/svg+xml; charset=utf-8", badge.RenderSVG())
+}
+
+// handleStatusSummary serves the embeddable JSON summary. A valid callback
+// query parameter switches the response to JSON-P for legacy widgets.
+func (s *Service) handleStatusSummary(c *gin.Context) {
+	data, err := json.Marshal(s.GetStatusSummary())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Status summary temporarily unavailable"})
+		return
+	}
+
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	if callback := c.Query("callback"); callback != "" {
+		if !jsonpCallbackPattern.MatchString(callback) {
+			c.JSON(400, gin.H{"error": "Invalid callback name"})
+			return
+		}
+		body := fmt.Sprintf("/**/ typeof %s === 'function' && %s(%s);", callback, callback, data)
+		writeCacheable(c, "application/javascript; charset=utf-8", []byte(body))
+		return
+	}
+
+	writeCacheable(c, "application/json; charset=utf-8", data)
+}
+
+// writeCacheable writes body with a short public cache TTL and a strong ETag,
+// answering conditional requests with 304 Not Modified.
+func writeCacheable(c *gin.Context, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(badgeCacheTTL.Seconds())))
+	c.Header("ETag", etag)
+
+	if match := c.GetHeader("If-None-Match"); match != "" && etagMatches(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// lastChecked returns when the most recent health check ran. The summary
+// reports it instead of the system status's LastUpdated, which is the time
+// of the request, so its ETag only changes when a check does.
+func lastChecked(services []ServiceStatus) time.Time {
+	var latest time.Time
+	for _, svc := range services {
+		if svc.LastChecked.After(latest) {
+			latest = svc.LastChecked
+		}
+	}
+	return latest
+}
+
+// overallUptime averages the uptime of all services
+func overallUptime(services []ServiceStatus) float64 {
+	if len(services) == 0 {
+		return 100.0
+	}
+
+	var total float64
+	for _, svc := range services {
+		total += svc.Uptime
+	}
+
+	return roundUptime(total / float64(len(services)))
+}
+
+func roundUptime(uptime float64) float64 {
+	return float64(int(uptime*100+0.5)) / 100
+}
+
+func formatUptime(uptime float64) string {
+	if uptime >= 100 {
+		return "100%"
+	}
+	return fmt.Sprintf("%.2f%%", uptime)
+}
+
+func describeStatus(status string) string {
+	switch status {
+	case "operational":
+		return "operational"
+	case "degraded":
+		return "degraded"
+	case "partial_outage":
+		return "partial outage"
+	case "major_outage", "down":
+		return "major outage"
+	default:
+		return "unknown"
+	}
+}
+
+func statusColor(status string) string {
+	switch status {
+	case "operational":
+		return badgeColorGreen
+	case "degraded", "partial_outage":
+		return badgeColorYellow
+	case "major_outage", "down":
+		return badgeColorRed
+	default:
+		return badgeColorGrey
+	}
+}
+
+func uptimeColor(uptime float64) string {
+	switch {
+	case uptime >= 99.9:
+		return badgeColorGreen
+	case uptime >= 99.0:
+		return badgeColorYellow
+	case uptime >= 95.0:
+		return badgeColorOrange
+	default:
+		return badgeColorRed
+	}
+}
+
+// textWidth approximates the rendered width of s in 11px Verdana
+func textWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("ijlt.,:;!|'", r):
+			width += 4
+		case strings.ContainsRune("mwMW%", r):
+			width += 10
+		case r >= 'A' && r <= 'Z':
+			width += 8
+		default:
+			width += 7
+		}
+	}
+	return width
+}
@@ -0,0 +1,20 @@
+package status
+
+import "github.com/JadenRazo/Project-Website/backend/internal/retention"
+
+// historyRetentionDays keeps three months of health checks for investigating
+// past incidents
+const historyRetentionDays = 90
+
+// RetentionDatasets returns the status datasets and their retention rules
+func RetentionDatasets() []retention.Dataset {
+	return []retention.Dataset{
+		{
+			Name:        "status.history",
+			Description: "Service health check results",
+			Table:       "status_history",
+			TimeColumn:  "checked_at",
+			Retention:   retention.Fixed(retention.Days(historyRetentionDays)),
+		},
+	}
+}
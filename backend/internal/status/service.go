@@ -377,6 +377,10 @@ func (s *Service) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/metrics/week", s.handleMetricsWeek)
 	router.GET("/metrics/month", s.handleMetricsMonth)
 	router.GET("/metrics/latest", s.handleLatestMetrics)
+
+	router.GET("/badge.svg", s.handleSystemBadge)
+	router.GET("/badge/:name", s.handleServiceBadge)
+	router.GET("/summary", s.handleStatusSummary)
 }
 
 func (s *Service) handleGetSystemStatus(c *gin.Context) {
@@ -0,0 +1,20 @@
+package urlshortener
+
+import "github.com/JadenRazo/Project-Website/backend/internal/retention"
+
+// clickRetentionDays bounds how long raw click analytics, including client IP
+// addresses, are kept
+const clickRetentionDays = 365
+
+// RetentionDatasets returns the URL shortener datasets and their retention rules
+func RetentionDatasets() []retention.Dataset {
+	return []retention.Dataset{
+		{
+			Name:        "urlshortener.clicks",
+			Description: "Short link click analytics",
+			Table:       "url_clicks",
+			TimeColumn:  "clicked_at",
+			Retention:   retention.Fixed(retention.Days(clickRetentionDays)),
+		},
+	}
+}
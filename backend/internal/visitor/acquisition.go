@@ -0,0 +1,193 @@
+package visitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// maxAcquisitionRows bounds the source and campaign lists in a report
+const maxAcquisitionRows = 25
+
+// AcquisitionStat counts visits for a channel or source
+type AcquisitionStat struct {
+	Name    string  `json:"name"`
+	Channel string  `json:"channel,omitempty"`
+	Visits  int     `json:"visits"`
+	Share   float64 `json:"share"`
+}
+
+// CampaignStat counts visits for a UTM campaign
+type CampaignStat struct {
+	Campaign string `json:"campaign"`
+	Source   string `json:"source"`
+	Medium   string `json:"medium"`
+	Visits   int    `json:"visits"`
+}
+
+// ShortLinkStat counts clicks on a single short link
+type ShortLinkStat struct {
+	ShortCode string `json:"shortCode"`
+	Title     string `json:"title"`
+	Clicks    int    `json:"clicks"`
+}
+
+// AcquisitionReport breaks down where visits came from over a period. Page
+// view sessions and short-link clicks are both counted as visits.
+type AcquisitionReport struct {
+	Period      string            `json:"period"`
+	TotalVisits int               `json:"totalVisits"`
+	Channels    []AcquisitionStat `json:"channels"`
+	Sources     []AcquisitionStat `json:"sources"`
+	Campaigns   []CampaignStat    `json:"campaigns"`
+	ShortLinks  []ShortLinkStat   `json:"shortLinks"`
+}
+
+// GetAcquisitionReport builds the acquisition report for a period from the
+// attributed landing page views and the URL shortener click log
+func (s *Service) GetAcquisitionReport(ctx context.Context, period string) (*AcquisitionReport, error) {
+	since := periodStart(period)
+
+	var landings []struct {
+		Channel        string
+		ReferrerDomain string
+		UTMSource      string
+		UTMMedium      string
+		UTMCampaign    string
+		Visits         int
+	}
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT
+			pv.channel,
+			COALESCE(pv.referrer_domain, '') AS referrer_domain,
+			COALESCE(pv.utm_source, '') AS utm_source,
+			COALESCE(pv.utm_medium, '') AS utm_medium,
+			COALESCE(pv.utm_campaign, '') AS utm_campaign,
+			COUNT(*) AS visits
+		FROM page_views pv
+		JOIN visitor_sessions vs ON vs.id = pv.session_id
+		WHERE pv.created_at >= ?
+		AND pv.channel <> ''
+		AND vs.is_bot = false
+		GROUP BY 1, 2, 3, 4, 5
+	`, since).Scan(&landings).Error; err != nil {
+		return nil, fmt.Errorf("failed to query landing page views: %w", err)
+	}
+
+	var clicks []struct {
+		ShortCode string
+		Title     string
+		Referer   string
+		Clicks    int
+	}
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT
+			su.short_code,
+			COALESCE(su.title, '') AS title,
+			COALESCE(uc.referer, '') AS referer,
+			COUNT(*) AS clicks
+		FROM url_clicks uc
+		JOIN shortened_urls su ON su.id = uc.short_url_id
+		WHERE uc.clicked_at >= ?
+		AND uc.is_bot = false
+		GROUP BY 1, 2, 3
+	`, since).Scan(&clicks).Error; err != nil {
+		return nil, fmt.Errorf("failed to query short link clicks: %w", err)
+	}
+
+	report := &AcquisitionReport{Period: period}
+	channels := make(map[string]int)
+	sources := make(map[string]*AcquisitionStat)
+	campaigns := make(map[CampaignStat]int)
+
+	addSource := func(name, channel string, visits int) {
+		stat, ok := sources[name]
+		if !ok {
+			stat = &AcquisitionStat{Name: name, Channel: channel}
+			sources[name] = stat
+		}
+		stat.Visits += visits
+	}
+
+	for _, l := range landings {
+		report.TotalVisits += l.Visits
+		channels[l.Channel] += l.Visits
+
+		source := l.UTMSource
+		if source == "" {
+			source = l.ReferrerDomain
+		}
+		if source == "" {
+			source = "(direct)"
+		}
+		addSource(source, l.Channel, l.Visits)
+
+		if l.UTMCampaign != "" {
+			campaigns[CampaignStat{Campaign: l.UTMCampaign, Source: l.UTMSource, Medium: l.UTMMedium}] += l.Visits
+		}
+	}
+
+	shortLinks := make(map[string]*ShortLinkStat)
+	for _, c := range clicks {
+		report.TotalVisits += c.Clicks
+		channels[clickChannel(c.Referer)] += c.Clicks
+		addSource(SourceShortLink, "", c.Clicks)
+
+		link, ok := shortLinks[c.ShortCode]
+		if !ok {
+			link = &ShortLinkStat{ShortCode: c.ShortCode, Title: c.Title}
+			shortLinks[c.ShortCode] = link
+		}
+		link.Clicks += c.Clicks
+	}
+
+	for name, visits := range channels {
+		report.Channels = append(report.Channels, AcquisitionStat{Name: name, Visits: visits})
+	}
+	for _, stat := range sources {
+		report.Sources = append(report.Sources, *stat)
+	}
+	for campaign, visits := range campaigns {
+		campaign.Visits = visits
+		report.Campaigns = append(report.Campaigns, campaign)
+	}
+	for _, link := range shortLinks {
+		report.ShortLinks = append(report.ShortLinks, *link)
+	}
+
+	sortAcquisitionStats(report.Channels, report.TotalVisits)
+	sortAcquisitionStats(report.Sources, report.TotalVisits)
+	sort.Slice(report.Campaigns, func(i, j int) bool {
+		return report.Campaigns[i].Visits > report.Campaigns[j].Visits
+	})
+	sort.Slice(report.ShortLinks, func(i, j int) bool {
+		return report.ShortLinks[i].Clicks > report.ShortLinks[j].Clicks
+	})
+
+	if len(report.Sources) > maxAcquisitionRows {
+		report.Sources = report.Sources[:maxAcquisitionRows]
+	}
+	if len(report.Campaigns) > maxAcquisitionRows {
+		report.Campaigns = report.Campaigns[:maxAcquisitionRows]
+	}
+	if len(report.ShortLinks) > maxAcquisitionRows {
+		report.ShortLinks = report.ShortLinks[:maxAcquisitionRows]
+	}
+
+	return report, nil
+}
+
+// sortAcquisitionStats orders stats by visits and fills in their share of total
+func sortAcquisitionStats(stats []AcquisitionStat, total int) {
+	for i := range stats {
+		if total > 0 {
+			stats[i].Share = float64(stats[i].Visits) / float64(total) * 100
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Visits != stats[j].Visits {
+			return stats[i].Visits > stats[j].Visits
+		}
+		return stats[i].Name < stats[j].Name
+	})
+}
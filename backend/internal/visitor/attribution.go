@@ -0,0 +1,180 @@
+package visitor
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Acquisition channels
+const (
+	ChannelSearch   = "search"
+	ChannelSocial   = "social"
+	ChannelEmail    = "email"
+	ChannelDirect   = "direct"
+	ChannelReferral = "referral"
+)
+
+// SourceShortLink is the acquisition source used for URL shortener clicks
+const SourceShortLink = "short_link"
+
+// maxUTMValueLen matches the column size of the utm_* fields
+const maxUTMValueLen = 255
+
+//go:embed referrers.json
+var referrerDatabaseJSON []byte
+
+// referrerEntry maps a host pattern to a channel. Patterns are either a domain
+// which also matches its subdomains, or "name.*" which matches name under any
+// TLD (google.com, google.co.uk, ...).
+type referrerEntry struct {
+	pattern string
+	channel string
+}
+
+var referrerDatabase = loadReferrerDatabase(referrerDatabaseJSON)
+
+func loadReferrerDatabase(data []byte) []referrerEntry {
+	var raw map[string][]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		panic("visitor: invalid embedded referrer database: " + err.Error())
+	}
+
+	var entries []referrerEntry
+	for channel, patterns := range raw {
+		for _, pattern := range patterns {
+			entries = append(entries, referrerEntry{pattern: strings.ToLower(pattern), channel: channel})
+		}
+	}
+	return entries
+}
+
+// Attribution describes where a session came from
+type Attribution struct {
+	ReferrerDomain string
+	Channel        string
+	UTMSource      string
+	UTMMedium      string
+	UTMCampaign    string
+	UTMTerm        string
+	UTMContent     string
+}
+
+// ParseAttribution extracts UTM parameters from the landing URL query and
+// classifies the session into a channel. siteHost is the host of the site
+// itself so internal navigation is not counted as a referral.
+func ParseAttribution(query url.Values, referrer, siteHost string) Attribution {
+	a := Attribution{
+		ReferrerDomain: normalizeHost(referrerHost(referrer)),
+		UTMSource:      utmValue(query, "utm_source"),
+		UTMMedium:      utmValue(query, "utm_medium"),
+		UTMCampaign:    utmValue(query, "utm_campaign"),
+		UTMTerm:        utmValue(query, "utm_term"),
+		UTMContent:     utmValue(query, "utm_content"),
+	}
+
+	if a.ReferrerDomain != "" && a.ReferrerDomain == normalizeHost(siteHost) {
+		a.ReferrerDomain = ""
+	}
+
+	a.Channel = classifyChannel(a)
+	return a
+}
+
+// classifyChannel prefers an explicit utm_medium, then the referrer database,
+// then utm_source, falling back to referral or direct.
+func classifyChannel(a Attribution) string {
+	if channel := channelForMedium(a.UTMMedium); channel != "" {
+		return channel
+	}
+	if a.ReferrerDomain != "" {
+		if channel := ClassifyReferrer(a.ReferrerDomain); channel != "" {
+			return channel
+		}
+		return ChannelReferral
+	}
+	if a.UTMSource != "" {
+		if channel := ClassifyReferrer(a.UTMSource); channel != "" {
+			return channel
+		}
+		return ChannelReferral
+	}
+	return ChannelDirect
+}
+
+// clickChannel classifies a short link click by its referer, which is
+// stored as the full URL
+func clickChannel(referer string) string {
+	return classifyChannel(Attribution{ReferrerDomain: normalizeHost(referrerHost(referer))})
+}
+
+// ClassifyReferrer looks a referrer host up in the embedded referrer database.
+// It returns an empty string for unknown hosts. The longest matching pattern
+// wins so mail.google.com is email rather than search.
+func ClassifyReferrer(host string) string {
+	host = normalizeHost(host)
+	if host == "" {
+		return ""
+	}
+
+	channel, best := "", 0
+	for _, entry := range referrerDatabase {
+		if len(entry.pattern) > best && hostMatches(entry.pattern, host) {
+			channel, best = entry.channel, len(entry.pattern)
+		}
+	}
+	return channel
+}
+
+func hostMatches(pattern, host string) bool {
+	if name, ok := strings.CutSuffix(pattern, ".*"); ok {
+		// Bare source names such as utm_source=google match too
+		return host == name || strings.HasPrefix(host, name+".") || strings.Contains(host, "."+name+".")
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+func channelForMedium(medium string) string {
+	switch strings.ToLower(medium) {
+	case "email", "e-mail", "newsletter", "mail":
+		return ChannelEmail
+	case "social", "social-media", "social_media", "social-network", "sm":
+		return ChannelSocial
+	case "cpc", "ppc", "paid", "paidsearch", "paid_search", "organic", "search":
+		return ChannelSearch
+	case "referral", "link":
+		return ChannelReferral
+	default:
+		return ""
+	}
+}
+
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// normalizeHost lowercases a host and strips the port and a leading www.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+func utmValue(query url.Values, key string) string {
+	value := strings.TrimSpace(query.Get(key))
+	if len(value) > maxUTMValueLen {
+		value = value[:maxUTMValueLen]
+	}
+	return value
+}
@@ -0,0 +1,42 @@
+package visitor
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyChannelFromRefererURL(t *testing.T) {
+	tests := []struct {
+		referer string
+		channel string
+	}{
+		{"https://www.google.com/", ChannelSearch},
+		{"https://www.google.co.uk/search?q=portfolio", ChannelSearch},
+		{"https://duckduckgo.com/?q=go+developer", ChannelSearch},
+		{"https://t.co/AbCdEf123", ChannelSocial},
+		{"https://l.facebook.com/l.php?u=https%3A%2F%2Fexample.com", ChannelSocial},
+		{"https://www.reddit.com/r/golang/comments/abc/", ChannelSocial},
+		{"https://mail.google.com/mail/u/0/", ChannelEmail},
+		{"https://blog.example.org:8443/posts/1", ChannelReferral},
+		{"", ChannelDirect},
+		{"not a url", ChannelDirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.referer, func(t *testing.T) {
+			assert.Equal(t, tt.channel, clickChannel(tt.referer), "short link click")
+			assert.Equal(t, tt.channel, ParseAttribution(url.Values{}, tt.referer, "example.com").Channel, "page view")
+		})
+	}
+}
+
+func TestClassifyChannelPrefersUTMMedium(t *testing.T) {
+	a := ParseAttribution(url.Values{"utm_medium": {"email"}}, "https://www.google.com/", "example.com")
+	assert.Equal(t, ChannelEmail, a.Channel)
+	assert.Equal(t, "google.com", a.ReferrerDomain)
+
+	a = ParseAttribution(url.Values{}, "https://example.com/about", "www.example.com")
+	assert.Equal(t, ChannelDirect, a.Channel, "internal navigation is not a referral")
+}
@@ -5,20 +5,26 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ErrRetentionUnavailable is returned when no retention engine is set
+var ErrRetentionUnavailable = errors.New("retention engine not configured")
+
 type ComplianceService struct {
-	db     *gorm.DB
-	config *ConfigService
+	db        *gorm.DB
+	config    *ConfigService
+	retention *retention.Engine
 }
 
 func NewComplianceService(db *gorm.DB, config *ConfigService) *ComplianceService {
@@ -290,46 +296,21 @@ func (cs *ComplianceService) ValidateProcessingBasis(ctx context.Context, sessio
 	}
 }
 
-// ApplyRetentionPolicy deletes data based on retention configuration
-func (cs *ComplianceService) ApplyRetentionPolicy(ctx context.Context) error {
-	config := cs.config.GetConfig()
-
-	if !config.Retention.EnableAutoDelete {
-		return nil
-	}
-
-	tx := cs.db.Begin()
-	defer tx.Rollback()
-
-	now := time.Now()
-
-	// Delete old sessions
-	sessionCutoff := now.AddDate(0, 0, -config.Retention.SessionDataDays)
-	if err := tx.Where("created_at < ?", sessionCutoff).Delete(&VisitorSession{}).Error; err != nil {
-		return err
-	}
-
-	// Delete old page views
-	pageViewCutoff := now.AddDate(0, 0, -config.Retention.PageViewDataDays)
-	if err := tx.Where("created_at < ?", pageViewCutoff).Delete(&PageView{}).Error; err != nil {
-		return err
-	}
-
-	// Delete old consent records
-	consentCutoff := now.AddDate(0, 0, -config.Retention.ConsentRecordDays)
-	if err := tx.Where("created_at < ?", consentCutoff).Delete(&PrivacyConsent{}).Error; err != nil {
-		return err
-	}
+// SetRetentionEngine sets the shared retention engine, so policy runs
+// requested here take the same run lock as the scheduled task and devpanel
+func (cs *ComplianceService) SetRetentionEngine(engine *retention.Engine) {
+	cs.retention = engine
+}
 
-	// Delete inactive sessions
-	if config.Retention.DeleteInactiveAfter > 0 {
-		inactiveCutoff := now.AddDate(0, 0, -config.Retention.DeleteInactiveAfter)
-		if err := tx.Where("last_seen_at < ?", inactiveCutoff).Delete(&VisitorSession{}).Error; err != nil {
-			return err
-		}
+// ApplyRetentionPolicy deletes expired data in batches through the shared
+// retention engine, which records an audit entry for the run
+func (cs *ComplianceService) ApplyRetentionPolicy(ctx context.Context) error {
+	if cs.retention == nil {
+		return ErrRetentionUnavailable
 	}
 
-	return tx.Commit().Error
+	_, err := cs.retention.Run(ctx, false, "visitor.compliance")
+	return err
 }
 
 // Helper function
@@ -378,7 +359,10 @@ type VisitorEvent struct {
 	ID          uuid.UUID              `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
 	SessionHash string                 `gorm:"type:varchar(64);index"`
 	EventType   string                 `gorm:"type:varchar(100)"`
-	EventData   map[string]interface{} `gorm:"type:jsonb"`
+	Category    string                 `gorm:"type:varchar(50)"`
+	Value       *float64               `gorm:"type:double precision"`
+	Path        string                 `gorm:"type:varchar(255)"`
+	EventData   map[string]interface{} `gorm:"serializer:json;type:jsonb"`
 	CreatedAt   time.Time
 }
 
@@ -386,7 +370,7 @@ type ConsentAuditLog struct {
 	ID          uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()"`
 	SessionHash string          `gorm:"type:varchar(64);index"`
 	Action      string          `gorm:"type:varchar(100)"`
-	Details     map[string]bool `gorm:"type:jsonb"`
+	Details     map[string]bool `gorm:"serializer:json;type:jsonb"`
 	Timestamp   time.Time
 	IPAddress   string          `gorm:"type:varchar(64)"`
 	UserAgent   string          `gorm:"type:text"`
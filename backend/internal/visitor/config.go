@@ -2,6 +2,7 @@ package visitor
 
 import (
 	"encoding/json"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -95,6 +96,7 @@ type ConsentConfig struct {
 
 type ConfigService struct {
 	db     *gorm.DB
+	mu     sync.RWMutex
 	config *PrivacyConfig
 }
 
@@ -119,7 +121,9 @@ func (cs *ConfigService) LoadOrCreateDefault() error {
 		return err
 	}
 
+	cs.mu.Lock()
 	cs.config = &config
+	cs.mu.Unlock()
 	return nil
 }
 
@@ -198,6 +202,20 @@ func (cs *ConfigService) GetDefaultConfig() PrivacyConfig {
 }
 
 func (cs *ConfigService) GetConfig() *PrivacyConfig {
+	cs.mu.RLock()
+	config := cs.config
+	cs.mu.RUnlock()
+	if config != nil {
+		return config
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.config == nil {
+		// Fall back to defaults when the stored config could not be loaded
+		defaults := cs.GetDefaultConfig()
+		cs.config = &defaults
+	}
 	return cs.config
 }
 
@@ -206,71 +224,76 @@ func (cs *ConfigService) UpdateConfig(config *PrivacyConfig) error {
 	if err := cs.db.Save(config).Error; err != nil {
 		return err
 	}
+	cs.mu.Lock()
 	cs.config = config
+	cs.mu.Unlock()
 	return nil
 }
 
 func (cs *ConfigService) ShouldCollect(dataType string) bool {
-	if !cs.config.EnableTracking {
+	config := cs.GetConfig()
+	if !config.EnableTracking {
 		return false
 	}
 
 	switch dataType {
 	case "cookies":
-		return cs.config.DataCollection.CollectCookies
+		return config.DataCollection.CollectCookies
 	case "ip":
-		return cs.config.DataCollection.CollectIPAddresses
+		return config.DataCollection.CollectIPAddresses
 	case "userAgent":
-		return cs.config.DataCollection.CollectUserAgents
+		return config.DataCollection.CollectUserAgents
 	case "referrer":
-		return cs.config.DataCollection.CollectReferrers
+		return config.DataCollection.CollectReferrers
 	case "geographic":
-		return cs.config.DataCollection.CollectGeographicData
+		return config.DataCollection.CollectGeographicData
 	case "session":
-		return cs.config.DataCollection.CollectSessionData
+		return config.DataCollection.CollectSessionData
 	case "event":
-		return cs.config.DataCollection.CollectEventData
+		return config.DataCollection.CollectEventData
 	case "device":
-		return cs.config.DataCollection.CollectDeviceInfo
+		return config.DataCollection.CollectDeviceInfo
 	case "browser":
-		return cs.config.DataCollection.CollectBrowserInfo
+		return config.DataCollection.CollectBrowserInfo
 	default:
 		return false
 	}
 }
 
 func (cs *ConfigService) GetRetentionDays(dataType string) int {
+	config := cs.GetConfig()
 	switch dataType {
 	case "session":
-		return cs.config.Retention.SessionDataDays
+		return config.Retention.SessionDataDays
 	case "pageView":
-		return cs.config.Retention.PageViewDataDays
+		return config.Retention.PageViewDataDays
 	case "aggregated":
-		return cs.config.Retention.AggregatedDataDays
+		return config.Retention.AggregatedDataDays
 	case "consent":
-		return cs.config.Retention.ConsentRecordDays
+		return config.Retention.ConsentRecordDays
 	default:
 		return 30
 	}
 }
 
 func (cs *ConfigService) IsComplianceEnabled(regulation string) bool {
+	config := cs.GetConfig()
 	switch regulation {
 	case "GDPR":
-		return cs.config.Compliance.GDPR.Enabled
+		return config.Compliance.GDPR.Enabled
 	case "CCPA":
-		return cs.config.Compliance.CCPA.Enabled
+		return config.Compliance.CCPA.Enabled
 	case "LGPD":
-		return cs.config.Compliance.LGPD.Enabled
+		return config.Compliance.LGPD.Enabled
 	case "PIPEDA":
-		return cs.config.Compliance.PIPEDA.Enabled
+		return config.Compliance.PIPEDA.Enabled
 	default:
 		return false
 	}
 }
 
 func (cs *ConfigService) ExportConfig() ([]byte, error) {
-	return json.MarshalIndent(cs.config, "", "  ")
+	return json.MarshalIndent(cs.GetConfig(), "", "  ")
 }
 
 func (cs *ConfigService) ImportConfig(data []byte) error {
@@ -0,0 +1,40 @@
+package visitor
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConfigServiceWithoutStoredConfig checks that a service whose config
+// failed to load answers with the defaults instead of panicking
+func TestConfigServiceWithoutStoredConfig(t *testing.T) {
+	cs := &ConfigService{}
+	defaults := cs.GetDefaultConfig()
+
+	assert.Equal(t, defaults.DataCollection.CollectEventData, cs.ShouldCollect("event"))
+	assert.Equal(t, defaults.Retention.SessionDataDays, cs.GetRetentionDays("session"))
+	assert.Equal(t, defaults.Compliance.GDPR.Enabled, cs.IsComplianceEnabled("GDPR"))
+}
+
+// TestConfigServiceConcurrentFallback checks that concurrent readers agree
+// on the fallback config; run with -race to catch unguarded access
+func TestConfigServiceConcurrentFallback(t *testing.T) {
+	cs := &ConfigService{}
+
+	configs := make([]*PrivacyConfig, 8)
+	var wg sync.WaitGroup
+	for i := range configs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			configs[i] = cs.GetConfig()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, config := range configs {
+		assert.Same(t, configs[0], config)
+	}
+}
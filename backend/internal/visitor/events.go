@@ -0,0 +1,208 @@
+package visitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Custom event schema limits
+const (
+	maxEventProperties     = 20
+	maxEventPropertyKeyLen = 40
+	maxEventStringValueLen = 255
+	maxEventCategoryLen    = 50
+	maxEventPathLen        = 255
+)
+
+var (
+	eventNamePattern   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:-]{0,63}$`)
+	propertyKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+	ErrInvalidEvent      = errors.New("invalid event")
+	ErrEventNotPermitted = errors.New("event tracking not permitted for this session")
+)
+
+// EventRequest is a custom event submitted by the frontend
+type EventRequest struct {
+	Name       string                 `json:"name"`
+	Category   string                 `json:"category"`
+	Value      *float64               `json:"value"`
+	Path       string                 `json:"path"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// EventSummary aggregates a single event name over a period
+type EventSummary struct {
+	Name           string  `json:"name"`
+	Category       string  `json:"category"`
+	Count          int     `json:"count"`
+	UniqueSessions int     `json:"uniqueSessions"`
+	TotalValue     float64 `json:"totalValue"`
+	AvgValue       float64 `json:"avgValue"`
+}
+
+// EventTimelinePoint is an event count for a single time bucket
+type EventTimelinePoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Count     int       `json:"count"`
+	Value     float64   `json:"value"`
+}
+
+// Validate normalises the request and enforces the event schema limits
+func (e *EventRequest) Validate() error {
+	e.Name = strings.TrimSpace(e.Name)
+	e.Category = strings.TrimSpace(e.Category)
+
+	if !eventNamePattern.MatchString(e.Name) {
+		return fmt.Errorf("%w: name must be 1-64 characters of letters, digits, _ . : -", ErrInvalidEvent)
+	}
+	if len(e.Category) > maxEventCategoryLen {
+		return fmt.Errorf("%w: category exceeds %d characters", ErrInvalidEvent, maxEventCategoryLen)
+	}
+	if len(e.Path) > maxEventPathLen {
+		return fmt.Errorf("%w: path exceeds %d characters", ErrInvalidEvent, maxEventPathLen)
+	}
+	if e.Value != nil && (math.IsNaN(*e.Value) || math.IsInf(*e.Value, 0)) {
+		return fmt.Errorf("%w: value must be a finite number", ErrInvalidEvent)
+	}
+
+	return validateEventProperties(e.Properties)
+}
+
+// validateEventProperties allows a flat map of scalar values only
+func validateEventProperties(props map[string]interface{}) error {
+	if len(props) > maxEventProperties {
+		return fmt.Errorf("%w: at most %d properties allowed", ErrInvalidEvent, maxEventProperties)
+	}
+
+	for key, value := range props {
+		if len(key) > maxEventPropertyKeyLen || !propertyKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: invalid property key %q", ErrInvalidEvent, key)
+		}
+
+		switch v := value.(type) {
+		case string:
+			if len(v) > maxEventStringValueLen {
+				return fmt.Errorf("%w: property %q exceeds %d characters", ErrInvalidEvent, key, maxEventStringValueLen)
+			}
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("%w: property %q must be a finite number", ErrInvalidEvent, key)
+			}
+		case bool, nil:
+		default:
+			return fmt.Errorf("%w: property %q must be a string, number or boolean", ErrInvalidEvent, key)
+		}
+	}
+
+	return nil
+}
+
+// TrackEvent records a custom event for the current session. Events are only
+// stored when event collection is enabled and there is a valid processing
+// basis for analytics.
+func (s *Service) TrackEvent(ctx context.Context, r *http.Request, req EventRequest) error {
+	if !s.config.EnableTracking || !s.privacy.ShouldCollect("event") {
+		return nil
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	session, _, err := s.getOrCreateSession(ctx, r)
+	if err != nil {
+		return fmt.Errorf("failed to get/create session: %w", err)
+	}
+
+	if session.IsBot {
+		return nil
+	}
+
+	if !s.analyticsPermitted(ctx, session) {
+		return ErrEventNotPermitted
+	}
+
+	event := &VisitorEvent{
+		SessionHash: session.SessionHash,
+		EventType:   req.Name,
+		Category:    req.Category,
+		Value:       req.Value,
+		Path:        req.Path,
+		EventData:   req.Properties,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.db.WithContext(ctx).Create(event).Error; err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+
+	return nil
+}
+
+// GetTopEvents returns the most frequent events for a period
+func (s *Service) GetTopEvents(ctx context.Context, period string, limit int) ([]EventSummary, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+
+	var summaries []EventSummary
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT
+			event_type AS name,
+			COALESCE(MAX(category), '') AS category,
+			COUNT(*) AS count,
+			COUNT(DISTINCT session_hash) AS unique_sessions,
+			COALESCE(SUM(value), 0) AS total_value,
+			COALESCE(AVG(value), 0) AS avg_value
+		FROM visitor_events
+		WHERE created_at >= ?
+		GROUP BY event_type
+		ORDER BY count DESC
+		LIMIT ?
+	`, periodStart(period), limit).Scan(&summaries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top events: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// GetEventTimeline returns event counts bucketed over a period, optionally
+// filtered to a single event name
+func (s *Service) GetEventTimeline(ctx context.Context, period, name string) ([]EventTimelinePoint, error) {
+	intervalUnit := "hour"
+	if period != "1d" && period != "7d" {
+		intervalUnit = "day"
+	}
+
+	query := `
+		SELECT
+			DATE_TRUNC(?, created_at) AS timestamp,
+			COUNT(*) AS count,
+			COALESCE(SUM(value), 0) AS value
+		FROM visitor_events
+		WHERE created_at >= ?`
+	args := []interface{}{intervalUnit, periodStart(period)}
+
+	if name != "" {
+		query += " AND event_type = ?"
+		args = append(args, name)
+	}
+	query += `
+		GROUP BY timestamp
+		ORDER BY timestamp ASC`
+
+	var points []EventTimelinePoint
+	if err := s.db.WithContext(ctx).Raw(query, args...).Scan(&points).Error; err != nil {
+		return nil, fmt.Errorf("failed to query event timeline: %w", err)
+	}
+
+	return points, nil
+}
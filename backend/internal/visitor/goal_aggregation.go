@@ -0,0 +1,212 @@
+package visitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// sessionTouch is a single page view or event in a session timeline
+type sessionTouch struct {
+	kind      string
+	value     string
+	createdAt time.Time
+}
+
+// GoalAggregator precomputes daily goal conversions and funnel step counts
+// from the ordered page views and events of each session.
+type GoalAggregator struct {
+	db         *gorm.DB
+	compliance *ComplianceService
+}
+
+// NewGoalAggregator creates a new goal aggregator
+func NewGoalAggregator(db *gorm.DB, compliance *ComplianceService) *GoalAggregator {
+	return &GoalAggregator{
+		db:         db,
+		compliance: compliance,
+	}
+}
+
+// AggregateDay computes goal conversions and funnel results for the day
+// containing the given time and upserts them.
+func (a *GoalAggregator) AggregateDay(ctx context.Context, day time.Time) error {
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	var goals []Goal
+	if err := a.db.WithContext(ctx).Where("is_active = ?", true).Find(&goals).Error; err != nil {
+		return fmt.Errorf("failed to load goals: %w", err)
+	}
+
+	var funnels []Funnel
+	if err := a.db.WithContext(ctx).Where("is_active = ?", true).Find(&funnels).Error; err != nil {
+		return fmt.Errorf("failed to load funnels: %w", err)
+	}
+
+	if len(goals) == 0 && len(funnels) == 0 {
+		return nil
+	}
+
+	timelines, err := a.loadTimelines(ctx, dayStart, dayEnd)
+	if err != nil {
+		return err
+	}
+
+	for _, goal := range goals {
+		conversion := GoalConversion{
+			GoalID:    goal.ID,
+			Date:      dayStart,
+			Sessions:  len(timelines),
+			CreatedAt: time.Now(),
+		}
+		for _, timeline := range timelines {
+			if timelineReachesGoal(timeline, goal) {
+				conversion.Conversions++
+			}
+		}
+
+		if err := a.db.WithContext(ctx).
+			Where("goal_id = ? AND date = ?", goal.ID, dayStart).
+			Assign(GoalConversion{Sessions: conversion.Sessions, Conversions: conversion.Conversions}).
+			FirstOrCreate(&conversion).Error; err != nil {
+			return fmt.Errorf("failed to store conversions for goal %s: %w", goal.ID, err)
+		}
+	}
+
+	for _, funnel := range funnels {
+		result := FunnelDailyResult{
+			FunnelID:   funnel.ID,
+			Date:       dayStart,
+			Sessions:   len(timelines),
+			StepCounts: make([]int, len(funnel.Steps)),
+			CreatedAt:  time.Now(),
+		}
+		for _, timeline := range timelines {
+			reached := funnelStepsReached(timeline, funnel.Steps)
+			for i := 0; i < reached; i++ {
+				result.StepCounts[i]++
+			}
+		}
+
+		if err := a.db.WithContext(ctx).
+			Where("funnel_id = ? AND date = ?", funnel.ID, dayStart).
+			Assign(FunnelDailyResult{Sessions: result.Sessions, StepCounts: result.StepCounts}).
+			FirstOrCreate(&result).Error; err != nil {
+			return fmt.Errorf("failed to store results for funnel %s: %w", funnel.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// loadTimelines builds time-ordered touch lists per session hash, skipping
+// bots and sessions without a valid processing basis for analytics.
+// Cookieless hashes change daily, so their timelines never span days, and
+// they need no consent.
+func (a *GoalAggregator) loadTimelines(ctx context.Context, start, end time.Time) (map[string][]sessionTouch, error) {
+	var views []struct {
+		SessionHash string
+		Path        string
+		Cookieless  bool
+		CreatedAt   time.Time
+	}
+	if err := a.db.WithContext(ctx).Raw(`
+		SELECT vs.session_hash, pv.path, vs.cookieless, pv.created_at
+		FROM page_views pv
+		JOIN visitor_sessions vs ON vs.id = pv.session_id
+		WHERE pv.created_at >= ? AND pv.created_at < ?
+		AND vs.is_bot = false
+		ORDER BY pv.created_at ASC
+	`, start, end).Scan(&views).Error; err != nil {
+		return nil, fmt.Errorf("failed to load page views: %w", err)
+	}
+
+	var events []struct {
+		SessionHash string
+		EventType   string
+		CreatedAt   time.Time
+	}
+	if err := a.db.WithContext(ctx).
+		Model(&VisitorEvent{}).
+		Select("session_hash, event_type, created_at").
+		Where("created_at >= ? AND created_at < ?", start, end).
+		Order("created_at ASC").
+		Scan(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+
+	allowed := make(map[string]bool)
+	for _, v := range views {
+		if v.Cookieless {
+			allowed[v.SessionHash] = true
+		}
+	}
+	permitted := func(hash string) bool {
+		ok, seen := allowed[hash]
+		if !seen {
+			ok = a.compliance == nil || a.compliance.ValidateProcessingBasis(ctx, hash, "analytics")
+			allowed[hash] = ok
+		}
+		return ok
+	}
+
+	timelines := make(map[string][]sessionTouch)
+	for _, v := range views {
+		if permitted(v.SessionHash) {
+			timelines[v.SessionHash] = append(timelines[v.SessionHash], sessionTouch{kind: GoalTypePath, value: v.Path, createdAt: v.CreatedAt})
+		}
+	}
+	for _, e := range events {
+		if permitted(e.SessionHash) {
+			timelines[e.SessionHash] = append(timelines[e.SessionHash], sessionTouch{kind: GoalTypeEvent, value: e.EventType, createdAt: e.CreatedAt})
+		}
+	}
+
+	for hash := range timelines {
+		timeline := timelines[hash]
+		sort.SliceStable(timeline, func(i, j int) bool {
+			return timeline[i].createdAt.Before(timeline[j].createdAt)
+		})
+	}
+
+	return timelines, nil
+}
+
+// touchMatches reports whether a touch satisfies a goal or step matcher
+func touchMatches(touch sessionTouch, matchType, pattern string) bool {
+	if touch.kind != matchType {
+		return false
+	}
+	if matchType == GoalTypePath {
+		return matchesPathPattern(pattern, touch.value)
+	}
+	return touch.value == pattern
+}
+
+func timelineReachesGoal(timeline []sessionTouch, goal Goal) bool {
+	for _, touch := range timeline {
+		if touchMatches(touch, goal.GoalType, goal.Pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// funnelStepsReached walks the timeline in order and returns how many funnel
+// steps the session completed in sequence.
+func funnelStepsReached(timeline []sessionTouch, steps []FunnelStep) int {
+	reached := 0
+	for _, touch := range timeline {
+		if reached == len(steps) {
+			break
+		}
+		if touchMatches(touch, steps[reached].Type, steps[reached].Pattern) {
+			reached++
+		}
+	}
+	return reached
+}
@@ -0,0 +1,338 @@
+package visitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Goal types
+const (
+	GoalTypePath  = "path"
+	GoalTypeEvent = "event"
+)
+
+// maxFunnelSteps bounds funnel length so reports stay readable
+const maxFunnelSteps = 10
+
+var (
+	ErrInvalidGoal    = errors.New("invalid goal definition")
+	ErrInvalidFunnel  = errors.New("invalid funnel definition")
+	ErrGoalNotFound   = errors.New("goal not found")
+	ErrFunnelNotFound = errors.New("funnel not found")
+)
+
+// Goal is a conversion target matched by page path pattern or custom event name
+type Goal struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Name      string    `gorm:"type:varchar(100);not null" json:"name"`
+	GoalType  string    `gorm:"type:varchar(20);not null;check:goal_type IN ('path','event')" json:"type"`
+	Pattern   string    `gorm:"type:varchar(255);not null" json:"pattern"`
+	IsActive  bool      `gorm:"default:true" json:"isActive"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// FunnelStep is a single ordered step of a funnel
+type FunnelStep struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Pattern string `json:"pattern"`
+}
+
+// Funnel is an ordered sequence of steps evaluated per session
+type Funnel struct {
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Name        string       `gorm:"type:varchar(100);not null" json:"name"`
+	Description string       `gorm:"type:text" json:"description"`
+	Steps       []FunnelStep `gorm:"serializer:json;type:jsonb" json:"steps"`
+	IsActive    bool         `gorm:"default:true" json:"isActive"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	UpdatedAt   time.Time    `json:"updatedAt"`
+}
+
+// GoalConversion holds precomputed daily conversions for a goal
+type GoalConversion struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"-"`
+	GoalID      uuid.UUID `gorm:"type:uuid;not null;index" json:"goalId"`
+	Date        time.Time `gorm:"type:date;not null" json:"date"`
+	Sessions    int       `gorm:"default:0" json:"sessions"`
+	Conversions int       `gorm:"default:0" json:"conversions"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// FunnelDailyResult holds precomputed daily step counts for a funnel
+type FunnelDailyResult struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"-"`
+	FunnelID   uuid.UUID `gorm:"type:uuid;not null;index" json:"funnelId"`
+	Date       time.Time `gorm:"type:date;not null" json:"date"`
+	Sessions   int       `gorm:"default:0" json:"sessions"`
+	StepCounts []int     `gorm:"serializer:json;type:jsonb" json:"stepCounts"`
+	CreatedAt  time.Time `json:"-"`
+}
+
+func (Goal) TableName() string              { return "visitor_goals" }
+func (Funnel) TableName() string            { return "visitor_funnels" }
+func (GoalConversion) TableName() string    { return "visitor_goal_conversions" }
+func (FunnelDailyResult) TableName() string { return "visitor_funnel_results" }
+
+// GoalReport summarises conversions for a goal over a period
+type GoalReport struct {
+	Goal           Goal             `json:"goal"`
+	Sessions       int              `json:"sessions"`
+	Conversions    int              `json:"conversions"`
+	ConversionRate float64          `json:"conversionRate"`
+	Daily          []GoalConversion `json:"daily"`
+}
+
+// FunnelStepReport describes how many sessions reached a funnel step
+type FunnelStepReport struct {
+	Name           string  `json:"name"`
+	Sessions       int     `json:"sessions"`
+	DropOff        int     `json:"dropOff"`
+	DropOffRate    float64 `json:"dropOffRate"`
+	ConversionRate float64 `json:"conversionRate"`
+}
+
+// FunnelReport summarises a funnel over a period
+type FunnelReport struct {
+	Funnel   Funnel             `json:"funnel"`
+	Sessions int                `json:"sessions"`
+	Steps    []FunnelStepReport `json:"steps"`
+}
+
+// Validate checks that a goal definition is usable
+func (g *Goal) Validate() error {
+	g.Name = strings.TrimSpace(g.Name)
+	g.Pattern = strings.TrimSpace(g.Pattern)
+
+	if g.Name == "" || g.Pattern == "" {
+		return ErrInvalidGoal
+	}
+
+	return validateMatcher(g.GoalType, g.Pattern, ErrInvalidGoal)
+}
+
+// Validate checks that a funnel definition is usable
+func (f *Funnel) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" || len(f.Steps) < 2 || len(f.Steps) > maxFunnelSteps {
+		return ErrInvalidFunnel
+	}
+
+	for i := range f.Steps {
+		step := &f.Steps[i]
+		step.Pattern = strings.TrimSpace(step.Pattern)
+		if step.Name == "" {
+			step.Name = step.Pattern
+		}
+		if err := validateMatcher(step.Type, step.Pattern, ErrInvalidFunnel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateMatcher(matchType, pattern string, invalid error) error {
+	switch matchType {
+	case GoalTypePath:
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("%w: path patterns must start with /", invalid)
+		}
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), "/"); err != nil {
+			return fmt.Errorf("%w: %v", invalid, err)
+		}
+	case GoalTypeEvent:
+		if len(pattern) > 100 {
+			return fmt.Errorf("%w: event name too long", invalid)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", invalid, matchType)
+	}
+	return nil
+}
+
+// matchesPathPattern matches a page path against a goal pattern. Patterns use
+// path.Match syntax, and a trailing "/**" matches the prefix and everything
+// below it.
+func matchesPathPattern(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+
+	matched, err := path.Match(pattern, p)
+	return err == nil && matched
+}
+
+// ListGoals returns all configured goals
+func (s *Service) ListGoals(ctx context.Context) ([]Goal, error) {
+	var goals []Goal
+	err := s.db.WithContext(ctx).Order("created_at ASC").Find(&goals).Error
+	return goals, err
+}
+
+// CreateGoal validates and stores a new goal
+func (s *Service) CreateGoal(ctx context.Context, goal *Goal) error {
+	if err := goal.Validate(); err != nil {
+		return err
+	}
+	goal.ID = uuid.New()
+	goal.IsActive = true
+	return s.db.WithContext(ctx).Create(goal).Error
+}
+
+// DeleteGoal removes a goal and its precomputed conversions
+func (s *Service) DeleteGoal(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("goal_id = ?", id).Delete(&GoalConversion{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&Goal{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrGoalNotFound
+		}
+		return nil
+	})
+}
+
+// ListFunnels returns all configured funnels
+func (s *Service) ListFunnels(ctx context.Context) ([]Funnel, error) {
+	var funnels []Funnel
+	err := s.db.WithContext(ctx).Order("created_at ASC").Find(&funnels).Error
+	return funnels, err
+}
+
+// CreateFunnel validates and stores a new funnel
+func (s *Service) CreateFunnel(ctx context.Context, funnel *Funnel) error {
+	if err := funnel.Validate(); err != nil {
+		return err
+	}
+	funnel.ID = uuid.New()
+	funnel.IsActive = true
+	return s.db.WithContext(ctx).Create(funnel).Error
+}
+
+// DeleteFunnel removes a funnel and its precomputed results
+func (s *Service) DeleteFunnel(ctx context.Context, id uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("funnel_id = ?", id).Delete(&FunnelDailyResult{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", id).Delete(&Funnel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrFunnelNotFound
+		}
+		return nil
+	})
+}
+
+// GetGoalReport sums the precomputed conversions for a goal over a period
+func (s *Service) GetGoalReport(ctx context.Context, id uuid.UUID, period string) (*GoalReport, error) {
+	var goal Goal
+	if err := s.db.WithContext(ctx).First(&goal, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGoalNotFound
+		}
+		return nil, err
+	}
+
+	report := &GoalReport{Goal: goal}
+	if err := s.db.WithContext(ctx).
+		Where("goal_id = ? AND date >= ?", id, periodStart(period)).
+		Order("date ASC").
+		Find(&report.Daily).Error; err != nil {
+		return nil, fmt.Errorf("failed to query goal conversions: %w", err)
+	}
+
+	for _, day := range report.Daily {
+		report.Sessions += day.Sessions
+		report.Conversions += day.Conversions
+	}
+	if report.Sessions > 0 {
+		report.ConversionRate = float64(report.Conversions) / float64(report.Sessions) * 100
+	}
+
+	return report, nil
+}
+
+// GetFunnelReport sums the precomputed step counts for a funnel over a period
+func (s *Service) GetFunnelReport(ctx context.Context, id uuid.UUID, period string) (*FunnelReport, error) {
+	var funnel Funnel
+	if err := s.db.WithContext(ctx).First(&funnel, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFunnelNotFound
+		}
+		return nil, err
+	}
+
+	var results []FunnelDailyResult
+	if err := s.db.WithContext(ctx).
+		Where("funnel_id = ? AND date >= ?", id, periodStart(period)).
+		Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query funnel results: %w", err)
+	}
+
+	totals := make([]int, len(funnel.Steps))
+	report := &FunnelReport{Funnel: funnel}
+	for _, day := range results {
+		report.Sessions += day.Sessions
+		for i := 0; i < len(totals) && i < len(day.StepCounts); i++ {
+			totals[i] += day.StepCounts[i]
+		}
+	}
+
+	report.Steps = buildFunnelSteps(funnel.Steps, totals)
+	return report, nil
+}
+
+// buildFunnelSteps turns raw per-step session counts into drop-off figures
+func buildFunnelSteps(steps []FunnelStep, counts []int) []FunnelStepReport {
+	reports := make([]FunnelStepReport, len(steps))
+	for i, step := range steps {
+		reports[i] = FunnelStepReport{Name: step.Name, Sessions: counts[i]}
+
+		if i > 0 {
+			prev := counts[i-1]
+			reports[i].DropOff = prev - counts[i]
+			if prev > 0 {
+				reports[i].DropOffRate = float64(prev-counts[i]) / float64(prev) * 100
+			}
+		}
+		if counts[0] > 0 {
+			reports[i].ConversionRate = float64(counts[i]) / float64(counts[0]) * 100
+		}
+	}
+	return reports
+}
+
+// periodStart converts a report period such as "7d" into its start date
+func periodStart(period string) time.Time {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case "1d":
+		return today
+	case "7d":
+		return today.AddDate(0, 0, -7)
+	case "90d":
+		return today.AddDate(0, 0, -90)
+	case "1y":
+		return today.AddDate(-1, 0, 0)
+	default:
+		return today.AddDate(0, 0, -30)
+	}
+}
@@ -0,0 +1,134 @@
+package visitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchesPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"/contact", "/contact", true},
+		{"/contact", "/contact/", false},
+		{"/contact", "/contact-us", false},
+		{"/blog/*", "/blog/first-post", true},
+		{"/blog/*", "/blog/2024/first-post", false},
+		{"/blog/*", "/blog", false},
+		{"/blog/**", "/blog", true},
+		{"/blog/**", "/blog/2024/first-post", true},
+		{"/blog/**", "/blogroll", false},
+		{"/projects/?", "/projects/1", true},
+		{"/projects/[", "/projects/[", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.matches, matchesPathPattern(tt.pattern, tt.path))
+		})
+	}
+}
+
+func TestFunnelStepsReached(t *testing.T) {
+	steps := []FunnelStep{
+		{Name: "Landing", Type: GoalTypePath, Pattern: "/"},
+		{Name: "Projects", Type: GoalTypePath, Pattern: "/projects/**"},
+		{Name: "Contact", Type: GoalTypeEvent, Pattern: "contact_submit"},
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	timeline := func(touches ...sessionTouch) []sessionTouch {
+		for i := range touches {
+			touches[i].createdAt = start.Add(time.Duration(i) * time.Minute)
+		}
+		return touches
+	}
+
+	tests := []struct {
+		name     string
+		timeline []sessionTouch
+		reached  int
+	}{
+		{"empty session", nil, 0},
+		{"first step only", timeline(
+			sessionTouch{kind: GoalTypePath, value: "/"},
+		), 1},
+		{"every step in order", timeline(
+			sessionTouch{kind: GoalTypePath, value: "/"},
+			sessionTouch{kind: GoalTypePath, value: "/projects/website"},
+			sessionTouch{kind: GoalTypeEvent, value: "contact_submit"},
+		), 3},
+		{"unrelated touches in between", timeline(
+			sessionTouch{kind: GoalTypePath, value: "/"},
+			sessionTouch{kind: GoalTypePath, value: "/about"},
+			sessionTouch{kind: GoalTypePath, value: "/projects"},
+			sessionTouch{kind: GoalTypeEvent, value: "download_cv"},
+			sessionTouch{kind: GoalTypeEvent, value: "contact_submit"},
+		), 3},
+		{"later steps before earlier ones do not count", timeline(
+			sessionTouch{kind: GoalTypeEvent, value: "contact_submit"},
+			sessionTouch{kind: GoalTypePath, value: "/projects/website"},
+			sessionTouch{kind: GoalTypePath, value: "/"},
+		), 1},
+		{"skipped step stops the funnel", timeline(
+			sessionTouch{kind: GoalTypePath, value: "/"},
+			sessionTouch{kind: GoalTypeEvent, value: "contact_submit"},
+		), 1},
+		{"event named like a path is not a page view", timeline(
+			sessionTouch{kind: GoalTypeEvent, value: "/"},
+		), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.reached, funnelStepsReached(tt.timeline, steps))
+		})
+	}
+}
+
+func TestBuildFunnelSteps(t *testing.T) {
+	steps := []FunnelStep{{Name: "Landing"}, {Name: "Projects"}, {Name: "Contact"}}
+
+	tests := []struct {
+		name   string
+		counts []int
+		want   []FunnelStepReport
+	}{
+		{
+			name:   "drop off at each step",
+			counts: []int{200, 50, 10},
+			want: []FunnelStepReport{
+				{Name: "Landing", Sessions: 200, ConversionRate: 100},
+				{Name: "Projects", Sessions: 50, DropOff: 150, DropOffRate: 75, ConversionRate: 25},
+				{Name: "Contact", Sessions: 10, DropOff: 40, DropOffRate: 80, ConversionRate: 5},
+			},
+		},
+		{
+			name:   "no sessions",
+			counts: []int{0, 0, 0},
+			want: []FunnelStepReport{
+				{Name: "Landing"},
+				{Name: "Projects"},
+				{Name: "Contact"},
+			},
+		},
+		{
+			name:   "nobody past the first step",
+			counts: []int{40, 0, 0},
+			want: []FunnelStepReport{
+				{Name: "Landing", Sessions: 40, ConversionRate: 100},
+				{Name: "Projects", DropOff: 40, DropOffRate: 100},
+				{Name: "Contact"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildFunnelSteps(steps, tt.counts))
+		})
+	}
+}
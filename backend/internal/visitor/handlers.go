@@ -2,7 +2,11 @@ package visitor
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/JadenRazo/Project-Website/backend/internal/common/response"
@@ -14,12 +18,25 @@ func (s *Service) RegisterRoutes(router *gin.RouterGroup) {
 	// Tracking endpoint for frontend page views
 	router.POST("/track", s.handleTrackPageView)
 
+	// Custom event endpoint
+	router.POST("/event", s.handleTrackEvent)
+
+	// Web vitals beacon endpoint
+	router.POST("/vitals", s.handleRecordVitals)
+
 	// Privacy consent endpoints
 	privacy := router.Group("/privacy")
 	{
 		privacy.POST("/consent", s.handleRecordConsent)
 		privacy.GET("/consent/:sessionId", s.handleGetConsent)
+		privacy.GET("/mode", s.handleGetPrivacyMode)
 		privacy.DELETE("/data/:sessionId", s.handleDataErasure)
+
+		// Verifiable data subject requests
+		privacy.POST("/requests", s.handleSubmitPrivacyRequest)
+		privacy.POST("/requests/verify", s.handleVerifyPrivacyRequest)
+		privacy.GET("/requests/status", s.handleGetPrivacyRequest)
+		privacy.GET("/requests/download", s.handleDownloadPrivacyExport)
 	}
 
 	// Analytics endpoints (aggregated data only)
@@ -30,6 +47,8 @@ func (s *Service) RegisterRoutes(router *gin.RouterGroup) {
 		analytics.GET("/timeline", s.handleGetTimeline)
 		analytics.GET("/locations", s.handleGetLocations)
 		analytics.GET("/devices", s.handleGetDevices)
+		analytics.GET("/events/top", s.handleGetTopEvents)
+		analytics.GET("/events/timeline", s.handleGetEventTimeline)
 	}
 }
 
@@ -49,7 +68,13 @@ func (s *Service) handleTrackPageView(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := s.TrackPageView(ctx, c.Request, req.Path); err != nil {
+	// The frontend reports document.referrer and the landing path including
+	// its query string, since the API request itself carries neither.
+	path, rawQuery, _ := strings.Cut(req.Path, "?")
+	query, _ := url.ParseQuery(rawQuery)
+	attribution := ParseAttribution(query, req.Referrer, siteHost(c.Request))
+
+	if err := s.TrackPageViewWithAttribution(ctx, c.Request, path, attribution); err != nil {
 		response.SendInternalError(c, "Failed to track page view", err)
 		return
 	}
@@ -60,6 +85,59 @@ func (s *Service) handleTrackPageView(c *gin.Context) {
 	})
 }
 
+// handleTrackEvent handles custom event tracking from frontend
+func (s *Service) handleTrackEvent(c *gin.Context) {
+	var req EventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.SendError(c, http.StatusBadRequest, "Invalid request", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.TrackEvent(ctx, c.Request, req); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidEvent):
+			response.SendValidationError(c, "Invalid event", err.Error())
+		case errors.Is(err, ErrEventNotPermitted):
+			response.SendError(c, http.StatusForbidden, "Event tracking requires analytics consent", nil)
+		default:
+			response.SendInternalError(c, "Failed to track event", err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleRecordVitals accepts a web vitals beacon. Beacons sent with
+// navigator.sendBeacon arrive as text/plain, so the body is always read as JSON.
+func (s *Service) handleRecordVitals(c *gin.Context) {
+	var beacon VitalsBeacon
+	if err := c.ShouldBindJSON(&beacon); err != nil {
+		response.SendError(c, http.StatusBadRequest, "Invalid request", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.RecordVitals(ctx, c.Request, beacon); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidVitals):
+			response.SendValidationError(c, "Invalid beacon", err.Error())
+		case errors.Is(err, ErrEventNotPermitted):
+			response.SendError(c, http.StatusForbidden, "Performance tracking requires analytics consent", nil)
+		default:
+			response.SendInternalError(c, "Failed to record web vitals", err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
 // handleRecordConsent records user consent preferences
 func (s *Service) handleRecordConsent(c *gin.Context) {
 	var req struct {
@@ -92,6 +170,14 @@ func (s *Service) handleRecordConsent(c *gin.Context) {
 	response.SendSuccess(c, nil)
 }
 
+// handleGetPrivacyMode tells the frontend whether a consent banner is needed
+func (s *Service) handleGetPrivacyMode(c *gin.Context) {
+	response.SendSuccess(c, gin.H{
+		"cookieless":      s.IsCookieless(),
+		"consentRequired": !s.IsCookieless(),
+	})
+}
+
 // handleGetConsent gets consent status for a session
 func (s *Service) handleGetConsent(c *gin.Context) {
 	sessionID := c.Param("sessionId")
@@ -105,16 +191,144 @@ func (s *Service) handleGetConsent(c *gin.Context) {
 	response.SendSuccess(c, status)
 }
 
-// handleDataErasure handles GDPR right to erasure requests
+// handleDataErasure handles GDPR right to erasure requests. Erasure is no
+// longer immediate: an erasure request bound to the caller's own session is
+// submitted and must be verified before the worker removes the data.
 func (s *Service) handleDataErasure(c *gin.Context) {
-	sessionID := c.Param("sessionId")
+	s.submitPrivacyRequest(c, PrivacyRequestInput{Type: PrivacyRequestErasure, Method: VerifyBySession})
+}
 
-	if err := s.EraseSessionData(c.Request.Context(), sessionID); err != nil {
-		response.SendInternalError(c, "Failed to erase data", err)
+// handleSubmitPrivacyRequest submits a data export or erasure request
+func (s *Service) handleSubmitPrivacyRequest(c *gin.Context) {
+	var req PrivacyRequestInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.SendError(c, http.StatusBadRequest, "Invalid request", nil)
 		return
 	}
 
-	response.SendSuccessWithMessage(c, nil, "All data associated with this session has been erased")
+	s.submitPrivacyRequest(c, req)
+}
+
+func (s *Service) submitPrivacyRequest(c *gin.Context, input PrivacyRequestInput) {
+	sessionHash, _, err := s.generateSessionHash(c.Request.Context(), c.Request)
+	if err != nil {
+		response.SendInternalError(c, "Failed to submit privacy request", err)
+		return
+	}
+
+	req, token, err := s.privacyRequests.Submit(c.Request.Context(), input, sessionHash)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPrivacyRequest):
+			response.SendValidationError(c, "Invalid privacy request", err.Error())
+		case errors.Is(err, ErrPrivacyRequestsUnavailable):
+			response.SendError(c, http.StatusServiceUnavailable, "Privacy requests are temporarily unavailable", nil)
+		default:
+			response.SendInternalError(c, "Failed to submit privacy request", err)
+		}
+		return
+	}
+
+	message := "Check your email to confirm this request"
+	if token != "" {
+		s.setPrivacyTokenCookie(c, token, s.privacyRequests.TokenExpiry(req))
+		message = "Confirm this request to proceed"
+	}
+
+	c.JSON(http.StatusAccepted, response.SuccessResponse{
+		Success: true,
+		Data:    privacyRequestStatus(req),
+		Message: message,
+	})
+}
+
+// handleVerifyPrivacyRequest confirms a request with the token from the
+// request cookie or the emailed link
+func (s *Service) handleVerifyPrivacyRequest(c *gin.Context) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	_ = c.ShouldBindJSON(&body)
+
+	req, err := s.privacyRequests.Verify(c.Request.Context(), s.privacyToken(c, body.Token))
+	if err != nil {
+		s.sendPrivacyRequestError(c, err)
+		return
+	}
+
+	response.SendSuccess(c, privacyRequestStatus(req))
+}
+
+// handleGetPrivacyRequest returns the status of the caller's request
+func (s *Service) handleGetPrivacyRequest(c *gin.Context) {
+	req, err := s.privacyRequests.Lookup(c.Request.Context(), s.privacyToken(c, c.Query("token")))
+	if err != nil {
+		s.sendPrivacyRequestError(c, err)
+		return
+	}
+
+	response.SendSuccess(c, privacyRequestStatus(req))
+}
+
+// handleDownloadPrivacyExport serves a finished export archive
+func (s *Service) handleDownloadPrivacyExport(c *gin.Context) {
+	req, path, err := s.privacyRequests.ExportFile(c.Request.Context(), s.privacyToken(c, c.Query("token")))
+	if err != nil {
+		s.sendPrivacyRequestError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(path, "data-export-"+req.ID.String()+"."+req.ExportFormat)
+}
+
+// privacyToken prefers an explicit token and falls back to the request cookie
+func (s *Service) privacyToken(c *gin.Context, explicit string) string {
+	if explicit != "" {
+		return explicit
+	}
+	token, _ := c.Cookie(PrivacyTokenCookie)
+	return token
+}
+
+func (s *Service) setPrivacyTokenCookie(c *gin.Context, token string, expires time.Time) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(
+		PrivacyTokenCookie,
+		token,
+		int(time.Until(expires).Seconds()),
+		"/",
+		"",
+		true,
+		true,
+	)
+}
+
+func (s *Service) sendPrivacyRequestError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidPrivacyToken):
+		response.SendError(c, http.StatusForbidden, err.Error(), nil)
+	case errors.Is(err, ErrPrivacyRequestState), errors.Is(err, ErrExportNotReady):
+		response.SendError(c, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrPrivacyRequestsUnavailable):
+		response.SendError(c, http.StatusServiceUnavailable, "Privacy requests are temporarily unavailable", nil)
+	default:
+		response.SendInternalError(c, "Failed to process privacy request", err)
+	}
+}
+
+// privacyRequestStatus is the public view of a request, without admin notes
+func privacyRequestStatus(req *PrivacyRequest) gin.H {
+	return gin.H{
+		"id":              req.ID,
+		"type":            req.RequestType,
+		"status":          req.Status,
+		"submittedAt":     req.SubmittedAt,
+		"verifiedAt":      req.VerifiedAt,
+		"fulfilledAt":     req.FulfilledAt,
+		"dueAt":           req.DueAt,
+		"exportExpiresAt": req.ExportExpiresAt,
+	}
 }
 
 // handleGetOverview returns visitor statistics overview
@@ -130,27 +344,13 @@ func (s *Service) handleGetOverview(c *gin.Context) {
 
 // handleGetRealtime returns real-time visitor data
 func (s *Service) handleGetRealtime(c *gin.Context) {
-	count := s.GetRealTimeCount(c.Request.Context())
-
-	var activePages []struct {
-		Page  string `json:"page"`
-		Count int    `json:"count"`
+	snapshot, err := s.GetRealtimeSnapshot(c.Request.Context())
+	if err != nil {
+		response.SendInternalError(c, "Failed to get realtime data", err)
+		return
 	}
 
-	s.db.Raw(`
-		SELECT current_page as page, COUNT(*) as count
-		FROM visitor_realtime
-		WHERE last_activity > ?
-		GROUP BY current_page
-		ORDER BY count DESC
-		LIMIT 10
-	`, time.Now().Add(-5*time.Minute)).Scan(&activePages)
-
-	response.SendSuccess(c, gin.H{
-		"activeVisitors": count,
-		"activePages":    activePages,
-		"timestamp":      time.Now(),
-	})
+	response.SendSuccess(c, snapshot)
 }
 
 // handleGetTimeline returns visitor timeline data
@@ -200,6 +400,41 @@ func (s *Service) handleGetDevices(c *gin.Context) {
 	response.SendSuccess(c, stats)
 }
 
+// handleGetTopEvents returns the most frequent custom events
+func (s *Service) handleGetTopEvents(c *gin.Context) {
+	period := c.DefaultQuery("period", "7d")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	events, err := s.GetTopEvents(c.Request.Context(), period, limit)
+	if err != nil {
+		response.SendInternalError(c, "Failed to get event statistics", err)
+		return
+	}
+
+	response.SendSuccess(c, gin.H{
+		"period": period,
+		"events": events,
+	})
+}
+
+// handleGetEventTimeline returns custom event counts over time
+func (s *Service) handleGetEventTimeline(c *gin.Context) {
+	period := c.DefaultQuery("period", "7d")
+	name := c.Query("name")
+
+	data, err := s.GetEventTimeline(c.Request.Context(), period, name)
+	if err != nil {
+		response.SendInternalError(c, "Failed to get event timeline", err)
+		return
+	}
+
+	response.SendSuccess(c, gin.H{
+		"period": period,
+		"name":   name,
+		"data":   data,
+	})
+}
+
 // EraseSessionData erases all data for a session (GDPR compliance)
 func (s *Service) EraseSessionData(ctx context.Context, sessionHash string) error {
 	// Start transaction
@@ -222,6 +457,12 @@ func (s *Service) EraseSessionData(ctx context.Context, sessionHash string) erro
 		return err
 	}
 	
+	// Delete custom events
+	if err := tx.Where("session_hash = ?", sessionHash).Delete(&VisitorEvent{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	
 	// Delete consents
 	if err := tx.Where("session_hash = ?", sessionHash).Delete(&PrivacyConsent{}).Error; err != nil {
 		tx.Rollback()
@@ -236,4 +477,15 @@ func (s *Service) EraseSessionData(ctx context.Context, sessionHash string) erro
 	
 	// Commit transaction
 	return tx.Commit().Error
-}
\ No newline at end of file
+}
+
+// siteHost returns the host of the page making a tracking request, taken from
+// the Origin header and falling back to the request host
+func siteHost(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	return r.Host
+}
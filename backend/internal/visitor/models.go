@@ -20,6 +20,7 @@ type VisitorSession struct {
 	BrowserFamily string    `gorm:"type:varchar(50)"`
 	OSFamily      string    `gorm:"type:varchar(50)"`
 	IsBot         bool      `gorm:"default:false"`
+	Cookieless    bool      `gorm:"default:false"`
 	CreatedAt     time.Time
 	LastSeenAt    time.Time
 	ExpiresAt     time.Time
@@ -31,6 +32,12 @@ type PageView struct {
 	SessionID        uuid.UUID `gorm:"type:uuid;not null;index"`
 	Path             string    `gorm:"type:varchar(255);not null;index"`
 	ReferrerDomain   string    `gorm:"type:varchar(255)"`
+	Channel          string    `gorm:"type:varchar(20);index"`
+	UTMSource        string    `gorm:"column:utm_source;type:varchar(255)"`
+	UTMMedium        string    `gorm:"column:utm_medium;type:varchar(255)"`
+	UTMCampaign      string    `gorm:"column:utm_campaign;type:varchar(255)"`
+	UTMTerm          string    `gorm:"column:utm_term;type:varchar(255)"`
+	UTMContent       string    `gorm:"column:utm_content;type:varchar(255)"`
 	DurationSeconds  int
 	CreatedAt        time.Time
 }
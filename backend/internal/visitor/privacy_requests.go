@@ -0,0 +1,742 @@
+package visitor
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Data subject request types
+const (
+	PrivacyRequestExport  = "export"
+	PrivacyRequestErasure = "erasure"
+)
+
+// Data subject request statuses. Requests move from submitted to verified to
+// fulfilled; rejected and expired are terminal.
+const (
+	PrivacyStatusSubmitted = "submitted"
+	PrivacyStatusVerified  = "verified"
+	PrivacyStatusFulfilled = "fulfilled"
+	PrivacyStatusRejected  = "rejected"
+	PrivacyStatusExpired   = "expired"
+)
+
+// Verification methods
+const (
+	VerifyBySession = "session"
+	VerifyByEmail   = "email"
+)
+
+// Export archive formats
+const (
+	ExportFormatZIP  = "zip"
+	ExportFormatJSON = "json"
+)
+
+const (
+	// privacyRequestDeadline is the legal response window (GDPR Art. 12(3))
+	privacyRequestDeadline = 30 * 24 * time.Hour
+	// privacyVerifyWindow is how long an unverified request stays open
+	privacyVerifyWindow = 7 * 24 * time.Hour
+	// defaultExportTTL is how long a finished export can be downloaded
+	defaultExportTTL = 7 * 24 * time.Hour
+	// maxProcessAttempts stops retrying a request that keeps failing
+	maxProcessAttempts = 5
+
+	// PrivacyTokenCookie carries the verification token for session-bound requests
+	PrivacyTokenCookie = "privacy_request"
+)
+
+var (
+	ErrPrivacyRequestsUnavailable = errors.New("privacy requests are not configured")
+	ErrInvalidPrivacyRequest      = errors.New("invalid privacy request")
+	ErrPrivacyRequestNotFound     = errors.New("privacy request not found")
+	ErrInvalidPrivacyToken        = errors.New("invalid or expired verification token")
+	ErrPrivacyRequestState        = errors.New("privacy request is not in a valid state for this action")
+	ErrExportNotReady             = errors.New("export is not available")
+)
+
+// PrivacyRequest is a data subject access or erasure request
+type PrivacyRequest struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	RequestType     string     `gorm:"type:varchar(20);not null" json:"type"`
+	Status          string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	VerifyMethod    string     `gorm:"type:varchar(20);not null" json:"verifyMethod"`
+	SubjectHash     string     `gorm:"type:varchar(64);not null" json:"-"`
+	SessionHash     string     `gorm:"type:varchar(64)" json:"-"`
+	Email           string     `gorm:"type:varchar(255)" json:"email,omitempty"`
+	ExportFormat    string     `gorm:"type:varchar(10)" json:"exportFormat,omitempty"`
+	ExportPath      string     `gorm:"type:text" json:"-"`
+	ExportExpiresAt *time.Time `json:"exportExpiresAt,omitempty"`
+	Attempts        int        `gorm:"default:0" json:"attempts"`
+	LastError       string     `gorm:"type:text" json:"lastError,omitempty"`
+	Notes           string     `gorm:"type:text" json:"notes,omitempty"`
+	SubmittedAt     time.Time  `gorm:"not null" json:"submittedAt"`
+	VerifiedAt      *time.Time `json:"verifiedAt,omitempty"`
+	FulfilledAt     *time.Time `json:"fulfilledAt,omitempty"`
+	DueAt           time.Time  `gorm:"not null;index" json:"dueAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+func (PrivacyRequest) TableName() string { return "privacy_requests" }
+
+// IsOpen reports whether the request still needs action
+func (r *PrivacyRequest) IsOpen() bool {
+	return r.Status == PrivacyStatusSubmitted || r.Status == PrivacyStatusVerified
+}
+
+// PrivacyRequestView adds deadline tracking to a request for admin listings
+type PrivacyRequestView struct {
+	PrivacyRequest
+	DaysRemaining int  `json:"daysRemaining"`
+	Overdue       bool `json:"overdue"`
+}
+
+// PrivacyRequestInput is submitted by the data subject
+type PrivacyRequestInput struct {
+	Type   string `json:"type"`
+	Method string `json:"method"`
+	Email  string `json:"email"`
+	Format string `json:"format"`
+}
+
+// PrivacyRequestConfig configures the data subject request workflow
+type PrivacyRequestConfig struct {
+	// SigningKey signs verification tokens; the workflow is disabled without it
+	SigningKey []byte
+	// ExportDir is where finished export archives are written
+	ExportDir string
+	// ExportTTL is how long an export can be downloaded once ready
+	ExportTTL time.Duration
+	// PublicURL is the frontend origin used in emailed links
+	PublicURL string
+}
+
+// Mailer sends plain text email
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// PrivacyRequestService runs the data subject request lifecycle
+type PrivacyRequestService struct {
+	db         *gorm.DB
+	compliance *ComplianceService
+	config     PrivacyRequestConfig
+	mailer     Mailer
+}
+
+// NewPrivacyRequestService creates a new privacy request service
+func NewPrivacyRequestService(db *gorm.DB, compliance *ComplianceService, config PrivacyRequestConfig) *PrivacyRequestService {
+	if config.ExportDir == "" {
+		config.ExportDir = filepath.Join("data", "privacy-exports")
+	}
+	if config.ExportTTL <= 0 {
+		config.ExportTTL = defaultExportTTL
+	}
+	if len(config.SigningKey) > 0 {
+		// Derive a purpose-specific key so a shared secret such as the JWT key
+		// can never produce a token valid elsewhere
+		mac := hmac.New(sha256.New, config.SigningKey)
+		mac.Write([]byte("visitor.privacy-requests"))
+		config.SigningKey = mac.Sum(nil)
+	}
+
+	return &PrivacyRequestService{
+		db:         db,
+		compliance: compliance,
+		config:     config,
+	}
+}
+
+// SetMailer sets the mailer used for email verification and notifications
+func (ps *PrivacyRequestService) SetMailer(mailer Mailer) {
+	ps.mailer = mailer
+}
+
+// privacyToken is the signed payload of a verification token
+type privacyToken struct {
+	RequestID string `json:"rid"`
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Submit records a new request. Session-bound requests are tied to the
+// session hash computed from the submitting browser, never one supplied by
+// the client. It returns the verification token; for email requests the token
+// is also mailed to the address so only its owner can verify.
+func (ps *PrivacyRequestService) Submit(ctx context.Context, input PrivacyRequestInput, sessionHash string) (*PrivacyRequest, string, error) {
+	if len(ps.config.SigningKey) == 0 {
+		return nil, "", ErrPrivacyRequestsUnavailable
+	}
+
+	if input.Type != PrivacyRequestExport && input.Type != PrivacyRequestErasure {
+		return nil, "", fmt.Errorf("%w: type must be export or erasure", ErrInvalidPrivacyRequest)
+	}
+	if input.Format == "" {
+		input.Format = ExportFormatZIP
+	}
+	if input.Type == PrivacyRequestExport && input.Format != ExportFormatZIP && input.Format != ExportFormatJSON {
+		return nil, "", fmt.Errorf("%w: format must be zip or json", ErrInvalidPrivacyRequest)
+	}
+
+	now := time.Now()
+	req := &PrivacyRequest{
+		ID:          uuid.New(),
+		RequestType: input.Type,
+		Status:      PrivacyStatusSubmitted,
+		SubmittedAt: now,
+		DueAt:       now.Add(privacyRequestDeadline),
+	}
+	if input.Type == PrivacyRequestExport {
+		req.ExportFormat = input.Format
+	}
+
+	switch input.Method {
+	case VerifyBySession, "":
+		if sessionHash == "" {
+			return nil, "", fmt.Errorf("%w: no session to bind the request to", ErrInvalidPrivacyRequest)
+		}
+		req.VerifyMethod = VerifyBySession
+		req.SessionHash = sessionHash
+		req.SubjectHash = subjectHash(sessionHash)
+	case VerifyByEmail:
+		addr, err := mail.ParseAddress(strings.TrimSpace(input.Email))
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: invalid email address", ErrInvalidPrivacyRequest)
+		}
+		if ps.mailer == nil {
+			return nil, "", ErrPrivacyRequestsUnavailable
+		}
+		req.VerifyMethod = VerifyByEmail
+		req.Email = strings.ToLower(addr.Address)
+		req.SubjectHash = subjectHash(req.Email)
+	default:
+		return nil, "", fmt.Errorf("%w: method must be session or email", ErrInvalidPrivacyRequest)
+	}
+
+	if err := ps.db.WithContext(ctx).Create(req).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create privacy request: %w", err)
+	}
+
+	token := ps.signToken(req, ps.TokenExpiry(req))
+
+	if req.VerifyMethod == VerifyByEmail {
+		link := ps.link("/privacy/requests/verify", token)
+		body := fmt.Sprintf("We received a request to %s the data we hold about %s.\n\n"+
+			"If you made this request, confirm it within 7 days by opening:\n%s\n\n"+
+			"If you did not, you can ignore this email and nothing will happen.\n",
+			describeRequestType(req.RequestType), req.Email, link)
+		if err := ps.mailer.Send(req.Email, "Confirm your privacy request", body); err != nil {
+			return nil, "", fmt.Errorf("failed to send verification email: %w", err)
+		}
+		// The token must only reach the mailbox owner
+		token = ""
+	}
+
+	return req, token, nil
+}
+
+// Verify confirms a submitted request using its signed token
+func (ps *PrivacyRequestService) Verify(ctx context.Context, token string) (*PrivacyRequest, error) {
+	req, err := ps.Lookup(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.Status {
+	case PrivacyStatusSubmitted:
+		if time.Since(req.SubmittedAt) > privacyVerifyWindow {
+			return nil, ErrInvalidPrivacyToken
+		}
+		return req, ps.markVerified(ctx, req, "")
+	case PrivacyStatusVerified, PrivacyStatusFulfilled:
+		return req, nil
+	default:
+		return nil, ErrPrivacyRequestState
+	}
+}
+
+// Lookup returns the request a token was issued for after checking the
+// signature, expiry and subject binding
+func (ps *PrivacyRequestService) Lookup(ctx context.Context, token string) (*PrivacyRequest, error) {
+	claims, err := ps.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var req PrivacyRequest
+	if err := ps.db.WithContext(ctx).First(&req, "id = ?", claims.RequestID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidPrivacyToken
+		}
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(claims.Subject), []byte(req.SubjectHash)) {
+		return nil, ErrInvalidPrivacyToken
+	}
+
+	return &req, nil
+}
+
+// ExportFile returns the archive path of a fulfilled export request
+func (ps *PrivacyRequestService) ExportFile(ctx context.Context, token string) (*PrivacyRequest, string, error) {
+	req, err := ps.Lookup(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if req.RequestType != PrivacyRequestExport || req.Status != PrivacyStatusFulfilled ||
+		req.ExportPath == "" || req.ExportExpiresAt == nil || time.Now().After(*req.ExportExpiresAt) {
+		return nil, "", ErrExportNotReady
+	}
+	if _, err := os.Stat(req.ExportPath); err != nil {
+		return nil, "", ErrExportNotReady
+	}
+
+	return req, req.ExportPath, nil
+}
+
+// TokenExpiry returns when tokens issued for a request stop being accepted
+func (ps *PrivacyRequestService) TokenExpiry(req *PrivacyRequest) time.Time {
+	return req.DueAt.Add(ps.config.ExportTTL)
+}
+
+// List returns requests for the admin view ordered by deadline
+func (ps *PrivacyRequestService) List(ctx context.Context, status string, overdueOnly bool) ([]PrivacyRequestView, error) {
+	query := ps.db.WithContext(ctx).Model(&PrivacyRequest{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if overdueOnly {
+		query = query.Where("status IN ? AND due_at < ?", []string{PrivacyStatusSubmitted, PrivacyStatusVerified}, time.Now())
+	}
+
+	var requests []PrivacyRequest
+	if err := query.Order("due_at ASC").Limit(500).Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("failed to list privacy requests: %w", err)
+	}
+
+	now := time.Now()
+	views := make([]PrivacyRequestView, len(requests))
+	for i, req := range requests {
+		views[i] = PrivacyRequestView{PrivacyRequest: req}
+		if req.IsOpen() {
+			views[i].DaysRemaining = int(req.DueAt.Sub(now).Hours() / 24)
+			views[i].Overdue = now.After(req.DueAt)
+		}
+	}
+
+	return views, nil
+}
+
+// AdminVerify marks a request as verified after an admin checked the
+// requester's identity out of band
+func (ps *PrivacyRequestService) AdminVerify(ctx context.Context, id uuid.UUID, note string) error {
+	req, err := ps.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if req.Status != PrivacyStatusSubmitted {
+		return ErrPrivacyRequestState
+	}
+	return ps.markVerified(ctx, req, note)
+}
+
+// Reject closes a request without fulfilling it
+func (ps *PrivacyRequestService) Reject(ctx context.Context, id uuid.UUID, reason string) error {
+	req, err := ps.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !req.IsOpen() {
+		return ErrPrivacyRequestState
+	}
+
+	return ps.db.WithContext(ctx).Model(req).Updates(map[string]interface{}{
+		"status": PrivacyStatusRejected,
+		"notes":  appendNote(req.Notes, "rejected: "+reason),
+	}).Error
+}
+
+// Fulfill processes a single verified request immediately
+func (ps *PrivacyRequestService) Fulfill(ctx context.Context, id uuid.UUID) error {
+	req, err := ps.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if req.Status != PrivacyStatusVerified {
+		return ErrPrivacyRequestState
+	}
+	return ps.process(ctx, req)
+}
+
+// ProcessPending fulfils verified requests, closes stale unverified ones and
+// removes expired export archives. It is run by the worker.
+func (ps *PrivacyRequestService) ProcessPending(ctx context.Context, limit int) (int, error) {
+	now := time.Now()
+
+	if err := ps.db.WithContext(ctx).Model(&PrivacyRequest{}).
+		Where("status = ? AND submitted_at < ?", PrivacyStatusSubmitted, now.Add(-privacyVerifyWindow)).
+		Update("status", PrivacyStatusExpired).Error; err != nil {
+		return 0, fmt.Errorf("failed to expire unverified requests: %w", err)
+	}
+
+	if err := ps.cleanupExports(ctx, now); err != nil {
+		return 0, err
+	}
+
+	var pending []PrivacyRequest
+	if err := ps.db.WithContext(ctx).
+		Where("status = ? AND attempts < ?", PrivacyStatusVerified, maxProcessAttempts).
+		Order("due_at ASC").
+		Limit(limit).
+		Find(&pending).Error; err != nil {
+		return 0, fmt.Errorf("failed to load verified requests: %w", err)
+	}
+
+	processed := 0
+	for i := range pending {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+		if err := ps.process(ctx, &pending[i]); err == nil {
+			processed++
+		}
+	}
+
+	return processed, nil
+}
+
+// process fulfils one verified request, recording failures for retry
+func (ps *PrivacyRequestService) process(ctx context.Context, req *PrivacyRequest) error {
+	var err error
+	updates := map[string]interface{}{}
+
+	switch req.RequestType {
+	case PrivacyRequestExport:
+		var path string
+		path, err = ps.writeExport(ctx, req)
+		if err == nil {
+			expires := time.Now().Add(ps.config.ExportTTL)
+			updates["export_path"] = path
+			updates["export_expires_at"] = expires
+			req.ExportExpiresAt = &expires
+		}
+	case PrivacyRequestErasure:
+		err = ps.erase(ctx, req)
+	default:
+		err = fmt.Errorf("%w: unknown type %q", ErrInvalidPrivacyRequest, req.RequestType)
+	}
+
+	if err != nil {
+		if updateErr := ps.db.WithContext(ctx).Model(req).Updates(map[string]interface{}{
+			"attempts":   req.Attempts + 1,
+			"last_error": err.Error(),
+		}).Error; updateErr != nil {
+			log.Printf("Failed to record failed attempt of privacy request %s: %v", req.ID, updateErr)
+		}
+		return err
+	}
+
+	now := time.Now()
+	updates["status"] = PrivacyStatusFulfilled
+	updates["fulfilled_at"] = now
+	updates["last_error"] = ""
+	if err := ps.db.WithContext(ctx).Model(req).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to mark request fulfilled: %w", err)
+	}
+
+	// The request is fulfilled either way, so failures past this point are
+	// logged rather than retried
+	if err := ps.db.WithContext(ctx).Create(&ConsentAuditLog{
+		ID:          uuid.New(),
+		SessionHash: req.SessionHash,
+		Action:      "privacy_" + req.RequestType + "_fulfilled",
+		Details:     map[string]bool{"verified_by_" + req.VerifyMethod: true},
+		Timestamp:   now,
+	}).Error; err != nil {
+		log.Printf("Failed to audit fulfilled privacy request %s: %v", req.ID, err)
+	}
+
+	if err := ps.notifyFulfilled(req); err != nil {
+		log.Printf("Failed to notify subject of fulfilled privacy request %s: %v", req.ID, err)
+	}
+	return nil
+}
+
+// erase removes every record tied to the request subject
+func (ps *PrivacyRequestService) erase(ctx context.Context, req *PrivacyRequest) error {
+	if req.VerifyMethod == VerifyBySession {
+		err := ps.compliance.DeleteUserData(ctx, req.SessionHash)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	return ps.db.WithContext(ctx).Exec("DELETE FROM contact_submissions WHERE LOWER(email) = ?", req.Email).Error
+}
+
+// writeExport gathers the subject's data and writes it to an archive using a
+// temporary file and rename so partial archives are never served
+func (ps *PrivacyRequestService) writeExport(ctx context.Context, req *PrivacyRequest) (string, error) {
+	files, err := ps.collectExport(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(ps.config.ExportDir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(ps.config.ExportDir, "export-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if req.ExportFormat == ExportFormatJSON {
+		err = writeJSONExport(tmp, files)
+	} else {
+		err = writeZIPExport(tmp, files)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+
+	path := filepath.Join(ps.config.ExportDir, req.ID.String()+"."+req.ExportFormat)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to finalize export: %w", err)
+	}
+
+	return path, nil
+}
+
+// collectExport returns the export sections keyed by file name
+func (ps *PrivacyRequestService) collectExport(ctx context.Context, req *PrivacyRequest) (map[string]interface{}, error) {
+	files := map[string]interface{}{
+		"manifest.json": map[string]interface{}{
+			"requestId":   req.ID,
+			"generatedAt": time.Now(),
+			"subjectType": req.VerifyMethod,
+		},
+	}
+
+	if req.VerifyMethod == VerifyBySession {
+		data, err := ps.compliance.ExportUserData(ctx, req.SessionHash)
+		if err != nil {
+			return nil, err
+		}
+
+		var auditLogs []ConsentAuditLog
+		if err := ps.db.WithContext(ctx).Where("session_hash = ?", req.SessionHash).Find(&auditLogs).Error; err != nil {
+			return nil, fmt.Errorf("failed to load consent audit logs: %w", err)
+		}
+
+		files["session.json"] = data.SessionData
+		files["page_views.json"] = data.PageViews
+		files["events.json"] = data.Events
+		files["consents.json"] = data.ConsentRecords
+		files["consent_audit_logs.json"] = auditLogs
+		return files, nil
+	}
+
+	var submissions []map[string]interface{}
+	if err := ps.db.WithContext(ctx).
+		Table("contact_submissions").
+		Select("name, email, subject, message, created_at").
+		Where("LOWER(email) = ?", req.Email).
+		Find(&submissions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load contact submissions: %w", err)
+	}
+	files["contact_submissions.json"] = submissions
+
+	return files, nil
+}
+
+func writeJSONExport(w io.Writer, files map[string]interface{}) error {
+	doc := make(map[string]interface{}, len(files))
+	for name, data := range files {
+		doc[strings.TrimSuffix(name, ".json")] = data
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func writeZIPExport(w io.Writer, files map[string]interface{}) error {
+	zw := zip.NewWriter(w)
+	for name, data := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// cleanupExports deletes archives whose download window has passed
+func (ps *PrivacyRequestService) cleanupExports(ctx context.Context, now time.Time) error {
+	var expired []PrivacyRequest
+	if err := ps.db.WithContext(ctx).
+		Where("export_path <> '' AND export_expires_at < ?", now).
+		Find(&expired).Error; err != nil {
+		return fmt.Errorf("failed to load expired exports: %w", err)
+	}
+
+	for i := range expired {
+		if err := os.Remove(expired[i].ExportPath); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		ps.db.WithContext(ctx).Model(&expired[i]).Update("export_path", "")
+	}
+
+	return nil
+}
+
+func (ps *PrivacyRequestService) notifyFulfilled(req *PrivacyRequest) error {
+	if req.VerifyMethod != VerifyByEmail || ps.mailer == nil {
+		return nil
+	}
+
+	var body string
+	if req.RequestType == PrivacyRequestExport {
+		token := ps.signToken(req, req.ExportExpiresAt.Add(time.Hour))
+		body = fmt.Sprintf("Your data export is ready. Download it before %s:\n%s\n",
+			req.ExportExpiresAt.Format("2 January 2006"), ps.link("/privacy/requests/download", token))
+	} else {
+		body = "The data we held about you has been erased as requested.\n"
+	}
+
+	return ps.mailer.Send(req.Email, "Your privacy request has been completed", body)
+}
+
+func (ps *PrivacyRequestService) markVerified(ctx context.Context, req *PrivacyRequest, note string) error {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      PrivacyStatusVerified,
+		"verified_at": now,
+	}
+	if note != "" {
+		updates["notes"] = appendNote(req.Notes, "verified by admin: "+note)
+	}
+
+	if err := ps.db.WithContext(ctx).Model(req).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to verify request: %w", err)
+	}
+	req.Status = PrivacyStatusVerified
+	req.VerifiedAt = &now
+	return nil
+}
+
+func (ps *PrivacyRequestService) get(ctx context.Context, id uuid.UUID) (*PrivacyRequest, error) {
+	var req PrivacyRequest
+	if err := ps.db.WithContext(ctx).First(&req, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPrivacyRequestNotFound
+		}
+		return nil, err
+	}
+	return &req, nil
+}
+
+// signToken issues an HMAC-signed token binding the request ID to its subject
+func (ps *PrivacyRequestService) signToken(req *PrivacyRequest, expires time.Time) string {
+	payload, _ := json.Marshal(privacyToken{
+		RequestID: req.ID.String(),
+		Subject:   req.SubjectHash,
+		ExpiresAt: expires.Unix(),
+	})
+
+	mac := hmac.New(sha256.New, ps.config.SigningKey)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (ps *PrivacyRequestService) parseToken(token string) (*privacyToken, error) {
+	if len(ps.config.SigningKey) == 0 {
+		return nil, ErrPrivacyRequestsUnavailable
+	}
+
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidPrivacyToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidPrivacyToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return nil, ErrInvalidPrivacyToken
+	}
+
+	mac := hmac.New(sha256.New, ps.config.SigningKey)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidPrivacyToken
+	}
+
+	var claims privacyToken
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidPrivacyToken
+	}
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, ErrInvalidPrivacyToken
+	}
+
+	return &claims, nil
+}
+
+func (ps *PrivacyRequestService) link(path, token string) string {
+	return strings.TrimSuffix(ps.config.PublicURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func subjectHash(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:])
+}
+
+func appendNote(notes, note string) string {
+	line := time.Now().Format(time.RFC3339) + " " + note
+	if notes == "" {
+		return line
+	}
+	return notes + "\n" + line
+}
+
+func describeRequestType(requestType string) string {
+	if requestType == PrivacyRequestErasure {
+		return "erase"
+	}
+	return "export"
+}
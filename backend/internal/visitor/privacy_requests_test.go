@@ -0,0 +1,244 @@
+package visitor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type sentMail struct {
+	to, subject, body string
+}
+
+type recordingMailer struct {
+	sent []sentMail
+}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, sentMail{to: to, subject: subject, body: body})
+	return nil
+}
+
+// token returns the token of the link in the last mail sent
+func (m *recordingMailer) token(t *testing.T) string {
+	t.Helper()
+	require.NotEmpty(t, m.sent)
+	body := m.sent[len(m.sent)-1].body
+	start := strings.Index(body, "https://")
+	require.GreaterOrEqual(t, start, 0, "mail has a link")
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	require.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func newPrivacyRequestService(t *testing.T) (*PrivacyRequestService, *gorm.DB, *recordingMailer) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	for _, statement := range []string{
+		`CREATE TABLE privacy_requests (
+			id TEXT PRIMARY KEY, request_type TEXT, status TEXT, verify_method TEXT, subject_hash TEXT,
+			session_hash TEXT, email TEXT, export_format TEXT, export_path TEXT, export_expires_at DATETIME,
+			attempts INTEGER DEFAULT 0, last_error TEXT, notes TEXT, submitted_at DATETIME, verified_at DATETIME,
+			fulfilled_at DATETIME, due_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE consent_audit_logs (
+			id TEXT PRIMARY KEY, session_hash TEXT, action TEXT, details TEXT, timestamp DATETIME,
+			ip_address TEXT, user_agent TEXT)`,
+		`CREATE TABLE visitor_sessions (id TEXT PRIMARY KEY, session_hash TEXT)`,
+		`CREATE TABLE contact_submissions (
+			id INTEGER PRIMARY KEY, name TEXT, email TEXT, subject TEXT, message TEXT, created_at DATETIME)`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	ps := NewPrivacyRequestService(db, NewComplianceService(db, &ConfigService{}), PrivacyRequestConfig{
+		SigningKey: []byte("test-signing-key"),
+		ExportDir:  t.TempDir(),
+		PublicURL:  "https://example.com/",
+	})
+	mailer := &recordingMailer{}
+	ps.SetMailer(mailer)
+	return ps, db, mailer
+}
+
+func TestPrivacyTokens(t *testing.T) {
+	ps, _, _ := newPrivacyRequestService(t)
+	ctx := context.Background()
+
+	req, token, err := ps.Submit(ctx, PrivacyRequestInput{Type: PrivacyRequestExport}, "session-hash")
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	claims, err := ps.parseToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, req.ID.String(), claims.RequestID)
+	assert.Equal(t, subjectHash("session-hash"), claims.Subject)
+	assert.Equal(t, ps.TokenExpiry(req).Unix(), claims.ExpiresAt)
+
+	found, err := ps.Lookup(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, req.ID, found.ID)
+
+	payload, sig, _ := strings.Cut(token, ".")
+	tampered, err := json.Marshal(privacyToken{RequestID: req.ID.String(), Subject: claims.Subject, ExpiresAt: claims.ExpiresAt + 3600})
+	require.NoError(t, err)
+
+	otherKey := NewPrivacyRequestService(nil, nil, PrivacyRequestConfig{SigningKey: []byte("other-key")})
+	otherSubject := *req
+	otherSubject.SubjectHash = subjectHash("another-session")
+	unknownRequest := *req
+	unknownRequest.ID = uuid.New()
+
+	invalid := map[string]string{
+		"expired":            ps.signToken(req, time.Now().Add(-time.Minute)),
+		"tampered payload":   base64.RawURLEncoding.EncodeToString(tampered) + "." + sig,
+		"tampered signature": payload + "." + base64.RawURLEncoding.EncodeToString([]byte("not the signature")),
+		"other key":          otherKey.signToken(req, ps.TokenExpiry(req)),
+		"subject mismatch":   ps.signToken(&otherSubject, ps.TokenExpiry(req)),
+		"unknown request":    ps.signToken(&unknownRequest, ps.TokenExpiry(req)),
+		"no signature":       payload,
+		"not base64":         "!!!." + sig,
+		"empty":              "",
+	}
+	for name, token := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := ps.Lookup(ctx, token)
+			assert.ErrorIs(t, err, ErrInvalidPrivacyToken)
+		})
+	}
+
+	unconfigured := NewPrivacyRequestService(nil, nil, PrivacyRequestConfig{})
+	_, err = unconfigured.parseToken(token)
+	assert.ErrorIs(t, err, ErrPrivacyRequestsUnavailable)
+}
+
+func TestPrivacyRequestVerifyWindow(t *testing.T) {
+	ps, db, _ := newPrivacyRequestService(t)
+	ctx := context.Background()
+
+	stale, staleToken, err := ps.Submit(ctx, PrivacyRequestInput{Type: PrivacyRequestErasure}, "stale-session")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(stale).Update("submitted_at", time.Now().Add(-privacyVerifyWindow-time.Hour)).Error)
+	_, err = ps.Verify(ctx, staleToken)
+	assert.ErrorIs(t, err, ErrInvalidPrivacyToken)
+
+	fresh, freshToken, err := ps.Submit(ctx, PrivacyRequestInput{Type: PrivacyRequestErasure}, "fresh-session")
+	require.NoError(t, err)
+	require.NoError(t, db.Model(fresh).Update("submitted_at", time.Now().Add(-privacyVerifyWindow+time.Hour)).Error)
+	verified, err := ps.Verify(ctx, freshToken)
+	require.NoError(t, err)
+	assert.Equal(t, PrivacyStatusVerified, verified.Status)
+
+	again, err := ps.Verify(ctx, freshToken)
+	require.NoError(t, err, "verifying twice is harmless")
+	assert.Equal(t, PrivacyStatusVerified, again.Status)
+
+	// Unverified requests past the window are closed by the worker
+	_, err = ps.ProcessPending(ctx, 10)
+	require.NoError(t, err)
+	var status string
+	require.NoError(t, db.Model(&PrivacyRequest{}).Where("id = ?", stale.ID).Pluck("status", &status).Error)
+	assert.Equal(t, PrivacyStatusExpired, status)
+}
+
+func TestPrivacyRequestLifecycle(t *testing.T) {
+	ps, db, mailer := newPrivacyRequestService(t)
+	ctx := context.Background()
+	require.NoError(t, db.Exec("INSERT INTO contact_submissions (name, email, subject, message, created_at) VALUES (?, ?, ?, ?, ?)",
+		"Ada", "Ada@Example.com", "Hello", "Hi there", time.Now()).Error)
+
+	t.Run("export", func(t *testing.T) {
+		req, token, err := ps.Submit(ctx, PrivacyRequestInput{
+			Type: PrivacyRequestExport, Method: VerifyByEmail, Email: "Ada <ada@example.com>", Format: ExportFormatJSON,
+		}, "")
+		require.NoError(t, err)
+		assert.Empty(t, token, "email tokens only go to the mailbox")
+		assert.Equal(t, "ada@example.com", req.Email)
+		require.Len(t, mailer.sent, 1)
+		assert.Equal(t, "ada@example.com", mailer.sent[0].to)
+
+		_, _, err = ps.ExportFile(ctx, mailer.token(t))
+		assert.ErrorIs(t, err, ErrExportNotReady)
+
+		verified, err := ps.Verify(ctx, mailer.token(t))
+		require.NoError(t, err)
+		assert.Equal(t, PrivacyStatusVerified, verified.Status)
+
+		processed, err := ps.ProcessPending(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		require.Len(t, mailer.sent, 2, "the subject is told where to download the export")
+		fulfilled, path, err := ps.ExportFile(ctx, mailer.token(t))
+		require.NoError(t, err)
+		assert.Equal(t, PrivacyStatusFulfilled, fulfilled.Status)
+		assert.NotNil(t, fulfilled.FulfilledAt)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var export map[string]json.RawMessage
+		require.NoError(t, json.Unmarshal(data, &export))
+		assert.Contains(t, string(export["contact_submissions"]), "Hi there")
+
+		var audited int64
+		require.NoError(t, db.Model(&ConsentAuditLog{}).Where("action = ?", "privacy_export_fulfilled").Count(&audited).Error)
+		assert.EqualValues(t, 1, audited)
+	})
+
+	t.Run("erasure", func(t *testing.T) {
+		_, _, err := ps.Submit(ctx, PrivacyRequestInput{Type: PrivacyRequestErasure, Method: VerifyByEmail, Email: "ada@example.com"}, "")
+		require.NoError(t, err)
+		_, err = ps.Verify(ctx, mailer.token(t))
+		require.NoError(t, err)
+
+		processed, err := ps.ProcessPending(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		var remaining int64
+		require.NoError(t, db.Table("contact_submissions").Count(&remaining).Error)
+		assert.Zero(t, remaining)
+		assert.Contains(t, mailer.sent[len(mailer.sent)-1].body, "erased")
+	})
+
+	t.Run("failures are retried", func(t *testing.T) {
+		// The export directory cannot be created below a file
+		blocker := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(blocker, nil, 0o600))
+		ps.config.ExportDir = filepath.Join(blocker, "exports")
+
+		req, _, err := ps.Submit(ctx, PrivacyRequestInput{Type: PrivacyRequestExport, Method: VerifyByEmail, Email: "ada@example.com"}, "")
+		require.NoError(t, err)
+		_, err = ps.Verify(ctx, mailer.token(t))
+		require.NoError(t, err)
+
+		processed, err := ps.ProcessPending(ctx, 10)
+		require.NoError(t, err)
+		assert.Zero(t, processed)
+
+		failed, err := ps.get(ctx, req.ID)
+		require.NoError(t, err)
+		assert.Equal(t, PrivacyStatusVerified, failed.Status)
+		assert.Equal(t, 1, failed.Attempts)
+		assert.Contains(t, failed.LastError, "export directory")
+	})
+}
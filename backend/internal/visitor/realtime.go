@@ -0,0 +1,307 @@
+package visitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// realtimeChannel is the pub/sub channel shared by all API instances
+	realtimeChannel = "visitor:realtime"
+	// defaultRealtimeDebounce is how long events are collected before they
+	// are pushed to subscribers as a single update
+	defaultRealtimeDebounce = 2 * time.Second
+	// realtimeHeartbeat refreshes the active count while the site is quiet so
+	// visitors leaving the 5 minute window are reflected
+	realtimeHeartbeat = 30 * time.Second
+	// realtimeWindow is the activity window for active visitors and top pages
+	realtimeWindow = 5 * time.Minute
+	// maxPendingRealtimeEvents bounds the events carried by a single update
+	maxPendingRealtimeEvents = 100
+	// realtimeResubscribeDelay is the pause before resubscribing after the
+	// bus subscription fails or closes
+	realtimeResubscribeDelay = 5 * time.Second
+)
+
+// Realtime event types
+const (
+	RealtimeEventSession  = "session"
+	RealtimeEventPageView = "pageview"
+)
+
+// RealtimeEvent is an incremental visitor event. It carries no session
+// identifier so subscribers only ever see aggregate-safe fields.
+type RealtimeEvent struct {
+	Type        string    `json:"type"`
+	Path        string    `json:"path,omitempty"`
+	Channel     string    `json:"channel,omitempty"`
+	DeviceType  string    `json:"deviceType,omitempty"`
+	CountryCode string    `json:"countryCode,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// ActivePage counts visitors currently on a page
+type ActivePage struct {
+	Page  string `json:"page"`
+	Count int    `json:"count"`
+}
+
+// RealtimeSnapshot is the current realtime state
+type RealtimeSnapshot struct {
+	ActiveVisitors int          `json:"activeVisitors"`
+	ActivePages    []ActivePage `json:"activePages"`
+	Timestamp      time.Time    `json:"timestamp"`
+}
+
+// RealtimeUpdate is the message pushed to WebSocket subscribers
+type RealtimeUpdate struct {
+	Type     string            `json:"type"`
+	Events   []RealtimeEvent   `json:"events"`
+	Dropped  int               `json:"dropped,omitempty"`
+	Snapshot *RealtimeSnapshot `json:"snapshot"`
+}
+
+// RealtimeBus fans realtime events out to every API instance
+type RealtimeBus interface {
+	Publish(ctx context.Context, message []byte) error
+	// Subscribe delivers published messages until ctx is cancelled
+	Subscribe(ctx context.Context) (<-chan []byte, error)
+}
+
+// MemoryBus is an in-process RealtimeBus for single-node and test setups
+type MemoryBus struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+}
+
+// NewMemoryBus creates a new in-process bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subscribers: make(map[chan []byte]struct{})}
+}
+
+// Publish delivers a message to every subscriber. Slow subscribers miss
+// messages rather than blocking the publisher.
+func (b *MemoryBus) Publish(ctx context.Context, message []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- message:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber until ctx is cancelled
+func (b *MemoryBus) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	sub := make(chan []byte, 64)
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers, sub)
+		close(sub)
+		b.mu.Unlock()
+	}()
+
+	return sub, nil
+}
+
+// pubsubBackend is the subset of the secure cache used for pub/sub
+type pubsubBackend interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+}
+
+// RedisBus shares realtime events between instances through Redis pub/sub
+type RedisBus struct {
+	backend pubsubBackend
+	channel string
+}
+
+// NewRedisBus creates a bus on the shared realtime channel
+func NewRedisBus(backend pubsubBackend) *RedisBus {
+	return &RedisBus{backend: backend, channel: realtimeChannel}
+}
+
+// Publish sends a message to all instances, including this one
+func (b *RedisBus) Publish(ctx context.Context, message []byte) error {
+	return b.backend.Publish(ctx, b.channel, message)
+}
+
+// Subscribe listens on the shared channel until ctx is cancelled
+func (b *RedisBus) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	return b.backend.Subscribe(ctx, b.channel)
+}
+
+// realtimeStream turns bus events into debounced hub broadcasts. Every
+// instance runs one and pushes to its own WebSocket subscribers.
+type realtimeStream struct {
+	bus      RealtimeBus
+	hub      *Hub
+	snapshot func(ctx context.Context) (*RealtimeSnapshot, error)
+	debounce time.Duration
+}
+
+func newRealtimeStream(bus RealtimeBus, hub *Hub, snapshot func(ctx context.Context) (*RealtimeSnapshot, error), debounce time.Duration) *realtimeStream {
+	if debounce <= 0 {
+		debounce = defaultRealtimeDebounce
+	}
+	return &realtimeStream{bus: bus, hub: hub, snapshot: snapshot, debounce: debounce}
+}
+
+// publish sends an event to every instance without blocking the caller
+func (r *realtimeStream) publish(event RealtimeEvent) {
+	event.Timestamp = time.Now()
+	message, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := r.bus.Publish(ctx, message); err != nil {
+			fmt.Printf("Failed to publish realtime event: %v\n", err)
+		}
+	}()
+}
+
+// Run consumes the bus until ctx is cancelled. Events arriving within the
+// debounce interval are coalesced into one update together with a fresh
+// snapshot of the active visitors and pages.
+func (r *realtimeStream) Run(ctx context.Context) {
+	heartbeat := time.NewTicker(realtimeHeartbeat)
+	defer heartbeat.Stop()
+
+	var (
+		messages <-chan []byte
+		pending  []RealtimeEvent
+		dropped  int
+		timer    *time.Timer
+		flushC   <-chan time.Time
+		retryC   <-chan time.Time
+	)
+
+	subscribe := func() {
+		var err error
+		messages, err = r.bus.Subscribe(ctx)
+		if err != nil {
+			fmt.Printf("Failed to subscribe to realtime events: %v\n", err)
+			messages = nil
+			retryC = time.After(realtimeResubscribeDelay)
+		}
+	}
+	subscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+
+		case <-retryC:
+			retryC = nil
+			subscribe()
+
+		case message, ok := <-messages:
+			if !ok {
+				messages = nil
+				retryC = time.After(realtimeResubscribeDelay)
+				continue
+			}
+
+			var event RealtimeEvent
+			if err := json.Unmarshal(message, &event); err != nil {
+				continue
+			}
+			if len(pending) < maxPendingRealtimeEvents {
+				pending = append(pending, event)
+			} else {
+				dropped++
+			}
+			if flushC == nil {
+				timer = time.NewTimer(r.debounce)
+				flushC = timer.C
+			}
+
+		case <-flushC:
+			r.flush(ctx, pending, dropped)
+			pending, dropped, timer, flushC = nil, 0, nil, nil
+
+		case <-heartbeat.C:
+			if flushC == nil {
+				r.flush(ctx, nil, 0)
+			}
+		}
+	}
+}
+
+// flush pushes an update to this instance's subscribers. Nothing is queried
+// while nobody is listening.
+func (r *realtimeStream) flush(ctx context.Context, events []RealtimeEvent, dropped int) {
+	if r.hub.ClientCount() == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	snapshot, err := r.snapshot(ctx)
+	if err != nil {
+		fmt.Printf("Failed to build realtime snapshot: %v\n", err)
+		return
+	}
+
+	if events == nil {
+		events = []RealtimeEvent{}
+	}
+	message, err := json.Marshal(RealtimeUpdate{
+		Type:     "realtime",
+		Events:   events,
+		Dropped:  dropped,
+		Snapshot: snapshot,
+	})
+	if err != nil {
+		return
+	}
+
+	select {
+	case r.hub.broadcast <- message:
+	case <-ctx.Done():
+	}
+}
+
+// GetRealtimeSnapshot returns the active visitor count and the most visited
+// pages within the realtime window
+func (s *Service) GetRealtimeSnapshot(ctx context.Context) (*RealtimeSnapshot, error) {
+	snapshot := &RealtimeSnapshot{
+		ActiveVisitors: s.GetRealTimeCount(ctx),
+		ActivePages:    []ActivePage{},
+		Timestamp:      time.Now(),
+	}
+
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT current_page as page, COUNT(*) as count
+		FROM visitor_realtime
+		WHERE last_activity > ?
+		GROUP BY current_page
+		ORDER BY count DESC
+		LIMIT 10
+	`, time.Now().Add(-realtimeWindow)).Scan(&snapshot.ActivePages).Error; err != nil {
+		return nil, fmt.Errorf("failed to query active pages: %w", err)
+	}
+
+	return snapshot, nil
+}
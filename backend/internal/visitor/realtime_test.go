@@ -0,0 +1,192 @@
+package visitor
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, ch <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case message, ok := <-ch:
+		require.True(t, ok, "channel closed")
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func assertNoMessage(t *testing.T, ch <-chan []byte, wait time.Duration) {
+	t.Helper()
+	select {
+	case message := <-ch:
+		t.Fatalf("unexpected message %s", message)
+	case <-time.After(wait):
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+	ctx := context.Background()
+
+	firstCtx, cancelFirst := context.WithCancel(ctx)
+	defer cancelFirst()
+	first, err := bus.Subscribe(firstCtx)
+	require.NoError(t, err)
+	secondCtx, cancelSecond := context.WithCancel(ctx)
+	second, err := bus.Subscribe(secondCtx)
+	require.NoError(t, err)
+
+	require.NoError(t, bus.Publish(ctx, []byte("hello")))
+	assert.Equal(t, "hello", string(receive(t, first)))
+	assert.Equal(t, "hello", string(receive(t, second)))
+
+	// Cancelling a subscription closes its channel and unregisters it
+	cancelSecond()
+	select {
+	case _, ok := <-second:
+		assert.False(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscription was not closed")
+	}
+	require.Eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.subscribers) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, bus.Publish(ctx, []byte("again")))
+	assert.Equal(t, "again", string(receive(t, first)))
+
+	// A subscriber that stops reading misses messages instead of blocking
+	// the publisher
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 200; i++ {
+			bus.Publish(ctx, []byte("flood"))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(2 * time.Second):
+		t.Fatal("publishing blocked on a slow subscriber")
+	}
+	assert.Len(t, first, cap(first))
+}
+
+// testStream runs a realtime stream over bus with one WebSocket client
+// connected and counts the snapshots it builds
+func testStream(t *testing.T, bus RealtimeBus, debounce time.Duration) (*Hub, *atomic.Int32) {
+	t.Helper()
+	hub := NewHub()
+	hub.clients[&websocket.Conn{}] = true
+
+	var snapshots atomic.Int32
+	stream := newRealtimeStream(bus, hub, func(ctx context.Context) (*RealtimeSnapshot, error) {
+		snapshots.Add(1)
+		return &RealtimeSnapshot{ActiveVisitors: 3, ActivePages: []ActivePage{{Page: "/", Count: 3}}}, nil
+	}, debounce)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go stream.Run(ctx)
+	return hub, &snapshots
+}
+
+func decodeUpdate(t *testing.T, message []byte) RealtimeUpdate {
+	t.Helper()
+	var update RealtimeUpdate
+	require.NoError(t, json.Unmarshal(message, &update))
+	return update
+}
+
+func TestRealtimeStreamDebounces(t *testing.T) {
+	bus := NewMemoryBus()
+	hub, snapshots := testStream(t, bus, 100*time.Millisecond)
+	require.Eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.subscribers) == 1
+	}, 2*time.Second, 10*time.Millisecond, "stream did not subscribe")
+
+	publish := func(event RealtimeEvent) {
+		message, err := json.Marshal(event)
+		require.NoError(t, err)
+		require.NoError(t, bus.Publish(context.Background(), message))
+	}
+
+	start := time.Now()
+	publish(RealtimeEvent{Type: RealtimeEventSession, Channel: "direct"})
+	publish(RealtimeEvent{Type: RealtimeEventPageView, Path: "/"})
+	require.NoError(t, bus.Publish(context.Background(), []byte("not json")))
+	publish(RealtimeEvent{Type: RealtimeEventPageView, Path: "/blog"})
+
+	update := decodeUpdate(t, receive(t, hub.broadcast))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, "realtime", update.Type)
+	require.Len(t, update.Events, 3, "events within the debounce are sent together")
+	assert.Equal(t, RealtimeEventSession, update.Events[0].Type)
+	assert.Equal(t, "/blog", update.Events[2].Path)
+	assert.Zero(t, update.Dropped)
+	require.NotNil(t, update.Snapshot)
+	assert.Equal(t, 3, update.Snapshot.ActiveVisitors)
+	assert.Equal(t, int32(1), snapshots.Load(), "one snapshot is built per update")
+
+	assertNoMessage(t, hub.broadcast, 200*time.Millisecond)
+
+	publish(RealtimeEvent{Type: RealtimeEventPageView, Path: "/contact"})
+	update = decodeUpdate(t, receive(t, hub.broadcast))
+	require.Len(t, update.Events, 1, "a later event starts a new update")
+	assert.Equal(t, "/contact", update.Events[0].Path)
+	assert.Equal(t, int32(2), snapshots.Load())
+}
+
+// channelBus hands out a single prefilled subscription
+type channelBus struct {
+	messages chan []byte
+}
+
+func (b *channelBus) Publish(ctx context.Context, message []byte) error {
+	b.messages <- message
+	return nil
+}
+
+func (b *channelBus) Subscribe(ctx context.Context) (<-chan []byte, error) {
+	return b.messages, nil
+}
+
+func TestRealtimeStreamDropsExcessEvents(t *testing.T) {
+	const extra = 5
+	bus := &channelBus{messages: make(chan []byte, maxPendingRealtimeEvents+extra)}
+	message, err := json.Marshal(RealtimeEvent{Type: RealtimeEventPageView, Path: "/"})
+	require.NoError(t, err)
+	for i := 0; i < maxPendingRealtimeEvents+extra; i++ {
+		require.NoError(t, bus.Publish(context.Background(), message))
+	}
+
+	hub, _ := testStream(t, bus, 50*time.Millisecond)
+	update := decodeUpdate(t, receive(t, hub.broadcast))
+	assert.Len(t, update.Events, maxPendingRealtimeEvents)
+	assert.Equal(t, extra, update.Dropped)
+}
+
+func TestRealtimeStreamSkipsUpdatesWithoutClients(t *testing.T) {
+	bus := &channelBus{messages: make(chan []byte, 1)}
+	hub, snapshots := testStream(t, bus, 10*time.Millisecond)
+	hub.mutex.Lock()
+	clear(hub.clients)
+	hub.mutex.Unlock()
+
+	require.NoError(t, bus.Publish(context.Background(), []byte(`{"type":"pageview","path":"/"}`)))
+	assertNoMessage(t, hub.broadcast, 100*time.Millisecond)
+	assert.Zero(t, snapshots.Load(), "nothing is queried while nobody is listening")
+}
@@ -0,0 +1,82 @@
+package visitor
+
+import (
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
+)
+
+// sessionDependents are removed in batches ahead of their sessions, whose
+// deletion would otherwise cascade to every page view at once
+var sessionDependents = []retention.Dependent{
+	{Table: "page_views", ForeignKey: "session_id"},
+}
+
+// RetentionDatasets returns the visitor analytics datasets and their retention
+// rules. Periods are read from the privacy configuration on every run, and all
+// datasets are disabled while auto-delete is turned off.
+func RetentionDatasets(config *ConfigService) []retention.Dataset {
+	days := func(pick func(RetentionConfig) int) func() time.Duration {
+		return func() time.Duration {
+			cfg := config.GetConfig().Retention
+			if !cfg.EnableAutoDelete {
+				return 0
+			}
+			return retention.Days(pick(cfg))
+		}
+	}
+
+	return []retention.Dataset{
+		{
+			Name:        "visitor.sessions",
+			Description: "Visitor sessions; page views are removed with their session",
+			Table:       "visitor_sessions",
+			TimeColumn:  "created_at",
+			Retention:   days(func(c RetentionConfig) int { return c.SessionDataDays }),
+			Dependents:  sessionDependents,
+		},
+		{
+			Name:        "visitor.inactive_sessions",
+			Description: "Visitor sessions not seen for the inactivity period",
+			Table:       "visitor_sessions",
+			TimeColumn:  "last_seen_at",
+			Retention:   days(func(c RetentionConfig) int { return c.DeleteInactiveAfter }),
+			Dependents:  sessionDependents,
+		},
+		{
+			Name:        "visitor.page_views",
+			Description: "Individual page views",
+			Table:       "page_views",
+			TimeColumn:  "created_at",
+			Retention:   days(func(c RetentionConfig) int { return c.PageViewDataDays }),
+		},
+		{
+			Name:        "visitor.events",
+			Description: "Custom visitor events",
+			Table:       "visitor_events",
+			TimeColumn:  "created_at",
+			Retention:   days(func(c RetentionConfig) int { return c.PageViewDataDays }),
+		},
+		{
+			Name:        "visitor.web_vitals",
+			Description: "Hourly web vitals percentiles",
+			Table:       "web_vital_rollups",
+			TimeColumn:  "hour",
+			Retention:   days(func(c RetentionConfig) int { return c.PageViewDataDays }),
+		},
+		{
+			Name:        "visitor.consents",
+			Description: "Privacy consent records",
+			Table:       "privacy_consents",
+			TimeColumn:  "created_at",
+			Retention:   days(func(c RetentionConfig) int { return c.ConsentRecordDays }),
+		},
+		{
+			Name:        "visitor.consent_audit_logs",
+			Description: "Consent change and erasure audit trail",
+			Table:       "consent_audit_logs",
+			TimeColumn:  "timestamp",
+			Retention:   days(func(c RetentionConfig) int { return c.ConsentRecordDays }),
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package visitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
+)
+
+func TestRetentionDatasetsRemovePageViewsBeforeSessions(t *testing.T) {
+	// Page views reference their session without cascading, so a session
+	// can only be removed once its page views are gone
+	db, err := gorm.Open(sqlite.Open(":memory:?_pragma=foreign_keys(1)"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	for _, statement := range []string{
+		`CREATE TABLE retention_runs (
+			id TEXT PRIMARY KEY, dry_run BOOLEAN, "trigger" TEXT, status TEXT, total_rows INTEGER,
+			results TEXT, started_at DATETIME, finished_at DATETIME)`,
+		`CREATE TABLE visitor_sessions (id TEXT PRIMARY KEY, created_at DATETIME, last_seen_at DATETIME)`,
+		`CREATE TABLE page_views (id TEXT PRIMARY KEY, session_id TEXT REFERENCES visitor_sessions(id), created_at DATETIME)`,
+		`CREATE TABLE visitor_events (id TEXT PRIMARY KEY, created_at DATETIME)`,
+		`CREATE TABLE web_vital_rollups (id TEXT PRIMARY KEY, hour DATETIME)`,
+		`CREATE TABLE privacy_consents (id TEXT PRIMARY KEY, created_at DATETIME)`,
+		`CREATE TABLE consent_audit_logs (id TEXT PRIMARY KEY, timestamp DATETIME)`,
+	} {
+		require.NoError(t, db.Exec(statement).Error)
+	}
+
+	// An expired session whose page views are recent enough to keep on
+	// their own, and a current one
+	session := func(age time.Duration) {
+		id := uuid.New()
+		createdAt := time.Now().Add(-age)
+		require.NoError(t, db.Exec("INSERT INTO visitor_sessions (id, created_at, last_seen_at) VALUES (?, ?, ?)",
+			id, createdAt, time.Now()).Error)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, db.Exec("INSERT INTO page_views (id, session_id, created_at) VALUES (?, ?, ?)",
+				uuid.New(), id, time.Now()).Error)
+		}
+	}
+	session(40 * 24 * time.Hour)
+	session(time.Hour)
+
+	config := &ConfigService{}
+	engine := retention.NewEngine(db, retention.Options{BatchSize: 2, BatchPause: -1})
+	require.NoError(t, engine.Register(RetentionDatasets(config)...))
+
+	config.GetConfig().Retention.EnableAutoDelete = false
+	run, err := engine.Run(context.Background(), false, "test")
+	require.NoError(t, err)
+	for _, result := range run.Results {
+		assert.True(t, result.Skipped, result.Dataset)
+	}
+
+	config.GetConfig().Retention.EnableAutoDelete = true
+	run, err = engine.Run(context.Background(), false, "test")
+	require.NoError(t, err)
+	assert.Equal(t, retention.RunStatusCompleted, run.Status)
+
+	var sessions, pageViews int64
+	require.NoError(t, db.Table("visitor_sessions").Count(&sessions).Error)
+	require.NoError(t, db.Table("page_views").Count(&pageViews).Error)
+	assert.EqualValues(t, 1, sessions)
+	assert.EqualValues(t, 3, pageViews)
+}
@@ -0,0 +1,143 @@
+package visitor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// saltBytes is the size of a generated daily salt
+const saltBytes = 32
+
+// SaltStore hands out the salt for the current UTC day. Salts are never
+// written to the database, so once a day's salt is discarded the hashes built
+// from it can no longer be linked to a visitor.
+type SaltStore interface {
+	// CurrentSalt returns today's salt and the time it rotates
+	CurrentSalt(ctx context.Context) ([]byte, time.Time, error)
+}
+
+// saltDay returns the UTC day key for t and the time that day ends
+func saltDay(t time.Time) (string, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, nil
+}
+
+// MemorySaltStore keeps only the current day's salt in process memory. It is
+// suitable for single-instance deployments; a restart rotates the salt early.
+type MemorySaltStore struct {
+	mu   sync.Mutex
+	day  string
+	salt []byte
+	now  func() time.Time
+}
+
+// NewMemorySaltStore creates a new in-memory salt store
+func NewMemorySaltStore() *MemorySaltStore {
+	return &MemorySaltStore{now: time.Now}
+}
+
+// CurrentSalt returns today's salt, replacing yesterday's on the first call
+// after midnight UTC
+func (m *MemorySaltStore) CurrentSalt(ctx context.Context) ([]byte, time.Time, error) {
+	day, rotatesAt := saltDay(m.now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.day != day {
+		salt, err := newSalt()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		m.day, m.salt = day, salt
+	}
+
+	return m.salt, rotatesAt, nil
+}
+
+// saltBackend is the subset of the secure cache used to share salts
+type saltBackend interface {
+	SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error)
+	GetDecrypted(ctx context.Context, key string, dest interface{}) error
+}
+
+// RedisSaltStore shares the daily salt between instances through Redis. The
+// key expires when the day ends so the salt never outlives it.
+type RedisSaltStore struct {
+	backend saltBackend
+	mu      sync.Mutex
+	day     string
+	salt    []byte
+	now     func() time.Time
+}
+
+// NewRedisSaltStore creates a salt store backed by the encrypted cache
+func NewRedisSaltStore(backend saltBackend) *RedisSaltStore {
+	return &RedisSaltStore{backend: backend, now: time.Now}
+}
+
+// CurrentSalt returns today's shared salt. The first instance to ask after
+// midnight generates it; the others read the winner's value.
+func (r *RedisSaltStore) CurrentSalt(ctx context.Context) ([]byte, time.Time, error) {
+	day, rotatesAt := saltDay(r.now())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.day == day {
+		return r.salt, rotatesAt, nil
+	}
+
+	key := "visitor:salt:" + day
+	ttl := rotatesAt.Sub(r.now())
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+
+	candidate, err := newSalt()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if _, err := r.backend.SetNX(ctx, key, hex.EncodeToString(candidate), ttl); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to store salt: %w", err)
+	}
+
+	var encoded string
+	if err := r.backend.GetDecrypted(ctx, key, &encoded); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load salt: %w", err)
+	}
+	salt, err := hex.DecodeString(encoded)
+	if err != nil || len(salt) != saltBytes {
+		return nil, time.Time{}, fmt.Errorf("invalid salt stored under %s", key)
+	}
+
+	r.day, r.salt = day, salt
+	return salt, rotatesAt, nil
+}
+
+// cookielessHash derives a visitor identifier from the daily salt, site, IP
+// address and user agent. The same visitor gets a new, unlinkable hash every
+// day, and no cookie or stored identifier is needed.
+func cookielessHash(salt []byte, site, ip, userAgent string) string {
+	h := sha256.New()
+	h.Write(salt)
+	for _, part := range []string{site, ip, userAgent} {
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package visitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// fakeSaltBackend emulates the SetNX/GetDecrypted pair of the secure cache
+type fakeSaltBackend struct {
+	mu     sync.Mutex
+	values map[string]string
+	ttls   map[string]time.Duration
+}
+
+func newFakeSaltBackend() *fakeSaltBackend {
+	return &fakeSaltBackend{values: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (f *fakeSaltBackend) SetNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.values[key]; ok {
+		return false, nil
+	}
+	f.values[key] = value.(string)
+	f.ttls[key] = ttl
+	return true, nil
+}
+
+func (f *fakeSaltBackend) GetDecrypted(ctx context.Context, key string, dest interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	*dest.(*string) = f.values[key]
+	return nil
+}
+
+func TestMemorySaltStore_RotatesDaily(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)}
+	store := NewMemorySaltStore()
+	store.now = clock.now
+	ctx := context.Background()
+
+	first, rotatesAt, err := store.CurrentSalt(ctx)
+	require.NoError(t, err)
+	assert.Len(t, first, saltBytes)
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), rotatesAt)
+
+	clock.t = clock.t.Add(14*time.Hour + 59*time.Minute)
+	same, _, err := store.CurrentSalt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, first, same, "salt must be stable within a day")
+
+	clock.t = time.Date(2024, 3, 11, 0, 0, 1, 0, time.UTC)
+	next, rotatesAt, err := store.CurrentSalt(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, next, "salt must rotate after midnight UTC")
+	assert.Equal(t, time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC), rotatesAt)
+}
+
+func TestMemorySaltStore_UsesUTCDay(t *testing.T) {
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	clock := &fakeClock{t: time.Date(2024, 3, 10, 20, 0, 0, 0, loc)}
+	store := NewMemorySaltStore()
+	store.now = clock.now
+
+	_, rotatesAt, err := store.CurrentSalt(context.Background())
+	require.NoError(t, err)
+	// 20:00 at UTC-5 is already 01:00 on the 11th in UTC
+	assert.Equal(t, time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC), rotatesAt)
+}
+
+func TestRedisSaltStore_SharedAndRotates(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 3, 10, 18, 0, 0, 0, time.UTC)}
+	backend := newFakeSaltBackend()
+	ctx := context.Background()
+
+	a := NewRedisSaltStore(backend)
+	a.now = clock.now
+	b := NewRedisSaltStore(backend)
+	b.now = clock.now
+
+	saltA, rotatesAt, err := a.CurrentSalt(ctx)
+	require.NoError(t, err)
+	saltB, _, err := b.CurrentSalt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, saltA, saltB, "instances must share the day's salt")
+	assert.Equal(t, time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), rotatesAt)
+	assert.Equal(t, 6*time.Hour, backend.ttls["visitor:salt:2024-03-10"], "salt must expire at midnight")
+
+	clock.t = time.Date(2024, 3, 11, 0, 0, 1, 0, time.UTC)
+	nextA, _, err := a.CurrentSalt(ctx)
+	require.NoError(t, err)
+	nextB, _, err := b.CurrentSalt(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, saltA, nextA)
+	assert.Equal(t, nextA, nextB)
+}
+
+func TestCookielessHash(t *testing.T) {
+	day1 := []byte("salt-for-day-one")
+	day2 := []byte("salt-for-day-two")
+
+	h1 := cookielessHash(day1, "example.com", "203.0.113.7", "Mozilla/5.0")
+	assert.Len(t, h1, 64)
+	assert.Equal(t, h1, cookielessHash(day1, "example.com", "203.0.113.7", "Mozilla/5.0"))
+	assert.NotEqual(t, h1, cookielessHash(day2, "example.com", "203.0.113.7", "Mozilla/5.0"),
+		"the same visitor must not be linkable across days")
+	assert.NotEqual(t, h1, cookielessHash(day1, "other.example", "203.0.113.7", "Mozilla/5.0"))
+	// Field separators prevent ambiguous concatenations
+	assert.NotEqual(t, cookielessHash(day1, "ab", "c", ""), cookielessHash(day1, "a", "bc", ""))
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/JadenRazo/Project-Website/backend/internal/common/cache"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/metrics"
 	"github.com/JadenRazo/Project-Website/backend/internal/core"
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
 )
 
 var geoClient = &http.Client{Timeout: 3 * time.Second}
@@ -52,6 +53,14 @@ type Service struct {
 	metrics *metrics.Manager
 	config  Config
 	hub     *Hub
+
+	privacy         *ConfigService
+	compliance      *ComplianceService
+	privacyRequests *PrivacyRequestService
+	salts           SaltStore
+	realtime        *realtimeStream
+	vitals          *vitalsBuffer
+	stopBackground  context.CancelFunc
 }
 
 // Config holds visitor service configuration
@@ -62,24 +71,81 @@ type Config struct {
 	MaxPageViewsPerSession int
 	EnableBotDetection bool
 	PrivacyMode        string // "strict", "balanced", "minimal"
+	PrivacyRequests    PrivacyRequestConfig
+	// Cookieless hashes IP, user agent and site with a salt rotated daily
+	// and kept only in memory or Redis, so no identifier outlives the day
+	Cookieless bool
+	// RealtimeDebounce is how long realtime events are coalesced before
+	// being pushed to WebSocket subscribers, defaults to 2s
+	RealtimeDebounce time.Duration
 }
 
 // NewService creates a new visitor service
 func NewService(db *gorm.DB, cache *cache.SecureCache, metrics *metrics.Manager, config Config) *Service {
 	hub := NewHub()
 	go hub.Run()
-	return &Service{
-		BaseService: core.NewBaseService("visitor"),
-		db:          db,
-		cache:       cache,
-		metrics:     metrics,
-		config:      config,
-		hub:         hub,
+	privacy := NewConfigService(db)
+	compliance := NewComplianceService(db, privacy)
+
+	var salts SaltStore
+	if config.Cookieless {
+		if cache != nil {
+			salts = NewRedisSaltStore(cache)
+		} else {
+			salts = NewMemorySaltStore()
+		}
+	}
+
+	// Realtime events are shared through Redis when available so every
+	// instance can push them to its own subscribers
+	var bus RealtimeBus = NewMemoryBus()
+	if cache != nil {
+		bus = NewRedisBus(cache)
+	}
+
+	s := &Service{
+		BaseService:     core.NewBaseService("visitor"),
+		db:              db,
+		cache:           cache,
+		metrics:         metrics,
+		config:          config,
+		hub:             hub,
+		privacy:         privacy,
+		compliance:      compliance,
+		privacyRequests: NewPrivacyRequestService(db, compliance, config.PrivacyRequests),
+		salts:           salts,
+		vitals:          newVitalsBuffer(),
 	}
+
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	s.realtime = newRealtimeStream(bus, hub, s.GetRealtimeSnapshot, config.RealtimeDebounce)
+	s.stopBackground = stopBackground
+	go s.realtime.Run(backgroundCtx)
+	go s.runVitalsRollup(backgroundCtx)
+
+	return s
 }
 
-// TrackPageView tracks a page view for the current session
+// PrivacyRequests returns the data subject request service
+func (s *Service) PrivacyRequests() *PrivacyRequestService {
+	return s.privacyRequests
+}
+
+// SetRetentionEngine sets the shared retention engine compliance runs use
+func (s *Service) SetRetentionEngine(engine *retention.Engine) {
+	s.compliance.SetRetentionEngine(engine)
+}
+
+// TrackPageView tracks a page view for the current session, attributing it
+// from the request query string and Referer header
 func (s *Service) TrackPageView(ctx context.Context, r *http.Request, path string) error {
+	return s.TrackPageViewWithAttribution(ctx, r, path, ParseAttribution(r.URL.Query(), r.Header.Get("Referer"), r.Host))
+}
+
+// TrackPageViewWithAttribution tracks a page view using an explicit
+// attribution. Channel and UTM parameters are only stored on the first page
+// view of a session.
+func (s *Service) TrackPageViewWithAttribution(ctx context.Context, r *http.Request, path string, attribution Attribution) error {
 	if !s.config.EnableTracking {
 		return nil
 	}
@@ -97,7 +163,7 @@ func (s *Service) TrackPageView(ctx context.Context, r *http.Request, path strin
 		consent = &ConsentStatus{Analytics: false}
 	}
 
-	if !consent.Analytics && s.config.PrivacyMode == "strict" {
+	if !consent.Analytics && !session.Cookieless && s.config.PrivacyMode == "strict" {
 		return nil // Don't track without consent in strict mode
 	}
 
@@ -105,9 +171,17 @@ func (s *Service) TrackPageView(ctx context.Context, r *http.Request, path strin
 	pageView := &PageView{
 		SessionID:      session.ID,
 		Path:           path,
-		ReferrerDomain: s.extractReferrerDomain(r.Header.Get("Referer")),
+		ReferrerDomain: attribution.ReferrerDomain,
 		CreatedAt:      time.Now(),
 	}
+	if isNew {
+		pageView.Channel = attribution.Channel
+		pageView.UTMSource = attribution.UTMSource
+		pageView.UTMMedium = attribution.UTMMedium
+		pageView.UTMCampaign = attribution.UTMCampaign
+		pageView.UTMTerm = attribution.UTMTerm
+		pageView.UTMContent = attribution.UTMContent
+	}
 
 	if err := s.db.Create(pageView).Error; err != nil {
 		return fmt.Errorf("failed to create page view: %w", err)
@@ -125,25 +199,17 @@ func (s *Service) TrackPageView(ctx context.Context, r *http.Request, path strin
 		fmt.Printf("Failed to update realtime tracking: %v\n", err)
 	}
 
-	// Broadcast page view event
-	go func() {
-		broadcastCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		realtimeCount := s.GetRealTimeCount(broadcastCtx)
-		message, err := json.Marshal(map[string]interface{}{
-			"type":      "pageview",
-			"path":      path,
-			"realtime":  realtimeCount,
+	// Push realtime events to devpanel subscribers
+	if isNew {
+		s.realtime.publish(RealtimeEvent{
+			Type:        RealtimeEventSession,
+			Path:        path,
+			Channel:     attribution.Channel,
+			DeviceType:  session.DeviceType,
+			CountryCode: session.CountryCode,
 		})
-		if err == nil {
-			select {
-			case s.hub.broadcast <- message:
-			case <-broadcastCtx.Done():
-				return
-			}
-		}
-	}()
+	}
+	s.realtime.publish(RealtimeEvent{Type: RealtimeEventPageView, Path: path})
 
 	// Record metrics
 	if s.metrics != nil {
@@ -158,7 +224,10 @@ func (s *Service) TrackPageView(ctx context.Context, r *http.Request, path strin
 
 // getOrCreateSession gets existing session or creates new one
 func (s *Service) getOrCreateSession(ctx context.Context, r *http.Request) (*VisitorSession, bool, error) {
-	sessionHash := s.generateSessionHash(r)
+	sessionHash, rotatesAt, err := s.generateSessionHash(ctx, r)
+	if err != nil {
+		return nil, false, err
+	}
 
 	// Try to get from cache first if cache is available
 	cacheKey := fmt.Sprintf("visitor:session:%s", sessionHash)
@@ -190,18 +259,24 @@ func (s *Service) getOrCreateSession(ctx context.Context, r *http.Request) (*Vis
 		BrowserFamily: browserName,
 		OSFamily:      ua.OS(),
 		IsBot:         s.config.EnableBotDetection && ua.Bot(),
+		Cookieless:    s.salts != nil,
 		CreatedAt:     time.Now(),
 		LastSeenAt:    time.Now(),
 		ExpiresAt:     time.Now().Add(s.config.SessionTimeout),
 	}
 
+	// A cookieless session cannot outlive the salt its hash was built from
+	if !rotatesAt.IsZero() && session.ExpiresAt.After(rotatesAt) {
+		session.ExpiresAt = rotatesAt
+	}
+
 	// Get location from IP (privacy-compliant)
 	if location := s.getLocationFromIP(r); location != nil {
 		session.CountryCode = location.CountryCode
 		session.Timezone = location.Timezone
 		
-		// Only include detailed location with consent
-		if consent, _ := s.GetConsentStatus(ctx, sessionHash); consent != nil && consent.Analytics {
+		// Only include detailed location with consent, never in cookieless mode
+		if consent, _ := s.GetConsentStatus(ctx, sessionHash); !session.Cookieless && consent != nil && consent.Analytics {
 			session.Region = location.Region
 			session.City = location.City
 		}
@@ -219,8 +294,17 @@ func (s *Service) getOrCreateSession(ctx context.Context, r *http.Request) (*Vis
 	return &session, true, nil
 }
 
-// generateSessionHash generates a privacy-safe session hash
-func (s *Service) generateSessionHash(r *http.Request) string {
+// generateSessionHash generates a privacy-safe session hash. In cookieless
+// mode it also returns when the hash stops being valid.
+func (s *Service) generateSessionHash(ctx context.Context, r *http.Request) (string, time.Time, error) {
+	if s.salts != nil {
+		salt, rotatesAt, err := s.salts.CurrentSalt(ctx)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to get daily salt: %w", err)
+		}
+		return cookielessHash(salt, siteHost(r), s.extractIP(r), r.UserAgent()), rotatesAt, nil
+	}
+
 	// Use non-PII data for session identification
 	ua := r.UserAgent()
 	acceptLang := r.Header.Get("Accept-Language")
@@ -229,7 +313,19 @@ func (s *Service) generateSessionHash(r *http.Request) string {
 	// Create hash from browser characteristics (no IP)
 	data := fmt.Sprintf("%s|%s|%s|%d", ua, acceptLang, acceptEnc, time.Now().Unix()/3600)
 	hash := sha256.Sum256([]byte(data))
-	return hex.EncodeToString(hash[:])
+	return hex.EncodeToString(hash[:]), time.Time{}, nil
+}
+
+// IsCookieless reports whether sessions are identified with daily salts
+func (s *Service) IsCookieless() bool {
+	return s.salts != nil
+}
+
+// analyticsPermitted reports whether analytics may be processed for a
+// session. Cookieless sessions hold no identifier beyond the day, so they do
+// not depend on consent.
+func (s *Service) analyticsPermitted(ctx context.Context, session *VisitorSession) bool {
+	return session.Cookieless || s.compliance.ValidateProcessingBasis(ctx, session.SessionHash, "analytics")
 }
 
 // getLocationFromIP gets location from IP without storing the IP
@@ -348,21 +444,6 @@ func (s *Service) getDeviceType(ua *user_agent.UserAgent, userAgentString string
 	return "desktop"
 }
 
-// extractReferrerDomain extracts domain from referrer URL
-func (s *Service) extractReferrerDomain(referrer string) string {
-	if referrer == "" {
-		return ""
-	}
-	
-	// Parse URL to extract domain
-	parts := strings.Split(referrer, "/")
-	if len(parts) >= 3 {
-		return parts[2]
-	}
-	
-	return ""
-}
-
 // updateRealtimeTracking updates real-time visitor tracking
 func (s *Service) updateRealtimeTracking(ctx context.Context, sessionHash, currentPage string) error {
 	realtime := &VisitorRealtime{
@@ -845,6 +926,20 @@ func (s *Service) GetDeviceBrowserStats(ctx context.Context, period string) (*De
 	return stats, nil
 }
 
+// Stop stops the realtime stream and rolls up buffered web vitals, including
+// the current partial hour, before stopping the service
+func (s *Service) Stop() error {
+	s.stopBackground()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.flushVitals(ctx, time.Now().Add(time.Hour)); err != nil {
+		fmt.Printf("Failed to roll up web vitals on shutdown: %v\n", err)
+	}
+
+	return s.BaseService.Stop()
+}
+
 // GetHub returns the WebSocket hub for external registration
 func (s *Service) GetHub() *Hub {
 	return s.hub
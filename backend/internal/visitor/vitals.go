@@ -0,0 +1,470 @@
+package visitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Core Web Vitals and related paint/network timings reported by browsers
+const (
+	VitalLCP  = "LCP"
+	VitalINP  = "INP"
+	VitalCLS  = "CLS"
+	VitalTTFB = "TTFB"
+	VitalFCP  = "FCP"
+)
+
+const (
+	// maxVitalSamples is the reservoir size per hour, page, device and metric
+	maxVitalSamples = 500
+	// maxVitalBuckets bounds the distinct buckets held in memory at once
+	maxVitalBuckets = 5000
+	// vitalsFlushInterval is how often completed hours are rolled up
+	vitalsFlushInterval = time.Minute
+	// minRegressionSamples is the sample count both weeks need before a
+	// change is reported as a regression
+	minRegressionSamples = 20
+	// regressionThreshold is the relative p75 increase treated as a regression
+	regressionThreshold = 0.10
+	// maxVitalsReportPages bounds the pages in a report
+	maxVitalsReportPages = 50
+)
+
+// Ratings follow the web.dev thresholds for the 75th percentile
+const (
+	RatingGood             = "good"
+	RatingNeedsImprovement = "needs-improvement"
+	RatingPoor             = "poor"
+)
+
+// vitalSpec holds the accepted range and rating thresholds for a metric
+type vitalSpec struct {
+	max  float64
+	good float64
+	poor float64
+}
+
+var vitalSpecs = map[string]vitalSpec{
+	VitalLCP:  {max: 60000, good: 2500, poor: 4000},
+	VitalINP:  {max: 60000, good: 200, poor: 500},
+	VitalCLS:  {max: 10, good: 0.1, poor: 0.25},
+	VitalTTFB: {max: 60000, good: 800, poor: 1800},
+	VitalFCP:  {max: 60000, good: 1800, poor: 3000},
+}
+
+var (
+	ErrInvalidVitals = errors.New("invalid web vitals beacon")
+	ErrInvalidDevice = errors.New("invalid device type")
+)
+
+// VitalsBeacon is a set of metrics reported by a browser for one page load.
+// Timings are in milliseconds, CLS is unitless.
+type VitalsBeacon struct {
+	Path    string             `json:"path"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// Validate normalises the beacon and rejects unknown or out of range metrics
+func (b *VitalsBeacon) Validate() error {
+	path, _, _ := strings.Cut(strings.TrimSpace(b.Path), "?")
+	path, _, _ = strings.Cut(path, "#")
+	if path == "" || !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%w: path must start with /", ErrInvalidVitals)
+	}
+	if len(path) > maxEventPathLen {
+		return fmt.Errorf("%w: path exceeds %d characters", ErrInvalidVitals, maxEventPathLen)
+	}
+	b.Path = path
+
+	if len(b.Metrics) == 0 {
+		return fmt.Errorf("%w: no metrics", ErrInvalidVitals)
+	}
+
+	metrics := make(map[string]float64, len(b.Metrics))
+	for name, value := range b.Metrics {
+		name = strings.ToUpper(name)
+		spec, ok := vitalSpecs[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown metric %q", ErrInvalidVitals, name)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 || value > spec.max {
+			return fmt.Errorf("%w: %s out of range", ErrInvalidVitals, name)
+		}
+		metrics[name] = value
+	}
+	b.Metrics = metrics
+
+	return nil
+}
+
+// rateVital rates a metric value against its thresholds
+func rateVital(metric string, value float64) string {
+	spec := vitalSpecs[metric]
+	switch {
+	case value <= spec.good:
+		return RatingGood
+	case value <= spec.poor:
+		return RatingNeedsImprovement
+	default:
+		return RatingPoor
+	}
+}
+
+// WebVitalRollup holds the percentiles of one metric for a page and device
+// class over one hour
+type WebVitalRollup struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Hour       time.Time `gorm:"not null;uniqueIndex:idx_web_vital_rollups_bucket" json:"hour"`
+	Path       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_web_vital_rollups_bucket" json:"path"`
+	DeviceType string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_web_vital_rollups_bucket" json:"deviceType"`
+	Metric     string    `gorm:"type:varchar(10);not null;uniqueIndex:idx_web_vital_rollups_bucket" json:"metric"`
+	Samples    int       `gorm:"not null" json:"samples"`
+	P50        float64   `gorm:"not null" json:"p50"`
+	P75        float64   `gorm:"not null" json:"p75"`
+	P95        float64   `gorm:"not null" json:"p95"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func (WebVitalRollup) TableName() string { return "web_vital_rollups" }
+
+// vitalKey identifies an hourly sample bucket
+type vitalKey struct {
+	Hour       time.Time
+	Path       string
+	DeviceType string
+	Metric     string
+}
+
+// sampleReservoir keeps a uniform random sample of at most maxVitalSamples
+// values, so memory stays bounded however many beacons arrive
+type sampleReservoir struct {
+	samples []float64
+	seen    int
+}
+
+func (r *sampleReservoir) add(value float64) {
+	r.seen++
+	if len(r.samples) < maxVitalSamples {
+		r.samples = append(r.samples, value)
+		return
+	}
+	if i := rand.IntN(r.seen); i < maxVitalSamples {
+		r.samples[i] = value
+	}
+}
+
+// vitalsBuffer holds raw samples in memory until their hour is rolled up
+type vitalsBuffer struct {
+	mu      sync.Mutex
+	buckets map[vitalKey]*sampleReservoir
+	dropped int64
+}
+
+func newVitalsBuffer() *vitalsBuffer {
+	return &vitalsBuffer{buckets: make(map[vitalKey]*sampleReservoir)}
+}
+
+// add records a sample. Samples for new buckets are dropped once the bucket
+// limit is reached.
+func (b *vitalsBuffer) add(key vitalKey, value float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		if len(b.buckets) >= maxVitalBuckets {
+			b.dropped++
+			return
+		}
+		bucket = &sampleReservoir{}
+		b.buckets[key] = bucket
+	}
+	bucket.add(value)
+}
+
+// drain removes and returns the buckets for hours before the given time
+func (b *vitalsBuffer) drain(before time.Time) map[vitalKey]*sampleReservoir {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	drained := make(map[vitalKey]*sampleReservoir)
+	for key, bucket := range b.buckets {
+		if key.Hour.Before(before) {
+			drained[key] = bucket
+			delete(b.buckets, key)
+		}
+	}
+	return drained
+}
+
+// percentile returns the p-th percentile (0-1) of sorted values using linear
+// interpolation between closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// RecordVitals stores a beacon's metrics in the in-memory buffer, tagged with
+// the device class of the visitor session. Nothing identifying the session
+// is kept with the samples.
+func (s *Service) RecordVitals(ctx context.Context, r *http.Request, beacon VitalsBeacon) error {
+	if !s.config.EnableTracking {
+		return nil
+	}
+
+	if err := beacon.Validate(); err != nil {
+		return err
+	}
+
+	session, _, err := s.getOrCreateSession(ctx, r)
+	if err != nil {
+		return fmt.Errorf("failed to get/create session: %w", err)
+	}
+
+	if session.IsBot {
+		return nil
+	}
+
+	if !s.analyticsPermitted(ctx, session) {
+		return ErrEventNotPermitted
+	}
+
+	deviceType := session.DeviceType
+	if deviceType == "" {
+		deviceType = "other"
+	}
+
+	hour := time.Now().UTC().Truncate(time.Hour)
+	for metric, value := range beacon.Metrics {
+		s.vitals.add(vitalKey{Hour: hour, Path: beacon.Path, DeviceType: deviceType, Metric: metric}, value)
+	}
+
+	return nil
+}
+
+// runVitalsRollup rolls up completed hours until ctx is cancelled
+func (s *Service) runVitalsRollup(ctx context.Context) {
+	ticker := time.NewTicker(vitalsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flushCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := s.flushVitals(flushCtx, time.Now().UTC().Truncate(time.Hour)); err != nil {
+				fmt.Printf("Failed to roll up web vitals: %v\n", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// flushVitals writes percentiles for buckets before the given hour. Several
+// instances, or a flush of a partial hour on shutdown, can contribute to the
+// same row; the percentiles are then merged as a sample-weighted average,
+// which is an approximation but stays close for similar distributions.
+func (s *Service) flushVitals(ctx context.Context, before time.Time) error {
+	buckets := s.vitals.drain(before)
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for key, bucket := range buckets {
+		sorted := append([]float64(nil), bucket.samples...)
+		sort.Float64s(sorted)
+
+		if err := s.db.WithContext(ctx).Exec(`
+			INSERT INTO web_vital_rollups (hour, path, device_type, metric, samples, p50, p75, p95, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (hour, path, device_type, metric) DO UPDATE SET
+				p50 = (web_vital_rollups.p50 * web_vital_rollups.samples + EXCLUDED.p50 * EXCLUDED.samples) / (web_vital_rollups.samples + EXCLUDED.samples),
+				p75 = (web_vital_rollups.p75 * web_vital_rollups.samples + EXCLUDED.p75 * EXCLUDED.samples) / (web_vital_rollups.samples + EXCLUDED.samples),
+				p95 = (web_vital_rollups.p95 * web_vital_rollups.samples + EXCLUDED.p95 * EXCLUDED.samples) / (web_vital_rollups.samples + EXCLUDED.samples),
+				samples = web_vital_rollups.samples + EXCLUDED.samples,
+				updated_at = EXCLUDED.updated_at
+		`, key.Hour, key.Path, key.DeviceType, key.Metric, bucket.seen,
+			percentile(sorted, 0.50), percentile(sorted, 0.75), percentile(sorted, 0.95), time.Now(),
+		).Error; err != nil {
+			errs = append(errs, fmt.Errorf("%s %s %s: %w", key.Path, key.DeviceType, key.Metric, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// VitalStat compares a metric on a page with the previous week
+type VitalStat struct {
+	Metric          string  `json:"metric"`
+	Samples         int     `json:"samples"`
+	P50             float64 `json:"p50"`
+	P75             float64 `json:"p75"`
+	P95             float64 `json:"p95"`
+	Rating          string  `json:"rating"`
+	PreviousSamples int     `json:"previousSamples"`
+	PreviousP75     float64 `json:"previousP75"`
+	ChangePercent   float64 `json:"changePercent"`
+	Regressed       bool    `json:"regressed"`
+}
+
+// PageVitals holds the metrics for a single page
+type PageVitals struct {
+	Path    string      `json:"path"`
+	Samples int         `json:"samples"`
+	Metrics []VitalStat `json:"metrics"`
+}
+
+// VitalRegression is a page metric whose p75 got worse week over week
+type VitalRegression struct {
+	Path string `json:"path"`
+	VitalStat
+}
+
+// WebVitalsReport lists page percentiles for the last 7 days compared with
+// the 7 days before
+type WebVitalsReport struct {
+	DeviceType  string            `json:"deviceType,omitempty"`
+	Since       time.Time         `json:"since"`
+	Pages       []PageVitals      `json:"pages"`
+	Regressions []VitalRegression `json:"regressions"`
+}
+
+// GetWebVitalsReport builds the weekly web vitals report, optionally for one
+// device class. Weekly percentiles are sample-weighted averages of the hourly
+// rollups.
+func (s *Service) GetWebVitalsReport(ctx context.Context, deviceType string) (*WebVitalsReport, error) {
+	switch deviceType {
+	case "", "desktop", "mobile", "tablet", "other":
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDevice, deviceType)
+	}
+
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -7)
+	previousSince := now.AddDate(0, 0, -14)
+
+	query := s.db.WithContext(ctx).Table("web_vital_rollups").
+		Select(`path, metric,
+			SUM(CASE WHEN hour >= @since THEN samples ELSE 0 END) AS samples,
+			COALESCE(SUM(CASE WHEN hour >= @since THEN p50 * samples END) / NULLIF(SUM(CASE WHEN hour >= @since THEN samples END), 0), 0) AS p50,
+			COALESCE(SUM(CASE WHEN hour >= @since THEN p75 * samples END) / NULLIF(SUM(CASE WHEN hour >= @since THEN samples END), 0), 0) AS p75,
+			COALESCE(SUM(CASE WHEN hour >= @since THEN p95 * samples END) / NULLIF(SUM(CASE WHEN hour >= @since THEN samples END), 0), 0) AS p95,
+			SUM(CASE WHEN hour < @since THEN samples ELSE 0 END) AS previous_samples,
+			COALESCE(SUM(CASE WHEN hour < @since THEN p75 * samples END) / NULLIF(SUM(CASE WHEN hour < @since THEN samples END), 0), 0) AS previous_p75`,
+			map[string]interface{}{"since": since}).
+		Where("hour >= ?", previousSince)
+	if deviceType != "" {
+		query = query.Where("device_type = ?", deviceType)
+	}
+
+	var rows []struct {
+		Path            string
+		Metric          string
+		Samples         int
+		P50             float64
+		P75             float64
+		P95             float64
+		PreviousSamples int
+		PreviousP75     float64
+	}
+	if err := query.Group("path, metric").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query web vitals: %w", err)
+	}
+
+	report := &WebVitalsReport{
+		DeviceType:  deviceType,
+		Since:       since,
+		Pages:       []PageVitals{},
+		Regressions: []VitalRegression{},
+	}
+
+	pages := make(map[string]*PageVitals)
+	for _, row := range rows {
+		if row.Samples == 0 {
+			continue
+		}
+
+		stat := VitalStat{
+			Metric:          row.Metric,
+			Samples:         row.Samples,
+			P50:             row.P50,
+			P75:             row.P75,
+			P95:             row.P95,
+			Rating:          rateVital(row.Metric, row.P75),
+			PreviousSamples: row.PreviousSamples,
+			PreviousP75:     row.PreviousP75,
+		}
+		if row.PreviousP75 > 0 {
+			stat.ChangePercent = (row.P75 - row.PreviousP75) / row.PreviousP75 * 100
+		}
+		stat.Regressed = isVitalRegression(stat)
+
+		page, ok := pages[row.Path]
+		if !ok {
+			page = &PageVitals{Path: row.Path}
+			pages[row.Path] = page
+		}
+		page.Metrics = append(page.Metrics, stat)
+		if row.Samples > page.Samples {
+			page.Samples = row.Samples
+		}
+
+		if stat.Regressed {
+			report.Regressions = append(report.Regressions, VitalRegression{Path: row.Path, VitalStat: stat})
+		}
+	}
+
+	for _, page := range pages {
+		sort.Slice(page.Metrics, func(i, j int) bool {
+			return page.Metrics[i].Metric < page.Metrics[j].Metric
+		})
+		report.Pages = append(report.Pages, *page)
+	}
+	sort.Slice(report.Pages, func(i, j int) bool {
+		if report.Pages[i].Samples != report.Pages[j].Samples {
+			return report.Pages[i].Samples > report.Pages[j].Samples
+		}
+		return report.Pages[i].Path < report.Pages[j].Path
+	})
+	if len(report.Pages) > maxVitalsReportPages {
+		report.Pages = report.Pages[:maxVitalsReportPages]
+	}
+	sort.Slice(report.Regressions, func(i, j int) bool {
+		return report.Regressions[i].ChangePercent > report.Regressions[j].ChangePercent
+	})
+
+	return report, nil
+}
+
+// isVitalRegression reports a p75 increase of at least regressionThreshold
+// with enough samples in both weeks. Increases that stay within the good
+// rating are ignored unless the rating was already worse.
+func isVitalRegression(stat VitalStat) bool {
+	if stat.Samples < minRegressionSamples || stat.PreviousSamples < minRegressionSamples || stat.PreviousP75 <= 0 {
+		return false
+	}
+	if stat.P75 < stat.PreviousP75*(1+regressionThreshold) {
+		return false
+	}
+	return stat.Rating != RatingGood
+}
@@ -0,0 +1,198 @@
+package visitor
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	hundred := make([]float64, 100)
+	for i := range hundred {
+		hundred[i] = float64(i + 1)
+	}
+
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{"empty", nil, 0.75, 0},
+		{"single value", []float64{42}, 0.95, 42},
+		{"minimum", []float64{1, 2, 3, 4}, 0, 1},
+		{"maximum", []float64{1, 2, 3, 4}, 1, 4},
+		{"median of even count", []float64{1, 2, 3, 4}, 0.5, 2.5},
+		{"interpolated p75", []float64{1, 2, 3, 4}, 0.75, 3.25},
+		{"exact rank", []float64{10, 20, 30, 40, 50}, 0.75, 40},
+		{"p95 of 1 to 100", hundred, 0.95, 95.05},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, percentile(tt.sorted, tt.p), 1e-9)
+		})
+	}
+}
+
+func TestSampleReservoir(t *testing.T) {
+	small := &sampleReservoir{}
+	for i := 0; i < 10; i++ {
+		small.add(float64(i))
+	}
+	assert.Equal(t, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, small.samples, "values below the limit are all kept")
+	assert.Equal(t, 10, small.seen)
+
+	const total = 20 * maxVitalSamples
+	large := &sampleReservoir{}
+	for i := 0; i < total; i++ {
+		large.add(float64(i))
+	}
+	assert.Equal(t, total, large.seen, "every value is counted")
+	require.Len(t, large.samples, maxVitalSamples)
+
+	// A uniform sample has a mean near the middle of the range, whereas
+	// keeping only the first values would not
+	sum := 0.0
+	late := 0
+	for _, sample := range large.samples {
+		sum += sample
+		if sample >= maxVitalSamples {
+			late++
+		}
+	}
+	assert.InDelta(t, total/2, sum/maxVitalSamples, total/10)
+	assert.Greater(t, late, maxVitalSamples/2, "later values replace earlier ones")
+}
+
+func TestVitalsBuffer(t *testing.T) {
+	hour := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	key := func(h time.Time, path string) vitalKey {
+		return vitalKey{Hour: h, Path: path, DeviceType: "desktop", Metric: VitalLCP}
+	}
+
+	t.Run("bucket limit", func(t *testing.T) {
+		buffer := newVitalsBuffer()
+		for i := 0; i < maxVitalBuckets; i++ {
+			buffer.add(key(hour, fmt.Sprintf("/page/%d", i)), 1)
+		}
+		require.Len(t, buffer.buckets, maxVitalBuckets)
+
+		buffer.add(key(hour, "/new"), 1)
+		assert.Len(t, buffer.buckets, maxVitalBuckets)
+		assert.Equal(t, int64(1), buffer.dropped, "samples for new buckets are dropped")
+
+		existing := key(hour, "/page/0")
+		require.Contains(t, buffer.buckets, existing)
+		buffer.add(existing, 2)
+		assert.Equal(t, 2, buffer.buckets[existing].seen, "existing buckets still take samples")
+		assert.Equal(t, int64(1), buffer.dropped)
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		buffer := newVitalsBuffer()
+		previous := key(hour.Add(-time.Hour), "/")
+		current := key(hour, "/")
+		buffer.add(previous, 1200)
+		buffer.add(previous, 1800)
+		buffer.add(current, 900)
+
+		drained := buffer.drain(hour)
+		require.Len(t, drained, 1, "only completed hours are drained")
+		assert.Equal(t, []float64{1200, 1800}, drained[previous].samples)
+		assert.NotContains(t, buffer.buckets, previous)
+		assert.Contains(t, buffer.buckets, current)
+
+		assert.Empty(t, buffer.drain(hour), "drained buckets are removed")
+		assert.Len(t, buffer.drain(hour.Add(time.Hour)), 1)
+		assert.Empty(t, buffer.buckets)
+	})
+}
+
+func TestVitalsBeaconValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		beacon  VitalsBeacon
+		want    VitalsBeacon
+		invalid bool
+	}{
+		{
+			name:   "valid",
+			beacon: VitalsBeacon{Path: "/blog", Metrics: map[string]float64{"LCP": 2100, "CLS": 0.05}},
+			want:   VitalsBeacon{Path: "/blog", Metrics: map[string]float64{"LCP": 2100, "CLS": 0.05}},
+		},
+		{
+			name:   "normalised",
+			beacon: VitalsBeacon{Path: " /blog?ref=mail#top ", Metrics: map[string]float64{"inp": 120, "ttfb": 0}},
+			want:   VitalsBeacon{Path: "/blog", Metrics: map[string]float64{"INP": 120, "TTFB": 0}},
+		},
+		{
+			name:   "upper bound",
+			beacon: VitalsBeacon{Path: "/", Metrics: map[string]float64{"CLS": 10, "FCP": 60000}},
+			want:   VitalsBeacon{Path: "/", Metrics: map[string]float64{"CLS": 10, "FCP": 60000}},
+		},
+		{name: "empty path", beacon: VitalsBeacon{Path: "", Metrics: map[string]float64{"LCP": 1}}, invalid: true},
+		{name: "only a query", beacon: VitalsBeacon{Path: "?a=b", Metrics: map[string]float64{"LCP": 1}}, invalid: true},
+		{name: "relative path", beacon: VitalsBeacon{Path: "blog", Metrics: map[string]float64{"LCP": 1}}, invalid: true},
+		{name: "long path", beacon: VitalsBeacon{Path: "/" + strings.Repeat("a", maxEventPathLen), Metrics: map[string]float64{"LCP": 1}}, invalid: true},
+		{name: "no metrics", beacon: VitalsBeacon{Path: "/"}, invalid: true},
+		{name: "unknown metric", beacon: VitalsBeacon{Path: "/", Metrics: map[string]float64{"FID": 10}}, invalid: true},
+		{name: "negative", beacon: VitalsBeacon{Path: "/", Metrics: map[string]float64{"LCP": -1}}, invalid: true},
+		{name: "too large", beacon: VitalsBeacon{Path: "/", Metrics: map[string]float64{"CLS": 10.5}}, invalid: true},
+		{name: "not a number", beacon: VitalsBeacon{Path: "/", Metrics: map[string]float64{"INP": math.NaN()}}, invalid: true},
+		{name: "infinite", beacon: VitalsBeacon{Path: "/", Metrics: map[string]float64{"TTFB": math.Inf(1)}}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			beacon := tt.beacon
+			err := beacon.Validate()
+			if tt.invalid {
+				assert.ErrorIs(t, err, ErrInvalidVitals)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, beacon)
+		})
+	}
+}
+
+func TestIsVitalRegression(t *testing.T) {
+	stat := func(metric string, samples, previousSamples int, p75, previousP75 float64) VitalStat {
+		return VitalStat{
+			Metric:          metric,
+			Samples:         samples,
+			P75:             p75,
+			Rating:          rateVital(metric, p75),
+			PreviousSamples: previousSamples,
+			PreviousP75:     previousP75,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		stat      VitalStat
+		regressed bool
+	}{
+		{"worse into poor", stat(VitalLCP, 100, 100, 4500, 3000), true},
+		{"worse within needs improvement", stat(VitalINP, 100, 100, 330, 300), true},
+		{"exactly at the threshold", stat(VitalTTFB, 50, 50, 1100, 1000), true},
+		{"below the threshold", stat(VitalTTFB, 50, 50, 1090, 1000), false},
+		{"improved", stat(VitalLCP, 100, 100, 3000, 4500), false},
+		{"worse but still good", stat(VitalLCP, 100, 100, 2400, 1200), false},
+		{"too few samples", stat(VitalLCP, minRegressionSamples-1, 100, 6000, 3000), false},
+		{"too few previous samples", stat(VitalLCP, 100, minRegressionSamples-1, 6000, 3000), false},
+		{"no previous week", stat(VitalCLS, 100, 100, 0.3, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.regressed, isVitalRegression(tt.stat))
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package visitor
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -104,11 +106,30 @@ func (h *Hub) Run() {
 	}
 }
 
+// ClientCount returns the number of connected subscribers
+func (h *Hub) ClientCount() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.clients)
+}
+
 // Stop gracefully stops the hub and closes all connections
 func (h *Hub) Stop() {
 	close(h.done)
 }
 
+// WebSocketToken copies a token query parameter into the Authorization header
+// so the admin auth middleware can run on WebSocket handshakes, which browsers
+// cannot attach headers to.
+func WebSocketToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		c.Next()
+	}
+}
+
 // ServeWs handles websocket requests from the peer.
 func (s *Service) ServeWs(hub *Hub, c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -116,6 +137,14 @@ func (s *Service) ServeWs(hub *Hub, c *gin.Context) {
 		fmt.Println(err)
 		return
 	}
+	// Send the current state first so the dashboard does not wait for the
+	// next update. The hub is not writing to this connection yet.
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	if snapshot, err := s.GetRealtimeSnapshot(ctx); err == nil {
+		conn.WriteJSON(RealtimeUpdate{Type: "realtime", Events: []RealtimeEvent{}, Snapshot: snapshot})
+	}
+	cancel()
+
 	hub.register <- conn
 
 	// Unregister the client when the connection is closed
@@ -0,0 +1,244 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Job statuses
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+const (
+	// defaultMaxAttempts is how often a job is tried before it is failed
+	defaultMaxAttempts = 5
+
+	// maxBackoff caps the delay between retries
+	maxBackoff = 30 * time.Minute
+
+	// defaultLockTimeout is how long a job may stay claimed before it is
+	// assumed its worker died and another one may claim it
+	defaultLockTimeout = 15 * time.Minute
+)
+
+// ErrNoProcessor is returned for jobs of a type no processor is registered for
+var ErrNoProcessor = errors.New("no processor registered for job type")
+
+// Job is a unit of background work stored in the jobs table
+type Job struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Type        string     `gorm:"type:varchar(100);not null;index" json:"type"`
+	Payload     []byte     `json:"payload"`
+	Status      string     `gorm:"type:varchar(20);not null;default:pending" json:"status"`
+	Priority    int        `gorm:"not null;default:0" json:"priority"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"not null;default:5" json:"max_attempts"`
+	RunAt       time.Time  `gorm:"not null" json:"run_at"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// Decode unmarshals the job's JSON payload into v
+func (j *Job) Decode(v interface{}) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return fmt.Errorf("failed to decode %s job payload: %w", j.Type, err)
+	}
+	return nil
+}
+
+// EnqueueOptions tune how a job is scheduled
+type EnqueueOptions struct {
+	// RunAt delays the job until the given time
+	RunAt time.Time
+	// Priority orders due jobs, higher first
+	Priority int
+	// MaxAttempts overrides how often the job is tried
+	MaxAttempts int
+}
+
+// Enqueuer adds jobs to a queue. Producers depend on it rather than on
+// Queue so they can be tested without a database.
+type Enqueuer interface {
+	Enqueue(ctx context.Context, jobType string, payload interface{}) (*Job, error)
+}
+
+// Queue stores jobs in the database. Any number of processes may claim
+// jobs from it concurrently.
+type Queue struct {
+	db          *gorm.DB
+	lockTimeout time.Duration
+}
+
+// New creates a queue backed by the jobs table
+func New(db *gorm.DB) *Queue {
+	return &Queue{db: db, lockTimeout: defaultLockTimeout}
+}
+
+// Enqueue adds a job that runs as soon as a worker is free. The payload is
+// stored as JSON.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (*Job, error) {
+	return q.EnqueueWithOptions(ctx, jobType, payload, EnqueueOptions{})
+}
+
+// EnqueueWithOptions adds a job with a delay, priority or attempt limit
+func (q *Queue) EnqueueWithOptions(ctx context.Context, jobType string, payload interface{}, opts EnqueueOptions) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s job payload: %w", jobType, err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          uuid.New(),
+		Type:        jobType,
+		Payload:     data,
+		Status:      StatusPending,
+		Priority:    opts.Priority,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt.UTC(),
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.RunAt.IsZero() {
+		job.RunAt = now
+	}
+
+	if err := q.db.WithContext(ctx).Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to enqueue %s job: %w", jobType, err)
+	}
+	return job, nil
+}
+
+// Claim marks up to limit due jobs of the given types as processing and
+// returns them. Rows locked by another claimer are skipped, and jobs whose
+// worker died are claimed again once their lock times out.
+func (q *Queue) Claim(ctx context.Context, types []string, limit int) ([]Job, error) {
+	if len(types) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	var jobs []Job
+	err := q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("type IN ?", types).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_at < ?)",
+				StatusPending, now, StatusProcessing, now.Add(-q.lockTimeout)).
+			Order("priority DESC, run_at ASC").
+			Limit(limit).
+			Find(&jobs).Error
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(jobs))
+		for i := range jobs {
+			ids[i] = jobs[i].ID
+			jobs[i].Status = StatusProcessing
+			jobs[i].Attempts++
+			jobs[i].LockedAt = &now
+		}
+
+		return tx.Model(&Job{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":     StatusProcessing,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"locked_at":  now,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Complete marks a claimed job as done
+func (q *Queue) Complete(ctx context.Context, job *Job) error {
+	now := time.Now().UTC()
+	err := q.db.WithContext(ctx).Model(&Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":       StatusCompleted,
+		"completed_at": now,
+		"locked_at":    nil,
+		"updated_at":   now,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to complete job %s: %w", job.ID, err)
+	}
+	job.Status = StatusCompleted
+	job.CompletedAt = &now
+	return nil
+}
+
+// Fail records a failed attempt. The job is retried with exponential
+// backoff until it runs out of attempts.
+func (q *Queue) Fail(ctx context.Context, job *Job, cause error) error {
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"last_error": cause.Error(),
+		"locked_at":  nil,
+		"updated_at": now,
+	}
+
+	if job.Attempts >= job.MaxAttempts || errors.Is(cause, ErrNoProcessor) {
+		job.Status = StatusFailed
+	} else {
+		job.Status = StatusPending
+		job.RunAt = now.Add(backoff(job.Attempts))
+		updates["run_at"] = job.RunAt
+	}
+	updates["status"] = job.Status
+	job.LastError = cause.Error()
+
+	if err := q.db.WithContext(ctx).Model(&Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record failure of job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Purge deletes completed jobs finished before the cutoff
+func (q *Queue) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result := q.db.WithContext(ctx).
+		Where("status = ? AND completed_at < ?", StatusCompleted, before).
+		Delete(&Job{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// backoff returns the delay before retrying after the given attempt
+func backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 20 {
+		return maxBackoff
+	}
+	delay := time.Duration(1<<uint(attempts-1)) * 10 * time.Second
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	appconfig "github.com/JadenRazo/Project-Website/backend/internal/app/config"
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+)
+
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+
+	require.NoError(t, logger.InitLogger(&appconfig.LoggingConfig{Level: "error", Output: "stderr"}, "queue-test", "test"))
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&Job{}))
+
+	return New(db)
+}
+
+func reload(t *testing.T, q *Queue, job *Job) *Job {
+	t.Helper()
+
+	var stored Job
+	require.NoError(t, q.db.First(&stored, "id = ?", job.ID).Error)
+	return &stored
+}
+
+type testPayload struct {
+	AttachmentID uint `json:"attachment_id"`
+}
+
+func TestClaimOnlyDueJobsOfKnownTypes(t *testing.T) {
+	q := newTestQueue(t)
+	ctx := context.Background()
+
+	due, err := q.Enqueue(ctx, "image", testPayload{AttachmentID: 7})
+	require.NoError(t, err)
+	_, err = q.EnqueueWithOptions(ctx, "image", testPayload{}, EnqueueOptions{RunAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = q.Enqueue(ctx, "email", testPayload{})
+	require.NoError(t, err)
+
+	jobs, err := q.Claim(ctx, []string{"image"}, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, due.ID, jobs[0].ID)
+	assert.Equal(t, 1, jobs[0].Attempts)
+
+	var payload testPayload
+	require.NoError(t, jobs[0].Decode(&payload))
+	assert.Equal(t, uint(7), payload.AttachmentID)
+
+	stored := reload(t, q, due)
+	assert.Equal(t, StatusProcessing, stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+
+	// A claimed job is not handed out twice
+	jobs, err = q.Claim(ctx, []string{"image"}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestClaimReclaimsJobsOfDeadWorkers(t *testing.T) {
+	q := newTestQueue(t)
+	q.lockTimeout = time.Millisecond
+	ctx := context.Background()
+
+	_, err := q.Enqueue(ctx, "image", testPayload{})
+	require.NoError(t, err)
+
+	jobs, err := q.Claim(ctx, []string{"image"}, 1)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	time.Sleep(5 * time.Millisecond)
+	jobs, err = q.Claim(ctx, []string{"image"}, 1)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, 2, jobs[0].Attempts)
+}
+
+func TestFailRetriesWithBackoff(t *testing.T) {
+	q := newTestQueue(t)
+	ctx := context.Background()
+
+	job, err := q.EnqueueWithOptions(ctx, "image", testPayload{}, EnqueueOptions{MaxAttempts: 2})
+	require.NoError(t, err)
+
+	jobs, err := q.Claim(ctx, []string{"image"}, 1)
+	require.NoError(t, err)
+	require.NoError(t, q.Fail(ctx, &jobs[0], errors.New("decoder exploded")))
+
+	stored := reload(t, q, job)
+	assert.Equal(t, StatusPending, stored.Status)
+	assert.Equal(t, "decoder exploded", stored.LastError)
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), stored.RunAt, 2*time.Second)
+
+	// Retry immediately to use up the last attempt
+	require.NoError(t, q.db.Model(stored).Update("run_at", time.Now().Add(-time.Second)).Error)
+	jobs, err = q.Claim(ctx, []string{"image"}, 1)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	require.NoError(t, q.Fail(ctx, &jobs[0], errors.New("still broken")))
+
+	assert.Equal(t, StatusFailed, reload(t, q, job).Status)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, backoff(1))
+	assert.Equal(t, 40*time.Second, backoff(3))
+	assert.Equal(t, maxBackoff, backoff(12))
+	assert.Equal(t, maxBackoff, backoff(100))
+}
+
+func TestRunnerProcessesRegisteredJobs(t *testing.T) {
+	q := newTestQueue(t)
+	runner := NewRunner(q)
+	ctx := context.Background()
+
+	var processed atomic.Int32
+	runner.Register("image", ProcessorFunc(func(ctx context.Context, job *Job) error {
+		processed.Add(1)
+		return nil
+	}))
+	runner.Register("flaky", ProcessorFunc(func(ctx context.Context, job *Job) error {
+		panic("boom")
+	}))
+
+	ok, err := runner.Enqueue(ctx, "image", testPayload{})
+	require.NoError(t, err)
+	flaky, err := runner.Enqueue(ctx, "flaky", testPayload{})
+	require.NoError(t, err)
+	other, err := q.Enqueue(ctx, "email", testPayload{})
+	require.NoError(t, err)
+
+	claimed, err := runner.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, claimed)
+	assert.Equal(t, int32(1), processed.Load())
+
+	assert.Equal(t, StatusCompleted, reload(t, q, ok).Status)
+	failed := reload(t, q, flaky)
+	assert.Equal(t, StatusPending, failed.Status)
+	assert.Contains(t, failed.LastError, "panic: boom")
+	assert.Equal(t, StatusPending, reload(t, q, other).Status, "jobs without a processor are left for other workers")
+}
+
+func TestRunnerRunsUntilCancelled(t *testing.T) {
+	q := newTestQueue(t)
+	runner := NewRunner(q)
+	runner.pollInterval = time.Hour
+
+	done := make(chan struct{}, 1)
+	runner.Register("image", ProcessorFunc(func(ctx context.Context, job *Job) error {
+		done <- struct{}{}
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- runner.Run(ctx) }()
+
+	// Enqueueing through the runner wakes it without waiting for a poll
+	_, err := runner.Enqueue(ctx, "image", testPayload{})
+	require.NoError(t, err)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job was not processed")
+	}
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(2 * time.Second):
+		t.Fatal("runner did not stop")
+	}
+}
@@ -0,0 +1,185 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+)
+
+const (
+	defaultPollInterval = 2 * time.Second
+	defaultBatchSize    = 10
+	defaultJobTimeout   = 5 * time.Minute
+)
+
+// Processor handles the jobs of one type
+type Processor interface {
+	Process(ctx context.Context, job *Job) error
+}
+
+// ProcessorFunc adapts a function to a Processor
+type ProcessorFunc func(ctx context.Context, job *Job) error
+
+// Process calls f(ctx, job)
+func (f ProcessorFunc) Process(ctx context.Context, job *Job) error {
+	return f(ctx, job)
+}
+
+// Runner polls a queue and hands claimed jobs to the processors registered
+// for their type. It only claims types it has a processor for, so processes
+// running different processors can share one queue.
+type Runner struct {
+	queue        *Queue
+	mu           sync.RWMutex
+	processors   map[string]Processor
+	pollInterval time.Duration
+	batchSize    int
+	jobTimeout   time.Duration
+	wake         chan struct{}
+}
+
+// NewRunner creates a runner for the queue
+func NewRunner(queue *Queue) *Runner {
+	return &Runner{
+		queue:        queue,
+		processors:   make(map[string]Processor),
+		pollInterval: defaultPollInterval,
+		batchSize:    defaultBatchSize,
+		jobTimeout:   defaultJobTimeout,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Queue returns the queue the runner claims jobs from
+func (r *Runner) Queue() *Queue {
+	return r.queue
+}
+
+// Register sets the processor for a job type, replacing any previous one
+func (r *Runner) Register(jobType string, processor Processor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.processors[jobType] = processor
+}
+
+// Enqueue adds a job to the runner's queue and wakes the runner, so jobs
+// enqueued in this process do not wait for the next poll
+func (r *Runner) Enqueue(ctx context.Context, jobType string, payload interface{}) (*Job, error) {
+	job, err := r.queue.Enqueue(ctx, jobType, payload)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Run processes jobs until ctx is cancelled, then waits for the batch in
+// progress to finish
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain full batches before waiting for the next poll
+		for {
+			processed, err := r.RunOnce(ctx)
+			if err != nil {
+				logger.Error("Failed to process jobs", "error", err)
+				break
+			}
+			if processed < r.batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RunOnce claims one batch of due jobs and processes them concurrently. It
+// returns how many jobs were claimed.
+func (r *Runner) RunOnce(ctx context.Context) (int, error) {
+	if ctx.Err() != nil {
+		return 0, nil
+	}
+
+	jobs, err := r.queue.Claim(ctx, r.types(), r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			r.process(ctx, job)
+		}(&jobs[i])
+	}
+	wg.Wait()
+
+	return len(jobs), nil
+}
+
+// process runs a single job and records its outcome. The outcome is written
+// with a fresh context so jobs interrupted by shutdown are retried.
+func (r *Runner) process(ctx context.Context, job *Job) {
+	err := r.run(ctx, job)
+
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err != nil {
+		logger.Warn("Job failed", "job_id", job.ID, "type", job.Type, "attempt", job.Attempts, "error", err)
+		if err := r.queue.Fail(recordCtx, job, err); err != nil {
+			logger.Error("Failed to record job failure", "job_id", job.ID, "error", err)
+		}
+		return
+	}
+
+	if err := r.queue.Complete(recordCtx, job); err != nil {
+		logger.Error("Failed to complete job", "job_id", job.ID, "error", err)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job *Job) (err error) {
+	r.mu.RLock()
+	processor, ok := r.processors[job.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoProcessor, job.Type)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+
+	jobCtx, cancel := context.WithTimeout(ctx, r.jobTimeout)
+	defer cancel()
+
+	return processor.Process(jobCtx, job)
+}
+
+func (r *Runner) types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.processors))
+	for jobType := range r.processors {
+		types = append(types, jobType)
+	}
+	return types
+}
@@ -6,6 +6,13 @@ import (
 	"time"
 
 	"github.com/JadenRazo/Project-Website/backend/internal/core"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/gc"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/digest"
+	msgretention "github.com/JadenRazo/Project-Website/backend/internal/messaging/retention"
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
+	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
 	"github.com/JadenRazo/Project-Website/backend/internal/worker/tasks"
 	"gorm.io/gorm"
 )
@@ -14,6 +21,7 @@ type Service struct {
 	*core.BaseService
 	db             *gorm.DB
 	scheduledTasks *tasks.ScheduledTasks
+	jobs           *queue.Runner
 	ctx            context.Context
 	cancel         context.CancelFunc
 	mu             sync.Mutex
@@ -25,6 +33,7 @@ func NewService(db *gorm.DB) *Service {
 		BaseService:    core.NewBaseService("worker"),
 		db:             db,
 		scheduledTasks: tasks.NewScheduledTasks(db),
+		jobs:           queue.NewRunner(queue.New(db)),
 		ctx:            ctx,
 		cancel:         cancel,
 	}
@@ -44,9 +53,54 @@ func (s *Service) Start() error {
 		}
 	}()
 
+	go func() {
+		if err := s.jobs.Run(s.ctx); err != nil && err != context.Canceled {
+			s.AddError(err)
+		}
+	}()
+
 	return nil
 }
 
+// RetentionEngine returns the engine used by the scheduled retention task
+func (s *Service) RetentionEngine() *retention.Engine {
+	return s.scheduledTasks.RetentionTask().Engine()
+}
+
+// Jobs returns the runner processing queued jobs in this process. Services
+// register processors on it and enqueue jobs through it.
+func (s *Service) Jobs() *queue.Runner {
+	return s.jobs
+}
+
+// SetPrivacyRequests sets the service whose verified requests the worker fulfils
+func (s *Service) SetPrivacyRequests(service *visitor.PrivacyRequestService) {
+	s.scheduledTasks.PrivacyRequestTask().SetService(service)
+}
+
+// SetAttachmentUploads sets the service whose abandoned uploads the worker expires
+func (s *Service) SetAttachmentUploads(service *uploads.Service) {
+	s.scheduledTasks.AttachmentUploadTask().SetService(service)
+}
+
+// SetAttachmentGC sets the collector the worker runs to delete unreferenced
+// attachment files
+func (s *Service) SetAttachmentGC(collector *gc.Collector) {
+	s.scheduledTasks.AttachmentGCTask().SetCollector(collector)
+}
+
+// SetMessageRetention sets the enforcer the worker runs to apply channel
+// retention policies
+func (s *Service) SetMessageRetention(enforcer *msgretention.Enforcer) {
+	s.scheduledTasks.MessageRetentionTask().SetEnforcer(enforcer)
+}
+
+// SetEmailDigests sets the service the worker sends messaging email
+// digests with
+func (s *Service) SetEmailDigests(service *digest.Service) {
+	s.scheduledTasks.EmailDigestTask().SetService(service)
+}
+
 func (s *Service) Stop() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
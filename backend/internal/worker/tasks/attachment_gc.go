@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/gc"
+)
+
+// AttachmentGCTask reconciles stored attachment files against attachment
+// records and deletes files nothing refers to
+type AttachmentGCTask struct {
+	collector *gc.Collector
+}
+
+// NewAttachmentGCTask creates a new attachment garbage collection task. The
+// collector is injected later since it needs the messaging storage.
+func NewAttachmentGCTask() *AttachmentGCTask {
+	return &AttachmentGCTask{}
+}
+
+// SetCollector sets the collector the task runs
+func (t *AttachmentGCTask) SetCollector(collector *gc.Collector) {
+	t.collector = collector
+}
+
+// Collect deletes orphaned files, records whose file is gone and the files
+// of removed messages
+func (t *AttachmentGCTask) Collect(ctx context.Context) error {
+	if t.collector == nil {
+		return nil
+	}
+
+	report, err := t.collector.Run(ctx, false)
+	if report != nil {
+		logger.Info("Attachment garbage collection finished",
+			"purged_attachments", report.PurgedAttachments,
+			"orphaned_files", report.OrphanedFiles,
+			"missing_files", report.MissingFiles,
+			"reclaimed_bytes", report.ReclaimedBytes,
+			"errors", len(report.Errors),
+		)
+	}
+	return err
+}
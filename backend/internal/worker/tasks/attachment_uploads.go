@@ -0,0 +1,37 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/attachments/uploads"
+)
+
+// AttachmentUploadTask removes resumable uploads that were abandoned
+type AttachmentUploadTask struct {
+	service *uploads.Service
+}
+
+// NewAttachmentUploadTask creates a new upload expiry task. The upload
+// service is injected later since it is owned by the messaging service.
+func NewAttachmentUploadTask() *AttachmentUploadTask {
+	return &AttachmentUploadTask{}
+}
+
+// SetService sets the upload service whose uploads expire
+func (t *AttachmentUploadTask) SetService(service *uploads.Service) {
+	t.service = service
+}
+
+// ExpireStale aborts expired uploads and deletes what they stored
+func (t *AttachmentUploadTask) ExpireStale(ctx context.Context) error {
+	if t.service == nil {
+		return nil
+	}
+
+	removed, err := t.service.ExpireStale(ctx)
+	if removed > 0 {
+		logger.Info("Expired attachment uploads removed", "count", removed)
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/JadenRazo/Project-Website/backend/internal/messaging/digest"
+)
+
+// EmailDigestTask emails users the digests of unread messages and mentions
+// they chose in their notification settings
+type EmailDigestTask struct {
+	service *digest.Service
+}
+
+// NewEmailDigestTask creates a new email digest task. The service is
+// injected later since it needs the API's mailer and repositories.
+func NewEmailDigestTask() *EmailDigestTask {
+	return &EmailDigestTask{}
+}
+
+// SetService sets the service whose digests the task sends
+func (t *EmailDigestTask) SetService(service *digest.Service) {
+	t.service = service
+}
+
+// Send sends every digest that is due
+func (t *EmailDigestTask) Send(ctx context.Context) error {
+	if t.service == nil {
+		return nil
+	}
+
+	report, err := t.service.Run(ctx)
+	if report != nil && (report.Sent > 0 || report.Failed > 0) {
+		logger.Info("Email digests sent",
+			"candidates", report.Candidates,
+			"sent", report.Sent,
+			"failed", report.Failed,
+		)
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	msgretention "github.com/JadenRazo/Project-Website/backend/internal/messaging/retention"
+)
+
+// MessageRetentionTask applies the retention policy of every messaging
+// channel
+type MessageRetentionTask struct {
+	enforcer *msgretention.Enforcer
+}
+
+// NewMessageRetentionTask creates a new message retention task. The
+// enforcer is injected later since its defaults come from the API's
+// configuration.
+func NewMessageRetentionTask() *MessageRetentionTask {
+	return &MessageRetentionTask{}
+}
+
+// SetEnforcer sets the enforcer the task runs
+func (t *MessageRetentionTask) SetEnforcer(enforcer *msgretention.Enforcer) {
+	t.enforcer = enforcer
+}
+
+// Enforce removes messages older than their channel's retention period
+func (t *MessageRetentionTask) Enforce(ctx context.Context) error {
+	if t.enforcer == nil {
+		return nil
+	}
+
+	report, err := t.enforcer.Run(ctx, false)
+	if report != nil {
+		failed := 0
+		for _, result := range report.Channels {
+			if result.Error != "" {
+				failed++
+				logger.Error("Failed to enforce message retention", "channel_id", result.ChannelID, "error", result.Error)
+			}
+		}
+		logger.Info("Message retention run finished",
+			"mode", report.Mode,
+			"channels", len(report.Channels),
+			"failed_channels", failed,
+			"messages", report.Messages,
+		)
+	}
+	return err
+}
@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"context"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
+)
+
+// privacyRequestBatchSize bounds how many requests are fulfilled per run
+const privacyRequestBatchSize = 20
+
+// PrivacyRequestTask fulfils verified data subject requests
+type PrivacyRequestTask struct {
+	service *visitor.PrivacyRequestService
+}
+
+// NewPrivacyRequestTask creates a new privacy request task. The request
+// service is injected later since it is owned by the visitor service.
+func NewPrivacyRequestTask() *PrivacyRequestTask {
+	return &PrivacyRequestTask{}
+}
+
+// SetService sets the privacy request service to process
+func (t *PrivacyRequestTask) SetService(service *visitor.PrivacyRequestService) {
+	t.service = service
+}
+
+// ProcessPending builds exports and performs erasures for verified requests
+func (t *PrivacyRequestTask) ProcessPending(ctx context.Context) error {
+	if t.service == nil {
+		return nil
+	}
+
+	processed, err := t.service.ProcessPending(ctx, privacyRequestBatchSize)
+	if err != nil {
+		return err
+	}
+
+	if processed > 0 {
+		logger.Info("Privacy requests fulfilled", "count", processed)
+	}
+	return nil
+}
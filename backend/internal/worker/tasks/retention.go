@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/JadenRazo/Project-Website/backend/internal/contact"
+	"github.com/JadenRazo/Project-Website/backend/internal/retention"
+	"github.com/JadenRazo/Project-Website/backend/internal/status"
+	"github.com/JadenRazo/Project-Website/backend/internal/urlshortener"
+	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
+)
+
+// RetentionTask enforces the retention rules registered by each package
+type RetentionTask struct {
+	engine *retention.Engine
+}
+
+// NewRetentionTask creates a retention task with every package's datasets
+// registered
+func NewRetentionTask(db *gorm.DB) *RetentionTask {
+	engine := retention.NewEngine(db, retention.Options{})
+
+	datasets := [][]retention.Dataset{
+		visitor.RetentionDatasets(visitor.NewConfigService(db)),
+		urlshortener.RetentionDatasets(),
+		contact.RetentionDatasets(),
+		status.RetentionDatasets(),
+	}
+	for _, ds := range datasets {
+		if err := engine.Register(ds...); err != nil {
+			logger.Error("Failed to register retention datasets", "error", err)
+		}
+	}
+
+	return &RetentionTask{engine: engine}
+}
+
+// Engine returns the underlying retention engine so manual runs share the
+// same registry and run lock
+func (t *RetentionTask) Engine() *retention.Engine {
+	return t.engine
+}
+
+// EnforceRetention deletes expired rows from every registered dataset
+func (t *RetentionTask) EnforceRetention(ctx context.Context) error {
+	run, err := t.engine.Run(ctx, false, "scheduled")
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Retention run finished",
+		"run_id", run.ID,
+		"status", run.Status,
+		"rows_deleted", run.TotalRows,
+	)
+	return nil
+}
@@ -2,18 +2,31 @@ package tasks
 
 import (
 	"context"
+	"time"
 
 	"github.com/JadenRazo/Project-Website/backend/internal/codestats"
 	"github.com/JadenRazo/Project-Website/backend/internal/codestats/projectpath/repository"
 	"github.com/JadenRazo/Project-Website/backend/internal/common/logger"
+	"github.com/JadenRazo/Project-Website/backend/internal/worker/queue"
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 )
 
+// completedJobRetention is how long finished jobs stay in the queue table
+const completedJobRetention = 7 * 24 * time.Hour
+
 type ScheduledTasks struct {
 	cron               *cron.Cron
 	codeStatsService   *codestats.Service
 	visitorMetricsTask *VisitorMetricsTask
+	visitorGoalsTask   *VisitorGoalsTask
+	retentionTask      *RetentionTask
+	privacyRequestTask *PrivacyRequestTask
+	uploadTask         *AttachmentUploadTask
+	attachmentGCTask   *AttachmentGCTask
+	messageRetention   *MessageRetentionTask
+	emailDigests       *EmailDigestTask
+	jobQueue           *queue.Queue
 }
 
 func NewScheduledTasks(db *gorm.DB) *ScheduledTasks {
@@ -23,6 +36,14 @@ func NewScheduledTasks(db *gorm.DB) *ScheduledTasks {
 		cron:               cron.New(cron.WithSeconds()),
 		codeStatsService:   codestats.NewService(db, projectPathRepo),
 		visitorMetricsTask: NewVisitorMetricsTask(db),
+		visitorGoalsTask:   NewVisitorGoalsTask(db),
+		retentionTask:      NewRetentionTask(db),
+		privacyRequestTask: NewPrivacyRequestTask(),
+		uploadTask:         NewAttachmentUploadTask(),
+		attachmentGCTask:   NewAttachmentGCTask(),
+		messageRetention:   NewMessageRetentionTask(),
+		emailDigests:       NewEmailDigestTask(),
+		jobQueue:           queue.New(db),
 	}
 }
 
@@ -84,12 +105,109 @@ func (st *ScheduledTasks) Start(ctx context.Context) error {
 		logger.Error("Failed to schedule old metrics cleanup", "error", err)
 	}
 
+	_, err = st.cron.AddFunc("0 10 * * * *", func() {
+		if err := st.visitorGoalsTask.AggregateToday(ctx); err != nil {
+			logger.Error("Failed to aggregate visitor goals", "error", err)
+		} else {
+			logger.Info("Visitor goals and funnels aggregated successfully")
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule visitor goals aggregation", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 15 0 * * *", func() {
+		if err := st.visitorGoalsTask.FinalizeYesterday(ctx); err != nil {
+			logger.Error("Failed to finalize visitor goals", "error", err)
+		} else {
+			logger.Info("Visitor goals and funnels finalized for yesterday")
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule visitor goals finalization", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 30 3 * * *", func() {
+		if err := st.retentionTask.EnforceRetention(ctx); err != nil {
+			logger.Error("Failed to enforce data retention", "error", err)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule data retention", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 */5 * * * *", func() {
+		if err := st.privacyRequestTask.ProcessPending(ctx); err != nil {
+			logger.Error("Failed to process privacy requests", "error", err)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule privacy request processing", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 45 3 * * *", func() {
+		purged, err := st.jobQueue.Purge(ctx, time.Now().Add(-completedJobRetention))
+		if err != nil {
+			logger.Error("Failed to purge completed jobs", "error", err)
+		} else if purged > 0 {
+			logger.Info("Completed jobs purged", "count", purged)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule job purge", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 */15 * * * *", func() {
+		if err := st.uploadTask.ExpireStale(ctx); err != nil {
+			logger.Error("Failed to expire attachment uploads", "error", err)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule attachment upload expiry", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 15 4 * * *", func() {
+		if err := st.attachmentGCTask.Collect(ctx); err != nil {
+			logger.Error("Failed to collect attachment garbage", "error", err)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule attachment garbage collection", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 0 4 * * *", func() {
+		if err := st.messageRetention.Enforce(ctx); err != nil {
+			logger.Error("Failed to enforce message retention", "error", err)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule message retention", "error", err)
+	}
+
+	_, err = st.cron.AddFunc("0 5 * * * *", func() {
+		if err := st.emailDigests.Send(ctx); err != nil {
+			logger.Error("Failed to send email digests", "error", err)
+		}
+	})
+	if err != nil {
+		logger.Error("Failed to schedule email digests", "error", err)
+	}
+
 	logger.Info("Visitor analytics scheduled tasks registered",
 		"hourly_aggregation", "0 0 * * * *",
 		"daily_summary", "0 5 0 * * *",
 		"session_cleanup", "0 0 */6 * * *",
 		"location_aggregates", "0 0 2 * * *",
 		"metrics_cleanup", "0 0 3 * * 0",
+		"goals_aggregation", "0 10 * * * *",
+		"goals_finalize", "0 15 0 * * *",
+		"data_retention", "0 30 3 * * *",
+		"privacy_requests", "0 */5 * * * *",
+		"job_purge", "0 45 3 * * *",
+		"upload_expiry", "0 */15 * * * *",
+		"attachment_gc", "0 15 4 * * *",
+		"message_retention", "0 0 4 * * *",
+		"email_digests", "0 5 * * * *",
 	)
 
 	st.cron.Start()
@@ -102,6 +220,36 @@ func (st *ScheduledTasks) Start(ctx context.Context) error {
 	return nil
 }
 
+// RetentionTask returns the data retention task
+func (st *ScheduledTasks) RetentionTask() *RetentionTask {
+	return st.retentionTask
+}
+
+// PrivacyRequestTask returns the data subject request task
+func (st *ScheduledTasks) PrivacyRequestTask() *PrivacyRequestTask {
+	return st.privacyRequestTask
+}
+
+// AttachmentUploadTask returns the resumable upload expiry task
+func (st *ScheduledTasks) AttachmentUploadTask() *AttachmentUploadTask {
+	return st.uploadTask
+}
+
+// AttachmentGCTask returns the attachment garbage collection task
+func (st *ScheduledTasks) AttachmentGCTask() *AttachmentGCTask {
+	return st.attachmentGCTask
+}
+
+// MessageRetentionTask returns the messaging channel retention task
+func (st *ScheduledTasks) MessageRetentionTask() *MessageRetentionTask {
+	return st.messageRetention
+}
+
+// EmailDigestTask returns the messaging email digest task
+func (st *ScheduledTasks) EmailDigestTask() *EmailDigestTask {
+	return st.emailDigests
+}
+
 func (st *ScheduledTasks) Stop() {
 	if st.cron != nil {
 		st.cron.Stop()
@@ -0,0 +1,33 @@
+package tasks
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/JadenRazo/Project-Website/backend/internal/visitor"
+)
+
+// VisitorGoalsTask precomputes goal conversions and funnel drop-off
+type VisitorGoalsTask struct {
+	aggregator *visitor.GoalAggregator
+}
+
+// NewVisitorGoalsTask creates a new visitor goals task
+func NewVisitorGoalsTask(db *gorm.DB) *VisitorGoalsTask {
+	compliance := visitor.NewComplianceService(db, visitor.NewConfigService(db))
+	return &VisitorGoalsTask{
+		aggregator: visitor.NewGoalAggregator(db, compliance),
+	}
+}
+
+// AggregateToday refreshes today's goal and funnel results
+func (t *VisitorGoalsTask) AggregateToday(ctx context.Context) error {
+	return t.aggregator.AggregateDay(ctx, time.Now())
+}
+
+// FinalizeYesterday recomputes yesterday's results once the day is complete
+func (t *VisitorGoalsTask) FinalizeYesterday(ctx context.Context) error {
+	return t.aggregator.AggregateDay(ctx, time.Now().AddDate(0, 0, -1))
+}
@@ -70,11 +70,14 @@ func (t *VisitorMetricsTask) AggregateHourlyMetrics(ctx context.Context) error {
 		bounceRate = float64(bouncedSessions) / float64(totalSessions) * 100
 	}
 
-	// Count new vs returning visitors
+	// Count new vs returning visitors. Cookieless hashes rotate at midnight
+	// UTC, so those sessions can only be linked to earlier ones from the same
+	// day and are otherwise counted as new.
+	dayStart := hourStart.UTC().Truncate(24 * time.Hour)
 	var newVisitors int64
 	t.db.Model(&visitor.VisitorSession{}).
 		Where("created_at >= ? AND created_at < ?", hourStart, hourEnd).
-		Where("session_hash NOT IN (SELECT DISTINCT session_hash FROM visitor_sessions WHERE created_at < ?)", hourStart).
+		Where("session_hash NOT IN (SELECT DISTINCT session_hash FROM visitor_sessions WHERE created_at < ? AND (cookieless = false OR created_at >= ?))", hourStart, dayStart).
 		Count(&newVisitors)
 
 	returningVisitors := uniqueVisitors - newVisitors
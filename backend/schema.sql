@@ -1280,3 +1280,507 @@ CREATE INDEX IF NOT EXISTS idx_posts_slug ON posts(slug);
 CREATE INDEX IF NOT EXISTS idx_posts_status ON posts(status);
 CREATE INDEX IF NOT EXISTS idx_posts_published_at ON posts(published_at DESC);
 CREATE INDEX IF NOT EXISTS idx_posts_is_featured ON posts(is_featured) WHERE is_featured = true;
+
+-- =============================================
+-- VISITOR GOALS AND FUNNELS
+-- =============================================
+
+-- Conversion goals matched by page path pattern or custom event name
+CREATE TABLE IF NOT EXISTS visitor_goals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    goal_type VARCHAR(20) NOT NULL CHECK (goal_type IN ('path', 'event')),
+    pattern VARCHAR(255) NOT NULL, -- "/blog/**", "/contact" or an event name
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Multi-step funnels evaluated in order per session
+CREATE TABLE IF NOT EXISTS visitor_funnels (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    steps JSONB NOT NULL DEFAULT '[]', -- [{"name": "Read post", "type": "path", "pattern": "/blog/**"}, ...]
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Daily goal conversions precomputed by the worker
+CREATE TABLE IF NOT EXISTS visitor_goal_conversions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    goal_id UUID NOT NULL REFERENCES visitor_goals(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    sessions INTEGER DEFAULT 0,
+    conversions INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(goal_id, date)
+);
+
+-- Daily funnel step counts precomputed by the worker
+CREATE TABLE IF NOT EXISTS visitor_funnel_results (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    funnel_id UUID NOT NULL REFERENCES visitor_funnels(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    sessions INTEGER DEFAULT 0,
+    step_counts JSONB DEFAULT '[]', -- sessions reaching each step, in order
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(funnel_id, date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_visitor_goal_conversions_goal_date ON visitor_goal_conversions(goal_id, date DESC);
+CREATE INDEX IF NOT EXISTS idx_visitor_funnel_results_funnel_date ON visitor_funnel_results(funnel_id, date DESC);
+CREATE INDEX IF NOT EXISTS idx_page_views_session_created ON page_views(session_id, created_at);
+
+DROP TRIGGER IF EXISTS update_visitor_goals_updated_at ON visitor_goals;
+CREATE TRIGGER update_visitor_goals_updated_at BEFORE UPDATE ON visitor_goals
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_visitor_funnels_updated_at ON visitor_funnels;
+CREATE TRIGGER update_visitor_funnels_updated_at BEFORE UPDATE ON visitor_funnels
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- =============================================
+-- VISITOR CUSTOM EVENTS
+-- =============================================
+
+-- Custom events recorded through POST /visitor/event (consent-gated)
+CREATE TABLE IF NOT EXISTS visitor_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_hash VARCHAR(64) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    category VARCHAR(50),
+    value DOUBLE PRECISION,
+    path VARCHAR(255),
+    event_data JSONB DEFAULT '{}', -- flat map of scalar properties, max 20 keys
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit trail for consent changes and erasure requests
+CREATE TABLE IF NOT EXISTS consent_audit_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_hash VARCHAR(64),
+    action VARCHAR(100),
+    details JSONB,
+    timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    ip_address VARCHAR(64),
+    user_agent TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_visitor_events_session ON visitor_events(session_hash);
+CREATE INDEX IF NOT EXISTS idx_visitor_events_created_at ON visitor_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_visitor_events_type_created ON visitor_events(event_type, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_consent_audit_logs_session ON consent_audit_logs(session_hash);
+
+-- =============================================
+-- VISITOR ACQUISITION ATTRIBUTION
+-- =============================================
+
+-- Channel and UTM parameters, stored on the first page view of each session
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS channel VARCHAR(20); -- search, social, email, direct, referral
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_source VARCHAR(255);
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_medium VARCHAR(255);
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_campaign VARCHAR(255);
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_term VARCHAR(255);
+ALTER TABLE page_views ADD COLUMN IF NOT EXISTS utm_content VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_page_views_channel_created ON page_views(created_at, channel) WHERE channel IS NOT NULL AND channel <> '';
+
+-- =============================================
+-- DATA RETENTION
+-- =============================================
+
+-- Audit record for every retention run (scheduled, manual or dry-run)
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    dry_run BOOLEAN NOT NULL DEFAULT false,
+    trigger VARCHAR(50) NOT NULL, -- scheduled, devpanel, visitor.compliance
+    status VARCHAR(20) NOT NULL CHECK (status IN ('completed', 'failed')),
+    total_rows BIGINT DEFAULT 0,
+    results JSONB DEFAULT '[]', -- per-dataset cutoff, rows, batches, duration and error
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_retention_runs_started_at ON retention_runs(started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_privacy_consents_created_at ON privacy_consents(created_at);
+CREATE INDEX IF NOT EXISTS idx_consent_audit_logs_timestamp ON consent_audit_logs(timestamp);
+
+-- =============================================
+-- PRIVACY DATA SUBJECT REQUESTS
+-- =============================================
+
+-- GDPR access/erasure requests: submitted -> verified -> fulfilled
+CREATE TABLE IF NOT EXISTS privacy_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    request_type VARCHAR(20) NOT NULL CHECK (request_type IN ('export', 'erasure')),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('submitted', 'verified', 'fulfilled', 'rejected', 'expired')),
+    verify_method VARCHAR(20) NOT NULL CHECK (verify_method IN ('session', 'email')),
+    subject_hash VARCHAR(64) NOT NULL, -- sha256 of the session hash or lowercased email
+    session_hash VARCHAR(64),
+    email VARCHAR(255),
+    export_format VARCHAR(10),
+    export_path TEXT,
+    export_expires_at TIMESTAMP WITH TIME ZONE,
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    notes TEXT,
+    submitted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    fulfilled_at TIMESTAMP WITH TIME ZONE,
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL, -- 30-day legal response deadline
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_privacy_requests_status_due ON privacy_requests(status, due_at);
+CREATE INDEX IF NOT EXISTS idx_privacy_requests_export_expires ON privacy_requests(export_expires_at) WHERE export_path IS NOT NULL AND export_path <> '';
+
+-- =============================================
+-- COOKIELESS VISITOR MODE
+-- =============================================
+
+-- Sessions hashed with a daily-rotating salt; they cannot be linked across days
+ALTER TABLE visitor_sessions ADD COLUMN IF NOT EXISTS cookieless BOOLEAN DEFAULT false;
+
+-- =============================================
+-- WEB VITALS
+-- =============================================
+
+-- Hourly percentiles of browser-reported LCP, INP, CLS, TTFB and FCP
+CREATE TABLE IF NOT EXISTS web_vital_rollups (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    device_type VARCHAR(50) NOT NULL,
+    metric VARCHAR(10) NOT NULL CHECK (metric IN ('LCP', 'INP', 'CLS', 'TTFB', 'FCP')),
+    samples INTEGER NOT NULL,
+    p50 DOUBLE PRECISION NOT NULL,
+    p75 DOUBLE PRECISION NOT NULL,
+    p95 DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_web_vital_rollups_bucket ON web_vital_rollups(hour, path, device_type, metric);
+
+-- =============================================
+-- CODE STATISTICS HISTORY
+-- =============================================
+
+-- Per-project snapshots, written only when a project's numbers change
+CREATE TABLE IF NOT EXISTS code_stats_snapshots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    project_name VARCHAR(255) NOT NULL,
+    files INTEGER DEFAULT 0,
+    lines BIGINT DEFAULT 0,
+    code BIGINT DEFAULT 0,
+    comments BIGINT DEFAULT 0,
+    blanks BIGINT DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_stats_snapshots_project_created ON code_stats_snapshots(project_path_id, created_at DESC);
+
+-- Per-language numbers of each snapshot
+CREATE TABLE IF NOT EXISTS code_stats_language_snapshots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    snapshot_id UUID NOT NULL REFERENCES code_stats_snapshots(id) ON DELETE CASCADE,
+    project_path_id UUID NOT NULL,
+    language VARCHAR(100) NOT NULL,
+    files INTEGER DEFAULT 0,
+    lines BIGINT DEFAULT 0,
+    code BIGINT DEFAULT 0,
+    comments BIGINT DEFAULT 0,
+    blanks BIGINT DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_stats_language_snapshots_snapshot ON code_stats_language_snapshots(snapshot_id);
+CREATE INDEX IF NOT EXISTS idx_code_stats_language_snapshots_language ON code_stats_language_snapshots(LOWER(language), created_at);
+
+-- =============================================
+-- CODE GIT HISTORY
+-- =============================================
+
+-- Last commit read from each repository below a project path; repo is the
+-- path relative to the project ('' for the project root)
+CREATE TABLE IF NOT EXISTS code_git_sync_state (
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    repo TEXT NOT NULL DEFAULT '',
+    last_commit VARCHAR(64) NOT NULL,
+    commits INTEGER DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_path_id, repo)
+);
+
+CREATE TABLE IF NOT EXISTS code_git_daily (
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    repo TEXT NOT NULL DEFAULT '',
+    day DATE NOT NULL,
+    commits INTEGER DEFAULT 0,
+    additions BIGINT DEFAULT 0,
+    deletions BIGINT DEFAULT 0,
+    PRIMARY KEY (project_path_id, repo, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_git_daily_day ON code_git_daily(day);
+
+-- Weeks start on Monday
+CREATE TABLE IF NOT EXISTS code_git_language_churn (
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    repo TEXT NOT NULL DEFAULT '',
+    week DATE NOT NULL,
+    language VARCHAR(100) NOT NULL,
+    additions BIGINT DEFAULT 0,
+    deletions BIGINT DEFAULT 0,
+    PRIMARY KEY (project_path_id, repo, week, language)
+);
+
+CREATE TABLE IF NOT EXISTS code_git_file_churn (
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    repo TEXT NOT NULL DEFAULT '',
+    path TEXT NOT NULL,
+    language VARCHAR(100),
+    changes INTEGER DEFAULT 0,
+    additions BIGINT DEFAULT 0,
+    deletions BIGINT DEFAULT 0,
+    last_changed_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (project_path_id, repo, path)
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_git_file_churn_changes ON code_git_file_churn(changes DESC);
+
+-- Authors are identified by a SHA-256 of their lowercased email
+CREATE TABLE IF NOT EXISTS code_git_contributors (
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    repo TEXT NOT NULL DEFAULT '',
+    author_hash VARCHAR(64) NOT NULL,
+    commits INTEGER DEFAULT 0,
+    first_commit_at TIMESTAMP WITH TIME ZONE,
+    last_commit_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (project_path_id, repo, author_hash)
+);
+
+-- =============================================
+-- CODE DEPENDENCY INVENTORY
+-- =============================================
+
+-- Dependencies of each project, replaced on every stats update; manifest is
+-- relative to the project path
+CREATE TABLE IF NOT EXISTS code_dependencies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_path_id UUID NOT NULL REFERENCES project_paths(id) ON DELETE CASCADE,
+    manifest TEXT NOT NULL,
+    ecosystem VARCHAR(20) NOT NULL CHECK (ecosystem IN ('go', 'npm', 'cargo', 'pypi')),
+    name VARCHAR(255) NOT NULL,
+    version VARCHAR(100),
+    direct BOOLEAN DEFAULT false,
+    dev BOOLEAN DEFAULT false,
+    license VARCHAR(255),
+    copyleft BOOLEAN DEFAULT false,
+    latest_version VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_dependencies_project ON code_dependencies(project_path_id);
+CREATE INDEX IF NOT EXISTS idx_code_dependencies_copyleft ON code_dependencies(ecosystem, name) WHERE copyleft = true;
+
+-- Licences and newest versions learnt from local module caches, lock files
+-- and install directories
+CREATE TABLE IF NOT EXISTS code_dependency_metadata (
+    ecosystem VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    license VARCHAR(255),
+    latest_version VARCHAR(100),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (ecosystem, name)
+);
+
+-- =============================================
+-- BACKGROUND JOB QUEUE
+-- =============================================
+
+-- Jobs claimed by workers with FOR UPDATE SKIP LOCKED; a processing job
+-- whose lock is older than the lock timeout is claimed again
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    type VARCHAR(100) NOT NULL,
+    payload BYTEA,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+    priority INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs(type, priority DESC, run_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_locked ON jobs(locked_at) WHERE status = 'processing';
+CREATE INDEX IF NOT EXISTS idx_jobs_completed ON jobs(completed_at) WHERE status = 'completed';
+
+-- =============================================
+-- RESUMABLE ATTACHMENT UPLOADS
+-- =============================================
+
+-- tus uploads in progress; received bytes are stored as multipart upload
+-- parts, bytes short of a full part as a tail object
+CREATE TABLE IF NOT EXISTS attachment_uploads (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel_id UUID NOT NULL REFERENCES messaging_channels(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255),
+    upload_length BIGINT NOT NULL CHECK (upload_length > 0),
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    storage_key VARCHAR(512) NOT NULL,
+    multipart_id VARCHAR(512) NOT NULL,
+    parts JSONB NOT NULL DEFAULT '[]',
+    tail_size BIGINT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    attachment_id UUID REFERENCES messaging_attachments(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_uploads_user_id ON attachment_uploads(user_id);
+CREATE INDEX IF NOT EXISTS idx_attachment_uploads_expires_at ON attachment_uploads(expires_at);
+
+-- Attachment files and their processing. Uploads stay quarantined until
+-- scan_status is clean; images are served once processing_status is
+-- complete, with the metadata of the original stripped.
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS uploaded_by UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS storage_key VARCHAR(512);
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS blurhash VARCHAR(100);
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS thumbnail_url VARCHAR(500);
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS preview_url VARCHAR(500);
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS thumbnail_key VARCHAR(512);
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS preview_key VARCHAR(512);
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS processing_status VARCHAR(20) DEFAULT 'complete';
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS scan_status VARCHAR(20) DEFAULT 'clean';
+ALTER TABLE messaging_attachments ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255);
+
+-- =============================================
+-- MESSAGE RETENTION POLICIES
+-- =============================================
+
+-- Per-channel message retention; retention_days of 0 uses the server-wide
+-- default and -1 keeps messages forever. A legal hold suspends deletion.
+CREATE TABLE IF NOT EXISTS messaging_retention_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    channel_id UUID NOT NULL UNIQUE REFERENCES messaging_channels(id) ON DELETE CASCADE,
+    retention_days INTEGER NOT NULL DEFAULT 0 CHECK (retention_days >= -1),
+    legal_hold BOOLEAN NOT NULL DEFAULT false,
+    legal_hold_reason TEXT,
+    legal_hold_since TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Expired messages are found per channel by age, and what is attached to
+-- them by message
+CREATE INDEX IF NOT EXISTS idx_messaging_messages_channel_created ON messaging_messages(channel_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messaging_messages_parent_id ON messaging_messages(parent_id) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messaging_reactions_message_id ON messaging_reactions(message_id);
+CREATE INDEX IF NOT EXISTS idx_messaging_pinned_messages_message_id ON messaging_pinned_messages(message_id);
+CREATE INDEX IF NOT EXISTS idx_messaging_attachments_message_id ON messaging_attachments(message_id);
+CREATE INDEX IF NOT EXISTS idx_messaging_embeds_message_id ON messaging_embeds(message_id);
+CREATE INDEX IF NOT EXISTS idx_messaging_read_receipts_last_message_id ON messaging_read_receipts(last_message_id);
+
+-- =============================================
+-- MESSAGE SEARCH
+-- =============================================
+
+-- Full-text search over message content, kept in sync by Postgres. The
+-- text search configuration must match the one the search repository
+-- queries with.
+ALTER TABLE messaging_messages
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', coalesce(content, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_messaging_messages_search_vector ON messaging_messages USING GIN (search_vector);
+
+-- =============================================
+-- WEB PUSH SUBSCRIPTIONS
+-- =============================================
+
+-- Browser push subscriptions of messaging users; p256dh and auth are the
+-- base64url encoded keys pushes are encrypted with
+CREATE TABLE IF NOT EXISTS messaging_push_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh VARCHAR(255) NOT NULL,
+    auth VARCHAR(255) NOT NULL,
+    user_agent TEXT,
+    last_push_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messaging_push_subscriptions_user_id ON messaging_push_subscriptions(user_id);
+
+-- =============================================
+-- EMAIL DIGESTS
+-- =============================================
+
+-- When each user was last emailed a digest of their unread messages and
+-- mentions; the digest frequency itself is a notification setting
+CREATE TABLE IF NOT EXISTS messaging_email_digests (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_sent_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- =============================================
+-- MESSAGING SETTINGS AND NOTIFICATIONS
+-- =============================================
+
+-- Each user's messaging settings; every group of settings is a JSON
+-- document, and a group the user never saved is NULL
+CREATE TABLE IF NOT EXISTS messaging_user_settings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    theme VARCHAR(50),
+    language VARCHAR(20),
+    notification_settings JSONB,
+    privacy_settings JSONB,
+    message_settings JSONB,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Mentions, direct messages and other events users are notified of. The
+-- channel and message are not foreign keys, since the messaging API keeps
+-- its messages outside messaging_messages.
+CREATE TABLE IF NOT EXISTS messaging_notifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL CHECK (type IN ('new_message', 'channel_invite', 'mention', 'reaction')),
+    channel_id UUID,
+    message_id UUID,
+    sender_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    content TEXT NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_messaging_notifications_user ON messaging_notifications(user_id, is_read, created_at DESC);
+
+-- =============================================
+-- MESSAGING WEBSOCKET HUB IDS
+-- =============================================
+
+-- The WebSocket hub routes events by number; each messaging user and
+-- channel it sees is given one the first time, shared by every instance
+CREATE TABLE IF NOT EXISTS messaging_hub_ids (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('user', 'channel')),
+    entity_id UUID NOT NULL,
+    UNIQUE(kind, entity_id)
+);
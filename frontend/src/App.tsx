@@ -36,6 +36,10 @@ const ProjectsPage = lazy(() => import('./pages/Projects'));
 const Status = lazy(() => import('./pages/Status/Status'));
 const BlogPage = lazy(() => import('./pages/Blog/Blog'));
 const BlogPostPage = lazy(() => import('./pages/Blog/BlogPost'));
+const PrivacyRequestVerify = lazy(() => import('./pages/Privacy/PrivacyRequestVerify'));
+const PrivacyExportDownload = lazy(() => import('./pages/Privacy/PrivacyExportDownload'));
+const DigestMarkRead = lazy(() => import('./pages/messaging/digest/DigestMarkRead'));
+const DigestUnsubscribe = lazy(() => import('./pages/messaging/digest/DigestUnsubscribe'));
 
 const AppContainer = styled.div`
   max-width: 100vw;
@@ -159,9 +163,14 @@ function AppContent() {
             <Route path="/devpanel" element={<DevPanel />} />
             <Route path="/urlshortener" element={<UrlShortener />} />
             <Route path="/messaging" element={<Messaging />} />
+            <Route path="/messaging/channels/:channelId" element={<Messaging />} />
+            <Route path="/messaging/digest/mark-read" element={<DigestMarkRead />} />
+            <Route path="/messaging/digest/unsubscribe" element={<DigestUnsubscribe />} />
             <Route path="/status" element={<Status />} />
             <Route path="/blog" element={<BlogPage />} />
             <Route path="/blog/:slug" element={<BlogPostPage />} />
+            <Route path="/privacy/requests/verify" element={<PrivacyRequestVerify />} />
+            <Route path="/privacy/requests/download" element={<PrivacyExportDownload />} />
 
             <Route path="*" element={<NotFound />} />
           </Routes>
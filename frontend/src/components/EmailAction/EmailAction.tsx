@@ -0,0 +1,155 @@
+import React, { useState } from 'react';
+import styled from 'styled-components';
+import { Link, useSearchParams } from 'react-router-dom';
+
+// Pages opened from links in emails. The signed token in the link is only
+// sent when the user confirms, so mail scanners that prefetch links cannot
+// trigger the action.
+
+const Container = styled.div`
+  min-height: 70vh;
+  display: flex;
+  justify-content: center;
+  align-items: center;
+  padding: ${({ theme }) => theme.spacing.xl};
+  background: ${({ theme }) => theme.colors.background};
+`;
+
+const Card = styled.div`
+  max-width: 480px;
+  width: 100%;
+  padding: ${({ theme }) => theme.spacing.xl};
+  background: ${({ theme }) => theme.colors.card};
+  border: 1px solid ${({ theme }) => theme.colors.border};
+  border-radius: ${({ theme }) => theme.borderRadius.large};
+  box-shadow: ${({ theme }) => theme.shadows.medium};
+  text-align: center;
+`;
+
+const Title = styled.h1`
+  font-size: 1.6rem;
+  color: ${({ theme }) => theme.colors.text};
+  margin: 0 0 ${({ theme }) => theme.spacing.md};
+`;
+
+const Text = styled.p`
+  color: ${({ theme }) => theme.colors.textSecondary};
+  line-height: 1.5;
+  margin: 0 0 ${({ theme }) => theme.spacing.lg};
+`;
+
+const Message = styled.p<{ $error?: boolean }>`
+  color: ${({ theme, $error }) => ($error ? theme.colors.error : theme.colors.success)};
+  margin: ${({ theme }) => theme.spacing.md} 0 0;
+`;
+
+const Button = styled.button`
+  background: ${({ theme }) => theme.colors.primary};
+  color: ${({ theme }) => theme.colors.textInverse};
+  border: none;
+  padding: ${({ theme }) => `${theme.spacing.sm} ${theme.spacing.lg}`};
+  border-radius: ${({ theme }) => theme.borderRadius.medium};
+  font-size: 1rem;
+  cursor: pointer;
+  text-decoration: none;
+  display: inline-block;
+
+  &:hover {
+    background: ${({ theme }) => theme.colors.primaryHover};
+  }
+
+  &:disabled {
+    opacity: 0.6;
+    cursor: not-allowed;
+  }
+`;
+
+const apiUrl = (path: string): string => {
+  const base = (window as any)._env_?.REACT_APP_API_URL || process.env.REACT_APP_API_URL || '';
+  return `${base}${path}`;
+};
+
+interface EmailActionProps {
+  title: string;
+  description: string;
+  confirmLabel: string;
+  // API endpoint the token is posted to as {"token": "..."}
+  endpoint?: string;
+  // API endpoint the token is passed to as ?token=, opened as a download
+  download?: string;
+  successMessage?: string;
+}
+
+type State = 'idle' | 'pending' | 'done' | 'failed';
+
+const EmailAction: React.FC<EmailActionProps> = ({
+  title,
+  description,
+  confirmLabel,
+  endpoint,
+  download,
+  successMessage,
+}) => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token') || '';
+  const [state, setState] = useState<State>('idle');
+  const [message, setMessage] = useState('');
+
+  const confirm = async () => {
+    if (!endpoint) {
+      return;
+    }
+    setState('pending');
+    try {
+      const response = await fetch(apiUrl(endpoint), {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ token }),
+      });
+      const data = await response.json().catch(() => ({}));
+      if (!response.ok) {
+        throw new Error(data.error || `Request failed with status ${response.status}`);
+      }
+      setState('done');
+      setMessage(data.message || successMessage || 'Done.');
+    } catch (err) {
+      setState('failed');
+      setMessage(err instanceof Error ? err.message : 'Something went wrong');
+    }
+  };
+
+  if (!token) {
+    return (
+      <Container>
+        <Card>
+          <Title>{title}</Title>
+          <Text>This link is missing its token. Please open the full link from the email.</Text>
+          <Link to="/">Back to home</Link>
+        </Card>
+      </Container>
+    );
+  }
+
+  return (
+    <Container>
+      <Card>
+        <Title>{title}</Title>
+        <Text>{description}</Text>
+        {download ? (
+          <Button as="a" href={apiUrl(`${download}?token=${encodeURIComponent(token)}`)}>
+            {confirmLabel}
+          </Button>
+        ) : (
+          state !== 'done' && (
+            <Button type="button" onClick={confirm} disabled={state === 'pending'}>
+              {state === 'pending' ? 'Working…' : confirmLabel}
+            </Button>
+          )
+        )}
+        {message && <Message $error={state === 'failed'}>{message}</Message>}
+      </Card>
+    </Container>
+  );
+};
+
+export default EmailAction;
@@ -6,11 +6,13 @@ import { ScrollableModal } from '../common/ScrollableModal';
 import { useInlineFormScroll } from '../../hooks/useInlineFormScroll';
 import { useCrudOperations } from '../../hooks/useCrudOperations';
 import {
+  CopyleftDependency,
   ProjectPath,
   ProjectPathFormData,
   defaultProjectPathFormData,
   mapProjectPathToFormData,
   projectPathsApi,
+  dependenciesApi,
 } from '../../utils/devPanelApi';
 
 const Container = styled.div`
@@ -211,6 +213,23 @@ const Pattern = styled.span`
   font-family: 'Courier New', monospace;
 `;
 
+const CopyleftWarning = styled.div`
+  margin-bottom: 1rem;
+  padding: 0.75rem;
+  background: ${({ theme }) => theme.colors.error}15;
+  border-left: 3px solid ${({ theme }) => theme.colors.error};
+  border-radius: 4px;
+  font-size: 0.75rem;
+  color: ${({ theme }) => theme.colors.text};
+`;
+
+const CopyleftLabel = styled.div`
+  font-weight: 500;
+  color: ${({ theme }) => theme.colors.error};
+  margin-bottom: 0.25rem;
+  font-size: 0.875rem;
+`;
+
 const PathActions = styled.div`
   display: flex;
   gap: 0.5rem;
@@ -409,6 +428,7 @@ export const ProjectPathsManager: React.FC = () => {
   const [patternInput, setPatternInput] = useState('');
   const [refreshingStats, setRefreshingStats] = useState(false);
   const [pendingRefreshes, setPendingRefreshes] = useState(new Set<string>());
+  const [copyleft, setCopyleft] = useState<CopyleftDependency[]>([]);
   
   // Scroll hooks and refs
   const { scrollToElement } = useScrollTo();
@@ -419,8 +439,21 @@ export const ProjectPathsManager: React.FC = () => {
 
   useEffect(() => {
     pathsCrud.fetchItems();
+    fetchCopyleft();
   }, []);
 
+  const fetchCopyleft = async () => {
+    try {
+      const data = await dependenciesApi.getCopyleft();
+      setCopyleft(data.dependencies || []);
+    } catch (err) {
+      console.warn('Failed to fetch copyleft dependencies:', err);
+    }
+  };
+
+  const copyleftFor = (pathId: string) =>
+    copyleft.filter((dep) => dep.projectIds.includes(pathId));
+
   // Removed fetchPaths - now handled by CRUD hook
 
   const refreshCodeStats = async (action?: string) => {
@@ -438,6 +471,7 @@ export const ProjectPathsManager: React.FC = () => {
       setRefreshingStats(true);
       
       await projectPathsApi.refreshStats(action);
+      fetchCopyleft();
       console.log('Code statistics refreshed successfully' + (action ? ` after ${action}` : ''));
     } catch (err) {
       console.warn('Error refreshing code stats:', err);
@@ -599,6 +633,17 @@ export const ProjectPathsManager: React.FC = () => {
                   </PatternsContainer>
                 )}
 
+                {copyleftFor(path.id).length > 0 && (
+                  <CopyleftWarning>
+                    <CopyleftLabel>Copyleft dependencies</CopyleftLabel>
+                    {copyleftFor(path.id).map((dep) => (
+                      <div key={`${dep.ecosystem}:${dep.name}`}>
+                        {dep.name} ({dep.license}){dep.direct ? '' : ' · transitive'}
+                      </div>
+                    ))}
+                  </CopyleftWarning>
+                )}
+
                 <PathActions>
                   <ActionButton variant="edit" onClick={() => handleEdit(path)}>
                     Edit
@@ -44,7 +44,21 @@ interface VisitorAnalyticsData {
 interface RealtimeData {
   type: string;
   path: string;
-  realtime: number;
+  channel?: string;
+  deviceType?: string;
+  countryCode?: string;
+  timestamp: string;
+}
+
+interface RealtimeUpdate {
+  type: 'realtime';
+  events: RealtimeData[];
+  dropped?: number;
+  snapshot: {
+    activeVisitors: number;
+    activePages: { page: string; count: number }[];
+    timestamp: string;
+  };
 }
 
 interface MetricsSummary {
@@ -322,12 +336,18 @@ const VisitorAnalytics: React.FC = () => {
     fetchTimelineData();
 
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-    const ws = new WebSocket(`${protocol}//${window.location.host}/ws/analytics`);
+    // Browsers cannot set headers on WebSocket handshakes, so the admin
+    // token is passed as a query parameter
+    const token = encodeURIComponent(localStorage.getItem('auth_token') || '');
+    const ws = new WebSocket(`${protocol}//${window.location.host}/ws/analytics?token=${token}`);
 
     ws.onmessage = (event) => {
-      const message = JSON.parse(event.data);
-      if (message.type === 'pageview') {
-        setState(prevState => ({ ...prevState, realtimeData: [...prevState.realtimeData, message] }));
+      const message = JSON.parse(event.data) as RealtimeUpdate;
+      if (message.type === 'realtime') {
+        setState(prevState => ({
+          ...prevState,
+          realtimeData: [...prevState.realtimeData, ...message.events].slice(-100),
+        }));
       }
     };
 
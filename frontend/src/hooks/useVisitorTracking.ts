@@ -1,10 +1,14 @@
 import { useEffect } from 'react';
 import { useLocation } from 'react-router-dom';
-import { trackPageView } from '../utils/visitorTracking';
+import { trackPageView, trackWebVitals } from '../utils/visitorTracking';
 
 export const useVisitorTracking = () => {
   const location = useLocation();
 
+  useEffect(() => {
+    trackWebVitals();
+  }, []);
+
   useEffect(() => {
     const path = location.pathname + location.search;
     trackPageView(path);
@@ -0,0 +1,14 @@
+import React from 'react';
+import EmailAction from '../../components/EmailAction/EmailAction';
+
+// Opened from the email sent when a data export is ready
+const PrivacyExportDownload: React.FC = () => (
+  <EmailAction
+    title="Your data export is ready"
+    description="Download the archive with the data we hold about you. The link expires on the date given in the email."
+    confirmLabel="Download export"
+    download="/api/v1/visitor/privacy/requests/download"
+  />
+);
+
+export default PrivacyExportDownload;
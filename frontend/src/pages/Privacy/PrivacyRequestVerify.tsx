@@ -0,0 +1,15 @@
+import React from 'react';
+import EmailAction from '../../components/EmailAction/EmailAction';
+
+// Opened from the verification email of a data subject request
+const PrivacyRequestVerify: React.FC = () => (
+  <EmailAction
+    title="Confirm your privacy request"
+    description="Confirm that you submitted this request for your data. We will start processing it once it is confirmed."
+    confirmLabel="Confirm request"
+    endpoint="/api/v1/visitor/privacy/requests/verify"
+    successMessage="Your request is confirmed. We will email you when it has been completed."
+  />
+);
+
+export default PrivacyRequestVerify;
@@ -1,5 +1,6 @@
 import React, { useState, useEffect, useRef } from 'react';
 import styled from 'styled-components';
+import { useParams } from 'react-router-dom';
 
 
 // Types
@@ -400,6 +401,8 @@ const createMockWebSocketEvents = (setChannels: React.Dispatch<React.SetStateAct
 
 // Main Component
 const Messaging: React.FC = () => {
+  // Set when opened from a link to a channel, such as in an email digest
+  const { channelId } = useParams<{ channelId?: string }>();
   // Ensure page scrolls to top when navigated to
   
   
@@ -517,12 +520,12 @@ const Messaging: React.FC = () => {
     }
   }, [messages, selectedChannel]);
 
-  // Select the first channel when channels are loaded
+  // Select the linked channel, or the first one, when channels are loaded
   useEffect(() => {
     if (channels.length > 0 && !selectedChannel) {
-      setSelectedChannel(channels[0]);
+      setSelectedChannel(channels.find(channel => channel.id === channelId) || channels[0]);
     }
-  }, [channels, selectedChannel]);
+  }, [channels, selectedChannel, channelId]);
 
   // Send a message
   const sendMessage = (e: React.FormEvent) => {
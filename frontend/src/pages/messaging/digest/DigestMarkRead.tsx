@@ -0,0 +1,15 @@
+import React from 'react';
+import EmailAction from '../../../components/EmailAction/EmailAction';
+
+// Opened from the mark as read link of an email digest
+const DigestMarkRead: React.FC = () => (
+  <EmailAction
+    title="Mark everything as read"
+    description="Mark all messages and mentions in your channels as read. Your next digest will only include what is posted after this."
+    confirmLabel="Mark as read"
+    endpoint="/api/v1/messaging/digest/mark-read"
+    successMessage="All messages marked as read."
+  />
+);
+
+export default DigestMarkRead;
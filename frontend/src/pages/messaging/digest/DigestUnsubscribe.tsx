@@ -0,0 +1,15 @@
+import React from 'react';
+import EmailAction from '../../../components/EmailAction/EmailAction';
+
+// Opened from the unsubscribe link of an email digest
+const DigestUnsubscribe: React.FC = () => (
+  <EmailAction
+    title="Unsubscribe from email digests"
+    description="Stop receiving emailed digests of your unread messages and mentions."
+    confirmLabel="Unsubscribe"
+    endpoint="/api/v1/messaging/digest/unsubscribe"
+    successMessage="You will no longer receive email digests."
+  />
+);
+
+export default DigestUnsubscribe;
@@ -121,6 +121,15 @@ export interface ProjectPathFormData {
   is_active: boolean;
 }
 
+export interface CopyleftDependency {
+  ecosystem: 'go' | 'npm' | 'cargo' | 'pypi';
+  name: string;
+  license: string;
+  direct: boolean;
+  projects: string[];
+  projectIds: string[];
+}
+
 export interface BlogPost {
   id: string;
   title: string;
@@ -372,6 +381,16 @@ export const projectPathsApi = {
   },
 };
 
+export const dependenciesApi = {
+  getCopyleft: async (): Promise<{ dependencies: CopyleftDependency[] }> => {
+    const response = await fetch(buildApiUrl('/api/v1/devpanel/dependencies/copyleft'), {
+      headers: getAuthHeaders(),
+    });
+    if (!response.ok) throw new Error('Failed to fetch copyleft dependencies');
+    return response.json();
+  },
+};
+
 // Form data mappers for each resource
 export const mapCertificationToFormData = (cert: Certification): CertificationFormData => ({
   name: cert.name,
@@ -77,6 +77,48 @@ export const trackPageView = async (path: string): Promise<void> => {
   }, 300);
 };
 
+let vitalsStarted = false;
+
+// trackWebVitals reports Core Web Vitals for the current page load. Metrics
+// are batched and sent with sendBeacon when the page is hidden, so the last
+// INP and CLS values are included.
+export const trackWebVitals = (): void => {
+  if (vitalsStarted || !isTrackingEnabled || typeof navigator.sendBeacon !== 'function') return;
+  vitalsStarted = true;
+
+  const metrics: Record<string, number> = {};
+  const path = window.location.pathname;
+
+  const flush = () => {
+    if (!isTrackingEnabled || Object.keys(metrics).length === 0) return;
+
+    const apiBaseUrl = getApiBaseUrl();
+    const vitalsUrl = apiBaseUrl ? `${apiBaseUrl}/api/v1/visitor/vitals` : '/api/v1/visitor/vitals';
+    navigator.sendBeacon(vitalsUrl, JSON.stringify({ path, metrics: { ...metrics } }));
+
+    for (const name of Object.keys(metrics)) {
+      delete metrics[name];
+    }
+  };
+
+  import('web-vitals').then(({ onCLS, onFCP, onINP, onLCP, onTTFB }) => {
+    const record = ({ name, value }: { name: string; value: number }) => {
+      metrics[name] = value;
+    };
+    onCLS(record);
+    onFCP(record);
+    onINP(record);
+    onLCP(record);
+    onTTFB(record);
+  });
+
+  document.addEventListener('visibilitychange', () => {
+    if (document.visibilityState === 'hidden') {
+      flush();
+    }
+  });
+};
+
 export const setTrackingEnabled = (enabled: boolean): void => {
   isTrackingEnabled = enabled;
 };